@@ -0,0 +1,407 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// Statuses of alerts.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// pagerDutyEventsURL is where alerts are sent to PagerDuty, with its Events
+// API v2.
+var pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// AlertRule is a condition on a topology, rendered with its default options,
+// which fires an alert for each of:
+//
+//   - the nodes matching the Nodes search query, by default;
+//   - the edges between nodes matching the From and To queries of Edges;
+//   - the parents in the CountBy topology, e.g. hosts, with more than Above
+//     nodes matching the Nodes query.
+//
+// An empty Nodes query matches all nodes.
+type AlertRule struct {
+	Name     string `yaml:"name"`
+	Topology string `yaml:"topology"`
+	Severity string `yaml:"severity"`
+	Nodes    string `yaml:"nodes"`
+	Edges    *struct {
+		From string `yaml:"from"`
+		To   string `yaml:"to"`
+	} `yaml:"edges"`
+	CountBy string `yaml:"countBy"`
+	Above   int    `yaml:"above"`
+
+	nodes, from, to detailed.Query
+}
+
+// Alert is the firing or resolution of an alert of a rule.
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Key      string    `json:"key"`
+	Summary  string    `json:"summary"`
+	Severity string    `json:"severity"`
+	Status   string    `json:"status"`
+	Time     time.Time `json:"time"`
+}
+
+// LoadAlertRules reads alerting rules from a YAML file, with a list of them
+// under a rules key.
+func LoadAlertRules(filename string) ([]AlertRule, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Rules []AlertRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(buf, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for i := range config.Rules {
+		if err := config.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	return config.Rules, nil
+}
+
+func (r *AlertRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rule without a name")
+	}
+	if _, ok := topologyRegistry.get(r.Topology); !ok {
+		return fmt.Errorf("alert rule %s: unknown topology %q", r.Name, r.Topology)
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	parse := func(q string) (detailed.Query, error) {
+		if q == "" {
+			return nil, nil
+		}
+		query, err := detailed.ParseQuery(q)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %v", r.Name, err)
+		}
+		return query, nil
+	}
+	var err error
+	if r.nodes, err = parse(r.Nodes); err != nil {
+		return err
+	}
+	if r.Edges != nil {
+		if r.from, err = parse(r.Edges.From); err != nil {
+			return err
+		}
+		if r.to, err = parse(r.Edges.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func alertMatches(q detailed.Query, n detailed.NodeSummary) bool {
+	return q == nil || q.Match(n)
+}
+
+// evaluate gives the summaries of the alerts of a rule on the nodes of its
+// topology, by key.
+func (r *AlertRule) evaluate(nodes detailed.NodeSummaries) map[string]string {
+	firing := map[string]string{}
+	switch {
+	case r.Edges != nil:
+		for _, n := range nodes {
+			if !alertMatches(r.from, n) {
+				continue
+			}
+			for _, adjacent := range n.Adjacency {
+				if to, ok := nodes[adjacent]; ok && alertMatches(r.to, to) {
+					firing[n.ID+"->"+to.ID] = fmt.Sprintf("%s: edge from %s to %s", r.Name, n.Label, to.Label)
+				}
+			}
+		}
+	case r.CountBy != "":
+		counts, labels := map[string]int{}, map[string]string{}
+		for _, n := range nodes {
+			if !alertMatches(r.nodes, n) {
+				continue
+			}
+			for _, parent := range n.Parents {
+				if parent.TopologyID == r.CountBy {
+					counts[parent.ID]++
+					labels[parent.ID] = parent.Label
+				}
+			}
+		}
+		for id, count := range counts {
+			if count > r.Above {
+				firing[id] = fmt.Sprintf("%s: %d %s on %s", r.Name, count, r.Topology, labels[id])
+			}
+		}
+	default:
+		for _, n := range nodes {
+			if alertMatches(r.nodes, n) {
+				firing[n.ID] = fmt.Sprintf("%s: %s", r.Name, n.Label)
+			}
+		}
+	}
+	return firing
+}
+
+// Alerter evaluates alerting rules on the reports of a Reporter every
+// interval, and notifies a sink of the alerts which fire and resolve.
+type Alerter struct {
+	reporter Reporter
+	rules    []AlertRule
+	sink     AlertSink
+	interval time.Duration
+	quit     chan struct{}
+	wait     sync.WaitGroup
+
+	mtx    sync.Mutex
+	active map[string]map[string]Alert // by rule, by key
+}
+
+// NewAlerter makes a new Alerter.
+func NewAlerter(reporter Reporter, rules []AlertRule, sink AlertSink, interval time.Duration) *Alerter {
+	a := &Alerter{
+		reporter: reporter,
+		rules:    rules,
+		sink:     sink,
+		interval: interval,
+		quit:     make(chan struct{}),
+		active:   map[string]map[string]Alert{},
+	}
+	a.wait.Add(1)
+	go a.loop()
+	return a
+}
+
+// Stop stops evaluating the rules.
+func (a *Alerter) Stop() {
+	close(a.quit)
+	a.wait.Wait()
+}
+
+func (a *Alerter) loop() {
+	defer a.wait.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.quit:
+			return
+		}
+		if err := a.evaluate(context.Background(), mtime.Now()); err != nil {
+			log.Warnf("Error evaluating alert rules: %v", err)
+		}
+	}
+}
+
+func (a *Alerter) evaluate(ctx context.Context, now time.Time) error {
+	rpt, err := a.reporter.Report(ctx, now)
+	if err != nil {
+		return err
+	}
+	rc := RenderContextForReporter(a.reporter, rpt)
+	var notifications []Alert
+	for i := range a.rules {
+		rule := &a.rules[i]
+		desc, ok := topologyRegistry.get(rule.Topology)
+		if !ok {
+			continue
+		}
+		renderer, decorator, err := topologyRegistry.RendererForTopology(rule.Topology, defaultOptions(desc), rpt)
+		if err != nil {
+			return err
+		}
+		firing := rule.evaluate(detailed.Summaries(rc, renderTopology(rule.Topology, renderer, decorator, rpt)))
+
+		a.mtx.Lock()
+		active := a.active[rule.Name]
+		next := map[string]Alert{}
+		for key, summary := range firing {
+			alert, ok := active[key]
+			if !ok {
+				alert = Alert{Rule: rule.Name, Key: key, Summary: summary, Severity: rule.Severity, Status: AlertFiring, Time: now}
+				notifications = append(notifications, alert)
+			}
+			next[key] = alert
+		}
+		for key, alert := range active {
+			if _, ok := firing[key]; !ok {
+				alert.Status, alert.Time = AlertResolved, now
+				notifications = append(notifications, alert)
+			}
+		}
+		a.active[rule.Name] = next
+		a.mtx.Unlock()
+	}
+
+	for _, alert := range notifications {
+		if err := a.sink.Notify(alert); err != nil {
+			log.Errorf("Error notifying alert %s of %s: %v", alert.Key, alert.Rule, err)
+		}
+	}
+	return nil
+}
+
+// Active gives the alerts which are firing, sorted by rule and key.
+func (a *Alerter) Active() []Alert {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	result := []Alert{}
+	for _, alerts := range a.active {
+		for _, alert := range alerts {
+			result = append(result, alert)
+		}
+	}
+	sort.Sort(alertsByRule(result))
+	return result
+}
+
+type alertsByRule []Alert
+
+func (a alertsByRule) Len() int      { return len(a) }
+func (a alertsByRule) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a alertsByRule) Less(i, j int) bool {
+	if a[i].Rule != a[j].Rule {
+		return a[i].Rule < a[j].Rule
+	}
+	return a[i].Key < a[j].Key
+}
+
+// RegisterAlertRoutes registers the route listing the firing alerts.
+func RegisterAlertRoutes(router *mux.Router, alerter *Alerter) {
+	router.Methods("GET").Path("/api/alerts").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, alerter.Active())
+		}))
+}
+
+// AlertSink is somewhere Alerts are notified.
+type AlertSink interface {
+	Notify(Alert) error
+}
+
+// AlertSinks notifies each AlertSink in turn.
+type AlertSinks []AlertSink
+
+// Notify implements AlertSink.
+func (as AlertSinks) Notify(alert Alert) error {
+	var errs []string
+	for _, a := range as {
+		if err := a.Notify(alert); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// NewAlertSink makes an AlertSink from a URL: http(s):// for a webhook each
+// alert is POSTed to, as JSON, slack://hooks.slack.com/services/... for a
+// Slack incoming webhook, and pagerduty://<routing key> for PagerDuty.
+func NewAlertSink(sinkURL string) (AlertSink, error) {
+	u, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	switch u.Scheme {
+	case "http", "https":
+		return &webhookAlertSink{url: sinkURL, client: client}, nil
+	case "slack":
+		u.Scheme = "https"
+		return &slackAlertSink{url: u.String(), client: client}, nil
+	case "pagerduty":
+		if u.Host == "" {
+			return nil, fmt.Errorf("PagerDuty alert sink '%s' has no routing key", sinkURL)
+		}
+		return &pagerDutyAlertSink{routingKey: u.Host, client: client}, nil
+	}
+	return nil, fmt.Errorf("Invalid alert sink '%s'", sinkURL)
+}
+
+func postAlert(client *http.Client, url string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+type webhookAlertSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookAlertSink) Notify(alert Alert) error {
+	return postAlert(s.client, s.url, alert)
+}
+
+type slackAlertSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *slackAlertSink) Notify(alert Alert) error {
+	return postAlert(s.client, s.url, map[string]string{
+		"text": fmt.Sprintf("[%s] %s", strings.ToUpper(alert.Status), alert.Summary),
+	})
+}
+
+type pagerDutyAlertSink struct {
+	routingKey string
+	client     *http.Client
+}
+
+func (s *pagerDutyAlertSink) Notify(alert Alert) error {
+	action := "trigger"
+	if alert.Status == AlertResolved {
+		action = "resolve"
+	}
+	return postAlert(s.client, pagerDutyEventsURL, map[string]interface{}{
+		"routing_key":  s.routingKey,
+		"event_action": action,
+		"dedup_key":    alert.Rule + "/" + alert.Key,
+		"payload": map[string]string{
+			"summary":   alert.Summary,
+			"source":    "scope",
+			"severity":  alert.Severity,
+			"timestamp": alert.Time.Format(time.RFC3339),
+		},
+	})
+}
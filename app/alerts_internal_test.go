@@ -0,0 +1,204 @@
+package app
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+type recordingAlertSink struct {
+	sync.Mutex
+	alerts []Alert
+}
+
+func (s *recordingAlertSink) Notify(alert Alert) error {
+	s.Lock()
+	defer s.Unlock()
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func (s *recordingAlertSink) take() []Alert {
+	s.Lock()
+	defer s.Unlock()
+	alerts := s.alerts
+	s.alerts = nil
+	sort.Sort(alertsByRule(alerts))
+	return alerts
+}
+
+func loadAlertRules(t *testing.T, rules string) []AlertRule {
+	f, err := ioutil.TempFile("", "alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(rules); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	result, err := LoadAlertRules(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestAlerter(t *testing.T) {
+	rules := loadAlertRules(t, `
+rules:
+- name: paused
+  topology: containers
+  nodes: state:paused
+  severity: critical
+- name: client-to-server
+  topology: containers
+  edges:
+    from: label:client
+    to: label:server
+- name: busy-hosts
+  topology: processes
+  countBy: hosts
+  above: 1
+`)
+	pausedReport := fixture.Report.Copy()
+	pausedReport.ID = "paused"
+	server := pausedReport.Container.Nodes[fixture.ServerContainerNodeID]
+	pausedReport.Container.Nodes[fixture.ServerContainerNodeID] = server.WithLatests(map[string]string{docker.ContainerStateHuman: "paused"})
+
+	var (
+		ctx   = context.Background()
+		sink  = &recordingAlertSink{}
+		a     = &Alerter{reporter: StaticCollector(fixture.Report), rules: rules, sink: sink, active: map[string]map[string]Alert{}}
+		start = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	)
+	evaluate := func(reporter Reporter, at time.Time) []Alert {
+		a.reporter = reporter
+		if err := a.evaluate(ctx, at); err != nil {
+			t.Fatal(err)
+		}
+		return sink.take()
+	}
+
+	firing := []Alert{
+		{Rule: "busy-hosts", Key: fixture.ClientHostNodeID, Summary: "busy-hosts: 2 processes on client.hostname.com", Severity: "warning", Status: AlertFiring, Time: start},
+		{Rule: "busy-hosts", Key: fixture.ServerHostNodeID, Summary: "busy-hosts: 2 processes on server.hostname.com", Severity: "warning", Status: AlertFiring, Time: start},
+		{Rule: "client-to-server", Key: fixture.ClientContainerNodeID + "->" + fixture.ServerContainerNodeID, Summary: "client-to-server: edge from client to server", Severity: "warning", Status: AlertFiring, Time: start},
+	}
+	equalAlerts(t, firing, evaluate(StaticCollector(fixture.Report), start))
+
+	// Alerts which are still firing are not notified again
+	later := start.Add(time.Minute)
+	paused := Alert{Rule: "paused", Key: fixture.ServerContainerNodeID, Summary: "paused: server", Severity: "critical", Status: AlertFiring, Time: later}
+	equalAlerts(t, []Alert{paused}, evaluate(StaticCollector(pausedReport), later))
+	equalAlerts(t, append(firing, paused), a.Active())
+
+	latest := later.Add(time.Minute)
+	resolved := paused
+	resolved.Status, resolved.Time = AlertResolved, latest
+	equalAlerts(t, []Alert{resolved}, evaluate(StaticCollector(fixture.Report), latest))
+	equalAlerts(t, firing, a.Active())
+}
+
+func equalAlerts(t *testing.T, want, have []Alert) {
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %#v, have %#v", want, have)
+	}
+}
+
+func TestLoadAlertRulesErrors(t *testing.T) {
+	for _, rules := range []string{
+		"rules: [{topology: containers}]",
+		"rules: [{name: foo, topology: foobar}]",
+		"rules: [{name: foo, topology: containers, nodes: \"(\"}]",
+		"rules: [{name: foo, topology: containers, edges: {from: \"cpu>\"}}]",
+	} {
+		f, err := ioutil.TempFile("", "alerts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(rules)
+		f.Close()
+		if _, err := LoadAlertRules(f.Name()); err == nil {
+			t.Errorf("%s: expected an error", rules)
+		}
+		os.Remove(f.Name())
+	}
+}
+
+func TestAlertSinks(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		bodies = map[string]map[string]interface{}{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mtx.Lock()
+		bodies[r.URL.Path] = body
+		mtx.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	oldPagerDutyEventsURL := pagerDutyEventsURL
+	pagerDutyEventsURL = ts.URL + "/pagerduty"
+	defer func() { pagerDutyEventsURL = oldPagerDutyEventsURL }()
+
+	webhook, err := NewAlertSink(ts.URL + "/webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack, err := NewAlertSink("slack://hooks.slack.com/services/T0/B0/X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := slack.(*slackAlertSink).url; have != "https://hooks.slack.com/services/T0/B0/X" {
+		t.Errorf("slack: want https://hooks.slack.com/services/T0/B0/X, have %s", have)
+	}
+	// Slack webhooks are https, which the test server is not
+	slack.(*slackAlertSink).url = ts.URL + "/slack"
+	pagerDuty, err := NewAlertSink("pagerduty://key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinks := AlertSinks{webhook, slack, pagerDuty}
+
+	alert := Alert{Rule: "paused", Key: "foo", Summary: "paused: foo", Severity: "critical", Status: AlertResolved, Time: time.Unix(0, 0).UTC()}
+	if err := sinks.Notify(alert); err != nil {
+		t.Fatal(err)
+	}
+	if have := bodies["/webhook"]["key"]; have != "foo" {
+		t.Errorf("webhook: want foo, have %v", have)
+	}
+	if have := bodies["/slack"]["text"]; have != "[RESOLVED] paused: foo" {
+		t.Errorf("slack: want [RESOLVED] paused: foo, have %v", have)
+	}
+	if have := bodies["/pagerduty"]["event_action"]; have != "resolve" {
+		t.Errorf("pagerduty: want resolve, have %v", have)
+	}
+	if have := bodies["/pagerduty"]["dedup_key"]; have != "paused/foo" {
+		t.Errorf("pagerduty: want paused/foo, have %v", have)
+	}
+
+	for _, sinkURL := range []string{"ftp://foo", "pagerduty://"} {
+		if _, err := NewAlertSink(sinkURL); err == nil {
+			t.Errorf("%s: expected an error", sinkURL)
+		}
+	}
+}
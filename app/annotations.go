@@ -0,0 +1,225 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Annotation is what users attached to a node: whether it is pinned, a
+// note, who owns it, a link to its runbook, and labels of their own.
+type Annotation struct {
+	NodeID    string            `json:"node_id"`
+	Pinned    bool              `json:"pinned,omitempty"`
+	Note      string            `json:"note,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	Runbook   string            `json:"runbook,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	UpdatedBy string            `json:"updated_by,omitempty"`
+	Updated   time.Time         `json:"updated"`
+}
+
+// Metadata row IDs of annotations. Labels get annotationLabelPrefix and
+// their key.
+const (
+	annotationPinned      = "annotation_pinned"
+	annotationNote        = "annotation_note"
+	annotationOwner       = "annotation_owner"
+	annotationRunbook     = "annotation_runbook"
+	annotationLabelPrefix = "annotation_label_"
+
+	// annotationPriority puts annotations after the metadata of nodes.
+	annotationPriority = 100
+)
+
+func (a Annotation) empty() bool {
+	return !a.Pinned && a.Note == "" && a.Owner == "" && a.Runbook == "" && len(a.Labels) == 0
+}
+
+// MetadataRows gives the metadata rows of the annotation, shown with the
+// other metadata of its node.
+func (a Annotation) MetadataRows() []report.MetadataRow {
+	var rows []report.MetadataRow
+	add := func(id, label, value string) {
+		if value != "" {
+			rows = append(rows, report.MetadataRow{ID: id, Label: label, Value: value, Priority: annotationPriority + float64(len(rows))})
+		}
+	}
+	if a.Pinned {
+		add(annotationPinned, "Pinned", "true")
+	}
+	add(annotationOwner, "Owner", a.Owner)
+	add(annotationRunbook, "Runbook", a.Runbook)
+	add(annotationNote, "Note", a.Note)
+	keys := make([]string, 0, len(a.Labels))
+	for key := range a.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(annotationLabelPrefix+key, key, a.Labels[key])
+	}
+	return rows
+}
+
+// NodeAnnotations keeps the annotations of nodes, by their IDs, which are
+// stable across reports. They are kept in file if given, so they survive
+// restarts of the app.
+type NodeAnnotations struct {
+	file string
+
+	mtx         sync.RWMutex
+	annotations map[string]Annotation
+}
+
+// NewNodeAnnotations makes a new NodeAnnotations, loading the annotations
+// in file.
+func NewNodeAnnotations(file string) (*NodeAnnotations, error) {
+	a := &NodeAnnotations{
+		file:        file,
+		annotations: map[string]Annotation{},
+	}
+	if file == "" {
+		return a, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&a.annotations); err != nil {
+		return nil, fmt.Errorf("Error reading annotations from %s: %v", file, err)
+	}
+	return a, nil
+}
+
+// save the annotations to the file, with the lock held.
+func (a *NodeAnnotations) save() error {
+	if a.file == "" {
+		return nil
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(a.annotations); err != nil {
+		return err
+	}
+	tmp := a.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
+
+// List gives the annotations, sorted by node ID, only of the pinned nodes
+// if pinned.
+func (a *NodeAnnotations) List(pinned bool) []Annotation {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	result := make([]Annotation, 0, len(a.annotations))
+	for _, annotation := range a.annotations {
+		if !pinned || annotation.Pinned {
+			result = append(result, annotation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].NodeID < result[j].NodeID })
+	return result
+}
+
+// Get gives the annotation of a node, if it has one.
+func (a *NodeAnnotations) Get(nodeID string) (Annotation, bool) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	annotation, ok := a.annotations[nodeID]
+	return annotation, ok
+}
+
+// Set the annotation of its node, replacing any it had. Empty annotations
+// delete it.
+func (a *NodeAnnotations) Set(annotation Annotation) (Annotation, error) {
+	if annotation.NodeID == "" {
+		return Annotation{}, fmt.Errorf("annotation without a node ID")
+	}
+	annotation.Updated = mtime.Now()
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if annotation.empty() {
+		delete(a.annotations, annotation.NodeID)
+	} else {
+		a.annotations[annotation.NodeID] = annotation
+	}
+	return annotation, a.save()
+}
+
+// Delete the annotation of a node, and say whether there was one.
+func (a *NodeAnnotations) Delete(nodeID string) (bool, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if _, ok := a.annotations[nodeID]; !ok {
+		return false, nil
+	}
+	delete(a.annotations, nodeID)
+	return true, a.save()
+}
+
+// Annotations implements report.Annotations.
+func (a *NodeAnnotations) Annotations(nodeID string) []report.MetadataRow {
+	annotation, ok := a.Get(nodeID)
+	if !ok {
+		return nil
+	}
+	return annotation.MetadataRows()
+}
+
+// RegisterAnnotationRoutes registers the routes listing, getting, setting
+// and deleting the annotations of nodes. Node IDs are escaped in paths, as
+// in /api/topology/{topology}/{id}.
+func RegisterAnnotationRoutes(router *mux.Router, annotations *NodeAnnotations) {
+	router.Methods("GET").Path("/api/annotations").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, annotations.List(r.FormValue("pinned") == "true"))
+		}))
+	router.Methods("GET").MatcherFunc(URLMatcher("/api/annotations/{id}")).
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			annotation, ok := annotations.Get(mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, annotation)
+		}))
+	router.Methods("PUT").MatcherFunc(URLMatcher("/api/annotations/{id}")).
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var annotation Annotation
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&annotation); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			if annotation.NodeID = mux.Vars(r)["id"]; annotation.NodeID == "" {
+				respondWith(w, http.StatusBadRequest, fmt.Errorf("annotation without a node ID"))
+				return
+			}
+			annotation.UpdatedBy = UserFromRequest(r).Name
+			annotation, err := annotations.Set(annotation)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondWith(w, http.StatusOK, annotation)
+		}))
+	router.Methods("DELETE").MatcherFunc(URLMatcher("/api/annotations/{id}")).
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ok, err := annotations.Delete(mux.Vars(r)["id"])
+			respondRevoked(w, r, ok, err)
+		}))
+}
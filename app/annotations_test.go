@@ -0,0 +1,91 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestNodeAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	annotations, err := app.NewNodeAnnotations(filepath.Join(dir, "annotations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterAnnotationRoutes(router, annotations)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: app.StaticCollector(fixture.Report), Annotations: annotations}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	path := "/api/annotations/" + url.QueryEscape(fixture.ClientHostNodeID)
+
+	for body, status := range map[string]int{
+		`{"pinned": true, "owner": "team-a", "runbook": "https://runbooks/client", "labels": {"tier": "frontend"}}`: 200,
+		`{"pinned": tru`: 400,
+	} {
+		if res, _ := checkRequest(t, ts, "PUT", path, []byte(body)); res.StatusCode != status {
+			t.Errorf("Expected status %d setting %s, got %d", status, body, res.StatusCode)
+		}
+	}
+	if res, _ := checkRequest(t, ts, "PUT", "/api/annotations/"+url.QueryEscape(fixture.ServerHostNodeID), []byte(`{"note": "noisy"}`)); res.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", res.StatusCode)
+	}
+
+	// Annotations are merged into the metadata of their nodes
+	var node app.APINode
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/hosts/"+url.QueryEscape(fixture.ClientHostNodeID)), &codec.JsonHandle{}).Decode(&node); err != nil {
+		t.Fatal(err)
+	}
+	have := map[string]report.MetadataRow{}
+	for _, row := range node.Node.Metadata {
+		have[row.ID] = row
+	}
+	for id, value := range map[string]string{
+		"annotation_pinned":     "true",
+		"annotation_owner":      "team-a",
+		"annotation_runbook":    "https://runbooks/client",
+		"annotation_label_tier": "frontend",
+	} {
+		if have[id].Value != value {
+			t.Errorf("Expected metadata row %s of %q, got %v", id, value, have[id])
+		}
+	}
+	if _, ok := have["annotation_note"]; ok {
+		t.Errorf("Expected no note, got %v", have["annotation_note"])
+	}
+
+	// Only pinned nodes, and surviving restarts
+	annotations, err = app.NewNodeAnnotations(filepath.Join(dir, "annotations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := annotations.List(true)
+	if len(pinned) != 1 || pinned[0].NodeID != fixture.ClientHostNodeID {
+		t.Errorf("Expected the pinned client host, got %v", pinned)
+	}
+	equals(t, 2, len(annotations.List(false)))
+
+	// Deleting, and setting empty annotations
+	if res, _ := checkRequest(t, ts, "DELETE", path, nil); res.StatusCode != 204 {
+		t.Errorf("Expected status 204 deleting, got %d", res.StatusCode)
+	}
+	is404(t, ts, path)
+	if res, _ := checkRequest(t, ts, "PUT", "/api/annotations/"+url.QueryEscape(fixture.ServerHostNodeID), []byte(`{}`)); res.StatusCode != 200 {
+		t.Errorf("Expected status 200, got %d", res.StatusCode)
+	}
+	is404(t, ts, "/api/annotations/"+url.QueryEscape(fixture.ServerHostNodeID))
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// ConnectionCountMetric is the ID under which anomalies in the number of
+// connections of nodes are given.
+const ConnectionCountMetric = "connection_count"
+
+const (
+	// anomalyWarmup is the number of samples a baseline needs before it
+	// flags anything, so that new nodes are not anomalous.
+	anomalyWarmup   = 10
+	anomalyGCPeriod = time.Minute
+	anomalyExpiry   = time.Hour
+)
+
+// anomalyMetrics are the metrics baselines are kept for.
+var anomalyMetrics = map[string]struct{}{
+	process.CPUUsage:     {},
+	process.MemoryUsage:  {},
+	docker.CPUTotalUsage: {},
+	docker.MemoryUsage:   {},
+	host.CPUUsage:        {},
+	host.MemoryUsage:     {},
+}
+
+// AnomalyDetector is a Collector which also keeps baselines, exponentially
+// weighted moving averages and variances, of the CPU and memory usage and
+// the connection counts of the processes, containers and hosts in the
+// reports added to it. Nodes whose latest value deviates from the baseline
+// by more than a number of standard deviations are anomalous.
+type AnomalyDetector struct {
+	Collector
+	alpha     float64
+	threshold float64
+
+	sync.Mutex
+	baselines map[string]map[string]*baseline // by node, by metric
+	lastGC    time.Time
+}
+
+type baseline struct {
+	mean, variance float64
+	count          int
+	anomalous      bool
+	last           time.Time
+}
+
+// NewAnomalyDetector makes a new AnomalyDetector, with baselines weighting
+// each new sample by alpha, and flagging samples more than threshold
+// standard deviations away from them.
+func NewAnomalyDetector(collector Collector, alpha, threshold float64) *AnomalyDetector {
+	return &AnomalyDetector{
+		Collector: collector,
+		alpha:     alpha,
+		threshold: threshold,
+		baselines: map[string]map[string]*baseline{},
+		lastGC:    mtime.Now(),
+	}
+}
+
+// Add implements Adder
+func (d *AnomalyDetector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	d.record(rpt)
+	return d.Collector.Add(ctx, rpt, buf)
+}
+
+func (d *AnomalyDetector) record(rpt report.Report) {
+	// Shortcut reports only have the nodes which changed, and so would
+	// count too few connections of everything else
+	if rpt.Shortcut {
+		return
+	}
+	now := mtime.Now()
+	d.Lock()
+	defer d.Unlock()
+	for _, t := range []report.Topology{rpt.Process, rpt.Container, rpt.Host} {
+		for nodeID, n := range t.Nodes {
+			for metricID, m := range n.Metrics {
+				if _, ok := anomalyMetrics[metricID]; !ok {
+					continue
+				}
+				if sample, ok := m.LastSample(); ok {
+					d.update(nodeID, metricID, sample)
+				}
+			}
+		}
+	}
+	for nodeID, count := range connectionCounts(rpt) {
+		d.update(nodeID, ConnectionCountMetric, report.Sample{Timestamp: now, Value: float64(count)})
+	}
+
+	if now.Sub(d.lastGC) < anomalyGCPeriod {
+		return
+	}
+	d.lastGC = now
+	for nodeID, metrics := range d.baselines {
+		for metricID, b := range metrics {
+			if now.Sub(b.last) > anomalyExpiry {
+				delete(metrics, metricID)
+			}
+		}
+		if len(metrics) == 0 {
+			delete(d.baselines, nodeID)
+		}
+	}
+}
+
+// update flags whether a sample is anomalous, before adding it to the
+// baseline. Samples seen already are skipped, as the same samples can be in
+// several reports.
+func (d *AnomalyDetector) update(nodeID, metricID string, sample report.Sample) {
+	metrics, ok := d.baselines[nodeID]
+	if !ok {
+		metrics = map[string]*baseline{}
+		d.baselines[nodeID] = metrics
+	}
+	b, ok := metrics[metricID]
+	if !ok {
+		b = &baseline{mean: sample.Value}
+		metrics[metricID] = b
+	} else if !sample.Timestamp.After(b.last) {
+		return
+	}
+	b.last = sample.Timestamp
+	diff := sample.Value - b.mean
+	b.anomalous = b.count >= anomalyWarmup && math.Abs(diff) > d.threshold*math.Sqrt(b.variance)
+	increment := d.alpha * diff
+	b.mean += increment
+	b.variance = (1 - d.alpha) * (b.variance + diff*increment)
+	b.count++
+}
+
+// connectionCounts gives the number of connections of each process,
+// container and host in a report, from its endpoints.
+func connectionCounts(rpt report.Report) map[string]int {
+	counts := map[string]int{}
+	for nodeID := range rpt.Process.Nodes {
+		counts[nodeID] = 0
+	}
+	for nodeID := range rpt.Container.Nodes {
+		counts[nodeID] = 0
+	}
+	for nodeID := range rpt.Host.Nodes {
+		counts[nodeID] = 0
+	}
+	add := func(endpoint report.Node) {
+		hostID := report.ExtractHostID(endpoint)
+		if hostID != "" {
+			counts[report.MakeHostNodeID(hostID)]++
+		}
+		pid, ok := endpoint.Latest.Lookup(process.PID)
+		if !ok {
+			return
+		}
+		processNodeID := report.MakeProcessNodeID(hostID, pid)
+		counts[processNodeID]++
+		if p, ok := rpt.Process.Nodes[processNodeID]; ok {
+			if containerID, ok := p.Latest.Lookup(docker.ContainerID); ok {
+				counts[report.MakeContainerNodeID(containerID)]++
+			}
+		}
+	}
+	for _, endpoint := range rpt.Endpoint.Nodes {
+		for _, adjacent := range endpoint.Adjacency {
+			add(endpoint)
+			if remote, ok := rpt.Endpoint.Nodes[adjacent]; ok {
+				add(remote)
+			}
+		}
+	}
+	return counts
+}
+
+// Anomalies implements report.Anomalies. It gives the IDs of the metrics of
+// a node whose latest values are anomalous, sorted.
+func (d *AnomalyDetector) Anomalies(nodeID string) []string {
+	d.Lock()
+	defer d.Unlock()
+	var metrics []string
+	for metricID, b := range d.baselines[nodeID] {
+		if b.anomalous {
+			metrics = append(metrics, metricID)
+		}
+	}
+	sort.Strings(metrics)
+	return metrics
+}
@@ -0,0 +1,96 @@
+package app_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		start    = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		detector = app.NewAnomalyDetector(app.NewCollector(time.Minute), 0.1, 3)
+		hostID   = report.MakeHostNodeID("foo")
+		pidID    = report.MakeProcessNodeID("foo", "1")
+	)
+	defer mtime.NowReset()
+	add := func(i int, cpu float64, connections int) {
+		now := start.Add(time.Duration(i) * time.Second)
+		mtime.NowForce(now)
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith(hostID, map[string]string{report.HostNodeID: hostID}).
+			WithMetric(host.CPUUsage, report.MakeSingletonMetric(now, cpu)))
+		rpt.Process.AddNode(report.MakeNodeWith(pidID, map[string]string{report.HostNodeID: hostID, process.PID: "1"}))
+		for c := 0; c < connections; c++ {
+			local := report.MakeEndpointNodeID("foo", "", "10.0.0.1", strconv.Itoa(1000+c))
+			remote := report.MakeEndpointNodeID("", "", "10.0.0.2", "80")
+			rpt.Endpoint.AddNode(report.MakeNodeWith(local, map[string]string{report.HostNodeID: hostID, process.PID: "1"}).WithAdjacent(remote))
+		}
+		if err := detector.Add(ctx, rpt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Baselines need warming up before flagging anything
+	add(0, 10, 2)
+	add(1, 90, 20)
+	equals(t, []string(nil), detector.Anomalies(hostID))
+
+	for i := 2; i < 30; i++ {
+		add(i, 10+float64(i%2), 2)
+	}
+	equals(t, []string(nil), detector.Anomalies(hostID))
+
+	add(30, 90, 2)
+	equals(t, []string{host.CPUUsage}, detector.Anomalies(hostID))
+	equals(t, []string(nil), detector.Anomalies(pidID))
+
+	add(31, 10, 20)
+	equals(t, []string{app.ConnectionCountMetric}, detector.Anomalies(hostID))
+	equals(t, []string{app.ConnectionCountMetric}, detector.Anomalies(pidID))
+}
+
+func TestAnomalyDetectorSkipsShortcuts(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		start    = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		detector = app.NewAnomalyDetector(app.NewCollector(time.Minute), 0.1, 3)
+		hostID   = report.MakeHostNodeID("foo")
+	)
+	defer mtime.NowReset()
+	add := func(i int, cpu float64, shortcut bool) {
+		now := start.Add(time.Duration(i) * time.Second)
+		mtime.NowForce(now)
+		rpt := report.MakeReport()
+		rpt.Shortcut = shortcut
+		rpt.Host.AddNode(report.MakeNodeWith(hostID, map[string]string{report.HostNodeID: hostID}).
+			WithMetric(host.CPUUsage, report.MakeSingletonMetric(now, cpu)))
+		if !shortcut {
+			for c := 0; c < 20; c++ {
+				local := report.MakeEndpointNodeID("foo", "", "10.0.0.1", strconv.Itoa(1000+c))
+				rpt.Endpoint.AddNode(report.MakeNodeWith(local, map[string]string{report.HostNodeID: hostID}))
+			}
+		}
+		if err := detector.Add(ctx, rpt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 30; i++ {
+		add(i, 10+float64(i%2), false)
+	}
+
+	// Shortcut reports, with none of the endpoints, don't count as the
+	// connections going away, nor are their samples taken
+	add(30, 90, true)
+	equals(t, []string(nil), detector.Anomalies(hostID))
+}
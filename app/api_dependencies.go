@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// APIDependencies is returned by the /api/topology/{name}/dependencies
+// handler.
+type APIDependencies struct {
+	Topology string                      `json:"topology" yaml:"topology"`
+	Nodes    []detailed.NodeDependencies `json:"nodes" yaml:"nodes"`
+}
+
+// Dependency manifest of the rendered topology: what each node connects to,
+// on which ports, in JSON or, with format=yaml, YAML. It is meant for
+// seeding network policies or documenting architectures, so it is best
+// rendered from topologies like containers or services.
+func handleDependencies(ctx context.Context, renderer render.Renderer, decorator render.Decorator, rc report.RenderContext, w http.ResponseWriter, r *http.Request) {
+	topologyID := mux.Vars(r)["topology"]
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "yaml" {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("Unknown dependencies format: %q", format))
+		return
+	}
+	dependencies := APIDependencies{
+		Topology: topologyID,
+		Nodes:    detailed.MakeDependencies(rc, renderTopology(topologyID, renderer, decorator, rc.Report)),
+	}
+	if format != "yaml" {
+		respondWith(w, http.StatusOK, dependencies)
+		return
+	}
+	buf, err := yaml.Marshal(dependencies)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(buf)
+}
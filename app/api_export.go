@@ -0,0 +1,239 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Formats of exported topologies.
+const (
+	DOTExportFormat       = "dot"
+	GraphMLExportFormat   = "graphml"
+	CytoscapeExportFormat = "cytoscape"
+)
+
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	write       func(io.Writer, string, []detailed.NodeSummary) error
+}{
+	DOTExportFormat:       {"text/vnd.graphviz", "dot", writeDOT},
+	GraphMLExportFormat:   {"application/graphml+xml", "graphml", writeGraphML},
+	CytoscapeExportFormat: {"application/json", "json", writeCytoscape},
+}
+
+// Export of the rendered topology, for other graph tools.
+func handleExport(ctx context.Context, renderer render.Renderer, decorator render.Decorator, rc report.RenderContext, w http.ResponseWriter, r *http.Request) {
+	topologyID := mux.Vars(r)["topology"]
+	format, ok := exportFormats[r.FormValue("format")]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("Unknown export format: %q", r.FormValue("format")))
+		return
+	}
+	query, err := searchQuery(r)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	summaries := detailed.Summaries(rc, renderTopology(topologyID, renderer, decorator, rc.Report))
+	if query != nil {
+		summaries = summaries.Search(query)
+	}
+	nodes := make([]detailed.NodeSummary, 0, len(summaries))
+	for _, n := range summaries {
+		nodes = append(nodes, n)
+	}
+	sort.Sort(summariesByID(nodes))
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", topologyID+"."+format.extension))
+	if err := format.write(w, topologyID, nodes); err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+	}
+}
+
+type summariesByID []detailed.NodeSummary
+
+func (s summariesByID) Len() int           { return len(s) }
+func (s summariesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s summariesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// exportEdges calls f with the edges of the exported nodes, leaving out
+// those to nodes which were not exported.
+func exportEdges(nodes []detailed.NodeSummary, f func(from, to string)) {
+	exported := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		exported[n.ID] = struct{}{}
+	}
+	for _, n := range nodes {
+		for _, adjacent := range n.Adjacency {
+			if _, ok := exported[adjacent]; ok {
+				f(n.ID, adjacent)
+			}
+		}
+	}
+}
+
+func writeDOT(w io.Writer, topologyID string, nodes []detailed.NodeSummary) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(topologyID))
+	edges := make(map[string]map[string]report.EdgeMetadata, len(nodes))
+	for _, n := range nodes {
+		edges[n.ID] = n.Edges
+		fmt.Fprintf(&b, "\t%s [label=%s", strconv.Quote(n.ID), strconv.Quote(n.Label))
+		if n.LabelMinor != "" {
+			fmt.Fprintf(&b, ", tooltip=%s", strconv.Quote(n.LabelMinor))
+		}
+		if n.Pseudo {
+			b.WriteString(", style=dashed")
+		}
+		for _, row := range n.Metadata {
+			fmt.Fprintf(&b, ", %s=%s", strconv.Quote(row.ID), strconv.Quote(row.Value))
+		}
+		b.WriteString("];\n")
+	}
+	exportEdges(nodes, func(from, to string) {
+		if edges[from][to].Attempted {
+			// Connections which were never answered
+			fmt.Fprintf(&b, "\t%s -> %s [style=dashed];\n", strconv.Quote(from), strconv.Quote(to))
+			return
+		}
+		fmt.Fprintf(&b, "\t%s -> %s;\n", strconv.Quote(from), strconv.Quote(to))
+	})
+	b.WriteString("}\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, topologyID string, nodes []detailed.NodeSummary) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "labelMinor", For: "node", Name: "labelMinor", Type: "string"},
+			{ID: "shape", For: "node", Name: "shape", Type: "string"},
+			{ID: "pseudo", For: "node", Name: "pseudo", Type: "boolean"},
+		},
+		Graph: graphMLGraph{ID: topologyID, EdgeDefault: "directed"},
+	}
+	keys := map[string]struct{}{}
+	for _, n := range nodes {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{
+			{Key: "label", Value: n.Label},
+			{Key: "labelMinor", Value: n.LabelMinor},
+			{Key: "shape", Value: n.Shape},
+			{Key: "pseudo", Value: strconv.FormatBool(n.Pseudo)},
+		}}
+		for _, row := range n.Metadata {
+			node.Data = append(node.Data, graphMLData{Key: row.ID, Value: row.Value})
+			if _, ok := keys[row.ID]; !ok {
+				keys[row.ID] = struct{}{}
+				doc.Keys = append(doc.Keys, graphMLKey{ID: row.ID, For: "node", Name: row.Label, Type: "string"})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	exportEdges(nodes, func(from, to string) {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: from, Target: to})
+	})
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// cytoscapeElement is an element of Cytoscape.js JSON, with the data of a
+// node or edge.
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func writeCytoscape(w io.Writer, topologyID string, nodes []detailed.NodeSummary) error {
+	elements := struct {
+		Nodes []cytoscapeElement `json:"nodes"`
+		Edges []cytoscapeElement `json:"edges"`
+	}{
+		Nodes: []cytoscapeElement{},
+		Edges: []cytoscapeElement{},
+	}
+	for _, n := range nodes {
+		data := map[string]interface{}{
+			"id":         n.ID,
+			"label":      n.Label,
+			"labelMinor": n.LabelMinor,
+			"shape":      n.Shape,
+			"pseudo":     n.Pseudo,
+		}
+		for _, row := range n.Metadata {
+			data[row.ID] = row.Value
+		}
+		for _, row := range n.Metrics {
+			if !row.ValueEmpty {
+				data[row.ID] = row.Value
+			}
+		}
+		elements.Nodes = append(elements.Nodes, cytoscapeElement{data})
+	}
+	exportEdges(nodes, func(from, to string) {
+		elements.Edges = append(elements.Edges, cytoscapeElement{map[string]interface{}{
+			"id":     from + "->" + to,
+			"source": from,
+			"target": to,
+		}})
+	})
+	return codec.NewEncoder(w, &codec.JsonHandle{}).Encode(map[string]interface{}{
+		"data":     map[string]interface{}{"name": topologyID},
+		"elements": elements,
+	})
+}
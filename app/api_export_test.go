@@ -0,0 +1,62 @@
+package app_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPITopologyExport(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	res, body := checkGet(t, ts, "/api/topology/containers/export?format=dot")
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "text/vnd.graphviz" {
+		t.Fatalf("Unexpected response %d, %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	dot := string(body)
+	if !strings.HasPrefix(dot, `digraph "containers" {`) ||
+		!strings.Contains(dot, `"`+fixture.ClientContainerNodeID+`" -> "`+fixture.ServerContainerNodeID+`";`) {
+		t.Errorf("Unexpected DOT export: %s", dot)
+	}
+
+	_, body = checkGet(t, ts, "/api/topology/containers/export?format=graphml")
+	var graphml struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(body, &graphml); err != nil {
+		t.Fatal(err)
+	}
+	if len(graphml.Nodes) == 0 || len(graphml.Edges) == 0 {
+		t.Errorf("Expected nodes and edges in the GraphML export: %s", body)
+	}
+
+	var cytoscape struct {
+		Elements struct {
+			Nodes []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"nodes"`
+			Edges []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers/export?format=cytoscape"), &codec.JsonHandle{}).Decode(&cytoscape); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, len(graphml.Nodes), len(cytoscape.Elements.Nodes))
+	equals(t, len(graphml.Edges), len(cytoscape.Elements.Edges))
+
+	is400(t, ts, "/api/topology/containers/export?format=png")
+	is404(t, ts, "/api/topology/foobar/export?format=dot")
+}
@@ -13,7 +13,8 @@ import (
 // Raw report handler
 func makeRawReportHandler(rep Reporter) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		report, err := rep.Report(ctx, time.Now())
+		timestamp := deserializeTimestamp(r.URL.Query().Get("timestamp"))
+		report, err := rep.Report(ctx, timestamp)
 		if err != nil {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
@@ -27,6 +28,12 @@ type probeDesc struct {
 	Hostname string    `json:"hostname"`
 	Version  string    `json:"version"`
 	LastSeen time.Time `json:"lastSeen"`
+	// Truncated is how many nodes the probe left out of each topology of
+	// its last report, to keep it within its size budget.
+	Truncated map[string]int `json:"truncated,omitempty"`
+	// Rejected is what is known of the reports of the probe rejected
+	// lately, as malformed or version-incompatible.
+	Rejected *RejectedReports `json:"rejected,omitempty"`
 }
 
 // Probe handler
@@ -37,18 +44,44 @@ func makeProbeHandler(rep Reporter) CtxHandlerFunc {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
 		}
-		result := []probeDesc{}
-		for _, n := range rpt.Host.Nodes {
-			id, _ := n.Latest.Lookup(report.ControlProbeID)
-			hostname, _ := n.Latest.Lookup(host.HostName)
-			version, dt, _ := n.Latest.LookupEntry(host.ScopeVersion)
-			result = append(result, probeDesc{
-				ID:       id,
-				Hostname: hostname,
-				Version:  version,
-				LastSeen: dt,
-			})
+		var rejected map[string]RejectedReports
+		if wrep, ok := rep.(WebReporter); ok && wrep.Quarantine != nil {
+			rejected = wrep.Quarantine.Rejected()
 		}
-		respondWith(w, http.StatusOK, result)
+		respondWith(w, http.StatusOK, probeDescs(rpt, rejected))
 	}
 }
+
+// probeDescs describes the probes of a report, and those of the rejected
+// reports, which might not be in it.
+func probeDescs(rpt report.Report, rejected map[string]RejectedReports) []probeDesc {
+	result := []probeDesc{}
+	described := map[string]bool{}
+	for _, n := range rpt.Host.Nodes {
+		id, _ := n.Latest.Lookup(report.ControlProbeID)
+		hostname, _ := n.Latest.Lookup(host.HostName)
+		version, dt, _ := n.Latest.LookupEntry(host.ScopeVersion)
+		desc := probeDesc{
+			ID:       id,
+			Hostname: hostname,
+			Version:  version,
+			LastSeen: dt,
+		}
+		if truncated, ok := n.Latest.Lookup(report.TruncatedTopologies); ok && truncated != "" {
+			desc.Truncated = report.ParseTruncated(truncated)
+		}
+		if r, ok := rejected[id]; ok {
+			desc.Rejected = &r
+		}
+		described[id] = true
+		result = append(result, desc)
+	}
+	for id, r := range rejected {
+		if described[id] {
+			continue
+		}
+		r := r
+		result = append(result, probeDesc{ID: id, Version: r.ProbeVersion, Rejected: &r})
+	}
+	return result
+}
@@ -33,3 +33,35 @@ func TestAPIReport(t *testing.T) {
 		t.Fatalf("JSON parse error: %s", err)
 	}
 }
+
+func TestAPIProbesTruncated(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host1"), map[string]string{
+		report.ControlProbeID:      "probe1",
+		report.TruncatedTopologies: "endpoint=1000,process=20",
+	}))
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host2"), map[string]string{
+		report.ControlProbeID:      "probe2",
+		report.TruncatedTopologies: "",
+	}))
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var probes []struct {
+		ID        string         `json:"id"`
+		Truncated map[string]int `json:"truncated"`
+	}
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/probes"), &codec.JsonHandle{}).Decode(&probes); err != nil {
+		t.Fatal(err)
+	}
+	truncated := map[string]map[string]int{}
+	for _, p := range probes {
+		truncated[p.ID] = p.Truncated
+	}
+	equals(t, map[string]map[string]int{
+		"probe1": {report.Endpoint: 1000, report.Process: 20},
+		"probe2": nil,
+	}, truncated)
+}
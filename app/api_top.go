@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Top consumers default to the first defaultTopConsumers, and at most
+// maxTopConsumers.
+const (
+	defaultTopConsumers = 10
+	maxTopConsumers     = 1000
+)
+
+// topTopologies are the topologies whose top consumers can be listed, by the
+// topology of the report whose nodes they render as they are.
+var topTopologies = map[string]string{
+	processesID:  report.Process,
+	containersID: report.Container,
+	podsID:       report.Pod,
+	hostsID:      report.Host,
+}
+
+// TopConsumer is a node and its latest value of a metric.
+type TopConsumer struct {
+	ID         string  `json:"id"`
+	Label      string  `json:"label"`
+	LabelMinor string  `json:"labelMinor,omitempty"`
+	Value      float64 `json:"value"`
+}
+
+// APITopConsumers is returned by the /api/topology/{name}/top handler.
+type APITopConsumers struct {
+	Topology string        `json:"topology"`
+	Metric   string        `json:"metric"`
+	Label    string        `json:"label"`
+	Format   string        `json:"format,omitempty"`
+	Nodes    []TopConsumer `json:"nodes"`
+}
+
+// findMetricTemplate finds a metric of a topology by its ID, or by its label
+// regardless of case, like cpu or memory.
+func findMetricTemplate(t report.Topology, metric string) (report.MetricTemplate, bool) {
+	if template, ok := t.MetricTemplates[metric]; ok {
+		return template, true
+	}
+	for _, template := range t.MetricTemplates {
+		if strings.EqualFold(template.Label, metric) {
+			return template, true
+		}
+	}
+	return report.MetricTemplate{}, false
+}
+
+// MakeTopConsumers gives the n nodes of a topology of the report with the
+// highest latest values of a metric, highest first.
+func MakeTopConsumers(rc report.RenderContext, topologyID string, template report.MetricTemplate, n int) []TopConsumer {
+	t, _ := rc.Report.Topology(topologyID)
+	result := []TopConsumer{}
+	for id, node := range t.Nodes {
+		metric, ok := node.Metrics.Lookup(template.ID)
+		if !ok {
+			continue
+		}
+		if s, ok := metric.LastSample(); ok {
+			result = append(result, TopConsumer{ID: id, Value: s.Value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Value != result[j].Value {
+			return result[i].Value > result[j].Value
+		}
+		return result[i].ID < result[j].ID
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	// Only the top nodes are summarized, for their labels.
+	for i := range result {
+		if summary, ok := detailed.MakeNodeSummary(rc, t.Nodes[result[i].ID]); ok {
+			result[i].Label, result[i].LabelMinor = summary.Label, summary.LabelMinor
+		}
+	}
+	return result
+}
+
+// Top consumers of a metric of a topology, from the nodes of the merged
+// report rather than the rendered topology, so it is cheap enough to poll.
+func handleTop(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	topologyID := mux.Vars(r)["topology"]
+	if _, ok := topologyRegistry.get(topologyID); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	reportTopologyID, ok := topTopologies[topologyID]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("No top consumers of topology %s", topologyID))
+		return
+	}
+	n := defaultTopConsumers
+	if v := r.FormValue("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 || n > maxTopConsumers {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("Invalid n: %q, must be between 1 and %d", v, maxTopConsumers))
+			return
+		}
+	}
+	rpt, err := rep.Report(ctx, deserializeTimestamp(r.URL.Query().Get("timestamp")))
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	t, _ := rpt.Topology(reportTopologyID)
+	template, ok := findMetricTemplate(t, r.FormValue("metric"))
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("Unknown metric of topology %s: %q", topologyID, r.FormValue("metric")))
+		return
+	}
+	respondWith(w, http.StatusOK, APITopConsumers{
+		Topology: topologyID,
+		Metric:   template.ID,
+		Label:    template.Label,
+		Format:   template.Format,
+		Nodes:    MakeTopConsumers(RenderContextForReporter(rep, rpt), reportTopologyID, template, n),
+	})
+}
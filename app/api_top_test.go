@@ -0,0 +1,46 @@
+package app_test
+
+import (
+	"testing"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPITopologyTop(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	var top app.APITopConsumers
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers/top?metric=cpu"), &codec.JsonHandle{}).Decode(&top); err != nil {
+		t.Fatal(err)
+	}
+	if top.Metric != docker.CPUTotalUsage {
+		t.Errorf("Expected the metric %s, got %s", docker.CPUTotalUsage, top.Metric)
+	}
+	if len(top.Nodes) != 2 {
+		t.Fatalf("Expected 2 containers, got %v", top.Nodes)
+	}
+	if top.Nodes[0].ID != fixture.ServerContainerNodeID || top.Nodes[1].ID != fixture.ClientContainerNodeID {
+		t.Errorf("Expected the server container before the client one, got %v", top.Nodes)
+	}
+	if top.Nodes[1].Label != fixture.ClientContainerName {
+		t.Errorf("Expected the label %s, got %s", fixture.ClientContainerName, top.Nodes[1].Label)
+	}
+
+	top = app.APITopConsumers{}
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/hosts/top?metric=cpu&n=1"), &codec.JsonHandle{}).Decode(&top); err != nil {
+		t.Fatal(err)
+	}
+	if len(top.Nodes) != 1 || top.Nodes[0].ID != fixture.ServerHostNodeID {
+		t.Errorf("Expected only the server host, got %v", top.Nodes)
+	}
+
+	is404(t, ts, "/api/topology/foo/top?metric=cpu")
+	is400(t, ts, "/api/topology/containers/top?metric=foo")
+	is400(t, ts, "/api/topology/containers/top?metric=cpu&n=0")
+	is400(t, ts, "/api/topology/containers/top?metric=cpu&n=foo")
+}
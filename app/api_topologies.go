@@ -28,13 +28,25 @@ const (
 	containersByHostnameID = "containers-by-hostname"
 	containersByImageID    = "containers-by-image"
 	podsID                 = "pods"
+	namespacesID           = "namespaces"
 	kubeControllersID      = "kube-controllers"
+	customResourcesID      = "custom-resources"
 	servicesID             = "services"
 	hostsID                = "hosts"
+	hostsByZoneID          = "hosts-by-zone"
 	weaveID                = "weave"
+	netIfacesID            = "net-ifaces"
+	scopeComponentsID      = "scope"
+	systemdUnitsID         = "systemd-units"
+	virtualMachinesID      = "virtual-machines"
 	ecsTasksID             = "ecs-tasks"
 	ecsServicesID          = "ecs-services"
+	ecsStacksID            = "ecs-stacks"
 	swarmServicesID        = "swarm-services"
+	swarmStacksID          = "swarm-stacks"
+	nomadAllocationsID     = "nomad-allocations"
+	nomadTaskGroupsID      = "nomad-task-groups"
+	nomadJobsID            = "nomad-jobs"
 )
 
 var (
@@ -64,6 +76,53 @@ func namespaceFilters(namespaces []string, noneLabel string) APITopologyOptionGr
 func updateFilters(rpt report.Report, topologies []APITopologyDesc) []APITopologyDesc {
 	topologies = updateKubeFilters(rpt, topologies)
 	topologies = updateSwarmFilters(rpt, topologies)
+	topologies = updateVulnerabilityFilters(rpt, topologies)
+	topologies = updateRegistryFilters(rpt, topologies)
+	topologies = updateOOMFilters(rpt, topologies)
+	return topologies
+}
+
+var oomFilter = APITopologyOptionGroup{
+	ID:      "oom",
+	Default: "all",
+	Options: []APITopologyOption{
+		{Value: "all", Label: "All", filter: nil, filterPseudo: false},
+		{Value: "oom-killed", Label: "Recently OOM killed", filter: render.IsRecentlyOOMKilled, filterPseudo: true},
+	},
+}
+
+// updateOOMFilters offers to show only the containers and pods recently
+// killed for running out of memory, when any report how they terminated.
+func updateOOMFilters(rpt report.Report, topologies []APITopologyDesc) []APITopologyDesc {
+	terminated := false
+	for _, t := range []struct {
+		topology report.Topology
+		key      string
+	}{
+		{rpt.Container, docker.ContainerOOMKilled},
+		{rpt.Pod, kubernetes.LastTermination},
+	} {
+		for _, n := range t.topology.Nodes {
+			if _, ok := n.Latest.Lookup(t.key); ok {
+				terminated = true
+				break
+			}
+		}
+	}
+	if !terminated {
+		return topologies
+	}
+	topologies = append([]APITopologyDesc{}, topologies...) // Make a copy so we can make changes safely
+	for i, t := range topologies {
+		switch t.id {
+		case containersID:
+			topologies[i] = mergeTopologyFilters(t, []APITopologyOptionGroup{oomFilter})
+		case podsID:
+			// Not of the controllers below pods, which never terminate
+			t.Options = append(append([]APITopologyOptionGroup{}, t.Options...), oomFilter)
+			topologies[i] = t
+		}
+	}
 	return topologies
 }
 
@@ -85,7 +144,7 @@ func updateSwarmFilters(rpt report.Report, topologies []APITopologyDesc) []APITo
 	}
 	topologies = append([]APITopologyDesc{}, topologies...) // Make a copy so we can make changes safely
 	for i, t := range topologies {
-		if t.id == containersID || t.id == swarmServicesID {
+		if t.id == containersID || t.id == swarmServicesID || t.id == swarmStacksID {
 			topologies[i] = mergeTopologyFilters(t, []APITopologyOptionGroup{
 				namespaceFilters(ns, "All Stacks"),
 			})
@@ -118,7 +177,7 @@ func updateKubeFilters(rpt report.Report, topologies []APITopologyDesc) []APITop
 	sort.Strings(ns)
 	topologies = append([]APITopologyDesc{}, topologies...) // Make a copy so we can make changes safely
 	for i, t := range topologies {
-		if t.id == containersID || t.id == podsID || t.id == servicesID || t.id == kubeControllersID {
+		if t.id == containersID || t.id == podsID || t.id == servicesID || t.id == kubeControllersID || t.id == customResourcesID {
 			topologies[i] = mergeTopologyFilters(t, []APITopologyOptionGroup{
 				namespaceFilters(ns, "All Namespaces"),
 			})
@@ -182,6 +241,37 @@ func MakeRegistry() *Registry {
 		},
 	}
 
+	systemdUnitFilters := []APITopologyOptionGroup{
+		{
+			ID:      "inactive",
+			Default: "hide",
+			Options: []APITopologyOption{
+				{Value: "show", Label: "All units", filter: nil, filterPseudo: false},
+				{Value: "hide", Label: "Active units", filter: render.IsActiveUnit, filterPseudo: false},
+			},
+		},
+	}
+
+	virtualMachineFilters := []APITopologyOptionGroup{
+		{
+			ID:      "stopped",
+			Default: "running",
+			Options: []APITopologyOption{
+				{Value: "stopped", Label: "Shut off VMs", filter: render.IsStoppedVirtualMachine, filterPseudo: false},
+				{Value: "running", Label: "Running VMs", filter: render.IsRunningVirtualMachine, filterPseudo: false},
+				{Value: "both", Label: "Both", filter: nil, filterPseudo: false},
+			},
+		},
+		{
+			ID:      "containers",
+			Default: "show",
+			Options: []APITopologyOption{
+				{Value: "show", Label: "Show containers", filter: nil, filterPseudo: false},
+				{Value: "hide", Label: "Hide containers", filter: render.IsVirtualMachine, filterPseudo: false},
+			},
+		},
+	}
+
 	unconnectedFilter := []APITopologyOptionGroup{
 		{
 			ID:      "unconnected",
@@ -236,12 +326,20 @@ func MakeRegistry() *Registry {
 		},
 		APITopologyDesc{
 			id:          podsID,
-			renderer:    render.FilterUnconnectedPseudo(render.PodRenderer),
+			renderer:    render.FilterUnconnectedPseudo(render.PodNetworkPolicyRenderer),
 			Name:        "Pods",
 			Rank:        3,
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          namespacesID,
+			parent:      podsID,
+			renderer:    render.FilterUnconnectedPseudo(podNamespaceRenderer),
+			Name:        "namespaces",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:          kubeControllersID,
 			parent:      podsID,
@@ -250,6 +348,14 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          customResourcesID,
+			parent:      podsID,
+			renderer:    render.FilterUnconnectedPseudo(render.CustomResourceRenderer),
+			Name:        "custom resources",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:          servicesID,
 			parent:      podsID,
@@ -274,6 +380,14 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          ecsStacksID,
+			parent:      ecsTasksID,
+			renderer:    render.FilterUnconnectedPseudo(render.ECSStackRenderer),
+			Name:        "stacks",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:          swarmServicesID,
 			renderer:    render.FilterUnconnectedPseudo(render.SwarmServiceRenderer),
@@ -282,18 +396,86 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          swarmStacksID,
+			parent:      swarmServicesID,
+			renderer:    render.FilterUnconnectedPseudo(render.SwarmStackRenderer),
+			Name:        "stacks",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          nomadAllocationsID,
+			renderer:    render.FilterUnconnectedPseudo(render.NomadAllocationRenderer),
+			Name:        "Allocations",
+			Rank:        3,
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          nomadTaskGroupsID,
+			parent:      nomadAllocationsID,
+			renderer:    render.FilterUnconnectedPseudo(render.NomadTaskGroupRenderer),
+			Name:        "task groups",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          nomadJobsID,
+			parent:      nomadAllocationsID,
+			renderer:    render.FilterUnconnectedPseudo(render.NomadJobRenderer),
+			Name:        "jobs",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:       hostsID,
 			renderer: render.FilterUnconnectedPseudo(render.HostRenderer),
 			Name:     "Hosts",
 			Rank:     4,
 		},
+		APITopologyDesc{
+			id:          hostsByZoneID,
+			parent:      hostsID,
+			renderer:    render.FilterUnconnectedPseudo(render.HostAvailabilityZoneRenderer),
+			Name:        "by zone",
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:       weaveID,
 			parent:   hostsID,
 			renderer: render.FilterUnconnectedPseudo(render.WeaveRenderer),
 			Name:     "Weave Net",
 		},
+		APITopologyDesc{
+			id:       netIfacesID,
+			parent:   hostsID,
+			renderer: render.NetIfaceRenderer,
+			Name:     "interfaces",
+		},
+		APITopologyDesc{
+			id:          scopeComponentsID,
+			parent:      hostsID,
+			renderer:    render.ScopeComponentRenderer,
+			Name:        "Scope",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          systemdUnitsID,
+			parent:      hostsID,
+			renderer:    render.FilterUnconnectedPseudo(render.SystemdUnitRenderer),
+			Name:        "systemd",
+			Options:     systemdUnitFilters,
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          virtualMachinesID,
+			parent:      hostsID,
+			renderer:    render.VirtualMachineRenderer,
+			Name:        "VMs",
+			Options:     virtualMachineFilters,
+			HideIfEmpty: true,
+		},
 	)
 
 	return registry
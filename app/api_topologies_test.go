@@ -41,7 +41,7 @@ func TestAPITopology(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	for _, topology := range topologies {
 		is200(t, ts, topology.URL)
@@ -50,8 +50,8 @@ func TestAPITopology(t *testing.T) {
 			is200(t, ts, subTopology.URL)
 		}
 
-		// TODO: add ECS nodes in report fixture
-		if topology.Name == "Tasks" || topology.Name == "services" {
+		// TODO: add ECS and Nomad nodes in report fixture
+		if topology.Name == "Tasks" || topology.Name == "services" || topology.Name == "Allocations" {
 			continue
 		}
 
@@ -189,7 +189,7 @@ func getTestContainerLabelFilterTopologySummary(t *testing.T, exclude bool) (det
 func TestAPITopologyAddsKubernetes(t *testing.T) {
 	router := mux.NewRouter()
 	c := app.NewCollector(1 * time.Minute)
-	app.RegisterReportPostHandler(c, router)
+	app.RegisterReportPostHandler(c, router, nil, nil)
 	app.RegisterTopologyRoutes(router, c, map[string]bool{"foo_capability": true})
 	ts := httptest.NewServer(router)
 	defer ts.Close()
@@ -201,7 +201,7 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	// Enable the kubernetes topologies
 	rpt := report.MakeReport()
@@ -235,7 +235,7 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	found := false
 	for _, topology := range topologies {
@@ -248,3 +248,42 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 		t.Error("Could not find pods topology")
 	}
 }
+
+func TestAPITopologyOOMFilter(t *testing.T) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	rpt := fixture.Report.Copy()
+	rpt.Container.Nodes[fixture.ClientContainerNodeID] = rpt.Container.Nodes[fixture.ClientContainerNodeID].WithLatests(map[string]string{
+		docker.ContainerOOMKilled: "true",
+		docker.ContainerFinished:  now,
+	})
+	rpt.Container.Nodes[fixture.ServerContainerNodeID] = rpt.Container.Nodes[fixture.ServerContainerNodeID].WithLatests(map[string]string{
+		docker.ContainerOOMKilled: "true",
+		docker.ContainerFinished:  "2017-01-01T00:00:00Z",
+	})
+	rpt.Pod.Nodes[fixture.ClientPodNodeID] = rpt.Pod.Nodes[fixture.ClientPodNodeID].WithLatests(map[string]string{
+		kubernetes.LastTermination: "OOMKilled",
+		kubernetes.LastTerminated:  now,
+	})
+	rpt.Pod.Nodes[fixture.ServerPodNodeID] = rpt.Pod.Nodes[fixture.ServerPodNodeID].WithLatests(map[string]string{
+		kubernetes.LastTermination: "Error",
+		kubernetes.LastTerminated:  now,
+	})
+	router := mux.NewRouter()
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Only the containers and pods OOM killed within the hour are shown
+	for path, want := range map[string]string{
+		"/api/topology/containers?oom=oom-killed": fixture.ClientContainerNodeID,
+		"/api/topology/pods?oom=oom-killed":       fixture.ClientPodNodeID,
+	} {
+		var topology app.APITopology
+		if err := codec.NewDecoderBytes(getRawJSON(t, ts, path), &codec.JsonHandle{}).Decode(&topology); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := topology.Nodes[want]; !found || len(topology.Nodes) != 1 {
+			t.Errorf("%s: expected only %s, got %d nodes", path, want, len(topology.Nodes))
+		}
+	}
+}
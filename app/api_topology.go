@@ -1,11 +1,15 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/xfer"
@@ -18,6 +22,30 @@ const (
 	websocketLoop = 1 * time.Second
 )
 
+// Subprotocols of the topology websocket. Without one, every message is the
+// JSON of a detailed.Diff. With a delta subprotocol, updated nodes are sent
+// as patches, in JSON text messages or MessagePack binary ones.
+const (
+	JSONDeltaSubprotocol    = "scope-delta.json"
+	MsgpackDeltaSubprotocol = "scope-delta.msgpack"
+)
+
+// Types of the messages browsers send on the topology websocket, as the JSON
+// of a websocketMessage. Pausing stops topologies being pushed until resumed.
+const (
+	websocketPause  = "pause"
+	websocketResume = "resume"
+)
+
+type websocketMessage struct {
+	Type string `json:"type"`
+}
+
+var (
+	websocketSubprotocols  = []string{MsgpackDeltaSubprotocol, JSONDeltaSubprotocol}
+	websocketMsgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+)
+
 // APITopology is returned by the /api/topology/{name} handler.
 type APITopology struct {
 	Nodes detailed.NodeSummaries `json:"nodes"`
@@ -30,9 +58,27 @@ type APINode struct {
 
 // Full topology.
 func handleTopology(ctx context.Context, renderer render.Renderer, decorator render.Decorator, rc report.RenderContext, w http.ResponseWriter, r *http.Request) {
-	respondWith(w, http.StatusOK, APITopology{
-		Nodes: detailed.Summaries(rc, renderer.Render(rc.Report, decorator)),
-	})
+	topologyID := mux.Vars(r)["topology"]
+	query, err := searchQuery(r)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	nodes := detailed.Summaries(rc, renderTopology(topologyID, renderer, decorator, rc.Report))
+	if query != nil {
+		nodes = nodes.Search(query)
+	}
+	respondWith(w, http.StatusOK, APITopology{Nodes: nodes})
+}
+
+// searchQuery parses the search query of a request, in its q parameter. It
+// is nil if there is none.
+func searchQuery(r *http.Request) (detailed.Query, error) {
+	q := r.FormValue("q")
+	if q == "" {
+		return nil, nil
+	}
+	return detailed.ParseQuery(q)
 }
 
 // Individual nodes.
@@ -42,17 +88,97 @@ func handleNode(ctx context.Context, renderer render.Renderer, decorator render.
 		topologyID       = vars["topology"]
 		nodeID           = vars["id"]
 		preciousRenderer = render.PreciousNodeRenderer{PreciousNodeID: nodeID, Renderer: renderer}
-		rendered         = preciousRenderer.Render(rc.Report, decorator)
+		rendered         = renderTopology(topologyID, preciousRenderer, decorator, rc.Report)
 		node, ok         = rendered[nodeID]
 	)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	respondWith(w, http.StatusOK, APINode{Node: detailed.MakeNode(topologyID, rc, rendered, node)})
+	apiNode := APINode{Node: detailed.MakeNode(topologyID, rc, rendered, node)}
+	// Controls are only shown to users allowed to invoke them.
+	if !RoleFromRequest(r).allows(RoleAdmin) {
+		apiNode.Node.Controls = []detailed.ControlInstance{}
+	}
+	// The metrics of the node can be shown over a longer range than the
+	// reports go back, from the metric history.
+	if d := r.FormValue("range"); d != "" {
+		metricRange, err := time.ParseDuration(d)
+		if err != nil || metricRange <= 0 {
+			respondWith(w, http.StatusBadRequest, d)
+			return
+		}
+		if rc.MetricHistory != nil {
+			withMetricHistory(apiNode.Node.Metrics, rc.MetricHistory, nodeID, metricRange)
+		}
+	}
+	respondWith(w, http.StatusOK, apiNode)
+}
+
+func withMetricHistory(rows []report.MetricRow, history report.MetricHistory, nodeID string, d time.Duration) {
+	for i, row := range rows {
+		if m, ok := history.MetricHistory(nodeID, row.ID, d); ok {
+			rows[i].Metric = &m
+		}
+	}
+}
+
+// APITopologyDiff is returned by the /api/topology/{name}/diff handler.
+type APITopologyDiff struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	detailed.Changes
+}
+
+// Changes to a topology between two timestamps, in the from and to
+// parameters. To defaults to now.
+func handleTopologyDiff(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	topologyID := mux.Vars(r)["topology"]
+	if _, ok := topologyRegistry.get(topologyID); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := time.Parse(time.RFC3339, r.Form.Get("from"))
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	to := deserializeTimestamp(r.Form.Get("to"))
+	if !from.Before(to) {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("from %v is not before to %v", from, to))
+		return
+	}
+
+	summaries := func(timestamp time.Time) (detailed.NodeSummaries, error) {
+		rpt, err := rep.Report(ctx, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		renderer, decorator, err := topologyRegistry.RendererForTopology(topologyID, r.Form, rpt)
+		if err != nil {
+			return nil, err
+		}
+		return detailed.Summaries(RenderContextForReporter(rep, rpt), renderTopology(topologyID, renderer, decorator, rpt)), nil
+	}
+	before, err := summaries(from)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	after, err := summaries(to)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWith(w, http.StatusOK, APITopologyDiff{From: from, To: to, Changes: detailed.MakeChanges(before, after)})
 }
 
-// Websocket for the full topology.
+// Websocket for the full topology. Browsers may pause and resume the
+// pushes, with {"type": "pause"} and {"type": "resume"} messages.
 func handleWebsocket(
 	ctx context.Context,
 	rep Reporter,
@@ -71,24 +197,69 @@ func handleWebsocket(
 			return
 		}
 	}
+	// When replaying historic reports, the speed is how many seconds of
+	// reports are played back per second, and the replay stops once the end
+	// timestamp has been reached. Neither means anything of live reports.
+	replaying := r.Form.Get("timestamp") != ""
+	if !replaying && (r.Form.Get("speed") != "" || r.Form.Get("end") != "") {
+		respondWith(w, http.StatusBadRequest, "speed and end need a timestamp to replay from")
+		return
+	}
+	speed := 1.0
+	if s := r.Form.Get("speed"); s != "" {
+		var err error
+		if speed, err = strconv.ParseFloat(s, 64); err != nil || speed <= 0 {
+			respondWith(w, http.StatusBadRequest, s)
+			return
+		}
+	}
+	var endReportingAt time.Time
+	if end := r.Form.Get("end"); end != "" {
+		var err error
+		if endReportingAt, err = time.Parse(time.RFC3339, end); err != nil {
+			respondWith(w, http.StatusBadRequest, end)
+			return
+		}
+	}
+
+	query, err := searchQuery(r)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
 
-	conn, err := xfer.Upgrade(w, r, nil)
+	conn, subprotocol, err := xfer.UpgradeSubprotocol(w, r, websocketSubprotocols)
 	if err != nil {
 		// log.Info("Upgrade:", err)
 		return
 	}
 	defer conn.Close()
 
-	quit := make(chan struct{})
+	var (
+		quit     = make(chan struct{})
+		done     = make(chan struct{})
+		controls = make(chan string)
+	)
+	defer close(done)
 	go func(c xfer.Websocket) {
-		for { // just discard everything the browser sends
-			if _, _, err := c.ReadMessage(); err != nil {
+		for { // discard everything the browser sends, but pauses and resumes
+			messageType, p, err := c.ReadMessage()
+			if err != nil {
 				if !xfer.IsExpectedWSCloseError(err) {
 					log.Error("err:", err)
 				}
 				close(quit)
 				break
 			}
+			var msg websocketMessage
+			if messageType != websocket.TextMessage || codec.NewDecoderBytes(p, &codec.JsonHandle{}).Decode(&msg) != nil {
+				continue
+			}
+			select {
+			case controls <- msg.Type:
+			case <-done:
+				return
+			}
 		}
 	}(conn)
 
@@ -99,6 +270,9 @@ func handleWebsocket(
 		topologyID       = mux.Vars(r)["topology"]
 		startReportingAt = deserializeTimestamp(r.Form.Get("timestamp"))
 		channelOpenedAt  = time.Now()
+		paused           bool
+		pausedAt         time.Time
+		pausedFor        time.Duration // of replays, which don't move on while paused
 	)
 
 	rep.WaitOn(ctx, wait)
@@ -108,11 +282,7 @@ func handleWebsocket(
 		// We measure how much time has passed since the channel was opened
 		// and add it to the initial report timestamp to get the timestamp
 		// of the snapshot we want to report right now.
-		// NOTE: Multiplying `timestampDelta` by a constant factor here
-		// would have an effect of fast-forward, which is something we
-		// might be interested in implementing in the future.
-		timestampDelta := time.Since(channelOpenedAt)
-		reportTimestamp := startReportingAt.Add(timestampDelta)
+		reportTimestamp, finished := replayTimestamp(startReportingAt, endReportingAt, time.Since(channelOpenedAt)-pausedFor, speed, time.Now())
 		re, err := rep.Report(ctx, reportTimestamp)
 		if err != nil {
 			log.Errorf("Error generating report: %v", err)
@@ -123,22 +293,90 @@ func handleWebsocket(
 			log.Errorf("Error generating report: %v", err)
 			return
 		}
-		newTopo := detailed.Summaries(RenderContextForReporter(rep, re), renderer.Render(re, decorator))
-		diff := detailed.TopoDiff(previousTopo, newTopo)
+		newTopo := detailed.Summaries(RenderContextForReporter(rep, re), renderTopology(topologyID, renderer, decorator, re))
+		if query != nil {
+			newTopo = newTopo.Search(query)
+		}
+		var diff detailed.Diff
+		if subprotocol == "" {
+			diff = detailed.TopoDiff(previousTopo, newTopo)
+		} else {
+			diff = detailed.TopoDelta(previousTopo, newTopo)
+		}
 		previousTopo = newTopo
 
-		if err := conn.WriteJSON(diff); err != nil {
+		if err := writeDiff(conn, subprotocol, diff); err != nil {
 			if !xfer.IsExpectedWSCloseError(err) {
 				log.Errorf("cannot serialize topology diff: %s", err)
 			}
 			return
 		}
 
-		select {
-		case <-wait:
-		case <-tick:
-		case <-quit:
-			return
+		if finished {
+			// Keep showing the last snapshot until the browser goes away.
+			for {
+				select {
+				case <-controls:
+				case <-quit:
+					return
+				}
+			}
 		}
+
+		// While paused nothing is rendered, and the last topology sent is
+		// kept, so that resuming sends a single diff from it to the
+		// current one rather than the browser refreshing everything.
+	waitForUpdate:
+		for {
+			select {
+			case <-wait:
+				if !paused {
+					break waitForUpdate
+				}
+			case <-tick:
+				if !paused {
+					break waitForUpdate
+				}
+			case control := <-controls:
+				switch {
+				case control == websocketPause && !paused:
+					paused, pausedAt = true, time.Now()
+				case control == websocketResume && paused:
+					paused = false
+					if replaying {
+						pausedFor += time.Since(pausedAt)
+					}
+					break waitForUpdate
+				}
+			case <-quit:
+				return
+			}
+		}
+	}
+}
+
+func writeDiff(conn xfer.Websocket, subprotocol string, diff detailed.Diff) error {
+	if subprotocol != MsgpackDeltaSubprotocol {
+		return conn.WriteJSON(diff)
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, websocketMsgpackHandle).Encode(diff); err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+// replayTimestamp gives the timestamp of the report to show once elapsed time
+// has passed since a websocket started replaying reports from start, and
+// whether the end of the replay has been reached. A zero end never finishes.
+// Replays faster than real time catch up with now, rather than overtake it.
+func replayTimestamp(start, end time.Time, elapsed time.Duration, speed float64, now time.Time) (time.Time, bool) {
+	timestamp := start.Add(time.Duration(float64(elapsed) * speed))
+	if timestamp.After(now) {
+		timestamp = now
+	}
+	if !end.IsZero() && !timestamp.Before(end) {
+		return end, true
 	}
+	return timestamp, false
 }
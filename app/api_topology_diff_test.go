@@ -0,0 +1,60 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+// historicReporter gives one report before a time, and another after.
+type historicReporter struct {
+	app.StaticCollector
+	before report.Report
+	at     time.Time
+}
+
+func (h historicReporter) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	if timestamp.Before(h.at) {
+		return h.before, nil
+	}
+	return h.StaticCollector.Report(ctx, timestamp)
+}
+
+func TestAPITopologyDiff(t *testing.T) {
+	at := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := fixture.Report.Copy()
+	before.ID = "before"
+	server := before.Container.Nodes[fixture.ServerContainerNodeID]
+	before.Container.Nodes[fixture.ServerContainerNodeID] = server.WithLatests(map[string]string{docker.ContainerStateHuman: "paused"})
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, historicReporter{app.StaticCollector(fixture.Report), before, at}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	body := getRawJSON(t, ts, "/api/topology/containers/diff?from=2017-06-01T11:00:00Z&to=2017-06-01T13:00:00Z")
+	var diff app.APITopologyDiff
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&diff); err != nil {
+		t.Fatal(err)
+	}
+	want := []detailed.NodeChange{{
+		ID:       fixture.ServerContainerNodeID,
+		Label:    "server",
+		Metadata: []detailed.MetadataChange{{ID: docker.ContainerStateHuman, Label: "State", From: "paused", To: "running"}},
+	}}
+	equals(t, want, diff.ChangedNodes)
+	equals(t, 0, len(diff.AddedNodes)+len(diff.RemovedNodes)+len(diff.AddedEdges)+len(diff.RemovedEdges))
+
+	is400(t, ts, "/api/topology/containers/diff?from=yesterday")
+	is400(t, ts, "/api/topology/containers/diff?from=2017-06-01T13:00:00Z&to=2017-06-01T11:00:00Z")
+	is404(t, ts, "/api/topology/foobar/diff?from=2017-06-01T11:00:00Z")
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayTimestamp(t *testing.T) {
+	var (
+		start = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		end   = start.Add(10 * time.Minute)
+		now   = start.Add(time.Hour)
+	)
+	for _, c := range []struct {
+		end      time.Time
+		elapsed  time.Duration
+		speed    float64
+		want     time.Time
+		finished bool
+	}{
+		{time.Time{}, 5 * time.Second, 1, start.Add(5 * time.Second), false},
+		{time.Time{}, 5 * time.Second, 60, start.Add(5 * time.Minute), false},
+		{end, 5 * time.Second, 0.5, start.Add(2500 * time.Millisecond), false},
+		{end, 10 * time.Second, 60, end, true},
+		{end, time.Minute, 60, end, true},
+		// Replays don't go past now
+		{time.Time{}, 2 * time.Minute, 60, now, false},
+		{now.Add(time.Minute), 2 * time.Minute, 60, now, false},
+	} {
+		have, finished := replayTimestamp(start, c.end, c.elapsed, c.speed, now)
+		if !have.Equal(c.want) || finished != c.finished {
+			t.Errorf("replayTimestamp(%v, %v, %v): want %v, %v; have %v, %v", c.end, c.elapsed, c.speed, c.want, c.finished, have, finished)
+		}
+	}
+}
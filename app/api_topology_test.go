@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v2"
 
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/render/detailed"
@@ -88,6 +90,7 @@ func TestAPITopologyHosts(t *testing.T) {
 	ts := topologyServer()
 	defer ts.Close()
 	is404(t, ts, "/api/topology/hosts/foobar")
+	is400(t, ts, "/api/topology/hosts/"+fixture.ServerHostNodeID+"?range=forever")
 	{
 		body := getRawJSON(t, ts, "/api/topology/hosts")
 		var topo app.APITopology
@@ -152,4 +155,141 @@ func TestAPITopologyWebsocket(t *testing.T) {
 	equals(t, 0, len(d.Remove))
 }
 
+func TestAPITopologyWebsocketMsgpack(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	ts.URL = "ws" + ts.URL[len("http"):]
+	dialer := &websocket.Dialer{Subprotocols: []string{app.MsgpackDeltaSubprotocol}}
+	ws, res, err := dialer.Dial(ts.URL+"/api/topology/processes/ws", nil)
+	ok(t, err)
+	defer ws.Close()
+	equals(t, app.MsgpackDeltaSubprotocol, res.Header.Get("Sec-Websocket-Protocol"))
+
+	messageType, p, err := ws.ReadMessage()
+	ok(t, err)
+	equals(t, websocket.BinaryMessage, messageType)
+	var d detailed.Diff
+	if err := codec.NewDecoderBytes(p, &codec.MsgpackHandle{}).Decode(&d); err != nil {
+		t.Fatalf("MessagePack parse error: %s", err)
+	}
+	equals(t, 6, len(d.Add))
+	equals(t, 0, len(d.Patch))
+}
+
+func TestAPITopologyWebsocketReplay(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	ts.URL = "ws" + ts.URL[len("http"):]
+	dialer := &websocket.Dialer{}
+
+	for _, speed := range []string{"0", "-1", "fast"} {
+		_, res, err := dialer.Dial(ts.URL+"/api/topology/processes/ws?speed="+speed, nil)
+		if err == nil {
+			t.Fatalf("speed %q: expected the websocket request to be rejected", speed)
+		}
+		equals(t, 400, res.StatusCode)
+	}
+
+	// Live reports can't be sped up, nor end
+	for _, query := range []string{"speed=60", "end=2017-01-01T00:10:00Z"} {
+		_, res, err := dialer.Dial(ts.URL+"/api/topology/processes/ws?"+query, nil)
+		if err == nil {
+			t.Fatalf("%s: expected the websocket request to be rejected", query)
+		}
+		equals(t, 400, res.StatusCode)
+	}
+
+	url := "/api/topology/processes/ws?timestamp=2017-01-01T00:00:00Z&end=2017-01-01T00:10:00Z&speed=60"
+	ws, _, err := dialer.Dial(ts.URL+url, nil)
+	ok(t, err)
+	defer ws.Close()
+
+	_, p, err := ws.ReadMessage()
+	ok(t, err)
+	var d detailed.Diff
+	decoder := codec.NewDecoderBytes(p, &codec.JsonHandle{})
+	if err := decoder.Decode(&d); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	equals(t, 6, len(d.Add))
+}
+
+func TestAPITopologyWebsocketPause(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	ts.URL = "ws" + ts.URL[len("http"):]
+	dialer := &websocket.Dialer{}
+	ws, _, err := dialer.Dial(ts.URL+"/api/topology/processes/ws?t=10ms", nil)
+	ok(t, err)
+	defer ws.Close()
+
+	diffs := make(chan detailed.Diff, 100)
+	go func() {
+		defer close(diffs)
+		for {
+			_, p, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var d detailed.Diff
+			if err := codec.NewDecoderBytes(p, &codec.JsonHandle{}).Decode(&d); err != nil {
+				t.Errorf("JSON parse error: %s", err)
+				return
+			}
+			diffs <- d
+		}
+	}()
+	equals(t, 6, len((<-diffs).Add))
+
+	ok(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"type": "pause"}`)))
+	// Diffs sent before the pause arrived may still be on their way
+	time.Sleep(50 * time.Millisecond)
+	for len(diffs) > 0 {
+		<-diffs
+	}
+	select {
+	case <-diffs:
+		t.Fatal("diff pushed while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ok(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"type": "resume"}`)))
+	select {
+	case d := <-diffs:
+		equals(t, 0, len(d.Add))
+		equals(t, 0, len(d.Remove))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no diff after resuming")
+	}
+}
+
 func newu64(value uint64) *uint64 { return &value }
+
+func TestAPITopologyDependencies(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	var dependencies app.APIDependencies
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/hosts/dependencies"), &codec.JsonHandle{}).Decode(&dependencies); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "hosts", dependencies.Topology)
+	res, body := checkGet(t, ts, "/api/topology/hosts/dependencies?format=yaml")
+	equals(t, "application/x-yaml", res.Header.Get("Content-Type"))
+	var yamlDependencies app.APIDependencies
+	if err := yaml.Unmarshal(body, &yamlDependencies); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, dependencies, yamlDependencies)
+	for _, n := range dependencies.Nodes {
+		if n.ID == fixture.ClientHostNodeID {
+			equals(t, []detailed.Dependency{{
+				ID:    fixture.ServerHostNodeID,
+				Label: "server",
+				Ports: []detailed.DependencyPort{{Port: 80, Transport: "tcp"}},
+			}}, n.Dependencies)
+		}
+	}
+
+	is400(t, ts, "/api/topology/hosts/dependencies?format=xml")
+}
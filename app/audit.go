@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// AuditEvent is the record of a control invoked through the API.
+type AuditEvent struct {
+	Time       time.Time         `json:"time"`
+	User       string            `json:"user"`
+	Role       Role              `json:"role"`
+	RemoteAddr string            `json:"remote_addr"`
+	ProbeID    string            `json:"probe_id"`
+	NodeID     string            `json:"node_id"`
+	Control    string            `json:"control"`
+	Args       map[string]string `json:"args,omitempty"`
+	Result     string            `json:"result"` // "ok" or "error"
+	Error      string            `json:"error,omitempty"`
+}
+
+// AuditSink is somewhere AuditEvents are written to.
+type AuditSink interface {
+	Audit(AuditEvent) error
+}
+
+// AuditSinks writes AuditEvents to each AuditSink in turn.
+type AuditSinks []AuditSink
+
+// Audit implements AuditSink.
+func (as AuditSinks) Audit(e AuditEvent) error {
+	var errs []string
+	for _, a := range as {
+		if err := a.Audit(e); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// NewAuditSink makes an AuditSink from a URL: file:///path for a file of
+// JSON lines, syslog:// or syslog://host:port for the local or a remote
+// syslog, and http(s):// for a webhook each event is POSTed to, as JSON.
+func NewAuditSink(sinkURL string) (AuditSink, error) {
+	u, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return NewFileAuditSink(u.Path)
+	case "syslog":
+		return NewSyslogAuditSink(u.Host)
+	case "http", "https":
+		return NewWebhookAuditSink(sinkURL), nil
+	}
+	return nil, fmt.Errorf("Invalid audit sink '%s'", sinkURL)
+}
+
+type fileAuditSink struct {
+	sync.Mutex
+	f *os.File
+}
+
+// NewFileAuditSink makes an AuditSink appending each event to a file, as a
+// line of JSON.
+func NewFileAuditSink(filename string) (AuditSink, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{f: f}, nil
+}
+
+func (s *fileAuditSink) Audit(e AuditEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.f.Write(append(buf, '\n'))
+	return err
+}
+
+type webhookAuditSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAuditSink makes an AuditSink POSTing each event to a URL, as
+// JSON.
+func NewWebhookAuditSink(url string) AuditSink {
+	return &webhookAuditSink{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (s *webhookAuditSink) Audit(e AuditEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// NewAuditingControlRouter makes a ControlRouter recording the controls
+// invoked through the API to sink. Controls the app invokes itself aren't
+// recorded.
+func NewAuditingControlRouter(cr ControlRouter, sink AuditSink) ControlRouter {
+	return &auditingControlRouter{ControlRouter: cr, sink: sink}
+}
+
+type auditingControlRouter struct {
+	ControlRouter
+	sink AuditSink
+}
+
+func (cr *auditingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := cr.ControlRouter.Handle(ctx, probeID, req)
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	if !ok {
+		return res, err
+	}
+	user := UserFromRequest(r)
+	e := AuditEvent{
+		Time:       mtime.Now(),
+		User:       user.Name,
+		Role:       user.Role,
+		RemoteAddr: r.RemoteAddr,
+		ProbeID:    probeID,
+		NodeID:     req.NodeID,
+		Control:    req.Control,
+		Args:       req.ControlArgs,
+		Result:     "ok",
+	}
+	if err != nil {
+		e.Result, e.Error = "error", err.Error()
+	} else if res.Error != "" {
+		e.Result, e.Error = "error", res.Error
+	}
+	if auditErr := cr.sink.Audit(e); auditErr != nil {
+		log.Errorf("Error auditing control %s of %s: %v", req.Control, req.NodeID, auditErr)
+	}
+	return res, err
+}
@@ -0,0 +1,34 @@
+// +build !windows
+
+package app
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+type syslogAuditSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogAuditSink makes an AuditSink writing each event to syslog, as
+// JSON. An empty addr is the local syslog; others are reached over UDP.
+func NewSyslogAuditSink(addr string) (AuditSink, error) {
+	network := ""
+	if addr != "" {
+		network = "udp"
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_NOTICE|syslog.LOG_AUTH, "scope-audit")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogAuditSink{w: w}, nil
+}
+
+func (s *syslogAuditSink) Audit(e AuditEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.w.Notice(string(buf))
+}
@@ -0,0 +1,10 @@
+package app
+
+import (
+	"fmt"
+)
+
+// NewSyslogAuditSink fails on Windows, which has no syslog.
+func NewSyslogAuditSink(addr string) (AuditSink, error) {
+	return nil, fmt.Errorf("syslog audit sinks are not supported on Windows")
+}
@@ -0,0 +1,129 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+type mockAuditSink struct {
+	events []app.AuditEvent
+}
+
+func (s *mockAuditSink) Audit(e app.AuditEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestAuditingControlRouter(t *testing.T) {
+	ctx := context.Background()
+	sink := &mockAuditSink{}
+	cr := app.NewAuditingControlRouter(app.NewLocalControlRouter(), sink)
+	if _, err := cr.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		if req.Control == "stop" {
+			return xfer.Response{}
+		}
+		return xfer.ResponseErrorf("unknown control %s", req.Control)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterControlRoutes(router, cr)
+	tokens := app.StaticTokens{"token": {Name: "alice", Role: app.RoleAdmin}}
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: tokens}.Wrap(router))
+	defer ts.Close()
+
+	for _, control := range []string{"stop", "exec"} {
+		req, err := http.NewRequest("POST", ts.URL+"/api/control/probe1/container1/"+control, strings.NewReader(`{"arg":"foo"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// Controls the app invokes itself aren't audited
+	if _, err := cr.Handle(ctx, "probe1", xfer.Request{NodeID: "container1", Control: "stop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %v", sink.events)
+	}
+	e := sink.events[0]
+	if e.User != "alice" || e.Role != app.RoleAdmin || e.ProbeID != "probe1" || e.NodeID != "container1" ||
+		e.Control != "stop" || e.Args["arg"] != "foo" || e.Result != "ok" || e.RemoteAddr == "" || e.Time.IsZero() {
+		t.Errorf("Unexpected audit event %+v", e)
+	}
+	if e := sink.events[1]; e.Control != "exec" || e.Result != "error" || e.Error != "unknown control exec" {
+		t.Errorf("Unexpected audit event %+v", e)
+	}
+}
+
+func TestAuditSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	var received []app.AuditEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e app.AuditEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		received = append(received, e)
+	}))
+	defer webhook.Close()
+
+	var sinks app.AuditSinks
+	for _, sinkURL := range []string{"file://" + filename, webhook.URL} {
+		sink, err := app.NewAuditSink(sinkURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if _, err := app.NewAuditSink("ftp://foo"); err == nil {
+		t.Error("Expected an error for an invalid sink")
+	}
+
+	for _, control := range []string{"stop", "exec"} {
+		if err := sinks.Audit(app.AuditEvent{User: "alice", Control: control, Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buf)
+	}
+	var e app.AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil || e.User != "alice" || e.Control != "exec" {
+		t.Errorf("Unexpected line %q: %v", lines[1], err)
+	}
+	if len(received) != 2 || received[0].Control != "stop" {
+		t.Errorf("Unexpected events received by the webhook: %v", received)
+	}
+}
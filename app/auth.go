@@ -0,0 +1,451 @@
+package app
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// Role is what a user of the app is allowed to do.
+type Role string
+
+// The roles of users of the app. Viewers can look at topologies and reports,
+// but not invoke controls or use pipes. Probes can only shake hands with the
+// app, publish reports, and connect controls and pipes and close the
+// latter. Admins can do everything.
+const (
+	RoleViewer Role = "viewer"
+	RoleAdmin  Role = "admin"
+	RoleProbe  Role = "probe"
+)
+
+// ParseRole parses the name of a role.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleViewer, RoleAdmin, RoleProbe:
+		return r, nil
+	}
+	return "", fmt.Errorf("Unknown role %q", s)
+}
+
+// allows tells whether the role is allowed to do what needs the other one.
+func (r Role) allows(needed Role) bool {
+	return r == RoleAdmin || r == needed
+}
+
+// User is an authenticated user of the app. Enrolled probes are of the
+// Cluster they enrolled for, and can only publish the reports of it.
+type User struct {
+	Name    string
+	Role    Role
+	Cluster string
+}
+
+const userCtxKey contextKey = contextKey("user")
+
+// UserFromRequest gives the user making an authenticated request. Requests
+// are only authenticated if the app has an AuthMiddleware; without one,
+// everyone is an anonymous admin.
+func UserFromRequest(r *http.Request) User {
+	if user, ok := r.Context().Value(userCtxKey).(User); ok {
+		return user
+	}
+	return User{Role: RoleAdmin}
+}
+
+// RoleFromRequest gives the role of the user making a request.
+func RoleFromRequest(r *http.Request) Role {
+	return UserFromRequest(r).Role
+}
+
+// Authenticator finds the user making a request from its token. It returns
+// false if it doesn't know the token.
+type Authenticator interface {
+	Authenticate(token string) (User, bool, error)
+}
+
+// Authenticators tries each Authenticator in turn.
+type Authenticators []Authenticator
+
+// Authenticate implements Authenticator.
+func (as Authenticators) Authenticate(token string) (User, bool, error) {
+	for _, a := range as {
+		user, ok, err := a.Authenticate(token)
+		if err != nil || ok {
+			return user, ok, err
+		}
+	}
+	return User{}, false, nil
+}
+
+// AuthCookie is the cookie the token of a request can be in, for requests
+// which can't set headers, like websockets opened by browsers.
+const AuthCookie = "scope_token"
+
+// requestToken gives the token of a request. It is a bearer token, or the
+// token probes send, or the AuthCookie.
+func requestToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	for _, prefix := range []string{"Bearer ", "Scope-Probe token="} {
+		if strings.HasPrefix(authorization, prefix) {
+			return strings.TrimPrefix(authorization, prefix)
+		}
+	}
+	if cookie, err := r.Cookie(AuthCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requiredRole gives the role needed for a request, besides probes making
+// the requests shared with them. Only the API is authenticated; the UI
+// itself has no data. Probes enrolling authenticate with their enrollment
+// tokens instead, and the apps of a sharded cluster with the token of the
+// cluster, checked by Sharding.Wrap.
+func requiredRole(r *http.Request) (Role, bool) {
+	path := r.URL.Path
+	switch {
+	case !strings.HasPrefix(path, "/api"), path == xfer.EnrollmentPath:
+		return "", false
+	case shardPeer(r), path == shardingGossipPath:
+		return "", false
+	case r.Method == "POST" && path == "/api/report",
+		path == "/api/control/ws",
+		strings.HasPrefix(path, "/api/pipe/") && strings.HasSuffix(path, "/probe"):
+		return RoleProbe, true
+	case strings.HasPrefix(path, "/api/control/"), strings.HasPrefix(path, "/api/pipe/"):
+		return RoleAdmin, true
+	case strings.HasPrefix(path, "/api/layouts"):
+		// Viewers save layouts of their own.
+		return RoleViewer, true
+	case r.Method != "GET":
+		return RoleAdmin, true
+	}
+	return RoleViewer, true
+}
+
+// sharedWithProbes tells whether probes make a request users make too: the
+// handshake of probes with the app, and closing pipes.
+func sharedWithProbes(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case r.Method == "GET" && path == "/api":
+		return true
+	case r.Method == "DELETE" && strings.HasPrefix(path, "/api/pipe/"):
+		return !strings.Contains(strings.TrimPrefix(path, "/api/pipe/"), "/")
+	}
+	return false
+}
+
+// clientCertUser gives the probe presenting a verified client certificate,
+// named after its subject.
+func clientCertUser(r *http.Request) (User, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return User{}, false
+	}
+	return User{Name: r.TLS.VerifiedChains[0][0].Subject.CommonName, Role: RoleProbe}, true
+}
+
+// AuthMiddleware only lets requests to the API through if their token gives
+// a role allowed to make them. With ClientCerts, the requests of probes are
+// authenticated by their verified client certificates instead of tokens;
+// those which users make too, by tokens without certificates.
+// Authenticator may be nil if only probes are authenticated.
+type AuthMiddleware struct {
+	Authenticator Authenticator
+	ClientCerts   bool
+}
+
+// Wrap implements middleware.Interface
+func (a AuthMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		needed, ok := requiredRole(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		probes := needed == RoleProbe || sharedWithProbes(r)
+		if a.ClientCerts && probes {
+			if user, ok := clientCertUser(r); ok {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey, user)))
+				return
+			}
+			// Users making the requests probes make too have tokens
+			if needed == RoleProbe {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if a.Authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := requestToken(r)
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, ok, err := a.Authenticator.Authenticate(token)
+		if err != nil {
+			log.Errorf("Error authenticating request: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.Role.allows(needed) && !(user.Role == RoleProbe && probes) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey, user)))
+	})
+}
+
+// StaticTokens is an Authenticator with a fixed set of tokens.
+type StaticTokens map[string]User
+
+// NewStaticTokens reads static tokens from a file, with a token,role[,name]
+// line per token.
+func NewStaticTokens(filename string) (StaticTokens, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens := StaticTokens{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Split(text, ",")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("%s:%d: expected token,role[,name]", filename, line)
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		user := User{Role: role}
+		if len(parts) == 3 {
+			user.Name = parts[2]
+		}
+		tokens[parts[0]] = user
+	}
+	return tokens, scanner.Err()
+}
+
+// Authenticate implements Authenticator.
+func (s StaticTokens) Authenticate(token string) (User, bool, error) {
+	user, ok := s[token]
+	return user, ok, nil
+}
+
+// oidcKeysRefreshInterval is the least time between fetches of the keys of
+// an OpenID Connect issuer.
+const oidcKeysRefreshInterval = time.Minute
+
+// OIDC is an Authenticator of OpenID Connect ID tokens, signed by the
+// issuer with RS256. Users are named by the email claim of their tokens, or
+// the subject if there is none. Users with the admin group in the groups
+// claim are admins; all others are viewers.
+type OIDC struct {
+	issuer      string
+	clientID    string
+	groupsClaim string
+	adminGroup  string
+	client      *http.Client
+
+	mtx         sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	lastFetched time.Time
+}
+
+// NewOIDC makes a new OIDC Authenticator.
+func NewOIDC(issuer, clientID, groupsClaim, adminGroup string) *OIDC {
+	return &OIDC{
+		issuer:      strings.TrimSuffix(issuer, "/"),
+		clientID:    clientID,
+		groupsClaim: groupsClaim,
+		adminGroup:  adminGroup,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		keys:        map[string]*rsa.PublicKey{},
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate implements Authenticator. Tokens which aren't JWTs are left
+// to other Authenticators.
+func (o *OIDC) Authenticate(token string) (User, bool, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return User{}, false, nil
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return User{}, false, nil
+	}
+	if header.Alg != "RS256" {
+		return User{}, false, nil
+	}
+	key, err := o.key(header.Kid)
+	if err != nil || key == nil {
+		return User{}, false, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return User{}, false, nil
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return User{}, false, nil
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return User{}, false, nil
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != o.issuer {
+		return User{}, false, nil
+	}
+	if !claimContains(claims["aud"], o.clientID) {
+		return User{}, false, nil
+	}
+	now := float64(mtime.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok || exp < now {
+		return User{}, false, nil
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && nbf > now {
+		return User{}, false, nil
+	}
+	user := User{Role: RoleViewer}
+	if o.adminGroup != "" && claimContains(claims[o.groupsClaim], o.adminGroup) {
+		user.Role = RoleAdmin
+	}
+	if user.Name, _ = claims["email"].(string); user.Name == "" {
+		user.Name, _ = claims["sub"].(string)
+	}
+	return user, true, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// claimContains tells whether a claim is, or is a list containing, value.
+func claimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []interface{}:
+		for _, v := range c {
+			if s, ok := v.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key gives the key with the given ID, fetching the keys of the issuer if
+// it isn't known, unless they have just been fetched.
+func (o *OIDC) key(kid string) (*rsa.PublicKey, error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	now := mtime.Now()
+	if now.Sub(o.lastFetched) < oidcKeysRefreshInterval {
+		return nil, nil
+	}
+	o.lastFetched = now
+	keys, err := o.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	o.keys = keys
+	return keys[kid], nil
+}
+
+type oidcDiscovery struct {
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (o *OIDC) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	var discovery oidcDiscovery
+	if err := o.getJSON(o.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	var set jwks
+	if err := o.getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(url string, v interface{}) error {
+	resp, err := o.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,253 @@
+package app_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestStaticTokens(t *testing.T) {
+	f, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, "# token,role[,name]\nabc,viewer\n\ndef,admin,alice")
+	f.Close()
+
+	tokens, err := app.NewStaticTokens(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, want := range map[string]app.User{"abc": {Role: app.RoleViewer}, "def": {Name: "alice", Role: app.RoleAdmin}} {
+		if user, ok, err := tokens.Authenticate(token); err != nil || !ok || user != want {
+			t.Errorf("%s: expected %v, got %v, %v, %v", token, want, user, ok, err)
+		}
+	}
+	if _, ok, _ := tokens.Authenticate("ghi"); ok {
+		t.Error("Expected an unknown token not to authenticate")
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("abc,root\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.NewStaticTokens(f.Name()); err == nil {
+		t.Error("Expected an error for an unknown role")
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host.Controls.AddControl(report.Control{ID: "host_exec", Human: "Exec shell", Icon: "fa-terminal"})
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host1"), map[string]string{report.ControlProbeID: "probe1"}).WithTopology(report.Host).WithLatestActiveControls("host_exec"))
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	app.RegisterControlRoutes(router, app.NewLocalControlRouter())
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tokens := app.StaticTokens{"viewer": {Role: app.RoleViewer}, "admin": {Role: app.RoleAdmin}, "probe": {Role: app.RoleProbe}}
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: tokens}.Wrap(router))
+	defer ts.Close()
+
+	nodePath := "/api/topology/hosts/" + url.QueryEscape(report.MakeHostNodeID("host1"))
+	for _, tc := range []struct {
+		method, path, token string
+		code                int
+	}{
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/api/topology", "", http.StatusUnauthorized},
+		{"GET", "/api/topology", "foo", http.StatusUnauthorized},
+		{"GET", "/api/topology", "viewer", http.StatusOK},
+		{"GET", "/api/topology", "probe", http.StatusForbidden},
+		{"POST", "/api/control/probe1/host1/host_exec", "viewer", http.StatusForbidden},
+		{"POST", "/api/control/probe1/host1/host_exec", "probe", http.StatusForbidden},
+		{"POST", "/api/control/probe1/host1/host_exec", "admin", http.StatusBadRequest}, // no such probe
+		{"GET", "/api/pipe/pipe1", "viewer", http.StatusForbidden},
+		{"GET", "/api/pipe/pipe1/probe", "viewer", http.StatusForbidden},
+		{"GET", "/api/pipe/pipe1/probe", "probe", http.StatusOK},
+		// Probes shake hands with the app, and close their pipes
+		{"GET", "/api", "probe", http.StatusOK},
+		{"GET", "/api", "viewer", http.StatusOK},
+		{"POST", "/api", "probe", http.StatusForbidden},
+		{"DELETE", "/api/pipe/pipe1", "probe", http.StatusOK},
+		{"DELETE", "/api/pipe/pipe1", "viewer", http.StatusForbidden},
+		{"DELETE", "/api/pipe/pipe1/check", "probe", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s %s as %q: expected %d, got %d", tc.method, tc.path, tc.token, tc.code, resp.StatusCode)
+		}
+	}
+
+	// Controls are filtered out for viewers
+	for token, want := range map[string]int{"viewer": 0, "admin": 1} {
+		req, err := http.NewRequest("GET", ts.URL+nodePath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: app.AuthCookie, Value: token})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var node struct {
+			Node struct {
+				Controls []interface{} `json:"controls"`
+			} `json:"node"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&node)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(node.Node.Controls) != want {
+			t.Errorf("%s: expected %d controls, got %d", token, want, len(node.Node.Controls))
+		}
+	}
+}
+
+func TestAuthMiddlewareClientCerts(t *testing.T) {
+	var user app.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = app.UserFromRequest(r)
+	})
+	handler := app.AuthMiddleware{ClientCerts: true}.Wrap(next)
+	withTokens := app.AuthMiddleware{ClientCerts: true, Authenticator: app.StaticTokens{"viewer": {Role: app.RoleViewer}}}.Wrap(next)
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "probe1"}}}}}
+	probe1 := app.User{Name: "probe1", Role: app.RoleProbe}
+	for _, tc := range []struct {
+		tokens       bool
+		method, path string
+		tls          *tls.ConnectionState
+		code         int
+		user         app.User
+	}{
+		{false, "POST", "/api/report", nil, http.StatusUnauthorized, app.User{}},
+		{false, "POST", "/api/report", &tls.ConnectionState{}, http.StatusUnauthorized, app.User{}},
+		{false, "POST", "/api/report", verified, http.StatusOK, probe1},
+		{false, "GET", "/api/control/ws", verified, http.StatusOK, probe1},
+		// Without an Authenticator, the rest of the API is open
+		{false, "GET", "/api/topology", nil, http.StatusOK, app.User{Role: app.RoleAdmin}},
+		// With one, probes still shake hands and close pipes with their
+		// certificates
+		{true, "GET", "/api", verified, http.StatusOK, probe1},
+		{true, "DELETE", "/api/pipe/pipe1", verified, http.StatusOK, probe1},
+		{true, "GET", "/api", nil, http.StatusUnauthorized, app.User{}},
+		{true, "GET", "/api/topology", verified, http.StatusUnauthorized, app.User{}},
+	} {
+		user = app.User{}
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.TLS = tc.tls
+		w := httptest.NewRecorder()
+		if tc.tokens {
+			withTokens.ServeHTTP(w, req)
+		} else {
+			handler.ServeHTTP(w, req)
+		}
+		if w.Code != tc.code || user != tc.user {
+			t.Errorf("%s %s: expected %d as %v, got %d as %v", tc.method, tc.path, tc.code, tc.user, w.Code, user)
+		}
+	}
+}
+
+func TestOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	sign := func(kid string, claims map[string]interface{}) string {
+		part := func(v interface{}) string {
+			buf, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return base64.RawURLEncoding.EncodeToString(buf)
+		}
+		signed := part(map[string]string{"alg": "RS256", "kid": kid}) + "." + part(claims)
+		hash := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	claims := func(aud interface{}, exp time.Duration, groups ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    server.URL,
+			"aud":    aud,
+			"exp":    time.Now().Add(exp).Unix(),
+			"sub":    "1234",
+			"groups": groups,
+		}
+	}
+
+	oidc := app.NewOIDC(server.URL, "scope", "groups", "ops")
+	for _, tc := range []struct {
+		name  string
+		token string
+		ok    bool
+		user  app.User
+	}{
+		{"viewer", sign("key1", claims("scope", time.Hour, "dev")), true, app.User{Name: "1234", Role: app.RoleViewer}},
+		{"admin", sign("key1", claims([]string{"other", "scope"}, time.Hour, "dev", "ops")), true, app.User{Name: "1234", Role: app.RoleAdmin}},
+		{"expired", sign("key1", claims("scope", -time.Hour, "ops")), false, app.User{}},
+		{"other client", sign("key1", claims("other", time.Hour, "ops")), false, app.User{}},
+		{"unknown key", sign("key2", claims("scope", time.Hour, "ops")), false, app.User{}},
+		{"tampered", strings.Replace(sign("key1", claims("scope", time.Hour, "dev")), ".", ".e", 1), false, app.User{}},
+		{"not a jwt", "abc", false, app.User{}},
+	} {
+		user, ok, err := oidc.Authenticate(tc.token)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if ok != tc.ok || user != tc.user {
+			t.Errorf("%s: expected %v %v, got %v %v", tc.name, tc.ok, tc.user, ok, user)
+		}
+	}
+}
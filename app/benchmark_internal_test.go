@@ -23,7 +23,7 @@ func loadReport() (report.Report, error) {
 		return fixture.Report, nil
 	}
 
-	c, err := NewFileCollector(*benchReportFile, 0)
+	c, err := NewFileCollector(*benchReportFile, 0, 1)
 	if err != nil {
 		return fixture.Report, err
 	}
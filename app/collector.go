@@ -40,6 +40,23 @@ type Reporter interface {
 type WebReporter struct {
 	Reporter
 	MetricsGraphURL string
+	MetricHistory   report.MetricHistory
+	Anomalies       report.Anomalies
+	Annotations     report.Annotations
+	Quarantine      *ReportQuarantine
+}
+
+// withEnrichmentRenderID gives an enriched report an ID of its own, of the
+// report it enriches, the enricher called name, and the generation of what
+// the enricher knows. Renders are cached by report ID (see render.Memoise),
+// while the same report renders differently as its enricher learns more,
+// like addresses and images looked up in the background: the enriched
+// report must miss the renders of the report, and of its enrichments with
+// older generations. Enrichers bump their generation whenever they learn
+// something.
+func withEnrichmentRenderID(rpt report.Report, name string, generation int) report.Report {
+	rpt.ID = fmt.Sprintf("%s-%s-%d", rpt.ID, name, generation)
+	return rpt
 }
 
 // RenderContextForReporter creates the rendering context for the given reporter.
@@ -47,6 +64,9 @@ func RenderContextForReporter(rep Reporter, r report.Report) report.RenderContex
 	rc := report.RenderContext{Report: r}
 	if wrep, ok := rep.(WebReporter); ok {
 		rc.MetricsGraphURL = wrep.MetricsGraphURL
+		rc.MetricHistory = wrep.MetricHistory
+		rc.Anomalies = wrep.Anomalies
+		rc.Annotations = wrep.Annotations
 	}
 	return rc
 }
@@ -69,16 +89,124 @@ type Collector interface {
 
 // Collector receives published reports from multiple producers. It yields a
 // single merged report, representing all collected reports.
+//
+// Reports are merged as they're added, into the quantum of
+// reportQuantisationInterval they were received in. Each topology of a
+// quantum has a lock of its own, so the topologies of a report are merged in
+// parallel, and reports added concurrently only contend on the topologies
+// they share. Report() merges the few quanta within the window, rather than
+// every report, and caches the result until a report is added or a quantum
+// expires.
 type collector struct {
-	mtx        sync.Mutex
-	reports    []report.Report
-	timestamps []time.Time
-	window     time.Duration
-	cached     *report.Report
-	merger     Merger
+	mtx    sync.Mutex
+	quanta []*quantum
+	window time.Duration
+	cached *report.Report
 	waitableCondition
 }
 
+// quantum holds the reports received within a reportQuantisationInterval,
+// merged.
+type quantum struct {
+	start      time.Time
+	topologies map[string]*topologyShard
+
+	sync.Mutex // guards the rest of the report
+	rest       report.Report
+}
+
+type topologyShard struct {
+	sync.Mutex
+	report.Topology
+}
+
+func newQuantum(start time.Time) *quantum {
+	q := &quantum{
+		start:      start,
+		topologies: map[string]*topologyShard{},
+		rest:       report.MakeReport(),
+	}
+	for name, t := range q.rest.TopologyMap() {
+		q.topologies[name] = &topologyShard{Topology: *t}
+		*t = report.Topology{}
+	}
+	return q
+}
+
+// add merges a report into the quantum, topology by topology.
+func (q *quantum) add(rpt report.Report) {
+	var wg sync.WaitGroup
+	for name, t := range rpt.TopologyMap() {
+		if len(t.Nodes) == 0 && len(t.Controls) == 0 && len(t.MetadataTemplates) == 0 &&
+			len(t.MetricTemplates) == 0 && len(t.TableTemplates) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard *topologyShard, t report.Topology) {
+			defer wg.Done()
+			shard.Lock()
+			mergeTopologyInto(&shard.Topology, t)
+			shard.Unlock()
+		}(q.topologies[name], *t)
+	}
+	q.Lock()
+	q.rest.Sampling = q.rest.Sampling.Merge(rpt.Sampling)
+	q.rest.Window += rpt.Window
+	q.rest.Plugins = q.rest.Plugins.Merge(rpt.Plugins)
+	q.Unlock()
+	wg.Wait()
+}
+
+// mergeTopologyInto merges src into dst, whose nodes are merged in place
+// rather than copied.
+func mergeTopologyInto(dst *report.Topology, src report.Topology) {
+	nodes := dst.Nodes
+	if nodes == nil {
+		nodes = report.Nodes{}
+	}
+	for id, n := range src.Nodes {
+		if existing, ok := nodes[id]; ok {
+			n = n.Merge(existing)
+		}
+		nodes[id] = n
+	}
+	dst.Nodes, src.Nodes = nil, nil
+	*dst = dst.Merge(src)
+	dst.Nodes = nodes
+}
+
+// mergeQuanta merges quanta into a new report, topology by topology.
+func mergeQuanta(quanta []*quantum) report.Report {
+	rpt := report.MakeReport()
+	if len(quanta) == 0 {
+		return rpt
+	}
+	var wg sync.WaitGroup
+	for name, t := range rpt.TopologyMap() {
+		wg.Add(1)
+		go func(name string, t *report.Topology) {
+			defer wg.Done()
+			merged := report.MakeTopology()
+			for _, q := range quanta {
+				shard := q.topologies[name]
+				shard.Lock()
+				mergeTopologyInto(&merged, shard.Topology)
+				shard.Unlock()
+			}
+			*t = merged
+		}(name, t)
+	}
+	for _, q := range quanta {
+		q.Lock()
+		rpt.Sampling = rpt.Sampling.Merge(q.rest.Sampling)
+		rpt.Window += q.rest.Window
+		rpt.Plugins = rpt.Plugins.Merge(q.rest.Plugins)
+		q.Unlock()
+	}
+	wg.Wait()
+	return rpt
+}
+
 type waitableCondition struct {
 	sync.Mutex
 	waiters map[chan struct{}]struct{}
@@ -115,20 +243,31 @@ func NewCollector(window time.Duration) Collector {
 		waitableCondition: waitableCondition{
 			waiters: map[chan struct{}]struct{}{},
 		},
-		merger: NewSmartMerger(),
 	}
 }
 
 // Add adds a report to the collector's internal state. It implements Adder.
 func (c *collector) Add(_ context.Context, rpt report.Report, _ []byte) error {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-	c.reports = append(c.reports, rpt)
-	c.timestamps = append(c.timestamps, mtime.Now())
+	shortcut := rpt.Shortcut
+	rpt = rpt.Upgrade()
 
+	now := mtime.Now()
+	c.mtx.Lock()
 	c.clean()
+	if len(c.quanta) == 0 || now.Sub(c.quanta[len(c.quanta)-1].start) >= reportQuantisationInterval {
+		c.quanta = append(c.quanta, newQuantum(now))
+	}
+	q := c.quanta[len(c.quanta)-1]
+	c.mtx.Unlock()
+
+	q.add(rpt)
+
+	// Reports merged while the report was being added may have missed some
+	// of it, so the cache is only invalidated now.
+	c.mtx.Lock()
 	c.cached = nil
-	if rpt.Shortcut {
+	c.mtx.Unlock()
+	if shortcut {
 		c.Broadcast()
 	}
 	return nil
@@ -142,17 +281,15 @@ func (c *collector) Report(_ context.Context, timestamp time.Time) (report.Repor
 
 	// If the oldest report is still within range,
 	// and there is a cached report, return that.
-	if c.cached != nil && len(c.reports) > 0 {
+	if c.cached != nil && len(c.quanta) > 0 {
 		oldest := timestamp.Add(-c.window)
-		if c.timestamps[0].After(oldest) {
+		if c.quanta[0].start.After(oldest) {
 			return *c.cached, nil
 		}
 	}
 
 	c.clean()
-	c.quantise()
-
-	rpt := c.merger.Merge(c.reports).Upgrade()
+	rpt := mergeQuanta(c.quanta)
 	c.cached = &rpt
 	return rpt, nil
 }
@@ -163,51 +300,17 @@ func (c *collector) HasHistoricReports() bool {
 	return false
 }
 
-// remove reports older than the app.window
+// remove the quanta started before the app.window
 func (c *collector) clean() {
-	var (
-		cleanedReports    = make([]report.Report, 0, len(c.reports))
-		cleanedTimestamps = make([]time.Time, 0, len(c.timestamps))
-		oldest            = mtime.Now().Add(-c.window)
-	)
-	for i, r := range c.reports {
-		if c.timestamps[i].After(oldest) {
-			cleanedReports = append(cleanedReports, r)
-			cleanedTimestamps = append(cleanedTimestamps, c.timestamps[i])
-		}
-	}
-	c.reports = cleanedReports
-	c.timestamps = cleanedTimestamps
-}
-
-// Merge reports received within the same reportQuantisationInterval.
-//
-// Quantisation is relative to the time of the first report in a given
-// interval, rather than absolute time. So, for example, with a
-// reportQuantisationInterval of 3s and reports with timestamps [0, 1,
-// 2, 5, 6, 7], the result contains merged reports with
-// timestamps/content of [0:{0,1,2}, 5:{5,6,7}].
-func (c *collector) quantise() {
-	if len(c.reports) == 0 {
-		return
+	oldest := mtime.Now().Add(-c.window)
+	i := 0
+	for i < len(c.quanta) && !c.quanta[i].start.After(oldest) {
+		i++
 	}
-	var (
-		quantisedReports    = make([]report.Report, 0, len(c.reports))
-		quantisedTimestamps = make([]time.Time, 0, len(c.timestamps))
-	)
-	quantumStartIdx := 0
-	quantumStartTimestamp := c.timestamps[0]
-	for i, t := range c.timestamps {
-		if t.Sub(quantumStartTimestamp) < reportQuantisationInterval {
-			continue
-		}
-		quantisedReports = append(quantisedReports, c.merger.Merge(c.reports[quantumStartIdx:i]))
-		quantisedTimestamps = append(quantisedTimestamps, quantumStartTimestamp)
-		quantumStartIdx = i
-		quantumStartTimestamp = t
+	if i > 0 {
+		c.quanta = c.quanta[i:]
+		c.cached = nil
 	}
-	c.reports = append(quantisedReports, c.merger.Merge(c.reports[quantumStartIdx:]))
-	c.timestamps = append(quantisedTimestamps, c.timestamps[quantumStartIdx])
 }
 
 // StaticCollector always returns the given report.
@@ -241,9 +344,13 @@ func (c StaticCollector) UnWait(context.Context, chan struct{}) {}
 // have names representing "nanoseconds since epoch" timestamps,
 // e.g. "1488557088545489008.msgpack.gz", then the collector will
 // return merged reports resulting from replaying the file reports in
-// a loop at a sequence and speed determined by the timestamps.
-// Otherwise the collector always returns the merger of all reports.
-func NewFileCollector(path string, window time.Duration) (Collector, error) {
+// a loop at a sequence and speed determined by the timestamps, sped up
+// by speed.  Otherwise the collector always returns the merger of all
+// reports.
+func NewFileCollector(path string, window time.Duration, speed float64) (Collector, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("replay speed must be positive, not %v", speed)
+	}
 	var (
 		timestamps []time.Time
 		reports    []report.Report
@@ -274,7 +381,7 @@ func NewFileCollector(path string, window time.Duration) (Collector, error) {
 	}
 	if len(reports) > 1 && allTimestamped {
 		collector := NewCollector(window)
-		go replay(collector, timestamps, reports)
+		go replay(collector, timestamps, reports, speed)
 		return collector, nil
 	}
 	return StaticCollector(NewSmartMerger().Merge(reports).Upgrade()), nil
@@ -296,7 +403,7 @@ func timestampFromFilepath(path string) (time.Time, error) {
 	return time.Unix(0, nanosecondsSinceEpoch), nil
 }
 
-func replay(a Adder, timestamps []time.Time, reports []report.Report) {
+func replay(a Adder, timestamps []time.Time, reports []report.Report, speed float64) {
 	// calculate delays between report n and n+1
 	l := len(timestamps)
 	delays := make([]time.Duration, l, l)
@@ -309,6 +416,9 @@ func replay(a Adder, timestamps []time.Time, reports []report.Report) {
 	// We don't know how long to wait before looping round, so make a
 	// good guess.
 	delays[l-1] = timestamps[l-1].Sub(timestamps[0]) / time.Duration(l)
+	for i := range delays {
+		delays[i] = time.Duration(float64(delays[i]) / speed)
+	}
 
 	due := time.Now()
 	for {
@@ -1,6 +1,9 @@
 package app_test
 
 import (
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -112,6 +115,77 @@ func TestCollectorExpire(t *testing.T) {
 	}
 }
 
+func TestCollectorQuantisation(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	ctx := context.Background()
+	c := app.NewCollector(10 * time.Second)
+	add := func(id string, at time.Duration) {
+		mtime.NowForce(now.Add(at))
+		r := report.MakeReport()
+		r.Host.AddNode(report.MakeNode(id))
+		r.Process.AddNode(report.MakeNode(id))
+		c.Add(ctx, r, nil)
+	}
+	nodes := func(at time.Duration) []string {
+		mtime.NowForce(now.Add(at))
+		have, err := c.Report(ctx, mtime.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for id := range have.Host.Nodes {
+			if _, ok := have.Process.Nodes[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// Reports of the same quantum expire together
+	add("a", 0)
+	add("b", time.Second)
+	add("c", 5*time.Second)
+	if want, have := []string{"a", "b", "c"}, nodes(5*time.Second); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := []string{"c"}, nodes(10*time.Second); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestCollectorConcurrency(t *testing.T) {
+	ctx := context.Background()
+	c := app.NewCollector(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := report.MakeReport()
+			r.Host.AddNode(report.MakeNode(fmt.Sprint(i)))
+			r.Container.AddNode(report.MakeNode(fmt.Sprint(i)))
+			c.Add(ctx, r, nil)
+			if _, err := c.Report(ctx, time.Now()); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	have, err := c.Report(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Host.Nodes) != 20 || len(have.Container.Nodes) != 20 {
+		t.Errorf("Expected all the nodes, got %d hosts and %d containers", len(have.Host.Nodes), len(have.Container.Nodes))
+	}
+}
+
 func TestCollectorWait(t *testing.T) {
 	ctx := context.Background()
 	window := time.Millisecond
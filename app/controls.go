@@ -3,6 +3,7 @@ package app
 import (
 	"net/http"
 	"net/rpc"
+	"strconv"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -26,7 +27,8 @@ func RegisterControlRoutes(router *mux.Router, cr ControlRouter) {
 }
 
 // handleControl routes control requests from the client to the appropriate
-// probe.  Its is blocking.
+// probe.  Its is blocking. Controls are dry run (see xfer.DryRunControl)
+// with ?dry_run=true.
 func handleControl(cr ControlRouter) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		var (
@@ -37,6 +39,10 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 			controlArgs map[string]string
 		)
 
+		if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+			control = xfer.DryRunControl(control)
+		}
+
 		if r.ContentLength > 0 {
 			err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&controlArgs)
 			defer r.Body.Close()
@@ -51,7 +57,10 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 			Control:     control,
 			ControlArgs: controlArgs,
 		})
-		if err != nil {
+		if err == errProbeNotHere {
+			respondWith(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
 			respondWith(w, http.StatusBadRequest, err.Error())
 			return
 		}
@@ -36,6 +36,11 @@ func TestControl(t *testing.T) {
 			t.Fatalf("'%s' != 'nodeid'", req.NodeID)
 		}
 
+		if req.Control == xfer.DryRunControl("control") {
+			return xfer.Response{
+				DryRun: &xfer.DryRunResult{Effects: []string{"control will be done"}},
+			}
+		}
 		if req.Control != "control" {
 			t.Fatalf("'%s' != 'control'", req.Control)
 		}
@@ -76,4 +81,22 @@ func TestControl(t *testing.T) {
 	if response.Value != "foo" {
 		t.Fatalf("'%s' != 'foo'", response.Value)
 	}
+
+	// Controls are dry run with ?dry_run=true
+	resp, err = httpClient.Post(
+		server.URL+"/api/control/foo/nodeid/control?dry_run=true",
+		"application/json",
+		strings.NewReader("{}"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	response = xfer.Response{}
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.DryRun == nil || len(response.DryRun.Effects) != 1 {
+		t.Fatalf("Expected the effects of the control, got %+v", response)
+	}
 }
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/awsec2"
+	"github.com/weaveworks/scope/probe/cloud"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// CostHourly is the metric of the estimated hourly cost of hosts, containers
+// and pods, in cents, as the values of metrics are only shown to the cent.
+const CostHourly = "cost_hourly"
+
+var costMetricTemplates = report.MetricTemplates{
+	CostHourly: {ID: CostHourly, Label: "Cost (¢/h)", Format: report.DefaultFormat, Priority: 20},
+}
+
+// podNamespaceRenderer sums the costs of the pods of namespaces.
+var podNamespaceRenderer = render.MakeMap(
+	render.PropagateSummedMetrics(report.Pod, CostHourly),
+	render.PodNamespaceRenderer,
+)
+
+// InstancePrices are the on-demand hourly prices of cloud machine types, in
+// dollars, like m5.large or n1-standard-2.
+type InstancePrices map[string]float64
+
+// DefaultInstancePrices are the prices of common machine types, in US
+// regions. They are only estimates: prices vary by region and change, so
+// give your own in a file for better ones.
+var DefaultInstancePrices = InstancePrices{
+	// EC2
+	"t3.micro":   0.0104,
+	"t3.small":   0.0208,
+	"t3.medium":  0.0416,
+	"t3.large":   0.0832,
+	"m5.large":   0.096,
+	"m5.xlarge":  0.192,
+	"m5.2xlarge": 0.384,
+	"m5.4xlarge": 0.768,
+	"c5.large":   0.085,
+	"c5.xlarge":  0.17,
+	"c5.2xlarge": 0.34,
+	"r5.large":   0.126,
+	"r5.xlarge":  0.252,
+	// GCP
+	"e2-medium":     0.0335,
+	"e2-standard-2": 0.067,
+	"e2-standard-4": 0.134,
+	"n1-standard-1": 0.0475,
+	"n1-standard-2": 0.095,
+	"n1-standard-4": 0.19,
+	"n2-standard-2": 0.0971,
+	"n2-standard-4": 0.1942,
+	"n2-standard-8": 0.3885,
+	// Azure
+	"Standard_B2s":    0.0416,
+	"Standard_D2s_v3": 0.096,
+	"Standard_D4s_v3": 0.192,
+	"Standard_D8s_v3": 0.384,
+	"Standard_E2s_v3": 0.126,
+	"Standard_F2s_v2": 0.085,
+}
+
+// LoadInstancePrices reads prices from a YAML file mapping machine types to
+// their hourly prices, overriding and adding to the default ones.
+func LoadInstancePrices(filename string) (InstancePrices, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var prices InstancePrices
+	if err := yaml.Unmarshal(buf, &prices); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	result := InstancePrices{}
+	for machineType, price := range DefaultInstancePrices {
+		result[machineType] = price
+	}
+	for machineType, price := range prices {
+		result[machineType] = price
+	}
+	return result, nil
+}
+
+// hostPrice gives the price of a host, by the machine type reported by the
+// EC2 or cloud reporters of its probe.
+func (p InstancePrices) hostPrice(n report.Node) (float64, bool) {
+	for _, key := range []string{awsec2.InstanceType, cloud.MachineType} {
+		if machineType, ok := n.Latest.Lookup(key); ok {
+			price, ok := p[machineType]
+			return price, ok
+		}
+	}
+	return 0, false
+}
+
+func lastValue(n report.Node, metricID string) (report.Sample, float64, bool) {
+	metric, ok := n.Metrics.Lookup(metricID)
+	if !ok {
+		return report.Sample{}, 0, false
+	}
+	s, ok := metric.LastSample()
+	return s, metric.Max, ok
+}
+
+// containerShare is the share of its host a container uses: the mean of the
+// shares of its CPU and memory, or the share of CPU alone when the memory
+// of the host is unknown.
+func containerShare(container, hostNode report.Node) (float64, bool) {
+	cpu, _, ok := lastValue(container, docker.CPUTotalUsage)
+	if !ok {
+		return 0, false
+	}
+	share := cpu.Value / 100
+	if memory, _, ok := lastValue(container, docker.MemoryUsage); ok {
+		if _, total, ok := lastValue(hostNode, host.MemoryUsage); ok && total > 0 {
+			share = (share + memory.Value/total) / 2
+		}
+	}
+	return share, true
+}
+
+// AddCosts adds the estimated hourly costs of hosts, by their machine type,
+// of containers, by the share of their host they use, and of pods, by their
+// containers, to a copy of a report.
+func AddCosts(rpt report.Report, prices InstancePrices) report.Report {
+	now := mtime.Now()
+	result := rpt
+	result.Host = rpt.Host.WithMetricTemplates(costMetricTemplates)
+	result.Container = rpt.Container.WithMetricTemplates(costMetricTemplates)
+	result.Pod = rpt.Pod.WithMetricTemplates(costMetricTemplates)
+
+	hostPrices := map[string]float64{}
+	for id, n := range result.Host.Nodes {
+		if price, ok := prices.hostPrice(n); ok {
+			hostPrices[id] = price * 100
+			result.Host.Nodes[id] = n.WithMetric(CostHourly, report.MakeSingletonMetric(now, price*100))
+		}
+	}
+
+	podCosts := map[string]float64{}
+	for id, n := range result.Container.Nodes {
+		hostIDs, _ := n.Parents.Lookup(report.Host)
+		if len(hostIDs) != 1 {
+			continue
+		}
+		price, ok := hostPrices[hostIDs[0]]
+		if !ok {
+			continue
+		}
+		share, ok := containerShare(n, result.Host.Nodes[hostIDs[0]])
+		if !ok {
+			continue
+		}
+		cost := price * share
+		result.Container.Nodes[id] = n.WithMetric(CostHourly, report.MakeSingletonMetric(now, cost))
+		podIDs, _ := n.Parents.Lookup(report.Pod)
+		for _, podID := range podIDs {
+			podCosts[podID] += cost
+		}
+	}
+	for id, cost := range podCosts {
+		if n, ok := result.Pod.Nodes[id]; ok {
+			result.Pod.Nodes[id] = n.WithMetric(CostHourly, report.MakeSingletonMetric(now, cost))
+		}
+	}
+	return result
+}
+
+// costCollector is a collector adding costs to its reports.
+type costCollector struct {
+	Collector
+	prices InstancePrices
+}
+
+// NewCostCollector makes a collector adding the estimated costs of nodes,
+// by the prices of their instances, to the reports of another.
+func NewCostCollector(collector Collector, prices InstancePrices) Collector {
+	return costCollector{Collector: collector, prices: prices}
+}
+
+func (c costCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := c.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	return AddCosts(rpt, c.prices), nil
+}
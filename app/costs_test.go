@@ -0,0 +1,108 @@
+package app_test
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/awsec2"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+func costReport(now time.Time) report.Report {
+	hostID := report.MakeHostNodeID("host1")
+	podID := report.MakePodNodeID("pod-uid")
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(hostID, map[string]string{awsec2.InstanceType: "m5.large"}).
+		WithMetric(host.MemoryUsage, report.MakeSingletonMetric(now, 4e9).WithMax(8e9)))
+	// Half of the CPU, and a quarter of the memory, of the host
+	rpt.Container.AddNode(report.MakeNodeWith(report.MakeContainerNodeID("c1"), map[string]string{docker.ContainerID: "c1"}).
+		WithParents(report.MakeSets().
+			Add(report.Host, report.MakeStringSet(hostID)).
+			Add(report.Pod, report.MakeStringSet(podID))).
+		WithMetric(docker.CPUTotalUsage, report.MakeSingletonMetric(now, 50).WithMax(100)).
+		WithMetric(docker.MemoryUsage, report.MakeSingletonMetric(now, 2e9)))
+	rpt.Pod.AddNode(report.MakeNodeWith(podID, map[string]string{
+		kubernetes.Name:      "pod",
+		kubernetes.Namespace: "shop",
+	}))
+	return rpt
+}
+
+func lastCost(t *testing.T, n report.Node) float64 {
+	metric, ok := n.Metrics.Lookup(app.CostHourly)
+	if !ok {
+		t.Fatalf("Expected %s to have a cost, got %v", n.ID, n.Metrics)
+	}
+	s, _ := metric.LastSample()
+	return s.Value
+}
+
+func TestAddCosts(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	rpt := costReport(now)
+	have := app.AddCosts(rpt, app.DefaultInstancePrices)
+	containerCost := 9.6 * (0.5 + 0.25) / 2
+	for _, c := range []struct {
+		node report.Node
+		want float64
+	}{
+		{have.Host.Nodes[report.MakeHostNodeID("host1")], 9.6},
+		{have.Container.Nodes[report.MakeContainerNodeID("c1")], containerCost},
+		{have.Pod.Nodes[report.MakePodNodeID("pod-uid")], containerCost},
+	} {
+		if cost := lastCost(t, c.node); math.Abs(cost-c.want) > 1e-9 {
+			t.Errorf("Expected %s to cost %f, got %f", c.node.ID, c.want, cost)
+		}
+	}
+	if _, ok := rpt.Host.Nodes[report.MakeHostNodeID("host1")].Metrics.Lookup(app.CostHourly); ok {
+		t.Error("Expected the original report to be left alone")
+	}
+
+	// Hosts of unknown machine types cost nothing we know of
+	none := app.AddCosts(rpt, app.InstancePrices{})
+	if _, ok := none.Container.Nodes[report.MakeContainerNodeID("c1")].Metrics.Lookup(app.CostHourly); ok {
+		t.Error("Expected no costs without prices")
+	}
+}
+
+func TestNamespaceCosts(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.NewCostCollector(app.StaticCollector(costReport(now)), app.DefaultInstancePrices), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/namespaces"), &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	namespace, ok := topology.Nodes["shop"]
+	if !ok {
+		t.Fatalf("Expected the shop namespace, got %v", topology.Nodes)
+	}
+	for _, row := range namespace.Metrics {
+		if row.ID == app.CostHourly {
+			if math.Abs(row.Value-3.6) > 0.02 {
+				t.Errorf("Expected the namespace to cost 3.6 cents, got %f", row.Value)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected the namespace to have a cost, got %v", namespace.Metrics)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+)
+
+// customTopologySources are the topologies whose nodes custom topologies
+// can group, with the prefix of the latest keys of their labels.
+var customTopologySources = map[string]struct {
+	renderer    render.Renderer
+	labelPrefix string
+}{
+	containersID: {render.ContainerWithImageNameRenderer, docker.LabelPrefix},
+	podsID:       {render.PodRenderer, kubernetes.LabelPrefix},
+	processesID:  {render.ProcessWithContainerNameRenderer, ""},
+	hostsID:      {render.HostRenderer, ""},
+}
+
+// CustomTopology is the definition of a topology grouping the nodes of
+// another one, e.g. containers by a team label.
+type CustomTopology struct {
+	ID     string `yaml:"id"`
+	Name   string `yaml:"name"`
+	Rank   int    `yaml:"rank"`
+	Parent string `yaml:"parent"`
+	// Source is the topology whose nodes are grouped: containers, pods,
+	// processes or hosts.
+	Source string `yaml:"source"`
+	// GroupBy are the labels nodes are grouped by, the first one a node has
+	// joining it to its group. Processes and hosts have no labels, and are
+	// grouped by the keys of their latest values instead.
+	GroupBy []string `yaml:"groupBy"`
+	// Ungrouped is the label of the group of the nodes without any of the
+	// labels, which are left out when empty.
+	Ungrouped   string `yaml:"ungrouped"`
+	HideIfEmpty bool   `yaml:"hideIfEmpty"`
+}
+
+// LoadCustomTopologies reads custom topology definitions from a YAML file,
+// with a list of them under a topologies key.
+func LoadCustomTopologies(filename string) ([]CustomTopology, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Topologies []CustomTopology `yaml:"topologies"`
+	}
+	if err := yaml.Unmarshal(buf, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return config.Topologies, nil
+}
+
+// AddCustomTopologies adds custom topologies to the default Registry
+// (topologyRegistry).
+func AddCustomTopologies(ts ...CustomTopology) error {
+	return topologyRegistry.AddCustom(ts...)
+}
+
+// AddCustom adds custom topologies to this Registry, with renderers made
+// from their definitions.
+func (r *Registry) AddCustom(ts ...CustomTopology) error {
+	for _, t := range ts {
+		desc, err := r.customTopologyDesc(t)
+		if err != nil {
+			return err
+		}
+		r.Add(desc)
+	}
+	return nil
+}
+
+func (r *Registry) customTopologyDesc(t CustomTopology) (APITopologyDesc, error) {
+	if t.ID == "" {
+		return APITopologyDesc{}, fmt.Errorf("custom topology without an id")
+	}
+	if _, ok := r.get(t.ID); ok {
+		return APITopologyDesc{}, fmt.Errorf("custom topology %s: topology already exists", t.ID)
+	}
+	if t.Parent != "" {
+		if parent, ok := r.get(t.Parent); !ok || parent.parent != "" {
+			return APITopologyDesc{}, fmt.Errorf("custom topology %s: parent %s is not a top-level topology", t.ID, t.Parent)
+		}
+	}
+	source, ok := customTopologySources[t.Source]
+	if !ok {
+		return APITopologyDesc{}, fmt.Errorf("custom topology %s: unknown source %q", t.ID, t.Source)
+	}
+	if len(t.GroupBy) == 0 {
+		return APITopologyDesc{}, fmt.Errorf("custom topology %s: nothing to group by", t.ID)
+	}
+	keys := make([]string, 0, len(t.GroupBy))
+	for _, label := range t.GroupBy {
+		keys = append(keys, source.labelPrefix+label)
+	}
+	name := t.Name
+	if name == "" {
+		name = t.ID
+	}
+	return APITopologyDesc{
+		id:          t.ID,
+		parent:      t.Parent,
+		renderer:    render.FilterUnconnectedPseudo(render.MakeGroupRenderer(keys, t.Ungrouped, source.renderer)),
+		Name:        name,
+		Rank:        t.Rank,
+		Options:     []APITopologyOptionGroup{unmanagedFilter},
+		HideIfEmpty: t.HideIfEmpty,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+const customTopologies = `
+topologies:
+- id: teams
+  name: Teams
+  parent: containers
+  source: containers
+  groupBy: [team, foo1]
+  ungrouped: no team
+`
+
+func TestCustomTopologies(t *testing.T) {
+	f, err := ioutil.TempFile("", "scope-topologies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(customTopologies); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	topologies, err := app.LoadCustomTopologies(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := app.MakeRegistry()
+	if err := registry.AddCustom(topologies...); err != nil {
+		t.Fatal(err)
+	}
+
+	renderer, _, err := registry.RendererForTopology("teams", nil, fixture.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := renderer.Render(fixture.Report, nil)
+	team, ok := nodes["bar1"]
+	if !ok {
+		t.Fatalf("Expected a group of the containers labelled foo1=bar1, got %v", nodes)
+	}
+	if team.Topology != render.MakeGroupNodeTopology(report.Container, docker.LabelPrefix+"foo1") {
+		t.Errorf("Unexpected topology of the group: %s", team.Topology)
+	}
+	if _, ok := nodes["no team"]; !ok {
+		t.Errorf("Expected a group of the unlabelled containers, got %v", nodes)
+	}
+
+	for _, bad := range []app.CustomTopology{
+		{ID: "teams", Source: "containers", GroupBy: []string{"team"}},
+		{ID: "other", Source: "weave", GroupBy: []string{"team"}},
+		{ID: "other", Source: "containers"},
+		{ID: "other", Parent: "containers-by-image", Source: "containers", GroupBy: []string{"team"}},
+	} {
+		if err := registry.AddCustom(bad); err == nil {
+			t.Errorf("Expected an error adding %v", bad)
+		}
+	}
+}
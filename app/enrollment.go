@@ -0,0 +1,349 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// EnrollmentToken lets probes enroll for the cluster it is scoped to, until
+// it expires or is revoked. The token itself is only given when minted.
+type EnrollmentToken struct {
+	ID      string    `json:"id"`
+	Token   string    `json:"token,omitempty"`
+	Cluster string    `json:"cluster"`
+	Expires time.Time `json:"expires,omitempty"`
+	Revoked bool      `json:"revoked"`
+}
+
+func (t EnrollmentToken) valid() bool {
+	return !t.Revoked && (t.Expires.IsZero() || mtime.Now().Before(t.Expires))
+}
+
+// ProbeCredential is the long-lived credential of the probe of an enrolled
+// host. Probes get a new ID every time they start, so it is for the host,
+// which is only unique within its cluster.
+type ProbeCredential struct {
+	Hostname string    `json:"hostname"`
+	Cluster  string    `json:"cluster"`
+	TokenID  string    `json:"token_id"` // of the enrollment token
+	Enrolled time.Time `json:"enrolled"`
+}
+
+// Enrollments mints enrollment tokens, and keeps the credentials probes
+// exchange them for. Only hashes of tokens and credentials are kept, in
+// file if given, so they survive restarts of the app.
+type Enrollments struct {
+	file string
+
+	mtx         sync.RWMutex
+	tokens      map[string]EnrollmentToken // by hash
+	credentials map[string]ProbeCredential // by hash
+}
+
+// enrollmentsFile is what is kept in the file of Enrollments.
+type enrollmentsFile struct {
+	Tokens      map[string]EnrollmentToken `json:"tokens"`
+	Credentials map[string]ProbeCredential `json:"credentials"`
+}
+
+// NewEnrollments makes a new Enrollments, loading the enrollments in file.
+func NewEnrollments(file string) (*Enrollments, error) {
+	e := &Enrollments{
+		file:        file,
+		tokens:      map[string]EnrollmentToken{},
+		credentials: map[string]ProbeCredential{},
+	}
+	if file == "" {
+		return e, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return e, nil
+	} else if err != nil {
+		return nil, err
+	}
+	saved := enrollmentsFile{Tokens: e.tokens, Credentials: e.credentials}
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("Error reading enrollments from %s: %v", file, err)
+	}
+	if saved.Tokens != nil {
+		e.tokens = saved.Tokens
+	}
+	if saved.Credentials != nil {
+		e.credentials = saved.Credentials
+	}
+	return e, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// save the enrollments to the file, with the lock held.
+func (e *Enrollments) save() error {
+	if e.file == "" {
+		return nil
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(enrollmentsFile{Tokens: e.tokens, Credentials: e.credentials}); err != nil {
+		return err
+	}
+	tmp := e.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.file)
+}
+
+// Mint a new enrollment token for cluster, expiring after ttl, or never if
+// ttl is 0.
+func (e *Enrollments) Mint(cluster string, ttl time.Duration) (EnrollmentToken, error) {
+	if cluster == "" {
+		return EnrollmentToken{}, fmt.Errorf("enrollment token without a cluster")
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return EnrollmentToken{}, err
+	}
+	token := EnrollmentToken{
+		ID:      hashSecret(secret)[:12],
+		Cluster: cluster,
+	}
+	if ttl > 0 {
+		token.Expires = mtime.Now().Add(ttl)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.tokens[hashSecret(secret)] = token
+	if err := e.save(); err != nil {
+		return EnrollmentToken{}, err
+	}
+	token.Token = secret
+	return token, nil
+}
+
+// ListTokens gives the enrollment tokens, sorted by cluster and ID.
+func (e *Enrollments) ListTokens() []EnrollmentToken {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	result := make([]EnrollmentToken, 0, len(e.tokens))
+	for _, token := range e.tokens {
+		result = append(result, token)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cluster != result[j].Cluster {
+			return result[i].Cluster < result[j].Cluster
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Revoke the enrollment token of id, and say whether there was one. Probes
+// already enrolled with it keep their credentials.
+func (e *Enrollments) Revoke(id string) (bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for hash, token := range e.tokens {
+		if token.ID == id {
+			token.Revoked = true
+			e.tokens[hash] = token
+			return true, e.save()
+		}
+	}
+	return false, nil
+}
+
+// Enroll exchanges a valid enrollment token for a new credential of the
+// probe of hostname, replacing any it had in the cluster of the token. It
+// returns false for unknown, expired or revoked tokens.
+func (e *Enrollments) Enroll(secret, hostname string) (string, bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	token, ok := e.tokens[hashSecret(secret)]
+	if !ok || !token.valid() {
+		return "", false, nil
+	}
+	credential, err := newSecret()
+	if err != nil {
+		return "", false, err
+	}
+	for hash, c := range e.credentials {
+		if c.Cluster == token.Cluster && c.Hostname == hostname {
+			delete(e.credentials, hash)
+		}
+	}
+	e.credentials[hashSecret(credential)] = ProbeCredential{
+		Hostname: hostname,
+		Cluster:  token.Cluster,
+		TokenID:  token.ID,
+		Enrolled: mtime.Now(),
+	}
+	return credential, true, e.save()
+}
+
+// ListCredentials gives the credentials of the enrolled probes, sorted by
+// cluster and hostname.
+func (e *Enrollments) ListCredentials() []ProbeCredential {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	result := make([]ProbeCredential, 0, len(e.credentials))
+	for _, c := range e.credentials {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cluster != result[j].Cluster {
+			return result[i].Cluster < result[j].Cluster
+		}
+		return result[i].Hostname < result[j].Hostname
+	})
+	return result
+}
+
+// RevokeCredential revokes the credential of the probe of hostname in
+// cluster, which has to enroll again, and says whether there was one.
+func (e *Enrollments) RevokeCredential(cluster, hostname string) (bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for hash, c := range e.credentials {
+		if c.Cluster == cluster && c.Hostname == hostname {
+			delete(e.credentials, hash)
+			return true, e.save()
+		}
+	}
+	return false, nil
+}
+
+// Authenticate implements Authenticator, for the credentials of enrolled
+// probes.
+func (e *Enrollments) Authenticate(token string) (User, bool, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	c, ok := e.credentials[hashSecret(token)]
+	if !ok {
+		return User{}, false, nil
+	}
+	return User{Name: c.Cluster + "/" + c.Hostname, Role: RoleProbe, Cluster: c.Cluster}, true, nil
+}
+
+// checkReportCluster checks that the hosts of a report published by user
+// are of the cluster it enrolled for, as tagged with their cluster ID, so
+// that probes can't publish the hosts of other clusters as theirs.
+func checkReportCluster(user User, rpt report.Report) error {
+	if user.Cluster == "" {
+		return nil
+	}
+	for id, n := range rpt.Host.Nodes {
+		if cluster, _ := n.Latest.Lookup(report.ClusterID); cluster != user.Cluster {
+			return fmt.Errorf("host %s is of cluster %q, but its probe enrolled for %q", id, cluster, user.Cluster)
+		}
+	}
+	return nil
+}
+
+// RegisterEnrollmentRoutes registers the routes minting, listing and
+// revoking enrollment tokens and credentials, and enrolling probes.
+func RegisterEnrollmentRoutes(router *mux.Router, enrollments *Enrollments) {
+	router.Methods("POST").Path(xfer.EnrollmentPath).
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var req xfer.EnrollmentRequest
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&req); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			if req.Hostname == "" {
+				respondWith(w, http.StatusBadRequest, fmt.Errorf("enrollment without a hostname"))
+				return
+			}
+			credential, ok, err := enrollments.Enroll(requestToken(r), req.Hostname)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			respondWith(w, http.StatusOK, xfer.EnrollmentResponse{Credential: credential})
+		}))
+	router.Methods("GET").Path("/api/enrollment/tokens").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, enrollments.ListTokens())
+		}))
+	router.Methods("POST").Path("/api/enrollment/tokens").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Cluster string `json:"cluster"`
+				TTL     string `json:"ttl,omitempty"`
+			}
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&req); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			var ttl time.Duration
+			if req.TTL != "" {
+				var err error
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					respondWith(w, http.StatusBadRequest, err)
+					return
+				}
+			}
+			token, err := enrollments.Mint(req.Cluster, ttl)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			respondWith(w, http.StatusOK, token)
+		}))
+	router.Methods("DELETE").Path("/api/enrollment/tokens/{id}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ok, err := enrollments.Revoke(mux.Vars(r)["id"])
+			respondRevoked(w, r, ok, err)
+		}))
+	router.Methods("GET").Path("/api/enrollment/credentials").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, enrollments.ListCredentials())
+		}))
+	router.Methods("DELETE").Path("/api/enrollment/credentials/{cluster}/{hostname}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			ok, err := enrollments.RevokeCredential(vars["cluster"], vars["hostname"])
+			respondRevoked(w, r, ok, err)
+		}))
+}
+
+func respondRevoked(w http.ResponseWriter, r *http.Request, ok bool, err error) {
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+	} else if !ok {
+		http.NotFound(w, r)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,286 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestEnrollment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrollment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	enrollments, err := app.NewEnrollments(filepath.Join(dir, "enrollments.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	app.RegisterEnrollmentRoutes(router, enrollments)
+	authenticator := app.Authenticators{app.StaticTokens{"admin": {Role: app.RoleAdmin}}, enrollments}
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: authenticator}.Wrap(router))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+
+	do := func(method, path, token, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	mint := func(body string) app.EnrollmentToken {
+		resp := do("POST", "/api/enrollment/tokens", "admin", body)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected to mint an enrollment token, got %s", resp.Status)
+		}
+		var token app.EnrollmentToken
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// Only admins mint tokens
+	if resp := do("POST", "/api/enrollment/tokens", "", `{"cluster": "prod"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous minting to be unauthorized, got %s", resp.Status)
+	}
+	token := mint(`{"cluster": "prod"}`)
+	if token.Token == "" || token.Cluster != "prod" {
+		t.Fatalf("Unexpected enrollment token %v", token)
+	}
+
+	// The probe exchanges the enrollment token for a credential, once
+	credentialsFile := filepath.Join(dir, "credentials.json")
+	credentials, err := appclient.NewCredentials(credentialsFile, "host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := credentials.Get(appclient.ProbeConfig{Token: token.Token, ProbeID: "probe1"}, target.Host, *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, ok, _ := enrollments.Authenticate(credential); !ok || user != (app.User{Name: "prod/host1", Role: app.RoleProbe, Cluster: "prod"}) {
+		t.Errorf("Expected the credential to authenticate the probe, got %v, %v", user, ok)
+	}
+
+	// Revoking the enrollment token keeps the probes enrolled with it
+	if resp := do("DELETE", "/api/enrollment/tokens/"+token.ID, "admin", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected to revoke the enrollment token, got %s", resp.Status)
+	}
+	if _, ok, _ := enrollments.Enroll(token.Token, "host2"); ok {
+		t.Error("Expected a revoked enrollment token not to enroll")
+	}
+	credentials, err = appclient.NewCredentials(credentialsFile, "host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, err := credentials.Get(appclient.ProbeConfig{Token: token.Token}, target.Host, *target); err != nil || have != credential {
+		t.Errorf("Expected the saved credential, got %q, %v", have, err)
+	}
+	enrollments, err = app.NewEnrollments(filepath.Join(dir, "enrollments.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := enrollments.Authenticate(credential); !ok {
+		t.Error("Expected the credential to survive a restart of the app")
+	}
+	if tokens := enrollments.ListTokens(); len(tokens) != 1 || !tokens[0].Revoked || tokens[0].Token != "" {
+		t.Errorf("Expected the revoked enrollment token without its secret, got %v", tokens)
+	}
+
+	// Tokens expire
+	expiring, err := enrollments.Mint("staging", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime.NowForce(time.Now().Add(2 * time.Hour))
+	defer mtime.NowReset()
+	if _, ok, _ := enrollments.Enroll(expiring.Token, "host3"); ok {
+		t.Error("Expected an expired enrollment token not to enroll")
+	}
+
+	// Revoked credentials don't authenticate, and are of a host of a cluster
+	if ok, _ := enrollments.RevokeCredential("staging", "host1"); ok {
+		t.Error("Expected no credential of host1 in another cluster")
+	}
+	if ok, err := enrollments.RevokeCredential("prod", "host1"); !ok || err != nil {
+		t.Errorf("Expected to revoke the credential, got %v, %v", ok, err)
+	}
+	if _, ok, _ := enrollments.Authenticate(credential); ok {
+		t.Error("Expected a revoked credential not to authenticate")
+	}
+}
+
+func TestEnrollmentClusters(t *testing.T) {
+	enrollments, err := app.NewEnrollments("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	app.RegisterEnrollmentRoutes(router, enrollments)
+	app.RegisterReportPostHandler(app.NewCollector(time.Minute), router, nil, nil)
+	authenticator := app.Authenticators{app.StaticTokens{"admin": {Role: app.RoleAdmin}}, enrollments}
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: authenticator}.Wrap(router))
+	defer ts.Close()
+
+	// Hosts of the same name in different clusters have credentials of
+	// their own
+	enroll := func(cluster string) string {
+		token, err := enrollments.Mint(cluster, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		credential, ok, err := enrollments.Enroll(token.Token, "host1")
+		if err != nil || !ok {
+			t.Fatalf("Expected to enroll, got %v, %v", ok, err)
+		}
+		return credential
+	}
+	prod, staging := enroll("prod"), enroll("staging")
+	if credentials := enrollments.ListCredentials(); len(credentials) != 2 {
+		t.Errorf("Expected a credential of host1 in each cluster, got %v", credentials)
+	}
+
+	// Enrolled probes only publish the hosts of their cluster
+	post := func(credential, cluster string) int {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith("host1;<host>", map[string]string{report.ClusterID: cluster}))
+		buf := &bytes.Buffer{}
+		if err := rpt.WriteBinary(buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Scope-Probe token="+credential)
+		req.Header.Set("Content-Type", "application/msgpack")
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, test := range []struct {
+		credential, cluster string
+		want                int
+	}{
+		{prod, "prod", http.StatusOK},
+		{prod, "staging", http.StatusForbidden},
+		{staging, "", http.StatusForbidden},
+	} {
+		if have := post(test.credential, test.cluster); have != test.want {
+			t.Errorf("Report of cluster %q: expected %d, got %d", test.cluster, test.want, have)
+		}
+	}
+
+	// Revoking the credential of a host leaves those of other clusters
+	req, err := http.NewRequest("DELETE", ts.URL+"/api/enrollment/credentials/prod/host1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected to revoke the credential, got %s", resp.Status)
+	}
+	if _, ok, _ := enrollments.Authenticate(prod); ok {
+		t.Error("Expected the revoked credential not to authenticate")
+	}
+	if _, ok, _ := enrollments.Authenticate(staging); !ok {
+		t.Error("Expected the credential of the other cluster to authenticate")
+	}
+}
+
+func TestEnrollmentProbeConnects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrollment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	enrollments, err := app.NewEnrollments("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := app.NewCollector(time.Minute)
+	router := mux.NewRouter()
+	app.RegisterEnrollmentRoutes(router, enrollments)
+	app.RegisterTopologyRoutes(router, collector, nil)
+	app.RegisterReportPostHandler(collector, router, nil, nil)
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: enrollments}.Wrap(router))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+
+	// The probe enrolls, then shakes hands with the app and publishes to it
+	// with its credential, as probes do
+	token, err := enrollments.Mint("prod", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := appclient.NewCredentials(filepath.Join(dir, "credentials.json"), "host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := credentials.Get(appclient.ProbeConfig{Token: token.Token, ProbeID: "probe1"}, target.Host, *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := appclient.NewAppClient(appclient.ProbeConfig{Token: credential, ProbeID: "probe1"}, target.Host, *target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if _, err := client.Details(); err != nil {
+		t.Fatalf("Expected the enrolled probe to shake hands with the app, got %v", err)
+	}
+
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith("host1;<host>", map[string]string{report.ClusterID: "prod"}))
+	buf := &bytes.Buffer{}
+	if err := rpt.WriteBinary(buf, gzip.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish(buf, false); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, time.Second, true, func() interface{} {
+		have, err := collector.Report(context.Background(), mtime.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok := have.Host.Nodes["host1;<host>"]
+		return ok
+	})
+}
@@ -0,0 +1,416 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// ClusterName is the Latest key of the nodes of reports fetched from
+// downstream apps, with the name of the cluster they came from.
+const ClusterName = "cluster"
+
+// federationTimeout is the timeout of requests to downstream apps.
+const federationTimeout = 10 * time.Second
+
+// DownstreamApp is a Scope app federated by another one.
+type DownstreamApp struct {
+	Cluster string
+	URL     *url.URL
+}
+
+// ParseDownstreamApp parses a downstream app, specified as cluster=url.
+func ParseDownstreamApp(s string) (DownstreamApp, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return DownstreamApp{}, fmt.Errorf("Downstream app %q is not in the cluster=url format", s)
+	}
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return DownstreamApp{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return DownstreamApp{}, fmt.Errorf("Downstream app %q does not have an http(s) url", s)
+	}
+	return DownstreamApp{Cluster: parts[0], URL: u}, nil
+}
+
+func (d DownstreamApp) url(path string) string {
+	return strings.TrimSuffix(d.URL.String(), "/") + path
+}
+
+func (d DownstreamApp) wsURL(path string) string {
+	output := *d.URL
+	if output.Scheme == "https" {
+		output.Scheme = "wss"
+	} else {
+		output.Scheme = "ws"
+	}
+	return strings.TrimSuffix(output.String(), "/") + path
+}
+
+type downstreamReport struct {
+	report.Report
+	timestamp time.Time
+}
+
+// Federation is a Collector which merges the reports of several downstream
+// apps, typically one per cluster, into the reports of the collector it
+// wraps. The nodes of the reports of each downstream app are labelled with
+// the name of its cluster. Use the ControlRouter and PipeRouter of a
+// Federation to send controls and pipes to the downstream app of the probe
+// they are for.
+type Federation struct {
+	Collector
+	apps     []DownstreamApp
+	interval time.Duration
+	client   *http.Client
+	quit     chan struct{}
+	wait     sync.WaitGroup
+
+	mtx     sync.Mutex
+	reports map[string]downstreamReport // by cluster
+	probes  map[string]DownstreamApp    // by probe ID
+	pipes   map[string]DownstreamApp    // by pipe ID
+}
+
+// NewFederation makes a new Federation, fetching the reports of the
+// downstream apps every interval.
+func NewFederation(collector Collector, apps []DownstreamApp, interval time.Duration) *Federation {
+	f := &Federation{
+		Collector: collector,
+		apps:      apps,
+		interval:  interval,
+		client:    &http.Client{Timeout: federationTimeout},
+		quit:      make(chan struct{}),
+		reports:   map[string]downstreamReport{},
+		probes:    map[string]DownstreamApp{},
+		pipes:     map[string]DownstreamApp{},
+	}
+	for _, app := range apps {
+		f.wait.Add(1)
+		go f.loop(app)
+	}
+	return f
+}
+
+// Stop stops fetching reports from the downstream apps.
+func (f *Federation) Stop() {
+	close(f.quit)
+	f.wait.Wait()
+}
+
+func (f *Federation) loop(app DownstreamApp) {
+	defer f.wait.Done()
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		if err := f.fetch(app); err != nil {
+			log.Warnf("Error fetching report of cluster %s: %v", app.Cluster, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+func (f *Federation) fetch(app DownstreamApp) error {
+	resp, err := f.client.Get(app.url("/api/report"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", app.URL, resp.Status)
+	}
+	var rpt report.Report
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&rpt); err != nil {
+		return err
+	}
+
+	probes := map[string]struct{}{}
+	labelCluster(&rpt, app.Cluster, probes)
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.reports[app.Cluster] = downstreamReport{Report: rpt, timestamp: mtime.Now()}
+	for probeID := range probes {
+		f.probes[probeID] = app
+	}
+	return nil
+}
+
+// labelCluster labels all the nodes of rpt with their cluster, and collects
+// the IDs of the probes which reported them.
+func labelCluster(rpt *report.Report, cluster string, probes map[string]struct{}) {
+	rpt.WalkTopologies(func(t *report.Topology) {
+		if len(t.Nodes) == 0 {
+			return
+		}
+		for id, n := range t.Nodes {
+			if probeID, ok := n.Latest.Lookup(report.ControlProbeID); ok {
+				probes[probeID] = struct{}{}
+			}
+			t.Nodes[id] = n.WithLatests(map[string]string{ClusterName: cluster})
+		}
+		t.MetadataTemplates = t.MetadataTemplates.Merge(report.MetadataTemplates{
+			ClusterName: {ID: ClusterName, Label: "Cluster", From: report.FromLatest, Priority: 0.5},
+		})
+	})
+}
+
+// Report implements Reporter. Reports of downstream apps are only merged in
+// while they are fresh, as they are not kept over time.
+func (f *Federation) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := f.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	oldest := timestamp.Add(-3 * f.interval)
+	for _, app := range f.apps {
+		downstream, ok := f.reports[app.Cluster]
+		if !ok || downstream.timestamp.Before(oldest) || downstream.timestamp.After(timestamp) {
+			continue
+		}
+		rpt = rpt.Merge(downstream.Report)
+	}
+	return rpt, nil
+}
+
+func (f *Federation) probeApp(probeID string) (DownstreamApp, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	app, ok := f.probes[probeID]
+	return app, ok
+}
+
+func (f *Federation) pipeApp(pipeID string) (DownstreamApp, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	app, ok := f.pipes[pipeID]
+	return app, ok
+}
+
+func (f *Federation) setPipeApp(pipeID string, app DownstreamApp) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.pipes[pipeID] = app
+}
+
+func (f *Federation) deletePipeApp(pipeID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.pipes, pipeID)
+}
+
+// ControlRouter returns a ControlRouter which sends the controls of probes
+// of downstream apps to those apps, and all others to cr.
+func (f *Federation) ControlRouter(cr ControlRouter) ControlRouter {
+	return &federatedControlRouter{ControlRouter: cr, federation: f}
+}
+
+type federatedControlRouter struct {
+	ControlRouter
+	federation *Federation
+}
+
+func (cr *federatedControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	app, ok := cr.federation.probeApp(probeID)
+	if !ok {
+		return cr.ControlRouter.Handle(ctx, probeID, req)
+	}
+
+	res, err := postControl(cr.federation.client, app.url(""), probeID, req, nil)
+	if err != nil {
+		return xfer.Response{}, fmt.Errorf("cluster %s: %v", app.Cluster, err)
+	}
+	if res.Pipe != "" {
+		cr.federation.setPipeApp(res.Pipe, app)
+	}
+	return res, nil
+}
+
+// postControl sends a control request for a probe to the app at baseURL,
+// with the extra headers if any, and gives its response.
+func postControl(client *http.Client, baseURL, probeID string, req xfer.Request, header http.Header) (xfer.Response, error) {
+	body := &bytes.Buffer{}
+	if err := codec.NewEncoder(body, &codec.JsonHandle{}).Encode(req.ControlArgs); err != nil {
+		return xfer.Response{}, err
+	}
+	path := fmt.Sprintf("/api/control/%s/%s/%s",
+		url.QueryEscape(probeID), url.QueryEscape(req.NodeID), url.QueryEscape(req.Control))
+	httpReq, err := http.NewRequest("POST", baseURL+path, body)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		httpReq.Header[key] = values
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var res xfer.Response
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&res); err != nil {
+			return xfer.Response{}, err
+		}
+	case http.StatusBadRequest:
+		// The other app responds with the error of the control
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&res.Error); err != nil {
+			return xfer.Response{}, err
+		}
+	default:
+		return xfer.Response{}, fmt.Errorf("%s", resp.Status)
+	}
+	return res, nil
+}
+
+// PipeRouter returns a PipeRouter which connects the UI to pipes of probes
+// of downstream apps through those apps, and to all others through pr.
+func (f *Federation) PipeRouter(pr PipeRouter) PipeRouter {
+	return &federatedPipeRouter{
+		PipeRouter: pr,
+		federation: f,
+		proxies:    map[string]xfer.Pipe{},
+	}
+}
+
+// federatedPipeRouter proxies the UI end of pipes of downstream apps. The
+// federating app acts as the probe end of such pipes, as far as the
+// downstream apps are concerned.
+type federatedPipeRouter struct {
+	PipeRouter
+	federation *Federation
+
+	mtx     sync.Mutex
+	proxies map[string]xfer.Pipe
+}
+
+func (pr *federatedPipeRouter) Exists(ctx context.Context, id string) (bool, error) {
+	app, ok := pr.federation.pipeApp(id)
+	if !ok {
+		return pr.PipeRouter.Exists(ctx, id)
+	}
+	resp, err := pr.federation.client.Get(app.url(fmt.Sprintf("/api/pipe/%s/check", url.QueryEscape(id))))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("cluster %s: %s", app.Cluster, resp.Status)
+}
+
+func (pr *federatedPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	app, ok := pr.federation.pipeApp(id)
+	if !ok {
+		return pr.PipeRouter.Get(ctx, id, e)
+	}
+	if e != UIEnd {
+		return nil, nil, fmt.Errorf("pipe %s belongs to cluster %s", id, app.Cluster)
+	}
+
+	pr.mtx.Lock()
+	defer pr.mtx.Unlock()
+	if p, ok := pr.proxies[id]; ok && !p.Closed() {
+		ui, _ := p.Ends()
+		return p, ui, nil
+	}
+
+	conn, resp, err := xfer.DialWS(&websocket.Dialer{HandshakeTimeout: federationTimeout}, app.wsURL(fmt.Sprintf("/api/pipe/%s", url.QueryEscape(id))), http.Header{})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			pr.federation.deletePipeApp(id)
+		}
+		return nil, nil, err
+	}
+	p := xfer.NewPipe()
+	pr.proxies[id] = p
+	go func() {
+		defer conn.Close()
+		defer p.Close()
+		_, downstream := p.Ends()
+		if err := p.CopyToWebsocket(downstream, conn); err != nil && !xfer.IsExpectedWSCloseError(err) {
+			log.Errorf("Error copying pipe %s of cluster %s: %v", id, app.Cluster, err)
+		}
+	}()
+	ui, _ := p.Ends()
+	return p, ui, nil
+}
+
+func (pr *federatedPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if _, ok := pr.federation.pipeApp(id); !ok {
+		return pr.PipeRouter.Release(ctx, id, e)
+	}
+	pr.closeProxy(id)
+	return nil
+}
+
+func (pr *federatedPipeRouter) Delete(ctx context.Context, id string) error {
+	app, ok := pr.federation.pipeApp(id)
+	if !ok {
+		return pr.PipeRouter.Delete(ctx, id)
+	}
+	pr.closeProxy(id)
+	pr.federation.deletePipeApp(id)
+
+	req, err := http.NewRequest("DELETE", app.url(fmt.Sprintf("/api/pipe/%s", url.QueryEscape(id))), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := pr.federation.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+func (pr *federatedPipeRouter) closeProxy(id string) {
+	pr.mtx.Lock()
+	p, ok := pr.proxies[id]
+	delete(pr.proxies, id)
+	pr.mtx.Unlock()
+	if ok {
+		p.Close()
+	}
+}
+
+func (pr *federatedPipeRouter) Stop() {
+	pr.mtx.Lock()
+	for id, p := range pr.proxies {
+		p.Close()
+		delete(pr.proxies, id)
+	}
+	pr.mtx.Unlock()
+	pr.PipeRouter.Stop()
+}
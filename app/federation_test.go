@@ -0,0 +1,130 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestParseDownstreamApp(t *testing.T) {
+	for _, s := range []string{"", "east", "=http://east:4040", "east=east:4040", "east=ftp://east"} {
+		if _, err := app.ParseDownstreamApp(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+	d, err := app.ParseDownstreamApp("east=http://east:4040/scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Cluster != "east" || d.URL.String() != "http://east:4040/scope" {
+		t.Errorf("Unexpected downstream app %v", d)
+	}
+}
+
+func TestFederation(t *testing.T) {
+	ctx := context.Background()
+
+	// A downstream app, with a probe connected to it
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith("host1", map[string]string{report.ControlProbeID: "probe1"}))
+	downstreamControls := app.NewLocalControlRouter()
+	downstreamPipes := app.NewLocalPipeRouter()
+	defer downstreamPipes.Stop()
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	app.RegisterControlRoutes(router, downstreamControls)
+	app.RegisterPipeRoutes(router, downstreamPipes)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	if _, err := downstreamControls.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		switch req.Control {
+		case "exec":
+			return xfer.Response{Pipe: "pipe1"}
+		case "ping":
+			return xfer.Response{Value: req.NodeID + " " + req.ControlArgs["arg"]}
+		}
+		return xfer.ResponseErrorf("unknown control %s", req.Control)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := app.NewFederation(app.NewCollector(time.Minute), []app.DownstreamApp{{Cluster: "east", URL: u}}, 10*time.Millisecond)
+	defer f.Stop()
+
+	// Reports of the downstream app are merged in, labelled with its cluster
+	var node report.Node
+	for i := 0; ; i++ {
+		rpt, err := f.Report(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ok bool
+		if node, ok = rpt.Host.Nodes["host1"]; ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Expected the report of the downstream app")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cluster, _ := node.Latest.Lookup(app.ClusterName); cluster != "east" {
+		t.Errorf("Expected host1 in cluster east, got %q", cluster)
+	}
+
+	// Controls go to the downstream app of the probe
+	cr := f.ControlRouter(app.NewLocalControlRouter())
+	res, err := cr.Handle(ctx, "probe1", xfer.Request{NodeID: "host1", Control: "ping", ControlArgs: map[string]string{"arg": "foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != "host1 foo" {
+		t.Errorf("Unexpected response %v", res)
+	}
+	if res, err = cr.Handle(ctx, "probe1", xfer.Request{NodeID: "host1", Control: "bar"}); err != nil || res.Error != "unknown control bar" {
+		t.Errorf("Expected the error of the control, got %v, %v", res, err)
+	}
+	if _, err := cr.Handle(ctx, "probe2", xfer.Request{NodeID: "host2", Control: "ping"}); err == nil {
+		t.Error("Expected an error for a probe connected to no app")
+	}
+
+	// Pipes too
+	pr := f.PipeRouter(app.NewLocalPipeRouter())
+	defer pr.Stop()
+	if res, err = cr.Handle(ctx, "probe1", xfer.Request{NodeID: "host1", Control: "exec"}); err != nil || res.Pipe != "pipe1" {
+		t.Fatalf("Expected a pipe, got %v, %v", res, err)
+	}
+	_, probeEnd, err := downstreamPipes.Get(ctx, "pipe1", app.ProbeEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, uiEnd, err := pr.Get(ctx, "pipe1", app.UIEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go probeEnd.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := uiEnd.Read(buf); err != nil || string(buf) != "hello" {
+		t.Errorf("Expected hello through the pipe, got %q, %v", buf, err)
+	}
+	if exists, err := pr.Exists(ctx, "pipe1"); err != nil || !exists {
+		t.Errorf("Expected pipe1 to exist, got %v, %v", exists, err)
+	}
+	if err := pr.Delete(ctx, "pipe1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := downstreamPipes.Exists(ctx, "pipe1"); err != nil || exists {
+		t.Errorf("Expected pipe1 to be deleted downstream, got %v, %v", exists, err)
+	}
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// FlameGraph is returned by the /api/pipe/{pipeID}/flamegraph handler. Each
+// node is a stack frame, with the number of samples in which it was on the
+// stack.
+type FlameGraph struct {
+	Name     string        `json:"name"`
+	Value    int           `json:"value"`
+	Children []*FlameGraph `json:"children,omitempty"`
+}
+
+func (f *FlameGraph) child(name string) *FlameGraph {
+	for _, c := range f.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &FlameGraph{Name: name}
+	f.Children = append(f.Children, c)
+	return c
+}
+
+type byFrameName []*FlameGraph
+
+func (a byFrameName) Len() int           { return len(a) }
+func (a byFrameName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFrameName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+func (f *FlameGraph) sort() {
+	sort.Sort(byFrameName(f.Children))
+	for _, c := range f.Children {
+		c.sort()
+	}
+}
+
+// parseFoldedStacks builds a flame graph out of folded stacks, as sent by the
+// CPU profiling control of processes. Malformed lines are skipped.
+func parseFoldedStacks(r io.Reader) *FlameGraph {
+	root := &FlameGraph{Name: "all"}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.LastIndexByte(line, ' ')
+		if i <= 0 {
+			continue
+		}
+		count, err := strconv.Atoi(line[i+1:])
+		if err != nil {
+			log.Debugf("Ignoring malformed folded stack %q", line)
+			continue
+		}
+		root.Value += count
+		node := root
+		for _, frame := range strings.Split(line[:i], ";") {
+			node = node.child(frame)
+			node.Value += count
+		}
+	}
+	root.sort()
+	return root
+}
+
+// handlePipeFlameGraph reads folded stacks from a pipe until it is closed, and
+// responds with them as a flame graph.
+func handlePipeFlameGraph(pr PipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["pipeID"]
+		_, endIO, err := pr.Get(ctx, id, UIEnd)
+		if err != nil {
+			log.Debugf("Error getting pipe %s: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+		defer pr.Release(ctx, id, UIEnd)
+
+		respondWith(w, http.StatusOK, parseFoldedStacks(endIO))
+	}
+}
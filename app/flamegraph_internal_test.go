@@ -0,0 +1,30 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestParseFoldedStacks(t *testing.T) {
+	have := parseFoldedStacks(strings.NewReader(
+		"java;main;doWork 2\n" +
+			"java;main;gc 1\n" +
+			"not a stack\n" +
+			"java;[unknown] 1\n",
+	))
+	want := &FlameGraph{Name: "all", Value: 4, Children: []*FlameGraph{
+		{Name: "java", Value: 4, Children: []*FlameGraph{
+			{Name: "[unknown]", Value: 1},
+			{Name: "main", Value: 3, Children: []*FlameGraph{
+				{Name: "doWork", Value: 2},
+				{Name: "gc", Value: 1},
+			}},
+		}},
+	}}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
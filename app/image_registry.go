@@ -0,0 +1,475 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys of what registries say of the tags of images, on the nodes of images
+// and of their containers.
+const (
+	RegistryTagPushed  = "registry_tag_pushed"  // when the image the tag is of was
+	RegistryNewerImage = "registry_newer_image" // "true" if the tag moved on to another image
+	RegistryDaysBehind = "registry_days_behind" // how much older the image is than that of the tag
+)
+
+const (
+	registryLookupTimeout = time.Minute
+	registryRetry         = 5 * time.Minute // after failed lookups
+	registryQueueLength   = 1000
+	registryWorkers       = 2
+	dockerHubRegistry     = "registry-1.docker.io"
+)
+
+// Media types of the manifests registries are asked for.
+const (
+	manifestV2        = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestListV2    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociManifest       = "application/vnd.oci.image.manifest.v1+json"
+	ociIndex          = "application/vnd.oci.image.index.v1+json"
+	manifestDigestKey = "Docker-Content-Digest"
+)
+
+var registryMetadataTemplates = report.MetadataTemplates{
+	RegistryTagPushed:  {ID: RegistryTagPushed, Label: "Tag Pushed", From: report.FromLatest, Datatype: "datetime", Priority: 30},
+	RegistryNewerImage: {ID: RegistryNewerImage, Label: "Newer Image on Tag", From: report.FromLatest, Priority: 31},
+	RegistryDaysBehind: {ID: RegistryDaysBehind, Label: "Days Behind Tag", From: report.FromLatest, Datatype: "number", Priority: 32},
+}
+
+// RegistryTag is what a registry says of a tag: the digest of the image it
+// is of, and when that image was created, which for images built to be
+// pushed is as good as when they were.
+type RegistryTag struct {
+	Digest string    `json:"digest"`
+	Pushed time.Time `json:"pushed"`
+}
+
+// ImageRegistry looks up the tags of images, by their names, like nginx:1.19
+// or quay.io/weaveworks/scope:latest.
+type ImageRegistry interface {
+	LookupTag(ctx context.Context, image string) (RegistryTag, error)
+}
+
+// ParseImageName splits the name of an image into the host of its registry,
+// its repository and its tag, as docker does: names without a registry are
+// on the Docker Hub, and names without a tag are of latest.
+func ParseImageName(image string) (host, repository, tag string, err error) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return "", "", "", fmt.Errorf("image %s is pinned by digest", image)
+	}
+	repository, tag = image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, tag = image[:i], image[i+1:]
+	}
+	if repository == "" || tag == "" {
+		return "", "", "", fmt.Errorf("invalid image name: %q", image)
+	}
+	host = dockerHubRegistry
+	if i := strings.Index(repository, "/"); i >= 0 {
+		first := repository[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			host, repository = first, repository[i+1:]
+		}
+	}
+	switch host {
+	case "docker.io", "index.docker.io":
+		host = dockerHubRegistry
+	}
+	if host == dockerHubRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return host, repository, tag, nil
+}
+
+// RegistryClient looks up tags with the v2 API of registries, anonymously,
+// fetching the tokens registries ask for.
+type RegistryClient struct {
+	Client *http.Client
+}
+
+type registryManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+type registryImageConfig struct {
+	Created time.Time `json:"created"`
+}
+
+// LookupTag implements ImageRegistry.
+func (c RegistryClient) LookupTag(ctx context.Context, image string) (RegistryTag, error) {
+	host, repository, tag, err := ParseImageName(image)
+	if err != nil {
+		return RegistryTag{}, err
+	}
+	body, digest, err := c.get(ctx, host, repository, "manifests/"+tag, strings.Join([]string{manifestListV2, ociIndex, manifestV2, ociManifest}, ", "))
+	if err != nil {
+		return RegistryTag{}, err
+	}
+	var manifest registryManifest
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&manifest); err != nil {
+		return RegistryTag{}, err
+	}
+	result := RegistryTag{Digest: digest}
+
+	// Of images for many platforms, the date is that of the linux/amd64 one
+	if len(manifest.Manifests) > 0 {
+		platform := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				platform = m.Digest
+				break
+			}
+		}
+		if body, _, err = c.get(ctx, host, repository, "manifests/"+platform, strings.Join([]string{manifestV2, ociManifest}, ", ")); err != nil {
+			return RegistryTag{}, err
+		}
+		manifest = registryManifest{}
+		if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&manifest); err != nil {
+			return RegistryTag{}, err
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return RegistryTag{}, fmt.Errorf("manifest of %s without a config", image)
+	}
+	if body, _, err = c.get(ctx, host, repository, "blobs/"+manifest.Config.Digest, "*/*"); err != nil {
+		return RegistryTag{}, err
+	}
+	var config registryImageConfig
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&config); err != nil {
+		return RegistryTag{}, err
+	}
+	result.Pushed = config.Created
+	return result, nil
+}
+
+// get a manifest or blob of a repository, with its digest, fetching a
+// token if the registry asks for one.
+func (c RegistryClient) get(ctx context.Context, host, repository, path, accept string) ([]byte, string, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/%s", host, repository, path)
+	token := ""
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Accept", accept)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ctxhttp.Do(ctx, client, req)
+		if err != nil {
+			return nil, "", err
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if token, err = c.token(ctx, client, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("getting %s: %s", u, resp.Status)
+		}
+		digest := resp.Header.Get(manifestDigestKey)
+		if digest == "" {
+			digest = fmt.Sprintf("sha256:%x", sha256.Sum256(buf.Bytes()))
+		}
+		return buf.Bytes(), digest, nil
+	}
+}
+
+// token fetches an anonymous token, from where a registry's challenge, like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",
+// scope="repository:library/nginx:pull", says.
+func (c RegistryClient) token(ctx context.Context, client *http.Client, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry challenge: %q", challenge)
+	}
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry challenge without a realm: %q", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value, ok := params[key]; ok {
+			query.Set(key, value)
+		}
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting a token from %s: %s", realm.Host, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
+
+type tagLookup struct {
+	result  RegistryTag
+	fetched time.Time
+	err     error
+	pending bool
+}
+
+// RegistryCollector is a collector adding what registries say of the tags
+// of images to the nodes of images and their containers, in the reports of
+// another: when the image of the tag was pushed, and whether and by how much
+// the image running is behind it. Each distinct tag is looked up in the
+// background, and again once its lookup is older than the TTL.
+type RegistryCollector struct {
+	Collector
+	registry ImageRegistry
+	ttl      time.Duration
+
+	mtx        sync.Mutex
+	lookups    map[string]*tagLookup // by image name
+	generation int                   // of the lookups, counting those done
+	queue      chan string
+	quit       chan struct{}
+	wait       sync.WaitGroup
+}
+
+// NewRegistryCollector makes a new RegistryCollector.
+func NewRegistryCollector(collector Collector, registry ImageRegistry, ttl time.Duration) *RegistryCollector {
+	c := &RegistryCollector{
+		Collector: collector,
+		registry:  registry,
+		ttl:       ttl,
+		lookups:   map[string]*tagLookup{},
+		queue:     make(chan string, registryQueueLength),
+		quit:      make(chan struct{}),
+	}
+	for i := 0; i < registryWorkers; i++ {
+		c.wait.Add(1)
+		go c.loop()
+	}
+	return c
+}
+
+// Stop stops looking up tags.
+func (c *RegistryCollector) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *RegistryCollector) loop() {
+	defer c.wait.Done()
+	for {
+		select {
+		case image := <-c.queue:
+			c.fetch(image)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *RegistryCollector) fetch(image string) {
+	ctx, cancel := context.WithTimeout(context.Background(), registryLookupTimeout)
+	defer cancel()
+	result, err := c.registry.LookupTag(ctx, image)
+	if err != nil {
+		log.Warnf("Error looking up the tag of image %s: %v", image, err)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.lookups[image] = &tagLookup{result: result, fetched: mtime.Now(), err: err}
+	c.generation++
+}
+
+// lookup gives the last successful lookup of a tag, queueing it to be
+// looked up if it never was, or is due to be again.
+func (c *RegistryCollector) lookup(image string, now time.Time) (RegistryTag, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	l, ok := c.lookups[image]
+	if !ok {
+		l = &tagLookup{}
+		c.lookups[image] = l
+	}
+	due := l.fetched.IsZero() ||
+		(l.err == nil && now.Sub(l.fetched) > c.ttl) ||
+		(l.err != nil && now.Sub(l.fetched) > registryRetry)
+	if due && !l.pending {
+		select {
+		case c.queue <- image:
+			l.pending = true
+		default:
+			// Looking up is behind; try again with the next report
+		}
+	}
+	return l.result, !l.fetched.IsZero() && l.err == nil
+}
+
+// Report implements Reporter.
+func (c *RegistryCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := c.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	return c.addRegistryMetadata(rpt, mtime.Now()), nil
+}
+
+func (c *RegistryCollector) addRegistryMetadata(rpt report.Report, now time.Time) report.Report {
+	result := rpt
+	result.ContainerImage = rpt.ContainerImage.WithMetadataTemplates(registryMetadataTemplates)
+	result.Container = rpt.Container.WithMetadataTemplates(registryMetadataTemplates)
+
+	images := map[string]map[string]string{}
+	result.ContainerImage.Nodes = rpt.ContainerImage.Nodes.Copy()
+	for id, n := range rpt.ContainerImage.Nodes {
+		name, ok := n.Latest.Lookup(docker.ImageName)
+		if !ok || name == "" || name == "<none>:<none>" {
+			continue
+		}
+		tag, ok := c.lookup(name, now)
+		if !ok {
+			continue
+		}
+		images[id] = tagMetadata(n, tag)
+		result.ContainerImage.Nodes[id] = n.WithLatests(images[id])
+	}
+
+	result.Container.Nodes = rpt.Container.Nodes.Copy()
+	for id, n := range rpt.Container.Nodes {
+		imageIDs, _ := n.Parents.Lookup(report.ContainerImage)
+		if len(imageIDs) == 0 {
+			if imageID, ok := n.Latest.Lookup(docker.ImageID); ok {
+				imageIDs = report.MakeStringSet(report.MakeContainerImageNodeID(imageID))
+			}
+		}
+		for _, imageID := range imageIDs {
+			if latests, ok := images[imageID]; ok {
+				result.Container.Nodes[id] = n.WithLatests(latests)
+				break
+			}
+		}
+	}
+	if len(images) > 0 {
+		c.mtx.Lock()
+		result = withEnrichmentRenderID(result, "registry", c.generation)
+		c.mtx.Unlock()
+	}
+	return result
+}
+
+// tagMetadata compares an image to that of its tag. Images are behind their
+// tags when they aren't of the digest the tag is of now, by the days
+// between when they were created and when the image of the tag was.
+func tagMetadata(n report.Node, tag RegistryTag) map[string]string {
+	latests := map[string]string{
+		RegistryTagPushed: tag.Pushed.UTC().Format(time.RFC3339),
+	}
+	repoDigest, ok := n.Latest.Lookup(docker.ImageDigest)
+	if !ok {
+		// Images never pulled from the registry can't be compared to it
+		return latests
+	}
+	newer := tag.Digest != "" && !strings.HasSuffix(repoDigest, "@"+tag.Digest)
+	latests[RegistryNewerImage] = strconv.FormatBool(newer)
+	days := 0
+	if created, ok := n.Latest.Lookup(docker.ImageCreated); ok && newer {
+		if t, err := time.Parse(time.RFC3339, created); err == nil && tag.Pushed.After(t) {
+			days = int(tag.Pushed.Sub(t).Hours() / 24)
+		}
+	}
+	latests[RegistryDaysBehind] = strconv.Itoa(days)
+	return latests
+}
+
+// IsOutdated checks whether a node is of an image whose tag moved on to
+// another image, or of a container of one.
+func IsOutdated(n report.Node) bool {
+	newer, ok := n.Latest.Lookup(RegistryNewerImage)
+	return ok && newer == "true"
+}
+
+var outdatedFilter = APITopologyOptionGroup{
+	ID:      "outdated",
+	Default: "all",
+	Options: []APITopologyOption{
+		{Value: "all", Label: "All", filter: nil, filterPseudo: false},
+		{Value: "outdated", Label: "Behind their tags", filter: IsOutdated, filterPseudo: true},
+	},
+}
+
+// updateRegistryFilters offers to show only the containers of images behind
+// their tags, when any tags were looked up.
+func updateRegistryFilters(rpt report.Report, topologies []APITopologyDesc) []APITopologyDesc {
+	looked := false
+	for _, n := range rpt.ContainerImage.Nodes {
+		if _, ok := n.Latest.Lookup(RegistryNewerImage); ok {
+			looked = true
+			break
+		}
+	}
+	if !looked {
+		return topologies
+	}
+	topologies = append([]APITopologyDesc{}, topologies...) // Make a copy so we can make changes safely
+	for i, t := range topologies {
+		if t.id == containersID {
+			topologies[i] = mergeTopologyFilters(t, []APITopologyOptionGroup{outdatedFilter})
+		}
+	}
+	return topologies
+}
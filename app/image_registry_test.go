@@ -0,0 +1,157 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestParseImageName(t *testing.T) {
+	for image, want := range map[string][3]string{
+		"nginx":                          {"registry-1.docker.io", "library/nginx", "latest"},
+		"nginx:1.19":                     {"registry-1.docker.io", "library/nginx", "1.19"},
+		"weaveworks/scope:1.13.0":        {"registry-1.docker.io", "weaveworks/scope", "1.13.0"},
+		"docker.io/weaveworks/scope":     {"registry-1.docker.io", "weaveworks/scope", "latest"},
+		"quay.io/coreos/etcd:v3.4":       {"quay.io", "coreos/etcd", "v3.4"},
+		"localhost:5000/app:dev":         {"localhost:5000", "app", "dev"},
+		"registry.example.com:443/a/b/c": {"registry.example.com:443", "a/b/c", "latest"},
+	} {
+		host, repository, tag, err := app.ParseImageName(image)
+		ok(t, err)
+		equals(t, want, [3]string{host, repository, tag})
+	}
+	if _, _, _, err := app.ParseImageName("nginx@sha256:abc"); err == nil {
+		t.Errorf("Expected no tags of images pinned by digest")
+	}
+}
+
+func TestRegistryClient(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			equals(t, "repository:library/nginx:pull", r.URL.Query().Get("scope"))
+			w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:library/nginx:pull"`, ts.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/library/nginx/manifests/1.19":
+			w.Header().Set("Docker-Content-Digest", "sha256:list")
+			w.Write([]byte(`{"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json", "manifests": [
+				{"digest": "sha256:arm", "platform": {"architecture": "arm64", "os": "linux"}},
+				{"digest": "sha256:amd", "platform": {"architecture": "amd64", "os": "linux"}}]}`))
+		case "/v2/library/nginx/manifests/sha256:amd":
+			w.Write([]byte(`{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {"digest": "sha256:config"}}`))
+		case "/v2/library/nginx/blobs/sha256:config":
+			w.Write([]byte(`{"architecture": "amd64", "created": "2021-03-04T05:06:07.123456789Z"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "https://")
+	client := app.RegistryClient{Client: ts.Client()}
+	ctx := context.Background()
+
+	tag, err := client.LookupTag(ctx, host+"/library/nginx:1.19")
+	ok(t, err)
+	equals(t, "sha256:list", tag.Digest)
+	equals(t, time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC), tag.Pushed.UTC())
+
+	if _, err := client.LookupTag(ctx, host+"/library/nginx:no-such-tag"); err == nil {
+		t.Errorf("Expected an error looking up an unknown tag")
+	}
+}
+
+type mockRegistry struct {
+	sync.Mutex
+	looked []string
+	tags   map[string]app.RegistryTag
+}
+
+func (r *mockRegistry) LookupTag(_ context.Context, image string) (app.RegistryTag, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.looked = append(r.looked, image)
+	tag, ok := r.tags[image]
+	if !ok {
+		return app.RegistryTag{}, fmt.Errorf("no such image: %s", image)
+	}
+	return tag, nil
+}
+
+func TestRegistryCollector(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	for id, latests := range map[string]map[string]string{
+		fixture.ClientContainerImageNodeID: {
+			docker.ImageDigest:  fixture.ClientContainerImageName + "@sha256:old",
+			docker.ImageCreated: "2020-01-01T00:00:00Z",
+		},
+		fixture.ServerContainerImageNodeID: {
+			docker.ImageDigest:  fixture.ServerContainerImageName + "@sha256:server",
+			docker.ImageCreated: "2020-01-01T00:00:00Z",
+		},
+	} {
+		rpt.ContainerImage.Nodes[id] = rpt.ContainerImage.Nodes[id].WithLatests(latests)
+	}
+	registry := &mockRegistry{tags: map[string]app.RegistryTag{
+		fixture.ClientContainerImageName: {Digest: "sha256:new", Pushed: time.Date(2020, 4, 10, 12, 0, 0, 0, time.UTC)},
+		fixture.ServerContainerImageName: {Digest: "sha256:server", Pushed: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	collector := app.NewRegistryCollector(app.StaticCollector(rpt), registry, time.Hour)
+	defer collector.Stop()
+	ctx := context.Background()
+
+	test.Poll(t, 100*time.Millisecond, "true", func() interface{} {
+		rpt, _ := collector.Report(ctx, time.Now())
+		newer, _ := rpt.ContainerImage.Nodes[fixture.ClientContainerImageNodeID].Latest.Lookup(app.RegistryNewerImage)
+		return newer
+	})
+	latest, err := collector.Report(ctx, time.Now())
+	ok(t, err)
+	for id, want := range map[string][2]string{
+		fixture.ClientContainerNodeID: {"true", "100"},
+		fixture.ServerContainerNodeID: {"false", "0"},
+	} {
+		n := latest.Container.Nodes[id]
+		newer, _ := n.Latest.Lookup(app.RegistryNewerImage)
+		days, _ := n.Latest.Lookup(app.RegistryDaysBehind)
+		equals(t, want, [2]string{newer, days})
+	}
+	pushed, _ := latest.Container.Nodes[fixture.ClientContainerNodeID].Latest.Lookup(app.RegistryTagPushed)
+	equals(t, "2020-04-10T12:00:00Z", pushed)
+	// Lookups are kept until their TTL
+	registry.Lock()
+	equals(t, 2, len(registry.looked))
+	registry.Unlock()
+
+	// Containers can be filtered down to those behind their tags
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, collector, map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers?outdated=outdated"), &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := topology.Nodes[fixture.ClientContainerNodeID]; !found || len(topology.Nodes) != 1 {
+		t.Errorf("Expected only the outdated container, got %d nodes", len(topology.Nodes))
+	}
+}
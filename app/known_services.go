@@ -0,0 +1,450 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+const knownServicesFetchTimeout = time.Minute
+
+// builtinKnownServices are the ranges of well-known services whose published
+// ranges rarely change: public DNS resolvers, and the ranges at
+// https://www.cloudflare.com/ips-v4 and https://www.cloudflare.com/ips-v6.
+// The ranges of cloud providers change weekly, and are loaded from where
+// they are published instead.
+const builtinKnownServices = `# network,service
+8.8.8.8/32,Google Public DNS
+8.8.4.4/32,Google Public DNS
+2001:4860:4860::8888/128,Google Public DNS
+2001:4860:4860::8844/128,Google Public DNS
+1.1.1.1/32,Cloudflare DNS
+1.0.0.1/32,Cloudflare DNS
+2606:4700:4700::1111/128,Cloudflare DNS
+2606:4700:4700::1001/128,Cloudflare DNS
+9.9.9.9/32,Quad9 DNS
+149.112.112.112/32,Quad9 DNS
+208.67.222.222/32,OpenDNS
+208.67.220.220/32,OpenDNS
+173.245.48.0/20,Cloudflare
+103.21.244.0/22,Cloudflare
+103.22.200.0/22,Cloudflare
+103.31.4.0/22,Cloudflare
+141.101.64.0/18,Cloudflare
+108.162.192.0/18,Cloudflare
+190.93.240.0/20,Cloudflare
+188.114.96.0/20,Cloudflare
+197.234.240.0/22,Cloudflare
+198.41.128.0/17,Cloudflare
+162.158.0.0/15,Cloudflare
+104.16.0.0/13,Cloudflare
+104.24.0.0/14,Cloudflare
+172.64.0.0/13,Cloudflare
+131.0.72.0/22,Cloudflare
+2400:cb00::/32,Cloudflare
+2606:4700::/32,Cloudflare
+2803:f800::/32,Cloudflare
+2405:b500::/32,Cloudflare
+2405:8100::/32,Cloudflare
+2a06:98c0::/29,Cloudflare
+2c0f:f248::/32,Cloudflare
+`
+
+// networkTable finds the most specific of a set of networks addresses are
+// in, trying the networks of each prefix length they could be in rather
+// than all the networks.
+type networkTable struct {
+	lengths  []int          // of the prefixes of the networks, longest first
+	networks map[string]int // by network, like "8.8.8.0/24", to the index of what they are of
+}
+
+func (t *networkTable) add(network *net.IPNet, i int) {
+	if t.networks == nil {
+		t.networks = map[string]int{}
+	}
+	t.networks[network.String()] = i
+	ones, bits := network.Mask.Size()
+	length := ones + 128 - bits // of IPv4 networks as IPv4-mapped ones
+	for j, l := range t.lengths {
+		if l == length {
+			return
+		} else if l < length {
+			t.lengths = append(t.lengths[:j], append([]int{length}, t.lengths[j:]...)...)
+			return
+		}
+	}
+	t.lengths = append(t.lengths, length)
+}
+
+func (t *networkTable) get(network *net.IPNet) (int, bool) {
+	i, ok := t.networks[network.String()]
+	return i, ok
+}
+
+func (t *networkTable) lookup(ip net.IP) (int, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return 0, false
+	}
+	isIPv4 := ip.To4() != nil
+	for _, length := range t.lengths {
+		if isIPv4 && length < 96 {
+			break
+		}
+		network := net.IPNet{IP: ip.Mask(net.CIDRMask(length, 128)), Mask: net.CIDRMask(length, 128)}
+		if isIPv4 {
+			network = net.IPNet{IP: network.IP.To4(), Mask: net.CIDRMask(length-96, 32)}
+		}
+		if i, ok := t.networks[network.String()]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// knownServiceRange is a network of a service. Ranges of the same network
+// are of the most specific of their services, like "AWS S3 us-east-1" rather
+// than "AWS us-east-1".
+type knownServiceRange struct {
+	network     *net.IPNet
+	service     string
+	specificity int
+}
+
+// KnownServices classifies external addresses as of the services of cloud
+// providers and well-known services, by the published ranges of their
+// addresses.
+type KnownServices struct {
+	table  networkTable
+	ranges []knownServiceRange
+}
+
+func (s *KnownServices) add(ranges []knownServiceRange) {
+	for _, r := range ranges {
+		if i, ok := s.table.get(r.network); ok {
+			if s.ranges[i].specificity < r.specificity {
+				s.ranges[i] = r
+			}
+			continue
+		}
+		s.table.add(r.network, len(s.ranges))
+		s.ranges = append(s.ranges, r)
+	}
+}
+
+// Classify gives the service an address is of, that of the most specific
+// range it is in.
+func (s *KnownServices) Classify(ip net.IP) (string, bool) {
+	i, ok := s.table.lookup(ip)
+	if !ok {
+		return "", false
+	}
+	return s.ranges[i].service, true
+}
+
+// LoadKnownServices loads the built-in ranges of well-known services, and
+// the ranges published at each of the sources, files or http(s) URLs. Sources
+// can be the ip-ranges.json of AWS, the cloud.json of GCP, the Service Tags
+// of Azure, or lines of network[,service], of a service named by prefixing
+// the source with "service=", like
+// "Cloudflare=https://www.cloudflare.com/ips-v4".
+func LoadKnownServices(ctx context.Context, client *http.Client, sources []string) (*KnownServices, error) {
+	services := &KnownServices{}
+	ranges, err := parseKnownServiceRanges([]byte(builtinKnownServices), "")
+	if err != nil {
+		return nil, err
+	}
+	services.add(ranges)
+	for _, source := range sources {
+		service, location := "", source
+		if i := strings.Index(source, "="); i > 0 && !strings.ContainsAny(source[:i], "/:") {
+			service, location = source[:i], source[i+1:]
+		}
+		content, err := readKnownServiceSource(ctx, client, location)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", location, err)
+		}
+		ranges, err := parseKnownServiceRanges(content, service)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", location, err)
+		}
+		services.add(ranges)
+	}
+	return services, nil
+}
+
+func readKnownServiceSource(ctx context.Context, client *http.Client, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return ioutil.ReadFile(location)
+	}
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+type publishedPrefix struct {
+	// AWS
+	IPPrefix   string `json:"ip_prefix"`
+	IPv6Prefix string `json:"ipv6_prefix"`
+	Region     string `json:"region"`
+	Service    string `json:"service"`
+	// GCP
+	IPv4PrefixGCP string `json:"ipv4Prefix"`
+	IPv6PrefixGCP string `json:"ipv6Prefix"`
+	Scope         string `json:"scope"`
+}
+
+type publishedRanges struct {
+	Prefixes     []publishedPrefix `json:"prefixes"`
+	IPv6Prefixes []publishedPrefix `json:"ipv6_prefixes"`
+	// Azure
+	Values []struct {
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+}
+
+// parseKnownServiceRanges parses published ranges of services, of the JSON
+// of AWS, GCP or Azure, or of lines of network[,service]. Lines without a
+// service are of that given.
+func parseKnownServiceRanges(content []byte, service string) ([]knownServiceRange, error) {
+	content = bytes.TrimSpace(content)
+	if !bytes.HasPrefix(content, []byte("{")) {
+		return parseKnownServiceLines(content, service)
+	}
+	var published publishedRanges
+	if err := json.Unmarshal(content, &published); err != nil {
+		return nil, err
+	}
+	var ranges []knownServiceRange
+	add := func(prefix, service string, specificity int) error {
+		if prefix == "" {
+			return nil
+		}
+		_, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, knownServiceRange{network: network, service: service, specificity: specificity})
+		return nil
+	}
+	for _, p := range append(published.Prefixes, published.IPv6Prefixes...) {
+		var err error
+		if p.IPv4PrefixGCP != "" || p.IPv6PrefixGCP != "" {
+			service := joinNonEmpty("GCP", p.Scope)
+			if err = add(p.IPv4PrefixGCP, service, 1); err == nil {
+				err = add(p.IPv6PrefixGCP, service, 1)
+			}
+		} else {
+			// AMAZON is of all the ranges of AWS, the others of its services
+			region, specificity := p.Region, 1
+			if region == "GLOBAL" {
+				region = ""
+			}
+			name := p.Service
+			if name == "AMAZON" {
+				name, specificity = "", 0
+			}
+			service := joinNonEmpty("AWS", name, region)
+			if err = add(p.IPPrefix, service, specificity); err == nil {
+				err = add(p.IPv6Prefix, service, specificity)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range published.Values {
+		// AzureCloud is of all the ranges of Azure, the others of its
+		// services, in all regions or one
+		name := strings.TrimPrefix(v.Properties.SystemService, "Azure")
+		specificity := 0
+		if name != "" {
+			specificity++
+		}
+		if v.Properties.Region != "" {
+			specificity++
+		}
+		service := joinNonEmpty("Azure", name, v.Properties.Region)
+		for _, prefix := range v.Properties.AddressPrefixes {
+			if err := add(prefix, service, specificity); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ranges, nil
+}
+
+func parseKnownServiceLines(content []byte, service string) ([]knownServiceRange, error) {
+	var ranges []knownServiceRange
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, ",", 2)
+		_, network, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		r := knownServiceRange{network: network, service: service}
+		if len(fields) == 2 {
+			r.service = strings.TrimSpace(fields[1])
+		}
+		if r.service == "" {
+			return nil, fmt.Errorf("line %d: no service of %s", line, fields[0])
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, scanner.Err()
+}
+
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// KnownServiceCollector is a collector classifying the external addresses of
+// the endpoints in the reports of another as of known services, for them to
+// be rendered as pseudo nodes of those services rather than of the Internet.
+// The ranges of services are loaded again every refresh interval, keeping
+// those last loaded if that fails.
+type KnownServiceCollector struct {
+	Collector
+	client  *http.Client
+	sources []string
+
+	mtx        sync.Mutex
+	services   *KnownServices
+	generation int // of the services loaded
+	quit       chan struct{}
+	wait       sync.WaitGroup
+}
+
+// NewKnownServiceCollector makes a new KnownServiceCollector, loading the
+// ranges of services from the sources. Until they are loaded, addresses are
+// only classified by the built-in ranges.
+func NewKnownServiceCollector(collector Collector, client *http.Client, sources []string, refresh time.Duration) *KnownServiceCollector {
+	c := &KnownServiceCollector{
+		Collector: collector,
+		client:    client,
+		sources:   sources,
+		quit:      make(chan struct{}),
+	}
+	if err := c.load(); err != nil {
+		log.Warnf("Error loading the ranges of known services: %v", err)
+		c.services, _ = LoadKnownServices(context.Background(), client, nil)
+	}
+	if len(sources) > 0 && refresh > 0 {
+		c.wait.Add(1)
+		go c.loop(refresh)
+	}
+	return c
+}
+
+// Stop stops loading the ranges of services.
+func (c *KnownServiceCollector) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *KnownServiceCollector) loop(refresh time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.load(); err != nil {
+				log.Warnf("Error loading the ranges of known services: %v", err)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *KnownServiceCollector) load() error {
+	ctx, cancel := context.WithTimeout(context.Background(), knownServicesFetchTimeout)
+	defer cancel()
+	services, err := LoadKnownServices(ctx, c.client, c.sources)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.services = services
+	c.generation++
+	return nil
+}
+
+// Report implements Reporter.
+func (c *KnownServiceCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := c.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	return c.addKnownServices(rpt), nil
+}
+
+func (c *KnownServiceCollector) addKnownServices(rpt report.Report) report.Report {
+	c.mtx.Lock()
+	services, generation := c.services, c.generation
+	c.mtx.Unlock()
+
+	local := render.LocalNetworks(rpt)
+	result := rpt
+	result.Endpoint.Nodes = rpt.Endpoint.Nodes.Copy()
+	classified := false
+	for id, n := range rpt.Endpoint.Nodes {
+		_, addr, _, ok := report.ParseEndpointNodeID(id)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil || local.Contains(ip) {
+			continue
+		}
+		if service, ok := services.Classify(ip); ok {
+			result.Endpoint.Nodes[id] = n.WithLatest(render.KnownService, mtime.Now(), service)
+			classified = true
+		}
+	}
+	if classified {
+		result = withEnrichmentRenderID(result, "known-services", generation)
+	}
+	return result
+}
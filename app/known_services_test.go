@@ -0,0 +1,138 @@
+package app_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+const (
+	awsRanges = `{
+  "syncToken": "1700000000",
+  "prefixes": [
+    {"ip_prefix": "52.216.0.0/15", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"},
+    {"ip_prefix": "52.216.0.0/15", "region": "us-east-1", "service": "S3", "network_border_group": "us-east-1"},
+    {"ip_prefix": "52.0.0.0/11", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f18::/33", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"}
+  ]
+}`
+	gcpRanges = `{
+  "syncToken": "1700000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.80.0.0/15", "service": "Google Cloud", "scope": "asia-east1"},
+    {"ipv6Prefix": "2600:1900:4010::/44", "service": "Google Cloud", "scope": "europe-west1"}
+  ]
+}`
+	azureRanges = `{
+  "changeNumber": 1,
+  "cloud": "Public",
+  "values": [
+    {"name": "AzureCloud", "properties": {"region": "", "systemService": "", "addressPrefixes": ["20.38.0.0/16"]}},
+    {"name": "AzureCloud.eastus", "properties": {"region": "eastus", "systemService": "", "addressPrefixes": ["20.38.0.0/16"]}},
+    {"name": "Storage.EastUS", "properties": {"region": "eastus", "systemService": "AzureStorage", "addressPrefixes": ["20.38.98.0/24"]}}
+  ]
+}`
+)
+
+func TestLoadKnownServices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ip-ranges.json":
+			fmt.Fprint(w, awsRanges)
+		case "/cloud.json":
+			fmt.Fprint(w, gcpRanges)
+		case "/saas":
+			fmt.Fprint(w, "# GitHub\n140.82.112.0/20\n192.30.252.0/22,GitHub Pages\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "known-services")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	azure := filepath.Join(dir, "ServiceTags_Public.json")
+	ok(t, ioutil.WriteFile(azure, []byte(azureRanges), 0600))
+
+	services, err := app.LoadKnownServices(context.Background(), ts.Client(), []string{
+		ts.URL + "/ip-ranges.json",
+		ts.URL + "/cloud.json",
+		azure,
+		"GitHub=" + ts.URL + "/saas",
+	})
+	ok(t, err)
+	for addr, want := range map[string]string{
+		"52.217.1.2":           "AWS S3 us-east-1",
+		"52.1.2.3":             "AWS us-east-1",
+		"13.32.4.5":            "AWS CLOUDFRONT",
+		"2600:1f18::1":         "AWS EC2 us-east-1",
+		"34.81.0.1":            "GCP asia-east1",
+		"2600:1900:4010::1":    "GCP europe-west1",
+		"20.38.1.1":            "Azure eastus",
+		"20.38.98.7":           "Azure Storage eastus",
+		"140.82.113.4":         "GitHub",
+		"192.30.253.1":         "GitHub Pages",
+		"8.8.8.8":              "Google Public DNS",
+		"2606:4700:4700::1111": "Cloudflare DNS",
+		"104.16.1.1":           "Cloudflare",
+		"93.184.216.34":        "",
+	} {
+		have, _ := services.Classify(net.ParseIP(addr))
+		equals(t, want, have)
+	}
+
+	if _, err := app.LoadKnownServices(context.Background(), ts.Client(), []string{ts.URL + "/missing"}); err == nil {
+		t.Errorf("Expected an error loading missing ranges")
+	}
+	if _, err := app.LoadKnownServices(context.Background(), ts.Client(), []string{ts.URL + "/saas"}); err == nil {
+		t.Errorf("Expected an error loading ranges without services")
+	}
+}
+
+func TestKnownServiceCollector(t *testing.T) {
+	collector := app.NewKnownServiceCollector(app.StaticCollector(fixture.Report), http.DefaultClient, nil, time.Hour)
+	defer collector.Stop()
+	rpt, err := collector.Report(context.Background(), time.Now())
+	ok(t, err)
+	service, _ := rpt.Endpoint.Nodes[fixture.GoogleEndpointNodeID].Latest.Lookup(render.KnownService)
+	equals(t, "Google Public DNS", service)
+	if _, found := rpt.Endpoint.Nodes[fixture.RandomClientNodeID].Latest.Lookup(render.KnownService); found {
+		t.Errorf("Expected %s not to be of a known service", fixture.RandomClientIP)
+	}
+
+	// Connections to known services are to nodes of those services, rather
+	// than to the Internet
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, collector, map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/processes"), &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	node, found := topology.Nodes[render.ServiceNodeIDPrefix+"Google Public DNS"]
+	if !found {
+		t.Fatalf("Expected a node of Google Public DNS, got %d nodes", len(topology.Nodes))
+	}
+	equals(t, "Google Public DNS", node.Label)
+	if _, found := topology.Nodes[render.OutgoingInternetID]; found {
+		t.Errorf("Expected no outgoing connections to the Internet")
+	}
+}
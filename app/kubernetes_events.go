@@ -0,0 +1,102 @@
+package app
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+// eventTopologies are the topologies of the nodes of objects probes attach
+// events to, by the IDs of the API topologies showing them, if any.
+var eventTopologies = map[string]string{
+	report.Pod:         podsID,
+	report.Deployment:  kubeControllersID,
+	report.DaemonSet:   kubeControllersID,
+	report.StatefulSet: kubeControllersID,
+	report.ReplicaSet:  "",
+}
+
+// APIEvent is a recent Kubernetes event of an object, with the node of the
+// object it is attached to.
+type APIEvent struct {
+	Topology  string    `json:"topology,omitempty"` // showing the node, if any
+	NodeID    string    `json:"nodeId"`
+	Object    string    `json:"object"`
+	Namespace string    `json:"namespace"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+}
+
+// APIEvents are the recent Kubernetes events of the objects of a cluster,
+// newest first.
+type APIEvents struct {
+	Events []APIEvent `json:"events"`
+}
+
+// MakeAPIEvents gathers the events attached to the nodes of objects, of the
+// namespace and of the type, if given.
+func MakeAPIEvents(rpt report.Report, namespace, eventType string) APIEvents {
+	result := APIEvents{Events: []APIEvent{}}
+	for topologyID, apiTopologyID := range eventTopologies {
+		t, _ := rpt.Topology(topologyID)
+		for _, n := range t.Nodes {
+			ns, _ := n.Latest.Lookup(kubernetes.Namespace)
+			if namespace != "" && ns != namespace {
+				continue
+			}
+			name, _ := n.Latest.Lookup(kubernetes.Name)
+			for _, row := range n.ExtractMulticolumnTable(kubernetes.EventsTableTemplate) {
+				event := APIEvent{
+					Topology:  apiTopologyID,
+					NodeID:    n.ID,
+					Object:    name,
+					Namespace: ns,
+					Type:      row.Entries[kubernetes.EventType],
+					Reason:    row.Entries[kubernetes.EventReason],
+					Message:   row.Entries[kubernetes.EventMessage],
+				}
+				if eventType != "" && event.Type != eventType {
+					continue
+				}
+				event.LastSeen, _ = time.Parse(time.RFC3339, row.Entries[kubernetes.EventLastSeen])
+				event.Count, _ = strconv.Atoi(row.Entries[kubernetes.EventCount])
+				result.Events = append(result.Events, event)
+			}
+		}
+	}
+	sort.Slice(result.Events, func(i, j int) bool {
+		a, b := result.Events[i], result.Events[j]
+		if !a.LastSeen.Equal(b.LastSeen) {
+			return a.LastSeen.After(b.LastSeen)
+		}
+		if a.NodeID != b.NodeID {
+			return a.NodeID < b.NodeID
+		}
+		return a.Reason < b.Reason
+	})
+	return result
+}
+
+// Recent Kubernetes events of the whole cluster, of the namespace and type
+// (like Warning) parameters, if given.
+func handleKubernetesEvents(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	rpt, err := rep.Report(ctx, deserializeTimestamp(r.Form.Get("timestamp")))
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWith(w, http.StatusOK, MakeAPIEvents(rpt, r.Form.Get("namespace"), r.Form.Get("type")))
+}
@@ -0,0 +1,66 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPIKubernetesEvents(t *testing.T) {
+	row := func(id, lastSeen, eventType, reason string) report.Row {
+		return report.Row{ID: id, Entries: map[string]string{
+			kubernetes.EventLastSeen: lastSeen,
+			kubernetes.EventType:     eventType,
+			kubernetes.EventReason:   reason,
+			kubernetes.EventMessage:  reason + " happened",
+			kubernetes.EventCount:    "2",
+		}}
+	}
+	rpt := fixture.Report.Copy()
+	rpt.Pod.Nodes[fixture.ClientPodNodeID] = rpt.Pod.Nodes[fixture.ClientPodNodeID].AddPrefixMulticolumnTable(kubernetes.EventsTablePrefix, []report.Row{
+		row("pong-a.1", "2017-01-01T00:01:00Z", "Warning", "BackOff"),
+		row("pong-a.2", "2017-01-01T00:03:00Z", "Normal", "Pulled"),
+	})
+	rpt.Pod.Nodes[fixture.ServerPodNodeID] = rpt.Pod.Nodes[fixture.ServerPodNodeID].AddPrefixMulticolumnTable(kubernetes.EventsTablePrefix, []report.Row{
+		row("pong-b.1", "2017-01-01T00:02:00Z", "Warning", "FailedScheduling"),
+	})
+	router := mux.NewRouter()
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var events app.APIEvents
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/kubernetes/events"), &codec.JsonHandle{}).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	reasons := []string{}
+	for _, event := range events.Events {
+		reasons = append(reasons, event.Reason)
+	}
+	equals(t, []string{"Pulled", "FailedScheduling", "BackOff"}, reasons)
+	equals(t, app.APIEvent{
+		Topology:  "pods",
+		NodeID:    fixture.ServerPodNodeID,
+		Object:    "pong-b",
+		Namespace: fixture.KubernetesNamespace,
+		LastSeen:  time.Date(2017, 1, 1, 0, 2, 0, 0, time.UTC),
+		Type:      "Warning",
+		Reason:    "FailedScheduling",
+		Message:   "FailedScheduling happened",
+		Count:     2,
+	}, events.Events[1])
+
+	// Events are of a type, and a namespace, if given
+	events = app.MakeAPIEvents(rpt, "", "Warning")
+	equals(t, 2, len(events.Events))
+	events = app.MakeAPIEvents(rpt, "other", "")
+	equals(t, 0, len(events.Events))
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+)
+
+// maxLayoutNodes is how many nodes a layout can pin.
+const maxLayoutNodes = 10000
+
+// Position is where a node was pinned in the graph.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Layout is the nodes a user pinned in the graph of a topology, in a view
+// of it: the options it is shown with, like "pseudo=hide".
+type Layout struct {
+	User     string              `json:"user"`
+	Topology string              `json:"topology"`
+	View     string              `json:"view,omitempty"`
+	Nodes    map[string]Position `json:"nodes"`
+	Updated  time.Time           `json:"updated"`
+}
+
+type layoutKey struct {
+	user, topology, view string
+}
+
+func (l Layout) key() layoutKey {
+	return layoutKey{l.User, l.Topology, l.View}
+}
+
+// Layouts keeps the layouts of users, so they survive refreshes of the
+// browser, and users can share them. They are kept in file if given, so
+// they survive restarts of the app too.
+type Layouts struct {
+	file string
+
+	mtx     sync.RWMutex
+	layouts map[layoutKey]Layout
+}
+
+// NewLayouts makes a new Layouts, loading the layouts in file.
+func NewLayouts(file string) (*Layouts, error) {
+	l := &Layouts{
+		file:    file,
+		layouts: map[layoutKey]Layout{},
+	}
+	if file == "" {
+		return l, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var saved []Layout
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("Error reading layouts from %s: %v", file, err)
+	}
+	for _, layout := range saved {
+		l.layouts[layout.key()] = layout
+	}
+	return l, nil
+}
+
+// save the layouts to the file, with the lock held.
+func (l *Layouts) save() error {
+	if l.file == "" {
+		return nil
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(l.list("")); err != nil {
+		return err
+	}
+	tmp := l.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.file)
+}
+
+// List gives the layouts of user, or of all users if user is "", sorted by
+// user, topology and view.
+func (l *Layouts) List(user string) []Layout {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.list(user)
+}
+
+func (l *Layouts) list(user string) []Layout {
+	result := make([]Layout, 0, len(l.layouts))
+	for _, layout := range l.layouts {
+		if user == "" || layout.User == user {
+			result = append(result, layout)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.Topology != b.Topology {
+			return a.Topology < b.Topology
+		}
+		return a.View < b.View
+	})
+	return result
+}
+
+// Get gives the layout of user for a view of a topology, if they saved one.
+func (l *Layouts) Get(user, topology, view string) (Layout, bool) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	layout, ok := l.layouts[layoutKey{user, topology, view}]
+	return layout, ok
+}
+
+func (l Layout) validate() error {
+	if l.Topology == "" {
+		return fmt.Errorf("layout without a topology")
+	}
+	if len(l.Nodes) > maxLayoutNodes {
+		return fmt.Errorf("layout of %d nodes, more than %d", len(l.Nodes), maxLayoutNodes)
+	}
+	return nil
+}
+
+// Save a layout, replacing the one its user had for its view.
+func (l *Layouts) Save(layout Layout) (Layout, error) {
+	if err := layout.validate(); err != nil {
+		return Layout{}, err
+	}
+	if layout.Nodes == nil {
+		layout.Nodes = map[string]Position{}
+	}
+	layout.Updated = mtime.Now()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.layouts[layout.key()] = layout
+	return layout, l.save()
+}
+
+// Delete the layout of user for a view of a topology, and say whether
+// there was one.
+func (l *Layouts) Delete(user, topology, view string) (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	key := layoutKey{user, topology, view}
+	if _, ok := l.layouts[key]; !ok {
+		return false, nil
+	}
+	delete(l.layouts, key)
+	return true, l.save()
+}
+
+// RegisterLayoutRoutes registers the routes listing, getting, saving and
+// deleting layouts. Users save and delete their own layouts, by the view in
+// the view parameter, but can get everyone's with the user parameter.
+func RegisterLayoutRoutes(router *mux.Router, layouts *Layouts) {
+	router.Methods("GET").Path("/api/layouts").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, layouts.List(r.FormValue("user")))
+		}))
+	router.Methods("GET").Path("/api/layouts/{topology}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			user := r.FormValue("user")
+			if _, ok := r.Form["user"]; !ok {
+				user = UserFromRequest(r).Name
+			}
+			layout, ok := layouts.Get(user, mux.Vars(r)["topology"], r.FormValue("view"))
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, layout)
+		}))
+	router.Methods("PUT").Path("/api/layouts/{topology}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			topologyID := mux.Vars(r)["topology"]
+			if _, ok := topologyRegistry.get(topologyID); !ok {
+				http.NotFound(w, r)
+				return
+			}
+			var layout Layout
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&layout); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			layout.User = UserFromRequest(r).Name
+			layout.Topology = topologyID
+			layout.View = r.FormValue("view")
+			if err := layout.validate(); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			layout, err := layouts.Save(layout)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondWith(w, http.StatusOK, layout)
+		}))
+	router.Methods("DELETE").Path("/api/layouts/{topology}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ok, err := layouts.Delete(UserFromRequest(r).Name, mux.Vars(r)["topology"], r.FormValue("view"))
+			respondRevoked(w, r, ok, err)
+		}))
+}
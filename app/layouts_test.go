@@ -0,0 +1,100 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+)
+
+func TestLayouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	layouts, err := app.NewLayouts(filepath.Join(dir, "layouts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	app.RegisterLayoutRoutes(router, layouts)
+	authenticator := app.StaticTokens{
+		"alice": {Name: "alice", Role: app.RoleViewer},
+		"bob":   {Name: "bob", Role: app.RoleViewer},
+	}
+	ts := httptest.NewServer(app.AuthMiddleware{Authenticator: authenticator}.Wrap(router))
+	defer ts.Close()
+
+	do := func(method, path, token, body string) (*http.Response, app.Layout) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var layout app.Layout
+		if resp.StatusCode == http.StatusOK {
+			if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&layout); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, layout
+	}
+	view := "?view=" + url.QueryEscape("pseudo=hide")
+
+	// Viewers save layouts of their own
+	if resp, _ := do("PUT", "/api/layouts/hosts"+view, "alice", `{"user": "bob", "nodes": {"host1;<host>": {"x": 10, "y": -5.5}}}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to save the layout, got %s", resp.Status)
+	}
+	if resp, _ := do("PUT", "/api/layouts/no-such-topology", "alice", `{}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected no layouts of unknown topologies, got %s", resp.Status)
+	}
+	if resp, _ := do("PUT", "/api/layouts/hosts", "", `{}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous layouts to be unauthorized, got %s", resp.Status)
+	}
+	resp, layout := do("GET", "/api/layouts/hosts"+view, "alice", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the saved layout, got %s", resp.Status)
+	}
+	equals(t, "alice", layout.User)
+	equals(t, "pseudo=hide", layout.View)
+	equals(t, map[string]app.Position{"host1;<host>": {X: 10, Y: -5.5}}, layout.Nodes)
+
+	// Other users have layouts of their own, but can get those of others
+	if resp, _ := do("GET", "/api/layouts/hosts"+view, "bob", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected bob to have no layout, got %s", resp.Status)
+	}
+	if resp, shared := do("GET", "/api/layouts/hosts"+view+"&user=alice", "bob", ""); resp.StatusCode != http.StatusOK || shared.User != "alice" {
+		t.Errorf("Expected the layout of alice, got %s, %v", resp.Status, shared)
+	}
+	if resp, _ := do("DELETE", "/api/layouts/hosts"+view, "bob", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected bob not to delete the layout of alice, got %s", resp.Status)
+	}
+
+	// Surviving restarts
+	layouts, err = app.NewLayouts(filepath.Join(dir, "layouts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved := layouts.List("alice"); len(saved) != 1 || saved[0].Nodes["host1;<host>"].X != 10 {
+		t.Errorf("Expected the saved layout, got %v", saved)
+	}
+	if ok, err := layouts.Delete("alice", "hosts", "pseudo=hide"); !ok || err != nil {
+		t.Errorf("Expected to delete the layout, got %v, %v", ok, err)
+	}
+	equals(t, 0, len(layouts.List("")))
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// MetricHistoryRanges are the ranges the history of metrics is kept for.
+// Each range is downsampled into the same number of points, so longer
+// ranges are coarser.
+var MetricHistoryRanges = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+const metricHistoryGCInterval = time.Minute
+
+// MetricHistory is a Collector which also records the metrics of the nodes
+// in the reports added to it, so that they can be looked at over longer
+// ranges than the window of reports kept by the Collector. Metrics are
+// recorded under the IDs of the nodes in the reports, so history is only
+// available for rendered nodes with report node IDs (hosts, containers,
+// processes).
+type MetricHistory struct {
+	Collector
+	points int
+
+	sync.Mutex
+	series map[metricSeriesKey]*metricSeries
+	lastGC time.Time
+}
+
+type metricSeriesKey struct {
+	nodeID, metricID string
+}
+
+// metricSeries holds a ring of points for each of the MetricHistoryRanges.
+type metricSeries struct {
+	rings []metricRing
+	last  time.Time
+}
+
+type metricRing struct {
+	resolution time.Duration
+	buckets    []metricBucket
+}
+
+// metricBucket is the sum of the samples of a metric which fell within
+// resolution of start.
+type metricBucket struct {
+	start time.Time
+	sum   float64
+	count int
+}
+
+// NewMetricHistory makes a new MetricHistory, keeping points downsampled
+// points per range of metric history.
+func NewMetricHistory(collector Collector, points int) *MetricHistory {
+	return &MetricHistory{
+		Collector: collector,
+		points:    points,
+		series:    map[metricSeriesKey]*metricSeries{},
+		lastGC:    mtime.Now(),
+	}
+}
+
+// Add implements Adder
+func (h *MetricHistory) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	h.record(rpt)
+	return h.Collector.Add(ctx, rpt, buf)
+}
+
+func (h *MetricHistory) record(rpt report.Report) {
+	h.Lock()
+	defer h.Unlock()
+	rpt.WalkTopologies(func(t *report.Topology) {
+		for nodeID, n := range t.Nodes {
+			for metricID, m := range n.Metrics {
+				key := metricSeriesKey{nodeID, metricID}
+				s, ok := h.series[key]
+				if !ok {
+					s = h.newSeries()
+					h.series[key] = s
+				}
+				s.add(m.Samples)
+			}
+		}
+	})
+
+	now := mtime.Now()
+	if now.Sub(h.lastGC) < metricHistoryGCInterval {
+		return
+	}
+	h.lastGC = now
+	oldest := now.Add(-MetricHistoryRanges[len(MetricHistoryRanges)-1])
+	for key, s := range h.series {
+		if s.last.Before(oldest) {
+			delete(h.series, key)
+		}
+	}
+}
+
+func (h *MetricHistory) newSeries() *metricSeries {
+	s := &metricSeries{}
+	for _, d := range MetricHistoryRanges {
+		s.rings = append(s.rings, metricRing{
+			resolution: d / time.Duration(h.points),
+			buckets:    make([]metricBucket, h.points),
+		})
+	}
+	return s
+}
+
+// add records samples, skipping those which have been seen already, as the
+// same samples can be in several reports.
+func (s *metricSeries) add(samples []report.Sample) {
+	for _, sample := range samples {
+		if !sample.Timestamp.After(s.last) {
+			continue
+		}
+		s.last = sample.Timestamp
+		for i := range s.rings {
+			s.rings[i].add(sample)
+		}
+	}
+}
+
+func (r *metricRing) add(sample report.Sample) {
+	start := sample.Timestamp.Truncate(r.resolution)
+	b := &r.buckets[(start.UnixNano()/int64(r.resolution))%int64(len(r.buckets))]
+	if !b.start.Equal(start) {
+		*b = metricBucket{start: start}
+	}
+	b.sum += sample.Value
+	b.count++
+}
+
+type samplesByTimestamp []report.Sample
+
+func (s samplesByTimestamp) Len() int           { return len(s) }
+func (s samplesByTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s samplesByTimestamp) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+
+// samples gives the average of every bucket since a point in time.
+func (r *metricRing) samples(since time.Time) []report.Sample {
+	samples := []report.Sample{}
+	for _, b := range r.buckets {
+		if b.count == 0 || b.start.Before(since) {
+			continue
+		}
+		samples = append(samples, report.Sample{Timestamp: b.start, Value: b.sum / float64(b.count)})
+	}
+	sort.Sort(samplesByTimestamp(samples))
+	return samples
+}
+
+// MetricHistory implements report.MetricHistory. It gives the history of a
+// metric over d, from the shortest range which covers it.
+func (h *MetricHistory) MetricHistory(nodeID, metricID string, d time.Duration) (report.Metric, bool) {
+	h.Lock()
+	defer h.Unlock()
+	s, ok := h.series[metricSeriesKey{nodeID, metricID}]
+	if !ok {
+		return report.Metric{}, false
+	}
+	i := sort.Search(len(MetricHistoryRanges), func(i int) bool { return MetricHistoryRanges[i] >= d })
+	if i == len(MetricHistoryRanges) {
+		i--
+	}
+	samples := s.rings[i].samples(mtime.Now().Add(-d))
+	if len(samples) == 0 {
+		return report.Metric{}, false
+	}
+	return report.MakeMetric(samples), true
+}
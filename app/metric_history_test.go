@@ -0,0 +1,78 @@
+package app_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestMetricHistory(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer mtime.NowReset()
+	h := app.NewMetricHistory(app.NewCollector(15*time.Second), 60)
+
+	// Two hours of reports every 15s, each with the samples of the last 30s,
+	// so that every sample is in two reports. The value of the samples is
+	// the minute they were taken in.
+	sample := func(t time.Time) report.Sample {
+		return report.Sample{Timestamp: t, Value: float64(t.Sub(start) / time.Minute)}
+	}
+	for now := start.Add(15 * time.Second); !now.After(start.Add(2 * time.Hour)); now = now.Add(15 * time.Second) {
+		mtime.NowForce(now)
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode("host1").WithMetrics(report.Metrics{
+			"load1": report.MakeMetric([]report.Sample{sample(now.Add(-15 * time.Second)), sample(now)}),
+		}))
+		if err := h.Add(ctx, rpt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The reports are still passed on to the collector
+	rpt, err := h.Report(ctx, mtime.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rpt.Host.Nodes["host1"]; !ok {
+		t.Error("Expected host1 in the collected report")
+	}
+
+	if _, ok := h.MetricHistory("host1", "cpu", time.Hour); ok {
+		t.Error("Expected no history of an unknown metric")
+	}
+
+	// An hour is kept in 60 points of 1m, each the average of the 4 samples
+	// taken in that minute. The minute which has just started has replaced
+	// the oldest one.
+	m, ok := h.MetricHistory("host1", "load1", time.Hour)
+	if !ok {
+		t.Fatal("Expected history of load1")
+	}
+	if m.Len() != 60 {
+		t.Errorf("Expected 60 points, got %d", m.Len())
+	}
+	if !m.First.Equal(start.Add(61*time.Minute)) || !m.Last.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("Unexpected range %v - %v", m.First, m.Last)
+	}
+	if m.Min != 61 || m.Max != 120 {
+		t.Errorf("Unexpected values %v - %v", m.Min, m.Max)
+	}
+
+	// 6h is kept in points of 6m, of which 21 are filled
+	m, ok = h.MetricHistory("host1", "load1", 6*time.Hour)
+	if !ok {
+		t.Fatal("Expected 6h history of load1")
+	}
+	if m.Len() != 21 {
+		t.Errorf("Expected 21 points, got %d", m.Len())
+	}
+	if want := 2.5; m.Min != want {
+		t.Errorf("Expected the first point to average %v, got %v", want, m.Min)
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"net/url"
+	"runtime/pprof"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+var (
+	reportsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "reports_received_total",
+		Help:      "Total number of reports received from probes.",
+	})
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "scope",
+		Name:      "render_duration_seconds",
+		Help:      "Time in seconds spent rendering topologies.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topology"})
+
+	topologyNodesDesc = prometheus.NewDesc(
+		"scope_topology_nodes",
+		"Number of nodes in each rendered topology.",
+		[]string{"topology"}, nil,
+	)
+	topologyEdgesDesc = prometheus.NewDesc(
+		"scope_topology_edges",
+		"Number of edges in each rendered topology.",
+		[]string{"topology"}, nil,
+	)
+	probeLastSeenDesc = prometheus.NewDesc(
+		"scope_probe_last_seen_timestamp_seconds",
+		"Time at which each probe last sent a report.",
+		[]string{"probe_id", "hostname"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(reportsReceived)
+	prometheus.MustRegister(renderDuration)
+}
+
+// renderTopology renders the topology topologyID, recording how long it took.
+// CPU profiles are labelled with the topology rendered, so that they can be
+// narrowed down to it with pprof -tagfocus topology=<id>.
+func renderTopology(topologyID string, renderer render.Renderer, decorator render.Decorator, rpt report.Report) report.Nodes {
+	defer func(begin time.Time) {
+		renderDuration.WithLabelValues(topologyID).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("topology", topologyID)))
+	defer pprof.SetGoroutineLabels(context.Background())
+	return renderer.Render(rpt, decorator)
+}
+
+// NewTopologyMetrics makes a prometheus Collector exporting the size of each
+// topology and the liveness of each probe, as found in the current report of
+// rep. The report is fetched without a user id in the context, so this is not
+// suitable for multitenant apps.
+func NewTopologyMetrics(rep Reporter) prometheus.Collector {
+	return topologyMetrics{rep}
+}
+
+type topologyMetrics struct {
+	rep Reporter
+}
+
+// Describe implements prometheus.Collector
+func (t topologyMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- topologyNodesDesc
+	ch <- topologyEdgesDesc
+	ch <- probeLastSeenDesc
+}
+
+// Collect implements prometheus.Collector
+func (t topologyMetrics) Collect(ch chan<- prometheus.Metric) {
+	rpt, err := t.rep.Report(context.Background(), time.Now())
+	if err != nil {
+		log.Errorf("Error generating report for metrics: %v", err)
+		return
+	}
+
+	collectTopology := func(id string) {
+		renderer, decorator, err := topologyRegistry.RendererForTopology(id, url.Values{}, rpt)
+		if err != nil {
+			return
+		}
+		stats := decorateWithStats(rpt, renderer, decorator)
+		ch <- prometheus.MustNewConstMetric(topologyNodesDesc, prometheus.GaugeValue, float64(stats.NodeCount), id)
+		ch <- prometheus.MustNewConstMetric(topologyEdgesDesc, prometheus.GaugeValue, float64(stats.EdgeCount), id)
+	}
+	topologyRegistry.walk(func(desc APITopologyDesc) {
+		collectTopology(desc.id)
+		for _, sub := range desc.SubTopologies {
+			collectTopology(sub.id)
+		}
+	})
+
+	for _, probe := range probeDescs(rpt, nil) {
+		ch <- prometheus.MustNewConstMetric(probeLastSeenDesc, prometheus.GaugeValue,
+			float64(probe.LastSeen.UnixNano())/1e9, probe.ID, probe.Hostname)
+	}
+}
@@ -0,0 +1,45 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestTopologyMetrics(t *testing.T) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		app.NewTopologyMetrics(app.StaticCollector(fixture.Report)).Collect(ch)
+		close(ch)
+	}()
+
+	nodes := map[string]float64{}
+	probes := 0
+	for m := range ch {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+		desc := m.Desc().String()
+		switch {
+		case strings.Contains(desc, `"scope_topology_nodes"`):
+			nodes[metric.Label[0].GetValue()] = metric.Gauge.GetValue()
+		case strings.Contains(desc, `"scope_probe_last_seen_timestamp_seconds"`):
+			probes++
+		}
+	}
+	if want, have := float64(6), nodes["processes"]; want != have {
+		t.Errorf("processes: want %v nodes, have %v", want, have)
+	}
+	if _, ok := nodes["hosts"]; !ok {
+		t.Errorf("no node count for hosts: %v", nodes)
+	}
+	if want, have := len(fixture.Report.Host.Nodes), probes; want != have {
+		t.Errorf("want %d probes, have %d", want, have)
+	}
+}
@@ -0,0 +1,301 @@
+package multitenant
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+var (
+	postgresRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "scope",
+		Name:      "postgres_request_duration_seconds",
+		Help:      "Time in seconds spent doing PostgreSQL requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status_code"})
+)
+
+func init() {
+	prometheus.MustRegister(postgresRequestDuration)
+}
+
+// postgresMigrations are applied in order, each exactly once; the index of
+// the last one applied is kept in scope_schema_version. Only ever append to
+// this list.
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS scope_reports (
+		id      BIGSERIAL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		ts      BIGINT NOT NULL,
+		report  BYTEA NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS scope_reports_user_id_ts ON scope_reports (user_id, ts)`,
+}
+
+// PostgresCollector is a Collector which can also CreateTables
+type PostgresCollector interface {
+	app.Collector
+	CreateTables() error
+	Stop()
+}
+
+// PostgresCollectorConfig has everything we need to make a PostgreSQL collector.
+type PostgresCollectorConfig struct {
+	UserIDer  UserIDer
+	DB        *sql.DB
+	Window    time.Duration
+	Retention time.Duration // Reports of all users older than this are deleted; zero keeps them forever
+}
+
+type postgresCollector struct {
+	userIDer  UserIDer
+	db        *sql.DB
+	merger    app.Merger
+	inProcess inProcessStore
+	window    time.Duration
+	retention time.Duration
+	quit      chan struct{}
+
+	// Shortcut reports can only be delivered to UIs connected to this
+	// instance, as there is nothing like NATS to fan them out.
+	waitersLock sync.Mutex
+	waiters     map[watchKey]struct{}
+}
+
+// NewPostgresCollector makes a new collector storing reports in PostgreSQL.
+func NewPostgresCollector(config PostgresCollectorConfig) PostgresCollector {
+	// (window * report rate) * number of hosts per user * number of users
+	reportCacheSize := (int(config.Window.Seconds()) / 3) * 10 * 5
+	c := &postgresCollector{
+		userIDer:  config.UserIDer,
+		db:        config.DB,
+		merger:    app.NewSmartMerger(),
+		inProcess: newInProcessStore(reportCacheSize, config.Window),
+		window:    config.Window,
+		retention: config.Retention,
+		quit:      make(chan struct{}),
+		waiters:   map[watchKey]struct{}{},
+	}
+	if c.retention > 0 {
+		go c.expireLoop()
+	}
+	return c
+}
+
+// CreateTables brings the schema up to date by applying any migrations which
+// haven't been applied yet.
+func (c *postgresCollector) CreateTables() error {
+	if _, err := c.db.Exec(`CREATE TABLE IF NOT EXISTS scope_schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialise concurrent migrations from several apps starting at once
+	if _, err := tx.Exec(`LOCK TABLE scope_schema_version IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	version := 0
+	switch err := tx.QueryRow(`SELECT version FROM scope_schema_version`).Scan(&version); err {
+	case nil:
+	case sql.ErrNoRows:
+		if _, err := tx.Exec(`INSERT INTO scope_schema_version (version) VALUES (0)`); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	for ; version < len(postgresMigrations); version++ {
+		log.Infof("Applying PostgreSQL schema migration %d", version+1)
+		if _, err := tx.Exec(postgresMigrations[version]); err != nil {
+			return fmt.Errorf("schema migration %d: %v", version+1, err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE scope_schema_version SET version = $1`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *postgresCollector) getReportIDs(ctx context.Context, userid string, start, end time.Time) ([]string, error) {
+	var ids []string
+	err := instrument.TimeRequestHistogram(ctx, "Postgres.Query", postgresRequestDuration, func(_ context.Context) error {
+		rows, err := c.db.Query(
+			`SELECT id FROM scope_reports WHERE user_id = $1 AND ts BETWEEN $2 AND $3`,
+			userid, start.UnixNano(), end.UnixNano(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		return rows.Err()
+	})
+	return ids, err
+}
+
+func (c *postgresCollector) fetchReport(ctx context.Context, id string) (*report.Report, error) {
+	var buf []byte
+	err := instrument.TimeRequestHistogram(ctx, "Postgres.Get", postgresRequestDuration, func(_ context.Context) error {
+		return c.db.QueryRow(`SELECT report FROM scope_reports WHERE id = $1`, id).Scan(&buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report.MakeFromBinary(bytes.NewReader(buf))
+}
+
+func (c *postgresCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	var (
+		end         = timestamp
+		start       = end.Add(-c.window)
+		userid, err = c.userIDer(ctx)
+	)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+
+	ids, err := c.getReportIDs(ctx, userid, start, end)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	log.Debugf("Fetching %d reports from %v to %v", len(ids), start, end)
+
+	found, missing, _ := c.inProcess.FetchReports(ctx, ids)
+	reports := make([]report.Report, 0, len(ids))
+	for _, rpt := range found {
+		reports = append(reports, rpt)
+	}
+	for _, id := range missing {
+		rpt, err := c.fetchReport(ctx, id)
+		if err == sql.ErrNoRows {
+			// Expired in the meantime
+			continue
+		} else if err != nil {
+			return report.MakeReport(), err
+		}
+		c.inProcess.StoreReport(id, *rpt)
+		reports = append(reports, *rpt)
+	}
+
+	return c.merger.Merge(reports).Upgrade(), nil
+}
+
+func (c *postgresCollector) HasHistoricReports() bool {
+	return true
+}
+
+func (c *postgresCollector) Add(ctx context.Context, rep report.Report, buf []byte) error {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = instrument.TimeRequestHistogram(ctx, "Postgres.Insert", postgresRequestDuration, func(_ context.Context) error {
+		_, err := c.db.Exec(
+			`INSERT INTO scope_reports (user_id, ts, report) VALUES ($1, $2, $3)`,
+			userid, time.Now().UnixNano(), buf,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	reportSizeHistogram.Observe(float64(len(buf)))
+
+	if rep.Shortcut {
+		c.waitersLock.Lock()
+		for key := range c.waiters {
+			if key.userid != userid {
+				continue
+			}
+			select {
+			case key.c <- struct{}{}:
+			default:
+			}
+		}
+		c.waitersLock.Unlock()
+	}
+	return nil
+}
+
+func (c *postgresCollector) WaitOn(ctx context.Context, waiter chan struct{}) {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		log.Errorf("Error getting user id in WaitOn: %v", err)
+		return
+	}
+	c.waitersLock.Lock()
+	c.waiters[watchKey{userid, waiter}] = struct{}{}
+	c.waitersLock.Unlock()
+}
+
+func (c *postgresCollector) UnWait(ctx context.Context, waiter chan struct{}) {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		log.Errorf("Error getting user id in UnWait: %v", err)
+		return
+	}
+	c.waitersLock.Lock()
+	delete(c.waiters, watchKey{userid, waiter})
+	c.waitersLock.Unlock()
+}
+
+// expireLoop deletes the reports which have fallen out of the retention period.
+func (c *postgresCollector) expireLoop() {
+	interval := c.retention / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.expire(time.Now().Add(-c.retention)); err != nil {
+				log.Errorf("Error deleting expired reports: %v", err)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// expire deletes the reports from before the given time. Retention is global:
+// the reports of every user are deleted alike.
+func (c *postgresCollector) expire(before time.Time) error {
+	return instrument.TimeRequestHistogram(context.Background(), "Postgres.Delete", postgresRequestDuration, func(_ context.Context) error {
+		result, err := c.db.Exec(`DELETE FROM scope_reports WHERE ts < $1`, before.UnixNano())
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			log.Debugf("Deleted %d reports older than %v", n, before)
+		}
+		return nil
+	})
+}
+
+func (c *postgresCollector) Stop() {
+	close(c.quit)
+}
@@ -0,0 +1,150 @@
+package multitenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func newMockPostgresCollector(t *testing.T) (*postgresCollector, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewPostgresCollector(PostgresCollectorConfig{
+		UserIDer: func(context.Context) (string, error) { return "user1", nil },
+		DB:       db,
+		Window:   15 * time.Second,
+	}).(*postgresCollector)
+	return c, mock
+}
+
+func expectMigrations(mock sqlmock.Sqlmock, from int) {
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS scope_schema_version`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE scope_schema_version`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version"})
+	if from > 0 {
+		rows.AddRow(from)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version FROM scope_schema_version`)).WillReturnRows(rows)
+	if from == 0 {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO scope_schema_version (version) VALUES (0)`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	for _, migration := range postgresMigrations[from:] {
+		mock.ExpectExec(regexp.QuoteMeta(migration)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE scope_schema_version SET version = $1`)).
+		WithArgs(len(postgresMigrations)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestPostgresCollectorCreateTables(t *testing.T) {
+	// Only the migrations which haven't been applied yet are
+	for from := 0; from <= len(postgresMigrations); from++ {
+		c, mock := newMockPostgresCollector(t)
+		expectMigrations(mock, from)
+		if err := c.CreateTables(); err != nil {
+			t.Fatalf("from version %d: %v", from, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("from version %d: %v", from, err)
+		}
+	}
+}
+
+type nanoseconds struct{}
+
+func (nanoseconds) Match(v driver.Value) bool {
+	_, ok := v.(int64)
+	return ok
+}
+
+func TestPostgresCollectorAddReport(t *testing.T) {
+	c, mock := newMockPostgresCollector(t)
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1"))
+	var buf bytes.Buffer
+	if err := rpt.WriteBinary(&buf, gzip.BestCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO scope_reports (user_id, ts, report) VALUES ($1, $2, $3)`)).
+		WithArgs("user1", nanoseconds{}, buf.Bytes()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := c.Add(context.Background(), rpt, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reports are fetched once, then served from the in-process cache
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM scope_reports WHERE user_id = $1 AND ts BETWEEN $2 AND $3`)).
+			WithArgs("user1", now.Add(-c.window).UnixNano(), now.UnixNano()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		if i == 0 {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT report FROM scope_reports WHERE id = $1`)).
+				WithArgs("1").
+				WillReturnRows(sqlmock.NewRows([]string{"report"}).AddRow(buf.Bytes()))
+		}
+		have, err := c.Report(context.Background(), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := have.Host.Nodes["host1"]; !ok {
+			t.Errorf("Expected the report added, got %v", have.Host.Nodes)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresCollectorReportExpired(t *testing.T) {
+	// Reports deleted between listing and fetching them are skipped
+	c, mock := newMockPostgresCollector(t)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM scope_reports`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT report FROM scope_reports WHERE id = $1`)).
+		WithArgs("1").
+		WillReturnError(sql.ErrNoRows)
+	have, err := c.Report(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Host.Nodes) != 0 {
+		t.Errorf("Expected an empty report, got %v", have.Host.Nodes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresCollectorExpire(t *testing.T) {
+	// Expiry is global, rather than of the user of the context
+	c, mock := newMockPostgresCollector(t)
+	before := time.Now().Add(-time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM scope_reports WHERE ts < $1`)).
+		WithArgs(before.UnixNano()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	if err := c.expire(before); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -98,3 +98,45 @@ func (store *S3Store) StoreReportBytes(ctx context.Context, key string, buf []by
 	})
 	return len(buf), err
 }
+
+// PutSnapshot stores a topology snapshot, implementing app.SnapshotStore.
+func (store *S3Store) PutSnapshot(ctx context.Context, key string, buf []byte) error {
+	return instrument.TimeRequestHistogram(ctx, "S3.Put", s3RequestDuration, func(_ context.Context) error {
+		_, err := store.s3.PutObject(&s3.PutObjectInput{
+			Body:        bytes.NewReader(buf),
+			Bucket:      aws.String(store.bucketName),
+			Key:         aws.String(key),
+			ContentType: aws.String("application/json"),
+		})
+		return err
+	})
+}
+
+// ListSnapshots lists the keys of the topology snapshots starting with a
+// prefix, implementing app.SnapshotStore.
+func (store *S3Store) ListSnapshots(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	err := instrument.TimeRequestHistogram(ctx, "S3.List", s3RequestDuration, func(_ context.Context) error {
+		return store.s3.ListObjectsPages(&s3.ListObjectsInput{
+			Bucket: aws.String(store.bucketName),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsOutput, _ bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+			return true
+		})
+	})
+	return keys, err
+}
+
+// DeleteSnapshot deletes a topology snapshot, implementing app.SnapshotStore.
+func (store *S3Store) DeleteSnapshot(ctx context.Context, key string) error {
+	return instrument.TimeRequestHistogram(ctx, "S3.Delete", s3RequestDuration, func(_ context.Context) error {
+		_, err := store.s3.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(store.bucketName),
+			Key:    aws.String(key),
+		})
+		return err
+	})
+}
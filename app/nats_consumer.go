@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bytes"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nats-io/nats"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// NATSConsumer adds the reports probes publish on a NATS subject to a
+// collector. Apps in the same queue group share the reports between them,
+// each report going to one of them; apps in none get all the reports.
+// Reports are acknowledged to the probes publishing them once added.
+type NATSConsumer struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// NewNATSConsumer connects to the NATS server at url, to add the reports
+// published on subject to adder.
+func NewNATSConsumer(adder Adder, url, subject, queue string) (*NATSConsumer, error) {
+	conn, err := nats.Connect(url, nats.Name("scope-app-"+UniqueID), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	handler := func(m *nats.Msg) {
+		// Reports are acknowledged once handled, for probes to keep them
+		// until then; only those the app failed to add are published again.
+		ack := func() {
+			if m.Reply != "" {
+				if err := conn.Publish(m.Reply, nil); err != nil {
+					log.Errorf("Error acknowledging report on NATS: %v", err)
+				}
+			}
+		}
+		var msg xfer.ReportMessage
+		if err := codec.NewDecoderBytes(m.Data, &codec.MsgpackHandle{}).Decode(&msg); err != nil {
+			log.Errorf("Error decoding report message from NATS: %v", err)
+			ack()
+			return
+		}
+		if err := report.CheckSchemaVersion(msg.SchemaVersion); err != nil {
+			log.Errorf("Rejected report of probe %s from NATS: %v", msg.ProbeID, err)
+			ack()
+			return
+		}
+		summer := xfer.NewReportChecksummer(bytes.NewReader(msg.Report))
+		var rpt report.Report
+		if err := rpt.ReadBinary(summer, true, &codec.MsgpackHandle{}); err != nil {
+			log.Errorf("Error decoding report of probe %s from NATS: %v", msg.ProbeID, err)
+			ack()
+			return
+		}
+		if err := summer.Verify(msg.Checksum); err != nil {
+			log.Errorf("Rejected report of probe %s from NATS: %v", msg.ProbeID, err)
+			ack()
+			return
+		}
+		if err := adder.Add(context.Background(), rpt, msg.Report); err != nil {
+			log.Errorf("Error Adding report: %v", err)
+			return
+		}
+		reportsReceived.Inc()
+		ack()
+	}
+	var sub *nats.Subscription
+	if queue != "" {
+		sub, err = conn.QueueSubscribe(subject, queue, handler)
+	} else {
+		sub, err = conn.Subscribe(subject, handler)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATSConsumer{conn: conn, sub: sub}, nil
+}
+
+// Stop consuming reports.
+func (c *NATSConsumer) Stop() {
+	c.sub.Unsubscribe()
+	c.conn.Close()
+}
@@ -0,0 +1,60 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/gnatsd/server"
+	natsTest "github.com/nats-io/gnatsd/test"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestNATSConsumer(t *testing.T) {
+	opts := natsTest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	s := natsTest.RunServer(&opts)
+	defer s.Shutdown()
+	url := fmt.Sprintf("nats://%s", s.Addr())
+
+	collector := app.NewCollector(time.Minute)
+	consumer, err := app.NewNATSConsumer(collector, url, xfer.DefaultReportSubject, "scope-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Stop()
+
+	publisher, err := appclient.NewNATSPublisher(url, xfer.DefaultReportSubject, "probe1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith("host1", map[string]string{report.ControlProbeID: "probe1"}))
+	buf := &bytes.Buffer{}
+	rpt.WriteBinary(buf, gzip.DefaultCompression)
+	if err := publisher.Publish(buf, false); err != nil {
+		t.Fatal(err)
+	}
+	publisher.Stop()
+
+	for i := 0; ; i++ {
+		have, err := collector.Report(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := have.Host.Nodes["host1"]; ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Expected the report published on NATS to be collected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,341 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// defaultPolicyWindowStep is how far apart the reports merged over the
+	// window of observed traffic are, the default window of the app.
+	defaultPolicyWindowStep = 15 * time.Second
+	// maxPolicyWindowReports is how many reports can be merged.
+	maxPolicyWindowReports = 240
+
+	// namespaceNameLabel is the label Kubernetes gives namespaces of their
+	// name, to select other namespaces by.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// policyIgnoredLabels are labels of pods which differ between the replicas
+// of a workload, so make no sense in selectors.
+var policyIgnoredLabels = map[string]struct{}{
+	"pod-template-hash":                  {},
+	"controller-revision-hash":           {},
+	"pod-template-generation":            {},
+	"statefulset.kubernetes.io/pod-name": {},
+}
+
+// The parts of Kubernetes NetworkPolicies which are suggested.
+type (
+	// NetworkPolicy is a suggested networking.k8s.io/v1 NetworkPolicy.
+	NetworkPolicy struct {
+		APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+		Kind       string            `json:"kind" yaml:"kind"`
+		Metadata   PolicyMetadata    `json:"metadata" yaml:"metadata"`
+		Spec       NetworkPolicySpec `json:"spec" yaml:"spec"`
+	}
+
+	// PolicyMetadata is the metadata of a NetworkPolicy.
+	PolicyMetadata struct {
+		Name      string `json:"name" yaml:"name"`
+		Namespace string `json:"namespace" yaml:"namespace"`
+	}
+
+	// NetworkPolicySpec only allows ingress to the pods it selects.
+	NetworkPolicySpec struct {
+		PodSelector LabelSelector       `json:"podSelector" yaml:"podSelector"`
+		PolicyTypes []string            `json:"policyTypes" yaml:"policyTypes"`
+		Ingress     []PolicyIngressRule `json:"ingress" yaml:"ingress"`
+	}
+
+	// LabelSelector selects by labels.
+	LabelSelector struct {
+		MatchLabels map[string]string `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	}
+
+	// PolicyIngressRule allows ingress from peers, on ports.
+	PolicyIngressRule struct {
+		From  []PolicyPeer `json:"from" yaml:"from"`
+		Ports []PolicyPort `json:"ports" yaml:"ports"`
+	}
+
+	// PolicyPeer is pods, of other namespaces with a namespace selector.
+	PolicyPeer struct {
+		PodSelector       LabelSelector  `json:"podSelector" yaml:"podSelector"`
+		NamespaceSelector *LabelSelector `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+	}
+
+	// PolicyPort is a port, and its protocol.
+	PolicyPort struct {
+		Protocol string `json:"protocol" yaml:"protocol"`
+		Port     int    `json:"port" yaml:"port"`
+	}
+)
+
+// APINetworkPolicies is returned by the /api/networkpolicies handler. Pods
+// without labels to select them by are skipped, by their namespace and
+// name.
+type APINetworkPolicies struct {
+	Policies []NetworkPolicy `json:"policies"`
+	Skipped  []string        `json:"skipped,omitempty"`
+}
+
+// podGroup is the pods of a namespace with the same labels, like the
+// replicas of a deployment.
+type podGroup struct {
+	namespace string
+	labels    map[string]string
+}
+
+func (g podGroup) key() string {
+	keys := make([]string, 0, len(g.labels))
+	for k := range g.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	b.WriteString(g.namespace)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", k, g.labels[k])
+	}
+	return b.String()
+}
+
+// policyName gives a name of a policy for the group, from the values of
+// its labels.
+func (g podGroup) policyName() string {
+	keys := make([]string, 0, len(g.labels))
+	for k := range g.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, g.labels[k])
+	}
+	return dnsLabel("allow-" + strings.Join(values, "-"))
+}
+
+var notDNSLabel = regexp.MustCompile("[^a-z0-9-]+")
+
+// dnsLabel makes s a valid name of Kubernetes objects, which are DNS labels.
+func dnsLabel(s string) string {
+	s = notDNSLabel.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-")
+}
+
+func podGroupOf(n report.Node) (podGroup, bool) {
+	namespace, _ := n.Latest.Lookup(kubernetes.Namespace)
+	g := podGroup{namespace: namespace, labels: map[string]string{}}
+	n.Latest.ForEach(func(key string, _ time.Time, value string) {
+		if label, ok := report.WithoutPrefix(key, kubernetes.LabelPrefix); ok {
+			if _, ignored := policyIgnoredLabels[label]; !ignored {
+				g.labels[label] = value
+			}
+		}
+	})
+	return g, len(g.labels) > 0
+}
+
+// MakeNetworkPolicies suggests NetworkPolicies allowing the traffic between
+// the pods of a report, and nothing else: a policy for each group of pods
+// connected to, with an ingress rule for each group connecting to them, on
+// the ports they did. Only pod-to-pod traffic is allowed, and only for the
+// pods of namespace, if given.
+func MakeNetworkPolicies(rc report.RenderContext, namespace string) APINetworkPolicies {
+	pods := render.PodRenderer.Render(rc.Report, nil)
+	groups := map[string]podGroup{}
+	skipped := map[string]struct{}{}
+	groupOf := func(id string) (podGroup, bool) {
+		n, ok := pods[id]
+		if !ok || n.Topology != report.Pod {
+			return podGroup{}, false
+		}
+		g, ok := podGroupOf(n)
+		if !ok {
+			ns, _ := n.Latest.Lookup(kubernetes.Namespace)
+			name, _ := n.Latest.Lookup(kubernetes.Name)
+			skipped[ns+"/"+name] = struct{}{}
+		}
+		return g, ok
+	}
+
+	// ports ingress is allowed on, by the key of the group of pods
+	// connected to, then of the group connecting
+	allowed := map[string]map[string]map[PolicyPort]struct{}{}
+	for _, deps := range detailed.MakeDependencies(rc, pods) {
+		from, ok := groupOf(deps.ID)
+		if !ok {
+			continue
+		}
+		for _, dep := range deps.Dependencies {
+			to, ok := groupOf(dep.ID)
+			if !ok || (namespace != "" && to.namespace != namespace) {
+				continue
+			}
+			groups[to.key()], groups[from.key()] = to, from
+			if allowed[to.key()] == nil {
+				allowed[to.key()] = map[string]map[PolicyPort]struct{}{}
+			}
+			ports := allowed[to.key()][from.key()]
+			if ports == nil {
+				ports = map[PolicyPort]struct{}{}
+				allowed[to.key()][from.key()] = ports
+			}
+			for _, port := range dep.Ports {
+				ports[PolicyPort{Protocol: strings.ToUpper(port.Transport), Port: port.Port}] = struct{}{}
+			}
+		}
+	}
+
+	result := APINetworkPolicies{Policies: []NetworkPolicy{}}
+	names := map[string]struct{}{}
+	toKeys := make([]string, 0, len(allowed))
+	for key := range allowed {
+		toKeys = append(toKeys, key)
+	}
+	sort.Strings(toKeys)
+	for _, toKey := range toKeys {
+		to := groups[toKey]
+		name := to.policyName()
+		for i := 2; ; i++ {
+			if _, ok := names[to.namespace+"/"+name]; !ok {
+				break
+			}
+			suffix := strconv.Itoa(i)
+			name = fmt.Sprintf("%.*s-%s", 62-len(suffix), to.policyName(), suffix)
+		}
+		names[to.namespace+"/"+name] = struct{}{}
+		policy := NetworkPolicy{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "NetworkPolicy",
+			Metadata:   PolicyMetadata{Name: name, Namespace: to.namespace},
+			Spec: NetworkPolicySpec{
+				PodSelector: LabelSelector{MatchLabels: to.labels},
+				PolicyTypes: []string{"Ingress"},
+				Ingress:     []PolicyIngressRule{},
+			},
+		}
+		fromKeys := make([]string, 0, len(allowed[toKey]))
+		for key := range allowed[toKey] {
+			fromKeys = append(fromKeys, key)
+		}
+		sort.Strings(fromKeys)
+		for _, fromKey := range fromKeys {
+			from := groups[fromKey]
+			peer := PolicyPeer{PodSelector: LabelSelector{MatchLabels: from.labels}}
+			if from.namespace != to.namespace {
+				peer.NamespaceSelector = &LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: from.namespace}}
+			}
+			rule := PolicyIngressRule{From: []PolicyPeer{peer}}
+			for port := range allowed[toKey][fromKey] {
+				rule.Ports = append(rule.Ports, port)
+			}
+			sort.Slice(rule.Ports, func(i, j int) bool {
+				if rule.Ports[i].Port != rule.Ports[j].Port {
+					return rule.Ports[i].Port < rule.Ports[j].Port
+				}
+				return rule.Ports[i].Protocol < rule.Ports[j].Protocol
+			})
+			policy.Spec.Ingress = append(policy.Spec.Ingress, rule)
+		}
+		result.Policies = append(result.Policies, policy)
+	}
+	for pod := range skipped {
+		result.Skipped = append(result.Skipped, pod)
+	}
+	sort.Strings(result.Skipped)
+	return result
+}
+
+// windowReport merges the reports over the window up to a timestamp, step
+// apart. Without historic reports, it is only the current one.
+func windowReport(ctx context.Context, rep Reporter, to time.Time, window, step time.Duration) (report.Report, error) {
+	if window <= 0 || !rep.HasHistoricReports() {
+		return rep.Report(ctx, to)
+	}
+	reports := []report.Report{}
+	for ts := to; to.Sub(ts) < window; ts = ts.Add(-step) {
+		rpt, err := rep.Report(ctx, ts)
+		if err != nil {
+			return report.Report{}, err
+		}
+		reports = append(reports, rpt)
+	}
+	return NewSmartMerger().Merge(reports), nil
+}
+
+// NetworkPolicies suggested from the traffic between pods observed over the
+// window parameter up to the timestamp one, for review before applying
+// them. They are YAML manifests, with the skipped pods in comments, unless
+// format is json.
+func handleNetworkPolicies(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	format := r.Form.Get("format")
+	if format != "" && format != "json" && format != "yaml" {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("Unknown network policies format: %q", format))
+		return
+	}
+	var window time.Duration
+	step := defaultPolicyWindowStep
+	for param, d := range map[string]*time.Duration{"window": &window, "step": &step} {
+		if v := r.Form.Get(param); v != "" {
+			var err error
+			if *d, err = time.ParseDuration(v); err != nil || *d <= 0 {
+				respondWith(w, http.StatusBadRequest, fmt.Errorf("Invalid %s: %q", param, v))
+				return
+			}
+		}
+	}
+	if window/step >= maxPolicyWindowReports {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("Window %v of more than %d reports %v apart", window, maxPolicyWindowReports, step))
+		return
+	}
+	rpt, err := windowReport(ctx, rep, deserializeTimestamp(r.Form.Get("timestamp")), window, step)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	policies := MakeNetworkPolicies(RenderContextForReporter(rep, rpt), r.Form.Get("namespace"))
+	if format == "json" {
+		respondWith(w, http.StatusOK, policies)
+		return
+	}
+
+	var b bytes.Buffer
+	for _, pod := range policies.Skipped {
+		fmt.Fprintf(&b, "# Skipped %s, without labels to select it by\n", pod)
+	}
+	for _, policy := range policies.Policies {
+		buf, err := yaml.Marshal(policy)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		b.WriteString("---\n")
+		b.Write(buf)
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	b.WriteTo(w)
+}
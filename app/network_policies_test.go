@@ -0,0 +1,77 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestMakeNetworkPolicies(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	rpt.Pod.Nodes[fixture.ClientPodNodeID] = rpt.Pod.Nodes[fixture.ClientPodNodeID].WithLatests(map[string]string{
+		kubernetes.LabelPrefix + "app":               "pong-a",
+		kubernetes.LabelPrefix + "pod-template-hash": "5d8f",
+	})
+	rpt.Pod.Nodes[fixture.ServerPodNodeID] = rpt.Pod.Nodes[fixture.ServerPodNodeID].WithLatests(map[string]string{
+		kubernetes.LabelPrefix + "app":  "pong-b",
+		kubernetes.LabelPrefix + "tier": "Backend",
+	})
+
+	have := app.MakeNetworkPolicies(report.RenderContext{Report: rpt}, "")
+	equals(t, app.APINetworkPolicies{Policies: []app.NetworkPolicy{{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   app.PolicyMetadata{Name: "allow-pong-b-backend", Namespace: fixture.KubernetesNamespace},
+		Spec: app.NetworkPolicySpec{
+			PodSelector: app.LabelSelector{MatchLabels: map[string]string{"app": "pong-b", "tier": "Backend"}},
+			PolicyTypes: []string{"Ingress"},
+			Ingress: []app.PolicyIngressRule{{
+				From:  []app.PolicyPeer{{PodSelector: app.LabelSelector{MatchLabels: map[string]string{"app": "pong-a"}}}},
+				Ports: []app.PolicyPort{{Protocol: "TCP", Port: 80}},
+			}},
+		},
+	}}}, have)
+
+	equals(t, 0, len(app.MakeNetworkPolicies(report.RenderContext{Report: rpt}, "other").Policies))
+
+	// Pods without labels can't be selected
+	have = app.MakeNetworkPolicies(report.RenderContext{Report: fixture.Report}, "")
+	equals(t, 0, len(have.Policies))
+	equals(t, []string{fixture.KubernetesNamespace + "/pong-a", fixture.KubernetesNamespace + "/pong-b"}, have.Skipped)
+}
+
+func TestAPINetworkPolicies(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	for id, app := range map[string]string{fixture.ClientPodNodeID: "pong-a", fixture.ServerPodNodeID: "pong-b"} {
+		rpt.Pod.Nodes[id] = rpt.Pod.Nodes[id].WithLatest(kubernetes.LabelPrefix+"app", fixture.Now, app)
+	}
+	router := mux.NewRouter()
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var policies app.APINetworkPolicies
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/networkpolicies?format=json"), &codec.JsonHandle{}).Decode(&policies); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(policies.Policies))
+
+	res, body := checkGet(t, ts, "/api/networkpolicies?window=1m")
+	equals(t, "application/x-yaml", res.Header.Get("Content-Type"))
+	var policy app.NetworkPolicy
+	if err := yaml.Unmarshal(body, &policy); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, policies.Policies[0], policy)
+
+	is400(t, ts, "/api/networkpolicies?window=-1m")
+	is400(t, ts, "/api/networkpolicies?window=24h&step=1s")
+}
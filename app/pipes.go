@@ -1,7 +1,12 @@
 package app
 
 import (
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -17,6 +22,16 @@ func RegisterPipeRoutes(router *mux.Router, pr PipeRouter) {
 		Path("/api/pipe/{pipeID}/check").
 		HandlerFunc(requestContextDecorator(checkPipe(pr)))
 
+	router.Methods("GET").
+		Name("api_pipe_pipeid_flamegraph").
+		Path("/api/pipe/{pipeID}/flamegraph").
+		HandlerFunc(requestContextDecorator(handlePipeFlameGraph(pr)))
+
+	router.Methods("GET").
+		Name("api_pipe_pipeid_download").
+		Path("/api/pipe/{pipeID}/download").
+		HandlerFunc(requestContextDecorator(handlePipeDownload(pr)))
+
 	router.Methods("GET").
 		Name("api_pipe_pipeid").
 		Path("/api/pipe/{pipeID}").
@@ -47,6 +62,36 @@ func checkPipe(pr PipeRouter) CtxHandlerFunc {
 	}
 }
 
+// handlePipeDownload responds with what is read from a pipe until it is
+// closed, as a file to download, such as the pcap of a packet capture. The
+// filename parameter names the file.
+func handlePipeDownload(pr PipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["pipeID"]
+		_, endIO, err := pr.Get(ctx, id, UIEnd)
+		if err != nil {
+			log.Debugf("Error getting pipe %s: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+		defer pr.Release(ctx, id, UIEnd)
+
+		filename := strings.Trim(path.Base(r.FormValue("filename")), `."/`)
+		if filename == "" {
+			filename = id
+		}
+		contentType := mime.TypeByExtension(path.Ext(filename))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if _, err := io.Copy(w, endIO); err != nil && err != io.ErrClosedPipe {
+			log.Debugf("Error downloading pipe %s: %v", id, err)
+		}
+	}
+}
+
 func handlePipeWs(pr PipeRouter, end End) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["pipeID"]
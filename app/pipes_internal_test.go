@@ -141,3 +141,68 @@ func TestPipeClose(t *testing.T) {
 		return pipe.Closed()
 	})
 }
+
+func TestPipeControls(t *testing.T) {
+	router := mux.NewRouter()
+	pr := NewLocalPipeRouter()
+	RegisterPipeRoutes(router, pr)
+	defer pr.Stop()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ip, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := url.URL{Scheme: "http", Host: ip + ":" + port}
+	client, err := appclient.NewAppClient(appclient.ProbeConfig{ProbeID: "foo"}, ip+":"+port, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	pipeID, pipe, err := controls.NewPipe(adapter{client}, "appid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+	received := make(chan xfer.PipeControl, 1)
+	pipe.OnControl(func(control xfer.PipeControl) {
+		received <- control
+	})
+
+	pipeURL := fmt.Sprintf("ws://%s:%s/api/pipe/%s", ip, port, pipeID)
+	conn, _, err := websocket.DefaultDialer.Dial(pipeURL, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Controls go from conn -> app -> probe, out of band
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"pipe_control":"resize","height":40,"width":120}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case control := <-received:
+		if want := (xfer.PipeControl{Type: xfer.ResizePipeControl, Height: 40, Width: 120}); control != want {
+			t.Fatalf("%v != %v", control, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("control not received")
+	}
+
+	// and other text messages are data
+	msg := []byte(`{"pipe_control": "not really"}`)
+	if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	local, _ := pipe.Ends()
+	buf := make([]byte, 1024)
+	if n, err := local.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(msg, buf[:n]) {
+		t.Fatalf("%s != %s", buf[:n], msg)
+	}
+}
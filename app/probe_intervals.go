@@ -0,0 +1,80 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// ProbeIntervals is a Collector which asks the probes it receives reports
+// from to use the given spy and publish intervals, over their control
+// connections. Each probe is asked once, when its first report arrives.
+type ProbeIntervals struct {
+	Collector
+	controlRouter ControlRouter
+	args          map[string]string
+
+	sync.Mutex
+	probes map[string]struct{} // probe IDs asked, or being asked
+}
+
+// NewProbeIntervals makes a new ProbeIntervals. Zero intervals are left to
+// the probes.
+func NewProbeIntervals(collector Collector, controlRouter ControlRouter, spyInterval, publishInterval time.Duration) *ProbeIntervals {
+	args := map[string]string{}
+	if spyInterval > 0 {
+		args["spy_interval"] = spyInterval.String()
+	}
+	if publishInterval > 0 {
+		args["publish_interval"] = publishInterval.String()
+	}
+	return &ProbeIntervals{
+		Collector:     collector,
+		controlRouter: controlRouter,
+		args:          args,
+		probes:        map[string]struct{}{},
+	}
+}
+
+// Add implements Adder
+func (p *ProbeIntervals) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	p.Lock()
+	for nodeID, node := range rpt.Host.Nodes {
+		probeID, ok := node.Latest.Lookup(report.ControlProbeID)
+		if !ok {
+			continue
+		}
+		if _, ok := p.probes[probeID]; ok {
+			continue
+		}
+		p.probes[probeID] = struct{}{}
+		go p.setIntervals(probeID, nodeID)
+	}
+	p.Unlock()
+	return p.Collector.Add(ctx, rpt, buf)
+}
+
+func (p *ProbeIntervals) setIntervals(probeID, nodeID string) {
+	res, err := p.controlRouter.Handle(context.Background(), probeID, xfer.Request{
+		NodeID:      nodeID,
+		Control:     xfer.SetProbeIntervalsControl,
+		ControlArgs: p.args,
+	})
+	if err != nil {
+		// Try again with the next report
+		log.Warnf("Error setting the intervals of probe %s: %v", probeID, err)
+		p.Lock()
+		delete(p.probes, probeID)
+		p.Unlock()
+		return
+	}
+	if res.Error != "" {
+		// Most likely an older probe, without the control.
+		log.Warnf("Probe %s did not set its intervals: %s", probeID, res.Error)
+	}
+}
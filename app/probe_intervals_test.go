@@ -0,0 +1,53 @@
+package app_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestProbeIntervals(t *testing.T) {
+	ctx := context.Background()
+	cr := app.NewLocalControlRouter()
+
+	var (
+		mtx      sync.Mutex
+		requests []xfer.Request
+	)
+	if _, err := cr.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests = append(requests, req)
+		return xfer.Response{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := app.NewProbeIntervals(app.NewCollector(15*time.Second), cr, 0, 10*time.Second)
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith("host1;<host>", map[string]string{report.ControlProbeID: "probe1"}))
+	// The probe is only asked once
+	for i := 0; i < 3; i++ {
+		if err := p.Add(ctx, rpt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []xfer.Request{{
+		NodeID:      "host1;<host>",
+		Control:     xfer.SetProbeIntervalsControl,
+		ControlArgs: map[string]string{"publish_interval": "10s"},
+	}}
+	test.Poll(t, 100*time.Millisecond, want, func() interface{} {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return append([]xfer.Request{}, requests...)
+	})
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// rateLimitWindow is how long probes can save their allowance up for, so
+// they can publish in bursts.
+const rateLimitWindow = 10 * time.Second
+
+var reportsRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "scope",
+	Name:      "reports_rate_limited_total",
+	Help:      "Total number of reports refused for their probe publishing too much.",
+})
+
+func init() {
+	prometheus.MustRegister(reportsRateLimited)
+}
+
+// bucket is a token bucket, which can go into debt: a report bigger than
+// the bucket is let through when it is full, and the probe then waits for
+// as long as its report was over.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill the bucket at rate, up to a window's worth of tokens.
+func (b *bucket) refill(now time.Time, rate float64) {
+	b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*rate, rate*rateLimitWindow.Seconds())
+	b.last = now
+}
+
+// wait gives how long until the bucket has tokens, or 0 if it has.
+func (b *bucket) wait(rate float64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+type probeBuckets struct {
+	reports, bytes bucket
+}
+
+// ReportRateLimiter limits how many reports, and bytes of them, each probe
+// publishes per second. Reports over the limits are refused with 429 Too
+// Many Requests, with a Retry-After for when the probe can publish again.
+// Zero rates are unlimited.
+type ReportRateLimiter struct {
+	ReportsPerSecond float64
+	BytesPerSecond   float64
+
+	mtx       sync.Mutex
+	probes    map[string]*probeBuckets
+	lastPrune time.Time
+}
+
+// NewReportRateLimiter makes a new ReportRateLimiter.
+func NewReportRateLimiter(reportsPerSecond, bytesPerSecond float64) *ReportRateLimiter {
+	return &ReportRateLimiter{
+		ReportsPerSecond: reportsPerSecond,
+		BytesPerSecond:   bytesPerSecond,
+		probes:           map[string]*probeBuckets{},
+	}
+}
+
+// buckets gives the buckets of a probe, refilled to now, with the lock held.
+func (l *ReportRateLimiter) buckets(probe string, now time.Time) *probeBuckets {
+	if now.Sub(l.lastPrune) > rateLimitWindow {
+		// Probes get new IDs when they restart, so forget the ones which
+		// have been quiet for long enough to have full buckets anyway.
+		for id, b := range l.probes {
+			if now.Sub(b.reports.last) > rateLimitWindow && now.Sub(b.bytes.last) > rateLimitWindow {
+				delete(l.probes, id)
+			}
+		}
+		l.lastPrune = now
+	}
+	b, ok := l.probes[probe]
+	if !ok {
+		b = &probeBuckets{
+			reports: bucket{tokens: l.ReportsPerSecond * rateLimitWindow.Seconds(), last: now},
+			bytes:   bucket{tokens: l.BytesPerSecond * rateLimitWindow.Seconds(), last: now},
+		}
+		l.probes[probe] = b
+	}
+	b.reports.refill(now, l.ReportsPerSecond)
+	b.bytes.refill(now, l.BytesPerSecond)
+	return b
+}
+
+// Admit a report of probe, or give how long it has to wait before
+// publishing another one.
+func (l *ReportRateLimiter) Admit(probe string) (time.Duration, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	b := l.buckets(probe, mtime.Now())
+	var wait time.Duration
+	if l.ReportsPerSecond > 0 {
+		wait = b.reports.wait(l.ReportsPerSecond)
+	}
+	if l.BytesPerSecond > 0 {
+		if w := b.bytes.wait(l.BytesPerSecond); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	b.reports.tokens--
+	return 0, true
+}
+
+// Charge probe for the bytes of the report it published.
+func (l *ReportRateLimiter) Charge(probe string, bytes int64) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.buckets(probe, mtime.Now()).bytes.tokens -= float64(bytes)
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// requestProbe gives who published a report: its probe, or its address for
+// reports without a probe ID.
+func requestProbe(r *http.Request) string {
+	if id := r.Header.Get(xfer.ScopeProbeIDHeader); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Wrap implements middleware.Interface. Only the reports probes publish
+// are limited, not the ones the apps of a sharded cluster forward between
+// them, which were already. With a limit on bytes, reports of more than
+// a window's worth of them are refused with 413 Request Entity Too Large,
+// so that no probe can go any further into debt.
+func (l *ReportRateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/report" || shardPeer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		probe := requestProbe(r)
+		if wait, ok := l.Admit(probe); !ok {
+			reportsRateLimited.Inc()
+			seconds := int(math.Ceil(wait.Seconds()))
+			log.Debugf("Rate limiting probe %s for %ds", probe, seconds)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		if l.BytesPerSecond > 0 {
+			limit := int64(l.BytesPerSecond * rateLimitWindow.Seconds())
+			buf, err := ioutil.ReadAll(http.MaxBytesReader(w, body, limit))
+			l.Charge(probe, body.count)
+			if err != nil {
+				if body.count > limit {
+					reportsRateLimited.Inc()
+					http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(buf))
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = body
+		next.ServeHTTP(w, r)
+		l.Charge(probe, body.count)
+	})
+}
@@ -0,0 +1,96 @@
+package app_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func TestReportRateLimiter(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	// Probes can save up 10s of reports
+	l := app.NewReportRateLimiter(1, 0)
+	for i := 0; i < 10; i++ {
+		if _, ok := l.Admit("probe1"); !ok {
+			t.Fatalf("Expected report %d to be admitted", i)
+		}
+	}
+	if wait, ok := l.Admit("probe1"); ok || wait != time.Second {
+		t.Errorf("Expected to wait a second, got %v, %v", wait, ok)
+	}
+	if _, ok := l.Admit("probe2"); !ok {
+		t.Error("Expected other probes not to be limited")
+	}
+	mtime.NowForce(now.Add(time.Second))
+	if _, ok := l.Admit("probe1"); !ok {
+		t.Error("Expected a report to be admitted after waiting")
+	}
+
+	// Big reports are let through, and then waited for
+	l = app.NewReportRateLimiter(0, 100)
+	l.Charge("probe1", 3000)
+	if wait, ok := l.Admit("probe1"); ok || wait != 20*time.Second+10*time.Millisecond {
+		t.Errorf("Expected to wait for the report to be paid back, got %v, %v", wait, ok)
+	}
+}
+
+func TestReportRateLimiterWrap(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	// Probes can save up a window of 10s worth of bytes, 1000 bytes
+	sharding := app.NewSharding(app.NewCollector(time.Minute), "http://self", "token1", nil, time.Hour)
+	defer sharding.Stop()
+	limiter := app.NewReportRateLimiter(0, 100).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+	}))
+	handler := sharding.Wrap(limiter)
+	post := func(probe, path string, body []byte, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set(xfer.ScopeProbeIDHeader, probe)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	if w := post("probe1", "/api/report", make([]byte, 1000), nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first report to be taken, got %d", w.Code)
+	}
+	w := post("probe1", "/api/report", []byte("{}"), nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected to be asked to retry after 1s, got %d after %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	forwarded := http.Header{app.ShardForwardedHeader: {"http://other"}, app.ShardTokenHeader: {"token1"}}
+	if w := post("probe1", "/api/report", []byte("{}"), forwarded); w.Code != http.StatusOK {
+		t.Errorf("Expected forwarded reports not to be limited, got %d", w.Code)
+	}
+	forged := httptest.NewRequest("POST", "/api/report", bytes.NewReader([]byte("{}")))
+	forged.Header.Set(xfer.ScopeProbeIDHeader, "probe1")
+	forged.Header.Set(app.ShardForwardedHeader, "http://other")
+	w = httptest.NewRecorder()
+	limiter.ServeHTTP(w, forged)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected reports claiming to be forwarded by no app to be limited, got %d", w.Code)
+	}
+	if w := post("probe1", "/api/control/probe1/node/control", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected other requests not to be limited, got %d", w.Code)
+	}
+
+	// Reports over a window's worth of bytes are refused outright
+	if w := post("probe2", "/api/report", make([]byte, 1001), nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a report too big to be refused, got %d", w.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render"
+)
+
+var renderStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "scope",
+	Name:      "render_stage_duration_seconds",
+	Help:      "Time in seconds spent in each map, filter and reduce stage of rendering topologies, excluding the stages they read from.",
+	Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+}, []string{"stage"})
+
+func init() {
+	prometheus.MustRegister(renderStageDuration)
+}
+
+// RenderStageStats is how long a stage of rendering a topology took.
+type RenderStageStats struct {
+	Stage   string  `json:"stage"`
+	Calls   int     `json:"calls"`
+	Seconds float64 `json:"seconds"`
+	Nodes   int     `json:"nodes"`
+}
+
+// RenderStats is how long rendering a topology took, stage by stage, slowest
+// first.
+type RenderStats struct {
+	Topology string             `json:"topology"`
+	Seconds  float64            `json:"seconds"`
+	Nodes    int                `json:"nodes"`
+	Stages   []RenderStageStats `json:"stages"`
+}
+
+// APIRenderStats is returned by /debug/render-stats.
+type APIRenderStats struct {
+	Topologies []RenderStats `json:"topologies"`
+}
+
+// RegisterRenderStatsRoutes registers /debug/render-stats, which renders the
+// topologies afresh to break down how long each stage of them takes, and
+// exports the durations of the stages of all renders to prometheus. Stages
+// are only timed once this is called.
+func RegisterRenderStatsRoutes(router *mux.Router, r Reporter) {
+	render.SetStageObserver(func(stage string, d time.Duration, _ int) {
+		renderStageDuration.WithLabelValues(stage).Observe(d.Seconds())
+	})
+	router.Methods("GET").Path("/debug/render-stats").
+		HandlerFunc(requestContextDecorator(captureReporter(r, handleRenderStats)))
+}
+
+// renderStatsTopologies are the IDs of the topologies and sub-topologies of
+// the registry, sorted.
+func (r *Registry) renderStatsTopologies() []string {
+	r.RLock()
+	defer r.RUnlock()
+	ids := make([]string, 0, len(r.items))
+	for id := range r.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func handleRenderStats(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	topologyIDs := topologyRegistry.renderStatsTopologies()
+	if topologyID := r.Form.Get("topology"); topologyID != "" {
+		if _, ok := topologyRegistry.get(topologyID); !ok {
+			respondWith(w, http.StatusNotFound, fmt.Errorf("Unknown topology: %q", topologyID))
+			return
+		}
+		topologyIDs = []string{topologyID}
+	}
+	rpt, err := rep.Report(ctx, deserializeTimestamp(r.Form.Get("timestamp")))
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := APIRenderStats{Topologies: []RenderStats{}}
+	for _, topologyID := range topologyIDs {
+		renderer, decorator, err := topologyRegistry.RendererForTopology(topologyID, r.Form, rpt)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		nodes, stages, total := render.TimeStages(rpt, renderer, decorator)
+		stats := RenderStats{
+			Topology: topologyID,
+			Seconds:  total.Seconds(),
+			Nodes:    len(nodes),
+			Stages:   make([]RenderStageStats, 0, len(stages)),
+		}
+		for _, stage := range stages {
+			stats.Stages = append(stats.Stages, RenderStageStats{
+				Stage:   stage.Stage,
+				Calls:   stage.Calls,
+				Seconds: stage.Duration.Seconds(),
+				Nodes:   stage.Nodes,
+			})
+		}
+		result.Topologies = append(result.Topologies, stats)
+	}
+	respondWith(w, http.StatusOK, result)
+}
@@ -0,0 +1,56 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestRenderStats(t *testing.T) {
+	router := mux.NewRouter()
+	app.RegisterRenderStatsRoutes(router, app.StaticCollector(fixture.Report))
+	defer render.SetStageObserver(nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var stats app.APIRenderStats
+	if err := json.Unmarshal(getRawJSON(t, ts, "/debug/render-stats?topology=processes"), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Topologies) != 1 || stats.Topologies[0].Topology != "processes" {
+		t.Fatalf("Expected the processes topology, got %v", stats.Topologies)
+	}
+	processes := stats.Topologies[0]
+	if processes.Nodes == 0 || processes.Seconds <= 0 || len(processes.Stages) == 0 {
+		t.Errorf("Expected the processes to be rendered and timed, got %v", processes)
+	}
+	found := false
+	for _, stage := range processes.Stages {
+		found = found || stage.Stage == "map:render.MapEndpoint2Process"
+	}
+	if !found {
+		t.Errorf("Expected the endpoint to process map to be timed, got %v", processes.Stages)
+	}
+
+	stats = app.APIRenderStats{}
+	if err := json.Unmarshal(getRawJSON(t, ts, "/debug/render-stats"), &stats); err != nil {
+		t.Fatal(err)
+	}
+	topologies := map[string]bool{}
+	for _, topology := range stats.Topologies {
+		topologies[topology.Topology] = true
+	}
+	for _, id := range []string{"processes", "containers", "hosts", "pods"} {
+		if !topologies[id] {
+			t.Errorf("Expected the %s topology, got %v", id, topologies)
+		}
+	}
+
+	is404(t, ts, "/debug/render-stats?topology=foo")
+}
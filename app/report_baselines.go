@@ -0,0 +1,56 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// reportBaselineTTL is how long the baseline of a probe is kept after its
+// last full report. Probes publish full reports every minute.
+const reportBaselineTTL = 5 * time.Minute
+
+// ReportBaselines keeps the last full report of each probe, for the probe's
+// incremental reports to be resolved against.
+type ReportBaselines struct {
+	sync.Mutex
+	baselines map[string]reportBaseline // by probe ID
+}
+
+type reportBaseline struct {
+	report.Report
+	added time.Time
+}
+
+// NewReportBaselines makes a new ReportBaselines.
+func NewReportBaselines() *ReportBaselines {
+	return &ReportBaselines{baselines: map[string]reportBaseline{}}
+}
+
+// Resolve gives the full report standing for a report of a probe, and
+// whether it could: incremental reports can only be resolved against the
+// last full report of their probe. Full reports become the baseline of the
+// probe.
+func (b *ReportBaselines) Resolve(probeID string, rpt report.Report) (report.Report, bool) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	if !rpt.IsDelta() {
+		if !rpt.Shortcut {
+			b.baselines[probeID] = reportBaseline{Report: rpt, added: now}
+			for id, baseline := range b.baselines {
+				if now.Sub(baseline.added) > reportBaselineTTL {
+					delete(b.baselines, id)
+				}
+			}
+		}
+		return rpt, true
+	}
+	baseline, ok := b.baselines[probeID]
+	if !ok {
+		return rpt, false
+	}
+	full, err := rpt.Resolve(baseline.Report)
+	return full, err == nil
+}
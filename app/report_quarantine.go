@@ -0,0 +1,70 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// reportQuarantineTTL is how long the rejections of a probe are shown after
+// its last rejected report.
+const reportQuarantineTTL = 10 * time.Minute
+
+// ReportQuarantine keeps track of the reports rejected of each probe, for
+// malformed and version-incompatible reports to show in the status of the
+// probe, rather than be merged.
+type ReportQuarantine struct {
+	sync.Mutex
+	rejected map[string]RejectedReports // by probe ID
+}
+
+// RejectedReports is what is known of the reports rejected of a probe.
+type RejectedReports struct {
+	ProbeVersion string    `json:"probeVersion,omitempty"`
+	Count        int       `json:"count"`
+	LastError    string    `json:"lastError"`
+	LastRejected time.Time `json:"lastRejected"`
+}
+
+// NewReportQuarantine makes a new ReportQuarantine.
+func NewReportQuarantine() *ReportQuarantine {
+	return &ReportQuarantine{rejected: map[string]RejectedReports{}}
+}
+
+// Reject records a report of a probe rejected for err.
+func (q *ReportQuarantine) Reject(probeID, probeVersion string, err error) {
+	log.Warnf("Rejected report of probe %s (version %s): %v", probeID, probeVersion, err)
+	q.Lock()
+	defer q.Unlock()
+	now := time.Now()
+	rejected := q.rejected[probeID]
+	rejected.ProbeVersion = probeVersion
+	rejected.Count++
+	rejected.LastError = err.Error()
+	rejected.LastRejected = now
+	q.rejected[probeID] = rejected
+	q.expire(now)
+}
+
+// Rejected gives the reports rejected of each probe lately, by probe ID.
+func (q *ReportQuarantine) Rejected() map[string]RejectedReports {
+	q.Lock()
+	defer q.Unlock()
+	q.expire(time.Now())
+	result := make(map[string]RejectedReports, len(q.rejected))
+	for id, rejected := range q.rejected {
+		result[id] = rejected
+	}
+	return result
+}
+
+// expire forgets the probes without rejected reports lately. Must be called
+// with the mutex held.
+func (q *ReportQuarantine) expire(now time.Time) {
+	for id, rejected := range q.rejected {
+		if now.Sub(rejected.LastRejected) > reportQuarantineTTL {
+			delete(q.rejected, id)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	reverseDNSLookupTimeout = 10 * time.Second
+	reverseDNSRetry         = 5 * time.Minute // after failed lookups
+	reverseDNSQueueLength   = 10000
+	reverseDNSWorkers       = 4
+)
+
+// ReverseResolver gives the names of an address, from its PTR records, like
+// net.Resolver.LookupAddr does.
+type ReverseResolver func(ctx context.Context, addr string) ([]string, error)
+
+// LookupAddr is the ReverseResolver of the resolver of the host.
+func LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return net.DefaultResolver.LookupAddr(ctx, addr)
+}
+
+// GeoIPRecord is what a GeoIP/ASN database knows of where an address is.
+type GeoIPRecord struct {
+	Country      string // ISO 3166 code, like "US"
+	ASN          int
+	Organisation string // of the autonomous system
+}
+
+// GeoIPDatabase looks up where addresses are.
+type GeoIPDatabase interface {
+	LookupIP(ip net.IP) (GeoIPRecord, bool)
+}
+
+type geoIPDatabase struct {
+	table   networkTable
+	records []GeoIPRecord
+}
+
+// LoadGeoIPDatabase loads a GeoIP/ASN database from a CSV file, of
+// network,country,asn,organisation lines like
+// "8.8.8.0/24,US,15169,Google LLC". Fields other than the network may be
+// empty; lines starting with # are comments. Addresses are of the most
+// specific network they are in.
+func LoadGeoIPDatabase(filename string) (GeoIPDatabase, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &geoIPDatabase{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, ",", 4)
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		record := GeoIPRecord{
+			Country:      strings.TrimSpace(fields[1]),
+			Organisation: strings.Trim(strings.TrimSpace(fields[3]), `"`),
+		}
+		if asn := strings.TrimPrefix(strings.TrimSpace(fields[2]), "AS"); asn != "" {
+			if record.ASN, err = strconv.Atoi(asn); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid ASN %q", filename, line, fields[2])
+			}
+		}
+		db.table.add(network, len(db.records))
+		db.records = append(db.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *geoIPDatabase) LookupIP(ip net.IP) (GeoIPRecord, bool) {
+	i, ok := db.table.lookup(ip)
+	if !ok {
+		return GeoIPRecord{}, false
+	}
+	return db.records[i], true
+}
+
+type addressLookup struct {
+	names   []string
+	geoIP   GeoIPRecord
+	located bool
+	fetched time.Time
+	seen    time.Time
+	err     error
+	pending bool
+}
+
+// ReverseDNSCollector is a collector adding the names of external addresses,
+// those of the Internet, to their endpoints in the reports of another, from
+// their PTR records, and where they are, from a GeoIP/ASN database. It makes
+// the unknown outbound and inbound traffic of the connections of the
+// Internet pseudo nodes identifiable. Names probes resolved or snooped are
+// kept. Each distinct address is looked up in the background, and again once
+// its lookup is older than the TTL.
+type ReverseDNSCollector struct {
+	Collector
+	resolver ReverseResolver // nil to only locate addresses
+	geoIP    GeoIPDatabase   // nil to only resolve them
+	ttl      time.Duration
+
+	mtx        sync.Mutex
+	lookups    map[string]*addressLookup // by address
+	generation int                       // of the lookups, counting those done
+	queue      chan string
+	quit       chan struct{}
+	wait       sync.WaitGroup
+}
+
+// NewReverseDNSCollector makes a new ReverseDNSCollector.
+func NewReverseDNSCollector(collector Collector, resolver ReverseResolver, geoIP GeoIPDatabase, ttl time.Duration) *ReverseDNSCollector {
+	c := &ReverseDNSCollector{
+		Collector: collector,
+		resolver:  resolver,
+		geoIP:     geoIP,
+		ttl:       ttl,
+		lookups:   map[string]*addressLookup{},
+		queue:     make(chan string, reverseDNSQueueLength),
+		quit:      make(chan struct{}),
+	}
+	for i := 0; i < reverseDNSWorkers; i++ {
+		c.wait.Add(1)
+		go c.loop()
+	}
+	return c
+}
+
+// Stop stops looking up addresses.
+func (c *ReverseDNSCollector) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *ReverseDNSCollector) loop() {
+	defer c.wait.Done()
+	for {
+		select {
+		case addr := <-c.queue:
+			c.fetch(addr)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *ReverseDNSCollector) fetch(addr string) {
+	var (
+		names   []string
+		geoIP   GeoIPRecord
+		located bool
+		err     error
+	)
+	if c.geoIP != nil {
+		geoIP, located = c.geoIP.LookupIP(net.ParseIP(addr))
+	}
+	if c.resolver != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), reverseDNSLookupTimeout)
+		names, err = c.resolver(ctx, addr)
+		cancel()
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			// Addresses without PTR records have no names, for the TTL
+			names, err = nil, nil
+		} else if err != nil {
+			log.Debugf("Error reverse resolving %s: %v", addr, err)
+		}
+		for i, name := range names {
+			names[i] = strings.TrimRight(name, ".")
+		}
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	l, ok := c.lookups[addr]
+	if !ok {
+		return // forgotten while looked up
+	}
+	if err == nil {
+		l.names = names
+	}
+	l.geoIP, l.located = geoIP, located
+	l.fetched, l.err, l.pending = mtime.Now(), err, false
+	c.generation++
+}
+
+// lookup gives the last lookup of an address, queueing it to be looked up
+// if it never was, or is due to be again. Must be called with the mutex
+// held.
+func (c *ReverseDNSCollector) lookup(addr string, now time.Time) *addressLookup {
+	l, ok := c.lookups[addr]
+	if !ok {
+		l = &addressLookup{}
+		c.lookups[addr] = l
+	}
+	l.seen = now
+	due := l.fetched.IsZero() ||
+		(l.err == nil && now.Sub(l.fetched) > c.ttl) ||
+		(l.err != nil && now.Sub(l.fetched) > reverseDNSRetry)
+	if due && !l.pending {
+		select {
+		case c.queue <- addr:
+			l.pending = true
+		default:
+			// Looking up is behind; try again with the next report
+		}
+	}
+	return l
+}
+
+// Report implements Reporter.
+func (c *ReverseDNSCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := c.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	return c.addReverseDNS(rpt, mtime.Now()), nil
+}
+
+func (c *ReverseDNSCollector) addReverseDNS(rpt report.Report, now time.Time) report.Report {
+	local := render.LocalNetworks(rpt)
+	result := rpt
+	result.Endpoint.Nodes = rpt.Endpoint.Nodes.Copy()
+	added := false
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for id, n := range rpt.Endpoint.Nodes {
+		_, addr, _, ok := report.ParseEndpointNodeID(id)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil || local.Contains(ip) || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		l := c.lookup(ip.String(), now)
+		if len(l.names) > 0 && len(render.DNSNames(n)) == 0 {
+			n = n.WithSet(endpoint.ReverseDNSNames, report.MakeStringSet(l.names...))
+			result.Endpoint.Nodes[id] = n
+			added = true
+		}
+		if l.located {
+			result.Endpoint.Nodes[id] = n.WithLatests(geoIPLatests(l.geoIP))
+			added = true
+		}
+	}
+	// Addresses no longer seen are forgotten, for their lookups not to
+	// grow without bound
+	for addr, l := range c.lookups {
+		if now.Sub(l.seen) > c.ttl && !l.pending {
+			delete(c.lookups, addr)
+		}
+	}
+	if added {
+		result = withEnrichmentRenderID(result, "reverse-dns", c.generation)
+	}
+	return result
+}
+
+func geoIPLatests(record GeoIPRecord) map[string]string {
+	latests := map[string]string{}
+	if record.Country != "" {
+		latests[render.GeoIPCountry] = record.Country
+	}
+	if record.ASN != 0 {
+		latests[render.GeoIPASN] = strconv.Itoa(record.ASN)
+	}
+	if record.Organisation != "" {
+		latests[render.GeoIPOrganisation] = record.Organisation
+	}
+	return latests
+}
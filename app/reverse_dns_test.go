@@ -0,0 +1,150 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+type mockResolver struct {
+	sync.Mutex
+	names  map[string][]string
+	looked []string
+}
+
+func (r *mockResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.looked = append(r.looked, addr)
+	if names, ok := r.names[addr]; ok {
+		return names, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func loadGeoIPDatabase(t *testing.T, csv string) app.GeoIPDatabase {
+	dir, err := ioutil.TempDir("", "geoip")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "geoip.csv")
+	ok(t, ioutil.WriteFile(filename, []byte(csv), 0600))
+	db, err := app.LoadGeoIPDatabase(filename)
+	ok(t, err)
+	return db
+}
+
+func TestGeoIPDatabase(t *testing.T) {
+	db := loadGeoIPDatabase(t, `# network,country,asn,organisation
+8.0.0.0/8,US,3356,Level 3
+8.8.8.0/24,US,AS15169,"Google LLC"
+2001:4860::/32,US,15169,Google LLC
+51.52.0.0/16,GB,,
+`)
+	for addr, want := range map[string]app.GeoIPRecord{
+		"8.8.8.8":              {Country: "US", ASN: 15169, Organisation: "Google LLC"},
+		"8.8.4.4":              {Country: "US", ASN: 3356, Organisation: "Level 3"},
+		"2001:4860:4860::8888": {Country: "US", ASN: 15169, Organisation: "Google LLC"},
+		"51.52.53.54":          {Country: "GB"},
+	} {
+		have, found := db.LookupIP(net.ParseIP(addr))
+		if !found {
+			t.Errorf("%s: expected to be found", addr)
+		}
+		equals(t, want, have)
+	}
+	if _, found := db.LookupIP(net.ParseIP("1.1.1.1")); found {
+		t.Errorf("Expected 1.1.1.1 not to be found")
+	}
+
+	dir, err := ioutil.TempDir("", "geoip")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	invalid := filepath.Join(dir, "invalid.csv")
+	ok(t, ioutil.WriteFile(invalid, []byte("8.8.8.0/33,US,15169,Google LLC\n"), 0600))
+	if _, err := app.LoadGeoIPDatabase(invalid); err == nil {
+		t.Errorf("Expected an error loading an invalid network")
+	}
+}
+
+func TestReverseDNSCollector(t *testing.T) {
+	resolver := &mockResolver{names: map[string][]string{
+		fixture.GoogleIP: {"dns.google."},
+	}}
+	db := loadGeoIPDatabase(t, "8.8.8.0/24,US,15169,Google LLC\n51.52.0.0/16,GB,,\n")
+	collector := app.NewReverseDNSCollector(app.StaticCollector(fixture.Report), resolver.LookupAddr, db, time.Hour)
+	defer collector.Stop()
+	ctx := context.Background()
+
+	test.Poll(t, 100*time.Millisecond, "dns.google", func() interface{} {
+		rpt, _ := collector.Report(ctx, time.Now())
+		names, _ := rpt.Endpoint.Nodes[fixture.GoogleEndpointNodeID].Sets.Lookup(endpoint.ReverseDNSNames)
+		if len(names) == 0 {
+			return ""
+		}
+		return names[0]
+	})
+	rpt, err := collector.Report(ctx, time.Now())
+	ok(t, err)
+	random := rpt.Endpoint.Nodes[fixture.RandomClientNodeID]
+	if names, _ := random.Sets.Lookup(endpoint.ReverseDNSNames); len(names) != 0 {
+		t.Errorf("Expected no names of an address without PTR records, got %v", names)
+	}
+	equals(t, "GB", render.GeoIPLocation(random))
+	equals(t, "AS15169 Google LLC, US", render.GeoIPLocation(rpt.Endpoint.Nodes[fixture.GoogleEndpointNodeID]))
+	// Local addresses are never looked up, and others only once
+	_, err = collector.Report(ctx, time.Now())
+	ok(t, err)
+	resolver.Lock()
+	looked := map[string]int{}
+	for _, addr := range resolver.looked {
+		looked[addr]++
+	}
+	resolver.Unlock()
+	for addr, count := range looked {
+		if addr == fixture.UnknownClient1IP || addr == fixture.ClientIP {
+			t.Errorf("Expected local address %s not to be looked up", addr)
+		}
+		if count != 1 {
+			t.Errorf("Expected %s to be looked up once, got %d", addr, count)
+		}
+	}
+
+	// The connections of the Internet are shown with the names and
+	// locations of their addresses
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, collector, map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	var node app.APINode
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/processes/"+render.OutgoingInternetID), &codec.JsonHandle{}).Decode(&node); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, summary := range node.Node.Connections {
+		for _, connection := range summary.Connections {
+			for _, row := range connection.Metadata {
+				if row.ID == "remote" && row.Value == "dns.google (8.8.8.8), AS15169 Google LLC, US" {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected a connection to dns.google, got %+v", node.Node.Connections)
+	}
+}
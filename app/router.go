@@ -105,6 +105,22 @@ func RegisterTopologyRoutes(router *mux.Router, r Reporter, capabilities map[str
 		HandleFunc("/api/topology/{topology}/ws",
 			requestContextDecorator(captureReporter(r, handleWebsocket))). // NB not gzip!
 		Name("api_topology_topology_ws")
+	get.
+		HandleFunc("/api/topology/{topology}/export",
+			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleExport)))).
+		Name("api_topology_topology_export")
+	get.
+		HandleFunc("/api/topology/{topology}/diff",
+			gzipHandler(requestContextDecorator(captureReporter(r, handleTopologyDiff)))).
+		Name("api_topology_topology_diff")
+	get.
+		HandleFunc("/api/topology/{topology}/dependencies",
+			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleDependencies)))).
+		Name("api_topology_topology_dependencies")
+	get.
+		HandleFunc("/api/topology/{topology}/top",
+			gzipHandler(requestContextDecorator(captureReporter(r, handleTop)))).
+		Name("api_topology_topology_top")
 	get.
 		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).HandlerFunc(
 		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleNode)))).
@@ -113,23 +129,53 @@ func RegisterTopologyRoutes(router *mux.Router, r Reporter, capabilities map[str
 		gzipHandler(requestContextDecorator(makeRawReportHandler(r))))
 	get.HandleFunc("/api/probes",
 		gzipHandler(requestContextDecorator(makeProbeHandler(r))))
+	get.HandleFunc("/api/networkpolicies",
+		gzipHandler(requestContextDecorator(captureReporter(r, handleNetworkPolicies))))
+	get.HandleFunc("/api/kubernetes/events",
+		gzipHandler(requestContextDecorator(captureReporter(r, handleKubernetesEvents))))
 }
 
-// RegisterReportPostHandler registers the handler for report submission
-func RegisterReportPostHandler(a Adder, router *mux.Router) {
+// RegisterReportPostHandler registers the handler for report submission.
+// Incremental reports are resolved against the baselines, and refused with
+// 409 Conflict when there are none. Malformed and version-incompatible
+// reports are refused, and recorded in the quarantine when there is one.
+func RegisterReportPostHandler(a Adder, router *mux.Router, baselines *ReportBaselines, quarantine *ReportQuarantine) {
 	post := router.Methods("POST").Subrouter()
 	post.HandleFunc("/api/report", requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		var (
-			rpt    report.Report
-			buf    bytes.Buffer
-			reader = io.TeeReader(r.Body, &buf)
+			rpt     report.Report
+			buf     bytes.Buffer
+			summer  = xfer.NewReportChecksummer(r.Body)
+			body    = io.Reader(summer)
+			gzipped bool
 		)
+		reject := func(code int, err error) {
+			if quarantine != nil {
+				quarantine.Reject(r.Header.Get(xfer.ScopeProbeIDHeader), r.Header.Get(xfer.ScopeProbeVersionHeader), err)
+			}
+			respondWith(w, code, err)
+		}
 
-		gzipped := strings.Contains(r.Header.Get("Content-Encoding"), "gzip")
-		if !gzipped {
-			reader = io.TeeReader(r.Body, gzip.NewWriter(&buf))
+		if err := report.CheckSchemaVersion(r.Header.Get(xfer.ScopeReportSchemaHeader)); err != nil {
+			reject(http.StatusBadRequest, err)
+			return
 		}
 
+		switch encoding := r.Header.Get("Content-Encoding"); encoding {
+		case "", xfer.IdentityEncoding:
+		case xfer.GzipEncoding:
+			gzipped = true
+		default:
+			decoder, err := xfer.NewReportDecoder(summer, encoding)
+			if err != nil {
+				reject(http.StatusUnsupportedMediaType, err)
+				return
+			}
+			defer decoder.Close()
+			body = decoder
+		}
+		reader := io.TeeReader(body, &buf)
+
 		contentType := r.Header.Get("Content-Type")
 		isMsgpack := strings.HasPrefix(contentType, "application/msgpack")
 		var handle codec.Handle
@@ -138,18 +184,46 @@ func RegisterReportPostHandler(a Adder, router *mux.Router) {
 			handle = &codec.JsonHandle{}
 		case isMsgpack:
 			handle = &codec.MsgpackHandle{}
+		case strings.HasPrefix(contentType, report.V2ContentType):
+			// v2 reports are compressed by themselves
 		default:
-			respondWith(w, http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", contentType))
+			reject(http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", contentType))
+			return
+		}
+
+		var err error
+		if handle == nil {
+			err = rpt.ReadBinaryV2(body)
+		} else {
+			err = rpt.ReadBinary(reader, gzipped, handle)
+		}
+		if err == nil {
+			err = summer.Verify(r.Header.Get(xfer.ScopeReportChecksumHeader))
+		}
+		if err != nil {
+			reject(http.StatusBadRequest, err)
 			return
 		}
 
-		if err := rpt.ReadBinary(reader, gzipped, handle); err != nil {
-			respondWith(w, http.StatusBadRequest, err)
+		resolved := rpt.IsDelta()
+		if baselines != nil {
+			var ok bool
+			if rpt, ok = baselines.Resolve(r.Header.Get(xfer.ScopeProbeIDHeader), rpt); !ok {
+				respondWith(w, http.StatusConflict, fmt.Errorf("Unknown baseline of incremental report: %v", rpt.Baseline))
+				return
+			}
+		} else if resolved {
+			respondWith(w, http.StatusConflict, fmt.Errorf("Incremental reports are not accepted"))
 			return
 		}
 
-		// a.Add(..., buf) assumes buf is gzip'd msgpack
-		if !isMsgpack {
+		if err := checkReportCluster(UserFromRequest(r), rpt); err != nil {
+			reject(http.StatusForbidden, err)
+			return
+		}
+
+		// a.Add(..., buf) assumes buf is gzip'd msgpack of the full report
+		if !isMsgpack || !gzipped || resolved {
 			buf = bytes.Buffer{}
 			rpt.WriteBinary(&buf, gzip.DefaultCompression)
 		}
@@ -159,6 +233,7 @@ func RegisterReportPostHandler(a Adder, router *mux.Router) {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
 		}
+		reportsReceived.Inc()
 		w.WriteHeader(http.StatusOK)
 	}))
 }
@@ -178,6 +253,23 @@ func NewVersion(version, downloadURL string) {
 	}
 }
 
+var probeUpdate = struct {
+	sync.Mutex
+	*xfer.ProbeUpdateInfo
+}{}
+
+// AdvertiseProbeUpdate is called to ask probes, through /api, to update
+// themselves to the signed binary of a version.
+func AdvertiseProbeUpdate(version, downloadURL, signature string) {
+	probeUpdate.Lock()
+	defer probeUpdate.Unlock()
+	probeUpdate.ProbeUpdateInfo = &xfer.ProbeUpdateInfo{
+		Version:     version,
+		DownloadURL: downloadURL,
+		Signature:   signature,
+	}
+}
+
 func apiHandler(rep Reporter, capabilities map[string]bool) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		report, err := rep.Report(ctx, time.Now())
@@ -187,6 +279,8 @@ func apiHandler(rep Reporter, capabilities map[string]bool) CtxHandlerFunc {
 		}
 		newVersion.Lock()
 		defer newVersion.Unlock()
+		probeUpdate.Lock()
+		defer probeUpdate.Unlock()
 		respondWith(w, http.StatusOK, xfer.Details{
 			ID:           UniqueID,
 			Version:      Version,
@@ -194,6 +288,7 @@ func apiHandler(rep Reporter, capabilities map[string]bool) CtxHandlerFunc {
 			Plugins:      report.Plugins,
 			Capabilities: capabilities,
 			NewVersion:   newVersion.NewVersionInfo,
+			ProbeUpdate:  probeUpdate.ProbeUpdateInfo,
 		})
 	}
 }
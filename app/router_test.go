@@ -2,10 +2,13 @@ package app_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -15,6 +18,9 @@ import (
 
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 )
 
@@ -43,7 +49,7 @@ func TestReportPostHandler(t *testing.T) {
 	test := func(contentType string, encoder func(interface{}) ([]byte, error)) {
 		router := mux.NewRouter()
 		c := app.NewCollector(1 * time.Minute)
-		app.RegisterReportPostHandler(c, router)
+		app.RegisterReportPostHandler(c, router, nil, nil)
 		ts := httptest.NewServer(router)
 		defer ts.Close()
 
@@ -93,4 +99,207 @@ func TestReportPostHandler(t *testing.T) {
 		err := codec.NewEncoder(buf, &codec.MsgpackHandle{}).Encode(v)
 		return buf.Bytes(), err
 	})
+	test(report.V2ContentType, func(v interface{}) ([]byte, error) {
+		buf := &bytes.Buffer{}
+		err := v.(report.Report).WriteBinaryV2(buf, gzip.DefaultCompression)
+		return buf.Bytes(), err
+	})
+}
+
+func TestReportEncodings(t *testing.T) {
+	for _, tc := range []struct {
+		encodings   []string
+		accepted    []string // encodings the app accepts, besides gzip
+		v2          bool
+		contentType string
+		encoding    string
+	}{
+		{[]string{xfer.GzipEncoding}, []string{xfer.DeflateEncoding}, false, "application/msgpack", "gzip"},
+		{[]string{xfer.DeflateEncoding, xfer.GzipEncoding}, []string{xfer.DeflateEncoding}, false, "application/msgpack", "deflate"},
+		{[]string{xfer.DeflateEncoding, xfer.GzipEncoding}, nil, false, "application/msgpack", "gzip"},
+		{[]string{xfer.IdentityEncoding}, nil, false, "application/msgpack", ""},
+		{[]string{xfer.DeflateEncoding}, []string{xfer.DeflateEncoding}, true, report.V2ContentType, "deflate"},
+		{[]string{xfer.IdentityEncoding}, nil, true, report.V2ContentType, ""},
+		// zstd is preferred, by the apps accepting it
+		{[]string{xfer.ZstdEncoding, xfer.GzipEncoding}, []string{xfer.ZstdEncoding, xfer.DeflateEncoding}, false, "application/msgpack", "zstd"},
+		{[]string{xfer.ZstdEncoding, xfer.GzipEncoding}, []string{xfer.DeflateEncoding}, false, "application/msgpack", "gzip"},
+		{[]string{xfer.ZstdEncoding, xfer.DeflateEncoding}, []string{xfer.DeflateEncoding}, true, report.V2ContentType, "deflate"},
+		{[]string{xfer.ZstdEncoding}, []string{xfer.ZstdEncoding}, true, report.V2ContentType, "zstd"},
+	} {
+		capabilities := map[string]bool{xfer.ReportV2Capability: tc.v2}
+		for _, encoding := range tc.accepted {
+			capabilities[xfer.ReportEncodingCapability(encoding)] = true
+		}
+		router := mux.NewRouter()
+		c := app.NewCollector(1 * time.Minute)
+		app.RegisterReportPostHandler(c, router, nil, nil)
+		app.RegisterTopologyRoutes(router, c, capabilities)
+		var contentType, encoding string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/report" {
+				contentType, encoding = r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding")
+			}
+			router.ServeHTTP(w, r)
+		}))
+
+		u, _ := url.Parse(ts.URL)
+		clients := appclient.NewMultiAppClient(func(hostname string, u url.URL) (appclient.AppClient, error) {
+			return appclient.NewAppClient(appclient.ProbeConfig{}, hostname, u, nil)
+		}, true)
+		clients.Set(u.Host, []url.URL{*u})
+		publisher := appclient.NewReportPublisher(clients, false)
+		publisher.SetCompression(appclient.CompressionConfig{Encodings: tc.encodings, Level: gzip.BestCompression})
+		if err := publisher.Publish(fixture.Report); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; ; i++ {
+			rpt, _ := c.Report(context.Background(), time.Now())
+			if len(rpt.Endpoint.Nodes) == len(fixture.Report.Endpoint.Nodes) {
+				break
+			}
+			if i == 100 {
+				t.Fatalf("%v: expected the report to be published, got %v", tc.encodings, rpt.Endpoint.Nodes)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if contentType != tc.contentType || encoding != tc.encoding {
+			t.Errorf("%v: expected %s in %q, got %s in %q", tc.encodings, tc.contentType, tc.encoding, contentType, encoding)
+		}
+		clients.Stop()
+		ts.Close()
+	}
+}
+
+func TestReportPostHandlerDeltas(t *testing.T) {
+	router := mux.NewRouter()
+	c := app.NewCollector(1 * time.Minute)
+	app.RegisterReportPostHandler(c, router, app.NewReportBaselines(), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(rpt report.Report) int {
+		buf := &bytes.Buffer{}
+		if err := rpt.WriteBinary(buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/msgpack")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(xfer.ScopeProbeIDHeader, "probe")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	baseline := report.MakeReport()
+	baseline.Host.AddNode(report.MakeNode("a"))
+	baseline.Host.AddNode(report.MakeNode("b"))
+	r := report.MakeReport()
+	r.Host.AddNode(report.MakeNode("a"))
+	r.Host.AddNode(report.MakeNode("c"))
+	delta := r.Delta(baseline)
+
+	if have := post(delta); have != http.StatusConflict {
+		t.Fatalf("Expected a conflict without a baseline, got %d", have)
+	}
+	if have := post(baseline); have != http.StatusOK {
+		t.Fatalf("Error posting the baseline: %d", have)
+	}
+	if have := post(delta); have != http.StatusOK {
+		t.Fatalf("Error posting the delta: %d", have)
+	}
+	rpt, err := c.Report(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rpt.Host.Nodes["c"]; !ok {
+		t.Errorf("Expected the node added by the delta, got %v", rpt.Host.Nodes)
+	}
+}
+
+func TestReportPostHandlerQuarantine(t *testing.T) {
+	router := mux.NewRouter()
+	c := app.NewCollector(1 * time.Minute)
+	quarantine := app.NewReportQuarantine()
+	app.RegisterReportPostHandler(c, router, nil, quarantine)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: c, Quarantine: quarantine}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	if err := fixture.Report.WriteBinary(buf, gzip.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	body := buf.Bytes()
+	post := func(body []byte, schema, checksum string) int {
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/msgpack")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(xfer.ScopeProbeIDHeader, "probe")
+		req.Header.Set(xfer.ScopeProbeVersionHeader, "1.2.3")
+		req.Header.Set(xfer.ScopeReportSchemaHeader, schema)
+		req.Header.Set(xfer.ScopeReportChecksumHeader, checksum)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	current := strconv.Itoa(report.SchemaVersion)
+	corrupt := append([]byte{}, body...)
+	corrupt[len(corrupt)-5] ^= 0xff
+	for _, tc := range []struct {
+		body             []byte
+		schema, checksum string
+	}{
+		{body, current, xfer.ReportChecksum(append([]byte("x"), body...))},
+		{body, strconv.Itoa(report.SchemaVersion + 1), xfer.ReportChecksum(body)},
+		{body, "latest", ""},
+		{[]byte("garbage"), current, xfer.ReportChecksum([]byte("garbage"))},
+		{corrupt, current, xfer.ReportChecksum(body)},
+	} {
+		if have := post(tc.body, tc.schema, tc.checksum); have != http.StatusBadRequest {
+			t.Errorf("%s %s: expected the report to be rejected, got %d", tc.schema, tc.checksum, have)
+		}
+	}
+	rpt, err := c.Report(context.Background(), time.Now())
+	ok(t, err)
+	if len(rpt.Endpoint.Nodes) != 0 {
+		t.Errorf("Expected no rejected report to be merged, got %v", rpt.Endpoint.Nodes)
+	}
+	// Reports without schema versions and checksums, of older probes, are
+	// accepted
+	equals(t, http.StatusOK, post(body, current, xfer.ReportChecksum(body)))
+	equals(t, http.StatusOK, post(body, "", ""))
+
+	var probes []struct {
+		ID       string               `json:"id"`
+		Rejected *app.RejectedReports `json:"rejected"`
+	}
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/probes"), &codec.JsonHandle{}).Decode(&probes); err != nil {
+		t.Fatal(err)
+	}
+	var rejected *app.RejectedReports
+	for _, probe := range probes {
+		if probe.ID == "probe" {
+			rejected = probe.Rejected
+		}
+	}
+	if rejected == nil {
+		t.Fatalf("Expected the rejected reports of the probe, got %+v", probes)
+	}
+	equals(t, "1.2.3", rejected.ProbeVersion)
+	equals(t, 5, rejected.Count)
 }
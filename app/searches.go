@@ -0,0 +1,104 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// SavedSearch is a named search query, with the topology it is for, if any.
+type SavedSearch struct {
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+	Topology string `json:"topology,omitempty"`
+}
+
+type searchesByName []SavedSearch
+
+func (a searchesByName) Len() int           { return len(a) }
+func (a searchesByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a searchesByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// Searches keeps the saved searches, by name.
+type Searches struct {
+	sync.RWMutex
+	searches map[string]SavedSearch
+}
+
+// NewSearches makes a new Searches.
+func NewSearches() *Searches {
+	return &Searches{searches: map[string]SavedSearch{}}
+}
+
+// List gives the saved searches, sorted by name.
+func (s *Searches) List() []SavedSearch {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		result = append(result, search)
+	}
+	sort.Sort(searchesByName(result))
+	return result
+}
+
+// Save saves a search, replacing any of the same name. Its query must
+// parse.
+func (s *Searches) Save(search SavedSearch) error {
+	if search.Name == "" {
+		return fmt.Errorf("search without a name")
+	}
+	if _, err := detailed.ParseQuery(search.Query); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.searches[search.Name] = search
+	return nil
+}
+
+// Delete deletes a saved search, and says whether there was one.
+func (s *Searches) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.searches[name]
+	delete(s.searches, name)
+	return ok
+}
+
+// RegisterSearchRoutes registers the routes listing, saving and deleting
+// saved searches.
+func RegisterSearchRoutes(router *mux.Router, searches *Searches) {
+	router.Methods("GET").Path("/api/searches").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			respondWith(w, http.StatusOK, searches.List())
+		}))
+	router.Methods("POST").Path("/api/searches").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var search SavedSearch
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&search); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			if err := searches.Save(search); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			respondWith(w, http.StatusOK, search)
+		}))
+	router.Methods("DELETE").Path("/api/searches/{name}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if !searches.Delete(mux.Vars(r)["name"]) {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+}
@@ -0,0 +1,67 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPITopologySearch(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	body := getRawJSON(t, ts, "/api/topology/containers?q="+url.QueryEscape("label:server"))
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(topology.Nodes))
+	if _, ok := topology.Nodes[fixture.ServerContainerNodeID]; !ok {
+		t.Errorf("Expected the server container, got %v", topology.Nodes)
+	}
+
+	is400(t, ts, "/api/topology/containers?q="+url.QueryEscape("(server"))
+}
+
+func TestSavedSearches(t *testing.T) {
+	router := mux.NewRouter()
+	app.RegisterSearchRoutes(router, app.NewSearches())
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, search := range []string{
+		`{"name": "hot", "query": "cpu>80%"}`,
+		`{"name": "frontend", "query": "team:frontend", "topology": "containers"}`,
+	} {
+		if res, _ := checkRequest(t, ts, "POST", "/api/searches", []byte(search)); res.StatusCode != 200 {
+			t.Fatalf("Expected status 200 saving %s, got %d", search, res.StatusCode)
+		}
+	}
+	for _, search := range []string{`{"name": "bad", "query": "(cpu"}`, `{"query": "cpu>80%"}`} {
+		if res, _ := checkRequest(t, ts, "POST", "/api/searches", []byte(search)); res.StatusCode != 400 {
+			t.Errorf("Expected status 400 saving %s, got %d", search, res.StatusCode)
+		}
+	}
+
+	var searches []app.SavedSearch
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/searches"), &codec.JsonHandle{}).Decode(&searches); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, []app.SavedSearch{
+		{Name: "frontend", Query: "team:frontend", Topology: "containers"},
+		{Name: "hot", Query: "cpu>80%"},
+	}, searches)
+
+	if res, _ := checkRequest(t, ts, "DELETE", "/api/searches/hot", nil); res.StatusCode != 204 {
+		t.Errorf("Expected status 204 deleting a search, got %d", res.StatusCode)
+	}
+	if res, _ := checkRequest(t, ts, "DELETE", "/api/searches/hot", nil); res.StatusCode != 404 {
+		t.Errorf("Expected status 404 deleting a deleted search, got %d", res.StatusCode)
+	}
+}
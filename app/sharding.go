@@ -0,0 +1,530 @@
+package app
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// ShardForwardedHeader marks the requests of the apps of a sharded cluster
+// to each other, which are served locally rather than forwarded again. It
+// has the URL of the app sending the request, and is only trusted along with
+// the token of the cluster in ShardTokenHeader.
+const ShardForwardedHeader = "X-Scope-Shard-Forwarded"
+
+// ShardTokenHeader has the token the apps of a sharded cluster share, which
+// authenticates their requests to each other.
+const ShardTokenHeader = "X-Scope-Shard-Token"
+
+const (
+	shardingGossipPath = "/api/sharding/gossip"
+	shardPeerCtxKey    = contextKey("shard-peer")
+)
+
+// errProbeNotHere is the error of controls forwarded to an app the probe
+// isn't connected to, for the app forwarding them to try the others.
+var errProbeNotHere = errors.New("probe is not connected to this app")
+
+const (
+	shardingTimeout = 10 * time.Second
+	// ringTokens is how many tokens each app has on the ring, for the
+	// probes to spread evenly.
+	ringTokens = 128
+	// memberTimeoutIntervals is how many gossip intervals an app may go
+	// without its heartbeat increasing before it is dropped.
+	memberTimeoutIntervals = 5
+)
+
+// Ring is a consistent hash ring of the apps of a sharded cluster, which
+// maps probe IDs to the app owning them. Only the probes of an app coming
+// or going change owner.
+type Ring struct {
+	tokens []uint32
+	owners map[uint32]string
+}
+
+// NewRing makes a new Ring of the apps.
+func NewRing(apps []string) *Ring {
+	r := &Ring{owners: map[uint32]string{}}
+	for _, app := range apps {
+		for i := 0; i < ringTokens; i++ {
+			token := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s-%d", app, i)))
+			if _, ok := r.owners[token]; ok {
+				continue
+			}
+			r.tokens = append(r.tokens, token)
+			r.owners[token] = app
+		}
+	}
+	sort.Slice(r.tokens, func(i, j int) bool { return r.tokens[i] < r.tokens[j] })
+	return r
+}
+
+// Owner gives the app owning key: the one of the first token following it
+// on the ring.
+func (r *Ring) Owner(key string) (string, bool) {
+	if len(r.tokens) == 0 {
+		return "", false
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i] >= hash })
+	if i == len(r.tokens) {
+		i = 0
+	}
+	return r.owners[r.tokens[i]], true
+}
+
+type member struct {
+	heartbeat uint64
+	updated   time.Time
+}
+
+// gossipMessage is what apps tell each other: the heartbeats of the apps
+// they know, by URL.
+type gossipMessage struct {
+	Members map[string]uint64 `json:"members"`
+}
+
+// Sharding is a Collector for one of several apps behind a load balancer,
+// which shard the probes between them on a consistent hash ring of their
+// probe IDs. Reports published to an app not owning their probe are
+// forwarded to the owner, and reports are merged from all of the apps when
+// rendering. The apps find each other by gossiping from seeds, over HTTP.
+//
+// The apps authenticate each other with a shared token, and Wrap must be
+// outside of any AuthMiddleware for their requests to bypass it.
+//
+// Gossiping is done over the HTTP API of the apps, rather than with
+// memberlist, as all the apps need to agree on is who is up: piggybacking
+// the heartbeats on the API needs no other port open between the apps, and
+// gets the TLS and the addresses they are configured with already. A
+// cluster of a handful of apps, gossiping every second, converges well
+// within memberTimeoutIntervals.
+//
+// Use the ControlRouter of a Sharding to send controls to the app the
+// probe is connected to. Pipes are not routed between apps, so the load
+// balancer should keep the UI on the app of the probe, with session
+// affinity.
+type Sharding struct {
+	Collector
+	self     string
+	token    string
+	seeds    []string
+	interval time.Duration
+	client   *http.Client
+	quit     chan struct{}
+	wait     sync.WaitGroup
+
+	mtx       sync.Mutex
+	heartbeat uint64
+	members   map[string]*member // by URL, excluding self
+	dead      map[string]uint64  // last heartbeats of the apps dropped
+	ring      *Ring
+}
+
+// NewSharding makes a new Sharding of the app advertised at self, joining
+// the cluster through the seeds, and gossiping every interval. The apps of
+// the cluster must share the token.
+func NewSharding(collector Collector, self, token string, seeds []string, interval time.Duration) *Sharding {
+	s := &Sharding{
+		Collector: collector,
+		self:      strings.TrimSuffix(self, "/"),
+		token:     token,
+		interval:  interval,
+		client:    &http.Client{Timeout: shardingTimeout},
+		quit:      make(chan struct{}),
+		members:   map[string]*member{},
+		dead:      map[string]uint64{},
+	}
+	for _, seed := range seeds {
+		if seed = strings.TrimSuffix(seed, "/"); seed != "" && seed != s.self {
+			s.seeds = append(s.seeds, seed)
+		}
+	}
+	s.ring = NewRing([]string{s.self})
+	s.wait.Add(1)
+	go s.loop()
+	return s
+}
+
+// Stop stops gossiping.
+func (s *Sharding) Stop() {
+	close(s.quit)
+	s.wait.Wait()
+}
+
+func (s *Sharding) loop() {
+	defer s.wait.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		for _, target := range s.tick(mtime.Now()) {
+			if err := s.gossipTo(target); err != nil {
+				log.Debugf("Error gossiping with app %s: %v", target, err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// tick beats the heart of this app, drops the apps not heard of for a
+// while, and gives who to gossip with: a random member, and the seeds
+// which aren't members.
+func (s *Sharding) tick(now time.Time) []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.heartbeat++
+
+	changed := false
+	for app, m := range s.members {
+		if now.Sub(m.updated) > memberTimeoutIntervals*s.interval {
+			log.Infof("App %s left the cluster", app)
+			delete(s.members, app)
+			s.dead[app] = m.heartbeat
+			changed = true
+		}
+	}
+	if changed {
+		s.updateRing()
+	}
+
+	var targets []string
+	for _, seed := range s.seeds {
+		if _, ok := s.members[seed]; !ok {
+			targets = append(targets, seed)
+		}
+	}
+	if len(s.members) > 0 {
+		apps := make([]string, 0, len(s.members))
+		for app := range s.members {
+			apps = append(apps, app)
+		}
+		targets = append(targets, apps[rand.Intn(len(apps))])
+	}
+	return targets
+}
+
+// updateRing rebuilds the ring from the members; s.mtx must be held.
+func (s *Sharding) updateRing() {
+	apps := []string{s.self}
+	for app := range s.members {
+		apps = append(apps, app)
+	}
+	s.ring = NewRing(apps)
+}
+
+func (s *Sharding) message() gossipMessage {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	msg := gossipMessage{Members: map[string]uint64{s.self: s.heartbeat}}
+	for app, m := range s.members {
+		msg.Members[app] = m.heartbeat
+	}
+	return msg
+}
+
+// merge learns the heartbeats another app knows of.
+func (s *Sharding) merge(msg gossipMessage, now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	changed := false
+	for app, heartbeat := range msg.Members {
+		if app == s.self {
+			continue
+		}
+		if m, ok := s.members[app]; ok {
+			if heartbeat > m.heartbeat {
+				m.heartbeat, m.updated = heartbeat, now
+			}
+			continue
+		}
+		// Apps dropped are gossiped about until everyone drops them
+		if heartbeat <= s.dead[app] {
+			continue
+		}
+		log.Infof("App %s joined the cluster", app)
+		delete(s.dead, app)
+		s.members[app] = &member{heartbeat: heartbeat, updated: now}
+		changed = true
+	}
+	if changed {
+		s.updateRing()
+	}
+}
+
+// peerHeader gives the headers authenticating the requests of this app to
+// the others.
+func (s *Sharding) peerHeader() http.Header {
+	return http.Header{
+		ShardForwardedHeader: []string{s.self},
+		ShardTokenHeader:     []string{s.token},
+	}
+}
+
+func (s *Sharding) newPeerRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range s.peerHeader() {
+		req.Header[key] = values
+	}
+	return req, nil
+}
+
+func (s *Sharding) gossipTo(app string) error {
+	body := &bytes.Buffer{}
+	if err := codec.NewEncoder(body, &codec.JsonHandle{}).Encode(s.message()); err != nil {
+		return err
+	}
+	req, err := s.newPeerRequest("POST", app+shardingGossipPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", app, resp.Status)
+	}
+	var msg gossipMessage
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&msg); err != nil {
+		return err
+	}
+	s.merge(msg, mtime.Now())
+	return nil
+}
+
+// Members gives the URLs of the apps of the cluster, including this one,
+// sorted.
+func (s *Sharding) Members() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	apps := []string{s.self}
+	for app := range s.members {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+func (s *Sharding) peers() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	apps := make([]string, 0, len(s.members))
+	for app := range s.members {
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// Owner gives the URL of the app owning a probe.
+func (s *Sharding) Owner(probeID string) string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	owner, _ := s.ring.Owner(probeID)
+	return owner
+}
+
+// Wrap implements middleware.Interface, authenticating the requests of the
+// other apps of the cluster by their token. Requests claiming to be from
+// another app without it are refused, as is gossip from anyone else.
+func (s *Sharding) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := r.Header.Get(ShardForwardedHeader)
+		if peer == "" && r.URL.Path != shardingGossipPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := r.Header.Get(ShardTokenHeader)
+		if peer == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), shardPeerCtxKey, peer)))
+	})
+}
+
+// shardPeer is whether a request is from another app of the cluster, as
+// authenticated by Sharding.Wrap.
+func shardPeer(r *http.Request) bool {
+	_, ok := r.Context().Value(shardPeerCtxKey).(string)
+	return ok
+}
+
+// forwarded is whether the request of ctx came from another app.
+func forwarded(ctx context.Context) bool {
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	return ok && shardPeer(r)
+}
+
+func probeIDOf(ctx context.Context) string {
+	if r, ok := ctx.Value(RequestCtxKey).(*http.Request); ok {
+		return r.Header.Get(xfer.ScopeProbeIDHeader)
+	}
+	return ""
+}
+
+// Add implements Adder, forwarding the reports of the probes of other apps
+// to them. buf is the gzipped msgpack of the full report. Should the owner
+// not take the report, it is added here rather than lost.
+func (s *Sharding) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	probeID := probeIDOf(ctx)
+	if probeID == "" || forwarded(ctx) {
+		return s.Collector.Add(ctx, rpt, buf)
+	}
+	owner := s.Owner(probeID)
+	if owner == "" || owner == s.self {
+		return s.Collector.Add(ctx, rpt, buf)
+	}
+	if err := s.forward(owner, probeID, buf); err != nil {
+		log.Warnf("Error forwarding report of probe %s to app %s: %v", probeID, owner, err)
+		return s.Collector.Add(ctx, rpt, buf)
+	}
+	return nil
+}
+
+func (s *Sharding) forward(app, probeID string, buf []byte) error {
+	req, err := s.newPeerRequest("POST", app+"/api/report", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(xfer.ScopeProbeIDHeader, probeID)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Report implements Reporter, merging the reports of the probes of all the
+// apps. Apps which don't respond are left out.
+func (s *Sharding) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := s.Collector.Report(ctx, timestamp)
+	if err != nil || forwarded(ctx) {
+		return rpt, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		reports []report.Report
+	)
+	for _, app := range s.peers() {
+		wg.Add(1)
+		go func(app string) {
+			defer wg.Done()
+			other, err := s.fetch(app, timestamp)
+			if err != nil {
+				log.Warnf("Error fetching report of app %s: %v", app, err)
+				return
+			}
+			mtx.Lock()
+			reports = append(reports, other)
+			mtx.Unlock()
+		}(app)
+	}
+	wg.Wait()
+	for _, other := range reports {
+		rpt = rpt.Merge(other)
+	}
+	return rpt, nil
+}
+
+func (s *Sharding) fetch(app string, timestamp time.Time) (report.Report, error) {
+	req, err := s.newPeerRequest("GET", app+"/api/report?timestamp="+url.QueryEscape(timestamp.Format(time.RFC3339Nano)), nil)
+	if err != nil {
+		return report.Report{}, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return report.Report{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return report.Report{}, fmt.Errorf("%s", resp.Status)
+	}
+	var rpt report.Report
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&rpt); err != nil {
+		return report.Report{}, err
+	}
+	return rpt, nil
+}
+
+// ControlRouter returns a ControlRouter which sends the controls of probes
+// not connected to this app to the other apps of the cluster, as probes
+// connect to whichever app the load balancer picks.
+func (s *Sharding) ControlRouter(cr ControlRouter) ControlRouter {
+	return &shardedControlRouter{ControlRouter: cr, sharding: s}
+}
+
+type shardedControlRouter struct {
+	ControlRouter
+	sharding *Sharding
+}
+
+func (cr *shardedControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := cr.ControlRouter.Handle(ctx, probeID, req)
+	if err == nil {
+		return res, nil
+	} else if forwarded(ctx) {
+		return res, errProbeNotHere
+	}
+	header := cr.sharding.peerHeader()
+	for _, app := range cr.sharding.peers() {
+		if other, otherErr := postControl(cr.sharding.client, app, probeID, req, header); otherErr == nil {
+			return other, nil
+		}
+	}
+	return res, err
+}
+
+// RegisterShardingRoutes registers the routes of the apps of a sharded
+// cluster gossiping with each other. Gossip is only served to the requests
+// Sharding.Wrap authenticated.
+func RegisterShardingRoutes(router *mux.Router, s *Sharding) {
+	router.Methods("POST").Path(shardingGossipPath).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg gossipMessage
+		if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&msg); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		s.merge(msg, mtime.Now())
+		respondWith(w, http.StatusOK, s.message())
+	})
+	router.Methods("GET").Path("/api/sharding/members").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, s.Members())
+	})
+}
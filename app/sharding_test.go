@@ -0,0 +1,208 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestRing(t *testing.T) {
+	before := app.NewRing([]string{"http://a", "http://b", "http://c"})
+	after := app.NewRing([]string{"http://a", "http://b", "http://c", "http://d"})
+
+	counts := map[string]int{}
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		probeID := fmt.Sprintf("probe%d", i)
+		owner, ok := before.Owner(probeID)
+		if !ok {
+			t.Fatalf("Expected an owner of %s", probeID)
+		}
+		counts[owner]++
+		// Only the probes of the app joining the ring change owner
+		if newOwner, _ := after.Owner(probeID); newOwner != owner {
+			moved++
+			if newOwner != "http://d" {
+				t.Errorf("Expected %s to move to the new app, got %s", probeID, newOwner)
+			}
+		}
+	}
+	for app, n := range counts {
+		if n < 200 {
+			t.Errorf("Expected the probes to spread evenly, %s has %d of 1000", app, n)
+		}
+	}
+	if moved == 0 || moved > 400 {
+		t.Errorf("Expected about a quarter of the probes to move, got %d", moved)
+	}
+	if _, ok := app.NewRing(nil).Owner("probe1"); ok {
+		t.Error("Expected no owner on an empty ring")
+	}
+}
+
+type shardedApp struct {
+	server    *httptest.Server
+	collector app.Collector // of the reports published to this app
+	controls  app.ControlRouter
+	sharding  *app.Sharding
+}
+
+func newShardedApp(seed string) *shardedApp {
+	router := mux.NewRouter().SkipClean(true)
+	a := &shardedApp{
+		server:    httptest.NewUnstartedServer(router),
+		collector: app.NewCollector(time.Minute),
+		controls:  app.NewLocalControlRouter(),
+	}
+	a.sharding = app.NewSharding(a.collector, "http://"+a.server.Listener.Addr().String(), "token1", []string{seed}, 10*time.Millisecond)
+	a.server.Config.Handler = a.sharding.Wrap(router)
+	app.RegisterReportPostHandler(a.sharding, router, nil, nil)
+	app.RegisterTopologyRoutes(router, a.sharding, nil)
+	app.RegisterControlRoutes(router, a.sharding.ControlRouter(a.controls))
+	app.RegisterShardingRoutes(router, a.sharding)
+	a.server.Start()
+	return a
+}
+
+func (a *shardedApp) stop() {
+	a.sharding.Stop()
+	a.server.Close()
+}
+
+func TestSharding(t *testing.T) {
+	ctx := context.Background()
+	a := newShardedApp("")
+	defer a.stop()
+	b := newShardedApp(a.server.URL)
+	defer b.stop()
+
+	// The apps find each other from the seed
+	for i := 0; len(a.sharding.Members()) != 2 || len(b.sharding.Members()) != 2; i++ {
+		if i == 100 {
+			t.Fatalf("Expected the apps to join, got %v and %v", a.sharding.Members(), b.sharding.Members())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A probe of b, publishing to a
+	var probeID string
+	for i := 0; probeID == ""; i++ {
+		if id := fmt.Sprintf("probe%d", i); a.sharding.Owner(id) == b.server.URL {
+			probeID = id
+		}
+	}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith("host1", map[string]string{report.ControlProbeID: probeID}))
+	buf := &bytes.Buffer{}
+	rpt.WriteBinary(buf, gzip.DefaultCompression)
+	req, err := http.NewRequest("POST", a.server.URL+"/api/report", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(xfer.ScopeProbeIDHeader, probeID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the report to be taken, got %s", resp.Status)
+	}
+
+	// The report is kept by b, and merged into the reports of a
+	if have, _ := b.collector.Report(ctx, time.Now()); len(have.Host.Nodes) != 1 {
+		t.Errorf("Expected the report forwarded to its owner, got %v", have.Host.Nodes)
+	}
+	if have, _ := a.collector.Report(ctx, time.Now()); len(have.Host.Nodes) != 0 {
+		t.Errorf("Expected the report not kept by who it was published to, got %v", have.Host.Nodes)
+	}
+	have, err := a.sharding.Report(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Host.Nodes["host1"]; !ok {
+		t.Errorf("Expected the reports of all the apps merged, got %v", have.Host.Nodes)
+	}
+
+	// Controls go to the app the probe is connected to
+	if _, err := b.controls.Register(ctx, probeID, func(req xfer.Request) xfer.Response {
+		return xfer.Response{Value: "pong " + req.NodeID}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.sharding.ControlRouter(a.controls).Handle(ctx, probeID, xfer.Request{NodeID: "host1", Control: "ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != "pong host1" {
+		t.Errorf("Unexpected response %v", res)
+	}
+	if _, err := a.sharding.ControlRouter(a.controls).Handle(ctx, "probe-nowhere", xfer.Request{NodeID: "host2", Control: "ping"}); err == nil {
+		t.Error("Expected an error for a probe connected to no app")
+	}
+}
+
+func TestShardingAuthentication(t *testing.T) {
+	a := newShardedApp("")
+	defer a.stop()
+	post := func(path string, header http.Header) int {
+		req, err := http.NewRequest("POST", a.server.URL+path, bytes.NewBufferString("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Only the apps with the token of the cluster can gossip, or claim to
+	// forward reports
+	for _, test := range []struct {
+		path   string
+		header http.Header
+		want   int
+	}{
+		{"/api/sharding/gossip", http.Header{}, http.StatusUnauthorized},
+		{"/api/sharding/gossip", http.Header{app.ShardForwardedHeader: {"http://other"}, app.ShardTokenHeader: {"wrong"}}, http.StatusUnauthorized},
+		{"/api/report", http.Header{app.ShardForwardedHeader: {"http://other"}}, http.StatusUnauthorized},
+		{"/api/sharding/gossip", http.Header{app.ShardForwardedHeader: {"http://other"}, app.ShardTokenHeader: {"token1"}}, http.StatusOK},
+	} {
+		if have := post(test.path, test.header); have != test.want {
+			t.Errorf("%s with %v: expected %d, got %d", test.path, test.header, test.want, have)
+		}
+	}
+
+	// The apps bypass the authentication of users
+	handler := a.sharding.Wrap(app.AuthMiddleware{Authenticator: app.StaticTokens{}}.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	for token, want := range map[string]int{"token1": http.StatusOK, "": http.StatusUnauthorized} {
+		req := httptest.NewRequest("GET", "/api/report", nil)
+		if token != "" {
+			req.Header.Set(app.ShardForwardedHeader, "http://other")
+			req.Header.Set(app.ShardTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("With token %q: expected %d, got %d", token, want, w.Code)
+		}
+	}
+}
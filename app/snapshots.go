@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// snapshotTimeFormat is the format of the timestamps in the keys of
+// snapshots, which sort in the order of the snapshots.
+const snapshotTimeFormat = "20060102T150405Z"
+
+// SnapshotStore is an object store, which topology snapshots are written to.
+type SnapshotStore interface {
+	PutSnapshot(ctx context.Context, key string, buf []byte) error
+	// ListSnapshots gives the keys of the snapshots starting with a prefix.
+	ListSnapshots(ctx context.Context, prefix string) ([]string, error)
+	DeleteSnapshot(ctx context.Context, key string) error
+}
+
+// TopologySnapshot is what is written to snapshot stores: every topology,
+// rendered with its default options.
+type TopologySnapshot struct {
+	Timestamp  time.Time                         `json:"timestamp"`
+	Topologies map[string]detailed.NodeSummaries `json:"topologies"`
+}
+
+// TopologySnapshotter periodically writes snapshots of the rendered
+// topologies to a SnapshotStore, and deletes the ones older than the
+// retention.
+type TopologySnapshotter struct {
+	reporter  Reporter
+	store     SnapshotStore
+	prefix    string
+	interval  time.Duration
+	retention time.Duration
+	quit      chan struct{}
+	wait      sync.WaitGroup
+}
+
+// NewTopologySnapshotter makes a new TopologySnapshotter, writing snapshots
+// under a key prefix every interval. A zero retention keeps the snapshots
+// forever.
+func NewTopologySnapshotter(reporter Reporter, store SnapshotStore, prefix string, interval, retention time.Duration) *TopologySnapshotter {
+	s := &TopologySnapshotter{
+		reporter:  reporter,
+		store:     store,
+		prefix:    prefix,
+		interval:  interval,
+		retention: retention,
+		quit:      make(chan struct{}),
+	}
+	s.wait.Add(1)
+	go s.loop()
+	return s
+}
+
+// Stop stops writing snapshots.
+func (s *TopologySnapshotter) Stop() {
+	close(s.quit)
+	s.wait.Wait()
+}
+
+func (s *TopologySnapshotter) loop() {
+	defer s.wait.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+		ctx := context.Background()
+		now := mtime.Now()
+		if err := s.snapshot(ctx, now); err != nil {
+			log.Warnf("Error writing topology snapshot: %v", err)
+		}
+		if err := s.expire(ctx, now); err != nil {
+			log.Warnf("Error deleting expired topology snapshots: %v", err)
+		}
+	}
+}
+
+func (s *TopologySnapshotter) key(t time.Time) string {
+	return s.prefix + t.UTC().Format(snapshotTimeFormat) + ".json"
+}
+
+func (s *TopologySnapshotter) snapshot(ctx context.Context, now time.Time) error {
+	rpt, err := s.reporter.Report(ctx, now)
+	if err != nil {
+		return err
+	}
+	rc := RenderContextForReporter(s.reporter, rpt)
+	snapshot := TopologySnapshot{Timestamp: now, Topologies: map[string]detailed.NodeSummaries{}}
+	add := func(desc APITopologyDesc) {
+		renderer, decorator, err := topologyRegistry.RendererForTopology(desc.id, defaultOptions(desc), rpt)
+		if err != nil {
+			return
+		}
+		snapshot.Topologies[desc.id] = detailed.Summaries(rc, renderTopology(desc.id, renderer, decorator, rpt))
+	}
+	topologyRegistry.walk(func(desc APITopologyDesc) {
+		add(desc)
+		for _, sub := range desc.SubTopologies {
+			add(sub)
+		}
+	})
+
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, &codec.JsonHandle{}).Encode(snapshot); err != nil {
+		return err
+	}
+	return s.store.PutSnapshot(ctx, s.key(now), buf.Bytes())
+}
+
+// expire deletes the snapshots older than the retention.
+func (s *TopologySnapshotter) expire(ctx context.Context, now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	keys, err := s.store.ListSnapshots(ctx, s.prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		name := strings.TrimSuffix(strings.TrimPrefix(key, s.prefix), ".json")
+		t, err := time.Parse(snapshotTimeFormat, name)
+		if err != nil || now.Sub(t) <= s.retention {
+			// Not a snapshot, or one which is kept
+			continue
+		}
+		if err := s.store.DeleteSnapshot(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultOptions gives the default values of the options of a topology, as
+// the UI shows it.
+func defaultOptions(desc APITopologyDesc) url.Values {
+	values := url.Values{}
+	for _, group := range desc.Options {
+		values.Set(group.ID, group.Default)
+	}
+	return values
+}
+
+// ParseSnapshotPath gives the bucket of snapshots, and the key prefix they
+// are written under, from the path of a snapshot store URL.
+func ParseSnapshotPath(path string) (bucket, prefix string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	prefix = parts[1]
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return parts[0], prefix
+}
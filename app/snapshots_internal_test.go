@@ -0,0 +1,100 @@
+package app
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+type memorySnapshotStore struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memorySnapshotStore) PutSnapshot(_ context.Context, key string, buf []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	m.objects[key] = buf
+	return nil
+}
+
+func (m *memorySnapshotStore) ListSnapshots(_ context.Context, prefix string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	keys := []string{}
+	for key := range m.objects {
+		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memorySnapshotStore) DeleteSnapshot(_ context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestTopologySnapshots(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = &memorySnapshotStore{objects: map[string][]byte{"snapshots/notes.txt": nil}}
+		s     = &TopologySnapshotter{reporter: StaticCollector(fixture.Report), store: store, prefix: "snapshots/", retention: time.Hour}
+		start = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	)
+	for _, at := range []time.Time{start, start.Add(30 * time.Minute), start.Add(90 * time.Minute)} {
+		if err := s.snapshot(ctx, at); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.expire(ctx, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, _ := store.ListSnapshots(ctx, "snapshots/")
+	want := []string{"snapshots/20170601T123000Z.json", "snapshots/20170601T133000Z.json", "snapshots/notes.txt"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, keys)
+		}
+	}
+
+	var snapshot TopologySnapshot
+	if err := codec.NewDecoderBytes(store.objects[want[1]], &codec.JsonHandle{}).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if !snapshot.Timestamp.Equal(start.Add(90 * time.Minute)) {
+		t.Errorf("Unexpected snapshot timestamp %v", snapshot.Timestamp)
+	}
+	if nodes := snapshot.Topologies[containersID]; len(nodes) == 0 {
+		t.Errorf("Expected containers in the snapshot, got %v", snapshot.Topologies)
+	}
+	if _, ok := snapshot.Topologies[containersByImageID]; !ok {
+		t.Errorf("Expected sub-topologies in the snapshot")
+	}
+}
+
+func TestParseSnapshotPath(t *testing.T) {
+	for path, want := range map[string][2]string{
+		"/bucket":             {"bucket", ""},
+		"/bucket/":            {"bucket", ""},
+		"/bucket/scope":       {"bucket", "scope/"},
+		"/bucket/scope/prod/": {"bucket", "scope/prod/"},
+	} {
+		if bucket, prefix := ParseSnapshotPath(path); bucket != want[0] || prefix != want[1] {
+			t.Errorf("%s: expected %v, got %s, %s", path, want, bucket, prefix)
+		}
+	}
+}
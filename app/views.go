@@ -0,0 +1,237 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// maxViewSearches is how many searches a view can pin.
+const maxViewSearches = 100
+
+// viewIDLength is how many characters of the hash of a view its ID has.
+const viewIDLength = 10
+
+// View is what a user was looking at: a topology with its options, the
+// searches they pinned and the node they selected. Views are kept under
+// short IDs, so links to them outlive the formats of the URLs of the UI.
+type View struct {
+	ID       string              `json:"id"`
+	Topology string              `json:"topology"`
+	Options  map[string][]string `json:"options,omitempty"` // of the topology, like "pseudo": ["hide"]
+	Searches []string            `json:"searches,omitempty"`
+	Selected string              `json:"selected,omitempty"` // node ID
+	User     string              `json:"user,omitempty"`     // who first saved it
+	Created  time.Time           `json:"created"`
+}
+
+func (v View) validate() error {
+	if v.Topology == "" {
+		return fmt.Errorf("view without a topology")
+	}
+	if len(v.Searches) > maxViewSearches {
+		return fmt.Errorf("view pinning %d searches, more than %d", len(v.Searches), maxViewSearches)
+	}
+	for _, search := range v.Searches {
+		if _, err := detailed.ParseQuery(search); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// id hashes what is viewed, so that saving the same view twice gives the
+// same ID.
+func (v View) id() string {
+	descriptor := View{Topology: v.Topology, Options: v.Options, Searches: v.Searches, Selected: v.Selected}
+	var buf []byte
+	codec.NewEncoderBytes(&buf, &codec.JsonHandle{BasicHandle: codec.BasicHandle{EncodeOptions: codec.EncodeOptions{Canonical: true}}}).Encode(descriptor)
+	sum := sha256.Sum256(buf)
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:viewIDLength]
+}
+
+// Views keeps the views users share links to, by their IDs. They are kept
+// in file if given, so the links survive restarts of the app too.
+type Views struct {
+	file string
+
+	mtx   sync.RWMutex
+	views map[string]View
+}
+
+// NewViews makes a new Views, loading the views in file.
+func NewViews(file string) (*Views, error) {
+	v := &Views{
+		file:  file,
+		views: map[string]View{},
+	}
+	if file == "" {
+		return v, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var saved []View
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("Error reading views from %s: %v", file, err)
+	}
+	for _, view := range saved {
+		v.views[view.ID] = view
+	}
+	return v, nil
+}
+
+// save the views to the file, with the lock held.
+func (v *Views) save() error {
+	if v.file == "" {
+		return nil
+	}
+	saved := make([]View, 0, len(v.views))
+	for _, view := range v.views {
+		saved = append(saved, view)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].ID < saved[j].ID })
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(saved); err != nil {
+		return err
+	}
+	tmp := v.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.file)
+}
+
+// Get gives a view by its ID.
+func (v *Views) Get(id string) (View, bool) {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+	view, ok := v.views[id]
+	return view, ok
+}
+
+// Save a view under its ID. A view saved before is kept as it was.
+func (v *Views) Save(view View) (View, error) {
+	if err := view.validate(); err != nil {
+		return View{}, err
+	}
+	view.ID = view.id()
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if saved, ok := v.views[view.ID]; ok {
+		return saved, nil
+	}
+	view.Created = mtime.Now()
+	v.views[view.ID] = view
+	return view, v.save()
+}
+
+// viewNodeDetails is a node the UI shows the details of.
+type viewNodeDetails struct {
+	ID         string `json:"id"`
+	Label      string `json:"label"`
+	TopologyID string `json:"topologyId"`
+}
+
+// viewURLState is the state the UI keeps in its URLs, of the parts of it a
+// view is of; see client/app/scripts/utils/router-utils.js.
+type viewURLState struct {
+	TopologyID      string                         `json:"topologyId"`
+	TopologyOptions map[string]map[string][]string `json:"topologyOptions"`
+	PinnedSearches  []string                       `json:"pinnedSearches"`
+	SelectedNodeID  string                         `json:"selectedNodeId,omitempty"`
+	NodeDetails     []viewNodeDetails              `json:"nodeDetails"`
+}
+
+// URLFragment gives the fragment of the URL of the UI showing the view.
+func (v View) URLFragment() string {
+	state := viewURLState{
+		TopologyID:      v.Topology,
+		TopologyOptions: map[string]map[string][]string{},
+		PinnedSearches:  v.Searches,
+		SelectedNodeID:  v.Selected,
+		NodeDetails:     []viewNodeDetails{},
+	}
+	if v.Options != nil {
+		state.TopologyOptions[v.Topology] = v.Options
+	}
+	if state.PinnedSearches == nil {
+		state.PinnedSearches = []string{}
+	}
+	if v.Selected != "" {
+		state.NodeDetails = append(state.NodeDetails, viewNodeDetails{ID: v.Selected, Label: v.Selected, TopologyID: v.Topology})
+	}
+	var buf []byte
+	codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(state)
+	// The UI can't route states with slashes in them, so escapes them, and
+	// percents, before percent-encoding them
+	encoded := strings.NewReplacer("%", "<PERCENT>", "/", "<SLASH>").Replace(string(buf))
+	return "!/state/" + url.PathEscape(encoded)
+}
+
+// RegisterViewRoutes registers the routes saving and getting views, and
+// the links to them, which redirect to the UI showing them.
+func RegisterViewRoutes(router *mux.Router, views *Views) {
+	router.Methods("POST").Path("/api/views").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var view View
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&view); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			if _, ok := topologyRegistry.get(view.Topology); !ok {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("no such topology: %q", view.Topology))
+				return
+			}
+			view.User = UserFromRequest(r).Name
+			if err := view.validate(); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			view, err := views.Save(view)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondWith(w, http.StatusOK, view)
+		}))
+	router.Methods("GET").Path("/api/views/{id}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			view, ok := views.Get(mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, view)
+		}))
+	router.Methods("GET").Path("/v/{id}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			view, ok := views.Get(mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			// Relative, for apps behind proxies serving them under a prefix,
+			// which http.Redirect would make absolute
+			w.Header().Set("Location", "../#"+view.URLFragment())
+			w.WriteHeader(http.StatusFound)
+		}))
+}
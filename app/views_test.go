@@ -0,0 +1,109 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+)
+
+func TestViews(t *testing.T) {
+	dir, err := ioutil.TempDir("", "views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "views.json")
+	views, err := app.NewViews(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	app.RegisterViewRoutes(router, views)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(body string) (*http.Response, app.View) {
+		resp, err := http.Post(ts.URL+"/api/views", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var view app.View
+		if resp.StatusCode == http.StatusOK {
+			if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&view); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, view
+	}
+
+	body := `{"topology": "containers", "options": {"system": ["application"]}, "searches": ["name:web"], "selected": "abc;<container>"}`
+	resp, view := post(body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to save the view, got %s", resp.Status)
+	}
+	if view.ID == "" {
+		t.Fatal("Expected the view to have an ID")
+	}
+	if _, again := post(body); again.ID != view.ID || !again.Created.Equal(view.Created) {
+		t.Errorf("Expected the same view to be saved once, got %v and %v", view, again)
+	}
+	if _, other := post(`{"topology": "hosts"}`); other.ID == view.ID {
+		t.Errorf("Expected other views to have other IDs")
+	}
+	if resp, _ := post(`{"topology": "no-such-topology"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected no views of unknown topologies, got %s", resp.Status)
+	}
+
+	// Views are resolved by their ID, even after a restart
+	views, err = app.NewViews(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, ok := views.Get(view.ID)
+	if !ok {
+		t.Fatalf("Expected view %s to have been kept", view.ID)
+	}
+	equals(t, "containers", saved.Topology)
+	equals(t, map[string][]string{"system": {"application"}}, saved.Options)
+	equals(t, []string{"name:web"}, saved.Searches)
+	is404(t, ts, "/api/views/nope")
+
+	// Links redirect to the UI showing the view
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Get(ts.URL + "/v/" + view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	equals(t, http.StatusFound, resp.StatusCode)
+	location := resp.Header.Get("Location")
+	if !strings.HasPrefix(location, "../#!/state/") {
+		t.Fatalf("Unexpected redirect to %s", location)
+	}
+	state, err := url.PathUnescape(strings.TrimPrefix(location, "../#!/state/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urlState struct {
+		TopologyID      string                         `json:"topologyId"`
+		TopologyOptions map[string]map[string][]string `json:"topologyOptions"`
+		SelectedNodeID  string                         `json:"selectedNodeId"`
+	}
+	if err := codec.NewDecoderBytes([]byte(strings.Replace(state, "<SLASH>", "/", -1)), &codec.JsonHandle{}).Decode(&urlState); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "containers", urlState.TopologyID)
+	equals(t, []string{"application"}, urlState.TopologyOptions["containers"]["system"])
+	equals(t, "abc;<container>", urlState.SelectedNodeID)
+}
@@ -0,0 +1,431 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys of the vulnerabilities of images, on the nodes of images and of their
+// containers.
+const (
+	VulnerabilitiesCritical = "vulnerabilities_critical"
+	VulnerabilitiesHigh     = "vulnerabilities_high"
+	VulnerabilitiesMedium   = "vulnerabilities_medium"
+	VulnerabilitiesLow      = "vulnerabilities_low"
+	VulnerabilitySeverity   = "vulnerability_severity" // the highest of any vulnerability
+	VulnerabilitiesScanned  = "vulnerabilities_scanned"
+)
+
+// Severities of vulnerabilities, as scanners name them.
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+	SeverityNone     = "NONE"
+)
+
+const (
+	vulnerabilityScanTimeout = 5 * time.Minute
+	vulnerabilityRetry       = time.Minute // after failed scans
+	vulnerabilityQueueLength = 1000
+)
+
+var vulnerabilityMetadataTemplates = report.MetadataTemplates{
+	VulnerabilitySeverity:   {ID: VulnerabilitySeverity, Label: "Vulnerability", From: report.FromLatest, Priority: 20},
+	VulnerabilitiesCritical: {ID: VulnerabilitiesCritical, Label: "Critical CVEs", From: report.FromLatest, Datatype: "number", Priority: 21},
+	VulnerabilitiesHigh:     {ID: VulnerabilitiesHigh, Label: "High CVEs", From: report.FromLatest, Datatype: "number", Priority: 22},
+	VulnerabilitiesMedium:   {ID: VulnerabilitiesMedium, Label: "Medium CVEs", From: report.FromLatest, Datatype: "number", Priority: 23},
+	VulnerabilitiesLow:      {ID: VulnerabilitiesLow, Label: "Low CVEs", From: report.FromLatest, Datatype: "number", Priority: 24},
+	VulnerabilitiesScanned:  {ID: VulnerabilitiesScanned, Label: "Scanned", From: report.FromLatest, Datatype: "datetime", Priority: 25},
+}
+
+// ImageVulnerabilities counts the vulnerabilities of an image, by severity.
+type ImageVulnerabilities struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+}
+
+// Add counts a vulnerability of a severity.
+func (v *ImageVulnerabilities) Add(severity string) {
+	switch strings.ToUpper(severity) {
+	case SeverityCritical:
+		v.Critical++
+	case SeverityHigh:
+		v.High++
+	case SeverityMedium:
+		v.Medium++
+	case SeverityLow:
+		v.Low++
+	default:
+		v.Unknown++
+	}
+}
+
+// Severity gives the highest severity of the vulnerabilities, or
+// SeverityNone.
+func (v ImageVulnerabilities) Severity() string {
+	switch {
+	case v.Critical > 0:
+		return SeverityCritical
+	case v.High > 0:
+		return SeverityHigh
+	case v.Medium > 0:
+		return SeverityMedium
+	case v.Low > 0:
+		return SeverityLow
+	case v.Unknown > 0:
+		return SeverityUnknown
+	}
+	return SeverityNone
+}
+
+// VulnerabilityScanner scans images, by their references, like
+// nginx@sha256:... or nginx:1.19, for vulnerabilities.
+type VulnerabilityScanner interface {
+	ScanImage(ctx context.Context, image string) (ImageVulnerabilities, error)
+}
+
+// trivyReport is the JSON Trivy reports scans in.
+type trivyReport struct {
+	Results []trivyResult
+}
+
+type trivyResult struct {
+	Target          string
+	Vulnerabilities []struct {
+		VulnerabilityID string
+		Severity        string
+	}
+}
+
+// parseTrivyReport counts the vulnerabilities in a Trivy JSON report, of
+// either the format of Trivy before 0.20, a list of results, or after.
+func parseTrivyReport(buf []byte) (ImageVulnerabilities, error) {
+	var results []trivyResult
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&results); err != nil {
+			return ImageVulnerabilities{}, err
+		}
+	} else {
+		var rpt trivyReport
+		if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&rpt); err != nil {
+			return ImageVulnerabilities{}, err
+		}
+		results = rpt.Results
+	}
+	result := ImageVulnerabilities{}
+	for _, r := range results {
+		for _, v := range r.Vulnerabilities {
+			result.Add(v.Severity)
+		}
+	}
+	return result, nil
+}
+
+// TrivyScanner scans images with the Trivy command, by itself or as a
+// client of a Trivy server.
+type TrivyScanner struct {
+	Path   string // of trivy
+	Server string // URL of the Trivy server, if any
+}
+
+// ScanImage implements VulnerabilityScanner.
+func (s TrivyScanner) ScanImage(ctx context.Context, image string) (ImageVulnerabilities, error) {
+	args := []string{"image", "--quiet", "--format", "json"}
+	if s.Server != "" {
+		args = append(args, "--server", s.Server)
+	}
+	cmd := exec.Command(s.Path, append(args, image)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		return ImageVulnerabilities{}, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		return ImageVulnerabilities{}, fmt.Errorf("trivy: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTrivyReport(stdout.Bytes())
+}
+
+// HTTPScanner scans images by asking a service, with GET <url>?image=<image>,
+// which answers with a Trivy JSON report; it adapts other scanners, like
+// Clair.
+type HTTPScanner struct {
+	URL    string
+	Client *http.Client
+}
+
+// ScanImage implements VulnerabilityScanner.
+func (s HTTPScanner) ScanImage(ctx context.Context, image string) (ImageVulnerabilities, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return ImageVulnerabilities{}, err
+	}
+	query := u.Query()
+	query.Set("image", image)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return ImageVulnerabilities{}, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return ImageVulnerabilities{}, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return ImageVulnerabilities{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ImageVulnerabilities{}, fmt.Errorf("scanning %s: %s", image, resp.Status)
+	}
+	return parseTrivyReport(buf.Bytes())
+}
+
+type imageScan struct {
+	result  ImageVulnerabilities
+	scanned time.Time
+	err     error
+	pending bool
+}
+
+// VulnerabilityCollector is a collector adding the vulnerabilities of
+// images to the nodes of images and their containers, in the reports of
+// another. Each distinct image is scanned in the background, and again
+// once its scan is older than the TTL; until then, its nodes have none.
+type VulnerabilityCollector struct {
+	Collector
+	scanner VulnerabilityScanner
+	ttl     time.Duration
+
+	mtx        sync.Mutex
+	scans      map[string]*imageScan // by image reference
+	generation int                   // of the scans, counting those done
+	queue      chan string
+	quit       chan struct{}
+	wait       sync.WaitGroup
+}
+
+// NewVulnerabilityCollector makes a new VulnerabilityCollector, scanning
+// images at most workers at a time.
+func NewVulnerabilityCollector(collector Collector, scanner VulnerabilityScanner, ttl time.Duration, workers int) *VulnerabilityCollector {
+	c := &VulnerabilityCollector{
+		Collector: collector,
+		scanner:   scanner,
+		ttl:       ttl,
+		scans:     map[string]*imageScan{},
+		queue:     make(chan string, vulnerabilityQueueLength),
+		quit:      make(chan struct{}),
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		c.wait.Add(1)
+		go c.loop()
+	}
+	return c
+}
+
+// Stop stops scanning images.
+func (c *VulnerabilityCollector) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *VulnerabilityCollector) loop() {
+	defer c.wait.Done()
+	for {
+		select {
+		case image := <-c.queue:
+			c.scan(image)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *VulnerabilityCollector) scan(image string) {
+	ctx, cancel := context.WithTimeout(context.Background(), vulnerabilityScanTimeout)
+	defer cancel()
+	result, err := c.scanner.ScanImage(ctx, image)
+	if err != nil {
+		log.Warnf("Error scanning image %s for vulnerabilities: %v", image, err)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.scans[image] = &imageScan{result: result, scanned: mtime.Now(), err: err}
+	c.generation++
+}
+
+// lookup gives the last successful scan of an image, queueing it to be
+// scanned if it never was, or is due to be again.
+func (c *VulnerabilityCollector) lookup(image string, now time.Time) (imageScan, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	scan, ok := c.scans[image]
+	if !ok {
+		scan = &imageScan{}
+		c.scans[image] = scan
+	}
+	due := scan.scanned.IsZero() ||
+		(scan.err == nil && now.Sub(scan.scanned) > c.ttl) ||
+		(scan.err != nil && now.Sub(scan.scanned) > vulnerabilityRetry)
+	if due && !scan.pending {
+		select {
+		case c.queue <- image:
+			scan.pending = true
+		default:
+			// Scanning is behind; try again with the next report
+		}
+	}
+	return *scan, !scan.scanned.IsZero() && scan.err == nil
+}
+
+// imageReference gives what to scan an image by: its digest, which pins
+// exactly what runs, or else its name.
+func imageReference(n report.Node) (string, bool) {
+	if digest, ok := n.Latest.Lookup(docker.ImageDigest); ok && digest != "" {
+		return digest, true
+	}
+	if name, ok := n.Latest.Lookup(docker.ImageName); ok && name != "" && name != "<none>:<none>" {
+		return name, true
+	}
+	return "", false
+}
+
+func withVulnerabilities(n report.Node, scan imageScan) report.Node {
+	return n.WithLatests(map[string]string{
+		VulnerabilitySeverity:   scan.result.Severity(),
+		VulnerabilitiesCritical: strconv.Itoa(scan.result.Critical),
+		VulnerabilitiesHigh:     strconv.Itoa(scan.result.High),
+		VulnerabilitiesMedium:   strconv.Itoa(scan.result.Medium),
+		VulnerabilitiesLow:      strconv.Itoa(scan.result.Low),
+		VulnerabilitiesScanned:  scan.scanned.UTC().Format(time.RFC3339),
+	})
+}
+
+// Report implements Reporter.
+func (c *VulnerabilityCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := c.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+	return c.addVulnerabilities(rpt, mtime.Now()), nil
+}
+
+func (c *VulnerabilityCollector) addVulnerabilities(rpt report.Report, now time.Time) report.Report {
+	result := rpt
+	result.ContainerImage = rpt.ContainerImage.WithMetadataTemplates(vulnerabilityMetadataTemplates)
+	result.Container = rpt.Container.WithMetadataTemplates(vulnerabilityMetadataTemplates)
+
+	images := map[string]imageScan{}
+	result.ContainerImage.Nodes = rpt.ContainerImage.Nodes.Copy()
+	for id, n := range rpt.ContainerImage.Nodes {
+		image, ok := imageReference(n)
+		if !ok {
+			continue
+		}
+		scan, ok := c.lookup(image, now)
+		if !ok {
+			continue
+		}
+		images[id] = scan
+		result.ContainerImage.Nodes[id] = withVulnerabilities(n, scan)
+	}
+
+	result.Container.Nodes = rpt.Container.Nodes.Copy()
+	for id, n := range rpt.Container.Nodes {
+		imageIDs, _ := n.Parents.Lookup(report.ContainerImage)
+		if len(imageIDs) == 0 {
+			if imageID, ok := n.Latest.Lookup(docker.ImageID); ok {
+				imageIDs = report.MakeStringSet(report.MakeContainerImageNodeID(imageID))
+			}
+		}
+		for _, imageID := range imageIDs {
+			if scan, ok := images[imageID]; ok {
+				result.Container.Nodes[id] = withVulnerabilities(n, scan)
+				break
+			}
+		}
+	}
+	if len(images) > 0 {
+		c.mtx.Lock()
+		result = withEnrichmentRenderID(result, "vulnerabilities", c.generation)
+		c.mtx.Unlock()
+	}
+	return result
+}
+
+// IsVulnerable checks whether a node is of an image with vulnerabilities,
+// or of a container of one.
+func IsVulnerable(n report.Node) bool {
+	severity, ok := n.Latest.Lookup(VulnerabilitySeverity)
+	return ok && severity != SeverityNone
+}
+
+var vulnerabilityFilter = APITopologyOptionGroup{
+	ID:      "vulnerable",
+	Default: "all",
+	Options: []APITopologyOption{
+		{Value: "all", Label: "All", filter: nil, filterPseudo: false},
+		{Value: "vulnerable", Label: "Vulnerable only", filter: IsVulnerable, filterPseudo: true},
+	},
+}
+
+// updateVulnerabilityFilters offers to show only vulnerable containers and
+// images, when any were scanned.
+func updateVulnerabilityFilters(rpt report.Report, topologies []APITopologyDesc) []APITopologyDesc {
+	scanned := false
+	for _, n := range rpt.ContainerImage.Nodes {
+		if _, ok := n.Latest.Lookup(VulnerabilitySeverity); ok {
+			scanned = true
+			break
+		}
+	}
+	if !scanned {
+		return topologies
+	}
+	topologies = append([]APITopologyDesc{}, topologies...) // Make a copy so we can make changes safely
+	for i, t := range topologies {
+		if t.id == containersID {
+			topologies[i] = mergeTopologyFilters(t, []APITopologyOptionGroup{vulnerabilityFilter})
+		}
+	}
+	return topologies
+}
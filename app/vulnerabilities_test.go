@@ -0,0 +1,127 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+type mockScanner struct {
+	sync.Mutex
+	scanned []string
+	results map[string]app.ImageVulnerabilities
+}
+
+func (s *mockScanner) ScanImage(_ context.Context, image string) (app.ImageVulnerabilities, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.scanned = append(s.scanned, image)
+	result, ok := s.results[image]
+	if !ok {
+		return app.ImageVulnerabilities{}, fmt.Errorf("no such image: %s", image)
+	}
+	return result, nil
+}
+
+func TestVulnerabilityCollector(t *testing.T) {
+	scanner := &mockScanner{results: map[string]app.ImageVulnerabilities{
+		fixture.ClientContainerImageName: {Critical: 1, Low: 3},
+		fixture.ServerContainerImageName: {},
+	}}
+	collector := app.NewVulnerabilityCollector(app.StaticCollector(fixture.Report), scanner, time.Hour, 1)
+	defer collector.Stop()
+	ctx := context.Background()
+
+	// Images are scanned in the background
+	rpt, err := collector.Report(ctx, time.Now())
+	ok(t, err)
+	if _, found := rpt.ContainerImage.Nodes[fixture.ClientContainerImageNodeID].Latest.Lookup(app.VulnerabilitySeverity); found {
+		t.Errorf("Expected no vulnerabilities before the scan")
+	}
+	test.Poll(t, 100*time.Millisecond, 2, func() interface{} {
+		scanner.Lock()
+		defer scanner.Unlock()
+		return len(scanner.scanned)
+	})
+	test.Poll(t, 100*time.Millisecond, "CRITICAL", func() interface{} {
+		rpt, _ := collector.Report(ctx, time.Now())
+		severity, _ := rpt.ContainerImage.Nodes[fixture.ClientContainerImageNodeID].Latest.Lookup(app.VulnerabilitySeverity)
+		return severity
+	})
+
+	rpt, err = collector.Report(ctx, time.Now())
+	ok(t, err)
+	for id, want := range map[string]string{
+		fixture.ClientContainerNodeID: "CRITICAL",
+		fixture.ServerContainerNodeID: "NONE",
+	} {
+		severity, _ := rpt.Container.Nodes[id].Latest.Lookup(app.VulnerabilitySeverity)
+		equals(t, want, severity)
+	}
+	low, _ := rpt.Container.Nodes[fixture.ClientContainerNodeID].Latest.Lookup(app.VulnerabilitiesLow)
+	equals(t, "3", low)
+	// Scans are kept until their TTL
+	scanner.Lock()
+	equals(t, 2, len(scanner.scanned))
+	scanner.Unlock()
+
+	// Containers can be filtered down to the vulnerable ones
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, collector, map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers?vulnerable=vulnerable"), &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := topology.Nodes[fixture.ClientContainerNodeID]; !found || len(topology.Nodes) != 1 {
+		t.Errorf("Expected only the vulnerable container, got %d nodes", len(topology.Nodes))
+	}
+}
+
+func TestHTTPScanner(t *testing.T) {
+	reports := map[string]string{
+		// Trivy from 0.20 on
+		"current": `{"SchemaVersion": 2, "Results": [{"Target": "debian", "Vulnerabilities": [
+			{"VulnerabilityID": "CVE-2021-1", "Severity": "HIGH"},
+			{"VulnerabilityID": "CVE-2021-2", "Severity": "MEDIUM"}]},
+			{"Target": "jar", "Vulnerabilities": [{"VulnerabilityID": "CVE-2021-3", "Severity": "HIGH"}]}]}`,
+		// Trivy before
+		"legacy": `[{"Target": "alpine", "Vulnerabilities": [{"VulnerabilityID": "CVE-2020-1", "Severity": "CRITICAL"}]}]`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rpt, found := reports[r.URL.Query().Get("image")]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rpt))
+	}))
+	defer ts.Close()
+	scanner := app.HTTPScanner{URL: ts.URL + "/scan"}
+	ctx := context.Background()
+
+	result, err := scanner.ScanImage(ctx, "current")
+	ok(t, err)
+	equals(t, app.ImageVulnerabilities{High: 2, Medium: 1}, result)
+	equals(t, "HIGH", result.Severity())
+
+	result, err = scanner.ScanImage(ctx, "legacy")
+	ok(t, err)
+	equals(t, app.ImageVulnerabilities{Critical: 1}, result)
+
+	if _, err := scanner.ScanImage(ctx, "unknown"); err == nil {
+		t.Errorf("Expected an error scanning an unknown image")
+	}
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Client talks to the API of a Scope app.
+type Client struct {
+	baseURL  string
+	token    string
+	client   *http.Client
+	wsDialer websocket.Dialer
+}
+
+// NewClient makes a client of the app at appURL, like http://localhost:4040,
+// authenticating with a bearer token, if any.
+func NewClient(appURL, token string) (*Client, error) {
+	if !strings.Contains(appURL, "://") {
+		appURL = "http://" + appURL
+	}
+	u, err := url.Parse(appURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(u.String(), "/"),
+		token:   token,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		wsDialer: websocket.Dialer{
+			HandshakeTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// handlerTransport serves requests with a handler, in process.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.handler.ServeHTTP(w, req)
+	return w.Result(), nil
+}
+
+// NewReportClient makes a client of the API of an app serving just a
+// report, like one saved from an app, without running an app.
+func NewReportClient(rpt report.Report) *Client {
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	return &Client{
+		baseURL: "http://report",
+		client:  &http.Client{Transport: handlerTransport{router}},
+	}
+}
+
+func (c *Client) headers() http.Header {
+	headers := http.Header{}
+	if c.token != "" {
+		headers.Set("Authorization", "Bearer "+c.token)
+	}
+	return headers
+}
+
+// do makes a request of the API, with path already escaped.
+func (c *Client) do(method, path string, query url.Values, body interface{}, result interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var buf bytes.Buffer
+	if body != nil {
+		if err := codec.NewEncoder(&buf, &codec.JsonHandle{}).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header = c.headers()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(text)))
+	}
+	if result == nil {
+		return nil
+	}
+	return codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(result)
+}
+
+// Topologies gives the topologies of the app, with their sub-topologies.
+func (c *Client) Topologies() ([]app.APITopologyDesc, error) {
+	var topologies []app.APITopologyDesc
+	err := c.do("GET", "/api/topology", nil, nil, &topologies)
+	return topologies, err
+}
+
+// Topology gives the rendered nodes of a topology, of those matching a search
+// query if it is not empty.
+func (c *Client) Topology(topologyID, search string) (app.APITopology, error) {
+	query := url.Values{}
+	if search != "" {
+		query.Set("q", search)
+	}
+	var topology app.APITopology
+	err := c.do("GET", "/api/topology/"+url.PathEscape(topologyID), query, nil, &topology)
+	return topology, err
+}
+
+// Node gives the details of a node of a topology, including its controls.
+func (c *Client) Node(topologyID, nodeID string) (detailed.Node, error) {
+	var node app.APINode
+	err := c.do("GET", "/api/topology/"+url.PathEscape(topologyID)+"/"+url.PathEscape(nodeID), nil, nil, &node)
+	return node.Node, err
+}
+
+// Report gives the raw report of the app, the merger of the reports of all
+// probes.
+func (c *Client) Report() (report.Report, error) {
+	rpt := report.MakeReport()
+	err := c.do("GET", "/api/report", nil, nil, &rpt)
+	return rpt, err
+}
+
+// Top gives the n nodes of a topology with the highest values of a metric.
+func (c *Client) Top(topologyID, metric string, n int) (app.APITopConsumers, error) {
+	query := url.Values{}
+	query.Set("metric", metric)
+	query.Set("n", strconv.Itoa(n))
+	var top app.APITopConsumers
+	err := c.do("GET", "/api/topology/"+url.PathEscape(topologyID)+"/top", query, nil, &top)
+	return top, err
+}
+
+// Control runs a control of a node on its probe.
+func (c *Client) Control(probeID, nodeID, control string, args map[string]string) (xfer.Response, error) {
+	path := fmt.Sprintf("/api/control/%s/%s/%s", url.PathEscape(probeID), url.PathEscape(nodeID), url.PathEscape(control))
+	var body interface{}
+	if len(args) > 0 {
+		body = args
+	}
+	var response xfer.Response
+	err := c.do("POST", path, nil, body, &response)
+	return response, err
+}
+
+// Pipe connects to the end of a pipe of the UI.
+func (c *Client) Pipe(pipeID string) (xfer.Websocket, error) {
+	u := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/api/pipe/" + url.PathEscape(pipeID)
+	conn, _, err := xfer.DialWS(&c.wsDialer, u, c.headers())
+	return conn, err
+}
+
+// DeletePipe closes a pipe.
+func (c *Client) DeletePipe(pipeID string) error {
+	return c.do("DELETE", "/api/pipe/"+url.PathEscape(pipeID), nil, nil, nil)
+}
@@ -0,0 +1,115 @@
+package cli_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/cli"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func newClient(t *testing.T) (*cli.Client, func()) {
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(fixture.Report), nil)
+	ts := httptest.NewServer(router)
+	client, err := cli.NewClient(strings.TrimPrefix(ts.URL, "http://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, ts.Close
+}
+
+func TestQuery(t *testing.T) {
+	client, done := newClient(t)
+	defer done()
+
+	topologies, err := client.Topologies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cli.WriteTopologies(&buf, topologies)
+	if !strings.Contains(buf.String(), "containers  Containers") {
+		t.Errorf("Expected the containers topology, got\n%s", buf.String())
+	}
+
+	topology, err := client.Topology("containers", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	cli.WriteTable(&buf, topology.Nodes)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "NAME") || !strings.Contains(lines[0], "CPU") {
+		t.Fatalf("Expected a header and two containers, got\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[1], fixture.ClientContainerName) || !strings.Contains(lines[1], fixture.ClientContainerNodeID) {
+		t.Errorf("Expected the client container first, got\n%s", buf.String())
+	}
+
+	buf.Reset()
+	cli.WriteTree(&buf, topology.Nodes)
+	if !strings.Contains(buf.String(), "└── ") {
+		t.Errorf("Expected the containers under their parents, got\n%s", buf.String())
+	}
+
+	if _, err := client.Topology("foo", ""); err == nil {
+		t.Error("Expected an error for an unknown topology")
+	}
+}
+
+func TestTop(t *testing.T) {
+	client, done := newClient(t)
+	defer done()
+
+	top, err := client.Top("hosts", "cpu", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cli.WriteTop(&buf, top)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], fixture.ServerHostNodeID) {
+		t.Errorf("Expected the server host, got\n%s", buf.String())
+	}
+}
+
+func TestFindNode(t *testing.T) {
+	client, done := newClient(t)
+	defer done()
+
+	for _, node := range []string{fixture.ClientContainerNodeID, fixture.ClientContainerName} {
+		n, err := client.FindNode("containers", node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.ID != fixture.ClientContainerNodeID {
+			t.Errorf("Expected %s, got %s", fixture.ClientContainerNodeID, n.ID)
+		}
+	}
+	if _, err := client.FindNode("containers", "foo"); err == nil {
+		t.Error("Expected an error for an unknown container")
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for format, want := range map[string]string{
+		"percent":      "12.5%",
+		"filesize":     "12.5B",
+		"filesizerate": "12.5B/s",
+		"integer":      "12",
+		"":             "12.50",
+	} {
+		if have := cli.FormatValue(format, 12.5); have != want {
+			t.Errorf("Expected %q as %s, got %q", want, format, have)
+		}
+	}
+	if have := cli.FormatValue("filesize", 3*1024*1024); have != "3.0MB" {
+		t.Errorf("Expected 3.0MB, got %q", have)
+	}
+}
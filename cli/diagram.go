@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Formats of diagrams.
+const (
+	SVGFormat = "svg"
+	PNGFormat = "png"
+)
+
+// DiagramFormats write laid out topologies, with their titles, as images.
+var DiagramFormats = map[string]func(io.Writer, string, Layout) error{
+	SVGFormat: WriteSVG,
+	PNGFormat: WritePNG,
+}
+
+// maxLabelLength is how many characters of labels fit between nodes.
+const maxLabelLength = 24
+
+func truncate(label string) string {
+	runes := []rune(label)
+	if len(runes) <= maxLabelLength {
+		return label
+	}
+	return string(runes[:maxLabelLength-1]) + "…"
+}
+
+// edgeEnds gives where the line of an edge starts and ends, at the edges of
+// the circles of its nodes rather than their centers.
+func edgeEnds(from, to LayoutNode) (x1, y1, x2, y2 float64) {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return from.X, from.Y, to.X, to.Y
+	}
+	ux, uy := dx/length*nodeRadius, dy/length*nodeRadius
+	return from.X + ux, from.Y + uy, to.X - ux, to.Y - uy
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// WriteSVG writes a laid out topology as an SVG image.
+func WriteSVG(w io.Writer, title string, layout Layout) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif">`+"\n",
+		layout.Width, layout.Height, layout.Width, layout.Height)
+	buf.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="#a0a0c0"/></marker></defs>` + "\n")
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	fmt.Fprintf(&buf, `<text x="12" y="24" font-size="16" fill="#32324b">%s</text>`+"\n", escape(title))
+	for _, e := range layout.Edges {
+		from, _ := layout.Node(e.From)
+		to, _ := layout.Node(e.To)
+		x1, y1, x2, y2 := edgeEnds(from, to)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#a0a0c0" stroke-width="1.5" marker-end="url(#arrow)"/>`+"\n", x1, y1, x2, y2)
+	}
+	for _, n := range layout.Nodes {
+		dash := ""
+		if n.Pseudo {
+			dash = ` stroke-dasharray="4,3"`
+		}
+		fmt.Fprintf(&buf, `<g><title>%s</title>`, escape(n.ID))
+		fmt.Fprintf(&buf, `<circle cx="%.1f" cy="%.1f" r="%d" fill="#e8e8f8" stroke="#6c6c9c" stroke-width="2"%s/>`, n.X, n.Y, nodeRadius, dash)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" font-size="12" text-anchor="middle" fill="#32324b">%s</text>`,
+			n.X, n.Y+nodeRadius+labelLineHeight, escape(truncate(n.Label)))
+		if n.LabelMinor != "" {
+			fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" font-size="10" text-anchor="middle" fill="#8c8cac">%s</text>`,
+				n.X, n.Y+nodeRadius+2*labelLineHeight, escape(truncate(n.LabelMinor)))
+		}
+		buf.WriteString("</g>\n")
+	}
+	buf.WriteString("</svg>\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
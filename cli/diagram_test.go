@@ -0,0 +1,69 @@
+package cli_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/cli"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestMakeLayout(t *testing.T) {
+	nodes := detailed.NodeSummaries{
+		"a": {ID: "a", Label: "a", Adjacency: report.MakeIDList("b")},
+		"b": {ID: "b", Label: "b", Adjacency: report.MakeIDList("c", "missing")},
+		"c": {ID: "c", Label: "c", Adjacency: report.MakeIDList("a")},
+		"d": {ID: "d", Label: "d"},
+	}
+	layout := cli.MakeLayout(nodes)
+	if len(layout.Nodes) != 4 || len(layout.Edges) != 3 {
+		t.Fatalf("Expected 4 nodes and 3 edges, got %v", layout)
+	}
+	a, _ := layout.Node("a")
+	b, _ := layout.Node("b")
+	c, _ := layout.Node("c")
+	d, _ := layout.Node("d")
+	if !(a.Y < b.Y && b.Y < c.Y) {
+		t.Errorf("Expected a above b above c, got %v", layout.Nodes)
+	}
+	if d.Y != a.Y || d.X == a.X {
+		t.Errorf("Expected d beside a, got %v", layout.Nodes)
+	}
+	for _, n := range layout.Nodes {
+		if n.X <= 0 || n.X >= layout.Width || n.Y <= 0 || n.Y >= layout.Height {
+			t.Errorf("Expected %s within the diagram, got %v", n.ID, n)
+		}
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	topology, err := cli.NewReportClient(fixture.Report).Topology("containers", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := cli.MakeLayout(topology.Nodes)
+
+	var buf bytes.Buffer
+	if err := cli.WriteSVG(&buf, "containers", layout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "<svg") || !strings.Contains(buf.String(), ">"+fixture.ClientContainerName+"<") {
+		t.Errorf("Expected an SVG with the client container, got\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := cli.WritePNG(&buf, "containers", layout); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != int(layout.Width) || img.Bounds().Dy() != int(layout.Height) {
+		t.Errorf("Expected a %.0fx%.0f image, got %v", layout.Width, layout.Height, img.Bounds())
+	}
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// execControls are the controls of nodes which open shells in them.
+var execControls = []string{docker.ExecContainer, host.ExecHost}
+
+// FindNode finds a node of a topology by its ID, or by its label if only one
+// node has it.
+func (c *Client) FindNode(topologyID, node string) (detailed.NodeSummary, error) {
+	topology, err := c.Topology(topologyID, "")
+	if err != nil {
+		return detailed.NodeSummary{}, err
+	}
+	if n, ok := topology.Nodes[node]; ok {
+		return n, nil
+	}
+	var found []detailed.NodeSummary
+	for _, n := range topology.Nodes {
+		if n.Label == node {
+			found = append(found, n)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return detailed.NodeSummary{}, fmt.Errorf("No node %q in %s", node, topologyID)
+	case 1:
+		return found[0], nil
+	}
+	return detailed.NodeSummary{}, fmt.Errorf("%d nodes are called %q in %s, give the ID of one", len(found), node, topologyID)
+}
+
+// execControl finds the control of a node which opens a shell in it.
+func execControl(node detailed.Node) (detailed.ControlInstance, bool) {
+	for _, id := range execControls {
+		for _, control := range node.Controls {
+			if control.Control.ID == id {
+				return control, true
+			}
+		}
+	}
+	return detailed.ControlInstance{}, false
+}
+
+// Exec opens a shell in a node of a topology, like a container or a host,
+// and attaches the terminal to it until it exits.
+func (c *Client) Exec(topologyID, node string, stdin *os.File, stdout io.Writer) error {
+	summary, err := c.FindNode(topologyID, node)
+	if err != nil {
+		return err
+	}
+	details, err := c.Node(topologyID, summary.ID)
+	if err != nil {
+		return err
+	}
+	control, ok := execControl(details)
+	if !ok {
+		return fmt.Errorf("Cannot exec in %s: it has no shell control", summary.Label)
+	}
+	resp, err := c.Control(control.ProbeID, control.NodeID, control.Control.ID, nil)
+	if err != nil {
+		return err
+	}
+	if resp.Pipe == "" {
+		return fmt.Errorf("Cannot exec in %s: no pipe was opened", summary.Label)
+	}
+	defer c.DeletePipe(resp.Pipe)
+
+	conn, err := c.Pipe(resp.Pipe)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fd := int(stdin.Fd())
+	if resp.RawTTY && terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, state)
+
+		resize := func() {
+			width, height, err := terminal.GetSize(fd)
+			if err != nil {
+				return
+			}
+			c.resize(conn, control.ProbeID, control.NodeID, resp, width, height)
+		}
+		resize()
+		if len(resizeSignals) > 0 {
+			winch := make(chan os.Signal, 1)
+			signal.Notify(winch, resizeSignals...)
+			defer signal.Stop(winch)
+			go func() {
+				for range winch {
+					resize()
+				}
+			}()
+		}
+	}
+	return attach(conn, stdin, stdout)
+}
+
+// resize tells the far end of a pipe the size of the terminal, with a pipe
+// control if it handles them, or else with the resize control of the node.
+func (c *Client) resize(conn xfer.Websocket, probeID, nodeID string, resp xfer.Response, width, height int) {
+	if resp.PipeControls {
+		var buf []byte
+		codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(xfer.PipeControl{
+			Type:   xfer.ResizePipeControl,
+			Height: uint(height),
+			Width:  uint(width),
+		})
+		conn.WriteMessage(websocket.TextMessage, buf)
+		return
+	}
+	if resp.ResizeTTYControl != "" {
+		c.Control(probeID, nodeID, resp.ResizeTTYControl, map[string]string{
+			"pipeID": resp.Pipe,
+			"height": strconv.Itoa(height),
+			"width":  strconv.Itoa(width),
+		})
+	}
+}
+
+// attach copies stdin to a pipe, and the pipe to stdout, until the pipe
+// closes.
+func attach(conn xfer.Websocket, stdin io.Reader, stdout io.Writer) error {
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		_, buf, err := conn.ReadMessage()
+		if xfer.IsExpectedWSCloseError(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+}
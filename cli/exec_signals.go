@@ -0,0 +1,11 @@
+// +build !windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+// resizeSignals tell the terminal of a shell has been resized.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
@@ -0,0 +1,9 @@
+package cli
+
+import (
+	"os"
+)
+
+// resizeSignals tell the terminal of a shell has been resized. Windows
+// consoles don't signal resizes, so shells keep the size they start with.
+var resizeSignals []os.Signal
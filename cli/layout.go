@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"sort"
+
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// Spacing of laid out nodes, in pixels.
+const (
+	nodeRadius      = 18
+	nodeSpacing     = 170
+	rankSpacing     = 130
+	layoutMargin    = 90
+	maxRowNodes     = 10
+	orderingPasses  = 4
+	labelLineHeight = 14
+)
+
+// LayoutNode is a node placed in a diagram.
+type LayoutNode struct {
+	ID         string
+	Label      string
+	LabelMinor string
+	Pseudo     bool
+	X, Y       float64
+}
+
+// LayoutEdge is an edge between two placed nodes.
+type LayoutEdge struct {
+	From, To string
+}
+
+// Layout is a topology laid out as a diagram.
+type Layout struct {
+	Width, Height float64
+	Nodes         []LayoutNode
+	Edges         []LayoutEdge
+	index         map[string]int
+}
+
+// Node gives a placed node by its ID.
+func (l Layout) Node(id string) (LayoutNode, bool) {
+	i, ok := l.index[id]
+	if !ok {
+		return LayoutNode{}, false
+	}
+	return l.Nodes[i], true
+}
+
+// MakeLayout lays out the nodes of a topology in layers, like Graphviz's dot
+// does: each node is ranked below the nodes with edges to it, cycles aside,
+// and the nodes of each rank are ordered by the mean position of their
+// neighbours, to cross fewer edges. Ranks wider than maxRowNodes are wrapped
+// into several rows.
+func MakeLayout(nodes detailed.NodeSummaries) Layout {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		edges = []LayoutEdge{}
+		out   = map[string][]string{}
+		in    = map[string][]string{}
+	)
+	for _, id := range ids {
+		adjacency := append([]string{}, nodes[id].Adjacency...)
+		sort.Strings(adjacency)
+		for _, to := range adjacency {
+			if _, ok := nodes[to]; !ok || to == id {
+				continue
+			}
+			edges = append(edges, LayoutEdge{From: id, To: to})
+			out[id] = append(out[id], to)
+			in[to] = append(in[to], id)
+		}
+	}
+
+	ranks := rankNodes(ids, out)
+	layers := [][]string{}
+	for _, id := range ids {
+		for len(layers) <= ranks[id] {
+			layers = append(layers, nil)
+		}
+		layers[ranks[id]] = append(layers[ranks[id]], id)
+	}
+	orderLayers(layers, in, out)
+
+	// Wrap the wide layers into rows
+	rows := [][]string{}
+	for _, layer := range layers {
+		for start := 0; start < len(layer); start += maxRowNodes {
+			end := start + maxRowNodes
+			if end > len(layer) {
+				end = len(layer)
+			}
+			rows = append(rows, layer[start:end])
+		}
+	}
+
+	widest := 1
+	for _, row := range rows {
+		if len(row) > widest {
+			widest = len(row)
+		}
+	}
+	layout := Layout{
+		Width:  float64(2*layoutMargin + (widest-1)*nodeSpacing),
+		Height: float64(2*layoutMargin + (len(rows)-1)*rankSpacing),
+		Edges:  edges,
+		index:  map[string]int{},
+	}
+	if len(rows) == 0 {
+		layout.Height = 2 * layoutMargin
+	}
+	for r, row := range rows {
+		// Center each row
+		offset := float64((widest-len(row))*nodeSpacing) / 2
+		for i, id := range row {
+			n := nodes[id]
+			layout.index[id] = len(layout.Nodes)
+			layout.Nodes = append(layout.Nodes, LayoutNode{
+				ID:         id,
+				Label:      n.Label,
+				LabelMinor: n.LabelMinor,
+				Pseudo:     n.Pseudo,
+				X:          layoutMargin + offset + float64(i*nodeSpacing),
+				Y:          float64(layoutMargin + r*rankSpacing),
+			})
+		}
+	}
+	return layout
+}
+
+// rankNodes ranks nodes by the longest path to them, ignoring the edges
+// which close cycles, as found by a depth first search.
+func rankNodes(ids []string, out map[string][]string) map[string]int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		state = map[string]int{}
+		order = []string{} // reverse topological order
+		dag   = map[string][]string{}
+		visit func(string)
+	)
+	visit = func(id string) {
+		state[id] = visiting
+		for _, to := range out[id] {
+			switch state[to] {
+			case unvisited:
+				dag[id] = append(dag[id], to)
+				visit(to)
+			case visited:
+				dag[id] = append(dag[id], to)
+			}
+			// Edges to nodes being visited close cycles
+		}
+		state[id] = visited
+		order = append(order, id)
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	ranks := map[string]int{}
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		for _, to := range dag[id] {
+			if ranks[id]+1 > ranks[to] {
+				ranks[to] = ranks[id] + 1
+			}
+		}
+	}
+	return ranks
+}
+
+// orderLayers orders the nodes of each layer by the mean positions of their
+// neighbours in the layer above, then below, a few times over.
+func orderLayers(layers [][]string, in, out map[string][]string) {
+	position := map[string]int{}
+	record := func(layer []string) {
+		for i, id := range layer {
+			position[id] = i
+		}
+	}
+	for _, layer := range layers {
+		record(layer)
+	}
+	reorder := func(layer []string, neighbours map[string][]string) {
+		barycenters := map[string]float64{}
+		for _, id := range layer {
+			sum, count := 0.0, 0
+			for _, n := range neighbours[id] {
+				sum += float64(position[n])
+				count++
+			}
+			if count == 0 {
+				barycenters[id] = float64(position[id])
+			} else {
+				barycenters[id] = sum / float64(count)
+			}
+		}
+		sort.SliceStable(layer, func(i, j int) bool {
+			return barycenters[layer[i]] < barycenters[layer[j]]
+		})
+		record(layer)
+	}
+	for pass := 0; pass < orderingPasses; pass++ {
+		for i := 1; i < len(layers); i++ {
+			reorder(layers[i], in)
+		}
+		for i := len(layers) - 2; i >= 0; i-- {
+			reorder(layers[i], out)
+		}
+	}
+}
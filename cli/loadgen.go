@@ -0,0 +1,274 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// Load configures the reports a Generator fabricates.
+type Load struct {
+	Hosts       int
+	Containers  int     // per host
+	Processes   int     // per container
+	Connections int     // from each container, to others
+	Images      int     // in all
+	Churn       float64 // the share of containers replaced at each step
+}
+
+// serverPort is the port the containers of generated reports listen on.
+const serverPort = "80"
+
+type loadContainer struct {
+	id, name, image, ip string
+	pids                []int
+}
+
+type loadHost struct {
+	name       string
+	id         string
+	containers []*loadContainer
+}
+
+// Generator fabricates the reports of the probes of a cluster, which it
+// churns step by step: containers stop and others start in their place.
+type Generator struct {
+	load       Load
+	rand       *rand.Rand
+	hosts      []*loadHost
+	containers []*loadContainer // of all hosts
+	created    int
+}
+
+// NewGenerator makes a generator of reports, seeded by seed.
+func NewGenerator(load Load, seed int64) *Generator {
+	g := &Generator{load: load, rand: rand.New(rand.NewSource(seed))}
+	if g.load.Images <= 0 {
+		g.load.Images = 1
+	}
+	for h := 0; h < load.Hosts; h++ {
+		name := fmt.Sprintf("loadgen-host-%d", h)
+		lh := &loadHost{name: name, id: name}
+		for c := 0; c < load.Containers; c++ {
+			lh.containers = append(lh.containers, g.newContainer(h))
+		}
+		g.hosts = append(g.hosts, lh)
+	}
+	g.index()
+	return g
+}
+
+func (g *Generator) newContainer(hostIndex int) *loadContainer {
+	g.created++
+	c := &loadContainer{
+		id:    fmt.Sprintf("%016x%016x%016x%016x", g.rand.Int63(), g.rand.Int63(), g.rand.Int63(), g.rand.Int63()),
+		name:  fmt.Sprintf("loadgen-%d", g.created),
+		image: fmt.Sprintf("loadgen/image-%d", g.rand.Intn(g.load.Images)),
+		// 10.<host>.<n>, numbered by when they were created
+		ip: fmt.Sprintf("10.%d.%d.%d", hostIndex%256, (g.created/256)%256, g.created%256),
+	}
+	for p := 0; p < g.load.Processes; p++ {
+		c.pids = append(c.pids, 1000*g.created+p)
+	}
+	return c
+}
+
+func (g *Generator) index() {
+	g.containers = g.containers[:0]
+	for _, h := range g.hosts {
+		g.containers = append(g.containers, h.containers...)
+	}
+}
+
+// Step churns the containers: each is replaced by a new one with a chance
+// of the churn rate of the load.
+func (g *Generator) Step() {
+	for i, h := range g.hosts {
+		for j := range h.containers {
+			if g.rand.Float64() < g.load.Churn {
+				h.containers[j] = g.newContainer(i)
+			}
+		}
+	}
+	g.index()
+}
+
+// ProbeID gives the ID of the probe of a host.
+func (g *Generator) ProbeID(hostIndex int) string {
+	return fmt.Sprintf("loadgen-probe-%d", hostIndex)
+}
+
+// peers gives the containers a container connects to. They are picked by
+// its ID, so they only change as the containers churn.
+func (g *Generator) peers(c *loadContainer) []*loadContainer {
+	hash := fnv.New64a()
+	hash.Write([]byte(c.id))
+	r := rand.New(rand.NewSource(int64(hash.Sum64())))
+	peers := []*loadContainer{}
+	for i := 0; i < g.load.Connections && len(g.containers) > 1; i++ {
+		if peer := g.containers[r.Intn(len(g.containers))]; peer != c {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func (g *Generator) metric(now time.Time, max float64) report.Metric {
+	return report.MakeSingletonMetric(now, g.rand.Float64()*max).WithMax(max)
+}
+
+// Report fabricates the report of the probe of a host, as of now.
+func (g *Generator) Report(hostIndex int, now time.Time) report.Report {
+	h := g.hosts[hostIndex]
+	hostNodeID := report.MakeHostNodeID(h.id)
+	rpt := report.MakeReport()
+	rpt.Host = rpt.Host.WithMetadataTemplates(host.MetadataTemplates).WithMetricTemplates(host.MetricTemplates)
+	rpt.Container = rpt.Container.WithMetadataTemplates(docker.ContainerMetadataTemplates).WithMetricTemplates(docker.ContainerMetricTemplates)
+	rpt.ContainerImage = rpt.ContainerImage.WithMetadataTemplates(docker.ContainerImageMetadataTemplates)
+	rpt.Process = rpt.Process.WithMetadataTemplates(process.MetadataTemplates).WithMetricTemplates(process.MetricTemplates)
+
+	const hostMemory = 16 << 30
+	rpt.Host.AddNode(report.MakeNodeWith(hostNodeID, map[string]string{
+		report.HostNodeID:     hostNodeID,
+		report.ControlProbeID: g.ProbeID(hostIndex),
+		host.HostName:         h.name,
+		host.OS:               "linux",
+	}).WithSets(report.MakeSets().
+		Add(host.LocalNetworks, report.MakeStringSet("10.0.0.0/8")),
+	).WithMetrics(report.Metrics{
+		host.CPUUsage:    g.metric(now, 100),
+		host.MemoryUsage: g.metric(now, hostMemory),
+		host.Load1:       g.metric(now, 8),
+	}))
+
+	for _, c := range h.containers {
+		containerNodeID := report.MakeContainerNodeID(c.id)
+		imageNodeID := report.MakeContainerImageNodeID(c.image)
+		rpt.ContainerImage.AddNode(report.MakeNodeWith(imageNodeID, map[string]string{
+			docker.ImageID:    c.image,
+			docker.ImageName:  c.image,
+			report.HostNodeID: hostNodeID,
+		}).WithParents(report.MakeSets().
+			Add(report.Host, report.MakeStringSet(hostNodeID)),
+		))
+		rpt.Container.AddNode(report.MakeNodeWith(containerNodeID, map[string]string{
+			docker.ContainerID:         c.id,
+			docker.ContainerName:       c.name,
+			docker.ContainerHostname:   c.name,
+			docker.ContainerState:      docker.StateRunning,
+			docker.ContainerStateHuman: docker.StateRunning,
+			docker.ImageID:             c.image,
+			report.HostNodeID:          hostNodeID,
+		}).WithSets(report.MakeSets().
+			Add(docker.ContainerIPs, report.MakeStringSet(c.ip)),
+		).WithParents(report.MakeSets().
+			Add(report.Host, report.MakeStringSet(hostNodeID)).
+			Add(report.ContainerImage, report.MakeStringSet(imageNodeID)),
+		).WithMetrics(report.Metrics{
+			docker.CPUTotalUsage: g.metric(now, 100),
+			docker.MemoryUsage:   g.metric(now, hostMemory/float64(len(h.containers))),
+		}))
+
+		for _, pid := range c.pids {
+			rpt.Process.AddNode(report.MakeNodeWith(report.MakeProcessNodeID(h.id, strconv.Itoa(pid)), map[string]string{
+				process.PID:        strconv.Itoa(pid),
+				process.Name:       "loadgen",
+				docker.ContainerID: c.id,
+				report.HostNodeID:  hostNodeID,
+			}).WithParents(report.MakeSets().
+				Add(report.Host, report.MakeStringSet(hostNodeID)).
+				Add(report.Container, report.MakeStringSet(containerNodeID)),
+			).WithMetrics(report.Metrics{
+				process.CPUUsage:    g.metric(now, 100),
+				process.MemoryUsage: g.metric(now, 1<<30),
+			}))
+		}
+		if len(c.pids) == 0 {
+			continue
+		}
+
+		// The first process of each container serves, and connects to the
+		// servers of its peers
+		pid := strconv.Itoa(c.pids[0])
+		rpt.Endpoint.AddNode(report.MakeNodeWith(report.MakeEndpointNodeID(h.id, "", c.ip, serverPort), map[string]string{
+			process.PID:       pid,
+			report.HostNodeID: hostNodeID,
+		}))
+		for i, peer := range g.peers(c) {
+			port := strconv.Itoa(30000 + i)
+			rpt.Endpoint.AddNode(report.MakeNodeWith(report.MakeEndpointNodeID(h.id, "", c.ip, port), map[string]string{
+				process.PID:       pid,
+				report.HostNodeID: hostNodeID,
+			}).WithAdjacent(report.MakeEndpointNodeID(h.id, "", peer.ip, serverPort)))
+		}
+	}
+	return rpt
+}
+
+// Publish sends a report to the app, as the probe probeID would.
+func (c *Client) Publish(probeID string, rpt report.Report) error {
+	var buf bytes.Buffer
+	if err := rpt.WriteBinary(&buf, gzip.BestSpeed); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.baseURL+"/api/report", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", xfer.GzipEncoding)
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set(xfer.ScopeProbeIDHeader, probeID)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Scope-Probe token="+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST /api/report: %s", resp.Status)
+	}
+	return nil
+}
+
+// PublishAll publishes the reports of all the hosts of a generator at once,
+// as their probes would, and gives how many nodes they had.
+func (c *Client) PublishAll(g *Generator, now time.Time) (int, error) {
+	var (
+		wg    sync.WaitGroup
+		mtx   sync.Mutex
+		nodes int
+		errs  []error
+	)
+	for i := range g.hosts {
+		rpt := g.Report(i, now)
+		nodes += len(rpt.Host.Nodes) + len(rpt.Container.Nodes) + len(rpt.Process.Nodes) + len(rpt.Endpoint.Nodes)
+		wg.Add(1)
+		go func(probeID string) {
+			defer wg.Done()
+			if err := c.Publish(probeID, rpt); err != nil {
+				mtx.Lock()
+				errs = append(errs, err)
+				mtx.Unlock()
+			}
+		}(g.ProbeID(i))
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nodes, fmt.Errorf("%d of %d reports failed: %v", len(errs), len(g.hosts), errs[0])
+	}
+	return nodes, nil
+}
@@ -0,0 +1,79 @@
+package cli_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/cli"
+	"github.com/weaveworks/scope/render"
+)
+
+func TestGenerator(t *testing.T) {
+	load := cli.Load{Hosts: 2, Containers: 5, Processes: 2, Connections: 2, Images: 3, Churn: 0.5}
+	g := cli.NewGenerator(load, 1)
+	now := time.Now()
+	rpt := g.Report(0, now)
+	if len(rpt.Host.Nodes) != 1 || len(rpt.Container.Nodes) != 5 || len(rpt.Process.Nodes) != 10 {
+		t.Fatalf("Expected 1 host, 5 containers and 10 processes, got %d, %d and %d",
+			len(rpt.Host.Nodes), len(rpt.Container.Nodes), len(rpt.Process.Nodes))
+	}
+	for id := range cli.NewGenerator(load, 1).Report(0, now).Container.Nodes {
+		if _, ok := rpt.Container.Nodes[id]; !ok {
+			t.Errorf("Expected the same seed to generate the same containers, got %s", id)
+		}
+	}
+
+	g.Step()
+	churned := g.Report(0, now)
+	same := 0
+	for id := range churned.Container.Nodes {
+		if _, ok := rpt.Container.Nodes[id]; ok {
+			same++
+		}
+	}
+	if len(churned.Container.Nodes) != 5 || same == 5 {
+		t.Errorf("Expected some of 5 containers to churn, %d of %d stayed", same, len(churned.Container.Nodes))
+	}
+}
+
+func TestPublishAll(t *testing.T) {
+	collector := app.NewCollector(time.Minute)
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterReportPostHandler(collector, router, nil, nil)
+	app.RegisterTopologyRoutes(router, collector, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client, err := cli.NewClient(ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := cli.NewGenerator(cli.Load{Hosts: 3, Containers: 4, Processes: 1, Connections: 2}, 1)
+	if _, err := client.PublishAll(g, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rpt, err := collector.Report(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Host.Nodes) != 3 || len(rpt.Container.Nodes) != 12 {
+		t.Errorf("Expected 3 hosts and 12 containers, got %d and %d", len(rpt.Host.Nodes), len(rpt.Container.Nodes))
+	}
+
+	// The containers connect to each other, not the internet
+	edges := 0
+	for _, n := range render.ContainerWithImageNameRenderer.Render(rpt, nil) {
+		if !render.IsNotPseudo(n) {
+			t.Errorf("Expected no pseudo nodes, got %s", n.ID)
+		}
+		edges += len(n.Adjacency)
+	}
+	if edges == 0 {
+		t.Error("Expected connections between containers")
+	}
+}
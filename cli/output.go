@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Output formats of topologies.
+const (
+	TableFormat = "table"
+	TreeFormat  = "tree"
+	JSONFormat  = "json"
+)
+
+const (
+	treeBranch     = "├── "
+	treeLastBranch = "└── "
+)
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// FormatValue formats the value of a metric as the UI does, roughly.
+func FormatValue(format string, value float64) string {
+	switch format {
+	case report.PercentFormat:
+		return fmt.Sprintf("%.1f%%", value)
+	case report.IntegerFormat:
+		return fmt.Sprintf("%.0f", value)
+	case report.FilesizeFormat:
+		return formatBytes(value)
+	case report.FilesizeRateFormat:
+		return formatBytes(value) + "/s"
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+func formatBytes(value float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
+
+// sortedNodes gives the nodes of a topology, except the pseudo ones, like the
+// internet, by label.
+func sortedNodes(nodes detailed.NodeSummaries) []detailed.NodeSummary {
+	result := make([]detailed.NodeSummary, 0, len(nodes))
+	for _, n := range nodes {
+		if !n.Pseudo {
+			result = append(result, n)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Label != result[j].Label {
+			return result[i].Label < result[j].Label
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// WriteTable writes the nodes of a topology as a table, with a column for
+// each of their metrics.
+func WriteTable(w io.Writer, nodes detailed.NodeSummaries) error {
+	sorted := sortedNodes(nodes)
+	metrics := map[string]report.MetricRow{}
+	for _, n := range sorted {
+		for _, m := range n.Metrics {
+			metrics[m.ID] = m
+		}
+	}
+	columns := make([]report.MetricRow, 0, len(metrics))
+	for _, m := range metrics {
+		columns = append(columns, m)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if columns[i].Priority != columns[j].Priority {
+			return columns[i].Priority < columns[j].Priority
+		}
+		return columns[i].ID < columns[j].ID
+	})
+
+	tw := newTabWriter(w)
+	header := []string{"NAME", "DETAIL"}
+	for _, m := range columns {
+		header = append(header, strings.ToUpper(m.Label))
+	}
+	fmt.Fprintln(tw, strings.Join(append(header, "ID"), "\t"))
+	for _, n := range sorted {
+		values := map[string]string{}
+		for _, m := range n.Metrics {
+			if !m.ValueEmpty {
+				values[m.ID] = FormatValue(m.Format, m.Value)
+			}
+		}
+		row := []string{n.Label, n.LabelMinor}
+		for _, m := range columns {
+			if v, ok := values[m.ID]; ok {
+				row = append(row, v)
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(append(row, n.ID), "\t"))
+	}
+	return tw.Flush()
+}
+
+// WriteTree writes the nodes of a topology as a tree, under their first
+// parents, like the containers of each host.
+func WriteTree(w io.Writer, nodes detailed.NodeSummaries) error {
+	var (
+		parents  = []detailed.Parent{}
+		children = map[string][]detailed.NodeSummary{}
+		orphans  = []detailed.NodeSummary{}
+	)
+	for _, n := range sortedNodes(nodes) {
+		if len(n.Parents) == 0 {
+			orphans = append(orphans, n)
+			continue
+		}
+		parent := n.Parents[0]
+		if _, ok := children[parent.ID]; !ok {
+			parents = append(parents, parent)
+		}
+		children[parent.ID] = append(children[parent.ID], n)
+	}
+	sort.Slice(parents, func(i, j int) bool {
+		if parents[i].Label != parents[j].Label {
+			return parents[i].Label < parents[j].Label
+		}
+		return parents[i].ID < parents[j].ID
+	})
+	for _, parent := range parents {
+		fmt.Fprintf(w, "%s (%s)\n", parent.Label, parent.TopologyID)
+		lines := []string{}
+		for _, n := range children[parent.ID] {
+			lines = append(lines, nodeLine(n))
+		}
+		writeBranches(w, lines)
+	}
+	for _, n := range orphans {
+		fmt.Fprintln(w, nodeLine(n))
+	}
+	return nil
+}
+
+func nodeLine(n detailed.NodeSummary) string {
+	if n.LabelMinor == "" {
+		return n.Label
+	}
+	return n.Label + "  " + n.LabelMinor
+}
+
+// writeBranches writes lines as the branches of a tree.
+func writeBranches(w io.Writer, lines []string) {
+	for i, line := range lines {
+		branch := treeBranch
+		if i == len(lines)-1 {
+			branch = treeLastBranch
+		}
+		fmt.Fprintln(w, branch+line)
+	}
+}
+
+// topologyID gives the ID of a topology from its URL, like containers of
+// /api/topology/containers.
+func topologyID(t app.APITopologyDesc) string {
+	return t.URL[strings.LastIndex(t.URL, "/")+1:]
+}
+
+func topologyLine(t app.APITopologyDesc) string {
+	return fmt.Sprintf("%s  %s (%d nodes)", topologyID(t), t.Name, t.Stats.NonpseudoNodeCount)
+}
+
+// WriteTopologies writes the topologies of the app as a tree, with their
+// sub-topologies under them.
+func WriteTopologies(w io.Writer, topologies []app.APITopologyDesc) error {
+	for _, t := range topologies {
+		fmt.Fprintln(w, topologyLine(t))
+		lines := []string{}
+		for _, sub := range t.SubTopologies {
+			lines = append(lines, topologyLine(sub))
+		}
+		writeBranches(w, lines)
+	}
+	return nil
+}
+
+// WriteTop writes the top consumers of a metric as a table.
+func WriteTop(w io.Writer, top app.APITopConsumers) error {
+	tw := newTabWriter(w)
+	fmt.Fprintf(tw, "NAME\tDETAIL\t%s\tID\n", strings.ToUpper(top.Label))
+	for _, n := range top.Nodes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", n.Label, n.LabelMinor, FormatValue(top.Format, n.Value), n.ID)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+var (
+	backgroundColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	edgeColor       = color.RGBA{0xa0, 0xa0, 0xc0, 0xff}
+	nodeFillColor   = color.RGBA{0xe8, 0xe8, 0xf8, 0xff}
+	nodeStrokeColor = color.RGBA{0x6c, 0x6c, 0x9c, 0xff}
+	labelColor      = color.RGBA{0x32, 0x32, 0x4b, 0xff}
+	labelMinorColor = color.RGBA{0x8c, 0x8c, 0xac, 0xff}
+)
+
+// Glyphs are 5 pixels wide, and 7 high.
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphSpacing = 1
+)
+
+// glyphs is a tiny bitmap font, as there are none in the standard library:
+// each glyph is its rows, the highest bit of the five the leftmost pixel.
+// Letters are all drawn in upper case.
+var glyphs = map[rune][glyphHeight]uint8{
+	'A': {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B': {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C': {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D': {0x1e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1e},
+	'E': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G': {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H': {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M': {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P': {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q': {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R': {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S': {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X': {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x04},
+	'Z': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'-': {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'?': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	' ': {},
+}
+
+type canvas struct {
+	*image.RGBA
+}
+
+func (c canvas) line(x1, y1, x2, y2 float64, col color.Color) {
+	steps := int(math.Max(math.Abs(x2-x1), math.Abs(y2-y1)))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		c.Set(int(math.Round(x1+t*(x2-x1))), int(math.Round(y1+t*(y2-y1))), col)
+	}
+}
+
+// arrow draws an edge, with its head at x2, y2.
+func (c canvas) arrow(x1, y1, x2, y2 float64) {
+	c.line(x1, y1, x2, y2, edgeColor)
+	angle := math.Atan2(y2-y1, x2-x1)
+	for _, side := range []float64{-0.4, 0.4} {
+		c.line(x2, y2, x2-8*math.Cos(angle+side), y2-8*math.Sin(angle+side), edgeColor)
+	}
+}
+
+func (c canvas) circle(cx, cy, r float64, dashed bool) {
+	for y := cy - r - 1; y <= cy+r+1; y++ {
+		for x := cx - r - 1; x <= cx+r+1; x++ {
+			d := math.Hypot(x-cx, y-cy)
+			switch {
+			case d <= r-2:
+				c.Set(int(x), int(y), nodeFillColor)
+			case d <= r:
+				// Dashes every 30 degrees
+				if !dashed || int(math.Floor((math.Atan2(y-cy, x-cx)+math.Pi)/(math.Pi/6)))%2 == 0 {
+					c.Set(int(x), int(y), nodeStrokeColor)
+				}
+			}
+		}
+	}
+}
+
+// text draws text centered on x, with its top at y.
+func (c canvas) text(s string, x, y float64, col color.Color) {
+	s = strings.Replace(strings.ToUpper(s), "…", "..", -1)
+	runes := []rune(s)
+	left := int(x) - (len(runes)*(glyphWidth+glyphSpacing)-glyphSpacing)/2
+	for i, r := range runes {
+		glyph, ok := glyphs[r]
+		if !ok {
+			glyph = glyphs['?']
+		}
+		for row, bits := range glyph {
+			for px := 0; px < glyphWidth; px++ {
+				if bits&(1<<uint(glyphWidth-1-px)) != 0 {
+					c.Set(left+i*(glyphWidth+glyphSpacing)+px, int(y)+row, col)
+				}
+			}
+		}
+	}
+}
+
+// WritePNG writes a laid out topology as a PNG image.
+func WritePNG(w io.Writer, title string, layout Layout) error {
+	c := canvas{image.NewRGBA(image.Rect(0, 0, int(layout.Width), int(layout.Height)))}
+	draw.Draw(c, c.Bounds(), image.NewUniform(backgroundColor), image.ZP, draw.Src)
+	c.text(title, 12+float64(len([]rune(title))*(glyphWidth+glyphSpacing))/2, 12, labelColor)
+	for _, e := range layout.Edges {
+		from, _ := layout.Node(e.From)
+		to, _ := layout.Node(e.To)
+		c.arrow(edgeEnds(from, to))
+	}
+	for _, n := range layout.Nodes {
+		c.circle(n.X, n.Y, nodeRadius, n.Pseudo)
+		c.text(truncate(n.Label), n.X, n.Y+nodeRadius+labelLineHeight-glyphHeight, labelColor)
+		if n.LabelMinor != "" {
+			c.text(truncate(n.LabelMinor), n.X, n.Y+nodeRadius+2*labelLineHeight-glyphHeight, labelMinorColor)
+		}
+	}
+	return png.Encode(w, c)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RecordingExtension is the extension of the reports of recordings, which
+// are named after when they were recorded, in nanoseconds since the epoch,
+// so the file collector of the app replays them in order.
+const RecordingExtension = ".msgpack.gz"
+
+// Record writes the report of the app to a directory every interval, until
+// it has recorded for duration or stop is closed, and gives how many
+// reports it wrote.
+func (c *Client) Record(dir string, interval, duration time.Duration, stop <-chan struct{}) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+	count := 0
+	for {
+		rpt, err := c.Report()
+		if err != nil {
+			return count, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d%s", time.Now().UnixNano(), RecordingExtension))
+		if err := rpt.WriteToFile(path, gzip.DefaultCompression); err != nil {
+			return count, err
+		}
+		count++
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return count, nil
+		case <-stop:
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cli_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/cli"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	count, err := cli.NewReportClient(fixture.Report).Record(dir, 10*time.Millisecond, 35*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+cli.RecordingExtension))
+	if count < 2 || len(files) != count {
+		t.Fatalf("Expected a few reports, recorded %d, got %v", count, files)
+	}
+
+	if _, err := app.NewFileCollector(dir, time.Minute, 0); err == nil {
+		t.Error("Expected a replay speed of 0 to be refused")
+	}
+	collector, err := app.NewFileCollector(dir, time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rpt, err := collector.Report(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rpt.Container.Nodes[fixture.ClientContainerNodeID]; ok {
+			return
+		}
+	}
+	t.Error("Expected the recorded containers to be replayed")
+}
@@ -287,6 +287,13 @@ export function setViewportDimensions(width, height) {
   };
 }
 
+export function setMetricHistoryRange(range) {
+  return (dispatch, getState) => {
+    dispatch({ type: ActionTypes.SET_METRIC_HISTORY_RANGE, range });
+    getNodeDetails(getState, dispatch);
+  };
+}
+
 export function setGraphView() {
   return (dispatch, getState) => {
     dispatch({
@@ -534,10 +541,11 @@ export function receiveControlError(nodeId, err) {
   };
 }
 
-export function receiveControlSuccess(nodeId) {
+export function receiveControlSuccess(nodeId, tables) {
   return {
     type: ActionTypes.DO_CONTROL_SUCCESS,
-    nodeId
+    nodeId,
+    tables
   };
 }
 
@@ -679,17 +687,19 @@ export function receiveControlNodeRemoved(nodeId) {
   };
 }
 
-export function receiveControlPipeFromParams(pipeId, rawTty, resizeTtyControl) {
+export function receiveControlPipeFromParams(pipeId, rawTty, resizeTtyControl, pipeControls) {
   // TODO add nodeId
   return {
     type: ActionTypes.RECEIVE_CONTROL_PIPE,
     pipeId,
     rawTty,
-    resizeTtyControl
+    resizeTtyControl,
+    pipeControls
   };
 }
 
-export function receiveControlPipe(pipeId, nodeId, rawTty, resizeTtyControl, control) {
+export function receiveControlPipe(pipeId, nodeId, rawTty, resizeTtyControl, pipeControls,
+  control) {
   return (dispatch, getState) => {
     const state = getState();
     if (state.get('nodeDetails').last()
@@ -710,6 +720,7 @@ export function receiveControlPipe(pipeId, nodeId, rawTty, resizeTtyControl, con
       pipeId,
       rawTty,
       resizeTtyControl,
+      pipeControls,
       control
     });
 
@@ -14,10 +14,10 @@ class Edge extends React.Component {
 
   render() {
     const {
-      id, path, highlighted, focused, thickness, source, target
+      id, path, highlighted, focused, thickness, source, target, attempted
     } = this.props;
     const shouldRenderMarker = (focused || highlighted) && (source !== target);
-    const className = classNames('edge', { highlighted });
+    const className = classNames('edge', { highlighted, attempted });
 
     return (
       <g
@@ -4,7 +4,7 @@ import classnames from 'classnames';
 import { Map as makeMap, List as makeList } from 'immutable';
 
 import { clickNode, enterNode, leaveNode } from '../actions/app-actions';
-import { getNodeColor } from '../utils/color-utils';
+import { getNodeColor, getStatusColor } from '../utils/color-utils';
 import MatchedText from '../components/matched-text';
 import MatchedResults from '../components/matched-results';
 import { trackAnalyticsEvent } from '../utils/tracking-utils';
@@ -105,11 +105,11 @@ class Node extends React.Component {
   render() {
     const {
       focused, highlighted, networks, pseudo, rank, label, transform,
-      exportingGraph, showingNetworks, stack, id, metric
+      exportingGraph, showingNetworks, stack, id, metric, status
     } = this.props;
     const { hovered } = this.state;
 
-    const color = getNodeColor(rank, label, pseudo);
+    const color = getStatusColor(status) || getNodeColor(rank, label, pseudo);
     const truncate = !focused && !hovered;
     const labelOffsetY = (showingNetworks && networks) ? 40 : 28;
 
@@ -163,6 +163,7 @@ class NodesChartElements extends React.Component {
         labelMinor={node.get('labelMinor')}
         pseudo={node.get('pseudo')}
         rank={node.get('rank')}
+        status={node.get('status')}
         dx={node.get('x')}
         dy={node.get('y')}
         scale={node.get('scale')}
@@ -183,6 +184,7 @@ class NodesChartElements extends React.Component {
         waypoints={edge.get('points')}
         highlighted={edge.get('highlighted')}
         focused={edge.get('focused')}
+        attempted={edge.get('attempted')}
         scale={edge.get('scale')}
         isAnimated={isAnimated}
       />
@@ -165,7 +165,10 @@ class NodeDetails extends React.Component {
     } = this.props;
     const showControls = details.controls && details.controls.length > 0;
     const nodeColor = getNodeColorDark(details.rank, details.label, details.pseudo);
-    const {error, pending} = nodeControlStatus ? nodeControlStatus.toJS() : {};
+    const {
+      error, pending, tables: controlTables
+    } = nodeControlStatus ? nodeControlStatus.toJS() : {};
+    const tables = (details.tables || []).concat(controlTables || []);
     const tools = this.renderTools();
     const styles = {
       controls: {
@@ -236,7 +239,7 @@ class NodeDetails extends React.Component {
             </div>
           ))}
 
-          {details.tables && details.tables.length > 0 && details.tables.map((table) => {
+          {tables.length > 0 && tables.map((table) => {
             if (table.rows.length > 0) {
               return (
                 <div className="node-details-content-section" key={table.id}>
@@ -0,0 +1,42 @@
+import React from 'react';
+import { connect } from 'react-redux';
+import classNames from 'classnames';
+
+import { setMetricHistoryRange } from '../../actions/app-actions';
+
+// Ranges of metric history kept by the app, see app/metric_history.go.
+// `null` shows the samples of the current reports.
+const RANGES = [
+  { label: 'Live', range: null },
+  { label: '1h', range: '1h' },
+  { label: '6h', range: '6h' },
+  { label: '24h', range: '24h' },
+];
+
+class NodeDetailsHealthRange extends React.Component {
+  render() {
+    const { metricHistoryRange } = this.props;
+    return (
+      <div className="node-details-health-range">
+        {RANGES.map(({ label, range }) => (
+          <span
+            key={label}
+            className={classNames('node-details-health-range-item', {
+              selected: range === metricHistoryRange
+            })}
+            onClick={() => this.props.setMetricHistoryRange(range)}>
+            {label}
+          </span>
+        ))}
+      </div>
+    );
+  }
+}
+
+function mapStateToProps(state) {
+  return {
+    metricHistoryRange: state.get('metricHistoryRange'),
+  };
+}
+
+export default connect(mapStateToProps, { setMetricHistoryRange })(NodeDetailsHealthRange);
@@ -2,6 +2,7 @@ import React from 'react';
 
 import ShowMore from '../show-more';
 import NodeDetailsHealthLinkItem from './node-details-health-link-item';
+import NodeDetailsHealthRange from './node-details-health-range';
 
 export default class NodeDetailsHealth extends React.Component {
   constructor(props, context) {
@@ -37,6 +38,7 @@ export default class NodeDetailsHealth extends React.Component {
 
     return (
       <div className="node-details-health" style={{ justifyContent: 'space-around' }}>
+        <NodeDetailsHealthRange />
         <div className="node-details-health-wrapper">
           {shownWithData.map(item => (<NodeDetailsHealthLinkItem
             {...item}
@@ -14,7 +14,7 @@ class TerminalApp extends React.Component {
     const params = JSON.parse(decodeURIComponent(paramString));
     this.props.receiveControlPipeFromParams(
       params.pipe.id, params.pipe.raw,
-      params.pipe.resizeTtyControl
+      params.pipe.resizeTtyControl, params.pipe.pipeControls
     );
 
     this.state = {
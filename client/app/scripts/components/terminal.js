@@ -30,6 +30,15 @@ function ab2str(buf) {
   return decodedString;
 }
 
+function str2ab(str) {
+  const encodedString = unescape(encodeURIComponent(str));
+  const buf = new Uint8Array(encodedString.length);
+  for (let i = 0; i < encodedString.length; i += 1) {
+    buf[i] = encodedString.charCodeAt(i);
+  }
+  return buf.buffer;
+}
+
 function terminalCellSize(wrapperNode) {
   // Badly guess the width/height of the row.
   let characterWidth = 20;
@@ -110,6 +119,12 @@ class Terminal extends React.Component {
       clearTimeout(this.reconnectTimeout);
       log('socket open to', getWebsocketUrl());
       this.setState({connected: true});
+      this.sendPipeControl({pipe_control: 'resize', height: this.state.rows, width: this.state.cols});
+      // A popped out terminal starts empty, so ask for what was already
+      // output again.
+      if (!this.isEmbedded() && !this.replayed) {
+        this.replayed = this.sendPipeControl({pipe_control: 'replay'});
+      }
     };
 
     socket.onclose = () => {
@@ -144,6 +159,10 @@ class Terminal extends React.Component {
     };
 
     socket.onmessage = (event) => {
+      // Text messages are pipe controls, none of which are for the UI yet.
+      if (typeof event.data === 'string') {
+        return;
+      }
       log('pipe data', event.data.size);
       const input = ab2str(event.data);
       term.write(input);
@@ -177,7 +196,9 @@ class Terminal extends React.Component {
     this.term.open(this.innerFlex);
     this.term.on('data', (data) => {
       if (this.socket) {
-        this.socket.send(data);
+        // Probes handling pipe controls take what is typed in binary
+        // messages, so that it can't be mistaken for a control.
+        this.socket.send(this.props.pipe.get('pipeControls') ? str2ab(data) : data);
       }
     });
 
@@ -256,7 +277,9 @@ class Terminal extends React.Component {
     const rows = Math.floor(height / this.state.characterHeight);
 
     const resizeTtyControl = this.props.pipe.get('resizeTtyControl');
-    if (resizeTtyControl) {
+    if (this.sendPipeControl({pipe_control: 'resize', height: rows, width: cols})) {
+      this.setState({cols, rows});
+    } else if (resizeTtyControl) {
       doResizeTty(this.getPipeId(), resizeTtyControl, cols, rows)
         .then(() => this.setState({cols, rows}));
     } else if (!this.props.pipe.get('raw')) {
@@ -264,6 +287,17 @@ class Terminal extends React.Component {
     }
   }
 
+  // sendPipeControl sends a control out of band on the pipe, if the probe
+  // handles them. Controls are text messages, and data binary ones.
+  sendPipeControl(control) {
+    if (!this.socket || this.socket.readyState !== WebSocket.OPEN
+      || !this.props.pipe.get('pipeControls')) {
+      return false;
+    }
+    this.socket.send(JSON.stringify(control));
+    return true;
+  }
+
   isEmbedded() {
     return (this.props.embedded !== false);
   }
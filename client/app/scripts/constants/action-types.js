@@ -55,6 +55,7 @@ const ACTION_TYPES = [
   'ROUTE_TOPOLOGY',
   'SELECT_NETWORK',
   'SET_EXPORTING_GRAPH',
+  'SET_METRIC_HISTORY_RANGE',
   'SET_RECEIVED_NODES_DELTA',
   'SET_VIEW_MODE',
   'SET_VIEWPORT_DIMENSIONS',
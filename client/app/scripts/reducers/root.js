@@ -57,6 +57,7 @@ export const initialState = makeMap({
   hostname: '...',
   hoveredMetricType: null,
   initialNodesLoaded: false,
+  metricHistoryRange: null, // e.g. '6h', for the metrics in the details panel
   mouseOverEdgeId: null,
   mouseOverNodeId: null,
   nodeDetails: makeOrderedMap(), // nodeId -> details
@@ -260,6 +261,10 @@ export function rootReducer(state = initialState, action) {
       });
     }
 
+    case ActionTypes.SET_METRIC_HISTORY_RANGE: {
+      return state.set('metricHistoryRange', action.range);
+    }
+
     case ActionTypes.SET_VIEW_MODE: {
       return state.set('topologyViewMode', action.viewMode);
     }
@@ -509,7 +514,8 @@ export function rootReducer(state = initialState, action) {
     case ActionTypes.DO_CONTROL_SUCCESS: {
       return state.setIn(['controlStatus', action.nodeId], makeMap({
         pending: false,
-        error: null
+        error: null,
+        tables: action.tables
       }));
     }
 
@@ -534,6 +540,7 @@ export function rootReducer(state = initialState, action) {
         nodeId: action.nodeId,
         raw: action.rawTty,
         resizeTtyControl: action.resizeTtyControl,
+        pipeControls: action.pipeControls,
         control: action.control
       }));
     }
@@ -596,6 +603,7 @@ export function rootReducer(state = initialState, action) {
         'RECEIVE_NODES_DELTA',
         'remove', size(action.delta.remove),
         'update', size(action.delta.update),
+        'patch', size(action.delta.patch),
         'add', size(action.delta.add),
         'reset', action.delta.reset
       );
@@ -619,6 +627,17 @@ export function rootReducer(state = initialState, action) {
         }
       });
 
+      // patch the fields which changed of existing nodes
+      each(action.delta.patch, (patch) => {
+        if (state.hasIn(['nodes', patch.id])) {
+          each(patch.fields, (value, field) => {
+            state = value === null
+              ? state.deleteIn(['nodes', patch.id, field])
+              : state.setIn(['nodes', patch.id, field], fromJS(value));
+          });
+        }
+      });
+
       // add new nodes
       each(action.delta.add, (node) => {
         state = state.setIn(['nodes', node.id], fromJS(node));
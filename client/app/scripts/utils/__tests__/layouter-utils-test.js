@@ -29,5 +29,16 @@ describe('LayouterUtils', () => {
         },
       });
     });
+
+    it('should mark the edges of attempted connections', () => {
+      const input = fromJS({
+        a: { adjacency: ['b', 'c'], edges: { b: { attempted: true } } },
+        b: {},
+        c: {}
+      });
+      const edges = initEdgesFromNodes(input);
+      expect(edges.getIn([edge('a', 'b'), 'attempted'])).toBe(true);
+      expect(edges.getIn([edge('a', 'c'), 'attempted'])).toBeUndefined();
+    });
   });
 });
@@ -10,6 +10,14 @@ describe('StringUtils', () => {
     });
   });
 
+  describe('formatMetricSvg', () => {
+    const f = StringUtils.formatMetricSvg;
+
+    it('it should render rates of filesizes per second', () => {
+      expect(f(2048, {format: 'filesizerate'})).toBe('2KB/s');
+    });
+  });
+
   describe('longestCommonPrefix', () => {
     const f = StringUtils.longestCommonPrefix;
 
@@ -2,6 +2,10 @@ import { hsl } from 'd3-color';
 import { scaleLinear, scaleOrdinal, schemeCategory10 } from 'd3-scale';
 
 const PSEUDO_COLOR = '#b1b1cb';
+// red, which is out of the hues of other nodes
+const STATUS_COLORS = {
+  crashlooping: '#e2474b',
+};
 const hueRange = [20, 330]; // exclude red
 const hueScale = scaleLinear().range(hueRange);
 const networkColorScale = scaleOrdinal(schemeCategory10);
@@ -51,6 +55,10 @@ export function getNodeColor(text = '', secondText = '', isPseudo = false) {
   return colors(text, secondText).toString();
 }
 
+export function getStatusColor(status) {
+  return STATUS_COLORS[status];
+}
+
 export function getNodeColorDark(text = '', secondText = '', isPseudo = false) {
   if (isPseudo) {
     return PSEUDO_COLOR;
@@ -26,9 +26,13 @@ export function initEdgesFromNodes(nodes) {
         // The direction source->target is important since dagre takes
         // directionality into account when calculating the layout.
         const edgeId = constructEdgeId(source, target);
-        const edge = makeMap({
+        let edge = makeMap({
           id: edgeId, value: 1, source, target
         });
+        // Connections which were attempted but never answered
+        if (node.getIn(['edges', target, 'attempted'])) {
+          edge = edge.set('attempted', true);
+        }
         edges = edges.set(edgeId, edge);
       }
     });
@@ -35,6 +35,11 @@ function makeFormatters(renderFn) {
       return renderFn(obj.value, obj.suffix);
     },
 
+    filesizerate(value) {
+      const obj = filesize(value, {output: 'object', round: 1});
+      return renderFn(obj.value, `${obj.suffix}/s`);
+    },
+
     integer(value) {
       const intNumber = Number(value).toFixed(0);
       if (value < 1100 && value >= 0) {
@@ -23,6 +23,8 @@ const log = debug('scope:web-api-utils');
 const reconnectTimerInterval = 5000;
 const updateFrequency = '5s';
 const FIRST_RENDER_TOO_LONG_THRESHOLD = 100; // ms
+// See app/api_topology.go
+const JSON_DELTA_SUBPROTOCOL = 'scope-delta.json';
 const csrfToken = (() => {
   // Check for token at window level or parent level (for iframe);
   /* eslint-disable no-underscore-dangle */
@@ -133,7 +135,8 @@ function createWebsocket(websocketUrl, getState, dispatch) {
   createWebsocketAt = new Date();
   firstMessageOnWebsocketAt = null;
 
-  socket = new WebSocket(websocketUrl);
+  // Ask for updated nodes as patches of the fields which changed.
+  socket = new WebSocket(websocketUrl, [JSON_DELTA_SUBPROTOCOL]);
 
   socket.onopen = () => {
     log(`Opening websocket to ${websocketUrl}`);
@@ -317,8 +320,12 @@ export function getNodeDetails(getState, dispatch) {
     let urlComponents = [getApiPath(), topologyUrl, '/', encodeURIComponent(obj.id)];
 
     // Only forward filters for nodes in the current topology.
-    const topologyOptions = currentTopologyId === obj.topologyId
+    let topologyOptions = currentTopologyId === obj.topologyId
       ? activeTopologyOptionsSelector(state) : makeMap();
+    // Ask for the history of the metrics over a longer range, if one is picked.
+    if (state.get('metricHistoryRange')) {
+      topologyOptions = topologyOptions.set('range', state.get('metricHistoryRange'));
+    }
 
     const query = buildUrlQuery(topologyOptions, state);
     if (query) {
@@ -391,15 +398,42 @@ export function getApiDetails(dispatch) {
   });
 }
 
-export function doControlRequest(nodeId, control, dispatch) {
+export function doControlRequest(nodeId, control, dispatch, confirmation) {
   clearTimeout(controlErrorTimer);
   const url = `${getApiPath()}/api/control/${encodeURIComponent(control.probeId)}/`
     + `${encodeURIComponent(control.nodeId)}/${control.id}`;
+  const error = (err) => {
+    dispatch(receiveControlError(nodeId, err.response));
+    controlErrorTimer = setTimeout(() => {
+      dispatch(clearControlError(nodeId));
+    }, 10000);
+  };
+  // Destructive controls are dry run first, for users to confirm what they
+  // will do
+  if (control.dryRun && !confirmation) {
+    doRequest({
+      method: 'POST',
+      url: `${url}?dry_run=true`,
+      success: (res) => {
+        const { effects, confirmation: dryRunConfirmation } = res.dryRun;
+        // eslint-disable-next-line no-alert
+        if (window.confirm(`${effects.join('\n')}\n\n${control.human}?`)) {
+          doControlRequest(nodeId, control, dispatch, dryRunConfirmation);
+        } else {
+          dispatch(receiveControlSuccess(nodeId));
+        }
+      },
+      error
+    });
+    return;
+  }
   doRequest({
     method: 'POST',
     url,
+    data: confirmation && JSON.stringify({ confirmation }),
     success: (res) => {
-      dispatch(receiveControlSuccess(nodeId));
+      // Controls such as inspecting a process respond with tables to show
+      dispatch(receiveControlSuccess(nodeId, res && res.value && res.value.tables));
       if (res) {
         if (res.pipe) {
           dispatch(blurSearch());
@@ -410,6 +444,7 @@ export function doControlRequest(nodeId, control, dispatch) {
             nodeId,
             res.raw_tty,
             resizeTtyControl,
+            res.pipe_controls,
             control
           ));
         }
@@ -418,12 +453,7 @@ export function doControlRequest(nodeId, control, dispatch) {
         }
       }
     },
-    error: (err) => {
-      dispatch(receiveControlError(nodeId, err.response));
-      controlErrorTimer = setTimeout(() => {
-        dispatch(clearControlError(nodeId));
-      }, 10000);
-    }
+    error
   });
 }
 
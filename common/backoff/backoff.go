@@ -0,0 +1,161 @@
+// Package backoff is github.com/weaveworks/common/backoff, extended with
+// jitter, context cancellation and a retry budget.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+type backoff struct {
+	f                          func() (bool, error)
+	quit, done                 chan struct{}
+	msg                        string
+	initialBackoff, maxBackoff time.Duration
+	jitter                     float64
+	maxRetries                 int
+	onGiveUp                   func(error)
+}
+
+// Interface does f in a loop, sleeping for initialBackoff between
+// each iterations.  If it hits an error, it exponentially backs
+// off to maxBackoff.  Backoff will log when it backs off, but
+// will stop logging when it reaches maxBackoff.  It will also
+// log on first success in the beginning and after errors.
+type Interface interface {
+	Start()
+	StartWithContext(context.Context)
+	Stop()
+	SetInitialBackoff(time.Duration)
+	SetMaxBackoff(time.Duration)
+	SetJitter(fraction float64)
+	SetMaxRetries(n int)
+	OnGiveUp(func(error))
+}
+
+// New makes a new Interface
+func New(f func() (bool, error), msg string) Interface {
+	return &backoff{
+		f:              f,
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+		msg:            msg,
+		initialBackoff: 10 * time.Second,
+		maxBackoff:     60 * time.Second,
+	}
+}
+
+func (b *backoff) SetInitialBackoff(d time.Duration) {
+	b.initialBackoff = d
+}
+
+func (b *backoff) SetMaxBackoff(d time.Duration) {
+	b.maxBackoff = d
+}
+
+// SetJitter randomises every sleep by up to fraction of it, either way, so
+// that many processes backing off at the same time spread out. The fraction
+// is between 0 (the default, no jitter) and 1.
+func (b *backoff) SetJitter(fraction float64) {
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+	b.jitter = fraction
+}
+
+// Stop the backoff, and waits for it to stop.
+func (b *backoff) Stop() {
+	close(b.quit)
+	<-b.done
+}
+
+// SetMaxRetries makes the backoff give up when f still fails after n
+// retries in a row.  0 (the default) retries forever.
+func (b *backoff) SetMaxRetries(n int) {
+	b.maxRetries = n
+}
+
+// OnGiveUp sets a function to call with the last error when the backoff
+// gives up.
+func (b *backoff) OnGiveUp(f func(error)) {
+	b.onGiveUp = f
+}
+
+// Start the backoff.  Can only be called once.
+func (b *backoff) Start() {
+	b.run(nil)
+}
+
+// StartWithContext starts the backoff, which stops when ctx is done as well
+// as on Stop.  Can only be called once, instead of Start.
+func (b *backoff) StartWithContext(ctx context.Context) {
+	b.run(ctx.Done())
+}
+
+func (b *backoff) run(cancel <-chan struct{}) {
+	defer close(b.done)
+	backoff := b.initialBackoff
+	shouldLog := true
+	failures := 0
+
+	for {
+		done, err := b.f()
+		if done {
+			return
+		}
+
+		if err != nil {
+			failures++
+			if b.maxRetries > 0 && failures > b.maxRetries {
+				log.Errorf("Error %s, giving up after %d retries: %s", b.msg, b.maxRetries, err)
+				if b.onGiveUp != nil {
+					b.onGiveUp(err)
+				}
+				return
+			}
+			backoff *= 2
+			shouldLog = true
+			if backoff > b.maxBackoff {
+				backoff = b.maxBackoff
+				shouldLog = false
+			}
+		} else {
+			backoff = b.initialBackoff
+			failures = 0
+		}
+
+		if shouldLog {
+			if err != nil {
+				log.Warnf("Error %s, backing off %s: %s",
+					b.msg, backoff, err)
+			} else {
+				log.Infof("Success %s", b.msg)
+			}
+		}
+
+		// Re-enable logging if we came from an error (suppressed or not)
+		// since we want to log in case a success follows.
+		shouldLog = err != nil
+
+		select {
+		case <-time.After(b.withJitter(backoff)):
+		case <-b.quit:
+			return
+		case <-cancel:
+			return
+		}
+	}
+
+}
+
+func (b *backoff) withJitter(d time.Duration) time.Duration {
+	if b.jitter == 0 {
+		return d
+	}
+	return d + time.Duration((2*rand.Float64()-1)*b.jitter*float64(d))
+}
@@ -0,0 +1,81 @@
+package backoff
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestJitter(t *testing.T) {
+	b := New(func() (bool, error) { return true, nil }, "testing").(*backoff)
+	d := 10 * time.Second
+	if have := b.withJitter(d); have != d {
+		t.Errorf("want no jitter by default, have %v", have)
+	}
+
+	b.SetJitter(0.2)
+	var lower, higher bool
+	for i := 0; i < 1000; i++ {
+		have := b.withJitter(d)
+		if have < 8*time.Second || have > 12*time.Second {
+			t.Fatalf("want a sleep within 20%% of %v, have %v", d, have)
+		}
+		lower = lower || have < d
+		higher = higher || have > d
+	}
+	if !lower || !higher {
+		t.Errorf("want sleeps both shorter and longer than %v", d)
+	}
+
+	b.SetJitter(2)
+	if b.jitter != 1 {
+		t.Errorf("want jitter capped at 1, have %v", b.jitter)
+	}
+}
+
+func TestStartWithContext(t *testing.T) {
+	calls := make(chan struct{}, 10)
+	b := New(func() (bool, error) {
+		calls <- struct{}{}
+		return false, fmt.Errorf("failing")
+	}, "testing")
+	b.SetInitialBackoff(time.Hour)
+	b.SetMaxBackoff(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		b.StartWithContext(ctx)
+		close(stopped)
+	}()
+	<-calls
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("backoff didn't stop when its context was cancelled")
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	calls := 0
+	b := New(func() (bool, error) {
+		calls++
+		return false, fmt.Errorf("failing %d", calls)
+	}, "testing")
+	b.SetInitialBackoff(time.Millisecond)
+	b.SetMaxBackoff(time.Millisecond)
+	b.SetMaxRetries(2)
+	var gaveUp error
+	b.OnGiveUp(func(err error) { gaveUp = err })
+
+	b.Start()
+	if calls != 3 {
+		t.Errorf("want the first try and 2 retries, have %d calls", calls)
+	}
+	if gaveUp == nil || gaveUp.Error() != "failing 3" {
+		t.Errorf("want to give up with the last error, have %v", gaveUp)
+	}
+}
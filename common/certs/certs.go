@@ -0,0 +1,209 @@
+// Package certs keeps the TLS certificates of mutually authenticated
+// connections between probes and apps up to date, so they can be rotated
+// without restarting either.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Reloader loads a certificate, its key and a CA bundle from files, and
+// loads them again on SIGHUP or when the files change.
+type Reloader struct {
+	certFile, keyFile, caFile string
+	quit                      chan struct{}
+
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	cas      *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader makes a new Reloader of the certificate and key in certFile
+// and keyFile, and the CAs in caFile, checking whether they changed every
+// interval. caFile is optional.
+func NewReloader(certFile, keyFile, caFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		quit:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.loop(interval)
+	return r, nil
+}
+
+// Stop watching the files.
+func (r *Reloader) Stop() {
+	close(r.quit)
+}
+
+func (r *Reloader) loop(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+		case <-r.quit:
+			return
+		}
+		if err := r.Reload(); err != nil {
+			log.Errorf("Error reloading TLS certificates, keeping the previous ones: %v", err)
+			continue
+		}
+		log.Infof("Reloaded TLS certificate %s", r.certFile)
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func modTimes(files []string) (map[string]time.Time, error) {
+	result := map[string]time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		result[file] = info.ModTime()
+	}
+	return result, nil
+}
+
+// changed tells whether any of the files was modified since it was loaded.
+func (r *Reloader) changed() bool {
+	current, err := modTimes(r.files())
+	if err != nil {
+		// Most likely mid-rotation; try again on the next tick
+		return false
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	for file, t := range current {
+		if !t.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload the files now.
+func (r *Reloader) Reload() error {
+	times, err := modTimes(r.files())
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var cas *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert, r.cas, r.modTimes = &cert, cas, times
+	return nil
+}
+
+// Certificate gives the current certificate.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert
+}
+
+// CAs gives the current CAs, or nil without a CA file.
+func (r *Reloader) CAs() *x509.CertPool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cas
+}
+
+// ServerConfig gives the TLS config of a server presenting the current
+// certificate. With a CA file, the certificates clients present are
+// verified against its CAs; they don't have to present one, so servers
+// can tell which requests need them.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := &tls.Config{
+				Certificates: []tls.Certificate{*r.Certificate()},
+			}
+			if cas := r.CAs(); cas != nil {
+				config.ClientCAs = cas
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}
+}
+
+// ClientConfig gives the TLS config of a client presenting the current
+// certificate to serverName. The certificate of the server is verified
+// against the current CAs, or roots without a CA file.
+func (r *Reloader) ClientConfig(serverName string, roots *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+	if r.caFile == "" {
+		config.RootCAs = roots
+		return config
+	}
+	// The roots of a tls.Config can't change, so verify the connection
+	// ourselves against the CAs at the time of the handshake.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("Server presented no certificate")
+		}
+		opts := x509.VerifyOptions{
+			Roots:         r.CAs(),
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return config
+}
@@ -0,0 +1,214 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/certs"
+)
+
+type ca struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) ca {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate for name, signed by the CA, to dir.
+func (c ca) issue(t *testing.T, dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, &key.PublicKey, c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authority := newCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(caFile, authority.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, serverKey := authority.issue(t, dir, "app")
+	server, err := certs.NewReloader(serverCert, serverKey, caFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "no client certificate", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}))
+	ts.TLS = server.ServerConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	clientCert, clientKey := authority.issue(t, dir, "probe")
+	client, err := certs.NewReloader(clientCert, clientKey, caFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	get := func(config *tls.Config) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if have, err := get(client.ClientConfig("127.0.0.1", nil)); err != nil || have != "probe" {
+		t.Fatalf("Expected the app to see the client certificate, got %q, %v", have, err)
+	}
+
+	// Rotate the client certificate
+	rotated := filepath.Join(dir, "rotated")
+	if err := os.Mkdir(rotated, 0700); err != nil {
+		t.Fatal(err)
+	}
+	newCert, newKey := authority.issue(t, rotated, "probe2")
+	for from, to := range map[string]string{newCert: clientCert, newKey: clientKey} {
+		if err := os.Rename(from, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := get(client.ClientConfig("127.0.0.1", nil)); err != nil || have != "probe2" {
+		t.Errorf("Expected the rotated client certificate, got %q, %v", have, err)
+	}
+
+	// A server with a certificate of another CA is not trusted
+	other := newCA(t)
+	otherFile := filepath.Join(dir, "other.crt")
+	if err := ioutil.WriteFile(otherFile, other.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	untrusting, err := certs.NewReloader(clientCert, clientKey, otherFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untrusting.Stop()
+	if _, err := get(untrusting.ClientConfig("127.0.0.1", nil)); err == nil {
+		t.Error("Expected the certificate of the app not to verify against another CA")
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authority := newCA(t)
+	certFile, keyFile := authority.issue(t, dir, "probe")
+	r, err := certs.NewReloader(certFile, keyFile, "", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	before := r.Certificate()
+
+	// Files written later have a later modification time
+	later := time.Now().Add(time.Second)
+	authority.issue(t, dir, "probe")
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; r.Certificate() == before; i++ {
+		if i == 100 {
+			t.Fatal("Expected the changed certificate to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Broken files keep the previous certificate
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Expected an error reloading a broken certificate")
+	}
+	if r.Certificate() == nil {
+		t.Error("Expected the previous certificate kept")
+	}
+}
@@ -24,6 +24,7 @@ const dockerAPIVersion = "1.22" // Support Docker Engine >= 1.10
 type Client interface {
 	Status() (Status, error)
 	AddDNSEntry(fqdn, containerid string, ip net.IP) error
+	RemovePeer(name string) (string, error)
 	PS() (map[string]PSEntry, error) // on the interface for mocking
 	Expose() error                   // on the interface for mocking
 }
@@ -46,14 +47,26 @@ type Router struct {
 	ProtocolMaxVersion int
 	PeerDiscovery      bool
 	Peers              []Peer
-	Connections        []struct {
-		Address  string
-		Outbound bool
-		State    string
-		Info     string
-	}
-	Targets        []string
-	TrustedSubnets []string
+	Connections        []Connection
+	Targets            []string
+	TrustedSubnets     []string
+}
+
+// Connection describes a connection of the Weave Router to another peer
+type Connection struct {
+	Address  string
+	Outbound bool
+	State    string
+	Info     string
+	Attrs    ConnectionAttrs
+}
+
+// ConnectionAttrs describes how an established connection carries traffic:
+// in the kernel with fastdp, or in user space with sleeve.
+type ConnectionAttrs struct {
+	Name      string `json:"name"`
+	Encrypted bool   `json:"encrypted"`
+	MTU       int    `json:"mtu"`
 }
 
 // Peer describes a peer in the weave network
@@ -88,15 +101,21 @@ type IPAM struct {
 		KnownNodes int
 		Quorum     uint
 	}
-	Range         string
-	DefaultSubnet string
-	Entries       []struct {
-		Size        uint32
-		IsKnownPeer bool
-	}
+	Range            string
+	DefaultSubnet    string
+	Entries          []IPAMEntry
 	PendingAllocates []string
 }
 
+// IPAMEntry is a range of the IPAM ring, from Token, owned by a peer
+type IPAMEntry struct {
+	Token       string
+	Size        uint32
+	Peer        string
+	Nickname    string
+	IsKnownPeer bool
+}
+
 // Proxy describes the status of Weave Proxy
 type Proxy struct {
 	Addresses []string
@@ -176,6 +195,28 @@ func (c *client) AddDNSEntry(fqdn, containerID string, ip net.IP) error {
 	return nil
 }
 
+// RemovePeer reclaims the IP ranges of a peer which is gone for good, as
+// weave rmpeer does, and gives what the router did.
+func (c *client) RemovePeer(name string) (string, error) {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/peer/%s", c.url, url.PathEscape(name)), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Got %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return string(bytes.TrimSpace(body)), nil
+}
+
 func (c *client) PS() (map[string]PSEntry, error) {
 	cmd := weaveCommand("--local", "ps")
 	stdOut, err := cmd.StdoutPipe()
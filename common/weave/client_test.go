@@ -35,6 +35,13 @@ var (
 			"Peers": [{
 				"Name": "%s",
 				"NickName": "%s"
+			}],
+			"Connections": [{
+				"Address": "10.0.0.2:6783",
+				"Outbound": true,
+				"State": "established",
+				"Info": "encrypted   fastdp",
+				"Attrs": {"name": "fastdp", "encrypted": true, "mtu": 1376}
 			}]
 		},
 		"DNS": {
@@ -80,6 +87,15 @@ func TestStatus(t *testing.T) {
 					NickName: mockWeavePeerNickName,
 				},
 			},
+			Connections: []weave.Connection{
+				{
+					Address:  "10.0.0.2:6783",
+					Outbound: true,
+					State:    "established",
+					Info:     "encrypted   fastdp",
+					Attrs:    weave.ConnectionAttrs{Name: "fastdp", Encrypted: true, MTU: 1376},
+				},
+			},
 		},
 		DNS: &weave.DNS{
 			Entries: []struct {
@@ -139,6 +155,27 @@ func TestDNSAdd(t *testing.T) {
 	}
 }
 
+func TestRemovePeer(t *testing.T) {
+	var method, path string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		fmt.Fprintln(w, "1024 IPs taken over from "+mockWeavePeerName)
+	}))
+	defer s.Close()
+
+	client := weave.NewClient(s.URL)
+	have, err := client.RemovePeer(mockWeavePeerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "DELETE" || path != "/peer/"+mockWeavePeerName {
+		t.Errorf("Expected DELETE /peer/%s, got %s %s", mockWeavePeerName, method, path)
+	}
+	if want := "1024 IPs taken over from " + mockWeavePeerName; have != want {
+		t.Errorf("Expected %q, got %q", want, have)
+	}
+}
+
 func TestPS(t *testing.T) {
 	oldExecCmd := exec.Command
 	defer func() { exec.Command = oldExecCmd }()
@@ -0,0 +1,18 @@
+package xfer
+
+// DefaultReportSubject is the NATS subject probes publish their reports on,
+// and apps consume them from, by default.
+const DefaultReportSubject = "scope.reports"
+
+// ReportMessage is a report published on a message bus, rather than posted
+// to an app. It is encoded with msgpack.
+type ReportMessage struct {
+	ProbeID string `json:"probeID"`
+	// Report is the gzipped msgpack of a full report.
+	Report []byte `json:"report"`
+	// SchemaVersion and Checksum are those of the report, as posted in
+	// ScopeReportSchemaHeader and ScopeReportChecksumHeader; empty in the
+	// messages of older probes.
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+}
@@ -1,5 +1,10 @@
 package xfer
 
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
 const (
 	// AppPort is the default port that the app will use for its HTTP server.
 	// The app publishes the API and user interface, and receives reports from
@@ -12,12 +17,54 @@ const (
 
 	// ScopeProbeVersionHeader is the header we use to carry the probe's version.
 	ScopeProbeVersionHeader = "X-Scope-Probe-Version"
+
+	// ScopeReportSchemaHeader carries the schema version of the report
+	// posted (report.SchemaVersion).
+	ScopeReportSchemaHeader = "X-Scope-Report-Schema"
+
+	// ScopeReportChecksumHeader carries the checksum of the body of the
+	// report posted (see ReportChecksum).
+	ScopeReportChecksumHeader = "X-Scope-Report-Checksum"
 )
 
 // HistoricReportsCapability indicates whether reports older than the
 // current time (-app.window) can be retrieved.
 const HistoricReportsCapability = "historic_reports"
 
+// ReportV2Capability indicates whether reports can be published in the v2
+// wire format. Probes only use it when all their apps have the capability.
+const ReportV2Capability = "report_v2"
+
+// ReportDeltasCapability indicates whether reports can be incremental, i.e.
+// deltas of the last full report of their probe. Apps reply to the ones they
+// can't resolve with 409 Conflict, asking for a full report.
+const ReportDeltasCapability = "report_deltas"
+
+// SavedSearchesCapability indicates whether named searches can be saved, in
+// /api/searches.
+const SavedSearchesCapability = "saved_searches"
+
+// AlertsCapability indicates whether alerting rules are evaluated, with the
+// firing alerts in /api/alerts.
+const AlertsCapability = "alerts"
+
+// AnnotationsCapability indicates whether users can pin and annotate nodes,
+// in /api/annotations.
+const AnnotationsCapability = "annotations"
+
+// LayoutsCapability indicates whether users can save the layouts of their
+// graphs, in /api/layouts.
+const LayoutsCapability = "layouts"
+
+// ViewsCapability indicates whether views can be saved under short IDs, to
+// link to, in /api/views.
+const ViewsCapability = "views"
+
+// SetProbeIntervalsControl is the control with which apps change the spy and
+// publish intervals of probes, to the durations in its spy_interval and
+// publish_interval arguments. Any node of the probe can be given.
+const SetProbeIntervalsControl = "probe_set_intervals"
+
 // Details are some generic details that can be fetched from /api
 type Details struct {
 	ID           string          `json:"id"`
@@ -27,6 +74,9 @@ type Details struct {
 	Capabilities map[string]bool `json:"capabilities,omitempty"`
 
 	NewVersion *NewVersionInfo `json:"newVersion,omitempty"`
+	// ProbeUpdate is the version apps want their probes to run, for those
+	// updating themselves.
+	ProbeUpdate *ProbeUpdateInfo `json:"probeUpdate,omitempty"`
 }
 
 // NewVersionInfo is the struct exposed in /api when there is a new
@@ -35,3 +85,19 @@ type NewVersionInfo struct {
 	Version     string `json:"version"`
 	DownloadURL string `json:"downloadUrl"`
 }
+
+// ProbeUpdateInfo is the struct exposed in /api when probes are asked to
+// update themselves: the probe binary of the version, at the download URL,
+// with the Ed25519 signature of its ProbeUpdateMessage, in base64.
+type ProbeUpdateInfo struct {
+	Version     string `json:"version"`
+	DownloadURL string `json:"downloadUrl"`
+	Signature   string `json:"signature"`
+}
+
+// ProbeUpdateMessage is what the signature of a probe update signs: the
+// version, and the SHA-256 of the binary of it, so that binaries can't be
+// passed off as other versions.
+func ProbeUpdateMessage(version string, binary []byte) []byte {
+	return []byte(fmt.Sprintf("scope-probe-update\n%s\n%x\n", version, sha256.Sum256(binary)))
+}
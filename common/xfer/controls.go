@@ -27,9 +27,33 @@ type Response struct {
 	Pipe             string `json:"pipe,omitempty"`
 	RawTTY           bool   `json:"raw_tty,omitempty"`
 	ResizeTTYControl string `json:"resize_tty_control,omitempty"`
+	PipeControls     bool   `json:"pipe_controls,omitempty"` // Set if the pipe handles PipeControls
 
 	// Remove specific fields
 	RemovedNode string `json:"removedNode,omitempty"` // Set if node was removed
+
+	// DryRun is set in the responses of dry runs (see DryRunControl)
+	DryRun *DryRunResult `json:"dryRun,omitempty"`
+}
+
+// DryRunResult is what a control would do, as told by its dry run, for
+// users to confirm before it is done.
+type DryRunResult struct {
+	Effects []string `json:"effects"`
+	// Confirmation is given as the ConfirmationArg of the control, for it
+	// to be done only while it would still do what its dry run told.
+	Confirmation string `json:"confirmation"`
+}
+
+// ConfirmationArg is the argument of controls with the confirmation of
+// their dry run.
+const ConfirmationArg = "confirmation"
+
+// DryRunControl is the control dry running another: telling what the
+// control would do, or why it can't be done, without doing it. Probes
+// without dry runs of the control don't recognise it.
+func DryRunControl(control string) string {
+	return control + "_dry_run"
 }
 
 // Message is the unions of Request, Response and arbitrary Value.
@@ -0,0 +1,149 @@
+package xfer
+
+import (
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// reportChecksumAlgorithm prefixes the checksums of reports.
+const reportChecksumAlgorithm = "sha256="
+
+// Content-Encodings of reports published to apps. All apps accept reports
+// in gzip, which their wire formats compress themselves with, or identity;
+// they tell which of the others they accept with ReportEncodingCapability.
+const (
+	GzipEncoding     = "gzip"
+	IdentityEncoding = "identity"
+	DeflateEncoding  = "deflate"
+	ZstdEncoding     = "zstd"
+)
+
+// ReportEncodingCapability indicates whether reports can be published in a
+// Content-Encoding other than gzip or identity.
+func ReportEncodingCapability(encoding string) string {
+	return "report_encoding_" + encoding
+}
+
+type reportCodec struct {
+	encoder func(w io.Writer, level int) (io.WriteCloser, error)
+	decoder func(r io.Reader) (io.ReadCloser, error)
+}
+
+var reportCodecs = map[string]reportCodec{
+	DeflateEncoding: {
+		encoder: func(w io.Writer, level int) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, level) },
+		decoder: zlib.NewReader,
+	},
+	ZstdEncoding: {
+		encoder: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel(level)), zstd.WithEncoderConcurrency(1))
+		},
+		decoder: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+
+// zstdLevel gives the zstd level of a compress/flate level, by how hard
+// they try.
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level < 0:
+		return zstd.SpeedDefault
+	case level <= 2:
+		return zstd.SpeedFastest
+	case level <= 6:
+		return zstd.SpeedDefault
+	case level <= 8:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// ReportEncodings gives the Content-Encodings of reports other than gzip
+// and identity, which apps have the capabilities of.
+func ReportEncodings() []string {
+	result := make([]string, 0, len(reportCodecs))
+	for encoding := range reportCodecs {
+		result = append(result, encoding)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// IsReportEncoding tells whether reports can be published in encoding.
+func IsReportEncoding(encoding string) bool {
+	_, ok := reportCodecs[encoding]
+	return ok || encoding == GzipEncoding || encoding == IdentityEncoding
+}
+
+// NewReportEncoder gives a writer compressing to w in encoding, at level
+// (as in compress/flate). encoding must be one of ReportEncodings.
+func NewReportEncoder(w io.Writer, encoding string, level int) (io.WriteCloser, error) {
+	codec, ok := reportCodecs[encoding]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported report encoding %q", encoding)
+	}
+	return codec.encoder(w, level)
+}
+
+// NewReportDecoder gives a reader decompressing r from encoding, which must
+// be one of ReportEncodings.
+func NewReportDecoder(r io.Reader, encoding string) (io.ReadCloser, error) {
+	codec, ok := reportCodecs[encoding]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported report encoding %q", encoding)
+	}
+	return codec.decoder(r)
+}
+
+// ReportChecksum gives the checksum of the body of a report, as published
+// with it: its SHA-256, as sha256=<hex digest>. Bodies are checksummed as
+// sent, in their Content-Encoding.
+func ReportChecksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return reportChecksumAlgorithm + hex.EncodeToString(sum[:])
+}
+
+// ReportChecksummer checksums the body of a report as it is read.
+type ReportChecksummer struct {
+	io.Reader
+	hash hash.Hash
+}
+
+// NewReportChecksummer makes a ReportChecksummer reading the body r.
+func NewReportChecksummer(r io.Reader) *ReportChecksummer {
+	h := sha256.New()
+	return &ReportChecksummer{Reader: io.TeeReader(r, h), hash: h}
+}
+
+// Verify reads the rest of the body, and checks it has the checksum it was
+// published with. Bodies without checksums, of older probes, always do.
+func (c *ReportChecksummer) Verify(checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	if !strings.HasPrefix(checksum, reportChecksumAlgorithm) {
+		return fmt.Errorf("Unsupported report checksum %q", checksum)
+	}
+	if _, err := io.Copy(ioutil.Discard, c.Reader); err != nil {
+		return err
+	}
+	if have := reportChecksumAlgorithm + hex.EncodeToString(c.hash.Sum(nil)); have != checksum {
+		return fmt.Errorf("Report checksum mismatch: the body has %s, published with %s", have, checksum)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package xfer
+
+// EnrollmentPath is where probes exchange an enrollment token, in the
+// Authorization header, for a credential of their own. Apps only have it
+// with enrollment enabled.
+const EnrollmentPath = "/api/enrollment/enroll"
+
+// EnrollmentRequest is what probes enroll with.
+type EnrollmentRequest struct {
+	Hostname string `json:"hostname"`
+}
+
+// EnrollmentResponse has the credential of an enrolled probe, to use as its
+// token from then on.
+type EnrollmentResponse struct {
+	Credential string `json:"credential"`
+}
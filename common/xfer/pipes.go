@@ -1,12 +1,49 @@
 package xfer
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
 )
 
+// Types of PipeControl.
+const (
+	ResizePipeControl = "resize" // the terminal at the UI end was resized
+	ReplayPipeControl = "replay" // the UI end wants the scrollback again
+)
+
+// controlBufferSize is how many controls are queued for an end of a pipe
+// before further ones are dropped.
+const controlBufferSize = 16
+
+// PipeControl is an out-of-band message on a pipe. Data is copied to and
+// from websockets in binary messages, and controls in text messages holding
+// their JSON. Text messages which aren't a PipeControl are data too, as
+// older UIs send what is typed in text messages.
+type PipeControl struct {
+	Type   string `json:"pipe_control"`
+	Height uint   `json:"height,omitempty"`
+	Width  uint   `json:"width,omitempty"`
+}
+
+var pipeControlPrefix = []byte(`{"pipe_control"`)
+
+func parsePipeControl(buf []byte) (PipeControl, bool) {
+	var control PipeControl
+	if !bytes.HasPrefix(buf, pipeControlPrefix) || json.Unmarshal(buf, &control) != nil {
+		return PipeControl{}, false
+	}
+	switch control.Type {
+	case ResizePipeControl, ReplayPipeControl:
+		return control, true
+	}
+	return PipeControl{}, false
+}
+
 // Pipe is a bi-directional channel from something in the probe
 // to the UI.
 type Pipe interface {
@@ -16,6 +53,23 @@ type Pipe interface {
 	Close() error
 	Closed() bool
 	OnClose(func())
+
+	// OnControl sets the handler of the controls sent from the far end of
+	// the pipe. Without one, the controls are passed on to the websocket
+	// copied to the other end, as in the app.
+	OnControl(func(PipeControl))
+}
+
+// pipeEnd lets CopyToWebsocket tell which of the ends of a pipe it copies.
+type pipeEnd struct {
+	io.ReadWriter
+}
+
+func newPipeEnd(rw io.ReadWriter) io.ReadWriter {
+	if rw == nil {
+		return nil
+	}
+	return &pipeEnd{rw}
 }
 
 type pipe struct {
@@ -26,14 +80,17 @@ type pipe struct {
 	quit            chan struct{}
 	closed          bool
 	onClose         func()
+	onControl       func(PipeControl)
+	controls        [2]chan PipeControl // to the port and starboard ends
 }
 
 // NewPipeFromEnds makes a new pipe specifying its ends
 func NewPipeFromEnds(local io.ReadWriter, remote io.ReadWriter) Pipe {
 	return &pipe{
-		port:      local,
-		starboard: remote,
+		port:      newPipeEnd(local),
+		starboard: newPipeEnd(remote),
 		quit:      make(chan struct{}),
+		controls:  newControls(),
 	}
 }
 
@@ -42,22 +99,30 @@ func NewPipe() Pipe {
 	r1, w1 := io.Pipe()
 	r2, w2 := io.Pipe()
 	return &pipe{
-		port: struct {
+		port: &pipeEnd{struct {
 			io.Reader
 			io.Writer
 		}{
 			r1, w2,
-		},
-		starboard: struct {
+		}},
+		starboard: &pipeEnd{struct {
 			io.Reader
 			io.Writer
 		}{
 			r2, w1,
-		},
+		}},
 		closers: []io.Closer{
 			r1, r2, w1, w2,
 		},
-		quit: make(chan struct{}),
+		quit:     make(chan struct{}),
+		controls: newControls(),
+	}
+}
+
+func newControls() [2]chan PipeControl {
+	return [2]chan PipeControl{
+		make(chan PipeControl, controlBufferSize),
+		make(chan PipeControl, controlBufferSize),
 	}
 }
 
@@ -98,6 +163,37 @@ func (p *pipe) OnClose(f func()) {
 	p.onClose = f
 }
 
+func (p *pipe) OnControl(f func(PipeControl)) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.onControl = f
+}
+
+// endIndex gives the index in controls of an end of the pipe.
+func (p *pipe) endIndex(end io.ReadWriter) int {
+	if e, ok := end.(*pipeEnd); ok && e == p.port {
+		return 0
+	}
+	return 1
+}
+
+// control handles a control which arrived at an end of the pipe, by passing
+// it to the handler or else to the other end.
+func (p *pipe) control(control PipeControl, from int) {
+	p.mtx.Lock()
+	onControl := p.onControl
+	p.mtx.Unlock()
+	if onControl != nil {
+		onControl(control)
+		return
+	}
+	select {
+	case p.controls[1-from] <- control:
+	default:
+		log.Debugf("Dropping %s pipe control, as too many are queued", control.Type)
+	}
+}
+
 // CopyToWebsocket copies pipe data to/from a websocket.  It blocks.
 func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 	p.mtx.Lock()
@@ -108,16 +204,19 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 	p.wg.Add(1)
 	p.mtx.Unlock()
 	defer p.wg.Done()
+	index := p.endIndex(end)
+	done := make(chan struct{})
+	defer close(done)
 
-	// The goroutines below both post their errors to the channel, but if you close()
+	// The goroutines below all post their errors to the channel, but if you close()
 	// the pipe before any errors then the pipe may not get read from. Therefore it
-	// needs up to 2 slots free.
-	errors := make(chan error, 2)
+	// needs up to 3 slots free.
+	errors := make(chan error, 3)
 
 	// Read-from-UI loop
 	go func() {
 		for {
-			_, buf, err := conn.ReadMessage() // TODO type should be binary message
+			messageType, buf, err := conn.ReadMessage()
 			if err != nil {
 				errors <- err
 				return
@@ -127,6 +226,13 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 				return
 			}
 
+			if messageType == websocket.TextMessage {
+				if control, ok := parsePipeControl(buf); ok {
+					p.control(control, index)
+					continue
+				}
+			}
+
 			if _, err := end.Write(buf); err != nil {
 				errors <- err
 				return
@@ -155,6 +261,25 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 		}
 	}()
 
+	// Write-controls-to-UI loop
+	go func() {
+		for {
+			select {
+			case control := <-p.controls[index]:
+				buf, err := json.Marshal(control)
+				if err == nil {
+					err = conn.WriteMessage(websocket.TextMessage, buf)
+				}
+				if err != nil {
+					errors <- err
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
 	// block until one of the goroutines exits
 	// this convoluted mechanism is to ensure we only close the websocket once.
 	select {
@@ -59,6 +59,19 @@ func Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header)
 	return Ping(wsConn), nil
 }
 
+// UpgradeSubprotocol upgrades the HTTP server connection to the WebSocket
+// protocol, agreeing on the first of subprotocols which the client asked
+// for. It gives the subprotocol agreed on, or "" for none.
+func UpgradeSubprotocol(w http.ResponseWriter, r *http.Request, subprotocols []string) (Websocket, string, error) {
+	u := upgrader
+	u.Subprotocols = subprotocols
+	wsConn, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return Ping(wsConn), wsConn.Subprotocol(), nil
+}
+
 // WSDialer can dial a new websocket
 type WSDialer interface {
 	Dial(urlStr string, requestHeader http.Header) (*websocket.Conn, *http.Response, error)
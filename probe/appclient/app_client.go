@@ -1,6 +1,8 @@
 package appclient
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,6 +10,7 @@ import (
 	"net/http"
 	"net/rpc"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +20,7 @@ import (
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
 )
 
 const (
@@ -37,6 +41,26 @@ type AppClient interface {
 	Stop()
 }
 
+// TargetStatus is the state of the connection to an app, for the status
+// endpoint of the probe.
+type TargetStatus struct {
+	AppID          string            `json:"app_id"`
+	Hostname       string            `json:"hostname"`
+	URL            string            `json:"url"`
+	Connected      bool              `json:"connected"` // whether the last publish succeeded
+	LastPublished  *time.Time        `json:"last_published,omitempty"`
+	PublishLatency string            `json:"publish_latency,omitempty"`
+	LastError      string            `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time        `json:"last_error_at,omitempty"`
+	Backoff        map[string]string `json:"backoff,omitempty"` // of the loops retrying, like publish and controls
+}
+
+// targeter is an AppClient or Publisher which knows the state of its
+// connections to apps.
+type targeter interface {
+	Targets() []TargetStatus
+}
+
 // appClient is a client to an app, dealing with report publishing, controls and pipes.
 type appClient struct {
 	ProbeConfig
@@ -58,9 +82,17 @@ type appClient struct {
 	// For publish
 	publishLoop sync.Once
 	readers     chan io.Reader
+	resync      bool // whether the app lost the baseline of incremental reports
 
 	// For controls
 	control xfer.ControlHandler
+
+	// For the status of the client
+	lastPublished  time.Time
+	publishLatency time.Duration
+	lastError      string
+	lastErrorAt    time.Time
+	backoffs       map[string]time.Duration // of the loops retrying, by what they do
 }
 
 // NewAppClient makes a new appClient.
@@ -80,9 +112,10 @@ func NewAppClient(pc ProbeConfig, hostname string, target url.URL, control xfer.
 			TLSClientConfig:  httpTransport.TLSClientConfig,
 			HandshakeTimeout: httpClientTimeout,
 		},
-		conns:   map[string]xfer.Websocket{},
-		readers: make(chan io.Reader, 2),
-		control: control,
+		conns:    map[string]xfer.Websocket{},
+		readers:  make(chan io.Reader, 2),
+		control:  control,
+		backoffs: map[string]time.Duration{},
 	}, nil
 }
 
@@ -199,13 +232,19 @@ func (c *appClient) Details() (xfer.Details, error) {
 	return result, nil
 }
 
-func (c *appClient) doWithBackoff(msg string, f func() (bool, error)) {
+// doWithBackoff does f in a loop, backing off when it fails, until it is
+// done or the client stops. With maxRetries above 0, it gives up once f
+// failed more than maxRetries times in a row, not counting the app
+// asking to retry later, and tells OnGiveUp.
+func (c *appClient) doWithBackoff(msg string, maxRetries int, f func() (bool, error)) {
 	if !c.retainGoroutine() {
 		return
 	}
 	defer c.releaseGoroutine()
 
 	backoff := initialBackoff
+	defer c.setBackoff(msg, 0)
+	failures := 0
 
 	for {
 		done, err := f()
@@ -214,8 +253,27 @@ func (c *appClient) doWithBackoff(msg string, f func() (bool, error)) {
 		}
 		if err == nil {
 			backoff = initialBackoff
+			failures = 0
+			c.setBackoff(msg, 0)
 			continue
 		}
+		if retry, ok := err.(retryAfterError); ok {
+			// The app is overloaded, and said when to try again
+			log.Warnf("Error doing %s for %s, retrying after %s: %v", msg, c.hostname, retry.after, err)
+			select {
+			case <-time.After(retry.after):
+			case <-c.quit:
+				return
+			}
+			continue
+		}
+		if failures++; maxRetries > 0 && failures > maxRetries {
+			log.Errorf("Error doing %s for %s, giving up after %d retries: %v", msg, c.hostname, maxRetries, err)
+			if c.OnGiveUp != nil {
+				c.OnGiveUp(fmt.Sprintf("%s to %s", msg, c.hostname))(err)
+			}
+			return
+		}
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			// The timeout period itself serves as a backoff that
 			// prevents thrashing. Hence there is no need to introduce
@@ -227,6 +285,7 @@ func (c *appClient) doWithBackoff(msg string, f func() (bool, error)) {
 			continue
 		}
 		log.Errorf("Error doing %s for %s, backing off %s: %v", msg, c.hostname, backoff, err)
+		c.setBackoff(msg, backoff)
 		select {
 		case <-time.After(backoff):
 		case <-c.quit:
@@ -239,6 +298,43 @@ func (c *appClient) doWithBackoff(msg string, f func() (bool, error)) {
 	}
 }
 
+func (c *appClient) setBackoff(msg string, backoff time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if backoff > 0 {
+		c.backoffs[msg] = backoff
+	} else {
+		delete(c.backoffs, msg)
+	}
+}
+
+// TargetStatus gives the state of the connection to the app.
+func (c *appClient) TargetStatus() TargetStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	status := TargetStatus{
+		Hostname:  c.hostname,
+		URL:       c.target.Redacted(),
+		Connected: !c.lastPublished.IsZero() && !c.lastPublished.Before(c.lastErrorAt),
+		LastError: c.lastError,
+	}
+	if !c.lastPublished.IsZero() {
+		lastPublished := c.lastPublished
+		status.LastPublished, status.PublishLatency = &lastPublished, c.publishLatency.String()
+	}
+	if !c.lastErrorAt.IsZero() {
+		lastErrorAt := c.lastErrorAt
+		status.LastErrorAt = &lastErrorAt
+	}
+	if len(c.backoffs) > 0 {
+		status.Backoff = map[string]string{}
+		for msg, backoff := range c.backoffs {
+			status.Backoff[msg] = backoff.String()
+		}
+	}
+	return status
+}
+
 func (c *appClient) controlConnection() (bool, error) {
 	headers := http.Header{}
 	c.ProbeConfig.authorizeHeaders(headers)
@@ -276,18 +372,41 @@ func (c *appClient) ControlConnection() {
 	go func() {
 		log.Infof("Control connection to %s starting", c.hostname)
 		defer log.Infof("Control connection to %s exiting", c.hostname)
-		c.doWithBackoff("controls", c.controlConnection)
+		c.doWithBackoff("controls", c.MaxRetries, c.controlConnection)
 	}()
 }
 
 func (c *appClient) publish(r io.Reader) error {
 	url := c.url("/api/report")
-	req, err := c.ProbeConfig.authorizedRequest("POST", url, r)
+	// Reports are checksummed for apps to tell they got them intact
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// Peeking at the format hides the length of the report from NewRequest
+	br := bufio.NewReader(bytes.NewReader(body))
+	req, err := c.ProbeConfig.authorizedRequest("POST", url, br)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Content-Type", "application/msgpack")
+	req.ContentLength = int64(len(body))
+	req.Header.Set(xfer.ScopeReportSchemaHeader, strconv.Itoa(report.SchemaVersion))
+	req.Header.Set(xfer.ScopeReportChecksumHeader, xfer.ReportChecksum(body))
+	if encoded, ok := r.(encodedReport); ok {
+		if encoded.encoding != xfer.IdentityEncoding {
+			req.Header.Set("Content-Encoding", encoded.encoding)
+		}
+		if encoded.v2 {
+			req.Header.Set("Content-Type", report.V2ContentType)
+		} else {
+			req.Header.Set("Content-Type", "application/msgpack")
+		}
+	} else if report.PeekV2(br) {
+		req.Header.Set("Content-Type", report.V2ContentType)
+	} else {
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Content-Type", "application/msgpack")
+	}
 	// req.Header.Set("Content-Type", "application/binary") // TODO: we should use http.DetectContentType(..) on the gob'ed
 
 	// Make sure this request is cancelled when we stop the client
@@ -299,23 +418,80 @@ func (c *appClient) publish(r io.Reader) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		// The app doesn't have the baseline of an incremental report: the
+		// next report had better be full.
+		log.Infof("App %s needs a full report", c.hostname)
+		c.mtx.Lock()
+		c.resync = true
+		c.mtx.Unlock()
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfterError{status: resp.Status, after: retryAfter(resp.Header.Get("Retry-After"))}
+	}
 	if resp.StatusCode != http.StatusOK {
 		text, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf(resp.Status + ": " + string(text))
+		return fmt.Errorf("%s: %s", resp.Status, text)
 	}
 	return nil
 }
 
+// retryAfterError is returned when the app asks for requests to be retried
+// later.
+type retryAfterError struct {
+	status string
+	after  time.Duration
+}
+
+func (e retryAfterError) Error() string {
+	return e.status
+}
+
+// retryAfter parses a Retry-After header, in seconds or as a date. Without
+// one, requests are retried after the initial backoff.
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if after := time.Until(date); after > 0 {
+			return after
+		}
+		return 0
+	}
+	return initialBackoff
+}
+
+// NeedResync is whether the app lost the baseline of incremental reports
+// since the last time it was asked.
+func (c *appClient) NeedResync() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	resync := c.resync
+	c.resync = false
+	return resync
+}
+
 func (c *appClient) startPublishing() {
 	go func() {
 		log.Infof("Publish loop for %s starting", c.hostname)
 		defer log.Infof("Publish loop for %s exiting", c.hostname)
-		c.doWithBackoff("publish", func() (bool, error) {
+		c.doWithBackoff("publish", c.MaxRetries, func() (bool, error) {
 			r := <-c.readers
 			if r == nil {
 				return true, nil
 			}
-			return false, c.publish(r)
+			t := time.Now()
+			err := c.publish(r)
+			c.mtx.Lock()
+			if err != nil {
+				c.lastError, c.lastErrorAt = err.Error(), time.Now()
+			} else {
+				c.lastPublished, c.publishLatency = time.Now(), time.Since(t)
+			}
+			c.mtx.Unlock()
+			return false, err
 		})
 	}()
 }
@@ -375,7 +551,7 @@ func (c *appClient) PipeConnection(id string, pipe xfer.Pipe) {
 	go func() {
 		log.Infof("Pipe %s connection to %s starting", id, c.hostname)
 		defer log.Infof("Pipe %s connection to %s exiting", id, c.hostname)
-		c.doWithBackoff(id, func() (bool, error) {
+		c.doWithBackoff(id, 0, func() (bool, error) {
 			return c.pipeConnection(id, pipe)
 		})
 	}()
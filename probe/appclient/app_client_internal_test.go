@@ -225,3 +225,165 @@ func TestStop(t *testing.T) {
 	// Let the server go so that the test can end
 	close(stopHanging)
 }
+
+func TestAppClientResync(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	if err := NewReportPublisher(p, false).Publish(report.MakeReport()); err != nil {
+		t.Fatal(err)
+	}
+	client := p.(*appClient)
+	deadline := time.Now().Add(time.Second)
+	for !client.NeedResync() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a resync on conflict")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.NeedResync() {
+		t.Errorf("Expected asking to clear the resync")
+	}
+}
+
+func TestAppClientRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"5":   5 * time.Second,
+		"":    initialBackoff,
+		"foo": initialBackoff,
+		time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat): 0,
+	} {
+		if have := retryAfter(header); have != want {
+			t.Errorf("%q: expected %s, got %s", header, want, have)
+		}
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if err := p.(*appClient).publish(strings.NewReader("")); err == nil {
+		t.Error("Expected an error when rate limited")
+	} else if retry, ok := err.(retryAfterError); !ok || retry.after != 0 {
+		t.Errorf("Expected to retry at once, got %v", err)
+	}
+}
+
+func TestAppClientTargetStatus(t *testing.T) {
+	fail := make(chan bool, 1)
+	fail <- true
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fail:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	client := p.(*appClient)
+	poll := func(timeout time.Duration, msg string, f func(TargetStatus) bool) {
+		deadline := time.Now().Add(timeout)
+		for !f(client.TargetStatus()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s, got %+v", msg, client.TargetStatus())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if status := client.TargetStatus(); status.Connected || status.URL != s.URL {
+		t.Errorf("Expected a client to %s which never published, got %+v", s.URL, status)
+	}
+
+	// The first publish fails, and is retried after the initial backoff
+	if err := NewReportPublisher(p, false).Publish(report.MakeReport()); err != nil {
+		t.Fatal(err)
+	}
+	poll(time.Second, "Expected the publish loop to back off", func(status TargetStatus) bool {
+		return status.Backoff["publish"] == initialBackoff.String()
+	})
+	if status := client.TargetStatus(); status.Connected || !strings.HasPrefix(status.LastError, "500") {
+		t.Errorf("Expected a failed publish, got %+v", status)
+	}
+
+	if err := NewReportPublisher(p, false).Publish(report.MakeReport()); err != nil {
+		t.Fatal(err)
+	}
+	poll(2*initialBackoff, "Expected the publish to be retried", func(status TargetStatus) bool {
+		return status.Connected
+	})
+	if status := client.TargetStatus(); status.PublishLatency == "" || len(status.Backoff) != 0 {
+		t.Errorf("Expected a publish latency, and no backoff, got %+v", status)
+	}
+}
+
+func TestAppClientGiveUp(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaveUp := make(chan string, 1)
+	p, err := NewAppClient(ProbeConfig{
+		MaxRetries: 1,
+		OnGiveUp: func(name string) func(error) {
+			return func(error) { gaveUp <- name }
+		},
+	}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// The first publish fails, and so does its retry
+	for i := 0; i < 2; i++ {
+		if err := NewReportPublisher(p, false).Publish(report.MakeReport()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case name := <-gaveUp:
+		if want := "publish to " + u.Host; name != want {
+			t.Errorf("Expected %q to give up, got %q", want, name)
+		}
+	case <-time.After(3 * initialBackoff):
+		t.Fatalf("Expected the publish loop to give up, got %+v", p.(*appClient).TargetStatus())
+	}
+}
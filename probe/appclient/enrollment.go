@@ -0,0 +1,105 @@
+package appclient
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// Credentials are the credentials a probe enrolled for with apps, by the
+// host of the app. They are kept in a file if given, so the probe only
+// enrolls once, and its enrollment token can be revoked after.
+type Credentials struct {
+	file     string
+	hostname string // of the probe, enrolled for
+
+	mtx   sync.Mutex
+	byApp map[string]string
+}
+
+// NewCredentials makes a new Credentials of the probe of hostname, loading
+// the credentials in file.
+func NewCredentials(file, hostname string) (*Credentials, error) {
+	c := &Credentials{
+		file:     file,
+		hostname: hostname,
+		byApp:    map[string]string{},
+	}
+	if file == "" {
+		return c, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&c.byApp); err != nil {
+		return nil, fmt.Errorf("Error reading credentials from %s: %v", file, err)
+	}
+	return c, nil
+}
+
+// Get gives the credential of the probe with the app at target, enrolling
+// with the enrollment token in pc if it has none yet.
+func (c *Credentials) Get(pc ProbeConfig, hostname string, target url.URL) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if credential, ok := c.byApp[target.Host]; ok {
+		return credential, nil
+	}
+
+	var body []byte
+	if err := codec.NewEncoderBytes(&body, &codec.JsonHandle{}).Encode(xfer.EnrollmentRequest{Hostname: c.hostname}); err != nil {
+		return "", err
+	}
+	req, err := pc.authorizedRequest("POST", target.String()+xfer.EnrollmentPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := cleanhttp.DefaultClient()
+	client.Transport = pc.getHTTPTransport(hostname)
+	client.Timeout = httpClientTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("Error enrolling with %s: %s: %s", target.Host, resp.Status, text)
+	}
+	var enrolled xfer.EnrollmentResponse
+	if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&enrolled); err != nil {
+		return "", err
+	}
+
+	c.byApp[target.Host] = enrolled.Credential
+	return enrolled.Credential, c.save()
+}
+
+// save the credentials to the file, with the lock held.
+func (c *Credentials) save() error {
+	if c.file == "" {
+		return nil
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(c.byApp); err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file)
+}
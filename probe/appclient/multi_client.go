@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 
@@ -26,8 +27,12 @@ type multiClient struct {
 
 	mtx        sync.Mutex
 	sema       semaphore
-	clients    map[string]AppClient     // holds map from app id -> client
-	ids        map[string]report.IDList // holds map from hostname -> app ids
+	clients    map[string]AppClient       // holds map from app id -> client
+	reportV2   map[string]bool            // holds map from app id -> v2 report capability
+	deltas     map[string]bool            // holds map from app id -> incremental report capability
+	encodings  map[string]map[string]bool // holds map from app id -> report encoding capabilities
+	ids        map[string]report.IDList   // holds map from hostname -> app ids
+	updater    ProbeUpdater
 	quit       chan struct{}
 	noControls bool
 }
@@ -37,6 +42,17 @@ type clientTuple struct {
 	AppClient
 }
 
+// resyncer is an AppClient which knows whether its app lost the baseline of
+// incremental reports.
+type resyncer interface {
+	NeedResync() bool
+}
+
+// targetStatuser is an AppClient which knows the state of its connection.
+type targetStatuser interface {
+	TargetStatus() TargetStatus
+}
+
 // Publisher is something which can send a stream of data somewhere, probably
 // to a remote collector.
 type Publisher interface {
@@ -52,6 +68,7 @@ type MultiAppClient interface {
 	PipeClose(appID, pipeID string) error
 	Stop()
 	Publish(io.Reader, bool) error
+	SetProbeUpdater(ProbeUpdater)
 }
 
 // NewMultiAppClient creates a new MultiAppClient.
@@ -61,6 +78,9 @@ func NewMultiAppClient(clientFactory ClientFactory, noControls bool) MultiAppCli
 
 		sema:       newSemaphore(maxConcurrentGET),
 		clients:    map[string]AppClient{},
+		reportV2:   map[string]bool{},
+		deltas:     map[string]bool{},
+		encodings:  map[string]map[string]bool{},
 		ids:        map[string]report.IDList{},
 		quit:       make(chan struct{}),
 		noControls: noControls,
@@ -103,6 +123,15 @@ func (c *multiClient) Set(hostname string, urls []url.URL) {
 	hostIDs := report.MakeIDList()
 	for tuple := range clients {
 		hostIDs = hostIDs.Add(tuple.ID)
+		c.reportV2[tuple.ID] = tuple.Capabilities[xfer.ReportV2Capability]
+		c.deltas[tuple.ID] = tuple.Capabilities[xfer.ReportDeltasCapability]
+		c.encodings[tuple.ID] = map[string]bool{}
+		for _, encoding := range xfer.ReportEncodings() {
+			c.encodings[tuple.ID][encoding] = tuple.Capabilities[xfer.ReportEncodingCapability(encoding)]
+		}
+		if tuple.ProbeUpdate != nil && c.updater != nil {
+			c.updater.Update(*tuple.ProbeUpdate)
+		}
 		if client, ok := c.clients[tuple.ID]; ok {
 			client.ReTarget(tuple.AppClient.Target())
 		} else {
@@ -123,10 +152,21 @@ func (c *multiClient) Set(hostname string, urls []url.URL) {
 		if !allReferencedIDs.Contains(id) {
 			client.Stop()
 			delete(c.clients, id)
+			delete(c.reportV2, id)
+			delete(c.deltas, id)
+			delete(c.encodings, id)
 		}
 	}
 }
 
+// SetProbeUpdater sets what updates the probe to the versions apps
+// advertise; none do by default.
+func (c *multiClient) SetProbeUpdater(updater ProbeUpdater) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.updater = updater
+}
+
 func (c *multiClient) withClient(appID string, f func(AppClient) error) error {
 	c.mtx.Lock()
 	client, ok := c.clients[appID]
@@ -181,9 +221,16 @@ func (c *multiClient) Publish(r io.Reader, shortcut bool) error {
 		return err
 	}
 
+	reader := func() io.Reader { return bytes.NewReader(buf) }
+	if encoded, ok := r.(encodedReport); ok {
+		reader = func() io.Reader {
+			return encodedReport{Reader: bytes.NewReader(buf), encoding: encoded.encoding, v2: encoded.v2}
+		}
+	}
+
 	errs := []string{}
 	for _, c := range c.clients {
-		if err := c.Publish(bytes.NewReader(buf), shortcut); err != nil {
+		if err := c.Publish(reader(), shortcut); err != nil {
 			errs = append(errs, err.Error())
 		}
 	}
@@ -193,8 +240,82 @@ func (c *multiClient) Publish(r io.Reader, shortcut bool) error {
 	return nil
 }
 
+// ReportV2 is whether all the apps reports are published to accept them in
+// the v2 wire format.
+func (c *multiClient) ReportV2() bool {
+	return c.allCapable(c.reportV2)
+}
+
+// ReportDeltas is whether all the apps reports are published to accept
+// incremental reports.
+func (c *multiClient) ReportDeltas() bool {
+	return c.allCapable(c.deltas)
+}
+
+// AcceptsReportEncoding is whether all the apps reports are published to
+// accept them in a Content-Encoding.
+func (c *multiClient) AcceptsReportEncoding(encoding string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.clients) == 0 {
+		return false
+	}
+	for id := range c.clients {
+		if !c.encodings[id][encoding] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *multiClient) allCapable(capable map[string]bool) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.clients) == 0 {
+		return false
+	}
+	for id := range c.clients {
+		if !capable[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// NeedResync is whether any app lost the baseline of incremental reports
+// since the last time it was asked.
+func (c *multiClient) NeedResync() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	resync := false
+	for _, client := range c.clients {
+		if r, ok := client.(resyncer); ok && r.NeedResync() {
+			resync = true
+		}
+	}
+	return resync
+}
+
 type semaphore chan struct{}
 
+// Targets gives the state of the connections to the apps, by app ID.
+func (c *multiClient) Targets() []TargetStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	result := []TargetStatus{}
+	for id, client := range c.clients {
+		target := client.Target()
+		status := TargetStatus{Hostname: target.Host, URL: target.Redacted()}
+		if s, ok := client.(targetStatuser); ok {
+			status = s.TargetStatus()
+		}
+		status.AppID = id
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AppID < result[j].AppID })
+	return result
+}
+
 func newSemaphore(n int) semaphore {
 	c := make(chan struct{}, n)
 	for i := 0; i < n; i++ {
@@ -1,25 +1,30 @@
 package appclient_test
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"runtime"
 	"testing"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
 )
 
 type mockClient struct {
-	id      string
-	count   int
-	stopped int
-	publish int
+	id       string
+	count    int
+	stopped  int
+	publish  int
+	reportV2 bool
 }
 
 func (c *mockClient) Details() (xfer.Details, error) {
-	return xfer.Details{ID: c.id}, nil
+	return xfer.Details{ID: c.id, Capabilities: map[string]bool{xfer.ReportV2Capability: c.reportV2}}, nil
 }
 
 func (c *mockClient) ControlConnection() {
@@ -50,6 +55,8 @@ var (
 	a2      = &mockClient{id: "2"} // hostname a, app id 2
 	b2      = &mockClient{id: "2"} // hostname b, app id 2 (duplicate)
 	b3      = &mockClient{id: "3"} // hostname b, app id 3
+	c4      = &mockClient{id: "4", reportV2: true}
+	c5      = &mockClient{id: "5", reportV2: true}
 	factory = func(hostname string, url url.URL) (appclient.AppClient, error) {
 		switch url.Host {
 		case "a1":
@@ -60,6 +67,10 @@ var (
 			return b2, nil
 		case "b3":
 			return b3, nil
+		case "c4":
+			return c4, nil
+		case "c5":
+			return c5, nil
 		}
 		panic(url.Host)
 	}
@@ -114,3 +125,140 @@ func TestMultiClientPublish(t *testing.T) {
 		}
 	}
 }
+
+type recordingPublisher struct {
+	reportV2 bool
+	deltas   bool
+	resync   bool
+	buf      []byte
+}
+
+func (p *recordingPublisher) Publish(r io.Reader, _ bool) error {
+	var err error
+	p.buf, err = ioutil.ReadAll(r)
+	return err
+}
+
+func (p *recordingPublisher) Stop() {}
+
+func (p *recordingPublisher) ReportV2() bool { return p.reportV2 }
+
+func (p *recordingPublisher) ReportDeltas() bool { return p.deltas }
+
+func (p *recordingPublisher) NeedResync() bool {
+	resync := p.resync
+	p.resync = false
+	return resync
+}
+
+func (p *recordingPublisher) published(t *testing.T) report.Report {
+	rpt, err := report.MakeFromBytes(p.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *rpt
+}
+
+func TestMultiClientReportV2(t *testing.T) {
+	mp := appclient.NewMultiAppClient(factory, false)
+	defer mp.Stop()
+	v2 := mp.(interface {
+		ReportV2() bool
+	})
+
+	if v2.ReportV2() {
+		t.Errorf("Expected no v2 reports without apps")
+	}
+	mp.Set("c", []url.URL{{Host: "c4"}, {Host: "c5"}})
+	if !v2.ReportV2() {
+		t.Errorf("Expected v2 reports when all apps accept them")
+	}
+	mp.Set("b", []url.URL{{Host: "b3"}})
+	if v2.ReportV2() {
+		t.Errorf("Expected no v2 reports when an app doesn't accept them")
+	}
+	mp.Set("b", []url.URL{})
+	if !v2.ReportV2() {
+		t.Errorf("Expected v2 reports once the app is gone")
+	}
+
+	for _, accepted := range []bool{false, true} {
+		p := &recordingPublisher{reportV2: accepted}
+		if err := appclient.NewReportPublisher(p, false).Publish(report.MakeReport()); err != nil {
+			t.Fatal(err)
+		}
+		if have := report.PeekV2(bufio.NewReader(bytes.NewReader(p.buf))); have != accepted {
+			t.Errorf("Expected a v2 report: %v, got one: %v", accepted, have)
+		}
+	}
+}
+
+func TestReportPublisherDeltas(t *testing.T) {
+	p := &recordingPublisher{deltas: true}
+	rp := appclient.NewReportPublisher(p, false)
+	publish := func() report.Report {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode("host"))
+		if err := rp.Publish(rpt); err != nil {
+			t.Fatal(err)
+		}
+		return p.published(t)
+	}
+
+	baseline := publish()
+	if baseline.IsDelta() {
+		t.Fatalf("Expected a full report first")
+	}
+	if delta := publish(); delta.Baseline != baseline.ID || len(delta.Host.Nodes) != 0 {
+		t.Errorf("Expected an empty delta of %s, got %v", baseline.ID, delta)
+	}
+
+	// Apps which lost the baseline get a full report
+	p.resync = true
+	if rpt := publish(); rpt.IsDelta() {
+		t.Errorf("Expected a full report on resync")
+	}
+
+	p.deltas = false
+	publish()
+	p.deltas = true
+	if rpt := publish(); rpt.IsDelta() {
+		t.Errorf("Expected a full report once apps accept deltas again")
+	}
+}
+
+func TestReportPublisherMaxSize(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host"))
+	rpt.Container.AddNode(report.MakeNodeWith("container", map[string]string{"name": "db"}))
+	for i := 0; i < 1000; i++ {
+		rpt.Endpoint.AddNode(report.MakeNode(fmt.Sprintf("endpoint%d", i)))
+	}
+
+	p := &recordingPublisher{}
+	rp := appclient.NewReportPublisher(p, false)
+	rp.SetMaxSize(1000)
+	if err := rp.Publish(rpt); err != nil {
+		t.Fatal(err)
+	}
+	have := p.published(t)
+	if len(have.Endpoint.Nodes) != 0 || len(have.Container.Nodes) != 1 {
+		t.Errorf("Expected only the endpoints left out, got %d endpoints and %d containers", len(have.Endpoint.Nodes), len(have.Container.Nodes))
+	}
+	if truncated, _ := have.Host.Nodes["host"].Latest.Lookup(report.TruncatedTopologies); truncated != "endpoint=1000" {
+		t.Errorf("Expected the endpoints left out recorded, got %q", truncated)
+	}
+	if len(rpt.Endpoint.Nodes) != 1000 {
+		t.Errorf("Expected the published report left alone")
+	}
+
+	// Within the budget, nothing is left out
+	rp.SetMaxSize(1 << 20)
+	if err := rp.Publish(rpt); err != nil {
+		t.Fatal(err)
+	}
+	have = p.published(t)
+	if truncated, _ := have.Host.Nodes["host"].Latest.Lookup(report.TruncatedTopologies); len(have.Endpoint.Nodes) != 1000 || truncated != "" {
+		t.Errorf("Expected a whole report, got %d endpoints and %q", len(have.Endpoint.Nodes), truncated)
+	}
+}
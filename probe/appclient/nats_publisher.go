@@ -0,0 +1,181 @@
+package appclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nats-io/nats"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// NATSPublisher is a Publisher of reports on a NATS subject, for apps to
+// consume them through the message bus rather than probes posting them to
+// apps. NATS doesn't keep the messages published while no app consumes
+// them, so reports are kept until an app acknowledges them, and are
+// published again until one does: apps being down, or the connection to
+// NATS, only loses the oldest reports beyond the number kept.
+type NATSPublisher struct {
+	conn       *nats.Conn
+	subject    string
+	probeID    string
+	maxPending int
+
+	mtx     sync.Mutex
+	pending []pendingReport // oldest first
+	seq     uint64
+	wake    chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+type pendingReport struct {
+	seq uint64
+	msg []byte
+}
+
+// Exposed for testing
+var (
+	natsAckTimeout    = 10 * time.Second
+	natsRetryInterval = 5 * time.Second
+)
+
+// NewNATSPublisher connects to the NATS server at url, to publish reports
+// of the probe on subject. Up to maxPending reports are kept until apps
+// acknowledge them.
+func NewNATSPublisher(url, subject, probeID string, maxPending int) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("scope-probe-"+probeID),
+		nats.MaxReconnects(-1),
+		nats.DisconnectHandler(func(*nats.Conn) {
+			log.Warnf("Disconnected from NATS at %s, keeping reports", url)
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			log.Infof("Reconnected to NATS at %s", url)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if maxPending < 1 {
+		maxPending = 1
+	}
+	p := &NATSPublisher{
+		conn:       conn,
+		subject:    subject,
+		probeID:    probeID,
+		maxPending: maxPending,
+		wake:       make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go p.loop()
+	return p, nil
+}
+
+// Publish implements Publisher. Reports are always full ones in the gzipped
+// msgpack format, as apps don't tell they lost the baselines of incremental
+// ones over the bus.
+func (p *NATSPublisher) Publish(r io.Reader, shortcut bool) error {
+	rpt, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	msg := xfer.ReportMessage{
+		ProbeID:       p.probeID,
+		Report:        rpt,
+		SchemaVersion: strconv.Itoa(report.SchemaVersion),
+		Checksum:      xfer.ReportChecksum(rpt),
+	}
+	if err := codec.NewEncoder(buf, &codec.MsgpackHandle{}).Encode(msg); err != nil {
+		return err
+	}
+
+	p.mtx.Lock()
+	p.seq++
+	p.pending = append(p.pending, pendingReport{seq: p.seq, msg: buf.Bytes()})
+	if len(p.pending) > p.maxPending {
+		log.Warnf("Dropping report; no app acknowledged the last %d published on NATS", p.maxPending)
+		p.pending = p.pending[1:]
+	}
+	p.mtx.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// loop publishes the oldest report kept until an app acknowledges it, in
+// turn. Once stopped, it publishes the reports kept until none are left or
+// no app acknowledges them.
+func (p *NATSPublisher) loop() {
+	defer close(p.done)
+	unacknowledged := false
+	for {
+		next, ok := p.oldest()
+		if !ok {
+			select {
+			case <-p.wake:
+			case <-p.quit:
+				if _, ok := p.oldest(); !ok {
+					return
+				}
+			}
+			continue
+		}
+
+		if _, err := p.conn.Request(p.subject, next.msg, natsAckTimeout); err != nil {
+			if !unacknowledged {
+				log.Warnf("No app acknowledged the report published on NATS, keeping reports until one does: %v", err)
+				unacknowledged = true
+			}
+			select {
+			case <-time.After(natsRetryInterval):
+				continue
+			case <-p.quit:
+				return
+			}
+		}
+		if unacknowledged {
+			log.Infof("Apps acknowledge the reports published on NATS again")
+			unacknowledged = false
+		}
+		p.mtx.Lock()
+		// Unless it was dropped meanwhile
+		if len(p.pending) > 0 && p.pending[0].seq == next.seq {
+			p.pending = p.pending[1:]
+		}
+		p.mtx.Unlock()
+	}
+}
+
+func (p *NATSPublisher) oldest() (pendingReport, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if len(p.pending) == 0 {
+		return pendingReport{}, false
+	}
+	return p.pending[0], true
+}
+
+// Stop implements Publisher, publishing the reports kept while apps
+// acknowledge them; the others are lost.
+func (p *NATSPublisher) Stop() {
+	close(p.quit)
+	<-p.done
+	p.mtx.Lock()
+	if len(p.pending) > 0 {
+		log.Warnf("Stopping with %d reports no app acknowledged on NATS", len(p.pending))
+	}
+	p.mtx.Unlock()
+	p.conn.Close()
+}
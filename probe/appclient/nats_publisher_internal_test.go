@@ -0,0 +1,75 @@
+package appclient
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/gnatsd/server"
+	natsTest "github.com/nats-io/gnatsd/test"
+	"github.com/nats-io/nats"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func TestNATSPublisherKeepsReports(t *testing.T) {
+	oldAckTimeout, oldRetryInterval := natsAckTimeout, natsRetryInterval
+	defer func() { natsAckTimeout, natsRetryInterval = oldAckTimeout, oldRetryInterval }()
+	natsAckTimeout, natsRetryInterval = 50*time.Millisecond, 10*time.Millisecond
+
+	opts := natsTest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	s := natsTest.RunServer(&opts)
+	defer s.Shutdown()
+	url := fmt.Sprintf("nats://%s", s.Addr())
+
+	publisher, err := NewNATSPublisher(url, xfer.DefaultReportSubject, "probe1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Stop()
+
+	// While no app consumes them, the last reports are kept
+	for _, rpt := range []string{"a", "b", "c"} {
+		if err := publisher.Publish(strings.NewReader(rpt), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(2 * natsAckTimeout)
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	received := make(chan string, 10)
+	if _, err := conn.Subscribe(xfer.DefaultReportSubject, func(m *nats.Msg) {
+		var msg xfer.ReportMessage
+		if err := codec.NewDecoderBytes(m.Data, &codec.MsgpackHandle{}).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		received <- string(msg.Report)
+		conn.Publish(m.Reply, nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var have []string
+	for len(have) < 2 {
+		select {
+		case rpt := <-received:
+			// Reports published again before the app acknowledged them
+			if len(have) == 0 || have[len(have)-1] != rpt {
+				have = append(have, rpt)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the reports kept to be published, got %v", have)
+		}
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
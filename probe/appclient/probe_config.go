@@ -12,6 +12,7 @@ import (
 	"github.com/certifi/gocertifi"
 	"github.com/hashicorp/go-cleanhttp"
 
+	"github.com/weaveworks/scope/common/certs"
 	"github.com/weaveworks/scope/common/xfer"
 )
 
@@ -35,6 +36,15 @@ type ProbeConfig struct {
 	ProbeVersion string
 	ProbeID      string
 	Insecure     bool
+	// TLS, if set, has the certificate the probe presents to apps, and
+	// the CAs their certificates are verified against.
+	TLS *certs.Reloader
+	// MaxRetries, if above 0, is how many failures in a row the loops
+	// publishing reports to and handling controls of an app retry before
+	// giving up. OnGiveUp, if set, gives the function recording the error
+	// of the loop called name which gave up.
+	MaxRetries int
+	OnGiveUp   func(name string) func(error)
 }
 
 func (pc ProbeConfig) authorizeHeaders(headers http.Header) {
@@ -57,7 +67,13 @@ func (pc ProbeConfig) getHTTPTransport(hostname string) *http.Transport {
 		Timeout:   dialTimeout,
 		KeepAlive: 30 * time.Second,
 	}).DialContext
-	if pc.Insecure {
+	if pc.TLS != nil {
+		transport.TLSClientConfig = pc.TLS.ClientConfig(hostname, certPool)
+		if pc.Insecure {
+			transport.TLSClientConfig.InsecureSkipVerify = true
+			transport.TLSClientConfig.VerifyConnection = nil
+		}
+	} else if pc.Insecure {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	} else {
 		transport.TLSClientConfig = &tls.Config{
@@ -3,14 +3,68 @@ package appclient
 import (
 	"bytes"
 	"compress/gzip"
+	"io"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/report"
 )
 
+// fullReportInterval is how often a full report is published, when the
+// others are incremental.
+const fullReportInterval = 1 * time.Minute
+
 // A ReportPublisher uses a buffer pool to serialise reports, which it
 // then passes to a publisher
 type ReportPublisher struct {
-	publisher  Publisher
-	noControls bool
+	publisher   Publisher
+	noControls  bool
+	compression CompressionConfig
+	maxSize     int
+	lastSize    int64 // atomically
+
+	// The last full report, which incremental reports are deltas of
+	baseline     *report.Report
+	baselineTime time.Time
+}
+
+// reportV2Publisher is a Publisher which knows whether all the apps it
+// publishes to accept reports in the v2 wire format.
+type reportV2Publisher interface {
+	ReportV2() bool
+}
+
+// CompressionConfig is how reports are compressed: in the first of the
+// Content-Encodings all the apps accept, at Level (as in compress/flate).
+type CompressionConfig struct {
+	Encodings []string
+	Level     int
+}
+
+// encodingPublisher is a Publisher which knows whether all the apps it
+// publishes to accept reports in a Content-Encoding.
+type encodingPublisher interface {
+	AcceptsReportEncoding(encoding string) bool
+}
+
+// encodedReport is a report published in a Content-Encoding other than
+// gzip, which can't be told by peeking at it.
+type encodedReport struct {
+	*bytes.Reader
+	encoding string
+	v2       bool
+}
+
+// deltaPublisher is a Publisher which knows whether all the apps it publishes
+// to accept incremental reports, and whether any of them lost the baseline of
+// those since it was last asked.
+type deltaPublisher interface {
+	ReportDeltas() bool
+	NeedResync() bool
 }
 
 // NewReportPublisher creates a new report publisher
@@ -18,17 +72,175 @@ func NewReportPublisher(publisher Publisher, noControls bool) *ReportPublisher {
 	return &ReportPublisher{
 		publisher:  publisher,
 		noControls: noControls,
+		compression: CompressionConfig{
+			Encodings: []string{xfer.GzipEncoding},
+			Level:     gzip.DefaultCompression,
+		},
+	}
+}
+
+// SetCompression sets how reports are compressed. It must not be called
+// concurrently with Publish.
+func (p *ReportPublisher) SetCompression(config CompressionConfig) {
+	p.compression = config
+}
+
+// encoding gives the first of the Content-Encodings of the config all the
+// apps accept, or gzip if they accept none.
+func (p *ReportPublisher) encoding() string {
+	for _, encoding := range p.compression.Encodings {
+		if encoding == xfer.GzipEncoding || encoding == xfer.IdentityEncoding {
+			return encoding
+		}
+		if e, ok := p.publisher.(encodingPublisher); ok && e.AcceptsReportEncoding(encoding) {
+			return encoding
+		}
 	}
+	return xfer.GzipEncoding
 }
 
-// Publish serialises and compresses a report, then passes it to a publisher
+// Publish serialises and compresses a report, then passes it to a publisher.
+// Reports are in the v2 wire format when the publisher's apps all accept it,
+// and incremental when they accept that. Other than in gzip, the compression
+// of the wire formats is left to the Content-Encoding.
 func (p *ReportPublisher) Publish(r report.Report) error {
 	if p.noControls {
 		r.WalkTopologies(func(t *report.Topology) {
 			t.Controls = report.Controls{}
 		})
 	}
-	buf := &bytes.Buffer{}
-	r.WriteBinary(buf, gzip.DefaultCompression)
-	return p.publisher.Publish(buf, r.Shortcut)
+	encoding := p.encoding()
+	v2Publisher, v2 := p.publisher.(reportV2Publisher)
+	v2 = v2 && v2Publisher.ReportV2()
+	if !r.Shortcut {
+		// Truncated before the delta, so the baseline is what the apps get
+		if p.maxSize > 0 {
+			r = p.truncate(r, encoding, v2)
+		}
+		r = p.delta(r)
+	}
+	buf, err := p.encode(r, encoding, v2)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&p.lastSize, int64(buf.Len()))
+	if encoding == xfer.GzipEncoding {
+		return p.publisher.Publish(buf, r.Shortcut)
+	}
+	return p.publisher.Publish(encodedReport{Reader: bytes.NewReader(buf.Bytes()), encoding: encoding, v2: v2}, r.Shortcut)
+}
+
+// encode a report in a Content-Encoding, and wire format.
+func (p *ReportPublisher) encode(r report.Report, encoding string, v2 bool) (*bytes.Buffer, error) {
+	var (
+		buf     = &bytes.Buffer{}
+		w       = io.Writer(buf)
+		level   = p.compression.Level
+		encoder io.WriteCloser
+		err     error
+	)
+	if encoding != xfer.GzipEncoding && encoding != xfer.IdentityEncoding {
+		if encoder, err = xfer.NewReportEncoder(buf, encoding, level); err != nil {
+			return nil, err
+		}
+		w = encoder
+	}
+	if v2 {
+		// v2 reports are always gzipped, but needn't be compressed twice
+		if encoding != xfer.GzipEncoding {
+			level = gzip.NoCompression
+		}
+		err = r.WriteBinaryV2(w, level)
+	} else if encoding == xfer.GzipEncoding {
+		err = r.WriteBinary(w, level)
+	} else {
+		err = codec.NewEncoder(w, &codec.MsgpackHandle{}).Encode(&r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if encoder != nil {
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// SetMaxSize sets the size budget of reports, in bytes once serialised and
+// compressed; 0 is unlimited. It must not be called concurrently with
+// Publish.
+func (p *ReportPublisher) SetMaxSize(maxSize int) {
+	p.maxSize = maxSize
+}
+
+// TruncationOrder is the order in which topologies are left out of reports
+// over their size budget, exposed for testing. The host topology never is.
+var TruncationOrder = []string{
+	report.Endpoint,
+	report.Process,
+	report.NetIface,
+	report.ContainerImage,
+	report.Container,
+}
+
+// truncate leaves topologies out of a report until it is within the size
+// budget, recording how many nodes were left out of each on its host nodes.
+// Reports have to be serialised to be measured, so budgets cost time.
+func (p *ReportPublisher) truncate(r report.Report, encoding string, v2 bool) report.Report {
+	truncated := map[string]int{}
+	topologies := r.TopologyMap()
+	for _, name := range TruncationOrder {
+		t := topologies[name]
+		if len(t.Nodes) == 0 {
+			continue
+		}
+		if buf, err := p.encode(r, encoding, v2); err != nil || buf.Len() <= p.maxSize {
+			break
+		}
+		truncated[name] = len(t.Nodes)
+		t.Nodes = report.Nodes{}
+	}
+	if len(truncated) > 0 {
+		log.Warnf("Report over its budget of %d bytes, left out the nodes of %s", p.maxSize, report.FormatTruncated(truncated))
+	}
+
+	// The host nodes are shared with the caller
+	hosts := make(report.Nodes, len(r.Host.Nodes))
+	for id, n := range r.Host.Nodes {
+		hosts[id] = n.WithLatests(map[string]string{report.TruncatedTopologies: report.FormatTruncated(truncated)})
+	}
+	r.Host.Nodes = hosts
+	return r
+}
+
+// delta gives the delta of a report against the last full one, or the report
+// itself when it's time for a full one.
+func (p *ReportPublisher) delta(r report.Report) report.Report {
+	deltas, ok := p.publisher.(deltaPublisher)
+	if !ok || !deltas.ReportDeltas() {
+		p.baseline = nil
+		return r
+	}
+	// Asking whether a resync is needed clears it, so it must always be asked
+	resync := deltas.NeedResync()
+	if now := time.Now(); resync || p.baseline == nil || now.Sub(p.baselineTime) >= fullReportInterval {
+		p.baseline, p.baselineTime = &r, now
+		return r
+	}
+	return r.Delta(*p.baseline)
+}
+
+// LastSize is the size of the last report serialised by Publish, in bytes.
+func (p *ReportPublisher) LastSize() int {
+	return int(atomic.LoadInt64(&p.lastSize))
+}
+
+// Targets gives the state of the connections to the apps published to, if
+// the publisher knows them.
+func (p *ReportPublisher) Targets() []TargetStatus {
+	if t, ok := p.publisher.(targeter); ok {
+		return t.Targets()
+	}
+	return nil
 }
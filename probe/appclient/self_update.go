@@ -0,0 +1,186 @@
+package appclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/go-version"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	selfUpdateTimeout = 5 * time.Minute
+	selfUpdateRetry   = 10 * time.Minute // after failed updates
+	maxProbeBinary    = 512 << 20
+)
+
+// ProbeUpdater updates the probe to the version apps advertise.
+type ProbeUpdater interface {
+	Update(xfer.ProbeUpdateInfo)
+}
+
+// SelfUpdaterConfig configures a SelfUpdater.
+type SelfUpdaterConfig struct {
+	Version   string // of the probe running
+	PublicKey string // Ed25519, in base64, binaries must be signed with
+}
+
+// SelfUpdater is a ProbeUpdater replacing the binary of the probe with the
+// one of the version advertised, once its signature is verified, and
+// restarting the probe with it. Probes are only updated to newer versions:
+// as the signature covers the version, an old update replayed can't make
+// probes go back, nor restart them over and over, as the record of failed
+// updates is lost on restarting.
+type SelfUpdater struct {
+	version    string
+	publicKey  ed25519.PublicKey
+	executable string
+	client     *http.Client
+
+	mtx      sync.Mutex
+	updating bool
+	failed   map[string]time.Time // by version
+}
+
+// Exposed for testing
+var (
+	execProbe = syscall.Exec
+)
+
+// NewSelfUpdater makes a new SelfUpdater, of the binary the probe runs.
+func NewSelfUpdater(config SelfUpdaterConfig) (*SelfUpdater, error) {
+	key, err := base64.StdEncoding.DecodeString(config.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Invalid public key: %d bytes, rather than %d", len(key), ed25519.PublicKeySize)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return nil, err
+	}
+	return &SelfUpdater{
+		version:    config.Version,
+		publicKey:  ed25519.PublicKey(key),
+		executable: executable,
+		client:     &http.Client{Timeout: selfUpdateTimeout},
+		failed:     map[string]time.Time{},
+	}, nil
+}
+
+// Update implements ProbeUpdater, updating the probe in the background
+// unless it runs the version or a newer one already, is being updated, or
+// failed to be updated to the version lately.
+func (u *SelfUpdater) Update(update xfer.ProbeUpdateInfo) {
+	if update.Version == "" || update.Version == u.version {
+		return
+	}
+	if err := checkUpgrade(u.version, update.Version); err != nil {
+		u.mtx.Lock()
+		defer u.mtx.Unlock()
+		if time.Since(u.failed[update.Version]) >= selfUpdateRetry {
+			log.Warnf("Not updating probe to version %s: %v", update.Version, err)
+			u.failed[update.Version] = time.Now()
+		}
+		return
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	if u.updating || time.Since(u.failed[update.Version]) < selfUpdateRetry {
+		return
+	}
+	u.updating = true
+	go func() {
+		if err := u.update(update); err != nil {
+			log.Errorf("Error updating probe to version %s: %v", update.Version, err)
+		}
+		u.mtx.Lock()
+		defer u.mtx.Unlock()
+		u.updating = false
+		u.failed[update.Version] = time.Now()
+	}()
+}
+
+// update downloads the binary of a version, verifies it, replaces the
+// binary of the probe with it and executes it. It only returns if it fails.
+func (u *SelfUpdater) update(update xfer.ProbeUpdateInfo) error {
+	signature, err := base64.StdEncoding.DecodeString(update.Signature)
+	if err != nil {
+		return fmt.Errorf("Invalid signature: %v", err)
+	}
+	log.Infof("Updating probe from version %s to %s, from %s", u.version, update.Version, update.DownloadURL)
+	resp, err := u.client.Get(update.DownloadURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error downloading %s: %s", update.DownloadURL, resp.Status)
+	}
+	binary, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBinary+1))
+	if err != nil {
+		return err
+	}
+	if len(binary) > maxProbeBinary {
+		return fmt.Errorf("Probe binary at %s is over %d bytes", update.DownloadURL, maxProbeBinary)
+	}
+	if !ed25519.Verify(u.publicKey, xfer.ProbeUpdateMessage(update.Version, binary), signature) {
+		return fmt.Errorf("Invalid signature of %s, as version %s", update.DownloadURL, update.Version)
+	}
+
+	// The binary is replaced atomically, by renaming the new one over it
+	// from the same directory
+	f, err := ioutil.TempFile(filepath.Dir(u.executable), ".scope-update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0755); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), u.executable); err != nil {
+		return err
+	}
+	log.Infof("Updated probe to version %s; restarting", update.Version)
+	return execProbe(u.executable, os.Args, os.Environ())
+}
+
+// checkUpgrade checks that going from version from to version to is an
+// upgrade.
+func checkUpgrade(from, to string) error {
+	current, err := version.NewVersion(from)
+	if err != nil {
+		return fmt.Errorf("Unknown version of the probe running: %v", err)
+	}
+	next, err := version.NewVersion(to)
+	if err != nil {
+		return err
+	}
+	if !next.GreaterThan(current) {
+		return fmt.Errorf("%s is not newer than %s", to, from)
+	}
+	return nil
+}
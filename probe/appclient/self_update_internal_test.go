@@ -0,0 +1,113 @@
+package appclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestSelfUpdater(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("#!/bin/sh\necho 1.2.0\n")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "self-update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	executable := filepath.Join(dir, "scope")
+	if err := ioutil.WriteFile(executable, []byte("1.0.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	execed := make(chan string, 1)
+	oldExec := execProbe
+	defer func() { execProbe = oldExec }()
+	execProbe = func(argv0 string, argv []string, envv []string) error {
+		execed <- argv0
+		return nil
+	}
+
+	if _, err := NewSelfUpdater(SelfUpdaterConfig{Version: "1.0.0", PublicKey: "c2hvcnQ="}); err == nil {
+		t.Errorf("Expected an error with a short public key")
+	}
+	u, err := NewSelfUpdater(SelfUpdaterConfig{Version: "1.0.0", PublicKey: base64.StdEncoding.EncodeToString(public)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.executable = executable
+	updating := func() interface{} {
+		u.mtx.Lock()
+		defer u.mtx.Unlock()
+		return u.updating
+	}
+
+	sign := func(version string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(private, xfer.ProbeUpdateMessage(version, binary)))
+	}
+
+	// Binaries not signed with the key are never run, nor are those signed
+	// as other versions
+	for _, update := range []xfer.ProbeUpdateInfo{
+		{Version: "1.1.0", DownloadURL: ts.URL, Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("something else")))},
+		{Version: "1.1.5", DownloadURL: ts.URL, Signature: sign("1.2.0")},
+	} {
+		u.Update(update)
+		test.Poll(t, time.Second, false, updating)
+		if have, _ := ioutil.ReadFile(executable); !bytes.Equal(have, []byte("1.0.0")) {
+			t.Errorf("Expected the binary not to be replaced, got %q", have)
+		}
+		select {
+		case <-execed:
+			t.Fatalf("Expected a binary with an invalid signature for %s not to be run", update.Version)
+		default:
+		}
+	}
+
+	// The version the probe runs is kept, and older ones are not gone back
+	// to, however signed
+	for _, version := range []string{"1.0.0", "0.9.0"} {
+		u.Update(xfer.ProbeUpdateInfo{Version: version, DownloadURL: ts.URL, Signature: sign(version)})
+		if updating().(bool) {
+			t.Errorf("Expected no update to version %s", version)
+		}
+	}
+
+	u.Update(xfer.ProbeUpdateInfo{
+		Version:     "1.2.0",
+		DownloadURL: ts.URL,
+		Signature:   sign("1.2.0"),
+	})
+	select {
+	case have := <-execed:
+		if have != executable {
+			t.Errorf("Expected %s to be run, got %s", executable, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the new binary to be run")
+	}
+	if have, _ := ioutil.ReadFile(executable); !bytes.Equal(have, binary) {
+		t.Errorf("Expected the binary to be replaced, got %q", have)
+	}
+	if info, err := os.Stat(executable); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected an executable binary, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,107 @@
+package awsec2
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Instance describes the parts of the EC2 instance the probe runs on we care
+// about. Exported for test.
+type Instance struct {
+	ID               string
+	Type             string
+	AvailabilityZone string
+	VPCID            string
+	SubnetID         string
+	SecurityGroups   []string
+	Tags             map[string]string
+}
+
+// Client fetches the instance the probe runs on.
+// We create an interface so we can mock for testing.
+type Client interface {
+	Instance() (Instance, error)
+}
+
+// actual implementation
+type clientImpl struct {
+	metadata *ec2metadata.EC2Metadata
+	ec2      *ec2.EC2
+}
+
+// NewClient makes a Client of the metadata service and EC2 API of the
+// instance the probe runs on, failing if it doesn't run on one.
+func NewClient() (Client, error) {
+	sess := session.New()
+	metadata := ec2metadata.New(sess)
+	if !metadata.Available() {
+		return nil, fmt.Errorf("EC2 metadata service not available")
+	}
+	region, err := metadata.Region()
+	if err != nil {
+		return nil, err
+	}
+	return &clientImpl{
+		metadata: metadata,
+		ec2:      ec2.New(sess, &aws.Config{Region: aws.String(region)}),
+	}, nil
+}
+
+// Implements Client.Instance. Everything but the tags comes from the
+// metadata service; those need the ec2:DescribeTags permission, so failing to
+// get them only leaves them out.
+func (c *clientImpl) Instance() (Instance, error) {
+	var instance Instance
+	for path, value := range map[string]*string{
+		"instance-id":                 &instance.ID,
+		"instance-type":               &instance.Type,
+		"placement/availability-zone": &instance.AvailabilityZone,
+	} {
+		v, err := c.metadata.GetMetadata(path)
+		if err != nil {
+			return Instance{}, err
+		}
+		*value = v
+	}
+	if groups, err := c.metadata.GetMetadata("security-groups"); err == nil {
+		instance.SecurityGroups = strings.Fields(groups)
+	}
+	// The VPC and subnet are those of the primary network interface.
+	if mac, err := c.metadata.GetMetadata("mac"); err == nil {
+		instance.VPCID, _ = c.metadata.GetMetadata("network/interfaces/macs/" + mac + "/vpc-id")
+		instance.SubnetID, _ = c.metadata.GetMetadata("network/interfaces/macs/" + mac + "/subnet-id")
+	}
+	tags, err := c.tags(instance.ID)
+	if err != nil {
+		log.Warnf("Error describing tags of EC2 instance %s, EC2 report will be missing them: %v", instance.ID, err)
+	}
+	instance.Tags = tags
+	return instance, nil
+}
+
+func (c *clientImpl) tags(instanceID string) (map[string]string, error) {
+	tags := map[string]string{}
+	err := c.ec2.DescribeTagsPages(
+		&ec2.DescribeTagsInput{Filters: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: []*string{aws.String(instanceID)}},
+		}},
+		func(page *ec2.DescribeTagsOutput, lastPage bool) bool {
+			if page == nil {
+				return true
+			}
+			for _, tag := range page.Tags {
+				if tag != nil && tag.Key != nil {
+					tags[*tag.Key] = aws.StringValue(tag.Value)
+				}
+			}
+			return true
+		},
+	)
+	return tags, err
+}
@@ -0,0 +1,116 @@
+package awsec2
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest and Node.Sets of hosts.
+const (
+	InstanceID       = "aws_instance_id"
+	InstanceType     = "aws_instance_type"
+	AvailabilityZone = "aws_availability_zone"
+	VPCID            = "aws_vpc_id"
+	SubnetID         = "aws_subnet_id"
+	SecurityGroups   = "aws_security_groups"
+	TagPrefix        = "aws_tag_"
+)
+
+// Exposed for testing.
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		InstanceID:       {ID: InstanceID, Label: "EC2 Instance", From: report.FromLatest, Priority: 21},
+		InstanceType:     {ID: InstanceType, Label: "Instance Type", From: report.FromLatest, Priority: 22},
+		AvailabilityZone: {ID: AvailabilityZone, Label: "Availability Zone", From: report.FromLatest, Priority: 23},
+		VPCID:            {ID: VPCID, Label: "VPC", From: report.FromLatest, Priority: 24},
+		SubnetID:         {ID: SubnetID, Label: "Subnet", From: report.FromLatest, Priority: 25},
+		SecurityGroups:   {ID: SecurityGroups, Label: "Security Groups", From: report.FromSets, Priority: 26},
+	}
+
+	TableTemplates = report.TableTemplates{
+		TagPrefix: {
+			ID:     TagPrefix,
+			Label:  "EC2 Tags",
+			Type:   report.PropertyListType,
+			Prefix: TagPrefix,
+		},
+	}
+)
+
+// Reporter adds the EC2 instance the probe runs on to its host node.
+// Instances hardly change, so they are fetched at most once per refresh.
+type Reporter struct {
+	hostID  string
+	client  Client
+	refresh time.Duration
+
+	mtx      sync.Mutex
+	instance *Instance
+	fetched  time.Time
+}
+
+// NewReporter makes a new Reporter.
+func NewReporter(hostID string, client Client, refresh time.Duration) *Reporter {
+	return &Reporter{
+		hostID:  hostID,
+		client:  client,
+		refresh: refresh,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "EC2" }
+
+// getInstance gives the instance, fetching it if it is older than the
+// refresh, or the last one fetched if fetching fails.
+func (r *Reporter) getInstance() *Instance {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := mtime.Now()
+	if r.instance != nil && now.Sub(r.fetched) < r.refresh {
+		return r.instance
+	}
+	instance, err := r.client.Instance()
+	if err != nil {
+		log.Warnf("Error getting EC2 instance: %v", err)
+		return r.instance
+	}
+	r.instance, r.fetched = &instance, now
+	return r.instance
+}
+
+// Report implements Reporter.
+func (r *Reporter) Report() (report.Report, error) {
+	rpt := report.MakeReport()
+	instance := r.getInstance()
+	if instance == nil {
+		return rpt, nil
+	}
+	latest := map[string]string{}
+	for key, value := range map[string]string{
+		InstanceID:       instance.ID,
+		InstanceType:     instance.Type,
+		AvailabilityZone: instance.AvailabilityZone,
+		VPCID:            instance.VPCID,
+		SubnetID:         instance.SubnetID,
+	} {
+		if value != "" {
+			latest[key] = value
+		}
+	}
+	node := report.MakeNodeWith(report.MakeHostNodeID(r.hostID), latest).
+		AddPrefixPropertyList(TagPrefix, instance.Tags)
+	if len(instance.SecurityGroups) > 0 {
+		node = node.WithSet(SecurityGroups, report.MakeStringSet(instance.SecurityGroups...))
+	}
+	rpt.Host = rpt.Host.
+		WithMetadataTemplates(MetadataTemplates).
+		WithTableTemplates(TableTemplates)
+	rpt.Host.AddNode(node)
+	return rpt, nil
+}
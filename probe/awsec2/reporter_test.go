@@ -0,0 +1,89 @@
+package awsec2_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/awsec2"
+	"github.com/weaveworks/scope/report"
+)
+
+// Implements Client
+type mockClient struct {
+	instance awsec2.Instance
+	err      error
+	calls    int
+}
+
+func (c *mockClient) Instance() (awsec2.Instance, error) {
+	c.calls++
+	return c.instance, c.err
+}
+
+func TestReporter(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	client := &mockClient{instance: awsec2.Instance{
+		ID:               "i-0123456789abcdef0",
+		Type:             "m5.large",
+		AvailabilityZone: "us-east-1a",
+		VPCID:            "vpc-1234",
+		SubnetID:         "subnet-5678",
+		SecurityGroups:   []string{"default", "web"},
+		Tags:             map[string]string{"Name": "web-1"},
+	}}
+	r := awsec2.NewReporter("host1", client, time.Minute)
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, ok := rpt.Host.Nodes[report.MakeHostNodeID("host1")]
+	if !ok {
+		t.Fatalf("Expected the host node, got %v", rpt.Host.Nodes)
+	}
+	for key, want := range map[string]string{
+		awsec2.InstanceID:         "i-0123456789abcdef0",
+		awsec2.InstanceType:       "m5.large",
+		awsec2.AvailabilityZone:   "us-east-1a",
+		awsec2.VPCID:              "vpc-1234",
+		awsec2.SubnetID:           "subnet-5678",
+		awsec2.TagPrefix + "Name": "web-1",
+	} {
+		if have, _ := node.Latest.Lookup(key); have != want {
+			t.Errorf("Expected %s of %q, got %q", key, want, have)
+		}
+	}
+	if groups, _ := node.Sets.Lookup(awsec2.SecurityGroups); !groups.Contains("web") || len(groups) != 2 {
+		t.Errorf("Expected the security groups, got %v", groups)
+	}
+
+	// The instance is only fetched again after the refresh, and kept if
+	// fetching it fails
+	if _, err := r.Report(); err != nil || client.calls != 1 {
+		t.Errorf("Expected the instance not to be fetched again, got %d calls, %v", client.calls, err)
+	}
+	mtime.NowForce(now.Add(2 * time.Minute))
+	client.err = fmt.Errorf("unavailable")
+	rpt, _ = r.Report()
+	if client.calls != 2 {
+		t.Errorf("Expected the instance to be fetched again, got %d calls", client.calls)
+	}
+	if zone, _ := rpt.Host.Nodes[report.MakeHostNodeID("host1")].Latest.Lookup(awsec2.AvailabilityZone); zone != "us-east-1a" {
+		t.Errorf("Expected the last instance fetched, got zone %q", zone)
+	}
+}
+
+func TestReporterWithoutInstance(t *testing.T) {
+	r := awsec2.NewReporter("host1", &mockClient{err: fmt.Errorf("unavailable")}, time.Minute)
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Host.Nodes) != 0 {
+		t.Errorf("Expected no host nodes, got %v", rpt.Host.Nodes)
+	}
+}
@@ -23,6 +23,8 @@ type EcsClient interface {
 	GetInfo([]string) EcsInfo
 	// Scales a service up or down by amount
 	ScaleService(string, int) error
+	// Returns the ARNs of the running Fargate tasks of the cluster.
+	ListFargateTasks() []string
 }
 
 // actual implementation
@@ -31,8 +33,18 @@ type ecsClientImpl struct {
 	cluster      string
 	taskCache    gcache.Cache // Keys are task ARNs.
 	serviceCache gcache.Cache // Keys are service names.
+	fargateCache gcache.Cache // Holds the list of Fargate task ARNs.
+	stackCache   gcache.Cache // Keys are service and task ARNs.
+	stacks       StackConfig
 }
 
+// Fargate tasks aren't on any probe's host, so they are listed from the ECS
+// API, at most once per fargateTasksExpiry.
+const (
+	fargateTasksExpiry = 15 * time.Second
+	fargateTasksKey    = "fargate-tasks"
+)
+
 // EcsTask describes the parts of ECS tasks we care about.
 // Since we're caching tasks heavily, we ensure no mistakes by casting into a structure
 // that only contains immutable attributes of the resource.
@@ -46,6 +58,9 @@ type EcsTask struct {
 	// which we know it is because otherwise we wouldn't be looking at it.
 	StartedAt time.Time
 	StartedBy string // tag or deployment id
+
+	// Fargate tasks don't run on a container instance.
+	Fargate bool
 }
 
 // EcsService describes the parts of ECS services we care about.
@@ -55,6 +70,7 @@ type EcsTask struct {
 // Exported for test.
 type EcsService struct {
 	ServiceName string
+	ServiceARN  string
 	// The following values may be stale in a cached copy
 	DeploymentIDs     []string
 	DesiredCount      int64
@@ -68,9 +84,13 @@ type EcsInfo struct {
 	Tasks          map[string]EcsTask
 	Services       map[string]EcsService
 	TaskServiceMap map[string]string
+	// The stacks of services, by name, and of tasks, by ARN, when stacks
+	// are looked up.
+	ServiceStacks map[string]Stack
+	TaskStacks    map[string]Stack
 }
 
-func newClient(cluster string, cacheSize int, cacheExpiry time.Duration, clusterRegion string) (EcsClient, error) {
+func newClient(cluster string, cacheSize int, cacheExpiry time.Duration, clusterRegion string, stacks StackConfig) (EcsClient, error) {
 	sess := session.New()
 	var err error
 
@@ -86,16 +106,20 @@ func newClient(cluster string, cacheSize int, cacheExpiry time.Duration, cluster
 		cluster:      cluster,
 		taskCache:    gcache.New(cacheSize).LRU().Expiration(cacheExpiry).Build(),
 		serviceCache: gcache.New(cacheSize).LRU().Expiration(cacheExpiry).Build(),
+		fargateCache: gcache.New(1).Expiration(fargateTasksExpiry).Build(),
+		stackCache:   gcache.New(cacheSize).LRU().Expiration(cacheExpiry).Build(),
+		stacks:       stacks,
 	}, nil
 }
 
 func newECSTask(task *ecs.Task) EcsTask {
 	return EcsTask{
-		TaskARN:           *task.TaskArn,
-		CreatedAt:         *task.CreatedAt,
-		TaskDefinitionARN: *task.TaskDefinitionArn,
-		StartedAt:         *task.StartedAt,
-		StartedBy:         *task.StartedBy,
+		TaskARN:           aws.StringValue(task.TaskArn),
+		CreatedAt:         aws.TimeValue(task.CreatedAt),
+		TaskDefinitionARN: aws.StringValue(task.TaskDefinitionArn),
+		StartedAt:         aws.TimeValue(task.StartedAt),
+		StartedBy:         aws.StringValue(task.StartedBy),
+		Fargate:           task.ContainerInstanceArn == nil,
 	}
 }
 
@@ -106,6 +130,7 @@ func newECSService(service *ecs.Service) EcsService {
 	}
 	return EcsService{
 		ServiceName:       *service.ServiceName,
+		ServiceARN:        aws.StringValue(service.ServiceArn),
 		DeploymentIDs:     deploymentIDs,
 		DesiredCount:      *service.DesiredCount,
 		PendingCount:      *service.PendingCount,
@@ -119,6 +144,16 @@ func (t EcsTask) IsServiceManaged() bool {
 	return strings.HasPrefix(t.StartedBy, servicePrefix)
 }
 
+// Family returns the family of the task definition of the task, from its
+// ARN: arn:aws:ecs:<region>:<account>:task-definition/<family>:<revision>
+func (t EcsTask) Family() string {
+	family := t.TaskDefinitionARN[strings.LastIndex(t.TaskDefinitionARN, "/")+1:]
+	if i := strings.LastIndex(family, ":"); i >= 0 {
+		family = family[:i]
+	}
+	return family
+}
+
 // Fetches a task from the cache, returning (task, ok) as per map[]
 func (c ecsClientImpl) getCachedTask(taskARN string) (EcsTask, bool) {
 	if taskRaw, err := c.taskCache.Get(taskARN); err == nil {
@@ -208,7 +243,7 @@ func (c ecsClientImpl) describeServicesBatch(names []string) {
 	}
 
 	for _, failure := range resp.Failures {
-		log.Warnf("Failed to describe ECS service %s, ECS service report may be incomplete: %s", *failure.Arn, failure.Reason)
+		log.Warnf("Failed to describe ECS service %s, ECS service report may be incomplete: %s", *failure.Arn, aws.StringValue(failure.Reason))
 	}
 
 	for _, service := range resp.Services {
@@ -249,6 +284,67 @@ func (c ecsClientImpl) getTasks(taskARNs []string) {
 	}
 }
 
+// Returns the ARNs of the tasks of the cluster meant to be running.
+// Cannot fail as it will attempt to deliver partial results.
+func (c ecsClientImpl) listTasks() []string {
+	log.Debugf("Listing ECS tasks")
+	results := []string{}
+	err := c.client.ListTasksPages(
+		&ecs.ListTasksInput{Cluster: &c.cluster, DesiredStatus: aws.String(ecs.DesiredStatusRunning)},
+		func(page *ecs.ListTasksOutput, lastPage bool) bool {
+			if page == nil {
+				return true
+			}
+			for _, arn := range page.TaskArns {
+				if arn != nil {
+					results = append(results, *arn)
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		log.Warnf("Error listing ECS tasks, ECS Fargate report may be incomplete: %v", err)
+	}
+	log.Debugf("Listed %d tasks", len(results))
+	return results
+}
+
+// Implements EcsClient.ListFargateTasks
+func (c ecsClientImpl) ListFargateTasks() []string {
+	if cached, err := c.fargateCache.Get(fargateTasksKey); err == nil {
+		return cached.([]string)
+	}
+
+	// Only tasks we don't know, or which hadn't started when we last looked,
+	// need describing.
+	const maxTasks = 100 // How many tasks we can put in one Describe command
+	taskARNs := c.listTasks()
+	toDescribe := []string{}
+	for _, taskARN := range taskARNs {
+		if task, ok := c.getCachedTask(taskARN); !ok || task.StartedAt.IsZero() {
+			toDescribe = append(toDescribe, taskARN)
+		}
+	}
+	for len(toDescribe) > 0 {
+		batch := toDescribe
+		if len(batch) > maxTasks {
+			batch = batch[:maxTasks]
+		}
+		toDescribe = toDescribe[len(batch):]
+		c.getTasks(batch)
+	}
+
+	results := []string{}
+	for _, taskARN := range taskARNs {
+		if task, ok := c.getCachedTask(taskARN); ok && task.Fargate && !task.StartedAt.IsZero() {
+			results = append(results, taskARN)
+		}
+	}
+	c.fargateCache.Set(fargateTasksKey, results)
+	return results
+}
+
 // Try to match a list of task ARNs to service names using cached info.
 // Returns (task to service map, unmatched tasks). Ignores tasks whose startedby values
 // don't appear to point to a service.
@@ -352,7 +448,11 @@ func (c ecsClientImpl) makeECSInfo(taskARNs []string, taskServiceMap map[string]
 		}
 	}
 
-	return EcsInfo{Services: services, Tasks: tasks, TaskServiceMap: taskServiceMap}
+	info := EcsInfo{Services: services, Tasks: tasks, TaskServiceMap: taskServiceMap}
+	if c.stacks.Enabled {
+		info.TaskStacks, info.ServiceStacks = c.getStacks(tasks, services, taskServiceMap)
+	}
+	return info
 }
 
 // Implements EcsClient.GetInfo
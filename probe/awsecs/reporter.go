@@ -16,17 +16,27 @@ const (
 	Cluster             = "ecs_cluster"
 	CreatedAt           = "ecs_created_at"
 	TaskFamily          = "ecs_task_family"
+	TaskLaunchType      = "ecs_task_launch_type"
 	ServiceDesiredCount = "ecs_service_desired_count"
 	ServiceRunningCount = "ecs_service_running_count"
 	ScaleUp             = "ecs_scale_up"
 	ScaleDown           = "ecs_scale_down"
+	StackKind           = "ecs_stack_kind"
+	StackName           = "ecs_stack_name"
+)
+
+// Values of TaskLaunchType
+const (
+	LaunchTypeEC2     = "EC2"
+	LaunchTypeFargate = "FARGATE"
 )
 
 var (
 	taskMetadata = report.MetadataTemplates{
-		Cluster:    {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
-		CreatedAt:  {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 1, Datatype: "datetime"},
-		TaskFamily: {ID: TaskFamily, Label: "Family", From: report.FromLatest, Priority: 2},
+		Cluster:        {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
+		CreatedAt:      {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 1, Datatype: "datetime"},
+		TaskFamily:     {ID: TaskFamily, Label: "Family", From: report.FromLatest, Priority: 2},
+		TaskLaunchType: {ID: TaskLaunchType, Label: "Launch Type", From: report.FromLatest, Priority: 3},
 	}
 	serviceMetadata = report.MetadataTemplates{
 		Cluster:             {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
@@ -34,6 +44,10 @@ var (
 		ServiceDesiredCount: {ID: ServiceDesiredCount, Label: "Desired Tasks", From: report.FromLatest, Priority: 2, Datatype: "number"},
 		ServiceRunningCount: {ID: ServiceRunningCount, Label: "Running Tasks", From: report.FromLatest, Priority: 3, Datatype: "number"},
 	}
+	stackMetadata = report.MetadataTemplates{
+		StackKind: {ID: StackKind, Label: "Kind", From: report.FromLatest, Priority: 0},
+		StackName: {ID: StackName, Label: "Name", From: report.FromLatest, Priority: 1},
+	}
 )
 
 // TaskLabelInfo is used in return value of GetLabelInfo. Exported for test.
@@ -78,7 +92,7 @@ func GetLabelInfo(rpt report.Report) map[string]map[string]*TaskLabelInfo {
 
 		task.ContainerIDs = append(task.ContainerIDs, nodeID)
 	}
-	log.Debug("Got ECS container info: %v", results)
+	log.Debugf("Got ECS container info: %v", results)
 	return results
 }
 
@@ -88,17 +102,25 @@ type Reporter struct {
 	cacheSize        int
 	cacheExpiry      time.Duration
 	clusterRegion    string
+	fargateClusters  []string
+	stacks           StackConfig
 	handlerRegistry  *controls.HandlerRegistry
 	probeID          string
 }
 
-// Make creates a new Reporter
-func Make(cacheSize int, cacheExpiry time.Duration, clusterRegion string, handlerRegistry *controls.HandlerRegistry, probeID string) Reporter {
+// Make creates a new Reporter. Fargate tasks don't run on any probe's host,
+// so the tasks and services of fargateClusters are listed from the ECS API
+// instead; only one probe per cluster should be given any. When stacks are
+// enabled, tasks and services are grouped by the CloudFormation stack or
+// Terraform workspace which created them, from their tags.
+func Make(cacheSize int, cacheExpiry time.Duration, clusterRegion string, fargateClusters []string, stacks StackConfig, handlerRegistry *controls.HandlerRegistry, probeID string) Reporter {
 	r := Reporter{
 		ClientsByCluster: map[string]EcsClient{},
 		cacheSize:        cacheSize,
 		cacheExpiry:      cacheExpiry,
 		clusterRegion:    clusterRegion,
+		fargateClusters:  fargateClusters,
+		stacks:           stacks,
 		handlerRegistry:  handlerRegistry,
 		probeID:          probeID,
 	}
@@ -116,7 +138,7 @@ func (r Reporter) getClient(cluster string) (EcsClient, error) {
 	if !ok {
 		log.Debugf("Creating new ECS client")
 		var err error
-		client, err = newClient(cluster, r.cacheSize, r.cacheExpiry, r.clusterRegion)
+		client, err = newClient(cluster, r.cacheSize, r.cacheExpiry, r.clusterRegion, r.stacks)
 		if err != nil {
 			return nil, err
 		}
@@ -147,22 +169,9 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 		ecsInfo := client.GetInfo(taskArns)
 		log.Debugf("Got info from ECS: %d tasks, %d services", len(ecsInfo.Tasks), len(ecsInfo.Services))
 
-		// Create all the services first
-		for serviceName, service := range ecsInfo.Services {
-			serviceID := report.MakeECSServiceNodeID(cluster, serviceName)
-			rpt.ECSService = rpt.ECSService.AddNode(report.MakeNodeWith(serviceID, map[string]string{
-				Cluster:               cluster,
-				ServiceDesiredCount:   fmt.Sprintf("%d", service.DesiredCount),
-				ServiceRunningCount:   fmt.Sprintf("%d", service.RunningCount),
-				report.ControlProbeID: r.probeID,
-			}).WithLatestControls(map[string]report.NodeControlData{
-				ScaleUp: {Dead: false},
-				// We've decided for now to disable ScaleDown when only 1 task is desired,
-				// since scaling down to 0 would cause the service to disappear (#2085)
-				ScaleDown: {Dead: service.DesiredCount <= 1},
-			}))
-		}
-		log.Debugf("Created %v ECS service nodes", len(ecsInfo.Services))
+		// Create all the stacks and services first
+		addStacks(&rpt, ecsInfo)
+		r.addServices(&rpt, cluster, ecsInfo)
 
 		for taskArn, info := range taskMap {
 			task, ok := ecsInfo.Tasks[taskArn]
@@ -171,24 +180,8 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 				continue
 			}
 
-			// new task node
-			taskID := report.MakeECSTaskNodeID(taskArn)
-			node := report.MakeNodeWith(taskID, map[string]string{
-				TaskFamily: info.Family,
-				Cluster:    cluster,
-				CreatedAt:  task.CreatedAt.Format(time.RFC3339Nano),
-			})
-			rpt.ECSTask = rpt.ECSTask.AddNode(node)
-
 			// parents sets to merge into all matching container nodes
-			parentsSets := report.MakeSets()
-			parentsSets = parentsSets.Add(report.ECSTask, report.MakeStringSet(taskID))
-			if serviceName, ok := ecsInfo.TaskServiceMap[taskArn]; ok {
-				serviceID := report.MakeECSServiceNodeID(cluster, serviceName)
-				parentsSets = parentsSets.Add(report.ECSService, report.MakeStringSet(serviceID))
-				// in addition, make service parent of task
-				rpt.ECSTask.Nodes[taskID] = rpt.ECSTask.Nodes[taskID].WithParents(report.MakeSets().Add(report.ECSService, report.MakeStringSet(serviceID)))
-			}
+			parentsSets := addTask(&rpt, cluster, info.Family, LaunchTypeEC2, task, ecsInfo)
 			for _, containerID := range info.ContainerIDs {
 				if containerNode, ok := rpt.Container.Nodes[containerID]; ok {
 					rpt.Container.Nodes[containerID] = containerNode.WithParents(parentsSets)
@@ -203,8 +196,73 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 	return rpt, nil
 }
 
+func (r Reporter) addServices(rpt *report.Report, cluster string, ecsInfo EcsInfo) {
+	for serviceName, service := range ecsInfo.Services {
+		serviceID := report.MakeECSServiceNodeID(cluster, serviceName)
+		node := report.MakeNodeWith(serviceID, map[string]string{
+			Cluster:               cluster,
+			ServiceDesiredCount:   fmt.Sprintf("%d", service.DesiredCount),
+			ServiceRunningCount:   fmt.Sprintf("%d", service.RunningCount),
+			report.ControlProbeID: r.probeID,
+		}).WithLatestControls(map[string]report.NodeControlData{
+			ScaleUp: {Dead: false},
+			// We've decided for now to disable ScaleDown when only 1 task is desired,
+			// since scaling down to 0 would cause the service to disappear (#2085)
+			ScaleDown: {Dead: service.DesiredCount <= 1},
+		})
+		if stack, ok := ecsInfo.ServiceStacks[serviceName]; ok {
+			node = node.WithParents(report.MakeSets().Add(report.ECSStack, report.MakeStringSet(stackNodeID(stack))))
+		}
+		rpt.ECSService = rpt.ECSService.AddNode(node)
+	}
+	log.Debugf("Created %v ECS service nodes", len(ecsInfo.Services))
+}
+
+func stackNodeID(stack Stack) string {
+	return report.MakeECSStackNodeID(stack.Kind, stack.Name)
+}
+
+// addStacks adds the nodes of the stacks of the tasks and services.
+func addStacks(rpt *report.Report, ecsInfo EcsInfo) {
+	for _, stacks := range []map[string]Stack{ecsInfo.ServiceStacks, ecsInfo.TaskStacks} {
+		for _, stack := range stacks {
+			rpt.ECSStack = rpt.ECSStack.AddNode(report.MakeNodeWith(stackNodeID(stack), map[string]string{
+				StackKind: stack.Kind,
+				StackName: stack.Name,
+			}))
+		}
+	}
+}
+
+// addTask adds a task node, and returns the parents of the containers of the
+// task.
+func addTask(rpt *report.Report, cluster, family, launchType string, task EcsTask, ecsInfo EcsInfo) report.Sets {
+	taskID := report.MakeECSTaskNodeID(task.TaskARN)
+	node := report.MakeNodeWith(taskID, map[string]string{
+		TaskFamily:     family,
+		TaskLaunchType: launchType,
+		Cluster:        cluster,
+		CreatedAt:      task.CreatedAt.Format(time.RFC3339Nano),
+	})
+	parentsSets := report.MakeSets()
+	parentsSets = parentsSets.Add(report.ECSTask, report.MakeStringSet(taskID))
+	if serviceName, ok := ecsInfo.TaskServiceMap[task.TaskARN]; ok {
+		serviceID := report.MakeECSServiceNodeID(cluster, serviceName)
+		parentsSets = parentsSets.Add(report.ECSService, report.MakeStringSet(serviceID))
+		// in addition, make service parent of task
+		node = node.WithParents(report.MakeSets().Add(report.ECSService, report.MakeStringSet(serviceID)))
+	}
+	if stack, ok := ecsInfo.TaskStacks[task.TaskARN]; ok {
+		stackID := stackNodeID(stack)
+		parentsSets = parentsSets.Add(report.ECSStack, report.MakeStringSet(stackID))
+		node = node.WithParents(report.MakeSets().Add(report.ECSStack, report.MakeStringSet(stackID)))
+	}
+	rpt.ECSTask = rpt.ECSTask.AddNode(node)
+	return parentsSets
+}
+
 // Report needed for Reporter
-func (Reporter) Report() (report.Report, error) {
+func (r Reporter) Report() (report.Report, error) {
 	result := report.MakeReport()
 	taskTopology := report.MakeTopology().WithMetadataTemplates(taskMetadata)
 	result.ECSTask = result.ECSTask.Merge(taskTopology)
@@ -224,6 +282,28 @@ func (Reporter) Report() (report.Report, error) {
 		},
 	})
 	result.ECSService = result.ECSService.Merge(serviceTopology)
+	result.ECSStack = result.ECSStack.Merge(report.MakeTopology().WithMetadataTemplates(stackMetadata))
+
+	for _, cluster := range r.fargateClusters {
+		client, err := r.getClient(cluster)
+		if err != nil {
+			log.Warnf("Error creating ECS client for cluster %s: %v", cluster, err)
+			continue
+		}
+		taskArns := client.ListFargateTasks()
+		if len(taskArns) == 0 {
+			continue
+		}
+		ecsInfo := client.GetInfo(taskArns)
+		log.Debugf("Got info from ECS on Fargate: %d tasks, %d services", len(ecsInfo.Tasks), len(ecsInfo.Services))
+		addStacks(&result, ecsInfo)
+		r.addServices(&result, cluster, ecsInfo)
+		for _, taskArn := range taskArns {
+			if task, ok := ecsInfo.Tasks[taskArn]; ok {
+				addTask(&result, cluster, task.Family(), LaunchTypeFargate, task, ecsInfo)
+			}
+		}
+	}
 	return result, nil
 }
 
@@ -38,7 +38,7 @@ func getTestContainerNode() report.Node {
 
 func TestGetLabelInfo(t *testing.T) {
 	hr := controls.NewDefaultHandlerRegistry()
-	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id")
+	r := awsecs.Make(1e6, time.Hour, "", nil, awsecs.StackConfig{}, hr, "test-probe-id")
 	rpt, err := r.Report()
 	if err != nil {
 		t.Fatalf("Error making report: %v", err)
@@ -73,9 +73,9 @@ type mockEcsClient struct {
 
 func newMockEcsClient(t *testing.T, expectedARNs []string, info awsecs.EcsInfo) awsecs.EcsClient {
 	return &mockEcsClient{
-		t,
-		expectedARNs,
-		info,
+		t:            t,
+		expectedARNs: expectedARNs,
+		info:         info,
 	}
 }
 
@@ -90,37 +90,46 @@ func (c mockEcsClient) ScaleService(serviceName string, amount int) error {
 	return nil
 }
 
+// The mock lists the expected tasks as Fargate ones.
+func (c mockEcsClient) ListFargateTasks() []string {
+	return c.expectedARNs
+}
+
+func getTestInfo(taskDefinitionARN string) awsecs.EcsInfo {
+	return awsecs.EcsInfo{
+		Tasks: map[string]awsecs.EcsTask{
+			testTaskARN: {
+				TaskARN:           testTaskARN,
+				CreatedAt:         testTaskCreatedAt,
+				TaskDefinitionARN: taskDefinitionARN,
+				StartedAt:         testTaskStartedAt,
+				StartedBy:         testDeploymentID,
+			},
+		},
+		Services: map[string]awsecs.EcsService{
+			testServiceName: {
+				ServiceName:       testServiceName,
+				DeploymentIDs:     []string{testDeploymentID},
+				DesiredCount:      1,
+				PendingCount:      0,
+				RunningCount:      1,
+				TaskDefinitionARN: taskDefinitionARN,
+			},
+		},
+		TaskServiceMap: map[string]string{
+			testTaskARN: testServiceName,
+		},
+	}
+}
+
 func TestTagReport(t *testing.T) {
 	hr := controls.NewDefaultHandlerRegistry()
-	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id")
+	r := awsecs.Make(1e6, time.Hour, "", nil, awsecs.StackConfig{}, hr, "test-probe-id")
 
 	r.ClientsByCluster[testCluster] = newMockEcsClient(
 		t,
 		[]string{testTaskARN},
-		awsecs.EcsInfo{
-			Tasks: map[string]awsecs.EcsTask{
-				testTaskARN: {
-					TaskARN:           testTaskARN,
-					CreatedAt:         testTaskCreatedAt,
-					TaskDefinitionARN: testTaskDefinitionARN,
-					StartedAt:         testTaskStartedAt,
-					StartedBy:         testDeploymentID,
-				},
-			},
-			Services: map[string]awsecs.EcsService{
-				testServiceName: {
-					ServiceName:       testServiceName,
-					DeploymentIDs:     []string{testDeploymentID},
-					DesiredCount:      1,
-					PendingCount:      0,
-					RunningCount:      1,
-					TaskDefinitionARN: testTaskDefinitionARN,
-				},
-			},
-			TaskServiceMap: map[string]string{
-				testTaskARN: testServiceName,
-			},
-		},
+		getTestInfo(testTaskDefinitionARN),
 	)
 
 	rpt, err := r.Report()
@@ -139,9 +148,10 @@ func TestTagReport(t *testing.T) {
 		t.Fatalf("Result report did not contain task %v: %v", testTaskARN, rpt.ECSTask.Nodes)
 	}
 	taskExpected := map[string]string{
-		awsecs.TaskFamily: testFamily,
-		awsecs.Cluster:    testCluster,
-		awsecs.CreatedAt:  testTaskCreatedAt.Format(time.RFC3339Nano),
+		awsecs.TaskFamily:     testFamily,
+		awsecs.TaskLaunchType: awsecs.LaunchTypeEC2,
+		awsecs.Cluster:        testCluster,
+		awsecs.CreatedAt:      testTaskCreatedAt.Format(time.RFC3339Nano),
 	}
 	for key, expectedValue := range taskExpected {
 		value, ok := task.Latest.Lookup(key)
@@ -194,3 +204,81 @@ func TestTagReport(t *testing.T) {
 		}
 	}
 }
+
+func TestFargateReport(t *testing.T) {
+	hr := controls.NewDefaultHandlerRegistry()
+	r := awsecs.Make(1e6, time.Hour, "", []string{testCluster}, awsecs.StackConfig{}, hr, "test-probe-id")
+	taskDefinitionARN := "arn:aws:ecs:us-east-1:123456789012:task-definition/" + testFamily + ":3"
+	r.ClientsByCluster[testCluster] = newMockEcsClient(t, []string{testTaskARN}, getTestInfo(taskDefinitionARN))
+
+	// Fargate tasks are reported without any containers on the host
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatalf("Error making report: %v", err)
+	}
+	task, ok := rpt.ECSTask.Nodes[report.MakeECSTaskNodeID(testTaskARN)]
+	if !ok {
+		t.Fatalf("Report did not contain task %v: %v", testTaskARN, rpt.ECSTask.Nodes)
+	}
+	for key, expectedValue := range map[string]string{
+		awsecs.TaskFamily:     testFamily,
+		awsecs.TaskLaunchType: awsecs.LaunchTypeFargate,
+		awsecs.Cluster:        testCluster,
+	} {
+		if value, _ := task.Latest.Lookup(key); value != expectedValue {
+			t.Errorf("Task did not contain expected value for key %v: %v != %v", key, value, expectedValue)
+		}
+	}
+	serviceID := report.MakeECSServiceNodeID(testCluster, testServiceName)
+	if parents, _ := task.Parents.Lookup(report.ECSService); !parents.Contains(serviceID) {
+		t.Errorf("Expected task to have service %v as parent: %v", serviceID, task.Parents)
+	}
+	if _, ok := rpt.ECSService.Nodes[serviceID]; !ok {
+		t.Errorf("Report did not contain service %v: %v", testServiceName, rpt.ECSService.Nodes)
+	}
+}
+
+func TestStacksReport(t *testing.T) {
+	hr := controls.NewDefaultHandlerRegistry()
+	r := awsecs.Make(1e6, time.Hour, "", nil, awsecs.StackConfig{Enabled: true}, hr, "test-probe-id")
+	info := getTestInfo(testTaskDefinitionARN)
+	stack := awsecs.Stack{Kind: awsecs.StackKindCloudFormation, Name: "test-stack"}
+	info.ServiceStacks = map[string]awsecs.Stack{testServiceName: stack}
+	info.TaskStacks = map[string]awsecs.Stack{testTaskARN: stack}
+	r.ClientsByCluster[testCluster] = newMockEcsClient(t, []string{testTaskARN}, info)
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatalf("Error making report: %v", err)
+	}
+	rpt.Container = rpt.Container.AddNode(getTestContainerNode())
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatalf("Failed to tag: %v", err)
+	}
+
+	stackID := report.MakeECSStackNodeID(awsecs.StackKindCloudFormation, "test-stack")
+	node, ok := rpt.ECSStack.Nodes[stackID]
+	if !ok {
+		t.Fatalf("Result report did not contain stack %v: %v", stackID, rpt.ECSStack.Nodes)
+	}
+	for key, expectedValue := range map[string]string{
+		awsecs.StackKind: awsecs.StackKindCloudFormation,
+		awsecs.StackName: "test-stack",
+	} {
+		if value, _ := node.Latest.Lookup(key); value != expectedValue {
+			t.Errorf("Stack did not contain expected value for key %v: %v != %v", key, value, expectedValue)
+		}
+	}
+
+	// The stack is the parent of the task, service and containers
+	for _, n := range []report.Node{
+		rpt.ECSTask.Nodes[report.MakeECSTaskNodeID(testTaskARN)],
+		rpt.ECSService.Nodes[report.MakeECSServiceNodeID(testCluster, testServiceName)],
+		rpt.Container.Nodes[report.MakeContainerNodeID(testContainer)],
+	} {
+		if parents, _ := n.Parents.Lookup(report.ECSStack); !parents.Contains(stackID) {
+			t.Errorf("Expected %v to have stack %v as parent: %v", n.ID, stackID, n.Parents)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package awsecs
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Kinds of stacks
+const (
+	StackKindCloudFormation = "CloudFormation"
+	StackKindTerraform      = "Terraform"
+)
+
+// cloudFormationStackTag is the tag CloudFormation puts on the resources of
+// its stacks, naming the stack.
+const cloudFormationStackTag = "aws:cloudformation:stack-name"
+
+// StackConfig says whether to look up the stacks which created ECS services
+// and tasks, and which tag names the Terraform workspace of those created by
+// Terraform, which doesn't tag them itself.
+type StackConfig struct {
+	Enabled               bool
+	TerraformWorkspaceTag string
+}
+
+// Stack is the CloudFormation stack or Terraform workspace which created an
+// ECS resource. Exported for test.
+type Stack struct {
+	Kind string
+	Name string
+}
+
+// stackOf gives the stack named by tags, preferring CloudFormation's own tag
+// to the Terraform workspace one.
+func (s StackConfig) stackOf(tags map[string]string) (Stack, bool) {
+	if name, ok := tags[cloudFormationStackTag]; ok && name != "" {
+		return Stack{Kind: StackKindCloudFormation, Name: name}, true
+	}
+	if s.TerraformWorkspaceTag == "" {
+		return Stack{}, false
+	}
+	if name, ok := tags[s.TerraformWorkspaceTag]; ok && name != "" {
+		return Stack{Kind: StackKindTerraform, Name: name}, true
+	}
+	return Stack{}, false
+}
+
+// The version of the ECS API we vendor predates tagging, so we make our own
+// ListTagsForResource requests.
+const opListTagsForResource = "ListTagsForResource"
+
+type listTagsForResourceInput struct {
+	_ struct{} `type:"structure"`
+
+	ResourceArn *string `locationName:"resourceArn" type:"string" required:"true"`
+}
+
+type listTagsForResourceOutput struct {
+	_ struct{} `type:"structure"`
+
+	Tags []*resourceTag `locationName:"tags" type:"list"`
+}
+
+type resourceTag struct {
+	_ struct{} `type:"structure"`
+
+	Key   *string `locationName:"key" type:"string"`
+	Value *string `locationName:"value" type:"string"`
+}
+
+func (c ecsClientImpl) listTags(arn string) (map[string]string, error) {
+	output := &listTagsForResourceOutput{}
+	req := c.client.NewRequest(&request.Operation{
+		Name:       opListTagsForResource,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &listTagsForResourceInput{ResourceArn: aws.String(arn)}, output)
+	if err := req.Send(); err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	for _, tag := range output.Tags {
+		if tag != nil && tag.Key != nil {
+			tags[*tag.Key] = aws.StringValue(tag.Value)
+		}
+	}
+	return tags, nil
+}
+
+// Fetches the stack of a service or task by its ARN, from the cache if
+// possible, returning (stack, ok) as per map[]. Resources without a stack are
+// cached as such, but failures to list tags are not, so they are retried.
+func (c ecsClientImpl) getStack(arn string) (Stack, bool) {
+	if stackRaw, err := c.stackCache.Get(arn); err == nil {
+		stack := stackRaw.(Stack)
+		return stack, stack != Stack{}
+	}
+	tags, err := c.listTags(arn)
+	if err != nil {
+		log.Warnf("Error listing tags of %s, ECS stack report may be incomplete: %v", arn, err)
+		return Stack{}, false
+	}
+	stack, ok := c.stacks.stackOf(tags)
+	c.stackCache.Set(arn, stack)
+	return stack, ok
+}
+
+// getStacks gives the stacks of services, by name, and of tasks, by ARN.
+// Tasks started by a service are the service's, so they are in its stack.
+func (c ecsClientImpl) getStacks(tasks map[string]EcsTask, services map[string]EcsService, taskServiceMap map[string]string) (map[string]Stack, map[string]Stack) {
+	serviceStacks := map[string]Stack{}
+	for serviceName, service := range services {
+		if service.ServiceARN == "" {
+			continue
+		}
+		if stack, ok := c.getStack(service.ServiceARN); ok {
+			serviceStacks[serviceName] = stack
+		}
+	}
+	taskStacks := map[string]Stack{}
+	for taskARN := range tasks {
+		if serviceName, ok := taskServiceMap[taskARN]; ok {
+			if stack, ok := serviceStacks[serviceName]; ok {
+				taskStacks[taskARN] = stack
+			}
+			continue
+		}
+		if stack, ok := c.getStack(taskARN); ok {
+			taskStacks[taskARN] = stack
+		}
+	}
+	return taskStacks, serviceStacks
+}
@@ -0,0 +1,128 @@
+// Package capture runs bounded packet captures with tcpdump, streaming the
+// pcap they write down a pipe.
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+// Bounds of captures, exposed for testing.
+var (
+	DefaultDuration = 30 * time.Second
+	MaxDuration     = 5 * time.Minute
+	DefaultMaxBytes = int64(10 * 1024 * 1024)
+	MaxBytes        = int64(100 * 1024 * 1024)
+
+	// Command gives the command capturing packets in the network namespace
+	// of pid, or of the probe if pid is 0, and writing them to its stdout
+	// as a pcap.
+	Command = func(pid int, opts Options) *exec.Cmd {
+		args := []string{"tcpdump", "-i", opts.Interface, "-U", "-w", "-", "--"}
+		if opts.Filter != "" {
+			args = append(args, opts.Filter)
+		}
+		if pid != 0 {
+			args = append([]string{"nsenter", "-t", strconv.Itoa(pid), "-n"}, args...)
+		}
+		return exec.Command(args[0], args[1:]...)
+	}
+)
+
+// Options of a capture.
+type Options struct {
+	Duration  time.Duration
+	MaxBytes  int64
+	Filter    string // BPF filter, empty for all packets
+	Interface string
+}
+
+// ParseOptions parses the arguments of a capture control: duration,
+// max_bytes, filter and interface, which is any by default. Captures are
+// bounded, so the duration and size can't go over MaxDuration and MaxBytes.
+func ParseOptions(args map[string]string) (Options, error) {
+	opts := Options{
+		Duration:  DefaultDuration,
+		MaxBytes:  DefaultMaxBytes,
+		Filter:    args["filter"],
+		Interface: args["interface"],
+	}
+	if opts.Interface == "" {
+		opts.Interface = "any"
+	}
+	if strings.HasPrefix(opts.Interface, "-") {
+		return Options{}, fmt.Errorf("Invalid interface: %q", opts.Interface)
+	}
+	if arg, ok := args["duration"]; ok {
+		duration, err := time.ParseDuration(arg)
+		if err != nil || duration <= 0 || duration > MaxDuration {
+			return Options{}, fmt.Errorf("Invalid duration: %q (at most %v)", arg, MaxDuration)
+		}
+		opts.Duration = duration
+	}
+	if arg, ok := args["max_bytes"]; ok {
+		maxBytes, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || maxBytes <= 0 || maxBytes > MaxBytes {
+			return Options{}, fmt.Errorf("Invalid max_bytes: %q (at most %d)", arg, MaxBytes)
+		}
+		opts.MaxBytes = maxBytes
+	}
+	return opts, nil
+}
+
+// Start starts capturing packets in the network namespace of pid, or of the
+// probe if pid is 0, sending them down a new pipe. The capture stops after
+// its duration or size, or when the pipe is closed. The last packet is cut
+// short when the size runs out.
+func Start(pipes controls.PipeClient, appID string, pid int, opts Options) xfer.Response {
+	cmd := Command(pid, opts)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return xfer.ResponseError(err)
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { cmd.Process.Kill() })
+	}
+
+	id, pipe, err := controls.NewPipe(pipes, appID)
+	if err != nil {
+		stop()
+		cmd.Wait()
+		return xfer.ResponseError(err)
+	}
+	pipe.OnClose(stop)
+	log.Infof("Capturing packets of pid %d matching %q for %v", pid, opts.Filter, opts.Duration)
+	go func() {
+		defer pipe.Close()
+		timer := time.AfterFunc(opts.Duration, stop)
+		defer timer.Stop()
+		local, _ := pipe.Ends()
+		n, copyErr := io.Copy(local, io.LimitReader(stdout, opts.MaxBytes))
+		stop()
+		// tcpdump is killed to stop it, so only its output tells what went
+		// wrong, if nothing was captured.
+		if err := cmd.Wait(); err != nil && n == 0 && copyErr == nil {
+			log.Errorf("Error capturing packets of pid %d: %v: %s", pid, err, strings.TrimSpace(stderr.String()))
+		}
+	}()
+	return xfer.Response{
+		Pipe: id,
+	}
+}
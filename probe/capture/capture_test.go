@@ -0,0 +1,76 @@
+package capture_test
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/capture"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+func TestParseOptions(t *testing.T) {
+	for _, tc := range []struct {
+		args map[string]string
+		opts capture.Options
+		err  string
+	}{
+		{
+			args: nil,
+			opts: capture.Options{Duration: capture.DefaultDuration, MaxBytes: capture.DefaultMaxBytes, Interface: "any"},
+		},
+		{
+			args: map[string]string{"duration": "5s", "max_bytes": "1024", "filter": "tcp port 80", "interface": "eth0"},
+			opts: capture.Options{Duration: 5 * time.Second, MaxBytes: 1024, Filter: "tcp port 80", Interface: "eth0"},
+		},
+		{args: map[string]string{"duration": "1h"}, err: `Invalid duration: "1h" (at most 5m0s)`},
+		{args: map[string]string{"max_bytes": "-1"}, err: `Invalid max_bytes: "-1" (at most 104857600)`},
+		{args: map[string]string{"interface": "-w/tmp/x"}, err: `Invalid interface: "-w/tmp/x"`},
+	} {
+		opts, err := capture.ParseOptions(tc.args)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %v", tc.args, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(opts, tc.opts) {
+			t.Errorf("%v: got %+v, %v", tc.args, opts, err)
+		}
+	}
+}
+
+type mockPipeClient struct{}
+
+func (mockPipeClient) PipeConnection(_, _ string, _ xfer.Pipe) error { return nil }
+func (mockPipeClient) PipeClose(_, _ string) error                   { return nil }
+
+func TestStart(t *testing.T) {
+	oldCommand, oldNewPipe := capture.Command, controls.NewPipe
+	defer func() { capture.Command, controls.NewPipe = oldCommand, oldNewPipe }()
+	var pid int
+	capture.Command = func(p int, opts capture.Options) *exec.Cmd {
+		pid = p
+		return exec.Command("echo", "-n", "pcap data which goes on")
+	}
+	pipe := xfer.NewPipe()
+	controls.NewPipe = func(_ controls.PipeClient, _ string) (string, xfer.Pipe, error) {
+		return "pipeid", pipe, nil
+	}
+
+	resp := capture.Start(mockPipeClient{}, "appid", 1234, capture.Options{Duration: time.Minute, MaxBytes: 9})
+	if want := (xfer.Response{Pipe: "pipeid"}); resp != want {
+		t.Fatalf("%+v != %+v", resp, want)
+	}
+	_, remote := pipe.Ends()
+	data, _ := ioutil.ReadAll(remote)
+	if string(data) != "pcap data" {
+		t.Errorf("expected the capture to be cut at 9 bytes, got %q", data)
+	}
+	if pid != 1234 {
+		t.Errorf("expected capture in pid 1234, got %d", pid)
+	}
+}
@@ -0,0 +1,249 @@
+// Package cgroup reads the resource usage of the control groups of
+// processes, under both the unified (v2) cgroup hierarchy and the legacy (v1)
+// hierarchies of controllers.
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Exposed for testing.
+var (
+	Root     = "/sys/fs/cgroup"
+	ProcRoot = "/proc"
+)
+
+// Limits of v1 cgroups never set are the largest page aligned int64, so
+// limits from unlimited on count as none.
+const unlimited = 1 << 62
+
+// clockTicks is USER_HZ, the unit of the CPU times of /proc/stat, which is
+// 100 on every architecture Linux runs on.
+const clockTicks = 100
+
+// Stats are the resource usage of a cgroup.
+type Stats struct {
+	CPUUsage    uint64 // nanoseconds
+	MemoryUsage uint64 // bytes, less inactive page cache
+	MemoryLimit uint64 // bytes, 0 if unlimited
+	IORead      uint64 // bytes
+	IOWrite     uint64 // bytes
+}
+
+// IsUnified tells whether the host mounts the unified cgroup hierarchy only.
+// Hybrid hosts mount it next to the v1 controllers, which are still where
+// resource usage is accounted.
+func IsUnified() bool {
+	_, err := os.Stat(filepath.Join(Root, "cgroup.controllers"))
+	return err == nil
+}
+
+// Path gives the path of the cgroup of a process under the hierarchy of a
+// controller, from lines of /proc/<pid>/cgroup like "4:memory:/docker/<id>".
+// Under the unified hierarchy, every controller has the one cgroup of the
+// process, from the line "0::/system.slice/docker-<id>.scope".
+func Path(pid int, controller string) (string, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(ProcRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	unified := IsUnified()
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if unified {
+			if fields[0] == "0" && fields[1] == "" {
+				return fields[2], nil
+			}
+			continue
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == controller {
+				return fields[2], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s cgroup for pid %d", controller, pid)
+}
+
+// ReadStats reads the resource usage of the cgroups of a process.
+func ReadStats(pid int) (Stats, error) {
+	if IsUnified() {
+		return readUnifiedStats(pid)
+	}
+	return readLegacyStats(pid)
+}
+
+func readUnifiedStats(pid int) (Stats, error) {
+	path, err := Path(pid, "")
+	if err != nil {
+		return Stats{}, err
+	}
+	dir := filepath.Join(Root, path)
+	var stats Stats
+	cpu, err := readKeyedFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.CPUUsage = cpu["usage_usec"] * 1000
+	if stats.MemoryUsage, err = readUint(filepath.Join(dir, "memory.current")); err != nil {
+		return Stats{}, err
+	}
+	if memory, err := readKeyedFile(filepath.Join(dir, "memory.stat")); err == nil {
+		stats.MemoryUsage = subtract(stats.MemoryUsage, memory["inactive_file"])
+	}
+	// Limits are "max" when there are none
+	stats.MemoryLimit, _ = readUint(filepath.Join(dir, "memory.max"))
+	// Lines are by device, like "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2"
+	if lines, err := readLines(filepath.Join(dir, "io.stat")); err == nil {
+		for _, line := range lines {
+			for _, field := range strings.Fields(line)[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				value, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch kv[0] {
+				case "rbytes":
+					stats.IORead += value
+				case "wbytes":
+					stats.IOWrite += value
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+func readLegacyStats(pid int) (Stats, error) {
+	var stats Stats
+	cpuacct, err := Path(pid, "cpuacct")
+	if err != nil {
+		return Stats{}, err
+	}
+	if stats.CPUUsage, err = readUint(filepath.Join(Root, "cpuacct", cpuacct, "cpuacct.usage")); err != nil {
+		return Stats{}, err
+	}
+	memory, err := Path(pid, "memory")
+	if err != nil {
+		return Stats{}, err
+	}
+	dir := filepath.Join(Root, "memory", memory)
+	if stats.MemoryUsage, err = readUint(filepath.Join(dir, "memory.usage_in_bytes")); err != nil {
+		return Stats{}, err
+	}
+	if memory, err := readKeyedFile(filepath.Join(dir, "memory.stat")); err == nil {
+		stats.MemoryUsage = subtract(stats.MemoryUsage, memory["total_inactive_file"])
+	}
+	if limit, err := readUint(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && limit < unlimited {
+		stats.MemoryLimit = limit
+	}
+	// Lines are by device and operation, like "8:0 Read 1024", with a last
+	// line of the "Total"
+	if blkio, err := Path(pid, "blkio"); err == nil {
+		lines, _ := readLines(filepath.Join(Root, "blkio", blkio, "blkio.throttle.io_service_bytes_recursive"))
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			value, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch fields[1] {
+			case "Read":
+				stats.IORead += value
+			case "Write":
+				stats.IOWrite += value
+			}
+		}
+	}
+	return stats, nil
+}
+
+// SystemCPUUsage gives the time all the CPUs of the host have spent, in
+// nanoseconds, from the first line of /proc/stat, like docker does.
+func SystemCPUUsage() (uint64, error) {
+	lines, err := readLines(filepath.Join(ProcRoot, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[0] != "cpu" {
+			continue
+		}
+		var ticks uint64
+		for _, field := range fields[1:8] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			ticks += value
+		}
+		return ticks * 1e9 / clockTicks, nil
+	}
+	return 0, fmt.Errorf("no cpu line in %s/stat", ProcRoot)
+}
+
+func subtract(a, b uint64) uint64 {
+	if b > a {
+		return a
+	}
+	return a - b
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func readUint(path string) (uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+}
+
+// readKeyedFile reads files of lines like "usage_usec 1234".
+func readKeyedFile(path string) (map[string]uint64, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]uint64{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			result[fields[0]] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package cgroup_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/cgroup"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func withRoot(t *testing.T, files map[string]string) func() {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, files)
+	oldRoot, oldProcRoot := cgroup.Root, cgroup.ProcRoot
+	cgroup.Root, cgroup.ProcRoot = filepath.Join(root, "sys/fs/cgroup"), filepath.Join(root, "proc")
+	return func() {
+		cgroup.Root, cgroup.ProcRoot = oldRoot, oldProcRoot
+		os.RemoveAll(root)
+	}
+}
+
+func TestReadStatsUnified(t *testing.T) {
+	defer withRoot(t, map[string]string{
+		"proc/42/cgroup":                   "0::/system.slice/docker-one.scope\n",
+		"proc/stat":                        "cpu  100 0 50 800 25 0 25 0 0 0\ncpu0 100 0 50 800 25 0 25 0 0 0\n",
+		"sys/fs/cgroup/cgroup.controllers": "cpu io memory pids\n",
+		"sys/fs/cgroup/system.slice/docker-one.scope/cpu.stat":       "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+		"sys/fs/cgroup/system.slice/docker-one.scope/memory.current": "4096\n",
+		"sys/fs/cgroup/system.slice/docker-one.scope/memory.stat":    "anon 2048\nfile 2048\ninactive_file 1024\n",
+		"sys/fs/cgroup/system.slice/docker-one.scope/memory.max":     "max\n",
+		"sys/fs/cgroup/system.slice/docker-one.scope/io.stat":        "8:0 rbytes=100 wbytes=200 rios=1 wios=2\n8:16 rbytes=1 wbytes=2 rios=1 wios=1\n",
+	})()
+
+	if !cgroup.IsUnified() {
+		t.Fatal("Expected the unified hierarchy")
+	}
+	stats, err := cgroup.ReadStats(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (cgroup.Stats{CPUUsage: 1500000, MemoryUsage: 3072, IORead: 101, IOWrite: 202}); stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	system, err := cgroup.SystemCPUUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system != 10000000000 {
+		t.Errorf("Expected 10s of system CPU usage, got %d", system)
+	}
+	if _, err := cgroup.ReadStats(43); err == nil {
+		t.Error("Expected an error reading the stats of an unknown process")
+	}
+}
+
+func TestReadStatsLegacy(t *testing.T) {
+	defer withRoot(t, map[string]string{
+		"proc/42/cgroup": "12:devices:/docker/one\n4:memory:/docker/one\n3:cpu,cpuacct:/docker/one\n2:blkio:/docker/one\n1:name=systemd:/docker/one\n0::/\n",
+		"sys/fs/cgroup/cpuacct/docker/one/cpuacct.usage":                           "1500000\n",
+		"sys/fs/cgroup/memory/docker/one/memory.usage_in_bytes":                    "4096\n",
+		"sys/fs/cgroup/memory/docker/one/memory.stat":                              "cache 2048\ntotal_inactive_file 1024\n",
+		"sys/fs/cgroup/memory/docker/one/memory.limit_in_bytes":                    "8192\n",
+		"sys/fs/cgroup/blkio/docker/one/blkio.throttle.io_service_bytes_recursive": "8:0 Read 100\n8:0 Write 200\n8:0 Sync 300\n8:0 Total 300\nTotal 300\n",
+	})()
+
+	if cgroup.IsUnified() {
+		t.Fatal("Expected the legacy hierarchies")
+	}
+	path, err := cgroup.Path(42, "devices")
+	if err != nil || path != "/docker/one" {
+		t.Errorf("Expected the devices cgroup /docker/one, got %q (%v)", path, err)
+	}
+	stats, err := cgroup.ReadStats(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (cgroup.Stats{CPUUsage: 1500000, MemoryUsage: 3072, MemoryLimit: 8192, IORead: 100, IOWrite: 200}); stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+}
@@ -0,0 +1,71 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const azureMetadataURL = "http://169.254.169.254/metadata/instance?api-version=2021-02-01"
+
+// The instance metadata service only answers requests with this header.
+var azureHeaders = map[string]string{"Metadata": "true"}
+
+type azureClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// azureInstance is the part of the instance metadata we care about.
+type azureInstance struct {
+	Compute struct {
+		VMID           string `json:"vmId"`
+		VMSize         string `json:"vmSize"`
+		Location       string `json:"location"`
+		Zone           string `json:"zone"`
+		SubscriptionID string `json:"subscriptionId"`
+		TagsList       []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"tagsList"`
+	} `json:"compute"`
+}
+
+func (c *azureClient) get() (azureInstance, error) {
+	var instance azureInstance
+	_, body, err := get(c.client, c.baseURL, azureHeaders)
+	if err != nil {
+		return instance, err
+	}
+	err = json.Unmarshal(body, &instance)
+	return instance, err
+}
+
+func (c *azureClient) detect() bool {
+	instance, err := c.get()
+	return err == nil && instance.Compute.VMID != ""
+}
+
+// Implements Client.Instance. Azure zones are numbered within their region,
+// so zones are reported as the region and number, like eastus-1, or only
+// the region for instances in none.
+func (c *azureClient) Instance() (Instance, error) {
+	vm, err := c.get()
+	if err != nil {
+		return Instance{}, err
+	}
+	instance := Instance{
+		Provider:    ProviderAzure,
+		ID:          vm.Compute.VMID,
+		MachineType: vm.Compute.VMSize,
+		Zone:        vm.Compute.Location,
+		Project:     vm.Compute.SubscriptionID,
+		Tags:        map[string]string{},
+	}
+	if vm.Compute.Zone != "" {
+		instance.Zone += "-" + vm.Compute.Zone
+	}
+	for _, tag := range vm.Compute.TagsList {
+		instance.Tags[tag.Name] = tag.Value
+	}
+	return instance, nil
+}
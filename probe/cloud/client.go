@@ -0,0 +1,80 @@
+package cloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Providers of Instance
+const (
+	ProviderAzure = "Azure"
+	ProviderGCP   = "GCP"
+)
+
+// Instance describes the parts of the cloud instance the probe runs on we
+// care about. Exported for test.
+type Instance struct {
+	Provider    string
+	ID          string
+	MachineType string
+	Zone        string
+	Project     string
+	Network     string
+	NetworkTags []string
+	Tags        map[string]string
+}
+
+// Client fetches the instance the probe runs on from the metadata service of
+// its cloud provider.
+// We create an interface so we can mock for testing.
+type Client interface {
+	Instance() (Instance, error)
+}
+
+// detectTimeout is how long metadata services get to answer when detecting
+// them; off the cloud, nothing answers at all.
+const detectTimeout = 2 * time.Second
+
+// Detect finds the cloud provider the probe runs on, by which metadata
+// service answers, failing if none does.
+func Detect() (Client, error) {
+	httpClient := &http.Client{Timeout: detectTimeout}
+	for _, client := range []interface {
+		Client
+		detect() bool
+	}{
+		&gcpClient{baseURL: gcpMetadataURL, client: httpClient},
+		&azureClient{baseURL: azureMetadataURL, client: httpClient},
+	} {
+		if client.detect() {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("no cloud metadata service available")
+}
+
+// get the body of a metadata service's answer, with the headers it requires.
+func get(client *http.Client, url string, headers map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, fmt.Errorf("Error getting %s: %s", url, resp.Status)
+	}
+	return resp, body, nil
+}
@@ -0,0 +1,95 @@
+package cloud
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGCPClient(t *testing.T) {
+	metadata := map[string]string{
+		"/":                                      "instance/\nproject/\n",
+		"/instance/id":                           "4520031799277581759",
+		"/instance/machine-type":                 "projects/123/machineTypes/n1-standard-1",
+		"/instance/zone":                         "projects/123/zones/us-central1-a",
+		"/project/project-id":                    "my-project",
+		"/instance/network-interfaces/0/network": "projects/123/networks/default",
+		"/instance/tags":                         `["http-server","https-server"]`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := metadata[r.URL.Path]
+		if !ok || r.Header.Get("Metadata-Flavor") != "Google" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		w.Write([]byte(value))
+	}))
+	defer ts.Close()
+
+	c := &gcpClient{baseURL: ts.URL + "/", client: http.DefaultClient}
+	if !c.detect() {
+		t.Fatal("Expected to detect GCP")
+	}
+	if (&azureClient{baseURL: ts.URL + "/", client: http.DefaultClient}).detect() {
+		t.Error("Expected not to detect Azure")
+	}
+	have, err := c.Instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Instance{
+		Provider:    ProviderGCP,
+		ID:          "4520031799277581759",
+		MachineType: "n1-standard-1",
+		Zone:        "us-central1-a",
+		Project:     "my-project",
+		Network:     "default",
+		NetworkTags: []string{"http-server", "https-server"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
+
+func TestAzureClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"compute": {
+			"vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+			"vmSize": "Standard_A3",
+			"location": "eastus",
+			"zone": "1",
+			"subscriptionId": "8d10da13-8125-4ba9-a717-bf7490507b3d",
+			"tagsList": [{"name": "team", "value": "web"}]
+		}}`))
+	}))
+	defer ts.Close()
+
+	c := &azureClient{baseURL: ts.URL, client: http.DefaultClient}
+	if !c.detect() {
+		t.Fatal("Expected to detect Azure")
+	}
+	if (&gcpClient{baseURL: ts.URL + "/", client: http.DefaultClient}).detect() {
+		t.Error("Expected not to detect GCP")
+	}
+	have, err := c.Instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Instance{
+		Provider:    ProviderAzure,
+		ID:          "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+		MachineType: "Standard_A3",
+		Zone:        "eastus-1",
+		Project:     "8d10da13-8125-4ba9-a717-bf7490507b3d",
+		Tags:        map[string]string{"team": "web"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
@@ -0,0 +1,64 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+
+// The metadata server only answers requests with this header, and sets it on
+// its answers.
+var gcpHeaders = map[string]string{"Metadata-Flavor": "Google"}
+
+type gcpClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (c *gcpClient) get(path string) (string, error) {
+	_, body, err := get(c.client, c.baseURL+path, gcpHeaders)
+	return string(body), err
+}
+
+func (c *gcpClient) detect() bool {
+	resp, _, err := get(c.client, c.baseURL, gcpHeaders)
+	return err == nil && resp.Header.Get("Metadata-Flavor") == "Google"
+}
+
+// lastSegment gives the name of a resource from its path, like the zone
+// us-central1-a of projects/123/zones/us-central1-a.
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// Implements Client.Instance
+func (c *gcpClient) Instance() (Instance, error) {
+	instance := Instance{Provider: ProviderGCP}
+	for path, value := range map[string]*string{
+		"instance/id":                           &instance.ID,
+		"instance/machine-type":                 &instance.MachineType,
+		"instance/zone":                         &instance.Zone,
+		"project/project-id":                    &instance.Project,
+		"instance/network-interfaces/0/network": &instance.Network,
+	} {
+		v, err := c.get(path)
+		if err != nil {
+			return Instance{}, err
+		}
+		*value = v
+	}
+	instance.MachineType = lastSegment(instance.MachineType)
+	instance.Zone = lastSegment(instance.Zone)
+	instance.Network = lastSegment(instance.Network)
+
+	tags, err := c.get("instance/tags")
+	if err != nil {
+		return Instance{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &instance.NetworkTags); err != nil {
+		return Instance{}, err
+	}
+	return instance, nil
+}
@@ -0,0 +1,119 @@
+package cloud
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest and Node.Sets of hosts.
+const (
+	Provider    = "cloud_provider"
+	InstanceID  = "cloud_instance_id"
+	MachineType = "cloud_machine_type"
+	Zone        = "cloud_zone"
+	Project     = "cloud_project"
+	Network     = "cloud_network"
+	NetworkTags = "cloud_network_tags"
+	TagPrefix   = "cloud_tag_"
+)
+
+// Exposed for testing.
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		Provider:    {ID: Provider, Label: "Cloud", From: report.FromLatest, Priority: 21},
+		InstanceID:  {ID: InstanceID, Label: "Instance", From: report.FromLatest, Priority: 22},
+		MachineType: {ID: MachineType, Label: "Machine Type", From: report.FromLatest, Priority: 23},
+		Zone:        {ID: Zone, Label: "Zone", From: report.FromLatest, Priority: 24},
+		Project:     {ID: Project, Label: "Project", From: report.FromLatest, Priority: 25},
+		Network:     {ID: Network, Label: "Network", From: report.FromLatest, Priority: 26},
+		NetworkTags: {ID: NetworkTags, Label: "Network Tags", From: report.FromSets, Priority: 27},
+	}
+
+	TableTemplates = report.TableTemplates{
+		TagPrefix: {
+			ID:     TagPrefix,
+			Label:  "Cloud Tags",
+			Type:   report.PropertyListType,
+			Prefix: TagPrefix,
+		},
+	}
+)
+
+// Reporter adds the cloud instance the probe runs on to its host node.
+// Instances hardly change, so they are fetched at most once per refresh.
+type Reporter struct {
+	hostID  string
+	client  Client
+	refresh time.Duration
+
+	mtx      sync.Mutex
+	instance *Instance
+	fetched  time.Time
+}
+
+// NewReporter makes a new Reporter.
+func NewReporter(hostID string, client Client, refresh time.Duration) *Reporter {
+	return &Reporter{
+		hostID:  hostID,
+		client:  client,
+		refresh: refresh,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Cloud" }
+
+// getInstance gives the instance, fetching it if it is older than the
+// refresh, or the last one fetched if fetching fails.
+func (r *Reporter) getInstance() *Instance {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := mtime.Now()
+	if r.instance != nil && now.Sub(r.fetched) < r.refresh {
+		return r.instance
+	}
+	instance, err := r.client.Instance()
+	if err != nil {
+		log.Warnf("Error getting cloud instance: %v", err)
+		return r.instance
+	}
+	r.instance, r.fetched = &instance, now
+	return r.instance
+}
+
+// Report implements Reporter.
+func (r *Reporter) Report() (report.Report, error) {
+	rpt := report.MakeReport()
+	instance := r.getInstance()
+	if instance == nil {
+		return rpt, nil
+	}
+	latest := map[string]string{}
+	for key, value := range map[string]string{
+		Provider:    instance.Provider,
+		InstanceID:  instance.ID,
+		MachineType: instance.MachineType,
+		Zone:        instance.Zone,
+		Project:     instance.Project,
+		Network:     instance.Network,
+	} {
+		if value != "" {
+			latest[key] = value
+		}
+	}
+	node := report.MakeNodeWith(report.MakeHostNodeID(r.hostID), latest).
+		AddPrefixPropertyList(TagPrefix, instance.Tags)
+	if len(instance.NetworkTags) > 0 {
+		node = node.WithSet(NetworkTags, report.MakeStringSet(instance.NetworkTags...))
+	}
+	rpt.Host = rpt.Host.
+		WithMetadataTemplates(MetadataTemplates).
+		WithTableTemplates(TableTemplates)
+	rpt.Host.AddNode(node)
+	return rpt, nil
+}
@@ -0,0 +1,178 @@
+package components
+
+import (
+	"time"
+
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/report"
+)
+
+// Kinds of Scope components, the first part of their node IDs.
+const (
+	KindApp    = "app"
+	KindProbe  = "probe"
+	KindPlugin = "plugin"
+)
+
+// Keys for use in Node.Latest.
+const (
+	Kind        = "scope_component_kind"
+	Name        = "scope_component_name"
+	Version     = "scope_component_version"
+	Hostname    = "scope_component_hostname"
+	URL         = "scope_component_url"
+	Status      = "scope_component_status"
+	LastError   = "scope_component_last_error"
+	LastErrorAt = "scope_component_last_error_at"
+	Published   = "scope_component_last_published"
+	Latency     = "scope_component_publish_latency"
+)
+
+// Values of Status.
+const (
+	StatusConnected    = "connected"
+	StatusDisconnected = "disconnected"
+	StatusRunning      = "running"
+)
+
+// Exposed for testing
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		Kind:        {ID: Kind, Label: "Kind", From: report.FromLatest, Priority: 1},
+		Status:      {ID: Status, Label: "Status", From: report.FromLatest, Priority: 2},
+		Version:     {ID: Version, Label: "Version", From: report.FromLatest, Priority: 3},
+		Hostname:    {ID: Hostname, Label: "Hostname", From: report.FromLatest, Priority: 4},
+		URL:         {ID: URL, Label: "URL", From: report.FromLatest, Priority: 5},
+		Latency:     {ID: Latency, Label: "Publish Latency", From: report.FromLatest, Priority: 6},
+		Published:   {ID: Published, Label: "Last Published", From: report.FromLatest, Datatype: "datetime", Priority: 7},
+		LastError:   {ID: LastError, Label: "Last Error", From: report.FromLatest, Priority: 8},
+		LastErrorAt: {ID: LastErrorAt, Label: "Last Error At", From: report.FromLatest, Datatype: "datetime", Priority: 9},
+	}
+)
+
+// Reporter generates Reports containing the ScopeComponent topology, of the
+// probe itself, the apps it publishes to and the plugins it runs.
+type Reporter struct {
+	probeID  string
+	hostID   string
+	hostName string
+	version  string
+	targets  func() []appclient.TargetStatus
+	plugins  func() []plugins.PluginStatus
+}
+
+// NewReporter makes a new Reporter. Either of targets or plugins may be nil,
+// when the probe has none.
+func NewReporter(probeID, hostID, hostName, version string, targets func() []appclient.TargetStatus, plugins func() []plugins.PluginStatus) *Reporter {
+	return &Reporter{
+		probeID:  probeID,
+		hostID:   hostID,
+		hostName: hostName,
+		version:  version,
+		targets:  targets,
+		plugins:  plugins,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Components" }
+
+// Report reports the components of Scope this probe knows of. Apps are
+// reported by each of the probes publishing to them, so their nodes merge.
+func (r *Reporter) Report() (report.Report, error) {
+	rpt := report.MakeReport()
+	rpt.ScopeComponent = rpt.ScopeComponent.WithMetadataTemplates(MetadataTemplates)
+
+	hostNodeID := report.MakeHostNodeID(r.hostID)
+	parents := report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID))
+	probeNodeID := report.MakeScopeComponentNodeID(KindProbe, r.probeID)
+	probe := report.MakeNodeWith(probeNodeID, map[string]string{
+		Kind:              KindProbe,
+		Name:              r.hostName,
+		Version:           r.version,
+		Hostname:          r.hostName,
+		Status:            StatusRunning,
+		report.HostNodeID: hostNodeID,
+	}).WithParents(parents)
+
+	if r.targets != nil {
+		for _, target := range r.targets() {
+			appNodeID := report.MakeScopeComponentNodeID(KindApp, appID(target))
+			rpt.ScopeComponent.AddNode(appNode(appNodeID, target))
+			if latency, err := time.ParseDuration(target.PublishLatency); err == nil {
+				micros := uint64(latency / time.Microsecond)
+				probe = probe.WithEdge(appNodeID, report.EdgeMetadata{LatencyMicros: &micros})
+			} else {
+				probe = probe.WithAdjacent(appNodeID)
+			}
+		}
+	}
+
+	if r.plugins != nil {
+		for _, plugin := range r.plugins() {
+			pluginNodeID := report.MakeScopeComponentNodeID(KindPlugin, r.probeID+report.ScopeDelim+plugin.ID)
+			latest := map[string]string{
+				Kind:              KindPlugin,
+				Name:              plugin.Label,
+				Hostname:          r.hostName,
+				Status:            plugin.Status,
+				report.HostNodeID: hostNodeID,
+			}
+			if plugin.LastError != "" {
+				latest[LastError] = plugin.LastError
+			}
+			if plugin.LastErrorAt != nil {
+				latest[LastErrorAt] = plugin.LastErrorAt.Format(time.RFC3339Nano)
+			}
+			rpt.ScopeComponent.AddNode(report.MakeNodeWith(pluginNodeID, latest).
+				WithParents(parents).
+				WithAdjacent(probeNodeID))
+		}
+	}
+
+	rpt.ScopeComponent.AddNode(probe)
+	return rpt, nil
+}
+
+// appID identifies an app by its ID, once the probe has learnt it, or else
+// by its URL.
+func appID(target appclient.TargetStatus) string {
+	if target.AppID != "" {
+		return target.AppID
+	}
+	return target.URL
+}
+
+func appNode(id string, target appclient.TargetStatus) report.Node {
+	status := StatusDisconnected
+	if target.Connected {
+		status = StatusConnected
+	}
+	name := target.Hostname
+	if name == "" {
+		name = target.URL
+	}
+	latest := map[string]string{
+		Kind:   KindApp,
+		Name:   name,
+		URL:    target.URL,
+		Status: status,
+	}
+	if target.Hostname != "" {
+		latest[Hostname] = target.Hostname
+	}
+	if target.PublishLatency != "" {
+		latest[Latency] = target.PublishLatency
+	}
+	if target.LastPublished != nil {
+		latest[Published] = target.LastPublished.Format(time.RFC3339Nano)
+	}
+	if target.LastError != "" {
+		latest[LastError] = target.LastError
+	}
+	if target.LastErrorAt != nil {
+		latest[LastErrorAt] = target.LastErrorAt.Format(time.RFC3339Nano)
+	}
+	return report.MakeNodeWith(id, latest)
+}
@@ -0,0 +1,68 @@
+package components_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/components"
+	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestReporter(t *testing.T) {
+	published := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets := func() []appclient.TargetStatus {
+		return []appclient.TargetStatus{
+			{AppID: "app1", Hostname: "scope-app", URL: "http://scope-app:4040", Connected: true, LastPublished: &published, PublishLatency: "12.5ms"},
+			{Hostname: "other", URL: "http://other:4040", LastError: "connection refused"},
+		}
+	}
+	plugs := func() []plugins.PluginStatus {
+		return []plugins.PluginStatus{{ID: "iowait", Label: "IOWait", Status: "ok"}}
+	}
+	rpt, err := components.NewReporter("probe1", "host1", "host-one", "1.0", targets, plugs).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 4, len(rpt.ScopeComponent.Nodes); want != have {
+		t.Fatalf("want %d nodes, have %d", want, have)
+	}
+
+	probeID := report.MakeScopeComponentNodeID(components.KindProbe, "probe1")
+	appID := report.MakeScopeComponentNodeID(components.KindApp, "app1")
+	otherID := report.MakeScopeComponentNodeID(components.KindApp, "http://other:4040")
+	pluginID := report.MakeScopeComponentNodeID(components.KindPlugin, "probe1;iowait")
+
+	probe := rpt.ScopeComponent.Nodes[probeID]
+	if version, _ := probe.Latest.Lookup(components.Version); version != "1.0" {
+		t.Errorf("probe version: %q", version)
+	}
+	if !probe.Adjacency.Contains(appID) || !probe.Adjacency.Contains(otherID) {
+		t.Errorf("probe adjacency: %v", probe.Adjacency)
+	}
+	edge, ok := probe.Edges.Lookup(appID)
+	if !ok || edge.LatencyMicros == nil || *edge.LatencyMicros != 12500 {
+		t.Errorf("probe to app edge: %v", edge)
+	}
+	if _, ok := probe.Edges.Lookup(otherID); ok {
+		t.Errorf("unexpected edge metadata to an app never published to")
+	}
+
+	for id, want := range map[string]string{appID: components.StatusConnected, otherID: components.StatusDisconnected} {
+		if status, _ := rpt.ScopeComponent.Nodes[id].Latest.Lookup(components.Status); status != want {
+			t.Errorf("%s: want status %q, have %q", id, want, status)
+		}
+	}
+	if lastError, _ := rpt.ScopeComponent.Nodes[otherID].Latest.Lookup(components.LastError); lastError != "connection refused" {
+		t.Errorf("last error: %q", lastError)
+	}
+
+	plugin := rpt.ScopeComponent.Nodes[pluginID]
+	if !plugin.Adjacency.Contains(probeID) {
+		t.Errorf("plugin adjacency: %v", plugin.Adjacency)
+	}
+	if name, _ := plugin.Latest.Lookup(components.Name); name != "IOWait" {
+		t.Errorf("plugin name: %q", name)
+	}
+}
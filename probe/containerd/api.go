@@ -0,0 +1,172 @@
+package containerd
+
+// The subset of the containerd 1.x gRPC API used by the reporter. These
+// mirror the messages in github.com/containerd/containerd/api, with the same
+// field numbers, so they can be sent over the wire with the default protobuf
+// codec without vendoring containerd itself.
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+const (
+	namespacesService = "/containerd.services.namespaces.v1.Namespaces/"
+	containersService = "/containerd.services.containers.v1.Containers/"
+	tasksService      = "/containerd.services.tasks.v1.Tasks/"
+
+	// namespaceHeader is the gRPC metadata key containerd reads the
+	// namespace of a request from.
+	namespaceHeader = "containerd-namespace"
+)
+
+// TaskStatus is the status of the task of a container.
+type TaskStatus int32
+
+// TaskStatus values, as in containerd.v1.types.Status.
+const (
+	TaskStatusUnknown TaskStatus = iota
+	TaskStatusCreated
+	TaskStatusRunning
+	TaskStatusStopped
+	TaskStatusPaused
+	TaskStatusPausing
+)
+
+// Namespace is a containerd namespace.
+type Namespace struct {
+	Name   string            `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Labels map[string]string `protobuf:"bytes,2,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Namespace) Reset()         { *m = Namespace{} }
+func (m *Namespace) String() string { return proto.CompactTextString(m) }
+func (*Namespace) ProtoMessage()    {}
+
+type listNamespacesRequest struct {
+	Filter string `protobuf:"bytes,1,opt,name=filter" json:"filter,omitempty"`
+}
+
+func (m *listNamespacesRequest) Reset()         { *m = listNamespacesRequest{} }
+func (m *listNamespacesRequest) String() string { return proto.CompactTextString(m) }
+func (*listNamespacesRequest) ProtoMessage()    {}
+
+type listNamespacesResponse struct {
+	Namespaces []*Namespace `protobuf:"bytes,1,rep,name=namespaces" json:"namespaces,omitempty"`
+}
+
+func (m *listNamespacesResponse) Reset()         { *m = listNamespacesResponse{} }
+func (m *listNamespacesResponse) String() string { return proto.CompactTextString(m) }
+func (*listNamespacesResponse) ProtoMessage()    {}
+
+// Runtime is the runtime a container is run with.
+type Runtime struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *Runtime) Reset()         { *m = Runtime{} }
+func (m *Runtime) String() string { return proto.CompactTextString(m) }
+func (*Runtime) ProtoMessage()    {}
+
+// Container is the metadata containerd keeps about a container. Its process,
+// if any, is a Task.
+type Container struct {
+	ID          string               `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Labels      map[string]string    `protobuf:"bytes,2,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Image       string               `protobuf:"bytes,3,opt,name=image" json:"image,omitempty"`
+	Runtime     *Runtime             `protobuf:"bytes,4,opt,name=runtime" json:"runtime,omitempty"`
+	Snapshotter string               `protobuf:"bytes,6,opt,name=snapshotter" json:"snapshotter,omitempty"`
+	CreatedAt   *timestamp.Timestamp `protobuf:"bytes,8,opt,name=created_at" json:"created_at,omitempty"`
+	UpdatedAt   *timestamp.Timestamp `protobuf:"bytes,9,opt,name=updated_at" json:"updated_at,omitempty"`
+}
+
+func (m *Container) Reset()         { *m = Container{} }
+func (m *Container) String() string { return proto.CompactTextString(m) }
+func (*Container) ProtoMessage()    {}
+
+type listContainersRequest struct {
+	Filters []string `protobuf:"bytes,1,rep,name=filters" json:"filters,omitempty"`
+}
+
+func (m *listContainersRequest) Reset()         { *m = listContainersRequest{} }
+func (m *listContainersRequest) String() string { return proto.CompactTextString(m) }
+func (*listContainersRequest) ProtoMessage()    {}
+
+type listContainersResponse struct {
+	Containers []*Container `protobuf:"bytes,1,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *listContainersResponse) Reset()         { *m = listContainersResponse{} }
+func (m *listContainersResponse) String() string { return proto.CompactTextString(m) }
+func (*listContainersResponse) ProtoMessage()    {}
+
+type deleteContainerRequest struct {
+	ID string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *deleteContainerRequest) Reset()         { *m = deleteContainerRequest{} }
+func (m *deleteContainerRequest) String() string { return proto.CompactTextString(m) }
+func (*deleteContainerRequest) ProtoMessage()    {}
+
+// Task is the (init) process of a container.
+type Task struct {
+	ContainerID string               `protobuf:"bytes,1,opt,name=container_id" json:"container_id,omitempty"`
+	ID          string               `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	PID         uint32               `protobuf:"varint,3,opt,name=pid" json:"pid,omitempty"`
+	Status      TaskStatus           `protobuf:"varint,4,opt,name=status" json:"status,omitempty"`
+	Terminal    bool                 `protobuf:"varint,8,opt,name=terminal" json:"terminal,omitempty"`
+	ExitStatus  uint32               `protobuf:"varint,9,opt,name=exit_status" json:"exit_status,omitempty"`
+	ExitedAt    *timestamp.Timestamp `protobuf:"bytes,10,opt,name=exited_at" json:"exited_at,omitempty"`
+}
+
+func (m *Task) Reset()         { *m = Task{} }
+func (m *Task) String() string { return proto.CompactTextString(m) }
+func (*Task) ProtoMessage()    {}
+
+type listTasksRequest struct {
+	Filter string `protobuf:"bytes,1,opt,name=filter" json:"filter,omitempty"`
+}
+
+func (m *listTasksRequest) Reset()         { *m = listTasksRequest{} }
+func (m *listTasksRequest) String() string { return proto.CompactTextString(m) }
+func (*listTasksRequest) ProtoMessage()    {}
+
+type listTasksResponse struct {
+	Tasks []*Task `protobuf:"bytes,1,rep,name=tasks" json:"tasks,omitempty"`
+}
+
+func (m *listTasksResponse) Reset()         { *m = listTasksResponse{} }
+func (m *listTasksResponse) String() string { return proto.CompactTextString(m) }
+func (*listTasksResponse) ProtoMessage()    {}
+
+type killRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id" json:"container_id,omitempty"`
+	ExecID      string `protobuf:"bytes,2,opt,name=exec_id" json:"exec_id,omitempty"`
+	Signal      uint32 `protobuf:"varint,3,opt,name=signal" json:"signal,omitempty"`
+	All         bool   `protobuf:"varint,4,opt,name=all" json:"all,omitempty"`
+}
+
+func (m *killRequest) Reset()         { *m = killRequest{} }
+func (m *killRequest) String() string { return proto.CompactTextString(m) }
+func (*killRequest) ProtoMessage()    {}
+
+// taskRequest is any of PauseTaskRequest, ResumeTaskRequest and
+// DeleteTaskRequest, which only hold the container ID.
+type taskRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id" json:"container_id,omitempty"`
+}
+
+func (m *taskRequest) Reset()         { *m = taskRequest{} }
+func (m *taskRequest) String() string { return proto.CompactTextString(m) }
+func (*taskRequest) ProtoMessage()    {}
+
+type deleteTaskResponse struct {
+	ID         string               `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	PID        uint32               `protobuf:"varint,2,opt,name=pid" json:"pid,omitempty"`
+	ExitStatus uint32               `protobuf:"varint,3,opt,name=exit_status" json:"exit_status,omitempty"`
+	ExitedAt   *timestamp.Timestamp `protobuf:"bytes,4,opt,name=exited_at" json:"exited_at,omitempty"`
+}
+
+func (m *deleteTaskResponse) Reset()         { *m = deleteTaskResponse{} }
+func (m *deleteTaskResponse) String() string { return proto.CompactTextString(m) }
+func (*deleteTaskResponse) ProtoMessage()    {}
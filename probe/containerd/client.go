@@ -0,0 +1,104 @@
+package containerd
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client is the subset of the containerd API used by the reporter, over
+// all namespaces. Exposed for testing.
+type Client interface {
+	ListNamespaces(ctx context.Context) ([]*Namespace, error)
+	ListContainers(ctx context.Context, namespace string) ([]*Container, error)
+	ListTasks(ctx context.Context, namespace string) ([]*Task, error)
+	KillTask(ctx context.Context, namespace, containerID string, signal syscall.Signal) error
+	PauseTask(ctx context.Context, namespace, containerID string) error
+	ResumeTask(ctx context.Context, namespace, containerID string) error
+	DeleteTask(ctx context.Context, namespace, containerID string) error
+	DeleteContainer(ctx context.Context, namespace, containerID string) error
+	Close() error
+}
+
+const dialTimeout = 5 * time.Second
+
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient connects to containerd on socket.
+func NewClient(socket string) (Client, error) {
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(dialTimeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcClient{conn: conn}, nil
+}
+
+func (c *grpcClient) invoke(ctx context.Context, namespace, method string, req, resp interface{}) error {
+	if namespace != "" {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs(namespaceHeader, namespace))
+	}
+	return grpc.Invoke(ctx, method, req, resp, c.conn)
+}
+
+func (c *grpcClient) ListNamespaces(ctx context.Context) ([]*Namespace, error) {
+	var resp listNamespacesResponse
+	if err := c.invoke(ctx, "", namespacesService+"List", &listNamespacesRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Namespaces, nil
+}
+
+func (c *grpcClient) ListContainers(ctx context.Context, namespace string) ([]*Container, error) {
+	var resp listContainersResponse
+	if err := c.invoke(ctx, namespace, containersService+"List", &listContainersRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Containers, nil
+}
+
+func (c *grpcClient) ListTasks(ctx context.Context, namespace string) ([]*Task, error) {
+	var resp listTasksResponse
+	if err := c.invoke(ctx, namespace, tasksService+"List", &listTasksRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+func (c *grpcClient) KillTask(ctx context.Context, namespace, containerID string, signal syscall.Signal) error {
+	req := &killRequest{ContainerID: containerID, Signal: uint32(signal), All: true}
+	return c.invoke(ctx, namespace, tasksService+"Kill", req, &empty.Empty{})
+}
+
+func (c *grpcClient) PauseTask(ctx context.Context, namespace, containerID string) error {
+	return c.invoke(ctx, namespace, tasksService+"Pause", &taskRequest{ContainerID: containerID}, &empty.Empty{})
+}
+
+func (c *grpcClient) ResumeTask(ctx context.Context, namespace, containerID string) error {
+	return c.invoke(ctx, namespace, tasksService+"Resume", &taskRequest{ContainerID: containerID}, &empty.Empty{})
+}
+
+func (c *grpcClient) DeleteTask(ctx context.Context, namespace, containerID string) error {
+	return c.invoke(ctx, namespace, tasksService+"Delete", &taskRequest{ContainerID: containerID}, &deleteTaskResponse{})
+}
+
+func (c *grpcClient) DeleteContainer(ctx context.Context, namespace, containerID string) error {
+	return c.invoke(ctx, namespace, containersService+"Delete", &deleteContainerRequest{ID: containerID}, &empty.Empty{})
+}
+
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,109 @@
+package containerd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeTasks is a containerd Tasks service, which records the namespace and
+// the requests it is sent.
+type fakeTasks struct {
+	namespace string
+	kill      killRequest
+}
+
+func requestNamespace(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md[namespaceHeader]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+var fakeTasksDesc = grpc.ServiceDesc{
+	ServiceName: "containerd.services.tasks.v1.Tasks",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var req listTasksRequest
+				if err := dec(&req); err != nil {
+					return nil, err
+				}
+				srv.(*fakeTasks).namespace = requestNamespace(ctx)
+				return &listTasksResponse{Tasks: []*Task{
+					{ContainerID: "app", ID: "app", PID: 1234, Status: TaskStatusPaused},
+				}}, nil
+			},
+		},
+		{
+			MethodName: "Kill",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				f := srv.(*fakeTasks)
+				if err := dec(&f.kill); err != nil {
+					return nil, err
+				}
+				f.namespace = requestNamespace(ctx)
+				return &empty.Empty{}, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func TestGRPCClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "containerd.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	tasks := &fakeTasks{}
+	server.RegisterService(&fakeTasksDesc, tasks)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := NewClient(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	have, err := client.ListTasks(context.Background(), "k8s.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Task{{ContainerID: "app", ID: "app", PID: 1234, Status: TaskStatusPaused}}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected tasks %v, got %v", want, have)
+	}
+	if tasks.namespace != "k8s.io" {
+		t.Errorf("Expected namespace k8s.io, got %q", tasks.namespace)
+	}
+
+	if err := client.KillTask(context.Background(), "default", "app", syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if want := (killRequest{ContainerID: "app", Signal: uint32(syscall.SIGTERM), All: true}); want != tasks.kill {
+		t.Errorf("Expected kill request %v, got %v", want, tasks.kill)
+	}
+	if tasks.namespace != "default" {
+		t.Errorf("Expected namespace default, got %q", tasks.namespace)
+	}
+}
@@ -0,0 +1,86 @@
+package containerd
+
+import (
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the containerd integration. Containers can't be
+// (re)started, as that needs the rootfs mounts of their snapshot, which only
+// the client which created them knows about.
+const (
+	StopContainer    = "containerd_stop_container"
+	PauseContainer   = "containerd_pause_container"
+	UnpauseContainer = "containerd_unpause_container"
+	RemoveContainer  = "containerd_remove_container"
+)
+
+func (r *Reporter) stopContainer(ctx context.Context, namespace, containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Stopping containerd container %s/%s", namespace, containerID)
+	return xfer.ResponseError(r.client.KillTask(ctx, namespace, containerID, syscall.SIGTERM))
+}
+
+func (r *Reporter) pauseContainer(ctx context.Context, namespace, containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Pausing containerd container %s/%s", namespace, containerID)
+	return xfer.ResponseError(r.client.PauseTask(ctx, namespace, containerID))
+}
+
+func (r *Reporter) unpauseContainer(ctx context.Context, namespace, containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Unpausing containerd container %s/%s", namespace, containerID)
+	return xfer.ResponseError(r.client.ResumeTask(ctx, namespace, containerID))
+}
+
+func (r *Reporter) removeContainer(ctx context.Context, namespace, containerID string, req xfer.Request) xfer.Response {
+	log.Infof("Removing containerd container %s/%s", namespace, containerID)
+	// The container may still have the task it exited with.
+	if err := r.client.DeleteTask(ctx, namespace, containerID); err != nil {
+		log.Debugf("containerd: error deleting task of %s/%s: %v", namespace, containerID, err)
+	}
+	if err := r.client.DeleteContainer(ctx, namespace, containerID); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{
+		RemovedNode: req.NodeID,
+	}
+}
+
+func (r *Reporter) captureContainer(f func(context.Context, string, string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		containerID, ok := report.ParseContainerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		namespace, ok := r.namespace(containerID)
+		if !ok {
+			return xfer.ResponseErrorf("Not found: %s", containerID)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		return f(ctx, namespace, containerID, req)
+	}
+}
+
+func (r *Reporter) registerControls() {
+	controls := map[string]xfer.ControlHandlerFunc{
+		StopContainer:    r.captureContainer(r.stopContainer),
+		PauseContainer:   r.captureContainer(r.pauseContainer),
+		UnpauseContainer: r.captureContainer(r.unpauseContainer),
+		RemoveContainer:  r.captureContainer(r.removeContainer),
+	}
+	r.handlerRegistry.Batch(nil, controls)
+}
+
+func (r *Reporter) deregisterControls() {
+	controls := []string{
+		StopContainer,
+		PauseContainer,
+		UnpauseContainer,
+		RemoveContainer,
+	}
+	r.handlerRegistry.Batch(controls, nil)
+}
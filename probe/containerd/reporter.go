@@ -0,0 +1,220 @@
+package containerd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest. Everything containerd and docker have in
+// common uses the docker keys, so that containers from either render the
+// same way.
+const (
+	ContainerNamespace = "containerd_namespace"
+	ContainerRuntime   = "containerd_runtime"
+	ContainerPID       = "containerd_pid"
+
+	requestTimeout = 5 * time.Second
+)
+
+// Exposed for testing
+var (
+	ContainerMetadataTemplates = docker.RuntimeContainerMetadataTemplates.Merge(report.MetadataTemplates{
+		ContainerNamespace: {ID: ContainerNamespace, Label: "Namespace", From: report.FromLatest, Priority: 4},
+		ContainerRuntime:   {ID: ContainerRuntime, Label: "Runtime", From: report.FromLatest, Priority: 5},
+		ContainerPID:       {ID: ContainerPID, Label: "PID", From: report.FromLatest, Datatype: "number", Priority: 6},
+	})
+
+	ContainerTableTemplates = docker.RuntimeContainerTableTemplates
+
+	ContainerControls = []report.Control{
+		{
+			ID:    PauseContainer,
+			Human: "Pause",
+			Icon:  "fa-pause",
+			Rank:  5,
+		},
+		{
+			ID:    UnpauseContainer,
+			Human: "Unpause",
+			Icon:  "fa-play",
+			Rank:  6,
+		},
+		{
+			ID:    StopContainer,
+			Human: "Stop",
+			Icon:  "fa-stop",
+			Rank:  7,
+		},
+		{
+			ID:    RemoveContainer,
+			Human: "Remove",
+			Icon:  "fa-trash-o",
+			Rank:  8,
+		},
+	}
+)
+
+// Reporter generates Reports containing the Container and ContainerImage
+// topologies of every containerd namespace.
+type Reporter struct {
+	client          Client
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
+
+	sync.Mutex
+	namespaces map[string]string // container ID -> namespace, as of the last report
+}
+
+// NewReporter makes a new Reporter
+func NewReporter(client Client, probeID string, handlerRegistry *controls.HandlerRegistry) *Reporter {
+	reporter := &Reporter{
+		client:          client,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+		namespaces:      map[string]string{},
+	}
+	reporter.registerControls()
+	return reporter
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Containerd" }
+
+// Stop unregisters controls and closes the connection to containerd.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+	if err := r.client.Close(); err != nil {
+		log.Errorf("containerd: error closing client: %v", err)
+	}
+}
+
+// namespace gives the namespace of a container, as of the last report.
+func (r *Reporter) namespace(containerID string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	namespace, ok := r.namespaces[containerID]
+	return namespace, ok
+}
+
+// Report generates a Report containing Container and ContainerImage topologies
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	namespaces, err := r.client.ListNamespaces(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	result.Container = result.Container.
+		WithMetadataTemplates(ContainerMetadataTemplates).
+		WithTableTemplates(ContainerTableTemplates)
+	result.Container.Controls.AddControls(ContainerControls)
+	result.ContainerImage = result.ContainerImage.
+		WithMetadataTemplates(docker.ContainerImageMetadataTemplates)
+
+	containerNamespaces := map[string]string{}
+	for _, namespace := range namespaces {
+		containers, err := r.client.ListContainers(ctx, namespace.Name)
+		if err != nil {
+			return result, err
+		}
+		tasks, err := r.client.ListTasks(ctx, namespace.Name)
+		if err != nil {
+			return result, err
+		}
+		byContainer := map[string]*Task{}
+		for _, task := range tasks {
+			byContainer[task.ContainerID] = task
+		}
+		for _, c := range containers {
+			containerNamespaces[c.ID] = namespace.Name
+			result.Container.AddNode(r.containerNode(namespace.Name, c, byContainer[c.ID]))
+			if c.Image != "" {
+				result.ContainerImage.AddNode(report.MakeNodeWith(report.MakeContainerImageNodeID(c.Image), map[string]string{
+					docker.ImageID:   c.Image,
+					docker.ImageName: c.Image,
+				}))
+			}
+		}
+	}
+
+	r.Lock()
+	r.namespaces = containerNamespaces
+	r.Unlock()
+	return result, nil
+}
+
+func (r *Reporter) containerNode(namespace string, c *Container, task *Task) report.Node {
+	state, stateHuman := containerState(task)
+	latest := map[string]string{
+		docker.ContainerID:         c.ID,
+		docker.ContainerName:       c.ID,
+		docker.ContainerState:      state,
+		docker.ContainerStateHuman: stateHuman,
+		ContainerNamespace:         namespace,
+		report.ControlProbeID:      r.probeID,
+	}
+	if created, err := ptypes.Timestamp(c.CreatedAt); err == nil {
+		latest[docker.ContainerCreated] = created.Format(time.RFC3339Nano)
+	}
+	if c.Runtime != nil {
+		latest[ContainerRuntime] = c.Runtime.Name
+	}
+	if task != nil && task.PID != 0 && state != docker.StateExited {
+		latest[ContainerPID] = strconv.FormatUint(uint64(task.PID), 10)
+	}
+
+	node := report.MakeNodeWith(report.MakeContainerNodeID(c.ID), latest)
+	if c.Image != "" {
+		node = node.WithLatests(map[string]string{docker.ImageID: c.Image}).
+			WithParents(report.MakeSets().
+				Add(report.ContainerImage, report.MakeStringSet(report.MakeContainerImageNodeID(c.Image))),
+			)
+	}
+	node = node.AddPrefixPropertyList(docker.LabelPrefix, c.Labels)
+	return node.WithLatestControls(controlsMap(state))
+}
+
+// containerState maps the status of the task of a container to the docker
+// container states.
+func containerState(task *Task) (string, string) {
+	if task == nil {
+		return docker.StateCreated, "Created"
+	}
+	switch task.Status {
+	case TaskStatusRunning:
+		return docker.StateRunning, "Up"
+	case TaskStatusPaused, TaskStatusPausing:
+		return docker.StatePaused, "Up (Paused)"
+	case TaskStatusStopped:
+		return docker.StateExited, fmt.Sprintf("Exited (%d)", task.ExitStatus)
+	default:
+		return docker.StateCreated, "Created"
+	}
+}
+
+func controlsMap(state string) map[string]report.NodeControlData {
+	var (
+		paused  = state == docker.StatePaused
+		running = state == docker.StateRunning
+		stopped = !paused && !running
+	)
+	return map[string]report.NodeControlData{
+		UnpauseContainer: {Dead: !paused},
+		StopContainer:    {Dead: !running},
+		PauseContainer:   {Dead: !running},
+		RemoveContainer:  {Dead: !stopped},
+	}
+}
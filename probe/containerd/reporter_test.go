@@ -0,0 +1,209 @@
+package containerd_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/containerd"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	containers map[string][]*containerd.Container
+	tasks      map[string][]*containerd.Task
+	calls      []string
+}
+
+func newMockClient() *mockClient {
+	created, _ := ptypes.TimestampProto(time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC))
+	return &mockClient{
+		containers: map[string][]*containerd.Container{
+			"k8s.io": {
+				{
+					ID:        "app",
+					Image:     "docker.io/library/nginx:1.13",
+					Labels:    map[string]string{"io.kubernetes.pod.name": "web"},
+					Runtime:   &containerd.Runtime{Name: "io.containerd.runtime.v1.linux"},
+					CreatedAt: created,
+				},
+				{ID: "done", Image: "docker.io/library/busybox:latest"},
+			},
+			"default": {
+				{ID: "idle"},
+			},
+		},
+		tasks: map[string][]*containerd.Task{
+			"k8s.io": {
+				{ContainerID: "app", ID: "app", PID: 1234, Status: containerd.TaskStatusRunning},
+				{ContainerID: "done", ID: "done", PID: 1235, Status: containerd.TaskStatusStopped, ExitStatus: 137},
+			},
+		},
+	}
+}
+
+func (c *mockClient) ListNamespaces(context.Context) ([]*containerd.Namespace, error) {
+	return []*containerd.Namespace{{Name: "default"}, {Name: "k8s.io"}}, nil
+}
+
+func (c *mockClient) ListContainers(_ context.Context, namespace string) ([]*containerd.Container, error) {
+	return c.containers[namespace], nil
+}
+
+func (c *mockClient) ListTasks(_ context.Context, namespace string) ([]*containerd.Task, error) {
+	return c.tasks[namespace], nil
+}
+
+func (c *mockClient) call(format string, args ...interface{}) error {
+	c.calls = append(c.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (c *mockClient) KillTask(_ context.Context, namespace, id string, signal syscall.Signal) error {
+	return c.call("kill %s/%s %d", namespace, id, signal)
+}
+
+func (c *mockClient) PauseTask(_ context.Context, namespace, id string) error {
+	return c.call("pause %s/%s", namespace, id)
+}
+
+func (c *mockClient) ResumeTask(_ context.Context, namespace, id string) error {
+	return c.call("resume %s/%s", namespace, id)
+}
+
+func (c *mockClient) DeleteTask(_ context.Context, namespace, id string) error {
+	return c.call("delete task %s/%s", namespace, id)
+}
+
+func (c *mockClient) DeleteContainer(_ context.Context, namespace, id string) error {
+	return c.call("delete container %s/%s", namespace, id)
+}
+
+func (c *mockClient) Close() error { return nil }
+
+func activeControls(n report.Node) []string {
+	controls := []string{}
+	n.LatestControls.ForEach(func(id string, _ time.Time, data report.NodeControlData) {
+		if !data.Dead {
+			controls = append(controls, id)
+		}
+	})
+	sort.Strings(controls)
+	return controls
+}
+
+func TestReporter(t *testing.T) {
+	reporter := containerd.NewReporter(newMockClient(), "probe-id", controls.NewDefaultHandlerRegistry())
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 3, len(rpt.Container.Nodes); want != have {
+		t.Fatalf("Expected %d containers, got %d", want, have)
+	}
+	for _, c := range []struct {
+		id, namespace, state, stateHuman string
+		live                             []string
+	}{
+		{"app", "k8s.io", docker.StateRunning, "Up", []string{containerd.PauseContainer, containerd.StopContainer}},
+		{"done", "k8s.io", docker.StateExited, "Exited (137)", []string{containerd.RemoveContainer}},
+		{"idle", "default", docker.StateCreated, "Created", []string{containerd.RemoveContainer}},
+	} {
+		node, ok := rpt.Container.Nodes[report.MakeContainerNodeID(c.id)]
+		if !ok {
+			t.Fatalf("Expected container %s", c.id)
+		}
+		for key, want := range map[string]string{
+			docker.ContainerID:            c.id,
+			docker.ContainerState:         c.state,
+			docker.ContainerStateHuman:    c.stateHuman,
+			containerd.ContainerNamespace: c.namespace,
+			report.ControlProbeID:         "probe-id",
+		} {
+			if have, _ := node.Latest.Lookup(key); want != have {
+				t.Errorf("%s: expected %s %q, got %q", c.id, key, want, have)
+			}
+		}
+		if have := activeControls(node); !reflect.DeepEqual(c.live, have) {
+			t.Errorf("%s: expected controls %v, got %v", c.id, c.live, have)
+		}
+	}
+
+	app := rpt.Container.Nodes[report.MakeContainerNodeID("app")]
+	for key, want := range map[string]string{
+		docker.ImageID: "docker.io/library/nginx:1.13",
+		docker.LabelPrefix + "io.kubernetes.pod.name": "web",
+		containerd.ContainerRuntime:                   "io.containerd.runtime.v1.linux",
+		containerd.ContainerPID:                       "1234",
+		docker.ContainerCreated:                       "2017-10-01T12:00:00Z",
+	} {
+		if have, _ := app.Latest.Lookup(key); want != have {
+			t.Errorf("Expected %s %q, got %q", key, want, have)
+		}
+	}
+	imageID := report.MakeContainerImageNodeID("docker.io/library/nginx:1.13")
+	if parents, _ := app.Parents.Lookup(report.ContainerImage); !reflect.DeepEqual(parents, report.MakeStringSet(imageID)) {
+		t.Errorf("Expected image parent %s, got %v", imageID, parents)
+	}
+	if _, ok := rpt.ContainerImage.Nodes[imageID]; !ok {
+		t.Errorf("Expected image %s", imageID)
+	}
+}
+
+func TestControls(t *testing.T) {
+	client := newMockClient()
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := containerd.NewReporter(client, "probe-id", hr)
+	defer reporter.Stop()
+
+	// Unknown until the containers have been reported
+	if result := hr.HandleControlRequest(xfer.Request{
+		Control: containerd.StopContainer,
+		NodeID:  report.MakeContainerNodeID("app"),
+	}); result.Error == "" {
+		t.Error("Expected an error for an unreported container")
+	}
+
+	if _, err := reporter.Report(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ control, id string }{
+		{containerd.StopContainer, "app"},
+		{containerd.PauseContainer, "app"},
+		{containerd.UnpauseContainer, "app"},
+		{containerd.RemoveContainer, "done"},
+	} {
+		nodeID := report.MakeContainerNodeID(tc.id)
+		result := hr.HandleControlRequest(xfer.Request{Control: tc.control, NodeID: nodeID})
+		want := xfer.Response{}
+		if tc.control == containerd.RemoveContainer {
+			want.RemovedNode = nodeID
+		}
+		if !reflect.DeepEqual(want, result) {
+			t.Errorf("%s: expected %v, got %v", tc.control, want, result)
+		}
+	}
+
+	want := []string{
+		"kill k8s.io/app 15",
+		"pause k8s.io/app",
+		"resume k8s.io/app",
+		"delete task k8s.io/done",
+		"delete container k8s.io/done",
+	}
+	if !reflect.DeepEqual(want, client.calls) {
+		t.Errorf("Expected calls %v, got %v", want, client.calls)
+	}
+}
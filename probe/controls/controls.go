@@ -1,6 +1,10 @@
 package controls
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/weaveworks/scope/common/xfer"
@@ -114,16 +118,64 @@ func (r *HandlerRegistry) Batch(toRemove []string, toAdd map[string]xfer.Control
 	}
 }
 
-// HandleControlRequest performs a control request.
+// HandleControlRequest performs a control request. Controls with a dry run
+// are only performed once confirmed after it, and while their dry run tells
+// the same.
 func (r *HandlerRegistry) HandleControlRequest(req xfer.Request) xfer.Response {
 	h, ok := r.handler(req.Control)
 	if !ok {
 		return xfer.ResponseErrorf("Control %q not recognised", req.Control)
 	}
+	confirmation, confirmed := req.ControlArgs[xfer.ConfirmationArg]
+	if dryRun, ok := r.handler(xfer.DryRunControl(req.Control)); ok {
+		if res := confirm(dryRun, req, confirmation); res.Error != "" {
+			return res
+		}
+	} else if confirmed {
+		return xfer.ResponseErrorf("Control %q has no dry run to confirm", req.Control)
+	}
 
 	return h(req)
 }
 
+func confirm(dryRun xfer.ControlHandlerFunc, req xfer.Request, confirmation string) xfer.Response {
+	if confirmation == "" {
+		return xfer.ResponseErrorf("Control %q has to be confirmed after its dry run", req.Control)
+	}
+	req.Control = xfer.DryRunControl(req.Control)
+	res := dryRun(req)
+	if res.Error != "" {
+		return res
+	}
+	if res.DryRun == nil || res.DryRun.Confirmation != confirmation {
+		return xfer.ResponseErrorf("What the control would do changed since it was confirmed; confirm it again")
+	}
+	return xfer.Response{}
+}
+
+// DryRunResponse is the response of the dry run of a control, telling the
+// effects the control would have, with the confirmation doing it takes.
+// Confirmations are of the effects, of the node and of the arguments of the
+// control, so that dry runs telling the same give the same confirmation.
+func DryRunResponse(req xfer.Request, effects ...string) xfer.Response {
+	args := make([]string, 0, len(req.ControlArgs))
+	for k, v := range req.ControlArgs {
+		if k != xfer.ConfirmationArg {
+			args = append(args, k+"="+v)
+		}
+	}
+	sort.Strings(args)
+	fields := append([]string{req.NodeID, req.Control}, args...)
+	fields = append(fields, effects...)
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return xfer.Response{
+		DryRun: &xfer.DryRunResult{
+			Effects:      effects,
+			Confirmation: hex.EncodeToString(sum[:16]),
+		},
+	}
+}
+
 func (r *HandlerRegistry) handler(control string) (xfer.ControlHandlerFunc, bool) {
 	r.backend.Lock()
 	defer r.backend.Unlock()
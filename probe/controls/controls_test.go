@@ -41,3 +41,53 @@ func TestControlsNotFound(t *testing.T) {
 		t.Fatal(test.Diff(want, have))
 	}
 }
+
+func TestControlsConfirmation(t *testing.T) {
+	registry := controls.NewDefaultHandlerRegistry()
+	effect := "foo will be done"
+	done := 0
+	registry.Register("foo", func(req xfer.Request) xfer.Response {
+		done++
+		return xfer.Response{}
+	})
+	registry.Register(xfer.DryRunControl("foo"), func(req xfer.Request) xfer.Response {
+		return controls.DryRunResponse(req, effect)
+	})
+
+	dryRun := registry.HandleControlRequest(xfer.Request{
+		NodeID:      "node",
+		Control:     xfer.DryRunControl("foo"),
+		ControlArgs: map[string]string{"bar": "baz"},
+	})
+	if dryRun.DryRun == nil || !reflect.DeepEqual(dryRun.DryRun.Effects, []string{effect}) {
+		t.Fatalf("Expected the effects of foo, got %+v", dryRun)
+	}
+	confirm := func(args map[string]string) xfer.Response {
+		return registry.HandleControlRequest(xfer.Request{NodeID: "node", Control: "foo", ControlArgs: args})
+	}
+
+	// Controls with a dry run are only done once confirmed
+	if have := confirm(map[string]string{"bar": "baz"}); have.Error == "" {
+		t.Errorf("Expected an unconfirmed control to fail")
+	}
+	// Confirmations are of the same arguments
+	if have := confirm(map[string]string{"bar": "qux", xfer.ConfirmationArg: dryRun.DryRun.Confirmation}); have.Error == "" {
+		t.Errorf("Expected a confirmation of other arguments to fail")
+	}
+	if have := confirm(map[string]string{"bar": "baz", xfer.ConfirmationArg: dryRun.DryRun.Confirmation}); have.Error != "" {
+		t.Errorf("Expected the confirmed control to be done, got %v", have.Error)
+	}
+	// ... and effects
+	effect = "foo will be done differently"
+	if have := confirm(map[string]string{"bar": "baz", xfer.ConfirmationArg: dryRun.DryRun.Confirmation}); have.Error == "" {
+		t.Errorf("Expected a confirmation of other effects to fail")
+	}
+	if done != 1 {
+		t.Errorf("Expected foo to be done once, got %d", done)
+	}
+
+	registry.Register("bar", func(req xfer.Request) xfer.Response { return xfer.Response{} })
+	if have := registry.HandleControlRequest(xfer.Request{Control: "bar", ControlArgs: map[string]string{xfer.ConfirmationArg: "x"}}); have.Error == "" {
+		t.Errorf("Expected a confirmation of a control without dry runs to fail")
+	}
+}
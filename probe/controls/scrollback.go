@@ -0,0 +1,47 @@
+package controls
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultScrollbackSize is how many bytes of output a Scrollback keeps,
+// unless asked otherwise.
+const DefaultScrollbackSize = 64 * 1024
+
+// Scrollback is a writer which keeps the last bytes written through it, so
+// that they can be replayed to a UI which reconnects to a pipe.
+type Scrollback struct {
+	mtx  sync.Mutex
+	w    io.Writer
+	buf  []byte
+	size int
+}
+
+// NewScrollback makes a new Scrollback writing to w, and keeping the last
+// size bytes written.
+func NewScrollback(w io.Writer, size int) *Scrollback {
+	return &Scrollback{w: w, size: size}
+}
+
+// Write writes p, keeping it.
+func (s *Scrollback) Write(p []byte) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.buf = append(s.buf, p...)
+	if len(s.buf) > s.size {
+		s.buf = append(s.buf[:0], s.buf[len(s.buf)-s.size:]...)
+	}
+	return s.w.Write(p)
+}
+
+// Replay writes what was kept again.
+func (s *Scrollback) Replay() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.buf)
+	return err
+}
@@ -0,0 +1,29 @@
+package controls_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+func TestScrollback(t *testing.T) {
+	var out bytes.Buffer
+	scrollback := controls.NewScrollback(&out, 8)
+	for _, s := range []string{"hello ", "world", "!"} {
+		if _, err := scrollback.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "hello world!"; out.String() != want {
+		t.Fatalf("%q != %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := scrollback.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "o world!"; out.String() != want {
+		t.Fatalf("%q != %q", out.String(), want)
+	}
+}
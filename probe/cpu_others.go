@@ -0,0 +1,17 @@
+// +build !windows
+
+package probe
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime is the user and system CPU time used by the probe.
+func processCPUTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
@@ -0,0 +1,24 @@
+package probe
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime is the user and kernel CPU time used by the probe.
+func processCPUTime() (time.Duration, error) {
+	handle, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	return filetimeDuration(kernel) + filetimeDuration(user), nil
+}
+
+// filetimeDuration converts a Filetime holding a duration, in 100ns ticks.
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,175 @@
+package cri
+
+// The subset of the Kubernetes CRI (runtime.v1alpha2) gRPC API used by the
+// reporter, with the field numbers of k8s.io/kubernetes/pkg/kubelet/apis/cri,
+// so it can be spoken with the default protobuf codec.
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+const runtimeService = "/runtime.v1alpha2.RuntimeService/"
+
+// ContainerState is the state of a CRI container.
+type ContainerState int32
+
+// ContainerState values
+const (
+	ContainerCreated ContainerState = iota
+	ContainerRunning
+	ContainerExited
+	ContainerUnknown
+)
+
+// ContainerMetadata holds the name of a container within its pod.
+type ContainerMetadata struct {
+	Name    string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Attempt uint32 `protobuf:"varint,2,opt,name=attempt" json:"attempt,omitempty"`
+}
+
+func (m *ContainerMetadata) Reset()         { *m = ContainerMetadata{} }
+func (m *ContainerMetadata) String() string { return proto.CompactTextString(m) }
+func (*ContainerMetadata) ProtoMessage()    {}
+
+// ImageSpec is the image a container was created from.
+type ImageSpec struct {
+	Image string `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+}
+
+func (m *ImageSpec) Reset()         { *m = ImageSpec{} }
+func (m *ImageSpec) String() string { return proto.CompactTextString(m) }
+func (*ImageSpec) ProtoMessage()    {}
+
+// Container is a container, as listed by the runtime.
+type Container struct {
+	ID           string             `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	PodSandboxID string             `protobuf:"bytes,2,opt,name=pod_sandbox_id" json:"pod_sandbox_id,omitempty"`
+	Metadata     *ContainerMetadata `protobuf:"bytes,3,opt,name=metadata" json:"metadata,omitempty"`
+	Image        *ImageSpec         `protobuf:"bytes,4,opt,name=image" json:"image,omitempty"`
+	ImageRef     string             `protobuf:"bytes,5,opt,name=image_ref" json:"image_ref,omitempty"`
+	State        ContainerState     `protobuf:"varint,6,opt,name=state" json:"state,omitempty"`
+	CreatedAt    int64              `protobuf:"varint,7,opt,name=created_at" json:"created_at,omitempty"`
+	Labels       map[string]string  `protobuf:"bytes,8,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Annotations  map[string]string  `protobuf:"bytes,9,rep,name=annotations" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Container) Reset()         { *m = Container{} }
+func (m *Container) String() string { return proto.CompactTextString(m) }
+func (*Container) ProtoMessage()    {}
+
+type listContainersRequest struct{}
+
+func (m *listContainersRequest) Reset()         { *m = listContainersRequest{} }
+func (m *listContainersRequest) String() string { return proto.CompactTextString(m) }
+func (*listContainersRequest) ProtoMessage()    {}
+
+type listContainersResponse struct {
+	Containers []*Container `protobuf:"bytes,1,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *listContainersResponse) Reset()         { *m = listContainersResponse{} }
+func (m *listContainersResponse) String() string { return proto.CompactTextString(m) }
+func (*listContainersResponse) ProtoMessage()    {}
+
+// UInt64Value wraps usage figures, which may be missing.
+type UInt64Value struct {
+	Value uint64 `protobuf:"varint,1,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *UInt64Value) Reset()         { *m = UInt64Value{} }
+func (m *UInt64Value) String() string { return proto.CompactTextString(m) }
+func (*UInt64Value) ProtoMessage()    {}
+
+// CPUUsage is the cumulative CPU time used by a container, as of Timestamp
+// (in nanoseconds).
+type CPUUsage struct {
+	Timestamp            int64        `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	UsageCoreNanoSeconds *UInt64Value `protobuf:"bytes,2,opt,name=usage_core_nano_seconds" json:"usage_core_nano_seconds,omitempty"`
+}
+
+func (m *CPUUsage) Reset()         { *m = CPUUsage{} }
+func (m *CPUUsage) String() string { return proto.CompactTextString(m) }
+func (*CPUUsage) ProtoMessage()    {}
+
+// MemoryUsage is the working set of a container, as of Timestamp (in
+// nanoseconds).
+type MemoryUsage struct {
+	Timestamp       int64        `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	WorkingSetBytes *UInt64Value `protobuf:"bytes,2,opt,name=working_set_bytes" json:"working_set_bytes,omitempty"`
+}
+
+func (m *MemoryUsage) Reset()         { *m = MemoryUsage{} }
+func (m *MemoryUsage) String() string { return proto.CompactTextString(m) }
+func (*MemoryUsage) ProtoMessage()    {}
+
+// ContainerAttributes identifies the container stats are about.
+type ContainerAttributes struct {
+	ID string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *ContainerAttributes) Reset()         { *m = ContainerAttributes{} }
+func (m *ContainerAttributes) String() string { return proto.CompactTextString(m) }
+func (*ContainerAttributes) ProtoMessage()    {}
+
+// ContainerStats are the resource usage of a container.
+type ContainerStats struct {
+	Attributes *ContainerAttributes `protobuf:"bytes,1,opt,name=attributes" json:"attributes,omitempty"`
+	CPU        *CPUUsage            `protobuf:"bytes,2,opt,name=cpu" json:"cpu,omitempty"`
+	Memory     *MemoryUsage         `protobuf:"bytes,3,opt,name=memory" json:"memory,omitempty"`
+}
+
+func (m *ContainerStats) Reset()         { *m = ContainerStats{} }
+func (m *ContainerStats) String() string { return proto.CompactTextString(m) }
+func (*ContainerStats) ProtoMessage()    {}
+
+type listContainerStatsRequest struct{}
+
+func (m *listContainerStatsRequest) Reset()         { *m = listContainerStatsRequest{} }
+func (m *listContainerStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*listContainerStatsRequest) ProtoMessage()    {}
+
+type listContainerStatsResponse struct {
+	Stats []*ContainerStats `protobuf:"bytes,1,rep,name=stats" json:"stats,omitempty"`
+}
+
+func (m *listContainerStatsResponse) Reset()         { *m = listContainerStatsResponse{} }
+func (m *listContainerStatsResponse) String() string { return proto.CompactTextString(m) }
+func (*listContainerStatsResponse) ProtoMessage()    {}
+
+// containerRequest is any of StartContainerRequest, StopContainerRequest and
+// RemoveContainerRequest. Timeout (in seconds) is only used to stop.
+type containerRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id" json:"container_id,omitempty"`
+	Timeout     int64  `protobuf:"varint,2,opt,name=timeout" json:"timeout,omitempty"`
+}
+
+func (m *containerRequest) Reset()         { *m = containerRequest{} }
+func (m *containerRequest) String() string { return proto.CompactTextString(m) }
+func (*containerRequest) ProtoMessage()    {}
+
+// emptyResponse is any of the (empty) responses to containerRequests.
+type emptyResponse struct{}
+
+func (m *emptyResponse) Reset()         { *m = emptyResponse{} }
+func (m *emptyResponse) String() string { return proto.CompactTextString(m) }
+func (*emptyResponse) ProtoMessage()    {}
+
+type versionRequest struct {
+	Version string `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
+}
+
+func (m *versionRequest) Reset()         { *m = versionRequest{} }
+func (m *versionRequest) String() string { return proto.CompactTextString(m) }
+func (*versionRequest) ProtoMessage()    {}
+
+// VersionResponse identifies the container runtime.
+type VersionResponse struct {
+	Version           string `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
+	RuntimeName       string `protobuf:"bytes,2,opt,name=runtime_name" json:"runtime_name,omitempty"`
+	RuntimeVersion    string `protobuf:"bytes,3,opt,name=runtime_version" json:"runtime_version,omitempty"`
+	RuntimeAPIVersion string `protobuf:"bytes,4,opt,name=runtime_api_version" json:"runtime_api_version,omitempty"`
+}
+
+func (m *VersionResponse) Reset()         { *m = VersionResponse{} }
+func (m *VersionResponse) String() string { return proto.CompactTextString(m) }
+func (*VersionResponse) ProtoMessage()    {}
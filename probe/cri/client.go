@@ -0,0 +1,90 @@
+package cri
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Client is the subset of the CRI runtime service used by the reporter.
+// Exposed for testing.
+type Client interface {
+	Version(ctx context.Context) (*VersionResponse, error)
+	ListContainers(ctx context.Context) ([]*Container, error)
+	ListContainerStats(ctx context.Context) ([]*ContainerStats, error)
+	StartContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string, timeout time.Duration) error
+	RemoveContainer(ctx context.Context, containerID string) error
+	Close() error
+}
+
+const dialTimeout = 5 * time.Second
+
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient connects to the CRI runtime service on endpoint, which is the
+// path of a unix socket, optionally prefixed with unix://.
+func NewClient(endpoint string) (Client, error) {
+	conn, err := grpc.Dial(strings.TrimPrefix(endpoint, "unix://"),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(dialTimeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcClient{conn: conn}, nil
+}
+
+func (c *grpcClient) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	return grpc.Invoke(ctx, runtimeService+method, req, resp, c.conn)
+}
+
+func (c *grpcClient) Version(ctx context.Context) (*VersionResponse, error) {
+	var resp VersionResponse
+	if err := c.invoke(ctx, "Version", &versionRequest{Version: "v1alpha2"}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *grpcClient) ListContainers(ctx context.Context) ([]*Container, error) {
+	var resp listContainersResponse
+	if err := c.invoke(ctx, "ListContainers", &listContainersRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Containers, nil
+}
+
+func (c *grpcClient) ListContainerStats(ctx context.Context) ([]*ContainerStats, error) {
+	var resp listContainerStatsResponse
+	if err := c.invoke(ctx, "ListContainerStats", &listContainerStatsRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Stats, nil
+}
+
+func (c *grpcClient) StartContainer(ctx context.Context, containerID string) error {
+	return c.invoke(ctx, "StartContainer", &containerRequest{ContainerID: containerID}, &emptyResponse{})
+}
+
+func (c *grpcClient) StopContainer(ctx context.Context, containerID string, timeout time.Duration) error {
+	req := &containerRequest{ContainerID: containerID, Timeout: int64(timeout / time.Second)}
+	return c.invoke(ctx, "StopContainer", req, &emptyResponse{})
+}
+
+func (c *grpcClient) RemoveContainer(ctx context.Context, containerID string) error {
+	return c.invoke(ctx, "RemoveContainer", &containerRequest{ContainerID: containerID}, &emptyResponse{})
+}
+
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,70 @@
+package cri
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var fakeRuntimeDesc = grpc.ServiceDesc{
+	ServiceName: "runtime.v1alpha2.RuntimeService",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListContainers",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var req listContainersRequest
+				if err := dec(&req); err != nil {
+					return nil, err
+				}
+				return &listContainersResponse{Containers: srv.([]*Container)}, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func TestGRPCClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "crio.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Container{{
+		ID:        "abc123",
+		Metadata:  &ContainerMetadata{Name: "web", Attempt: 1},
+		Image:     &ImageSpec{Image: "nginx"},
+		State:     ContainerRunning,
+		CreatedAt: 1500000000000000000,
+		Labels:    map[string]string{"io.kubernetes.pod.uid": "uid1"},
+	}}
+	server := grpc.NewServer()
+	server.RegisterService(&fakeRuntimeDesc, want)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := NewClient("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	have, err := client.ListContainers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected containers %v, got %v", want, have)
+	}
+}
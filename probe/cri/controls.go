@@ -0,0 +1,71 @@
+package cri
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the CRI integration. Exited containers can't be
+// restarted through the CRI; the kubelet creates new ones instead.
+const (
+	StartContainer  = "cri_start_container"
+	StopContainer   = "cri_stop_container"
+	RemoveContainer = "cri_remove_container"
+
+	stopTimeout = 10 * time.Second
+)
+
+func (r *Reporter) startContainer(ctx context.Context, containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Starting CRI container %s", containerID)
+	return xfer.ResponseError(r.client.StartContainer(ctx, containerID))
+}
+
+func (r *Reporter) stopContainer(ctx context.Context, containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Stopping CRI container %s", containerID)
+	return xfer.ResponseError(r.client.StopContainer(ctx, containerID, stopTimeout))
+}
+
+func (r *Reporter) removeContainer(ctx context.Context, containerID string, req xfer.Request) xfer.Response {
+	log.Infof("Removing CRI container %s", containerID)
+	if err := r.client.RemoveContainer(ctx, containerID); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{
+		RemovedNode: req.NodeID,
+	}
+}
+
+func captureContainerID(timeout time.Duration, f func(context.Context, string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		containerID, ok := report.ParseContainerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return f(ctx, containerID, req)
+	}
+}
+
+func (r *Reporter) registerControls() {
+	controls := map[string]xfer.ControlHandlerFunc{
+		StartContainer:  captureContainerID(requestTimeout, r.startContainer),
+		StopContainer:   captureContainerID(requestTimeout+stopTimeout, r.stopContainer),
+		RemoveContainer: captureContainerID(requestTimeout, r.removeContainer),
+	}
+	r.handlerRegistry.Batch(nil, controls)
+}
+
+func (r *Reporter) deregisterControls() {
+	controls := []string{
+		StartContainer,
+		StopContainer,
+		RemoveContainer,
+	}
+	r.handlerRegistry.Batch(controls, nil)
+}
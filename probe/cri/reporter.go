@@ -0,0 +1,242 @@
+package cri
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest. Everything CRI and docker containers have in
+// common uses the docker keys, so that containers from either render the
+// same way.
+const (
+	ContainerRuntime = "cri_runtime"
+	ContainerAttempt = "cri_container_attempt"
+	PodSandboxID     = "cri_pod_sandbox_id"
+
+	requestTimeout = 5 * time.Second
+)
+
+// Exposed for testing
+var (
+	ContainerMetadataTemplates = docker.RuntimeContainerMetadataTemplates.Merge(report.MetadataTemplates{
+		ContainerAttempt: {ID: ContainerAttempt, Label: "Restart #", From: report.FromLatest, Priority: 5},
+		ContainerRuntime: {ID: ContainerRuntime, Label: "Runtime", From: report.FromLatest, Priority: 6},
+	})
+
+	ContainerTableTemplates = docker.RuntimeContainerTableTemplates
+
+	ContainerControls = []report.Control{
+		{
+			ID:    StartContainer,
+			Human: "Start",
+			Icon:  "fa-play",
+			Rank:  3,
+		},
+		{
+			ID:    StopContainer,
+			Human: "Stop",
+			Icon:  "fa-stop",
+			Rank:  7,
+		},
+		{
+			ID:    RemoveContainer,
+			Human: "Remove",
+			Icon:  "fa-trash-o",
+			Rank:  8,
+		},
+	}
+)
+
+// cpuSample is the cumulative CPU usage of a container at a point in time.
+type cpuSample struct {
+	timestamp, usage uint64
+}
+
+// Reporter generates Reports containing the Container and ContainerImage
+// topologies of a CRI runtime.
+type Reporter struct {
+	client          Client
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
+
+	sync.Mutex
+	runtime     string
+	previousCPU map[string]cpuSample
+}
+
+// NewReporter makes a new Reporter
+func NewReporter(client Client, probeID string, handlerRegistry *controls.HandlerRegistry) *Reporter {
+	reporter := &Reporter{
+		client:          client,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+		previousCPU:     map[string]cpuSample{},
+	}
+	reporter.registerControls()
+	return reporter
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "CRI" }
+
+// Stop unregisters controls and closes the connection to the runtime.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+	if err := r.client.Close(); err != nil {
+		log.Errorf("cri: error closing client: %v", err)
+	}
+}
+
+func (r *Reporter) runtimeName(ctx context.Context) string {
+	r.Lock()
+	defer r.Unlock()
+	if r.runtime == "" {
+		if version, err := r.client.Version(ctx); err == nil {
+			r.runtime = version.RuntimeName + " " + version.RuntimeVersion
+		}
+	}
+	return r.runtime
+}
+
+// Report generates a Report containing Container and ContainerImage topologies
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	containers, err := r.client.ListContainers(ctx)
+	if err != nil {
+		return result, err
+	}
+	stats, err := r.client.ListContainerStats(ctx)
+	if err != nil {
+		log.Warnf("cri: error listing container stats: %v", err)
+	}
+	metrics := r.metrics(stats)
+	runtime := r.runtimeName(ctx)
+
+	result.Container = result.Container.
+		WithMetadataTemplates(ContainerMetadataTemplates).
+		WithMetricTemplates(docker.ContainerMetricTemplates).
+		WithTableTemplates(ContainerTableTemplates)
+	result.Container.Controls.AddControls(ContainerControls)
+	result.ContainerImage = result.ContainerImage.
+		WithMetadataTemplates(docker.ContainerImageMetadataTemplates)
+
+	for _, c := range containers {
+		node := r.containerNode(c, runtime).WithMetrics(metrics[c.ID])
+		result.Container.AddNode(node)
+		if imageID, ok := node.Latest.Lookup(docker.ImageID); ok {
+			imageName, _ := node.Latest.Lookup(docker.ImageName)
+			result.ContainerImage.AddNode(report.MakeNodeWith(report.MakeContainerImageNodeID(imageID), map[string]string{
+				docker.ImageID:   imageID,
+				docker.ImageName: imageName,
+			}))
+		}
+	}
+	return result, nil
+}
+
+func (r *Reporter) containerNode(c *Container, runtime string) report.Node {
+	state, stateHuman := containerState(c.State)
+	latest := map[string]string{
+		docker.ContainerID:         c.ID,
+		docker.ContainerName:       c.ID,
+		docker.ContainerState:      state,
+		docker.ContainerStateHuman: stateHuman,
+		docker.ContainerCreated:    time.Unix(0, c.CreatedAt).UTC().Format(time.RFC3339Nano),
+		PodSandboxID:               c.PodSandboxID,
+		report.ControlProbeID:      r.probeID,
+	}
+	if c.Metadata != nil {
+		latest[docker.ContainerName] = c.Metadata.Name
+		latest[ContainerAttempt] = strconv.FormatUint(uint64(c.Metadata.Attempt), 10)
+	}
+	if runtime != "" {
+		latest[ContainerRuntime] = runtime
+	}
+
+	node := report.MakeNodeWith(report.MakeContainerNodeID(c.ID), latest)
+	if imageID := strings.TrimPrefix(c.ImageRef, "sha256:"); imageID != "" {
+		imageName := imageID
+		if c.Image != nil && c.Image.Image != "" {
+			imageName = c.Image.Image
+		}
+		node = node.WithLatests(map[string]string{
+			docker.ImageID:   imageID,
+			docker.ImageName: imageName,
+		}).WithParents(report.MakeSets().
+			Add(report.ContainerImage, report.MakeStringSet(report.MakeContainerImageNodeID(imageID))),
+		)
+	}
+	node = node.AddPrefixPropertyList(docker.LabelPrefix, c.Labels)
+	return node.WithLatestControls(controlsMap(state))
+}
+
+// metrics turns container stats into the docker CPU and memory metrics. CPU
+// usage is a percentage since the previous report, so is only reported from
+// the second time a container is seen.
+func (r *Reporter) metrics(stats []*ContainerStats) map[string]report.Metrics {
+	r.Lock()
+	defer r.Unlock()
+	var (
+		now      = mtime.Now()
+		result   = map[string]report.Metrics{}
+		previous = r.previousCPU
+	)
+	r.previousCPU = map[string]cpuSample{}
+	for _, s := range stats {
+		if s.Attributes == nil {
+			continue
+		}
+		var (
+			id      = s.Attributes.ID
+			metrics = report.Metrics{}
+		)
+		if s.Memory != nil && s.Memory.WorkingSetBytes != nil {
+			metrics[docker.MemoryUsage] = report.MakeSingletonMetric(now, float64(s.Memory.WorkingSetBytes.Value))
+		}
+		if s.CPU != nil && s.CPU.UsageCoreNanoSeconds != nil {
+			sample := cpuSample{timestamp: uint64(s.CPU.Timestamp), usage: s.CPU.UsageCoreNanoSeconds.Value}
+			r.previousCPU[id] = sample
+			if prev, ok := previous[id]; ok && sample.timestamp > prev.timestamp && sample.usage >= prev.usage {
+				percent := float64(sample.usage-prev.usage) / float64(sample.timestamp-prev.timestamp) * 100.
+				metrics[docker.CPUTotalUsage] = report.MakeSingletonMetric(now, percent)
+			}
+		}
+		result[id] = metrics
+	}
+	return result
+}
+
+// containerState maps CRI container states to the docker container states.
+func containerState(state ContainerState) (string, string) {
+	switch state {
+	case ContainerCreated:
+		return docker.StateCreated, "Created"
+	case ContainerRunning:
+		return docker.StateRunning, "Up"
+	case ContainerExited:
+		return docker.StateExited, "Exited"
+	default:
+		return docker.StateDead, "Unknown"
+	}
+}
+
+func controlsMap(state string) map[string]report.NodeControlData {
+	return map[string]report.NodeControlData{
+		StartContainer:  {Dead: state != docker.StateCreated},
+		StopContainer:   {Dead: state != docker.StateRunning},
+		RemoveContainer: {Dead: state == docker.StateRunning},
+	}
+}
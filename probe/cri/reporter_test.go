@@ -0,0 +1,155 @@
+package cri_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/cri"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	containers []*cri.Container
+	stats      []*cri.ContainerStats
+	calls      []string
+}
+
+func (c *mockClient) Version(context.Context) (*cri.VersionResponse, error) {
+	return &cri.VersionResponse{RuntimeName: "cri-o", RuntimeVersion: "1.10.0"}, nil
+}
+
+func (c *mockClient) ListContainers(context.Context) ([]*cri.Container, error) {
+	return c.containers, nil
+}
+
+func (c *mockClient) ListContainerStats(context.Context) ([]*cri.ContainerStats, error) {
+	return c.stats, nil
+}
+
+func (c *mockClient) StartContainer(_ context.Context, id string) error {
+	c.calls = append(c.calls, "start "+id)
+	return nil
+}
+
+func (c *mockClient) StopContainer(_ context.Context, id string, timeout time.Duration) error {
+	c.calls = append(c.calls, "stop "+id+" "+timeout.String())
+	return nil
+}
+
+func (c *mockClient) RemoveContainer(_ context.Context, id string) error {
+	c.calls = append(c.calls, "remove "+id)
+	return nil
+}
+
+func (c *mockClient) Close() error { return nil }
+
+func stats(id string, at time.Duration, cpu, memory uint64) *cri.ContainerStats {
+	return &cri.ContainerStats{
+		Attributes: &cri.ContainerAttributes{ID: id},
+		CPU:        &cri.CPUUsage{Timestamp: int64(at), UsageCoreNanoSeconds: &cri.UInt64Value{Value: cpu}},
+		Memory:     &cri.MemoryUsage{Timestamp: int64(at), WorkingSetBytes: &cri.UInt64Value{Value: memory}},
+	}
+}
+
+func TestReporter(t *testing.T) {
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	client := &mockClient{
+		containers: []*cri.Container{
+			{
+				ID:           "abc123",
+				PodSandboxID: "pod1",
+				Metadata:     &cri.ContainerMetadata{Name: "web", Attempt: 2},
+				Image:        &cri.ImageSpec{Image: "docker.io/library/nginx:1.13"},
+				ImageRef:     "sha256:deadbeef",
+				State:        cri.ContainerRunning,
+				CreatedAt:    now.Add(-time.Hour).UnixNano(),
+				Labels:       map[string]string{"io.kubernetes.pod.uid": "uid1"},
+			},
+			{ID: "def456", State: cri.ContainerExited},
+		},
+		stats: []*cri.ContainerStats{stats("abc123", 0, 0, 1024)},
+	}
+	reporter := cri.NewReporter(client, "probe-id", controls.NewDefaultHandlerRegistry())
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := rpt.Container.Nodes[report.MakeContainerNodeID("abc123")]
+	for key, want := range map[string]string{
+		docker.ContainerID:                           "abc123",
+		docker.ContainerName:                         "web",
+		docker.ContainerState:                        docker.StateRunning,
+		docker.ImageID:                               "deadbeef",
+		docker.ImageName:                             "docker.io/library/nginx:1.13",
+		docker.ContainerCreated:                      "2018-03-01T11:00:00Z",
+		docker.LabelPrefix + "io.kubernetes.pod.uid": "uid1",
+		cri.ContainerAttempt:                         "2",
+		cri.ContainerRuntime:                         "cri-o 1.10.0",
+		cri.PodSandboxID:                             "pod1",
+		report.ControlProbeID:                        "probe-id",
+	} {
+		if have, _ := web.Latest.Lookup(key); want != have {
+			t.Errorf("Expected %s %q, got %q", key, want, have)
+		}
+	}
+	if _, ok := rpt.ContainerImage.Nodes[report.MakeContainerImageNodeID("deadbeef")]; !ok {
+		t.Error("Expected image deadbeef")
+	}
+	if memory, ok := web.Metrics[docker.MemoryUsage]; !ok || memory.Max != 1024 {
+		t.Errorf("Expected memory usage of 1024, got %v", memory)
+	}
+	// No CPU usage until there are two samples
+	if _, ok := web.Metrics[docker.CPUTotalUsage]; ok {
+		t.Error("Expected no CPU usage from the first sample")
+	}
+	exited := rpt.Container.Nodes[report.MakeContainerNodeID("def456")]
+	if state, _ := exited.Latest.Lookup(docker.ContainerState); state != docker.StateExited {
+		t.Errorf("Expected exited container, got %q", state)
+	}
+
+	// Half a core over a second
+	client.stats = []*cri.ContainerStats{stats("abc123", time.Second, uint64(500*time.Millisecond), 2048)}
+	rpt, err = reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	web = rpt.Container.Nodes[report.MakeContainerNodeID("abc123")]
+	if cpu, ok := web.Metrics[docker.CPUTotalUsage]; !ok || cpu.Max != 50 {
+		t.Errorf("Expected CPU usage of 50%%, got %v", cpu)
+	}
+}
+
+func TestControls(t *testing.T) {
+	client := &mockClient{}
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := cri.NewReporter(client, "probe-id", hr)
+	defer reporter.Stop()
+
+	nodeID := report.MakeContainerNodeID("abc123")
+	for _, control := range []string{cri.StartContainer, cri.StopContainer, cri.RemoveContainer} {
+		result := hr.HandleControlRequest(xfer.Request{Control: control, NodeID: nodeID})
+		want := xfer.Response{}
+		if control == cri.RemoveContainer {
+			want.RemovedNode = nodeID
+		}
+		if !reflect.DeepEqual(want, result) {
+			t.Errorf("%s: expected %v, got %v", control, want, result)
+		}
+	}
+	want := []string{"start abc123", "stop abc123 10s", "remove abc123"}
+	if !reflect.DeepEqual(want, client.calls) {
+		t.Errorf("Expected calls %v, got %v", want, client.calls)
+	}
+}
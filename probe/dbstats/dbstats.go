@@ -0,0 +1,207 @@
+// Package dbstats counts the queries sent to MySQL and PostgreSQL servers,
+// and the errors they return, on the edges of the connections to them.
+package dbstats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Database protocols, as in report.EdgeMetadata.Protocol
+const (
+	MySQL      = "mysql"
+	PostgreSQL = "postgresql"
+)
+
+// Ports are the protocols of the well-known ports of database servers,
+// exposed for testing.
+var Ports = map[uint16]string{
+	3306: MySQL,
+	5432: PostgreSQL,
+}
+
+// Commands of the MySQL client/server protocol.
+const (
+	mysqlComQuery       = 0x03
+	mysqlComStmtExecute = 0x17
+	mysqlErrPacket      = 0xff
+	mysqlHeaderLen      = 4 // payload length (3 bytes) and sequence id
+)
+
+// Message is what the start of a TCP payload of a database protocol tells:
+// whether a query was sent or an error returned.
+type Message struct {
+	Query bool
+	Error bool
+}
+
+// ParseMessage parses the start of a TCP payload in protocol, sent to the
+// server or returned by it. Only the first message of the payload is
+// parsed, so queries pipelined in one segment count once.
+func ParseMessage(protocol string, toServer bool, payload []byte) (Message, bool) {
+	switch protocol {
+	case MySQL:
+		// <length:3><sequence id:1><command or status:1>...
+		if len(payload) <= mysqlHeaderLen || payload[0]|payload[1]|payload[2] == 0 {
+			return Message{}, false
+		}
+		seq, command := payload[3], payload[4]
+		if toServer && seq == 0 && (command == mysqlComQuery || command == mysqlComStmtExecute) {
+			return Message{Query: true}, true
+		}
+		if !toServer && seq != 0 && command == mysqlErrPacket {
+			return Message{Error: true}, true
+		}
+	case PostgreSQL:
+		// <type:1><length:4>..., the length counting itself
+		if len(payload) < 5 || binary.BigEndian.Uint32(payload[1:5]) < 4 {
+			return Message{}, false
+		}
+		switch {
+		// a simple query, or the parse or bind starting an extended one
+		case toServer && (payload[0] == 'Q' || payload[0] == 'P' || payload[0] == 'B'):
+			return Message{Query: true}, true
+		case !toServer && payload[0] == 'E':
+			return Message{Error: true}, true
+		}
+	}
+	return Message{}, false
+}
+
+// connection is a connection to a database server, by host:port.
+type connection struct {
+	client, server string
+}
+
+type counts struct {
+	protocol        string
+	queries, errors uint64
+}
+
+// Counter counts the queries and errors of the connections to database
+// servers.
+type Counter struct {
+	mtx    sync.Mutex
+	byConn map[connection]*counts
+}
+
+// NewCounter makes a new Counter.
+func NewCounter() *Counter {
+	return &Counter{
+		byConn: map[connection]*counts{},
+	}
+}
+
+// Filter implements snoop.Observer, matching the segments with a payload
+// to or from the database ports.
+func (c *Counter) Filter() string {
+	var ports []string
+	for port := range Ports {
+		ports = append(ports, fmt.Sprintf("tcp port %d", port))
+	}
+	sort.Strings(ports)
+	return fmt.Sprintf("(%s) and (ip[2:2] - ((ip[0] & 0xf) << 2) - ((tcp[12] & 0xf0) >> 2)) != 0", strings.Join(ports, " or "))
+}
+
+func hostPort(ip net.IP, port uint16) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+// Observe implements snoop.Observer.
+func (c *Counter) Observe(src, dst net.IP, srcPort, dstPort uint16, payload []byte) {
+	var (
+		conn     connection
+		toServer bool
+	)
+	protocol, ok := Ports[dstPort]
+	if ok {
+		conn, toServer = connection{client: hostPort(src, srcPort), server: hostPort(dst, dstPort)}, true
+	} else if protocol, ok = Ports[srcPort]; ok {
+		conn = connection{client: hostPort(dst, dstPort), server: hostPort(src, srcPort)}
+	} else {
+		return
+	}
+	msg, ok := ParseMessage(protocol, toServer, payload)
+	if !ok {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	n, ok := c.byConn[conn]
+	if !ok {
+		n = &counts{protocol: protocol}
+		c.byConn[conn] = n
+	}
+	if msg.Query {
+		n.queries++
+	} else {
+		n.errors++
+	}
+}
+
+// reset gives the counts since the last reset.
+func (c *Counter) reset() map[connection]*counts {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	byConn := c.byConn
+	c.byConn = map[connection]*counts{}
+	return byConn
+}
+
+// Tagger adds the queries and errors counted since the previous report to
+// the edges of the endpoint topology from the clients to database servers.
+type Tagger struct {
+	counter *Counter
+}
+
+// NewTagger makes a new Tagger of the queries counted by counter.
+func NewTagger(counter *Counter) *Tagger {
+	return &Tagger{counter: counter}
+}
+
+// Name of this tagger, for metrics gathering
+func (*Tagger) Name() string { return "Database" }
+
+func endpointAddress(endpointNodeID string) (string, bool) {
+	_, addr, port, ok := report.ParseEndpointNodeID(endpointNodeID)
+	return net.JoinHostPort(addr, port), ok
+}
+
+// Tag implements Tagger.
+func (t *Tagger) Tag(rpt report.Report) (report.Report, error) {
+	byConn := t.counter.reset()
+	if len(byConn) == 0 {
+		return rpt, nil
+	}
+	for id, n := range rpt.Endpoint.Nodes {
+		client, ok := endpointAddress(id)
+		if !ok {
+			continue
+		}
+		for _, dst := range n.Adjacency {
+			server, ok := endpointAddress(dst)
+			if !ok {
+				continue
+			}
+			c, ok := byConn[connection{client: client, server: server}]
+			if !ok {
+				continue
+			}
+			queries, errors := c.queries, c.errors
+			rpt.Endpoint.AddNode(report.MakeNode(id).WithEdge(dst, report.EdgeMetadata{
+				Protocol:        c.protocol,
+				QueryCount:      &queries,
+				QueryErrorCount: &errors,
+			}))
+		}
+	}
+	return rpt, nil
+}
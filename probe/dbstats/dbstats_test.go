@@ -0,0 +1,77 @@
+package dbstats_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/weaveworks/common/test"
+
+	"github.com/weaveworks/scope/probe/dbstats"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestParseMessage(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		protocol string
+		toServer bool
+		payload  string
+		ok       bool
+		want     dbstats.Message
+	}{
+		{"mysql query", dbstats.MySQL, true, "\x09\x00\x00\x00\x03SELECT 1", true, dbstats.Message{Query: true}},
+		{"mysql execute", dbstats.MySQL, true, "\x0a\x00\x00\x00\x17\x01\x00\x00\x00\x00", true, dbstats.Message{Query: true}},
+		{"mysql ping", dbstats.MySQL, true, "\x01\x00\x00\x00\x0e", false, dbstats.Message{}},
+		{"mysql error", dbstats.MySQL, false, "\x17\x00\x00\x01\xff\x7a\x04#42S02", true, dbstats.Message{Error: true}},
+		{"mysql ok", dbstats.MySQL, false, "\x07\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00", false, dbstats.Message{}},
+		{"postgres query", dbstats.PostgreSQL, true, "Q\x00\x00\x00\x0dSELECT 1\x00", true, dbstats.Message{Query: true}},
+		{"postgres parse", dbstats.PostgreSQL, true, "P\x00\x00\x00\x10\x00SELECT $1\x00", true, dbstats.Message{Query: true}},
+		{"postgres startup", dbstats.PostgreSQL, true, "\x00\x00\x00\x08\x04\xd2\x16\x2f", false, dbstats.Message{}},
+		{"postgres error", dbstats.PostgreSQL, false, "E\x00\x00\x00\x50SERROR\x00", true, dbstats.Message{Error: true}},
+		{"postgres ready", dbstats.PostgreSQL, false, "Z\x00\x00\x00\x05I", false, dbstats.Message{}},
+	} {
+		have, ok := dbstats.ParseMessage(c.protocol, c.toServer, []byte(c.payload))
+		if ok != c.ok || have != c.want {
+			t.Errorf("%s: expected %v, %v, got %v, %v", c.name, c.want, c.ok, have, ok)
+		}
+	}
+}
+
+func TestTagger(t *testing.T) {
+	var (
+		client   = net.ParseIP("10.0.0.1")
+		server   = net.ParseIP("10.0.0.2")
+		clientID = report.MakeEndpointNodeID("host", "", client.String(), "50000")
+		serverID = report.MakeEndpointNodeID("host", "", server.String(), "3306")
+		query    = []byte("\x09\x00\x00\x00\x03SELECT 1")
+	)
+	counter := dbstats.NewCounter()
+	counter.Observe(client, server, 50000, 3306, query)
+	counter.Observe(client, server, 50000, 3306, query)
+	counter.Observe(server, client, 3306, 50000, []byte("\x17\x00\x00\x01\xff\x7a\x04#42S02"))
+	// Not a database port
+	counter.Observe(client, server, 50001, 80, query)
+
+	rpt := report.MakeReport()
+	rpt.Endpoint.AddNode(report.MakeNode(clientID).WithAdjacent(serverID))
+	rpt.Endpoint.AddNode(report.MakeNode(serverID))
+	rpt, err := dbstats.NewTagger(counter).Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, _ := rpt.Endpoint.Nodes[clientID].Edges.Lookup(serverID)
+	queries, errors := uint64(2), uint64(1)
+	want := report.EdgeMetadata{Protocol: dbstats.MySQL, QueryCount: &queries, QueryErrorCount: &errors}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// The counts are since the previous report
+	rpt = report.MakeReport()
+	rpt.Endpoint.AddNode(report.MakeNode(clientID).WithAdjacent(serverID))
+	rpt, _ = dbstats.NewTagger(counter).Tag(rpt)
+	if md, ok := rpt.Endpoint.Nodes[clientID].Edges.Lookup(serverID); ok {
+		t.Errorf("Expected no queries since the previous report, got %v", md)
+	}
+}
@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	docker_client "github.com/fsouza/go-dockerclient"
+)
+
+// checkpointAPIVersion is the first version of the Docker API with
+// checkpoints, which need the daemon to run with experimental features and
+// CRIU installed.
+const checkpointAPIVersion = "v1.25"
+
+// dockerClient adds the checkpoint API, which go-dockerclient lacks, to its
+// Client.
+type dockerClient struct {
+	*docker_client.Client
+	httpClient *http.Client
+	baseURL    string
+}
+
+func newCheckpointingClient(c *docker_client.Client) (*dockerClient, error) {
+	u, err := url.Parse(c.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	result := &dockerClient{Client: c, httpClient: c.HTTPClient}
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		result.httpClient = &http.Client{Transport: &http.Transport{
+			Dial: func(string, string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		}}
+		result.baseURL = "http://unix.sock"
+	default:
+		scheme := "http"
+		if c.TLSConfig != nil {
+			scheme = "https"
+		}
+		result.baseURL = scheme + "://" + u.Host
+	}
+	if result.httpClient == nil {
+		result.httpClient = http.DefaultClient
+	}
+	return result, nil
+}
+
+func (c *dockerClient) checkpointRequest(method, path string, body interface{}, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.baseURL+"/"+checkpointAPIVersion+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Docker API error (%s): %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// ListCheckpoints gives the names of the checkpoints of a container.
+func (c *dockerClient) ListCheckpoints(containerID string) ([]string, error) {
+	var checkpoints []struct {
+		Name string
+	}
+	if err := c.checkpointRequest("GET", "/containers/"+containerID+"/checkpoints", nil, &checkpoints); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		names = append(names, checkpoint.Name)
+	}
+	return names, nil
+}
+
+// CreateCheckpoint checkpoints a container, as docker checkpoint create
+// does. The container is stopped, unless it is left running.
+func (c *dockerClient) CreateCheckpoint(containerID, checkpoint string, leaveRunning bool) error {
+	return c.checkpointRequest("POST", "/containers/"+containerID+"/checkpoints", map[string]interface{}{
+		"CheckpointID": checkpoint,
+		"Exit":         !leaveRunning,
+	}, nil)
+}
+
+// RestoreCheckpoint starts a stopped container from one of its checkpoints.
+func (c *dockerClient) RestoreCheckpoint(containerID, checkpoint string) error {
+	return c.checkpointRequest("POST", "/containers/"+containerID+"/start?checkpoint="+url.QueryEscape(checkpoint), nil, nil)
+}
@@ -0,0 +1,57 @@
+package docker_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+)
+
+func TestCheckpointClient(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.String()+" "+string(body))
+		switch {
+		case r.Method == "GET":
+			w.Write([]byte(`[{"Name":"foo"},{"Name":"bar"}]`))
+		case r.URL.Query().Get("checkpoint") == "missing":
+			http.Error(w, "no such checkpoint", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := docker.NewDockerClientStub("tcp://" + ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, err := client.ListCheckpoints("ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"foo", "bar"}; !reflect.DeepEqual(want, checkpoints) {
+		t.Errorf("want %v, have %v", want, checkpoints)
+	}
+	if err := client.CreateCheckpoint("ping", "foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RestoreCheckpoint("ping", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RestoreCheckpoint("ping", "missing"); err == nil {
+		t.Error("Expected an error restoring a missing checkpoint")
+	}
+
+	want := []string{
+		"GET /v1.25/containers/ping/checkpoints ",
+		"POST /v1.25/containers/ping/checkpoints {\"CheckpointID\":\"foo\",\"Exit\":true}\n",
+		"POST /v1.25/containers/ping/start?checkpoint=foo ",
+		"POST /v1.25/containers/ping/start?checkpoint=missing ",
+	}
+	if !reflect.DeepEqual(want, requests) {
+		t.Errorf("want %q, have %q", want, requests)
+	}
+}
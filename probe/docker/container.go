@@ -13,6 +13,7 @@ import (
 	docker "github.com/fsouza/go-dockerclient"
 
 	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/cgroup"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -31,6 +32,12 @@ const (
 	ContainerUptime        = "docker_container_uptime"
 	ContainerRestartCount  = "docker_container_restart_count"
 	ContainerNetworkMode   = "docker_container_network_mode"
+	ContainerGPUs          = "docker_container_gpus"
+	ContainerCrashLooping  = "docker_container_crashlooping"
+	ContainerExitCode      = "docker_container_exit_code"
+	ContainerOOMKilled     = "docker_container_oom_killed"
+	ContainerTermination   = "docker_container_termination_reason"
+	ContainerFinished      = "docker_container_finished"
 
 	NetworkRxDropped = "network_rx_dropped"
 	NetworkRxBytes   = "network_rx_bytes"
@@ -52,6 +59,9 @@ const (
 	CPUUsageInKernelmode = "docker_cpu_usage_in_kernelmode"
 	CPUSystemCPUUsage    = "docker_cpu_system_cpu_usage"
 
+	BlkioReadRate  = "docker_blkio_read_rate"
+	BlkioWriteRate = "docker_blkio_write_rate"
+
 	NetworkModeHost = "host"
 
 	LabelPrefix = "docker_label_"
@@ -105,6 +115,7 @@ type container struct {
 	numPending             int
 	hostID                 string
 	baseNode               report.Node
+	lastTermination        *docker.State
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
 }
@@ -118,6 +129,7 @@ func NewContainer(c *docker.Container, hostID string, noCommandLineArguments boo
 		noEnvironmentVariables: noEnvironmentVariables,
 	}
 	result.baseNode = result.getBaseNode()
+	result.recordTermination()
 	return result
 }
 
@@ -125,6 +137,33 @@ func (c *container) UpdateState(container *docker.Container) {
 	c.Lock()
 	defer c.Unlock()
 	c.container = container
+	c.recordTermination()
+}
+
+// recordTermination keeps the state of the container when it last
+// finished, as docker resets the exit code and OOM kill flag of containers
+// once they start again.
+func (c *container) recordTermination() {
+	state := c.container.State
+	if (state.Running && !state.Restarting) || state.FinishedAt.IsZero() {
+		return
+	}
+	c.lastTermination = &state
+}
+
+// terminationReason gives why the container last finished, in the terms
+// Kubernetes uses for the reasons containers terminated.
+func terminationReason(state *docker.State) string {
+	switch {
+	case state.OOMKilled:
+		return "OOMKilled"
+	case state.Error != "":
+		return state.Error
+	case state.ExitCode == 0:
+		return "Completed"
+	default:
+		return "Error"
+	}
 }
 
 func (c *container) ID() string {
@@ -192,6 +231,10 @@ func (c *container) StartGatheringStats(client StatsGatherer) error {
 
 	go func() {
 		for s := range stats {
+			c.RLock()
+			pid := c.container.State.Pid
+			c.RUnlock()
+			withCgroupStats(s, pid)
 			c.Lock()
 			if c.numPending >= len(c.pendingStats) {
 				log.Warnf("docker container: dropping stats for %s", c.container.ID)
@@ -222,6 +265,38 @@ func (c *container) StopGatheringStats() {
 	}
 }
 
+// withCgroupStats fills in the usage docker leaves out of the stats of a
+// container from its cgroups, as versions of docker without support for the
+// unified cgroup hierarchy give no CPU, memory or block IO usage under it.
+func withCgroupStats(s *docker.Stats, pid int) {
+	if pid <= 0 || (s.CPUStats.CPUUsage.TotalUsage != 0 && s.MemoryStats.Usage != 0 && len(s.BlkioStats.IOServiceBytesRecursive) != 0) {
+		return
+	}
+	stats, err := cgroup.ReadStats(pid)
+	if err != nil {
+		log.Debugf("docker container: error reading cgroup stats of pid %d: %v", pid, err)
+		return
+	}
+	if s.CPUStats.CPUUsage.TotalUsage == 0 {
+		s.CPUStats.CPUUsage.TotalUsage = stats.CPUUsage
+		if s.CPUStats.SystemCPUUsage == 0 {
+			s.CPUStats.SystemCPUUsage, _ = cgroup.SystemCPUUsage()
+		}
+	}
+	if s.MemoryStats.Usage == 0 {
+		s.MemoryStats.Usage = stats.MemoryUsage
+		if s.MemoryStats.Limit == 0 {
+			s.MemoryStats.Limit = stats.MemoryLimit
+		}
+	}
+	if len(s.BlkioStats.IOServiceBytesRecursive) == 0 {
+		s.BlkioStats.IOServiceBytesRecursive = []docker.BlkioStatsEntry{
+			{Op: "read", Value: stats.IORead},
+			{Op: "write", Value: stats.IOWrite},
+		}
+	}
+}
+
 func (c *container) ports(localAddrs []net.IP) report.StringSet {
 	if c.container.NetworkSettings == nil {
 		return report.MakeStringSet()
@@ -234,14 +309,17 @@ func (c *container) ports(localAddrs []net.IP) report.StringSet {
 			continue
 		}
 		for _, b := range bindings {
-			if b.HostIP != "0.0.0.0" {
-				ports = append(ports, fmt.Sprintf("%s:%s->%s", b.HostIP, b.HostPort, port))
+			// Bindings to all the addresses of the host are of one family,
+			// "0.0.0.0" or "::"
+			hostIP := net.ParseIP(b.HostIP)
+			if hostIP == nil || !hostIP.IsUnspecified() {
+				ports = append(ports, fmt.Sprintf("%s->%s", net.JoinHostPort(b.HostIP, b.HostPort), port))
 				continue
 			}
 
 			for _, ip := range localAddrs {
-				if ip.To4() != nil {
-					ports = append(ports, fmt.Sprintf("%s:%s->%s", ip, b.HostPort, port))
+				if (ip.To4() != nil) == (hostIP.To4() != nil) {
+					ports = append(ports, fmt.Sprintf("%s->%s", net.JoinHostPort(ip.String(), b.HostPort), port))
 				}
 			}
 		}
@@ -267,55 +345,68 @@ func addScopeToIPs(hostID string, ips []string) []string {
 	return ipsWithScopes
 }
 
-func isIPv4(addr string) bool {
-	ip := net.ParseIP(addr)
-	return ip != nil && ip.To4() != nil
+// canonicalIPs gives the valid addresses of ips, IPv4 or IPv6, in their
+// canonical forms.
+func canonicalIPs(ips []string) []string {
+	result := []string{}
+	for _, addr := range ips {
+		if ip := net.ParseIP(addr); ip != nil {
+			result = append(result, ip.String())
+		}
+	}
+	return result
 }
 
 func (c *container) NetworkInfo(localAddrs []net.IP) report.Sets {
 	c.RLock()
 	defer c.RUnlock()
 
-	ips := c.container.NetworkSettings.SecondaryIPAddresses
-	if c.container.NetworkSettings.IPAddress != "" {
-		ips = append(ips, c.container.NetworkSettings.IPAddress)
-	}
+	settings := c.container.NetworkSettings
+	ips := append([]string{}, settings.SecondaryIPAddresses...)
+	ips = append(ips, settings.SecondaryIPv6Addresses...)
+	ips = append(ips, settings.IPAddress, settings.GlobalIPv6Address)
 
 	// For now, for the proof-of-concept, we just add networks as a set of
 	// names. For the next iteration, we will probably want to create a new
 	// Network topology, populate the network nodes with all of the details
 	// here, and provide foreign key links from nodes to networks.
-	networks := make([]string, 0, len(c.container.NetworkSettings.Networks))
-	for name, settings := range c.container.NetworkSettings.Networks {
+	networks := make([]string, 0, len(settings.Networks))
+	for name, network := range settings.Networks {
 		networks = append(networks, name)
-		if settings.IPAddress != "" {
-			ips = append(ips, settings.IPAddress)
-		}
+		ips = append(ips, network.IPAddress, network.GlobalIPv6Address)
 	}
 
-	// Filter out IPv6 addresses; nothing works with IPv6 yet
-	ipv4s := []string{}
-	for _, ip := range ips {
-		if isIPv4(ip) {
-			ipv4s = append(ipv4s, ip)
-		}
-	}
+	ips = canonicalIPs(ips)
 	// Treat all Docker IPs as local scoped.
-	ipsWithScopes := addScopeToIPs(c.hostID, ipv4s)
+	ipsWithScopes := addScopeToIPs(c.hostID, ips)
 
 	return report.MakeSets().
 		Add(ContainerNetworks, report.MakeStringSet(networks...)).
 		Add(ContainerPorts, c.ports(localAddrs)).
-		Add(ContainerIPs, report.MakeStringSet(ipv4s...)).
+		Add(ContainerIPs, report.MakeStringSet(ips...)).
 		Add(ContainerIPsWithScopes, report.MakeStringSet(ipsWithScopes...))
 }
 
+// memoryUsage gives the memory used by a container, less the inactive page
+// cache the kernel reclaims first, like the docker CLI does. The cache is in
+// total_inactive_file under v1 cgroups, and inactive_file under v2.
+func memoryUsage(s docker.Stats) uint64 {
+	cache := s.MemoryStats.Stats.TotalInactiveFile
+	if cache == 0 {
+		cache = s.MemoryStats.Stats.InactiveFile
+	}
+	if cache > s.MemoryStats.Usage {
+		return s.MemoryStats.Usage
+	}
+	return s.MemoryStats.Usage - cache
+}
+
 func (c *container) memoryUsageMetric(stats []docker.Stats) report.Metric {
 	var max float64
 	samples := make([]report.Sample, len(stats))
 	for i, s := range stats {
 		samples[i].Timestamp = s.Read
-		samples[i].Value = float64(s.MemoryStats.Usage)
+		samples[i].Value = float64(memoryUsage(s))
 		if float64(s.MemoryStats.Limit) > max {
 			max = float64(s.MemoryStats.Limit)
 		}
@@ -345,14 +436,50 @@ func (c *container) cpuPercentMetric(stats []docker.Stats) report.Metric {
 	return report.MakeMetric(samples).WithMax(100.0)
 }
 
+// blkioBytes sums the bytes read or written by a container on all devices.
+func blkioBytes(s docker.Stats, op string) uint64 {
+	var total uint64
+	for _, entry := range s.BlkioStats.IOServiceBytesRecursive {
+		if strings.EqualFold(entry.Op, op) {
+			total += entry.Value
+		}
+	}
+	return total
+}
+
+// blkioRateMetric gives the bytes per second read or written by a container,
+// between consecutive stats.
+func (c *container) blkioRateMetric(stats []docker.Stats, op string) report.Metric {
+	if len(stats) < 2 {
+		return report.MakeMetric(nil)
+	}
+
+	samples := make([]report.Sample, len(stats)-1)
+	previous := stats[0]
+	for i, s := range stats[1:] {
+		rate := 0.0
+		current, last := blkioBytes(s, op), blkioBytes(previous, op)
+		// Counters go back to zero when the container restarts
+		if seconds := s.Read.Sub(previous.Read).Seconds(); seconds > 0 && current > last {
+			rate = float64(current-last) / seconds
+		}
+		samples[i].Timestamp = s.Read
+		samples[i].Value = rate
+		previous = s
+	}
+	return report.MakeMetric(samples)
+}
+
 func (c *container) metrics() report.Metrics {
 	if c.numPending == 0 {
 		return report.Metrics{}
 	}
 	pendingStats := c.pendingStats[:c.numPending]
 	result := report.Metrics{
-		MemoryUsage:   c.memoryUsageMetric(pendingStats),
-		CPUTotalUsage: c.cpuPercentMetric(pendingStats),
+		MemoryUsage:    c.memoryUsageMetric(pendingStats),
+		CPUTotalUsage:  c.cpuPercentMetric(pendingStats),
+		BlkioReadRate:  c.blkioRateMetric(pendingStats, "read"),
+		BlkioWriteRate: c.blkioRateMetric(pendingStats, "write"),
 	}
 
 	// leave one stat to help with relative metrics
@@ -411,6 +538,18 @@ func (c *container) controlsMap() map[string]report.NodeControlData {
 		ExecContainer:    {Dead: !running},
 		StartContainer:   {Dead: !stopped},
 		RemoveContainer:  {Dead: !stopped},
+		BrowseFiles:      {Dead: false},
+		CapturePackets:   {Dead: !running},
+	}
+}
+
+// checkpointControls gives the checkpoint controls of a container node:
+// running containers can be checkpointed, and stopped ones restored.
+func checkpointControls(n report.Node) map[string]report.NodeControlData {
+	state, _ := n.Latest.Lookup(ContainerState)
+	return map[string]report.NodeControlData{
+		CheckpointContainer: {Dead: state != StateRunning},
+		RestoreContainer:    {Dead: state != StateExited && state != StateCreated},
 	}
 }
 
@@ -435,6 +574,13 @@ func (c *container) GetNode() report.Node {
 		latest[ContainerNetworkMode] = networkMode
 	}
 
+	if last := c.lastTermination; last != nil {
+		latest[ContainerExitCode] = strconv.Itoa(last.ExitCode)
+		latest[ContainerOOMKilled] = strconv.FormatBool(last.OOMKilled)
+		latest[ContainerTermination] = terminationReason(last)
+		latest[ContainerFinished] = last.FinishedAt.UTC().Format(time.RFC3339Nano)
+	}
+
 	result := c.baseNode.WithLatests(latest)
 	result = result.WithLatestControls(controls)
 	result = result.WithMetrics(c.metrics())
@@ -1,7 +1,10 @@
 package docker_test
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -9,6 +12,7 @@ import (
 	client "github.com/fsouza/go-dockerclient"
 
 	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/cgroup"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
@@ -68,6 +72,8 @@ func TestContainer(t *testing.T) {
 			docker.ExecContainer:    {Dead: false},
 			docker.StartContainer:   {Dead: true},
 			docker.RemoveContainer:  {Dead: true},
+			docker.BrowseFiles:      {Dead: false},
+			docker.CapturePackets:   {Dead: false},
 		}
 		want := report.MakeNodeWith("ping;<container>", map[string]string{
 			"docker_container_command":     "ping foo.bar.local",
@@ -84,8 +90,10 @@ func TestContainer(t *testing.T) {
 		}).WithLatestControls(
 			controls,
 		).WithMetrics(report.Metrics{
-			"docker_cpu_total_usage": report.MakeMetric(nil),
-			"docker_memory_usage":    report.MakeSingletonMetric(now, 12345).WithMax(45678),
+			"docker_cpu_total_usage":  report.MakeMetric(nil),
+			"docker_memory_usage":     report.MakeSingletonMetric(now, 12345).WithMax(45678),
+			"docker_blkio_read_rate":  report.MakeMetric(nil),
+			"docker_blkio_write_rate": report.MakeMetric(nil),
 		}).WithParents(report.MakeSets().
 			Add(report.ContainerImage, report.MakeStringSet(report.MakeContainerImageNodeID("baz"))),
 		)
@@ -130,6 +138,100 @@ func TestContainer(t *testing.T) {
 	}
 }
 
+func TestContainerBlkioRates(t *testing.T) {
+	now := time.Unix(12345, 67890).UTC()
+	c := docker.NewContainer(container1, "scope", false, false)
+	s := newMockStatsGatherer()
+	if err := c.StartGatheringStats(s); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopGatheringStats()
+
+	for i, bytes := range []uint64{1000, 3000} {
+		stats := &client.Stats{}
+		stats.Read = now.Add(time.Duration(i) * 2 * time.Second)
+		stats.BlkioStats.IOServiceBytesRecursive = []client.BlkioStatsEntry{
+			{Major: 8, Minor: 0, Op: "Read", Value: bytes},
+			{Major: 8, Minor: 16, Op: "Read", Value: bytes},
+			{Major: 8, Minor: 0, Op: "Write", Value: 500},
+			{Major: 8, Minor: 0, Op: "Total", Value: bytes + 500},
+		}
+		s.Send(stats)
+	}
+
+	want := map[string]float64{
+		docker.BlkioReadRate:  2000, // 2*2000 bytes in 2 seconds
+		docker.BlkioWriteRate: 0,
+	}
+	test.Poll(t, 100*time.Millisecond, want, func() interface{} {
+		have := map[string]float64{}
+		// Getting the node consumes the pending stats
+		metrics := c.GetNode().Metrics
+		for key := range want {
+			if sample, ok := metrics[key].LastSample(); ok {
+				have[key] = sample.Value
+			}
+		}
+		return have
+	})
+}
+
+func TestContainerCgroupStats(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	oldRoot, oldProcRoot := cgroup.Root, cgroup.ProcRoot
+	defer func() { cgroup.Root, cgroup.ProcRoot = oldRoot, oldProcRoot }()
+	cgroup.Root, cgroup.ProcRoot = filepath.Join(root, "sys/fs/cgroup"), filepath.Join(root, "proc")
+	for path, content := range map[string]string{
+		"proc/2/cgroup":                            "0::/docker/ping\n",
+		"proc/stat":                                "cpu  100 0 0 900 0 0 0 0 0 0\n",
+		"sys/fs/cgroup/cgroup.controllers":         "cpu io memory\n",
+		"sys/fs/cgroup/docker/ping/cpu.stat":       "usage_usec 1000\n",
+		"sys/fs/cgroup/docker/ping/memory.current": "8192\n",
+		"sys/fs/cgroup/docker/ping/memory.max":     "16384\n",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		stats func(*client.Stats)
+		want  report.Metric
+	}{
+		// Docker without support for the unified hierarchy gives no usage
+		{"from cgroups", func(*client.Stats) {}, report.MakeSingletonMetric(time.Unix(0, 0), 8192).WithMax(16384)},
+		{"from docker, less inactive page cache", func(s *client.Stats) {
+			s.CPUStats.CPUUsage.TotalUsage = 1
+			s.MemoryStats.Usage = 4096
+			s.MemoryStats.Limit = 65536
+			s.MemoryStats.Stats.InactiveFile = 1024
+			s.BlkioStats.IOServiceBytesRecursive = []client.BlkioStatsEntry{{Op: "read", Value: 1}}
+		}, report.MakeSingletonMetric(time.Unix(0, 0), 3072).WithMax(65536)},
+	} {
+		c := docker.NewContainer(container1, "scope", false, false)
+		s := newMockStatsGatherer()
+		if err := c.StartGatheringStats(s); err != nil {
+			t.Fatal(err)
+		}
+		stats := &client.Stats{Read: time.Unix(0, 0)}
+		tc.stats(stats)
+		s.Send(stats)
+		test.Poll(t, 100*time.Millisecond, tc.want, func() interface{} {
+			return c.GetNode().Metrics[docker.MemoryUsage]
+		})
+		c.StopGatheringStats()
+	}
+}
+
 func TestContainerHidingArgs(t *testing.T) {
 	const hostID = "scope"
 	c := docker.NewContainer(container1, hostID, true, false)
@@ -165,3 +267,65 @@ func TestContainerHidingBoth(t *testing.T) {
 		}
 	})
 }
+
+func TestContainerTermination(t *testing.T) {
+	finished := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	dead := *container1
+	dead.State = client.State{Status: "exited", ExitCode: 137, OOMKilled: true, FinishedAt: finished}
+	c := docker.NewContainer(&dead, "scope", false, false)
+
+	want := map[string]string{
+		docker.ContainerExitCode:    "137",
+		docker.ContainerOOMKilled:   "true",
+		docker.ContainerTermination: "OOMKilled",
+		docker.ContainerFinished:    "2017-01-01T00:00:00Z",
+	}
+	check := func() {
+		node := c.GetNode()
+		for key, value := range want {
+			if have, _ := node.Latest.Lookup(key); have != value {
+				t.Errorf("%s: want %q, have %q", key, value, have)
+			}
+		}
+	}
+	check()
+
+	// Docker resets how containers terminated once they start again
+	restarted := *container1
+	restarted.State = client.State{Status: "running", Running: true, Pid: 2, StartedAt: finished.Add(time.Second), FinishedAt: finished}
+	c.UpdateState(&restarted)
+	check()
+}
+
+func TestContainerIPv6(t *testing.T) {
+	dualStack := *container1
+	dualStack.NetworkSettings = &client.NetworkSettings{
+		IPAddress:         "1.2.3.4",
+		GlobalIPv6Address: "2001:db8:0:0::2",
+		Ports: map[client.Port][]client.PortBinding{
+			client.Port("80/tcp"): {
+				{HostIP: "0.0.0.0", HostPort: "8080"},
+				{HostIP: "::", HostPort: "8080"},
+			},
+			client.Port("443/tcp"): {
+				{HostIP: "2001:db8::1", HostPort: "8443"},
+			},
+		},
+		Networks: map[string]client.ContainerNetwork{
+			"network1": {IPAddress: "5.6.7.8", GlobalIPv6Address: "fd00::2"},
+		},
+	}
+	c := docker.NewContainer(&dualStack, "scope", false, false)
+
+	sets := c.NetworkInfo([]net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")})
+	if have, _ := sets.Lookup(docker.ContainerIPs); !reflect.DeepEqual(have, report.MakeStringSet("1.2.3.4", "2001:db8::2", "5.6.7.8", "fd00::2")) {
+		t.Errorf("Unexpected IPs %v", have)
+	}
+	if have, _ := sets.Lookup(docker.ContainerIPsWithScopes); !have.Contains(report.MakeAddressNodeID("scope", "2001:db8::2")) {
+		t.Errorf("Unexpected IPs with scopes %v", have)
+	}
+	want := report.MakeStringSet("10.0.0.1:8080->80/tcp", "[2001:db8::1]:8080->80/tcp", "[2001:db8::1]:8443->443/tcp")
+	if have, _ := sets.Lookup(docker.ContainerPorts); !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected ports %v, got %v", want, have)
+	}
+}
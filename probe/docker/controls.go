@@ -1,11 +1,18 @@
 package docker
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
 	docker_client "github.com/fsouza/go-dockerclient"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/common/mtime"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/capture"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
@@ -21,6 +28,16 @@ const (
 	AttachContainer  = "docker_attach_container"
 	ExecContainer    = "docker_exec_container"
 	ResizeExecTTY    = "docker_resize_exec_tty"
+	BrowseFiles      = "docker_browse_files"
+	CapturePackets   = "docker_capture_packets"
+
+	CheckpointContainer = "docker_checkpoint_container"
+	RestoreContainer    = "docker_restore_container"
+
+	// checkpointPrefix starts the names of the checkpoints made by Scope,
+	// which are followed by the time they are made at, so that the last
+	// one is restored by default.
+	checkpointPrefix = "scope-"
 
 	waitTime = 10
 )
@@ -30,6 +47,72 @@ func (r *registry) stopContainer(containerID string, _ xfer.Request) xfer.Respon
 	return xfer.ResponseError(r.client.StopContainer(containerID, waitTime))
 }
 
+// stopContainerDryRun tells what stopping a container does: whoever runs it
+// might start it again.
+func (r *registry) stopContainerDryRun(containerID string, req xfer.Request) xfer.Response {
+	c, ok := r.GetContainer(containerID)
+	if !ok {
+		return xfer.ResponseErrorf("Container not found: %s", containerID)
+	}
+	container := c.Container()
+	if !container.State.Running {
+		return xfer.ResponseErrorf("Container %s is not running", containerName(container))
+	}
+	effects := []string{fmt.Sprintf("Container %s will be stopped, and killed unless it exits within %ds", containerName(container), waitTime)}
+	effects = append(effects, recreatedBy(container)...)
+	if container.HostConfig != nil && container.HostConfig.RestartPolicy.Name == "always" {
+		effects = append(effects, "Docker will start it again when the daemon restarts, as its restart policy is always")
+	}
+	return controls.DryRunResponse(req, effects...)
+}
+
+// removeContainerDryRun tells what removing a container does: it can't be
+// done while the container runs, and loses all but its volumes.
+func (r *registry) removeContainerDryRun(containerID string, req xfer.Request) xfer.Response {
+	c, ok := r.GetContainer(containerID)
+	if !ok {
+		return xfer.ResponseErrorf("Container not found: %s", containerID)
+	}
+	container := c.Container()
+	if container.State.Running {
+		return xfer.ResponseErrorf("Container %s is running, and can't be removed until it is stopped", containerName(container))
+	}
+	effects := []string{fmt.Sprintf("Container %s will be removed, with the changes to its filesystem", containerName(container))}
+	if len(container.Mounts) > 0 {
+		volumes := make([]string, 0, len(container.Mounts))
+		for _, mount := range container.Mounts {
+			volumes = append(volumes, mount.Destination)
+		}
+		sort.Strings(volumes)
+		effects = append(effects, fmt.Sprintf("Its volumes (%s) will be kept", strings.Join(volumes, ", ")))
+	}
+	effects = append(effects, recreatedBy(container)...)
+	return controls.DryRunResponse(req, effects...)
+}
+
+// recreatedBy tells who replaces the containers they run when stopped or
+// removed.
+func recreatedBy(container *docker_client.Container) []string {
+	if container.Config == nil {
+		return nil
+	}
+	labels := container.Config.Labels
+	if pod, ok := labels["io.kubernetes.pod.name"]; ok {
+		return []string{fmt.Sprintf("Kubernetes will start it again, as a container of pod %s/%s", labels["io.kubernetes.pod.namespace"], pod)}
+	}
+	if service, ok := labels["com.docker.swarm.service.name"]; ok {
+		return []string{fmt.Sprintf("Docker swarm will replace it, as a task of service %s", service)}
+	}
+	return nil
+}
+
+func containerName(container *docker_client.Container) string {
+	if name := strings.TrimPrefix(container.Name, "/"); name != "" {
+		return name
+	}
+	return container.ID
+}
+
 func (r *registry) startContainer(containerID string, _ xfer.Request) xfer.Response {
 	log.Infof("Starting container %s", containerID)
 	return xfer.ResponseError(r.client.StartContainer(containerID, nil))
@@ -74,6 +157,7 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 		return xfer.ResponseError(err)
 	}
 	local, _ := pipe.Ends()
+	scrollback := controls.NewScrollback(local, controls.DefaultScrollbackSize)
 	cw, err := r.client.AttachToContainerNonBlocking(docker_client.AttachToContainerOptions{
 		Container:    containerID,
 		RawTerminal:  hasTTY,
@@ -82,8 +166,8 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 		Stdout:       true,
 		Stderr:       true,
 		InputStream:  local,
-		OutputStream: local,
-		ErrorStream:  local,
+		OutputStream: scrollback,
+		ErrorStream:  scrollback,
 	})
 	if err != nil {
 		pipe.Close()
@@ -95,6 +179,11 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 			return
 		}
 	})
+	var resize func(string, int, int) error
+	if hasTTY {
+		resize = r.client.ResizeContainerTTY
+	}
+	pipe.OnControl(pipeControlHandler(containerID, containerID, resize, scrollback))
 	go func() {
 		if err := cw.Wait(); err != nil {
 			log.Errorf("Error waiting on attachment to container %s: %v", containerID, err)
@@ -102,8 +191,9 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 		pipe.Close()
 	}()
 	return xfer.Response{
-		Pipe:   id,
-		RawTTY: hasTTY,
+		Pipe:         id,
+		RawTTY:       hasTTY,
+		PipeControls: true,
 	}
 }
 
@@ -126,12 +216,13 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 	}
 
 	local, _ := pipe.Ends()
+	scrollback := controls.NewScrollback(local, controls.DefaultScrollbackSize)
 	cw, err := r.client.StartExecNonBlocking(exec.ID, docker_client.StartExecOptions{
 		Tty:          true,
 		RawTerminal:  true,
 		InputStream:  local,
-		OutputStream: local,
-		ErrorStream:  local,
+		OutputStream: scrollback,
+		ErrorStream:  scrollback,
 	})
 	if err != nil {
 		pipe.Close()
@@ -151,6 +242,7 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 		delete(r.pipeIDToexecID, id)
 		r.Unlock()
 	})
+	pipe.OnControl(pipeControlHandler(containerID, exec.ID, r.client.ResizeExecTTY, scrollback))
 	go func() {
 		if err := cw.Wait(); err != nil {
 			log.Errorf("Error waiting on exec in container %s: %v", containerID, err)
@@ -161,6 +253,26 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 		Pipe:             id,
 		RawTTY:           true,
 		ResizeTTYControl: ResizeExecTTY,
+		PipeControls:     true,
+	}
+}
+
+// pipeControlHandler handles the controls sent on the pipe of an attachment
+// or exec, resizing the TTY of id if any, and replaying the scrollback.
+func pipeControlHandler(containerID, id string, resize func(string, int, int) error, scrollback *controls.Scrollback) func(xfer.PipeControl) {
+	return func(control xfer.PipeControl) {
+		var err error
+		switch control.Type {
+		case xfer.ResizePipeControl:
+			if resize != nil {
+				err = resize(id, int(control.Height), int(control.Width))
+			}
+		case xfer.ReplayPipeControl:
+			err = scrollback.Replay()
+		}
+		if err != nil {
+			log.Errorf("Error handling %s pipe control of container %s: %v", control.Type, containerID, err)
+		}
 	}
 }
 
@@ -182,6 +294,67 @@ func (r *registry) resizeExecTTY(pipeID string, height, width uint) xfer.Respons
 	return xfer.Response{}
 }
 
+// checkpointContainer checkpoints a container, under the name in its
+// checkpoint argument, if any. The container is stopped, unless its
+// leave_running argument is true.
+func (r *registry) checkpointContainer(containerID string, req xfer.Request) xfer.Response {
+	checkpoint, ok := req.ControlArgs["checkpoint"]
+	if !ok {
+		checkpoint = checkpointPrefix + mtime.Now().UTC().Format("20060102T150405Z")
+	}
+	leaveRunning := false
+	if arg, ok := req.ControlArgs["leave_running"]; ok {
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return xfer.ResponseErrorf("Invalid leave_running: %q", arg)
+		}
+		leaveRunning = b
+	}
+	log.Infof("Checkpointing container %s as %s", containerID, checkpoint)
+	return xfer.ResponseError(r.client.CreateCheckpoint(containerID, checkpoint, leaveRunning))
+}
+
+// restoreContainer starts a container from the checkpoint in its checkpoint
+// argument, or else from the last one made by Scope.
+func (r *registry) restoreContainer(containerID string, req xfer.Request) xfer.Response {
+	checkpoint, ok := req.ControlArgs["checkpoint"]
+	if !ok {
+		checkpoints, err := r.client.ListCheckpoints(containerID)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+		sort.Strings(checkpoints)
+		for _, name := range checkpoints {
+			if strings.HasPrefix(name, checkpointPrefix) {
+				checkpoint = name
+			}
+		}
+		if checkpoint == "" {
+			return xfer.ResponseErrorf("No checkpoints of container %s", containerID)
+		}
+	}
+	log.Infof("Restoring container %s from %s", containerID, checkpoint)
+	return xfer.ResponseError(r.client.RestoreCheckpoint(containerID, checkpoint))
+}
+
+// capturePackets captures the packets in the network namespace of a
+// container, as bounded by the arguments of the control.
+func (r *registry) capturePackets(containerID string, req xfer.Request) xfer.Response {
+	c, ok := r.GetContainer(containerID)
+	if !ok {
+		return xfer.ResponseErrorf("Not found: %s", containerID)
+	}
+	pid := c.PID()
+	if pid <= 0 {
+		return xfer.ResponseErrorf("Container %s is not running", containerID)
+	}
+	opts, err := capture.ParseOptions(req.ControlArgs)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return capture.Start(r.pipes, req.AppID, pid, opts)
+}
+
 func captureContainerID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
 	return func(req xfer.Request) xfer.Response {
 		containerID, ok := report.ParseContainerNodeID(req.NodeID)
@@ -203,6 +376,15 @@ func (r *registry) registerControls() {
 		AttachContainer:  captureContainerID(r.attachContainer),
 		ExecContainer:    captureContainerID(r.execContainer),
 		ResizeExecTTY:    xfer.ResizeTTYControlWrapper(r.resizeExecTTY),
+		BrowseFiles:      captureContainerID(r.browseFiles),
+		CapturePackets:   captureContainerID(r.capturePackets),
+
+		xfer.DryRunControl(StopContainer):   captureContainerID(r.stopContainerDryRun),
+		xfer.DryRunControl(RemoveContainer): captureContainerID(r.removeContainerDryRun),
+	}
+	if r.checkpoints {
+		controls[CheckpointContainer] = captureContainerID(r.checkpointContainer)
+		controls[RestoreContainer] = captureContainerID(r.restoreContainer)
 	}
 	r.handlerRegistry.Batch(nil, controls)
 }
@@ -218,6 +400,13 @@ func (r *registry) deregisterControls() {
 		AttachContainer,
 		ExecContainer,
 		ResizeExecTTY,
+		BrowseFiles,
+		CapturePackets,
+		xfer.DryRunControl(StopContainer),
+		xfer.DryRunControl(RemoveContainer),
+	}
+	if r.checkpoints {
+		controls = append(controls, CheckpointContainer, RestoreContainer)
 	}
 	r.handlerRegistry.Batch(controls, nil)
 }
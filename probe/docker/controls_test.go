@@ -1,8 +1,10 @@
 package docker_test
 
 import (
+	"encoding/json"
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,7 +27,8 @@ func TestControls(t *testing.T) {
 		defer registry.Stop()
 
 		for _, tc := range []struct{ command, result string }{
-			{docker.StopContainer, "stopped"},
+			// Stopping containers is only done once confirmed after its dry run
+			{docker.StopContainer, `Control "docker_stop_container" has to be confirmed after its dry run`},
 			{docker.StartContainer, "started"},
 			{docker.RestartContainer, "restarted"},
 			{docker.PauseContainer, "paused"},
@@ -44,6 +47,42 @@ func TestControls(t *testing.T) {
 	})
 }
 
+func TestCheckpointControls(t *testing.T) {
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		hr := controls.NewDefaultHandlerRegistry()
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:        10 * time.Second,
+			HandlerRegistry: hr,
+			Checkpoints:     true,
+		})
+		defer registry.Stop()
+
+		for _, tc := range []struct {
+			command string
+			args    map[string]string
+			result  string
+		}{
+			{docker.CheckpointContainer, map[string]string{"checkpoint": "foo"}, "checkpointed foo, leaving running: false"},
+			{docker.CheckpointContainer, map[string]string{"checkpoint": "foo", "leave_running": "true"}, "checkpointed foo, leaving running: true"},
+			{docker.CheckpointContainer, map[string]string{"leave_running": "maybe"}, `Invalid leave_running: "maybe"`},
+			{docker.RestoreContainer, map[string]string{"checkpoint": "other"}, "restored other"},
+			{docker.RestoreContainer, nil, "restored scope-20170602T000000Z"},
+		} {
+			result := hr.HandleControlRequest(xfer.Request{
+				Control:     tc.command,
+				NodeID:      report.MakeContainerNodeID("a1b2c3d4e5"),
+				ControlArgs: tc.args,
+			})
+			if !reflect.DeepEqual(result, xfer.Response{
+				Error: tc.result,
+			}) {
+				t.Error(result)
+			}
+		}
+	})
+}
+
 type mockPipe struct{}
 
 func (mockPipe) Ends() (io.ReadWriter, io.ReadWriter)                { return nil, nil }
@@ -51,6 +90,7 @@ func (mockPipe) CopyToWebsocket(io.ReadWriter, xfer.Websocket) error { return ni
 func (mockPipe) Close() error                                        { return nil }
 func (mockPipe) Closed() bool                                        { return false }
 func (mockPipe) OnClose(func())                                      {}
+func (mockPipe) OnControl(func(xfer.PipeControl))                    {}
 
 func TestPipes(t *testing.T) {
 	oldNewPipe := controls.NewPipe
@@ -80,8 +120,9 @@ func TestPipes(t *testing.T) {
 			{
 				control: docker.AttachContainer,
 				response: xfer.Response{
-					Pipe:   "pipeid",
-					RawTTY: true,
+					Pipe:         "pipeid",
+					RawTTY:       true,
+					PipeControls: true,
 				},
 			},
 
@@ -91,6 +132,7 @@ func TestPipes(t *testing.T) {
 					Pipe:             "pipeid",
 					RawTTY:           true,
 					ResizeTTYControl: docker.ResizeExecTTY,
+					PipeControls:     true,
 				},
 			},
 		} {
@@ -104,3 +146,126 @@ func TestPipes(t *testing.T) {
 		}
 	})
 }
+
+func TestBrowseFiles(t *testing.T) {
+	oldNewPipe := controls.NewPipe
+	defer func() { controls.NewPipe = oldNewPipe }()
+	pipe := xfer.NewPipe()
+	controls.NewPipe = func(_ controls.PipeClient, _ string) (string, xfer.Pipe, error) {
+		return "pipeid", pipe, nil
+	}
+
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		hr := controls.NewDefaultHandlerRegistry()
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:        10 * time.Second,
+			HandlerRegistry: hr,
+		})
+		defer registry.Stop()
+
+		result := hr.HandleControlRequest(xfer.Request{
+			Control: docker.BrowseFiles,
+			NodeID:  report.MakeContainerNodeID("ping"),
+		})
+		if want := (xfer.Response{Pipe: "pipeid"}); !reflect.DeepEqual(result, want) {
+			t.Fatal(commonTest.Diff(want, result))
+		}
+		defer pipe.Close()
+
+		_, remote := pipe.Ends()
+		encoder, decoder := json.NewEncoder(remote), json.NewDecoder(remote)
+		for _, tc := range []struct {
+			request docker.FileRequest
+			check   func(docker.FileResponse) bool
+		}{
+			{
+				docker.FileRequest{Op: docker.ListFiles, Path: "/var/log"},
+				func(resp docker.FileResponse) bool {
+					return len(resp.Files) == 2 && resp.Files[0].Name == "app.log" && resp.Files[1].Name == "nested" && resp.Files[1].Dir
+				},
+			},
+			{
+				docker.FileRequest{Op: docker.ListFiles, Path: "/var/log/app.log"},
+				func(resp docker.FileResponse) bool { return resp.Error == "Not a directory: /var/log/app.log" },
+			},
+			{
+				docker.FileRequest{Op: docker.StatFile, Path: "/var/log/app.log"},
+				func(resp docker.FileResponse) bool { return resp.File.Name == "app.log" && resp.File.Size == 6 },
+			},
+			{
+				docker.FileRequest{Op: docker.DownloadFile, Path: "/var/log/app.log"},
+				func(resp docker.FileResponse) bool { return string(resp.Data) == "xxxxxx" },
+			},
+			{
+				docker.FileRequest{Op: docker.DownloadFile, Path: "/var/log"},
+				func(resp docker.FileResponse) bool { return resp.Error == "Not a regular file: /var/log" },
+			},
+			{
+				docker.FileRequest{Op: docker.DownloadFile, Path: "/etc/passwd"},
+				func(resp docker.FileResponse) bool { return resp.Error == "no such file: /etc/passwd" },
+			},
+			{
+				docker.FileRequest{Op: docker.UploadFile, Path: "/tmp/foo", Data: []byte("hello")},
+				func(resp docker.FileResponse) bool { return resp.Error == "uploaded 5 bytes to foo in /tmp" },
+			},
+			{
+				docker.FileRequest{Op: docker.ListFiles, Path: "relative"},
+				func(resp docker.FileResponse) bool { return resp.Error == `Path must be absolute: "relative"` },
+			},
+		} {
+			if err := encoder.Encode(tc.request); err != nil {
+				t.Fatal(err)
+			}
+			var resp docker.FileResponse
+			if err := decoder.Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Op != tc.request.Op || resp.Path != tc.request.Path || !tc.check(resp) {
+				t.Errorf("%s %s: unexpected response %+v", tc.request.Op, tc.request.Path, resp)
+			}
+		}
+	})
+}
+
+func TestDryRunControls(t *testing.T) {
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		hr := controls.NewDefaultHandlerRegistry()
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:        10 * time.Second,
+			HandlerRegistry: hr,
+		})
+		defer registry.Stop()
+
+		test.Poll(t, 100*time.Millisecond, true, func() interface{} {
+			_, ok := registry.GetContainer("ping")
+			return ok
+		})
+
+		result := hr.HandleControlRequest(xfer.Request{
+			Control: xfer.DryRunControl(docker.StopContainer),
+			NodeID:  report.MakeContainerNodeID("ping"),
+		})
+		if result.DryRun == nil || len(result.DryRun.Effects) != 1 || !strings.HasPrefix(result.DryRun.Effects[0], "Container pong will be stopped") {
+			t.Fatalf("Expected the effects of stopping pong, got %+v", result)
+		}
+		result = hr.HandleControlRequest(xfer.Request{
+			Control:     docker.StopContainer,
+			NodeID:      report.MakeContainerNodeID("ping"),
+			ControlArgs: map[string]string{xfer.ConfirmationArg: result.DryRun.Confirmation},
+		})
+		if !reflect.DeepEqual(result, xfer.Response{Error: "stopped"}) {
+			t.Error(result)
+		}
+
+		// Running containers can't be removed
+		result = hr.HandleControlRequest(xfer.Request{
+			Control: xfer.DryRunControl(docker.RemoveContainer),
+			NodeID:  report.MakeContainerNodeID("ping"),
+		})
+		if result.Error != "Container pong is running, and can't be removed until it is stopped" {
+			t.Error(result)
+		}
+	})
+}
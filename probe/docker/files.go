@@ -0,0 +1,265 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	docker_client "github.com/fsouza/go-dockerclient"
+	"golang.org/x/net/context"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+// Operations of the file browser pipe.
+const (
+	ListFiles    = "list"
+	StatFile     = "stat"
+	DownloadFile = "download"
+	UploadFile   = "upload"
+)
+
+const (
+	// maxFileTransferSize is the size of the largest file which can be
+	// downloaded from, or uploaded to, a container.
+	maxFileTransferSize = 10 * 1024 * 1024
+
+	// maxListedFiles is how many files are listed in a directory, at most.
+	maxListedFiles = 1000
+)
+
+// FileRequest is a request on the file browser pipe, one per line of JSON.
+// Data holds the content of the file to upload.
+type FileRequest struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// FileResponse is the answer to a FileRequest, one per line of JSON.
+type FileResponse struct {
+	Op        string     `json:"op"`
+	Path      string     `json:"path"`
+	Error     string     `json:"error,omitempty"`
+	Files     []FileInfo `json:"files,omitempty"`
+	File      *FileInfo  `json:"file,omitempty"`
+	Data      []byte     `json:"data,omitempty"`
+	Truncated bool       `json:"truncated,omitempty"` // Set if there were more than maxListedFiles
+}
+
+// FileInfo describes a file in a container.
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	ModTime    time.Time `json:"mod_time"`
+	Dir        bool      `json:"dir,omitempty"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+func makeFileInfo(hdr *tar.Header) FileInfo {
+	info := hdr.FileInfo()
+	return FileInfo{
+		Name:       path.Base(strings.TrimSuffix(hdr.Name, "/")),
+		Size:       hdr.Size,
+		Mode:       info.Mode().String(),
+		ModTime:    hdr.ModTime.UTC(),
+		Dir:        info.IsDir(),
+		LinkTarget: hdr.Linkname,
+	}
+}
+
+// browseFiles opens a pipe over which the filesystem of a container can be
+// listed, and files downloaded from and uploaded to it, as docker cp does.
+func (r *registry) browseFiles(containerID string, req xfer.Request) xfer.Response {
+	id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	local, _ := pipe.Ends()
+	go func() {
+		defer pipe.Close()
+		r.serveFiles(containerID, local)
+	}()
+	return xfer.Response{
+		Pipe: id,
+	}
+}
+
+// serveFiles answers the FileRequests read from rw, until it is closed.
+func (r *registry) serveFiles(containerID string, rw io.ReadWriter) {
+	scanner := bufio.NewScanner(rw)
+	// Uploads are base64 encoded, in a single line.
+	scanner.Buffer(nil, maxFileTransferSize*4/3+4096)
+	encoder := json.NewEncoder(rw)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req FileRequest
+		var resp FileResponse
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp.Error = fmt.Sprintf("Invalid request: %v", err)
+		} else {
+			resp = r.fileRequest(containerID, req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && err != io.ErrClosedPipe {
+		log.Errorf("Error reading file requests for container %s: %v", containerID, err)
+	}
+}
+
+func (r *registry) fileRequest(containerID string, req FileRequest) FileResponse {
+	resp := FileResponse{Op: req.Op, Path: req.Path}
+	var err error
+	switch {
+	case !path.IsAbs(req.Path):
+		err = fmt.Errorf("Path must be absolute: %q", req.Path)
+	case req.Op == ListFiles:
+		resp.Files, resp.Truncated, err = r.listFiles(containerID, req.Path)
+	case req.Op == StatFile:
+		var info FileInfo
+		info, err = r.statFile(containerID, req.Path)
+		resp.File = &info
+	case req.Op == DownloadFile:
+		resp.Data, err = r.downloadFile(containerID, req.Path)
+	case req.Op == UploadFile:
+		log.Infof("Uploading %d bytes to %s in container %s", len(req.Data), req.Path, containerID)
+		err = r.uploadFile(containerID, req.Path, req.Data)
+	default:
+		err = fmt.Errorf("Unknown op: %q", req.Op)
+	}
+	if err != nil {
+		return FileResponse{Op: req.Op, Path: req.Path, Error: err.Error()}
+	}
+	return resp
+}
+
+// walkArchive calls f with the entries of the tar archive of a path in a
+// container, until it returns false. The archive is streamed, and the
+// download stopped once f is done.
+func (r *registry) walkArchive(containerID, filePath string, f func(*tar.Header, io.Reader) (bool, error)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	done := make(chan error, 1)
+	go func() {
+		err := r.client.DownloadFromContainer(containerID, docker_client.DownloadFromContainerOptions{
+			OutputStream: pw,
+			Path:         filePath,
+			Context:      ctx,
+		})
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	archive := tar.NewReader(pr)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			return <-done
+		} else if err != nil {
+			return err
+		}
+		if more, err := f(hdr, archive); err != nil || !more {
+			return err
+		}
+	}
+}
+
+func (r *registry) statFile(containerID, filePath string) (FileInfo, error) {
+	var info FileInfo
+	err := r.walkArchive(containerID, filePath, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+		info = makeFileInfo(hdr)
+		return false, nil
+	})
+	return info, err
+}
+
+// listFiles lists the files in a directory, which are the entries of the
+// archive one level below its first, the directory itself.
+func (r *registry) listFiles(containerID, dir string) ([]FileInfo, bool, error) {
+	var (
+		root      string
+		files     []FileInfo
+		truncated bool
+	)
+	err := r.walkArchive(containerID, dir, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if root == "" {
+			if hdr.Typeflag != tar.TypeDir {
+				return false, fmt.Errorf("Not a directory: %s", dir)
+			}
+			root = name + "/"
+			return true, nil
+		}
+		if !strings.HasPrefix(name, root) || strings.Contains(name[len(root):], "/") {
+			return true, nil
+		}
+		if len(files) == maxListedFiles {
+			truncated = true
+			return false, nil
+		}
+		files = append(files, makeFileInfo(hdr))
+		return true, nil
+	})
+	return files, truncated, err
+}
+
+func (r *registry) downloadFile(containerID, filePath string) ([]byte, error) {
+	var data []byte
+	err := r.walkArchive(containerID, filePath, func(hdr *tar.Header, content io.Reader) (bool, error) {
+		if !hdr.FileInfo().Mode().IsRegular() {
+			return false, fmt.Errorf("Not a regular file: %s", filePath)
+		}
+		if hdr.Size > maxFileTransferSize {
+			return false, fmt.Errorf("File too large to download (%d bytes, limit %d): %s", hdr.Size, maxFileTransferSize, filePath)
+		}
+		var err error
+		data, err = ioutil.ReadAll(content)
+		return false, err
+	})
+	return data, err
+}
+
+func (r *registry) uploadFile(containerID, filePath string, data []byte) error {
+	if len(data) > maxFileTransferSize {
+		return fmt.Errorf("File too large to upload (%d bytes, limit %d): %s", len(data), maxFileTransferSize, filePath)
+	}
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    path.Base(filePath),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: mtime.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := archive.Write(data); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return r.client.UploadToContainer(containerID, docker_client.UploadToContainerOptions{
+		InputStream: &buf,
+		Path:        path.Dir(filePath),
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/armon/go-radix"
 	docker_client "github.com/fsouza/go-dockerclient"
 
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
@@ -44,6 +45,12 @@ type Registry interface {
 	GetContainer(string) (Container, bool)
 	GetContainerByPrefix(string) (Container, bool)
 	GetContainerImage(string) (docker_client.APIImages, bool)
+	// CheckpointsEnabled is whether containers can be checkpointed and
+	// restored.
+	CheckpointsEnabled() bool
+	// CrashLooping is whether a container restarted too often lately, and
+	// how many times it did.
+	CrashLooping(containerID string) (int, bool)
 }
 
 // ContainerUpdateWatcher is the type of functions that get called when containers are updated.
@@ -60,6 +67,9 @@ type registry struct {
 	handlerRegistry        *controls.HandlerRegistry
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
+	checkpoints            bool
+	crashLoopRestarts      int
+	crashLoopWindow        time.Duration
 
 	watchers        []ContainerUpdateWatcher
 	containers      *radix.Tree
@@ -67,6 +77,14 @@ type registry struct {
 	images          map[string]docker_client.APIImages
 	networks        []docker_client.Network
 	pipeIDToexecID  map[string]string
+	restarts        map[string]*restartHistory
+}
+
+// restartHistory is when a container restarted, within the crash loop
+// window, as seen from its restart count going up.
+type restartHistory struct {
+	count int
+	times []time.Time
 }
 
 // Client interface for mocking.
@@ -89,13 +107,29 @@ type Client interface {
 	StartExecNonBlocking(string, docker_client.StartExecOptions) (docker_client.CloseWaiter, error)
 	Stats(docker_client.StatsOptions) error
 	ResizeExecTTY(id string, height, width int) error
+	ResizeContainerTTY(id string, height, width int) error
+	DownloadFromContainer(string, docker_client.DownloadFromContainerOptions) error
+	UploadToContainer(string, docker_client.UploadToContainerOptions) error
+
+	ListCheckpoints(containerID string) ([]string, error)
+	CreateCheckpoint(containerID, checkpoint string, leaveRunning bool) error
+	RestoreCheckpoint(containerID, checkpoint string) error
 }
 
 func newDockerClient(endpoint string) (Client, error) {
+	var (
+		client *docker_client.Client
+		err    error
+	)
 	if endpoint == "" {
-		return docker_client.NewClientFromEnv()
+		client, err = docker_client.NewClientFromEnv()
+	} else {
+		client, err = docker_client.NewClient(endpoint)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return docker_client.NewClient(endpoint)
+	return newCheckpointingClient(client)
 }
 
 // RegistryOptions are used to initialize the Registry
@@ -108,6 +142,13 @@ type RegistryOptions struct {
 	DockerEndpoint         string
 	NoCommandLineArguments bool
 	NoEnvironmentVariables bool
+	// Checkpoints enables the experimental controls to checkpoint and
+	// restore containers with CRIU.
+	Checkpoints bool
+	// Containers restarting CrashLoopRestarts times within CrashLoopWindow
+	// are crash looping; 0 restarts never are.
+	CrashLoopRestarts int
+	CrashLoopWindow   time.Duration
 }
 
 // NewRegistry returns a usable Registry. Don't forget to Stop it.
@@ -122,6 +163,7 @@ func NewRegistry(options RegistryOptions) (Registry, error) {
 		containersByPID: map[int]Container{},
 		images:          map[string]docker_client.APIImages{},
 		pipeIDToexecID:  map[string]string{},
+		restarts:        map[string]*restartHistory{},
 
 		client:          client,
 		pipes:           options.Pipes,
@@ -132,6 +174,9 @@ func NewRegistry(options RegistryOptions) (Registry, error) {
 		quit:            make(chan chan struct{}),
 		noCommandLineArguments: options.NoCommandLineArguments,
 		noEnvironmentVariables: options.NoEnvironmentVariables,
+		checkpoints:            options.Checkpoints,
+		crashLoopRestarts:      options.CrashLoopRestarts,
+		crashLoopWindow:        options.CrashLoopWindow,
 	}
 
 	r.registerControls()
@@ -139,6 +184,51 @@ func NewRegistry(options RegistryOptions) (Registry, error) {
 	return r, nil
 }
 
+// CheckpointsEnabled implements Registry
+func (r *registry) CheckpointsEnabled() bool {
+	return r.checkpoints
+}
+
+// CrashLooping implements Registry
+func (r *registry) CrashLooping(containerID string) (int, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	h, ok := r.restarts[containerID]
+	if !ok || r.crashLoopRestarts <= 0 {
+		return 0, false
+	}
+	since := mtime.Now().Add(-r.crashLoopWindow)
+	restarts := 0
+	for _, t := range h.times {
+		if t.After(since) {
+			restarts++
+		}
+	}
+	return restarts, restarts >= r.crashLoopRestarts
+}
+
+// trackRestarts notes the restarts of a container since it was last seen,
+// forgetting those out of the crash loop window. Restarts before a container
+// is first seen have no times, so don't count.
+func (r *registry) trackRestarts(containerID string, count int) {
+	if r.crashLoopRestarts <= 0 {
+		return
+	}
+	h, ok := r.restarts[containerID]
+	if !ok {
+		r.restarts[containerID] = &restartHistory{count: count}
+		return
+	}
+	now := mtime.Now()
+	for ; h.count < count; h.count++ {
+		h.times = append(h.times, now)
+	}
+	since := now.Add(-r.crashLoopWindow)
+	for len(h.times) > 0 && !h.times[0].After(since) {
+		h.times = h.times[1:]
+	}
+}
+
 // Stop stops the Docker registry's event subscriber.
 func (r *registry) Stop() {
 	r.deregisterControls()
@@ -337,6 +427,7 @@ func (r *registry) updateContainerState(containerID string, intendedState *strin
 
 		r.containers.Delete(containerID)
 		delete(r.containersByPID, container.PID())
+		delete(r.restarts, containerID)
 		if r.collectStats {
 			container.StopGatheringStats()
 		}
@@ -367,6 +458,8 @@ func (r *registry) updateContainerState(containerID string, intendedState *strin
 		c.UpdateState(dockerContainer)
 	}
 
+	r.trackRestarts(containerID, dockerContainer.RestartCount)
+
 	// Update PID index
 	if c.PID() > 1 {
 		r.containersByPID[c.PID()] = c
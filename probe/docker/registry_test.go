@@ -1,6 +1,8 @@
 package docker_test
 
 import (
+	"archive/tar"
+	"bytes"
 	"fmt"
 	"net"
 	"runtime"
@@ -176,6 +178,22 @@ func (m *mockDockerClient) ResizeExecTTY(id string, height, width int) error {
 	return fmt.Errorf("resizeExecTTY")
 }
 
+func (m *mockDockerClient) ResizeContainerTTY(id string, height, width int) error {
+	return fmt.Errorf("resizeContainerTTY")
+}
+
+func (m *mockDockerClient) ListCheckpoints(_ string) ([]string, error) {
+	return []string{"scope-20170602T000000Z", "other", "scope-20170601T000000Z"}, nil
+}
+
+func (m *mockDockerClient) CreateCheckpoint(_, checkpoint string, leaveRunning bool) error {
+	return fmt.Errorf("checkpointed %s, leaving running: %t", checkpoint, leaveRunning)
+}
+
+func (m *mockDockerClient) RestoreCheckpoint(_, checkpoint string) error {
+	return fmt.Errorf("restored %s", checkpoint)
+}
+
 type mockCloseWaiter struct{}
 
 func (mockCloseWaiter) Close() error { return nil }
@@ -193,6 +211,46 @@ func (m *mockDockerClient) StartExecNonBlocking(string, client.StartExecOptions)
 	return mockCloseWaiter{}, nil
 }
 
+// mockArchives are the tar archives DownloadFromContainer gives, of a
+// /var/log directory holding app.log and nested/deep.log.
+var mockArchives = map[string][]tar.Header{
+	"/var/log": {
+		{Name: "log/", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "log/app.log", Mode: 0644, Size: 6, Typeflag: tar.TypeReg},
+		{Name: "log/nested/", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "log/nested/deep.log", Mode: 0644, Size: 6, Typeflag: tar.TypeReg},
+	},
+	"/var/log/app.log": {
+		{Name: "app.log", Mode: 0644, Size: 6, Typeflag: tar.TypeReg},
+	},
+}
+
+func (m *mockDockerClient) DownloadFromContainer(_ string, opts client.DownloadFromContainerOptions) error {
+	hdrs, ok := mockArchives[opts.Path]
+	if !ok {
+		return fmt.Errorf("no such file: %s", opts.Path)
+	}
+	archive := tar.NewWriter(opts.OutputStream)
+	for i := range hdrs {
+		if err := archive.WriteHeader(&hdrs[i]); err != nil {
+			return err
+		}
+		if _, err := archive.Write(bytes.Repeat([]byte("x"), int(hdrs[i].Size))); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (m *mockDockerClient) UploadToContainer(_ string, opts client.UploadToContainerOptions) error {
+	archive := tar.NewReader(opts.InputStream)
+	hdr, err := archive.Next()
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("uploaded %d bytes to %s in %s", hdr.Size, hdr.Name, opts.Path)
+}
+
 func (m *mockDockerClient) send(event *client.APIEvents) {
 	m.RLock()
 	defer m.RUnlock()
@@ -530,3 +588,47 @@ func TestDockerImageName(t *testing.T) {
 		}
 	}
 }
+
+func TestRegistryCrashLoop(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:          10 * time.Second,
+			HandlerRegistry:   controls.NewDefaultHandlerRegistry(),
+			CrashLoopRestarts: 2,
+			CrashLoopWindow:   10 * time.Minute,
+		})
+		defer registry.Stop()
+		test.Poll(t, 100*time.Millisecond, []docker.Container{&mockContainer{container1}}, func() interface{} {
+			return allContainers(registry)
+		})
+
+		restart := func(count int) {
+			c := *container1
+			c.RestartCount = count
+			mdc.Lock()
+			mdc.containers["ping"] = &c
+			mdc.Unlock()
+			mdc.send(&client.APIEvents{Status: docker.StartEvent, ID: "ping"})
+		}
+		check := func(restarts int, crashLooping bool) {
+			test.Poll(t, 100*time.Millisecond, []interface{}{restarts, crashLooping}, func() interface{} {
+				restarts, crashLooping := registry.CrashLooping("ping")
+				return []interface{}{restarts, crashLooping}
+			})
+		}
+
+		restart(1)
+		check(1, false)
+		restart(3)
+		check(3, true)
+
+		// Restarts out of the window don't count
+		mtime.NowForce(now.Add(11 * time.Minute))
+		check(0, false)
+	})
+}
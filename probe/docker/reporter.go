@@ -1,8 +1,10 @@
 package docker
 
 import (
+	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	humanize "github.com/dustin/go-humanize"
 	docker_client "github.com/fsouza/go-dockerclient"
@@ -14,16 +16,46 @@ import (
 
 // Keys for use in Node
 const (
-	ImageID          = "docker_image_id"
-	ImageName        = "docker_image_name"
-	ImageSize        = "docker_image_size"
-	ImageVirtualSize = "docker_image_virtual_size"
-	ImageLabelPrefix = "docker_image_label_"
-	IsInHostNetwork  = "docker_is_in_host_network"
-	ImageTableID     = "image_table"
-	ServiceName      = "service_name"
-	StackNamespace   = "stack_namespace"
-	DefaultNamespace = "No Stack"
+	ImageID                = "docker_image_id"
+	ImageName              = "docker_image_name"
+	ImageDigest            = "docker_image_digest"
+	ImageCreated           = "docker_image_created"
+	ImageSize              = "docker_image_size"
+	ImageVirtualSize       = "docker_image_virtual_size"
+	ImageLabelPrefix       = "docker_image_label_"
+	IsInHostNetwork        = "docker_is_in_host_network"
+	ImageTableID           = "image_table"
+	ServiceName            = "service_name"
+	ServiceMode            = "service_mode"
+	ServiceImage           = "service_image"
+	ServiceDesiredReplicas = "service_desired_replicas"
+	ServiceRunningReplicas = "service_running_replicas"
+	ServiceCreated         = "service_created"
+	StackNamespace         = "stack_namespace"
+	DefaultNamespace       = "No Stack"
+)
+
+// Templates shared by the containers of other runtimes (containerd, CRI,
+// podman), which are reported with the docker keys they have in common.
+var (
+	// RuntimeContainerMetadataTemplates are the metadata all runtimes have
+	// of containers, which they merge their own into.
+	RuntimeContainerMetadataTemplates = report.MetadataTemplates{
+		ImageName:           {ID: ImageName, Label: "Image", From: report.FromLatest, Priority: 1},
+		ContainerStateHuman: {ID: ContainerStateHuman, Label: "State", From: report.FromLatest, Priority: 3},
+		ContainerCreated:    {ID: ContainerCreated, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 9},
+		ContainerID:         {ID: ContainerID, Label: "ID", From: report.FromLatest, Truncate: 12, Priority: 10},
+	}
+
+	// RuntimeContainerTableTemplates show the labels of containers.
+	RuntimeContainerTableTemplates = report.TableTemplates{
+		LabelPrefix: {
+			ID:     LabelPrefix,
+			Label:  "Labels",
+			Type:   report.PropertyListType,
+			Prefix: LabelPrefix,
+		},
+	}
 )
 
 // Exposed for testing
@@ -39,15 +71,22 @@ var (
 		ContainerPorts:        {ID: ContainerPorts, Label: "Ports", From: report.FromSets, Priority: 8},
 		ContainerCreated:      {ID: ContainerCreated, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 9},
 		ContainerID:           {ID: ContainerID, Label: "ID", From: report.FromLatest, Truncate: 12, Priority: 10},
+		ContainerGPUs:         {ID: ContainerGPUs, Label: "GPUs", From: report.FromLatest, Priority: 11},
+		ContainerExitCode:     {ID: ContainerExitCode, Label: "Last Exit Code", From: report.FromLatest, Datatype: "number", Priority: 12},
+		ContainerTermination:  {ID: ContainerTermination, Label: "Last Termination", From: report.FromLatest, Priority: 13},
+		ContainerFinished:     {ID: ContainerFinished, Label: "Last Finished", From: report.FromLatest, Datatype: "datetime", Priority: 14},
 	}
 
 	ContainerMetricTemplates = report.MetricTemplates{
-		CPUTotalUsage: {ID: CPUTotalUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
-		MemoryUsage:   {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		CPUTotalUsage:  {ID: CPUTotalUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage:    {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		BlkioReadRate:  {ID: BlkioReadRate, Label: "Disk Read", Format: report.FilesizeRateFormat, Priority: 3},
+		BlkioWriteRate: {ID: BlkioWriteRate, Label: "Disk Write", Format: report.FilesizeRateFormat, Priority: 4},
 	}
 
 	ContainerImageMetadataTemplates = report.MetadataTemplates{
 		report.Container: {ID: report.Container, Label: "# Containers", From: report.FromCounters, Datatype: "number", Priority: 2},
+		ImageCreated:     {ID: ImageCreated, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 3},
 	}
 
 	ContainerTableTemplates = report.TableTemplates{
@@ -123,22 +162,60 @@ var (
 			Rank:  6,
 		},
 		{
-			ID:    StopContainer,
-			Human: "Stop",
-			Icon:  "fa-stop",
-			Rank:  7,
+			ID:     StopContainer,
+			Human:  "Stop",
+			Icon:   "fa-stop",
+			Rank:   7,
+			DryRun: true,
+		},
+		{
+			ID:     RemoveContainer,
+			Human:  "Remove",
+			Icon:   "fa-trash-o",
+			Rank:   8,
+			DryRun: true,
+		},
+		{
+			ID:    BrowseFiles,
+			Human: "Browse files",
+			Icon:  "fa-folder-open-o",
+			Rank:  9,
+		},
+		{
+			ID:    CapturePackets,
+			Human: "Capture packets",
+			Icon:  "fa-download",
+			Rank:  10,
+		},
+	}
+
+	CheckpointControls = []report.Control{
+		{
+			ID:    CheckpointContainer,
+			Human: "Checkpoint",
+			Icon:  "fa-floppy-o",
+			Rank:  11,
 		},
 		{
-			ID:    RemoveContainer,
-			Human: "Remove",
-			Icon:  "fa-trash-o",
-			Rank:  8,
+			ID:    RestoreContainer,
+			Human: "Restore from checkpoint",
+			Icon:  "fa-history",
+			Rank:  12,
 		},
 	}
 
 	SwarmServiceMetadataTemplates = report.MetadataTemplates{
-		ServiceName:    {ID: ServiceName, Label: "Service Name", From: report.FromLatest, Priority: 0},
-		StackNamespace: {ID: StackNamespace, Label: "Stack Namespace", From: report.FromLatest, Priority: 1},
+		ServiceName:            {ID: ServiceName, Label: "Service Name", From: report.FromLatest, Priority: 0},
+		StackNamespace:         {ID: StackNamespace, Label: "Stack Namespace", From: report.FromLatest, Priority: 1},
+		ServiceMode:            {ID: ServiceMode, Label: "Mode", From: report.FromLatest, Priority: 2},
+		ServiceImage:           {ID: ServiceImage, Label: "Image", From: report.FromLatest, Priority: 3},
+		ServiceDesiredReplicas: {ID: ServiceDesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Datatype: "number", Priority: 4},
+		ServiceRunningReplicas: {ID: ServiceRunningReplicas, Label: "Running Replicas", From: report.FromLatest, Datatype: "number", Priority: 5},
+		ServiceCreated:         {ID: ServiceCreated, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 6},
+	}
+
+	SwarmStackMetadataTemplates = report.MetadataTemplates{
+		report.SwarmService: {ID: report.SwarmService, Label: "# Services", From: report.FromCounters, Datatype: "number", Priority: 1},
 	}
 )
 
@@ -186,6 +263,7 @@ func (r *Reporter) Report() (report.Report, error) {
 	result.ContainerImage = result.ContainerImage.Merge(r.containerImageTopology())
 	result.Overlay = result.Overlay.Merge(r.overlayTopology())
 	result.SwarmService = result.SwarmService.Merge(r.swarmServiceTopology())
+	result.NetIface = result.NetIface.Merge(r.netIfaceTopology())
 	return result, nil
 }
 
@@ -207,11 +285,30 @@ func (r *Reporter) containerTopology(localAddrs []net.IP) report.Topology {
 		WithMetricTemplates(ContainerMetricTemplates).
 		WithTableTemplates(ContainerTableTemplates)
 	result.Controls.AddControls(ContainerControls)
+	checkpoints := r.registry.CheckpointsEnabled()
+	if checkpoints {
+		result.Controls.AddControls(CheckpointControls)
+	}
 
 	metadata := map[string]string{report.ControlProbeID: r.probeID}
 	nodes := []report.Node{}
 	r.registry.WalkContainers(func(c Container) {
-		nodes = append(nodes, c.GetNode().WithLatests(metadata))
+		node := c.GetNode().WithLatests(metadata)
+		if checkpoints {
+			node = node.WithLatestControls(checkpointControls(node))
+		}
+		if restarts, ok := r.registry.CrashLooping(c.ID()); ok {
+			node = node.WithLatests(map[string]string{
+				ContainerCrashLooping: "true",
+				ContainerStateHuman:   fmt.Sprintf("Crash looping, restarted %d times lately", restarts),
+			})
+		}
+		if pid := c.PID(); pid > 0 {
+			if gpus := host.GetGPUDevices(pid); len(gpus) > 0 {
+				node = node.WithLatests(map[string]string{ContainerGPUs: strings.Join(gpus, ", ")})
+			}
+		}
+		nodes = append(nodes, node)
 	})
 
 	// Copy the IP addresses from other containers where they share network
@@ -280,6 +377,12 @@ func (r *Reporter) containerImageTopology() report.Topology {
 		if len(image.RepoTags) > 0 {
 			latests[ImageName] = image.RepoTags[0]
 		}
+		if len(image.RepoDigests) > 0 {
+			latests[ImageDigest] = image.RepoDigests[0]
+		}
+		if image.Created > 0 {
+			latests[ImageCreated] = time.Unix(image.Created, 0).UTC().Format(time.RFC3339)
+		}
 		nodeID := report.MakeContainerImageNodeID(imageID)
 		node := report.MakeNodeWith(nodeID, latests)
 		node = node.AddPrefixPropertyList(ImageLabelPrefix, image.Labels)
@@ -308,6 +411,27 @@ func (r *Reporter) swarmServiceTopology() report.Topology {
 	return report.MakeTopology().WithMetadataTemplates(SwarmServiceMetadataTemplates)
 }
 
+// netIfaceTopology makes the interfaces of the host which are the peers of
+// veths of containers adjacent to them. The rest of their details is reported
+// by the host.
+func (r *Reporter) netIfaceTopology() report.Topology {
+	result := report.MakeTopology()
+	r.registry.WalkContainers(func(c Container) {
+		pid := c.PID()
+		if pid <= 0 {
+			return
+		}
+		if networkMode, ok := c.NetworkMode(); ok && (networkMode == NetworkModeHost || strings.HasPrefix(networkMode, "container:")) {
+			return
+		}
+		containerNodeID := report.MakeContainerNodeID(c.ID())
+		for _, peer := range host.GetVethPeers(pid) {
+			result.AddNode(report.MakeNode(report.MakeNetIfaceNodeID(r.hostID, peer)).WithAdjacent(containerNodeID))
+		}
+	})
+	return result
+}
+
 // Docker sometimes prefixes ids with a "type" annotation, but it renders a bit
 // ugly and isn't necessary, so we should strip it off
 func trimImageID(id string) string {
@@ -48,6 +48,10 @@ func (r *mockRegistry) GetContainer(_ string) (docker.Container, bool) { return
 
 func (r *mockRegistry) GetContainerByPrefix(_ string) (docker.Container, bool) { return nil, false }
 
+func (r *mockRegistry) CheckpointsEnabled() bool { return false }
+
+func (r *mockRegistry) CrashLooping(_ string) (int, bool) { return 0, false }
+
 func (r *mockRegistry) GetContainerImage(id string) (client.APIImages, bool) {
 	image, ok := r.images[id]
 	return image, ok
@@ -72,6 +76,15 @@ func TestReporter(t *testing.T) {
 		hostID         = "host1"
 	)
 
+	oldGetVethPeers := host.GetVethPeers
+	defer func() { host.GetVethPeers = oldGetVethPeers }()
+	host.GetVethPeers = func(pid int) []string {
+		if pid != 2 {
+			return nil
+		}
+		return []string{"veth1234"}
+	}
+
 	containerImageNodeID := report.MakeContainerImageNodeID(imageID)
 	rpt, err := docker.NewReporter(mockRegistryInstance, "host1", controlProbeID, nil).Report()
 	if err != nil {
@@ -146,4 +159,16 @@ func TestReporter(t *testing.T) {
 		}
 
 	}
+
+	// Reporter should make the peer of the container's veth adjacent to it
+	{
+		netIfaceNodeID := report.MakeNetIfaceNodeID(hostID, "veth1234")
+		node, ok := rpt.NetIface.Nodes[netIfaceNodeID]
+		if !ok {
+			t.Fatalf("Expected report to have interface %q, but not found", netIfaceNodeID)
+		}
+		if containerNodeID := report.MakeContainerNodeID("ping"); !node.Adjacency.Contains(containerNodeID) {
+			t.Errorf("Expected interface to be adjacent to %q, got %v", containerNodeID, node.Adjacency)
+		}
+	}
 }
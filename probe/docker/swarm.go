@@ -0,0 +1,352 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the Swarm integration.
+const (
+	SwarmScaleUp   = "docker_swarm_scale_up"
+	SwarmScaleDown = "docker_swarm_scale_down"
+)
+
+// Values of ServiceMode
+const (
+	ServiceModeReplicated = "replicated"
+	ServiceModeGlobal     = "global"
+)
+
+const (
+	stackNamespaceLabel = "com.docker.stack.namespace"
+	// Swarm API version we speak; it is the first one with services.
+	swarmAPIVersion    = "v1.24"
+	swarmClientTimeout = 10 * time.Second
+	defaultDockerHost  = "unix:///var/run/docker.sock"
+)
+
+// SwarmScalingControls are the controls of replicated Swarm services.
+var SwarmScalingControls = []report.Control{
+	{
+		ID:    SwarmScaleDown,
+		Human: "Scale Down",
+		Icon:  "fa-minus",
+		Rank:  0,
+	},
+	{
+		ID:    SwarmScaleUp,
+		Human: "Scale Up",
+		Icon:  "fa-plus",
+		Rank:  1,
+	},
+}
+
+// swarmServiceNode makes the node of a Swarm service. Services deployed in
+// a stack are named after it; their name is given without that prefix.
+func swarmServiceNode(id, name, stackNamespace string) report.Node {
+	if stackNamespace == "" {
+		return report.MakeNodeWith(id, map[string]string{
+			ServiceName:    name,
+			StackNamespace: DefaultNamespace,
+		})
+	}
+	return report.MakeNodeWith(id, map[string]string{
+		ServiceName:    strings.TrimPrefix(name, stackNamespace+"_"),
+		StackNamespace: stackNamespace,
+	}).WithParents(report.MakeSets().
+		Add(report.SwarmStack, report.MakeStringSet(report.MakeSwarmStackNodeID(stackNamespace))),
+	)
+}
+
+func swarmStackNode(stackNamespace string) report.Node {
+	return report.MakeNodeWith(report.MakeSwarmStackNodeID(stackNamespace), map[string]string{
+		StackNamespace: stackNamespace,
+	})
+}
+
+// SwarmService is a Swarm service, as listed by the engine API. Only what is
+// reported is decoded.
+type SwarmService struct {
+	ID        string
+	CreatedAt time.Time
+	Spec      struct {
+		Name         string
+		Labels       map[string]string
+		TaskTemplate struct {
+			ContainerSpec struct {
+				Image string
+			}
+		}
+		Mode struct {
+			Replicated *struct {
+				Replicas *uint64
+			}
+			Global *struct{}
+		}
+	}
+}
+
+// SwarmTask is a task of a Swarm service, as listed by the engine API.
+type SwarmTask struct {
+	ID           string
+	ServiceID    string
+	DesiredState string
+	Status       struct {
+		State string
+	}
+}
+
+// SwarmClient talks to the Swarm API of a Docker engine. Exposed for testing.
+type SwarmClient interface {
+	// ListServices and ListTasks give nothing if the engine isn't a manager
+	// of a swarm, as only managers serve the Swarm API.
+	ListServices() ([]SwarmService, error)
+	ListTasks() ([]SwarmTask, error)
+	ScaleService(id string, delta int) error
+}
+
+type swarmClient struct {
+	base string
+	http *http.Client
+}
+
+// NewSwarmClient makes a SwarmClient of the engine at endpoint, which is a
+// unix:// or tcp:// address. An empty endpoint is $DOCKER_HOST, or the
+// default socket.
+func NewSwarmClient(endpoint string) (SwarmClient, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("DOCKER_HOST")
+	}
+	if endpoint == "" {
+		endpoint = defaultDockerHost
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c := &swarmClient{http: &http.Client{Timeout: swarmClientTimeout}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		c.base = "http://docker"
+		c.http.Transport = &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		}
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("Invalid Docker endpoint '%s'", endpoint)
+	}
+	return c, nil
+}
+
+// errNotManager is returned by the engine when it isn't a swarm manager.
+var errNotManager = fmt.Errorf("not a swarm manager")
+
+func (c *swarmClient) do(method, path string, query url.Values, body, result interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.base+"/"+swarmAPIVersion+path+"?"+query.Encode(), &reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		return errNotManager
+	case resp.StatusCode >= 300:
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("docker returned %s", resp.Status)
+		}
+		return fmt.Errorf("docker returned %s: %s", resp.Status, apiErr.Message)
+	case result != nil:
+		decoder := json.NewDecoder(resp.Body)
+		decoder.UseNumber()
+		return decoder.Decode(result)
+	}
+	return nil
+}
+
+func (c *swarmClient) ListServices() ([]SwarmService, error) {
+	var services []SwarmService
+	err := c.do("GET", "/services", nil, nil, &services)
+	if err == errNotManager {
+		return nil, nil
+	}
+	return services, err
+}
+
+func (c *swarmClient) ListTasks() ([]SwarmTask, error) {
+	var tasks []SwarmTask
+	err := c.do("GET", "/tasks", nil, nil, &tasks)
+	if err == errNotManager {
+		return nil, nil
+	}
+	return tasks, err
+}
+
+// ScaleService changes the replicas of a replicated service by delta. The
+// spec is updated as a generic document, so fields of newer engines survive.
+func (c *swarmClient) ScaleService(id string, delta int) error {
+	var service struct {
+		Version struct {
+			Index uint64
+		}
+		Spec map[string]interface{}
+	}
+	if err := c.do("GET", "/services/"+url.PathEscape(id), nil, nil, &service); err != nil {
+		return err
+	}
+	mode, _ := service.Spec["Mode"].(map[string]interface{})
+	replicated, ok := mode["Replicated"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Service %s isn't replicated", id)
+	}
+	var replicas int64
+	if n, ok := replicated["Replicas"].(json.Number); ok {
+		var err error
+		if replicas, err = n.Int64(); err != nil {
+			return err
+		}
+	}
+	if replicas += int64(delta); replicas < 0 {
+		replicas = 0
+	}
+	replicated["Replicas"] = replicas
+	query := url.Values{"version": {strconv.FormatUint(service.Version.Index, 10)}}
+	return c.do("POST", "/services/"+url.PathEscape(id)+"/update", query, service.Spec, nil)
+}
+
+// SwarmReporter generates Reports containing the SwarmService and SwarmStack
+// topologies of the swarm the engine is a manager of, with controls to scale
+// replicated services.
+type SwarmReporter struct {
+	client          SwarmClient
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
+}
+
+// NewSwarmReporter makes a new SwarmReporter. Don't forget to Stop it.
+func NewSwarmReporter(client SwarmClient, probeID string, handlerRegistry *controls.HandlerRegistry) *SwarmReporter {
+	r := &SwarmReporter{
+		client:          client,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+	}
+	handlerRegistry.Batch(nil, map[string]xfer.ControlHandlerFunc{
+		SwarmScaleUp:   r.captureService(1),
+		SwarmScaleDown: r.captureService(-1),
+	})
+	return r
+}
+
+// Name of this reporter, for metrics gathering
+func (*SwarmReporter) Name() string { return "Swarm" }
+
+// Stop unregisters controls.
+func (r *SwarmReporter) Stop() {
+	r.handlerRegistry.Batch([]string{
+		SwarmScaleUp,
+		SwarmScaleDown,
+	}, nil)
+}
+
+func (r *SwarmReporter) captureService(delta int) xfer.ControlHandlerFunc {
+	return func(req xfer.Request) xfer.Response {
+		serviceID, ok := report.ParseSwarmServiceNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		log.Infof("Scaling Swarm service %s by %d", serviceID, delta)
+		return xfer.ResponseError(r.client.ScaleService(serviceID, delta))
+	}
+}
+
+// Report generates a Report containing the SwarmService and SwarmStack
+// topologies. It is empty unless the engine is a swarm manager.
+func (r *SwarmReporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.SwarmService = result.SwarmService.WithMetadataTemplates(SwarmServiceMetadataTemplates)
+	result.SwarmService.Controls.AddControls(SwarmScalingControls)
+	result.SwarmStack = result.SwarmStack.WithMetadataTemplates(SwarmStackMetadataTemplates)
+
+	services, err := r.client.ListServices()
+	if err != nil {
+		return result, err
+	}
+	if len(services) == 0 {
+		return result, nil
+	}
+	tasks, err := r.client.ListTasks()
+	if err != nil {
+		return result, err
+	}
+	running := map[string]int{}
+	for _, t := range tasks {
+		if t.Status.State == "running" && t.DesiredState == "running" {
+			running[t.ServiceID]++
+		}
+	}
+
+	for _, s := range services {
+		stackNamespace := s.Spec.Labels[stackNamespaceLabel]
+		node := swarmServiceNode(report.MakeSwarmServiceNodeID(s.ID), s.Spec.Name, stackNamespace).
+			WithLatests(map[string]string{
+				ServiceImage:           strings.SplitN(s.Spec.TaskTemplate.ContainerSpec.Image, "@", 2)[0], // without the digest
+				ServiceRunningReplicas: strconv.Itoa(running[s.ID]),
+				ServiceCreated:         s.CreatedAt.UTC().Format(time.RFC3339Nano),
+				report.ControlProbeID:  r.probeID,
+			})
+		if replicated := s.Spec.Mode.Replicated; replicated != nil {
+			var replicas uint64
+			if replicated.Replicas != nil {
+				replicas = *replicated.Replicas
+			}
+			node = node.WithLatests(map[string]string{
+				ServiceMode:            ServiceModeReplicated,
+				ServiceDesiredReplicas: strconv.FormatUint(replicas, 10),
+			}).WithLatestControls(map[string]report.NodeControlData{
+				SwarmScaleUp:   {Dead: false},
+				SwarmScaleDown: {Dead: replicas == 0},
+			})
+		} else {
+			node = node.WithLatests(map[string]string{ServiceMode: ServiceModeGlobal})
+		}
+		result.SwarmService.AddNode(node)
+		if stackNamespace != "" {
+			result.SwarmStack.AddNode(swarmStackNode(stackNamespace))
+		}
+	}
+	return result, nil
+}
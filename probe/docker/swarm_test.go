@@ -0,0 +1,166 @@
+package docker_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+const swarmServices = `[
+	{
+		"ID": "svc1",
+		"Version": {"Index": 12},
+		"CreatedAt": "2020-06-01T12:00:00Z",
+		"Spec": {
+			"Name": "shop_web",
+			"Labels": {"com.docker.stack.namespace": "shop"},
+			"TaskTemplate": {"ContainerSpec": {"Image": "nginx:latest@sha256:abc", "StopGracePeriod": 10000000000}},
+			"Mode": {"Replicated": {"Replicas": 3}}
+		}
+	},
+	{
+		"ID": "svc2",
+		"Version": {"Index": 5},
+		"CreatedAt": "2020-06-01T12:00:00Z",
+		"Spec": {
+			"Name": "agent",
+			"TaskTemplate": {"ContainerSpec": {"Image": "agent:1"}},
+			"Mode": {"Global": {}}
+		}
+	}
+]`
+
+const swarmTasks = `[
+	{"ID": "task1", "ServiceID": "svc1", "DesiredState": "running", "Status": {"State": "running"}},
+	{"ID": "task2", "ServiceID": "svc1", "DesiredState": "running", "Status": {"State": "starting"}},
+	{"ID": "task3", "ServiceID": "svc1", "DesiredState": "shutdown", "Status": {"State": "running"}},
+	{"ID": "task4", "ServiceID": "svc2", "DesiredState": "running", "Status": {"State": "running"}}
+]`
+
+// swarmManager serves a swarm manager's API, recording the updates of
+// services.
+func swarmManager(t *testing.T, updates *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.24/services", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(swarmServices))
+	})
+	mux.HandleFunc("/v1.24/tasks", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(swarmTasks))
+	})
+	mux.HandleFunc("/v1.24/services/svc1", func(w http.ResponseWriter, r *http.Request) {
+		var services []json.RawMessage
+		if err := json.Unmarshal([]byte(swarmServices), &services); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(services[0])
+	})
+	mux.HandleFunc("/v1.24/services/svc1/update", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*updates = append(*updates, r.URL.Query().Get("version")+" "+strings.TrimSpace(string(body)))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSwarmReporter(t *testing.T) {
+	var updates []string
+	server := swarmManager(t, &updates)
+	defer server.Close()
+	client, err := docker.NewSwarmClient(strings.Replace(server.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := docker.NewSwarmReporter(client, "probe1", hr)
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, ok := rpt.SwarmService.Nodes[report.MakeSwarmServiceNodeID("svc1")]
+	if !ok {
+		t.Fatalf("Expected service svc1, got %v", rpt.SwarmService.Nodes)
+	}
+	for k, want := range map[string]string{
+		docker.ServiceName:            "web",
+		docker.StackNamespace:         "shop",
+		docker.ServiceMode:            docker.ServiceModeReplicated,
+		docker.ServiceImage:           "nginx:latest",
+		docker.ServiceDesiredReplicas: "3",
+		docker.ServiceRunningReplicas: "1",
+		report.ControlProbeID:         "probe1",
+	} {
+		if have, _ := web.Latest.Lookup(k); have != want {
+			t.Errorf("Expected %s %q, got %q", k, want, have)
+		}
+	}
+	stackID := report.MakeSwarmStackNodeID("shop")
+	if parents, _ := web.Parents.Lookup(report.SwarmStack); !parents.Contains(stackID) {
+		t.Errorf("Expected svc1 to be in the stack, got %v", web.Parents)
+	}
+	if _, ok := rpt.SwarmStack.Nodes[stackID]; !ok || len(rpt.SwarmStack.Nodes) != 1 {
+		t.Errorf("Expected the stack shop, got %v", rpt.SwarmStack.Nodes)
+	}
+
+	agent := rpt.SwarmService.Nodes[report.MakeSwarmServiceNodeID("svc2")]
+	if mode, _ := agent.Latest.Lookup(docker.ServiceMode); mode != docker.ServiceModeGlobal {
+		t.Errorf("Expected svc2 to be global, got %q", mode)
+	}
+	if namespace, _ := agent.Latest.Lookup(docker.StackNamespace); namespace != docker.DefaultNamespace {
+		t.Errorf("Expected svc2 to be in no stack, got %q", namespace)
+	}
+	if _, ok := agent.LatestControls.Lookup(docker.SwarmScaleUp); ok {
+		t.Errorf("Expected global services not to be scaled")
+	}
+
+	for _, control := range []string{docker.SwarmScaleUp, docker.SwarmScaleDown} {
+		if resp := hr.HandleControlRequest(xfer.Request{
+			Control: control,
+			NodeID:  report.MakeSwarmServiceNodeID("svc1"),
+		}); resp.Error != "" {
+			t.Fatalf("%s: %s", control, resp.Error)
+		}
+	}
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %v", updates)
+	}
+	for i, want := range []string{`"Replicas":4`, `"Replicas":2`} {
+		// The rest of the spec is sent back as it was
+		if !strings.HasPrefix(updates[i], "12 ") || !strings.Contains(updates[i], want) || !strings.Contains(updates[i], `"StopGracePeriod":10000000000`) {
+			t.Errorf("Expected an update of version 12 with %s, got %s", want, updates[i])
+		}
+	}
+}
+
+func TestSwarmReporterNotManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "This node is not a swarm manager."}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client, err := docker.NewSwarmClient(strings.Replace(server.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := docker.NewSwarmReporter(client, "probe1", controls.NewDefaultHandlerRegistry())
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.SwarmService.Nodes) != 0 {
+		t.Errorf("Expected no services, got %v", rpt.SwarmService.Nodes)
+	}
+
+	if _, err := docker.NewSwarmClient("ftp://foo"); err == nil {
+		t.Error("Expected an error for an invalid endpoint")
+	}
+}
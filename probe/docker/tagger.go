@@ -2,7 +2,6 @@ package docker
 
 import (
 	"strconv"
-	"strings"
 
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
@@ -22,7 +21,7 @@ var (
 
 // Tagger is a tagger that tags Docker container information to process
 // nodes that have a PID.
-// It also populates the SwarmService topology if any of the associated docker labels are present.
+// It also populates the SwarmService and SwarmStack topologies if any of the associated docker labels are present.
 type Tagger struct {
 	registry   Registry
 	procWalker process.Walker
@@ -57,22 +56,13 @@ func (t *Tagger) Tag(r report.Report) (report.Report, error) {
 		if !ok {
 			continue
 		}
-		stackNamespace, ok := container.Latest.Lookup(LabelPrefix + "com.docker.stack.namespace")
-		if !ok {
-			stackNamespace = DefaultNamespace
-		} else {
-			prefix := stackNamespace + "_"
-			if strings.HasPrefix(serviceName, prefix) {
-				serviceName = serviceName[len(prefix):]
-			}
-		}
+		stackNamespace, _ := container.Latest.Lookup(LabelPrefix + stackNamespaceLabel)
 
 		nodeID := report.MakeSwarmServiceNodeID(serviceID)
-		node := report.MakeNodeWith(nodeID, map[string]string{
-			ServiceName:    serviceName,
-			StackNamespace: stackNamespace,
-		})
-		r.SwarmService = r.SwarmService.AddNode(node)
+		r.SwarmService = r.SwarmService.AddNode(swarmServiceNode(nodeID, serviceName, stackNamespace))
+		if stackNamespace != "" {
+			r.SwarmStack = r.SwarmStack.AddNode(swarmStackNode(stackNamespace))
+		}
 
 		r.Container.Nodes[containerID] = container.WithParents(container.Parents.Add(report.SwarmService, report.MakeStringSet(nodeID)))
 	}
@@ -1,6 +1,8 @@
 package endpoint
 
 import (
+	"bytes"
+	"os"
 	"strconv"
 	"time"
 
@@ -18,18 +20,28 @@ type connectionTrackerConfig struct {
 	UseConntrack bool
 	WalkProc     bool
 	UseEbpfConn  bool
+	TrackUDP     bool
 	ProcRoot     string
 	BufferSize   int
 	ProcessCache *process.CachingWalker
 	Scanner      procspy.ConnectionScanner
 	DNSSnooper   *DNSSnooper
+	TCPStats     bool
+	// TrackAttempts reports the TCP connections conntrack saw attempted,
+	// but never answered.
+	TrackAttempts bool
 }
 
 type connectionTracker struct {
 	conf            connectionTrackerConfig
 	flowWalker      flowWalker // Interface
+	udpFlowWalker   flowWalker // nil unless TrackUDP is set
+	attemptWalker   flowWalker // attempts, unseen by eBPF; nil unless TrackAttempts is set with it
 	ebpfTracker     *EbpfTracker
 	reverseResolver *reverseResolver
+	tcpStats        *tcpStatsTracker // nil unless TCPStats is set
+	// stats of the TCP connections of the current report, by tuple key
+	currentTCPStats map[string]tcpStats
 
 	// time of the previous ebpf failure, or zero if it didn't fail
 	ebpfLastFailureTime time.Time
@@ -40,10 +52,21 @@ func newConnectionTracker(conf connectionTrackerConfig) connectionTracker {
 		conf:            conf,
 		reverseResolver: newReverseResolver(),
 	}
+	if conf.TCPStats {
+		ct.tcpStats = &tcpStatsTracker{dump: func() (map[string]tcpStats, error) { return dumpTCPStats(conf.ProcRoot) }}
+	}
+	if conf.TrackUDP {
+		// The eBPF tracker only follows TCP, so UDP is always taken from
+		// conntrack and /proc.
+		ct.udpFlowWalker = newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, udpProto, false, false)
+	}
 	if conf.UseEbpfConn {
 		et, err := newEbpfTracker()
 		if err == nil {
 			ct.ebpfTracker = et
+			if conf.TrackAttempts {
+				ct.attemptWalker = newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, tcpProto, false, true)
+			}
 			go ct.getInitialState()
 			return ct
 		}
@@ -77,8 +100,13 @@ func (t *connectionTracker) useProcfs() {
 	if t.conf.WalkProc && t.conf.Scanner == nil {
 		t.conf.Scanner = procspy.NewConnectionScanner(t.conf.ProcessCache, t.conf.SpyProcs)
 	}
+	if t.attemptWalker != nil {
+		// The flow walker follows attempts too
+		t.attemptWalker.stop()
+		t.attemptWalker = nil
+	}
 	if t.flowWalker == nil {
-		t.flowWalker = newConntrackFlowWalker(t.conf.UseConntrack, t.conf.ProcRoot, t.conf.BufferSize)
+		t.flowWalker = newConntrackFlowWalker(t.conf.UseConntrack, t.conf.ProcRoot, t.conf.BufferSize, tcpProto, false, t.conf.TrackAttempts)
 	}
 }
 
@@ -86,6 +114,19 @@ func (t *connectionTracker) useProcfs() {
 func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 	hostNodeID := report.MakeHostNodeID(t.conf.HostID)
 
+	if t.tcpStats != nil {
+		stats, err := t.tcpStats.update()
+		if err != nil {
+			log.Warnf("Cannot read the stats of TCP connections, not reporting their RTT and retransmissions: %v", err)
+			t.tcpStats = nil
+		}
+		t.currentTCPStats = stats
+	}
+
+	if t.udpFlowWalker != nil {
+		t.performUDPTrack(rpt)
+	}
+
 	if t.ebpfTracker != nil {
 		if !t.ebpfTracker.isDead() {
 			t.performEbpfTrack(rpt, hostNodeID)
@@ -121,7 +162,7 @@ func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 	t.flowWalker.walkFlows(func(f flow, alive bool) {
 		tuple := flowToTuple(f)
 		seenTuples[tuple.key()] = tuple
-		t.addConnection(rpt, false, tuple, "", nil, nil)
+		t.addConnection(rpt, false, tuple, "", nil, nil, flowEdge(f, alive))
 	})
 
 	if t.conf.WalkProc && t.conf.Scanner != nil {
@@ -135,7 +176,7 @@ func (t *connectionTracker) existingFlows() map[string]fourTuple {
 		// log.Warnf("Not using conntrack: disabled")
 	} else if err := IsConntrackSupported(t.conf.ProcRoot); err != nil {
 		log.Warnf("Not using conntrack: not supported by the kernel: %s", err)
-	} else if existingFlows, err := existingConnections([]string{"--any-nat"}); err != nil {
+	} else if existingFlows, err := existingConnections(tcpProto, true); err != nil {
 		log.Errorf("conntrack existingConnections error: %v", err)
 	} else {
 		for _, f := range existingFlows {
@@ -160,11 +201,38 @@ func (t *connectionTracker) performWalkProc(rpt *report.Report, hostNodeID strin
 				report.HostNodeID: hostNodeID,
 			}
 		}
-		t.addConnection(rpt, incoming, tuple, namespaceID, fromNodeInfo, toNodeInfo)
+		t.addConnection(rpt, incoming, tuple, namespaceID, fromNodeInfo, toNodeInfo, report.EdgeMetadata{})
 	}
 	return nil
 }
 
+// performUDPTrack reports the UDP flows known to conntrack, plus the
+// connected UDP sockets of the host network namespace.
+func (t *connectionTracker) performUDPTrack(rpt *report.Report) {
+	seenTuples := map[string]fourTuple{}
+	t.udpFlowWalker.walkFlows(func(f flow, alive bool) {
+		tuple := flowToTuple(f)
+		seenTuples[tuple.key()] = tuple
+		edge := flowEdge(f, alive)
+		edge.Transport = udpProto
+		t.addConnection(rpt, false, tuple, "", nil, nil, edge)
+	})
+
+	if !t.conf.WalkProc {
+		return
+	}
+	var buf bytes.Buffer
+	if _, err := procspy.ReadUDPFiles(os.Getpid(), &buf); err != nil {
+		log.Debugf("Error reading UDP sockets: %v", err)
+		return
+	}
+	sockets := procspy.NewUDPProcNet(buf.Bytes())
+	for conn := sockets.Next(); conn != nil; conn = sockets.Next() {
+		tuple, _, incoming := connectionTuple(conn, seenTuples)
+		t.addConnection(rpt, incoming, tuple, "", nil, nil, report.EdgeMetadata{Transport: udpProto})
+	}
+}
+
 // getInitialState runs conntrack and proc parsing synchronously only
 // once to initialize ebpfTracker
 func (t *connectionTracker) getInitialState() {
@@ -203,28 +271,63 @@ func (t *connectionTracker) performEbpfTrack(rpt *report.Report, hostNodeID stri
 				report.HostNodeID: hostNodeID,
 			}
 		}
-		t.addConnection(rpt, e.incoming, e.tuple, e.networkNamespace, fromNodeInfo, toNodeInfo)
+		t.addConnection(rpt, e.incoming, e.tuple, e.networkNamespace, fromNodeInfo, toNodeInfo, report.EdgeMetadata{})
 	})
+	if t.attemptWalker != nil {
+		t.attemptWalker.walkFlows(func(f flow, alive bool) {
+			if f.Attempted {
+				t.addConnection(rpt, false, flowToTuple(f), "", nil, nil, flowEdge(f, alive))
+			}
+		})
+	}
 	return nil
 }
 
-func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft fourTuple, namespaceID string, extraFromNode, extraToNode map[string]string) {
+// addConnection adds a connection to the report, with edge metadata in the
+// direction of the tuple. The stats of TCP sockets supersede the counters of
+// conntrack, when there are both.
+func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft fourTuple, namespaceID string, extraFromNode, extraToNode map[string]string, edge report.EdgeMetadata) {
 	if incoming {
 		ft = reverse(ft)
 		extraFromNode, extraToNode = extraToNode, extraFromNode
+		edge = edge.Reversed()
 	}
 	var (
-		fromNode = t.makeEndpointNode(namespaceID, ft.fromAddr, ft.fromPort, extraFromNode)
-		toNode   = t.makeEndpointNode(namespaceID, ft.toAddr, ft.toPort, extraToNode)
+		fromNode = t.makeEndpointNode(namespaceID, "", ft.fromAddr, ft.fromPort, extraFromNode)
+		toNode   = t.makeEndpointNode(namespaceID, ft.fromAddr, ft.toAddr, ft.toPort, extraToNode)
 	)
-	rpt.Endpoint = rpt.Endpoint.AddNode(fromNode.WithEdge(toNode.ID, report.EdgeMetadata{}))
+	if stats, ok := t.currentTCPStats[ft.key()]; ok && edge.Transport == "" && !edge.Attempted {
+		edge = stats.edge(ft)
+	}
+	rpt.Endpoint = rpt.Endpoint.AddNode(fromNode.WithEdge(toNode.ID, edge))
 	rpt.Endpoint = rpt.Endpoint.AddNode(toNode)
 }
 
-func (t *connectionTracker) makeEndpointNode(namespaceID string, addr string, port uint16, extra map[string]string) report.Node {
+// flowEdge gives the counters of a flow, in the direction of its tuple. Only
+// flows which are gone have them.
+func flowEdge(f flow, alive bool) report.EdgeMetadata {
+	if alive || (f.Original.Packets == 0 && f.Reply.Packets == 0) {
+		return report.EdgeMetadata{Attempted: f.Attempted}
+	}
+	return report.EdgeMetadata{
+		EgressPacketCount:  &f.Original.Packets,
+		IngressPacketCount: &f.Reply.Packets,
+		EgressByteCount:    &f.Original.Bytes,
+		IngressByteCount:   &f.Reply.Bytes,
+		Attempted:          f.Attempted,
+	}
+}
+
+// makeEndpointNode makes the node of an endpoint. The names of the endpoints
+// connected to are the ones their client resolved.
+func (t *connectionTracker) makeEndpointNode(namespaceID string, client, addr string, port uint16, extra map[string]string) report.Node {
 	portStr := strconv.Itoa(int(port))
 	node := report.MakeNodeWith(report.MakeEndpointNodeID(t.conf.HostID, namespaceID, addr, portStr), nil)
-	if names := t.conf.DNSSnooper.CachedNamesForIP(addr); len(names) > 0 {
+	names := t.conf.DNSSnooper.CachedNamesForIP(addr)
+	if client != "" {
+		names = t.conf.DNSSnooper.CachedNamesForIPFrom(client, addr)
+	}
+	if len(names) > 0 {
 		node = node.WithSet(SnoopedDNSNames, report.MakeStringSet(names...))
 	}
 	if names, err := t.reverseResolver.get(addr); err == nil && len(names) > 0 {
@@ -243,6 +346,12 @@ func (t *connectionTracker) Stop() error {
 	if t.flowWalker != nil {
 		t.flowWalker.stop()
 	}
+	if t.udpFlowWalker != nil {
+		t.udpFlowWalker.stop()
+	}
+	if t.attemptWalker != nil {
+		t.attemptWalker.stop()
+	}
 	t.reverseResolver.stop()
 	return nil
 }
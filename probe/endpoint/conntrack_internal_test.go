@@ -1,253 +1,311 @@
 package endpoint
 
 import (
-	"bufio"
-	"io"
-	"strings"
+	"encoding/binary"
+	"net"
 	"testing"
-	"time"
 
 	"github.com/weaveworks/scope/test"
 )
 
-// Obtained though conntrack -E -p tcp -o id and then tweaked
-const streamedFlowsSource = `[DESTROY] tcp      6 src=10.0.0.1 dst=127.0.0.1 sport=36826 dport=28106 src=10.0.0.2 dst=127.0.0.2 sport=28107 dport=36826 [ASSURED] id=347275904
-    [NEW] tcp      6 120 SYN_SENT src=10.0.0.1 dst=127.0.0.1 sport=36898 dport=28107 [UNREPLIED] src=10.0.0.2 dst=127.0.0.2 sport=28107 dport=36898 id=347275904
- [UPDATE] tcp      6 60 SYN_RECV src=10.0.0.1 dst=127.0.0.1 sport=36898 dport=28107 src=10.0.0.2 dst=127.0.0.2 sport=28107 dport=36898 id=347275904
- [UPDATE] tcp      6 432000 ESTABLISHED src=10.0.0.1 dst=127.0.0.1 sport=36898 dport=28107 src=10.0.0.2 dst=127.0.0.2 sport=28107 dport=36898 [ASSURED] id=347275904`
+// Netlink messages are encoded as the kernel does, see
+// ctnetlink_fill_info() in net/netfilter/nf_conntrack_netlink.c
 
-var wantStreamedFlows = []flow{
-	{
-		Type: destroyType,
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.1",
-				DstIP: "127.0.0.1",
-			},
-			Layer4: layer4{
-				SrcPort: 36826,
-				DstPort: 28106,
-				Proto:   "tcp",
-			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.2",
-				DstIP: "127.0.0.2",
-			},
-			Layer4: layer4{
-				SrcPort: 28107,
-				DstPort: 36826,
-				Proto:   "tcp",
-			},
-		},
-		Independent: meta{
-			ID: 347275904,
-		},
-	},
-	{
-		Type: newType,
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.1",
-				DstIP: "127.0.0.1",
-			},
-			Layer4: layer4{
-				SrcPort: 36898,
-				DstPort: 28107,
-				Proto:   "tcp",
-			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.2",
-				DstIP: "127.0.0.2",
-			},
-			Layer4: layer4{
-				SrcPort: 28107,
-				DstPort: 36898,
-				Proto:   "tcp",
-			},
-		},
-		Independent: meta{
-			ID:    347275904,
-			State: "SYN_SENT",
-		},
-	},
-	{
-		Type: updateType,
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.1",
-				DstIP: "127.0.0.1",
-			},
-			Layer4: layer4{
-				SrcPort: 36898,
-				DstPort: 28107,
-				Proto:   "tcp",
-			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.2",
-				DstIP: "127.0.0.2",
-			},
-			Layer4: layer4{
-				SrcPort: 28107,
-				DstPort: 36898,
-				Proto:   "tcp",
-			},
-		},
-		Independent: meta{
-			ID:    347275904,
-			State: "SYN_RECV",
-		},
-	},
-	{
-		Type: updateType,
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.1",
-				DstIP: "127.0.0.1",
-			},
-			Layer4: layer4{
-				SrcPort: 36898,
-				DstPort: 28107,
-				Proto:   "tcp",
-			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.0.2",
-				DstIP: "127.0.0.2",
-			},
-			Layer4: layer4{
-				SrcPort: 28107,
-				DstPort: 36898,
-				Proto:   "tcp",
-			},
-		},
-		Independent: meta{
-			ID:    347275904,
-			State: "ESTABLISHED",
-		},
-	},
+func encodeAttr(typ uint16, value []byte) []byte {
+	b := make([]byte, netlinkAlign(nlaHdrLen+len(value)))
+	nativeEndian.PutUint16(b[0:2], uint16(nlaHdrLen+len(value)))
+	nativeEndian.PutUint16(b[2:4], typ)
+	copy(b[nlaHdrLen:], value)
+	return b
 }
 
-func testFlowDecoding(t *testing.T, source string, want []flow, decoder func(scanner *bufio.Scanner) (flow, error)) {
-	scanner := bufio.NewScanner(strings.NewReader(source))
-	d := time.Millisecond * 100
-	for _, wantFlow := range want {
-		haveFlow, err := decoder(scanner)
-		if err != nil {
-			t.Fatalf("Unexpected decoding error: %v", err)
-		}
-		test.Poll(t, d, wantFlow, func() interface{} { return haveFlow })
+func encodeNested(typ uint16, attrs ...[]byte) []byte {
+	var value []byte
+	for _, attr := range attrs {
+		value = append(value, attr...)
 	}
+	return encodeAttr(typ|0x8000, value) // NLA_F_NESTED
+}
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
 
-	if _, err := decodeStreamedFlow(scanner); err != io.EOF {
-		t.Fatalf("Unexpected error value on empty input: %v", err)
+func encodeTuple(typ uint16, m meta, proto uint8) []byte {
+	ip := encodeNested(ctaTupleIP,
+		encodeAttr(ctaIPv4Src, net.ParseIP(m.Layer3.SrcIP).To4()),
+		encodeAttr(ctaIPv4Dst, net.ParseIP(m.Layer3.DstIP).To4()),
+	)
+	if family(m) == afInet6 {
+		ip = encodeNested(ctaTupleIP,
+			encodeAttr(ctaIPv6Src, net.ParseIP(m.Layer3.SrcIP).To16()),
+			encodeAttr(ctaIPv6Dst, net.ParseIP(m.Layer3.DstIP).To16()),
+		)
 	}
+	return encodeNested(typ,
+		ip,
+		encodeNested(ctaTupleProto,
+			encodeAttr(ctaProtoNum, []byte{proto}),
+			encodeAttr(ctaProtoSrcPort, be16(uint16(m.Layer4.SrcPort))),
+			encodeAttr(ctaProtoDstPort, be16(uint16(m.Layer4.DstPort))),
+		),
+	)
 }
 
-func TestStreamedFlowDecoding(t *testing.T) {
-	testFlowDecoding(t, streamedFlowsSource, wantStreamedFlows, decodeStreamedFlow)
+func family(m meta) uint8 {
+	if net.ParseIP(m.Layer3.SrcIP).To4() == nil {
+		return afInet6
+	}
+	return afInet
 }
 
-// Obtained through conntrack -L -p tcp -o id
-// With SELinux, there is a "secctx="
-// After "sudo sysctl net.netfilter.nf_conntrack_acct=1", there is "packets=" and "bytes="
-const dumpedFlowsSource = `tcp      6 431998 ESTABLISHED src=10.0.2.2 dst=10.0.2.15 sport=49911 dport=22 src=10.0.2.15 dst=10.0.2.2 sport=22 dport=49911 [ASSURED] mark=0 use=1 id=2993966208
-tcp      6 108 ESTABLISHED src=172.17.0.5 dst=172.17.0.2 sport=47010 dport=80 src=172.17.0.2 dst=172.17.0.5 sport=80 dport=47010 [ASSURED] mark=0 secctx=system_u:object_r:unlabeled_t:s0 use=1 id=4001098880
-tcp      6 431970 ESTABLISHED src=192.168.35.116 dst=216.58.213.227 sport=49862 dport=443 packets=11 bytes=1337 src=216.58.213.227 dst=192.168.35.116 sport=443 dport=49862 packets=8 bytes=716 [ASSURED] mark=0 secctx=system_u:object_r:unlabeled_t:s0 use=1 id=943643840`
+func encodeMessage(typ, flags uint16, family uint8, attrs ...[]byte) []byte {
+	data := []byte{family, 0, 0, 0}
+	for _, attr := range attrs {
+		data = append(data, attr...)
+	}
+	b := make([]byte, nlmsgHdrLen, nlmsgHdrLen+len(data))
+	nativeEndian.PutUint32(b[0:4], uint32(nlmsgHdrLen+len(data)))
+	nativeEndian.PutUint16(b[4:6], typ)
+	nativeEndian.PutUint16(b[6:8], flags)
+	return append(b, data...)
+}
 
-var wantDumpedFlows = []flow{
-	{
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.2.2",
-				DstIP: "10.0.2.15",
-			},
-			Layer4: layer4{
-				SrcPort: 49911,
-				DstPort: 22,
-				Proto:   "tcp",
-			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "10.0.2.15",
-				DstIP: "10.0.2.2",
-			},
-			Layer4: layer4{
-				SrcPort: 22,
-				DstPort: 49911,
-				Proto:   "tcp",
-			},
-		},
-		Independent: meta{
-			ID:    2993966208,
-			State: "ESTABLISHED",
-		},
-	},
-	{
+// encodeFlow encodes a flow as a conntrack event, or the entry of a dump.
+func encodeFlow(f flow, proto uint8, status uint32, state uint8) []byte {
+	typ, flags := uint16(nfnlSubsysCTNetlink<<8|ipctnlMsgCtNew), uint16(0)
+	switch f.Type {
+	case newType:
+		flags = nlmFCreate | nlmFExcl
+	case destroyType:
+		typ = nfnlSubsysCTNetlink<<8 | ipctnlMsgCtDelete
+	}
+	attrs := [][]byte{
+		encodeTuple(ctaTupleOrig, f.Original, proto),
+		encodeTuple(ctaTupleReply, f.Reply, proto),
+		encodeAttr(ctaStatus, be32(status)),
+	}
+	if proto == ipprotoTCP && f.Type != destroyType {
+		attrs = append(attrs, encodeNested(ctaProtoinfo,
+			encodeNested(ctaProtoinfoTCP, encodeAttr(ctaProtoinfoTCPState, []byte{state}))))
+	}
+	attrs = append(attrs, encodeAttr(ctaID, be32(uint32(f.Independent.ID))))
+	return encodeMessage(typ, flags, family(f.Original), attrs...)
+}
+
+func makeFlow(typ, state string, id int64) flow {
+	return flow{
+		Type: typ,
 		Original: meta{
-			Layer3: layer3{
-				SrcIP: "172.17.0.5",
-				DstIP: "172.17.0.2",
-			},
-			Layer4: layer4{
-				SrcPort: 47010,
-				DstPort: 80,
-				Proto:   "tcp",
-			},
+			Layer3: layer3{SrcIP: "10.0.0.1", DstIP: "127.0.0.1"},
+			Layer4: layer4{SrcPort: 36898, DstPort: 28107, Proto: tcpProto},
 		},
 		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "172.17.0.2",
-				DstIP: "172.17.0.5",
-			},
-			Layer4: layer4{
-				SrcPort: 80,
-				DstPort: 47010,
-				Proto:   "tcp",
-			},
+			Layer3: layer3{SrcIP: "10.0.0.2", DstIP: "127.0.0.2"},
+			Layer4: layer4{SrcPort: 28107, DstPort: 36898, Proto: tcpProto},
 		},
-		Independent: meta{
-			ID:    4001098880,
-			State: "ESTABLISHED",
-		},
-	},
-	{
-		Original: meta{
-			Layer3: layer3{
-				SrcIP: "192.168.35.116",
-				DstIP: "216.58.213.227",
+		Independent: meta{ID: id, State: state},
+	}
+}
+
+func TestConntrackEventDecoding(t *testing.T) {
+	const (
+		synSent     = 1
+		established = 3
+		timeWaitNum = 7
+	)
+	var (
+		newFlow      = makeFlow(newType, "SYN_SENT", 347275904)
+		updatedFlow  = makeFlow(updateType, "ESTABLISHED", 347275904)
+		timeWaitFlow = makeFlow(updateType, timeWait, 347275904)
+		destroyFlow  = makeFlow(destroyType, "", 347275904)
+		udpFlow      = flow{
+			Type: updateType,
+			Original: meta{
+				Layer3: layer3{SrcIP: "192.168.2.100", DstIP: "192.168.2.1"},
+				Layer4: layer4{SrcPort: 57767, DstPort: 53, Proto: udpProto},
 			},
-			Layer4: layer4{
-				SrcPort: 49862,
-				DstPort: 443,
-				Proto:   "tcp",
+			Reply: meta{
+				Layer3: layer3{SrcIP: "192.168.2.1", DstIP: "192.168.2.100"},
+				Layer4: layer4{SrcPort: 53, DstPort: 57767, Proto: udpProto},
 			},
-		},
-		Reply: meta{
-			Layer3: layer3{
-				SrcIP: "216.58.213.227",
-				DstIP: "192.168.35.116",
+			Independent: meta{ID: 1595499777},
+		}
+		ipv6Flow = flow{
+			Type: updateType,
+			Original: meta{
+				Layer3: layer3{SrcIP: "fd00::1", DstIP: "2001:db8::80"},
+				Layer4: layer4{SrcPort: 41234, DstPort: 443, Proto: tcpProto},
 			},
-			Layer4: layer4{
-				SrcPort: 443,
-				DstPort: 49862,
-				Proto:   "tcp",
+			Reply: meta{
+				Layer3: layer3{SrcIP: "2001:db8::80", DstIP: "fd00::1"},
+				Layer4: layer4{SrcPort: 443, DstPort: 41234, Proto: tcpProto},
 			},
-		},
-		Independent: meta{
-			ID:    943643840,
-			State: "ESTABLISHED",
-		},
-	},
+			Independent: meta{ID: 1595499778, State: "ESTABLISHED"},
+		}
+	)
+
+	// Events are batched in datagrams
+	var datagram []byte
+	for _, msg := range [][]byte{
+		encodeFlow(newFlow, ipprotoTCP, 0, synSent),
+		encodeFlow(udpFlow, ipprotoUDP, 0, 0),
+		encodeFlow(updatedFlow, ipprotoTCP, 0, established),
+		encodeFlow(ipv6Flow, ipprotoTCP, 0, established),
+		// Flows of other families, like AF_BRIDGE, are ignored
+		encodeMessage(nfnlSubsysCTNetlink<<8|ipctnlMsgCtNew, 0, 7),
+		encodeFlow(timeWaitFlow, ipprotoTCP, 0, timeWaitNum),
+		encodeFlow(destroyFlow, ipprotoTCP, 0, 0),
+	} {
+		datagram = append(datagram, msg...)
+	}
+
+	have, done, err := decodeConntrackFlows(datagram, conntrackFilter{proto: tcpProto})
+	if err != nil || done {
+		t.Fatalf("Unexpected decoding result: %v, %v", done, err)
+	}
+	test.Poll(t, 0, []flow{newFlow, updatedFlow, ipv6Flow, timeWaitFlow, destroyFlow}, func() interface{} { return have })
+
+	have, _, err = decodeConntrackFlows(datagram, conntrackFilter{proto: udpProto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 0, []flow{udpFlow}, func() interface{} { return have })
+}
+
+func TestConntrackNATOnly(t *testing.T) {
+	plain := makeFlow(updateType, "ESTABLISHED", 1)
+	nated := makeFlow(updateType, "ESTABLISHED", 2)
+	datagram := append(encodeFlow(plain, ipprotoTCP, 0, 3), encodeFlow(nated, ipprotoTCP, ipsDstNAT, 3)...)
+	nated.Status = ipsDstNAT
+
+	have, _, err := decodeConntrackFlows(datagram, conntrackFilter{proto: tcpProto, natOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 0, []flow{nated}, func() interface{} { return have })
 }
 
-func TestDumpedFlowDecoding(t *testing.T) {
-	testFlowDecoding(t, dumpedFlowsSource, wantDumpedFlows, decodeDumpedFlow)
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func TestConntrackCountersDecoding(t *testing.T) {
+	destroyed := makeFlow(destroyType, "", 1)
+	msg := encodeFlow(destroyed, ipprotoTCP, 0, 0)
+	// Counters come with the events of destroyed flows
+	msg = append(msg, encodeNested(ctaCountersOrig,
+		encodeAttr(ctaCountersPackets, be64(12)), encodeAttr(ctaCountersBytes, be64(1500)))...)
+	msg = append(msg, encodeNested(ctaCountersReply,
+		encodeAttr(ctaCounters32Packets, be32(10)), encodeAttr(ctaCounters32Bytes, be32(90000)))...)
+	nativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+
+	have, _, err := decodeConntrackFlows(msg, conntrackFilter{proto: tcpProto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	destroyed.Original.Packets, destroyed.Original.Bytes = 12, 1500
+	destroyed.Reply.Packets, destroyed.Reply.Bytes = 10, 90000
+	test.Poll(t, 0, []flow{destroyed}, func() interface{} { return have })
+
+	// Walkers keep the counters of destroyed flows
+	walker := &conntrackWalker{activeFlows: map[int64]flow{}, proto: tcpProto}
+	walker.handleFlow(makeFlow(updateType, "ESTABLISHED", 1), false)
+	walker.handleFlow(have[0], false)
+	var walked []flow
+	walker.walkFlows(func(f flow, alive bool) { walked = append(walked, f) })
+	if len(walked) != 1 || walked[0].Original.Bytes != 1500 || walked[0].Reply.Bytes != 90000 {
+		t.Errorf("Unexpected walked flows %v", walked)
+	}
+}
+
+func TestConntrackDumpDecoding(t *testing.T) {
+	done := encodeMessage(nlmsgDone, 0, 0)
+	datagram := append(encodeFlow(makeFlow(updateType, "ESTABLISHED", 1), ipprotoTCP, 0, 3), done...)
+	flows, isDone, err := decodeConntrackFlows(datagram, conntrackFilter{proto: tcpProto})
+	if err != nil || !isDone || len(flows) != 1 {
+		t.Errorf("Expected one flow and the end of the dump, got %v, %v, %v", flows, isDone, err)
+	}
+
+	// An errno of -EPERM
+	failed := encodeMessage(nlmsgError, 0, 0)
+	nativeEndian.PutUint32(failed[nlmsgHdrLen:], uint32(0xffffffff))
+	if _, _, err := decodeConntrackFlows(failed, conntrackFilter{proto: tcpProto}); err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if _, _, err := decodeConntrackFlows(datagram[:30], conntrackFilter{proto: tcpProto}); err == nil {
+		t.Errorf("Expected an error on a truncated datagram")
+	}
+}
+
+func TestConntrackDumpRequest(t *testing.T) {
+	msgs, err := parseNetlinkMessages(conntrackDumpRequest(7))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Expected one message, got %v, %v", msgs, err)
+	}
+	if msg := msgs[0]; msg.Type != nfnlSubsysCTNetlink<<8|ipctnlMsgCtGet || msg.Flags != nlmFRequest|nlmFDump || msg.Data[0] != afUnspec {
+		t.Errorf("Unexpected dump request %v", msg)
+	}
+}
+
+func TestConntrackAttempts(t *testing.T) {
+	var (
+		walker     = &conntrackWalker{activeFlows: map[int64]flow{}, proto: tcpProto, attempts: true, attemptedFlows: map[int64]attempt{}}
+		unanswered = makeFlow(newType, "SYN_SENT", 1)
+		answered   = makeFlow(newType, "SYN_SENT", 2)
+		given      = makeFlow(newType, "SYN_SENT", 3)
+	)
+	walks := func() map[int64]bool {
+		walked := map[int64]bool{}
+		walker.walkFlows(func(f flow, alive bool) {
+			if f.Attempted {
+				walked[f.Independent.ID] = alive
+			}
+		})
+		return walked
+	}
+	for _, f := range []flow{unanswered, answered, given} {
+		walker.handleFlow(f, false)
+	}
+	// Attempts are only walked once unanswered for long enough
+	if walked := walks(); len(walked) != 0 {
+		t.Errorf("Expected no attempts yet, got %v", walked)
+	}
+	for id, a := range walker.attemptedFlows {
+		a.since = a.since.Add(-2 * attemptTimeout)
+		walker.attemptedFlows[id] = a
+	}
+
+	answered.Type, answered.Independent.State, answered.Status = updateType, "ESTABLISHED", ipsSeenReply
+	walker.handleFlow(answered, false)
+	given.Type = destroyType
+	walker.handleFlow(given, false)
+	test.Poll(t, 0, map[int64]bool{1: true, 3: false}, func() interface{} { return walks() })
+	if _, ok := walker.activeFlows[2]; !ok {
+		t.Errorf("Expected the answered flow to be active")
+	}
+	test.Poll(t, 0, map[int64]bool{1: true}, func() interface{} { return walks() })
+
+	// Unanswered flows of the table are attempts of unknown age
+	dumped := makeFlow(updateType, "SYN_SENT", 4)
+	walker.handleFlow(dumped, true)
+	test.Poll(t, 0, map[int64]bool{1: true, 4: true}, func() interface{} { return walks() })
+
+	// Flows are active, as ever, when not following attempts
+	walker = &conntrackWalker{activeFlows: map[int64]flow{}, proto: tcpProto}
+	walker.handleFlow(dumped, true)
+	if walked := walks(); len(walked) != 0 || len(walker.activeFlows) != 1 {
+		t.Errorf("Expected no attempts, got %v", walked)
+	}
 }
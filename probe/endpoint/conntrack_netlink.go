@@ -0,0 +1,360 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"unsafe"
+)
+
+// The conntrack table is dumped, and followed, over the netlink protocol of
+// netfilter (NFNL_SUBSYS_CTNETLINK). Constants are from linux/netlink.h,
+// linux/netfilter/nfnetlink.h and linux/netfilter/nfnetlink_conntrack.h.
+const (
+	netlinkNetfilter = 12 // NETLINK_NETFILTER
+
+	nlmsgHdrLen = 16
+	nlmsgError  = 2
+	nlmsgDone   = 3
+	nlmFRequest = 0x1
+	nlmFDump    = 0x300
+	nlmFExcl    = 0x200
+	nlmFCreate  = 0x400
+
+	nfgenmsgLen         = 4
+	nfnlSubsysCTNetlink = 1
+	ipctnlMsgCtNew      = 0
+	ipctnlMsgCtGet      = 1
+	ipctnlMsgCtDelete   = 2
+
+	// Multicast groups of conntrack events, as a bitmask for bind(2)
+	nfnlgrpConntrackNew     = 1 << 0
+	nfnlgrpConntrackUpdate  = 1 << 1
+	nfnlgrpConntrackDestroy = 1 << 2
+
+	nlaHdrLen   = 4
+	nlaTypeMask = 0x3fff // without NLA_F_NESTED and NLA_F_NET_BYTEORDER
+
+	ctaTupleOrig     = 1
+	ctaTupleReply    = 2
+	ctaStatus        = 3
+	ctaProtoinfo     = 4
+	ctaCountersOrig  = 9
+	ctaCountersReply = 10
+	ctaID            = 12
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+	ctaIPv6Src = 3
+	ctaIPv6Dst = 4
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	ctaProtoinfoTCP      = 1
+	ctaProtoinfoTCPState = 1
+
+	ctaCountersPackets   = 1
+	ctaCountersBytes     = 2
+	ctaCounters32Packets = 3
+	ctaCounters32Bytes   = 4
+
+	// Bits of CTA_STATUS
+	ipsSeenReply = 1 << 1
+	ipsSrcNAT    = 1 << 4
+	ipsDstNAT    = 1 << 5
+
+	afUnspec   = 0
+	afInet     = 2
+	ipprotoTCP = 6
+	ipprotoUDP = 17
+)
+
+// tcpStates are the names of the TCP states of conntrack, as the conntrack
+// CLI prints them.
+var tcpStates = []string{
+	"NONE",
+	"SYN_SENT",
+	"SYN_RECV",
+	"ESTABLISHED",
+	"FIN_WAIT",
+	"CLOSE_WAIT",
+	"LAST_ACK",
+	timeWait,
+	"CLOSE",
+	"LISTEN",
+}
+
+// nativeEndian is the byte order of netlink headers; attribute values are in
+// network byte order.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+type netlinkMessage struct {
+	Type, Flags uint16
+	Data        []byte
+}
+
+type netlinkAttr struct {
+	Type  uint16
+	Value []byte
+}
+
+func netlinkAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// parseNetlinkMessages splits a datagram read from a netlink socket into
+// its messages.
+func parseNetlinkMessages(b []byte) ([]netlinkMessage, error) {
+	var msgs []netlinkMessage
+	for len(b) >= nlmsgHdrLen {
+		length := int(nativeEndian.Uint32(b[0:4]))
+		if length < nlmsgHdrLen || length > len(b) {
+			return nil, fmt.Errorf("invalid netlink message length %d", length)
+		}
+		msgs = append(msgs, netlinkMessage{
+			Type:  nativeEndian.Uint16(b[4:6]),
+			Flags: nativeEndian.Uint16(b[6:8]),
+			Data:  b[nlmsgHdrLen:length],
+		})
+		if netlinkAlign(length) >= len(b) {
+			break
+		}
+		b = b[netlinkAlign(length):]
+	}
+	return msgs, nil
+}
+
+func parseNetlinkAttrs(b []byte) ([]netlinkAttr, error) {
+	var attrs []netlinkAttr
+	for len(b) >= nlaHdrLen {
+		length := int(nativeEndian.Uint16(b[0:2]))
+		if length < nlaHdrLen || length > len(b) {
+			return nil, fmt.Errorf("invalid netlink attribute length %d", length)
+		}
+		attrs = append(attrs, netlinkAttr{
+			Type:  nativeEndian.Uint16(b[2:4]) & nlaTypeMask,
+			Value: b[nlaHdrLen:length],
+		})
+		if netlinkAlign(length) >= len(b) {
+			break
+		}
+		b = b[netlinkAlign(length):]
+	}
+	return attrs, nil
+}
+
+// netlinkError gives the error of a NLMSG_ERROR message, which is nil for
+// acknowledgements.
+func netlinkError(msg netlinkMessage) error {
+	if len(msg.Data) < 4 {
+		return fmt.Errorf("truncated netlink error")
+	}
+	if errno := int32(nativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+		return fmt.Errorf("netlink error %d", -errno)
+	}
+	return nil
+}
+
+// conntrackDumpRequest is the message asking for the flows of the conntrack
+// table, of every family.
+func conntrackDumpRequest(seq uint32) []byte {
+	b := make([]byte, nlmsgHdrLen+nfgenmsgLen)
+	nativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	nativeEndian.PutUint16(b[4:6], nfnlSubsysCTNetlink<<8|ipctnlMsgCtGet)
+	nativeEndian.PutUint16(b[6:8], nlmFRequest|nlmFDump)
+	nativeEndian.PutUint32(b[8:12], seq)
+	b[nlmsgHdrLen] = afUnspec // nfgenmsg: family, version 0 and res_id 0
+	return b
+}
+
+// decodeConntrackMessage decodes a message of the conntrack subsystem into
+// a flow, with its status bits. Messages about other subsystems, and flows
+// which are neither IPv4 nor IPv6, aren't ok.
+func decodeConntrackMessage(msg netlinkMessage) (f flow, status uint32, ok bool, err error) {
+	if msg.Type>>8 != nfnlSubsysCTNetlink || len(msg.Data) < nfgenmsgLen || (msg.Data[0] != afInet && msg.Data[0] != afInet6) {
+		return flow{}, 0, false, nil
+	}
+	switch msg.Type & 0xff {
+	case ipctnlMsgCtDelete:
+		f.Type = destroyType
+	case ipctnlMsgCtNew:
+		if msg.Flags&(nlmFCreate|nlmFExcl) != 0 {
+			f.Type = newType
+		} else {
+			f.Type = updateType
+		}
+	default:
+		return flow{}, 0, false, nil
+	}
+
+	attrs, err := parseNetlinkAttrs(msg.Data[nfgenmsgLen:])
+	if err != nil {
+		return flow{}, 0, false, err
+	}
+	for _, attr := range attrs {
+		switch attr.Type {
+		case ctaTupleOrig:
+			err = decodeTuple(attr.Value, &f.Original)
+		case ctaTupleReply:
+			err = decodeTuple(attr.Value, &f.Reply)
+		case ctaStatus:
+			if len(attr.Value) >= 4 {
+				status = binary.BigEndian.Uint32(attr.Value)
+			}
+		case ctaProtoinfo:
+			f.Independent.State, err = decodeTCPState(attr.Value)
+		case ctaCountersOrig:
+			err = decodeCounters(attr.Value, &f.Original)
+		case ctaCountersReply:
+			err = decodeCounters(attr.Value, &f.Reply)
+		case ctaID:
+			if len(attr.Value) >= 4 {
+				f.Independent.ID = int64(binary.BigEndian.Uint32(attr.Value))
+			}
+		}
+		if err != nil {
+			return flow{}, 0, false, err
+		}
+	}
+	return f, status, true, nil
+}
+
+func decodeTuple(b []byte, m *meta) error {
+	attrs, err := parseNetlinkAttrs(b)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		nested, err := parseNetlinkAttrs(attr.Value)
+		if err != nil {
+			return err
+		}
+		for _, n := range nested {
+			switch {
+			case attr.Type == ctaTupleIP && (n.Type == ctaIPv4Src || n.Type == ctaIPv6Src):
+				m.Layer3.SrcIP = net.IP(n.Value).String()
+			case attr.Type == ctaTupleIP && (n.Type == ctaIPv4Dst || n.Type == ctaIPv6Dst):
+				m.Layer3.DstIP = net.IP(n.Value).String()
+			case attr.Type == ctaTupleProto && n.Type == ctaProtoNum && len(n.Value) >= 1:
+				m.Layer4.Proto = protoName(n.Value[0])
+			case attr.Type == ctaTupleProto && n.Type == ctaProtoSrcPort && len(n.Value) >= 2:
+				m.Layer4.SrcPort = int(binary.BigEndian.Uint16(n.Value))
+			case attr.Type == ctaTupleProto && n.Type == ctaProtoDstPort && len(n.Value) >= 2:
+				m.Layer4.DstPort = int(binary.BigEndian.Uint16(n.Value))
+			}
+		}
+	}
+	return nil
+}
+
+// decodeCounters decodes the packet and byte counters of a direction, which
+// are 32 bits on old kernels.
+func decodeCounters(b []byte, m *meta) error {
+	attrs, err := parseNetlinkAttrs(b)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		var value uint64
+		switch len(attr.Value) {
+		case 8:
+			value = binary.BigEndian.Uint64(attr.Value)
+		case 4:
+			value = uint64(binary.BigEndian.Uint32(attr.Value))
+		default:
+			continue
+		}
+		switch attr.Type {
+		case ctaCountersPackets, ctaCounters32Packets:
+			m.Packets = value
+		case ctaCountersBytes, ctaCounters32Bytes:
+			m.Bytes = value
+		}
+	}
+	return nil
+}
+
+func decodeTCPState(b []byte) (string, error) {
+	attrs, err := parseNetlinkAttrs(b)
+	if err != nil {
+		return "", err
+	}
+	for _, attr := range attrs {
+		if attr.Type != ctaProtoinfoTCP {
+			continue
+		}
+		nested, err := parseNetlinkAttrs(attr.Value)
+		if err != nil {
+			return "", err
+		}
+		for _, n := range nested {
+			if n.Type == ctaProtoinfoTCPState && len(n.Value) >= 1 && int(n.Value[0]) < len(tcpStates) {
+				return tcpStates[n.Value[0]], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func protoName(proto uint8) string {
+	switch proto {
+	case ipprotoTCP:
+		return tcpProto
+	case ipprotoUDP:
+		return udpProto
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// conntrackFilter tells whether to follow a flow: only flows of one
+// protocol are followed, and maybe only NAT'd ones.
+type conntrackFilter struct {
+	proto   string
+	natOnly bool
+}
+
+func (c conntrackFilter) matches(f flow, status uint32) bool {
+	return f.Original.Layer4.Proto == c.proto && (!c.natOnly || status&(ipsSrcNAT|ipsDstNAT) != 0)
+}
+
+// decodeConntrackFlows decodes the flows matching a filter in a datagram of
+// conntrack messages. done is true at the end of a dump.
+func decodeConntrackFlows(b []byte, filter conntrackFilter) (flows []flow, done bool, err error) {
+	msgs, err := parseNetlinkMessages(b)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, msg := range msgs {
+		switch msg.Type {
+		case nlmsgDone:
+			return flows, true, nil
+		case nlmsgError:
+			if err := netlinkError(msg); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		f, status, ok, err := decodeConntrackMessage(msg)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok && filter.matches(f, status) {
+			f.Reply.Layer4.Proto = f.Original.Layer4.Proto
+			f.Status = status
+			flows = append(flows, f)
+		}
+	}
+	return flows, false, nil
+}
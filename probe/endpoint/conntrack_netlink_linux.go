@@ -0,0 +1,145 @@
+package endpoint
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// Datagrams of netlink dumps fit in a page, but events are batched.
+	netlinkReadBufferSize = 64 * 1024
+	// How often a blocked read of events wakes up, to see if it's stopped.
+	conntrackEventsReadTimeout = time.Second
+)
+
+// netlinkSocket is a socket of a netlink protocol.
+type netlinkSocket struct {
+	fd  int
+	buf []byte
+}
+
+// conntrackSocket is a socket of the netfilter netlink protocol.
+type conntrackSocket struct {
+	*netlinkSocket
+}
+
+func openConntrackSocket(groups uint32) (*conntrackSocket, error) {
+	s, err := openNetlinkSocket(netlinkNetfilter, groups)
+	if err != nil {
+		return nil, err
+	}
+	return &conntrackSocket{s}, nil
+}
+
+func openNetlinkSocket(protocol int, groups uint32) (*netlinkSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return &netlinkSocket{fd: fd, buf: make([]byte, netlinkReadBufferSize)}, nil
+}
+
+func (s *netlinkSocket) close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *netlinkSocket) send(msg []byte) error {
+	if err := syscall.Sendto(s.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+	return nil
+}
+
+// recv returns nothing when no datagram came before the read timeout.
+func (s *netlinkSocket) recv() ([]byte, error) {
+	n, _, err := syscall.Recvfrom(s.fd, s.buf, 0)
+	switch {
+	case err == syscall.EAGAIN || err == syscall.EINTR:
+		return nil, nil
+	case err != nil:
+		return nil, os.NewSyscallError("recvfrom", err)
+	}
+	return s.buf[:n], nil
+}
+
+// read returns nothing when no datagram came before the read timeout.
+func (s *conntrackSocket) read(filter conntrackFilter) ([]flow, bool, error) {
+	b, err := s.recv()
+	if err != nil || b == nil {
+		return nil, false, err
+	}
+	return decodeConntrackFlows(b, filter)
+}
+
+// existingConnections dumps the flows of the conntrack table.
+func existingConnections(proto string, natOnly bool) ([]flow, error) {
+	s, err := openConntrackSocket(0)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	if err := s.send(conntrackDumpRequest(1)); err != nil {
+		return nil, err
+	}
+
+	filter := conntrackFilter{proto: proto, natOnly: natOnly}
+	var result []flow
+	for {
+		flows, done, err := s.read(filter)
+		if err != nil {
+			return result, err
+		}
+		for _, f := range flows {
+			// Flows of dumps aren't events
+			f.Type = ""
+			result = append(result, f)
+		}
+		if done {
+			return result, nil
+		}
+	}
+}
+
+// conntrackEvents is a subscription to the events of the conntrack table.
+type conntrackEvents struct {
+	socket *conntrackSocket
+	filter conntrackFilter
+}
+
+// subscribeConntrack subscribes to the events of the conntrack table, in a
+// kernel buffer of bufferSize bytes. Forcing the size of the buffer over the
+// limit of the system needs CAP_NET_ADMIN.
+func subscribeConntrack(proto string, natOnly bool, bufferSize int) (*conntrackEvents, error) {
+	s, err := openConntrackSocket(nfnlgrpConntrackNew | nfnlgrpConntrackUpdate | nfnlgrpConntrackDestroy)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetsockoptInt(s.fd, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, bufferSize); err != nil {
+		if err := syscall.SetsockoptInt(s.fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, bufferSize); err != nil {
+			s.close()
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+	timeout := syscall.NsecToTimeval(conntrackEventsReadTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(s.fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		s.close()
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	return &conntrackEvents{socket: s, filter: conntrackFilter{proto: proto, natOnly: natOnly}}, nil
+}
+
+// next waits for the next events, for up to a second. It fails with ENOBUFS
+// when events were lost, as the buffer overflowed.
+func (e *conntrackEvents) next() ([]flow, error) {
+	flows, _, err := e.socket.read(e.filter)
+	return flows, err
+}
+
+func (e *conntrackEvents) close() error {
+	return e.socket.close()
+}
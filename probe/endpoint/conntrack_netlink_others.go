@@ -0,0 +1,29 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+var errConntrackNotSupported = fmt.Errorf("conntrack is only supported on Linux")
+
+// existingConnections dumps the flows of the conntrack table.
+func existingConnections(proto string, natOnly bool) ([]flow, error) {
+	return nil, errConntrackNotSupported
+}
+
+// conntrackEvents is a subscription to the events of the conntrack table.
+type conntrackEvents struct{}
+
+func subscribeConntrack(proto string, natOnly bool, bufferSize int) (*conntrackEvents, error) {
+	return nil, errConntrackNotSupported
+}
+
+func (e *conntrackEvents) next() ([]flow, error) {
+	return nil, errConntrackNotSupported
+}
+
+func (e *conntrackEvents) close() error {
+	return nil
+}
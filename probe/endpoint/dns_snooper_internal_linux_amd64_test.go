@@ -0,0 +1,59 @@
+package endpoint
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func dnsResponse(name string, ips ...string) *layers.DNS {
+	dns := &layers.DNS{
+		QR:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+	for _, ip := range ips {
+		dns.Answers = append(dns.Answers, layers.DNSResourceRecord{
+			Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN, IP: net.ParseIP(ip),
+		})
+	}
+	return dns
+}
+
+func TestDNSSnooperPerClient(t *testing.T) {
+	const (
+		cdnIP   = "151.101.1.69"
+		client1 = "10.32.0.1"
+		client2 = "10.32.0.2"
+	)
+	for _, perClient := range []bool{false, true} {
+		s := newDNSSnooper(perClient)
+		s.processDNSMessage(dnsResponse("stackoverflow.com", cdnIP), client1)
+		s.processDNSMessage(dnsResponse("reddit.com", cdnIP), client2)
+
+		all := s.CachedNamesForIP(cdnIP)
+		sort.Strings(all)
+		if want := []string{"reddit.com", "stackoverflow.com"}; !reflect.DeepEqual(want, all) {
+			t.Errorf("Expected %v, got %v", want, all)
+		}
+
+		want := all
+		if perClient {
+			want = []string{"stackoverflow.com"}
+		}
+		have := s.CachedNamesForIPFrom(client1, cdnIP)
+		sort.Strings(have)
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("Expected %v for %s (per client: %v), got %v", want, client1, perClient, have)
+		}
+
+		// Clients which weren't seen resolving the IP get all of its names
+		have = s.CachedNamesForIPFrom("10.32.0.3", cdnIP)
+		sort.Strings(have)
+		if !reflect.DeepEqual(all, have) {
+			t.Errorf("Expected %v for an unknown client, got %v", all, have)
+		}
+	}
+}
@@ -26,28 +26,35 @@ const (
 type DNSSnooper struct {
 	stop       chan struct{}
 	pcapHandle *pcap.Handle
+	perClient  bool
 	// gcache is goroutine-safe, but the cached values aren't
 	reverseDNSMutex     sync.RWMutex
 	reverseDNSCache     gcache.Cache
+	clientDNSCache      gcache.Cache      // keyed by the client and the IP
 	decodingErrorCounts map[string]uint64 // for limiting
 }
 
-// NewDNSSnooper creates a new snooper of DNS queries
-func NewDNSSnooper() (*DNSSnooper, error) {
+// NewDNSSnooper creates a new snooper of DNS queries. In per-client mode,
+// the names of IPs are the ones the clients connecting to them resolved.
+func NewDNSSnooper(perClient bool) (*DNSSnooper, error) {
 	pcapHandle, err := newPcapHandle()
 	if err != nil {
 		return nil, err
 	}
-	reverseDNSCache := gcache.New(maxReverseDNSrecords).LRU().Build()
+	s := newDNSSnooper(perClient)
+	s.pcapHandle = pcapHandle
+	go s.run()
+	return s, nil
+}
 
-	s := &DNSSnooper{
+func newDNSSnooper(perClient bool) *DNSSnooper {
+	return &DNSSnooper{
 		stop:                make(chan struct{}),
-		pcapHandle:          pcapHandle,
-		reverseDNSCache:     reverseDNSCache,
+		perClient:           perClient,
+		reverseDNSCache:     gcache.New(maxReverseDNSrecords).LRU().Build(),
+		clientDNSCache:      gcache.New(maxReverseDNSrecords).LRU().Build(),
 		decodingErrorCounts: map[string]uint64{},
 	}
-	go s.run()
-	return s, nil
 }
 
 func newPcapHandle() (*pcap.Handle, error) {
@@ -100,7 +107,25 @@ func (s *DNSSnooper) CachedNamesForIP(ip string) []string {
 	if s == nil {
 		return result
 	}
-	domains, err := s.reverseDNSCache.Get(ip)
+	return s.cachedNames(s.reverseDNSCache, ip)
+}
+
+// CachedNamesForIPFrom obtains the domains associated to an IP for a client
+// connecting to it. In per-client mode, they are the domains the client
+// resolved to the IP, if it was seen doing so.
+func (s *DNSSnooper) CachedNamesForIPFrom(client, ip string) []string {
+	if s == nil || !s.perClient {
+		return s.CachedNamesForIP(ip)
+	}
+	if result := s.cachedNames(s.clientDNSCache, clientDNSKey(client, ip)); len(result) > 0 {
+		return result
+	}
+	return s.CachedNamesForIP(ip)
+}
+
+func (s *DNSSnooper) cachedNames(cache gcache.Cache, key string) []string {
+	result := []string{}
+	domains, err := cache.Get(key)
 	if err != nil {
 		return result
 	}
@@ -113,6 +138,10 @@ func (s *DNSSnooper) CachedNamesForIP(ip string) []string {
 	return result
 }
 
+func clientDNSKey(client, ip string) string {
+	return client + "|" + ip
+}
+
 // Stop makes the snooper stop inspecting DNS communications
 func (s *DNSSnooper) Stop() {
 	if s != nil {
@@ -204,9 +233,16 @@ func (s *DNSSnooper) run() {
 			continue
 		}
 
+		// Responses are inbound, so their destination is the client
+		var client string
 		for _, layerType := range decodedLayers {
-			if layerType == layers.LayerTypeDNS {
-				s.processDNSMessage(&dns)
+			switch layerType {
+			case layers.LayerTypeIPv4:
+				client = ip4.DstIP.String()
+			case layers.LayerTypeIPv6:
+				client = ip6.DstIP.String()
+			case layers.LayerTypeDNS:
+				s.processDNSMessage(&dns, client)
 			}
 		}
 	}
@@ -231,7 +267,7 @@ func (s *DNSSnooper) handleDecodingError(err error) {
 	}
 }
 
-func (s *DNSSnooper) processDNSMessage(dns *layers.DNS) {
+func (s *DNSSnooper) processDNSMessage(dns *layers.DNS, client string) {
 
 	// Only consider responses to singleton, A-record questions
 	if !dns.QR || dns.ResponseCode != 0 || len(dns.Questions) != 1 {
@@ -270,15 +306,22 @@ func (s *DNSSnooper) processDNSMessage(dns *layers.DNS) {
 
 	// Update cache
 	newDomain := string(domainQueried)
-	log.Debugf("DNSSnooper: caught DNS lookup: %s -> %v", newDomain, ips)
+	log.Debugf("DNSSnooper: caught DNS lookup by %s: %s -> %v", client, newDomain, ips)
 	for ip := range ips {
-		if existingDomains, err := s.reverseDNSCache.Get(ip); err != nil {
-			s.reverseDNSCache.Set(ip, map[string]struct{}{newDomain: {}})
-		} else {
-			// TODO: Be smarter about the expiration of entries with pre-existing associated domains
-			s.reverseDNSMutex.Lock()
-			existingDomains.(map[string]struct{})[newDomain] = struct{}{}
-			s.reverseDNSMutex.Unlock()
+		s.cacheName(s.reverseDNSCache, ip, newDomain)
+		if s.perClient && client != "" {
+			s.cacheName(s.clientDNSCache, clientDNSKey(client, ip), newDomain)
 		}
 	}
 }
+
+func (s *DNSSnooper) cacheName(cache gcache.Cache, key, domain string) {
+	if existingDomains, err := cache.Get(key); err != nil {
+		cache.Set(key, map[string]struct{}{domain: {}})
+	} else {
+		// TODO: Be smarter about the expiration of entries with pre-existing associated domains
+		s.reverseDNSMutex.Lock()
+		existingDomains.(map[string]struct{})[domain] = struct{}{}
+		s.reverseDNSMutex.Unlock()
+	}
+}
@@ -1,4 +1,4 @@
-// +build darwin arm
+// +build darwin arm windows
 
 // Cross-compiling the snooper requires having pcap binaries,
 // let's disable it for now.
@@ -10,7 +10,7 @@ package endpoint
 type DNSSnooper struct{}
 
 // NewDNSSnooper creates a new snooper of DNS queries
-func NewDNSSnooper() (*DNSSnooper, error) {
+func NewDNSSnooper(perClient bool) (*DNSSnooper, error) {
 	return nil, nil
 }
 
@@ -20,6 +20,12 @@ func (s *DNSSnooper) CachedNamesForIP(ip string) []string {
 	return []string{}
 }
 
+// CachedNamesForIPFrom obtains the domains associated to an IP for a client
+// connecting to it
+func (s *DNSSnooper) CachedNamesForIPFrom(client, ip string) []string {
+	return []string{}
+}
+
 // Stop makes the snooper stop inspecting DNS communications
 func (s *DNSSnooper) Stop() {
 }
@@ -1,3 +1,5 @@
+// +build !windows
+
 package endpoint
 
 import (
@@ -36,6 +38,7 @@ type EbpfTracker struct {
 	stopping        bool
 	dead            bool
 	lastTimestampV4 uint64
+	lastTimestampV6 uint64
 
 	// debugBPF specifies if EbpfTracker must be started in debug mode. This
 	// allows to easily debug issues like:
@@ -55,6 +58,10 @@ type EbpfTracker struct {
 
 var releaseRegex = regexp.MustCompile(`^(\d+)\.(\d+).*$`)
 
+// kprobeEventsFile is where the tracer registers its kprobes on
+// tcp_v4_connect, inet_csk_accept, tcp_close etc.
+const kprobeEventsFile = "/sys/kernel/debug/tracing/kprobe_events"
+
 func isKernelSupported() error {
 	release, _, err := host.GetKernelReleaseAndVersion()
 	if err != nil {
@@ -87,10 +94,23 @@ func isKernelSupported() error {
 	return nil
 }
 
+// isKprobeSupported checks that the kprobe tracing interface is available,
+// so we can fall back to /proc scanning straight away rather than failing
+// half-way through loading the eBPF programs.
+func isKprobeSupported(kprobeEvents string) error {
+	if _, err := os.Stat(kprobeEvents); err != nil {
+		return fmt.Errorf("kprobes not available (is debugfs mounted on /sys/kernel/debug?): %v", err)
+	}
+	return nil
+}
+
 func newEbpfTracker() (*EbpfTracker, error) {
 	if err := isKernelSupported(); err != nil {
 		return nil, fmt.Errorf("kernel not supported: %v", err)
 	}
+	if err := isKprobeSupported(kprobeEventsFile); err != nil {
+		return nil, err
+	}
 
 	var debugBPF bool
 	if os.Getenv("SCOPE_DEBUG_BPF") != "" {
@@ -110,6 +130,21 @@ func newEbpfTracker() (*EbpfTracker, error) {
 
 // TCPEventV4 handles IPv4 TCP events from the eBPF tracer
 func (t *EbpfTracker) TCPEventV4(e tracer.TcpV4) {
+	t.tcpEvent(&t.lastTimestampV4, e.Timestamp, e.Type, e.Pid, e.Fd, e.NetNS,
+		fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort})
+}
+
+// TCPEventV6 handles IPv6 TCP events from the eBPF tracer. The addresses of
+// IPv4 connections of dual-stack sockets are IPv4-mapped, and come out as
+// their IPv4 addresses.
+func (t *EbpfTracker) TCPEventV6(e tracer.TcpV6) {
+	t.tcpEvent(&t.lastTimestampV6, e.Timestamp, e.Type, e.Pid, e.Fd, e.NetNS,
+		fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort})
+}
+
+// tcpEvent handles the TCP events of a family, the timestamps of which are
+// in order of their own.
+func (t *EbpfTracker) tcpEvent(lastTimestamp *uint64, timestamp uint64, typ tracer.EventType, pid, fd, netNS uint32, tuple fourTuple) {
 	if t.debugBPF {
 		debugBPFFile := "/var/run/scope/debug-bpf"
 		b, err := ioutil.ReadFile("/var/run/scope/debug-bpf")
@@ -121,42 +156,35 @@ func (t *EbpfTracker) TCPEventV4(e tracer.TcpV4) {
 		}
 	}
 
-	if t.lastTimestampV4 > e.Timestamp {
+	if *lastTimestamp > timestamp {
 		// A kernel bug can cause the timestamps to be wrong (e.g. on Ubuntu with Linux 4.4.0-47.68)
 		// Upgrading the kernel will fix the problem. For further info see:
 		// https://github.com/iovisor/bcc/issues/790#issuecomment-263704235
 		// https://github.com/weaveworks/scope/issues/2334
-		log.Errorf("tcp tracer received event with timestamp %v even though the last timestamp was %v. Stopping the eBPF tracker.", e.Timestamp, t.lastTimestampV4)
+		log.Errorf("tcp tracer received event with timestamp %v even though the last timestamp was %v. Stopping the eBPF tracker.", timestamp, *lastTimestamp)
 		t.stop()
 		return
 	}
 
-	t.lastTimestampV4 = e.Timestamp
+	*lastTimestamp = timestamp
 
-	if e.Type == tracer.EventFdInstall {
-		t.handleFdInstall(e.Type, int(e.Pid), int(e.Fd))
+	if typ == tracer.EventFdInstall {
+		t.handleFdInstall(typ, int(pid), int(fd))
 	} else {
-		tuple := fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort}
-		t.handleConnection(e.Type, tuple, int(e.Pid), strconv.Itoa(int(e.NetNS)))
+		t.handleConnection(typ, tuple, int(pid), strconv.Itoa(int(netNS)))
 	}
 }
 
-// TCPEventV6 handles IPv6 TCP events from the eBPF tracer. This is
-// currently a no-op.
-func (t *EbpfTracker) TCPEventV6(e tracer.TcpV6) {
-	// TODO: IPv6 not supported in Scope
-}
-
 // LostV4 handles IPv4 TCP event misses from the eBPF tracer.
 func (t *EbpfTracker) LostV4(count uint64) {
 	log.Errorf("tcp tracer lost %d events. Stopping the eBPF tracker", count)
 	t.stop()
 }
 
-// LostV6 handles IPv4 TCP event misses from the eBPF tracer. This is
-// currently a no-op.
+// LostV6 handles IPv6 TCP event misses from the eBPF tracer.
 func (t *EbpfTracker) LostV6(count uint64) {
-	// TODO: IPv6 not supported in Scope
+	log.Errorf("tcp tracer lost %d IPv6 events. Stopping the eBPF tracker", count)
+	t.stop()
 }
 
 func tupleFromPidFd(pid int, fd int) (tuple fourTuple, netns string, ok bool) {
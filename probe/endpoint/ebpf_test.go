@@ -1,7 +1,12 @@
+// +build !windows
+
 package endpoint
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
@@ -136,6 +141,41 @@ func TestHandleConnection(t *testing.T) {
 	}
 }
 
+func TestTCPEventV6(t *testing.T) {
+	mockEbpfTracker := newMockEbpfTracker()
+	connect := tracer.TcpV6{
+		Timestamp: 1,
+		Type:      tracer.EventConnect,
+		Pid:       43,
+		SAddr:     net.ParseIP("fd00::2"),
+		DAddr:     net.ParseIP("2001:db8::80"),
+		SPort:     41234,
+		DPort:     443,
+		NetNS:     123456789,
+	}
+	mockEbpfTracker.TCPEventV6(connect)
+	tuple := fourTuple{"fd00::2", "2001:db8::80", 41234, 443}
+	if conn, ok := mockEbpfTracker.openConnections[tuple]; !ok || conn.pid != 43 || conn.incoming {
+		t.Errorf("Expected the IPv6 connection to be open, got %v", mockEbpfTracker.openConnections)
+	}
+
+	// IPv4 connections of dual-stack sockets have IPv4-mapped addresses
+	accept := connect
+	accept.Timestamp, accept.Type = 2, tracer.EventAccept
+	accept.SAddr, accept.DAddr = net.ParseIP("::ffff:10.0.0.1"), net.ParseIP("::ffff:10.0.0.2")
+	mockEbpfTracker.TCPEventV6(accept)
+	if _, ok := mockEbpfTracker.openConnections[fourTuple{"10.0.0.1", "10.0.0.2", 41234, 443}]; !ok {
+		t.Errorf("Expected the IPv4 connection to be open, got %v", mockEbpfTracker.openConnections)
+	}
+
+	closing := connect
+	closing.Timestamp, closing.Type = 3, tracer.EventClose
+	mockEbpfTracker.TCPEventV6(closing)
+	if _, ok := mockEbpfTracker.openConnections[tuple]; ok {
+		t.Errorf("Expected the IPv6 connection to be closed")
+	}
+}
+
 func TestWalkConnections(t *testing.T) {
 	var (
 		cnt         int
@@ -233,3 +273,22 @@ func TestInvalidTimeStampDead(t *testing.T) {
 		t.Errorf("expected ebpfTracker to be set to dead after events with wrong order")
 	}
 }
+
+func TestKprobeSupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-kprobe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kprobeEvents := filepath.Join(dir, "kprobe_events")
+	if err := isKprobeSupported(kprobeEvents); err == nil {
+		t.Errorf("expected an error when %s is missing", kprobeEvents)
+	}
+	if err := ioutil.WriteFile(kprobeEvents, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := isKprobeSupported(kprobeEvents); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
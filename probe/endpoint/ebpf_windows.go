@@ -0,0 +1,36 @@
+package endpoint
+
+import (
+	"fmt"
+
+	"github.com/weaveworks/scope/probe/endpoint/procspy"
+)
+
+// An ebpfConnection represents a TCP connection
+type ebpfConnection struct {
+	tuple            fourTuple
+	networkNamespace string
+	incoming         bool
+	pid              int
+}
+
+// EbpfTracker is not supported on Windows: there is no eBPF, so connections
+// are always found by scanning.
+type EbpfTracker struct{}
+
+func newEbpfTracker() (*EbpfTracker, error) {
+	return nil, fmt.Errorf("eBPF tracking is not supported on Windows")
+}
+
+func (t *EbpfTracker) walkConnections(f func(ebpfConnection)) {}
+
+func (t *EbpfTracker) feedInitialConnections(conns procspy.ConnIter, seenTuples map[string]fourTuple, processesWaitingInAccept []int, hostNodeID string) {
+}
+
+func (t *EbpfTracker) isDead() bool { return true }
+
+func (t *EbpfTracker) stop() {}
+
+func (t *EbpfTracker) restart() error {
+	return fmt.Errorf("eBPF tracking is not supported on Windows")
+}
@@ -1,8 +1,9 @@
 package endpoint
 
 import (
-	"fmt"
+	"net"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -15,15 +16,21 @@ type fourTuple struct {
 }
 
 func (t fourTuple) String() string {
-	return fmt.Sprintf("%s:%d-%s:%d", t.fromAddr, t.fromPort, t.toAddr, t.toPort)
+	return hostPort(t.fromAddr, t.fromPort) + "-" + hostPort(t.toAddr, t.toPort)
+}
+
+// hostPort gives an address and port like "10.0.0.1:80", or
+// "[2001:db8::1]:80" for IPv6.
+func hostPort(addr string, port uint16) string {
+	return net.JoinHostPort(addr, strconv.Itoa(int(port)))
 }
 
 // key is a sortable direction-independent key for tuples, used to look up a
 // fourTuple when you are unsure of its direction.
 func (t fourTuple) key() string {
 	key := []string{
-		fmt.Sprintf("%s:%d", t.fromAddr, t.fromPort),
-		fmt.Sprintf("%s:%d", t.toAddr, t.toPort),
+		hostPort(t.fromAddr, t.fromPort),
+		hostPort(t.toAddr, t.toPort),
 	}
 	sort.Strings(key)
 	return strings.Join(key, " ")
@@ -138,3 +138,34 @@ func TestNat(t *testing.T) {
 		}
 	}
 }
+
+func TestNatAddressScope(t *testing.T) {
+	report.AddressScope = "cluster-a"
+	defer func() { report.AddressScope = "" }()
+
+	// A pod (10.0.47.1:80) of cluster-a, DNAT'd from its node (1.2.3.4:80)
+	ct := &mockFlowWalker{flows: []flow{{
+		Type: updateType,
+		Original: meta{
+			Layer3: layer3{SrcIP: "2.3.4.5", DstIP: "1.2.3.4"},
+			Layer4: layer4{SrcPort: 22222, DstPort: 80, Proto: "tcp"},
+		},
+		Reply: meta{
+			Layer3: layer3{SrcIP: "10.0.47.1", DstIP: "2.3.4.5"},
+			Layer4: layer4{SrcPort: 80, DstPort: 22222, Proto: "tcp"},
+		},
+		Independent: meta{ID: 1},
+	}}}
+	rpt := report.MakeReport()
+	originalID := "cluster-a;10.0.47.1;80"
+	rpt.Endpoint.AddNode(report.MakeNode(originalID))
+
+	makeNATMapper(ct).applyNAT(rpt, "host1")
+	copied, ok := rpt.Endpoint.Nodes[";1.2.3.4;80"]
+	if !ok {
+		t.Fatalf("Expected a copy of the pod endpoint, got %v", rpt.Endpoint.Nodes)
+	}
+	if copyOf, _ := copied.Latest.Lookup("copy_of"); copyOf != originalID {
+		t.Errorf("Expected a copy of %s, got %s", originalID, copyOf)
+	}
+}
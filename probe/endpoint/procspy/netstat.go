@@ -81,3 +81,66 @@ func parseDarwinNetstat(out string) []Connection {
 
 	return res
 }
+
+// parseWindowsNetstat parses the output of `netstat -ano`, which has both
+// IPv4 (ip:port) and IPv6 ([ip]:port) addresses, and the owning PID in the
+// last column.
+func parseWindowsNetstat(out string) []Connection {
+	//
+	//  Active Connections
+	//
+	//    Proto  Local Address          Foreign Address        State           PID
+	//    TCP    10.0.1.6:58287         1.2.3.4:443            ESTABLISHED     1234
+	//
+	res := []Connection{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "TCP" || fields[3] != "ESTABLISHED" {
+			continue
+		}
+
+		localAddress, localPort, ok := splitWindowsAddress(fields[1])
+		if !ok {
+			continue
+		}
+		remoteAddress, remotePort, ok := splitWindowsAddress(fields[2])
+		if !ok {
+			continue
+		}
+		pid, err := strconv.ParseUint(fields[4], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		res = append(res, Connection{
+			Transport:     "tcp",
+			LocalAddress:  localAddress,
+			LocalPort:     localPort,
+			RemoteAddress: remoteAddress,
+			RemotePort:    remotePort,
+			Proc:          Proc{PID: uint(pid)},
+		})
+	}
+
+	return res
+}
+
+func splitWindowsAddress(addr string) (net.IP, uint16, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, false
+	}
+	// Strip the zone of link-local IPv6 addresses, e.g. [fe80::1%4]
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	return ip, uint16(p), true
+}
@@ -56,3 +56,48 @@ tcp4       0      0  10.0.1.6.1         	4.0.4.0.443    			GONE
 	}
 
 }
+
+func TestNetstatWindows(t *testing.T) {
+	testString := `
+Active Connections
+
+  Proto  Local Address          Foreign Address        State           PID
+  TCP    0.0.0.0:135            0.0.0.0:0              LISTENING       948
+  TCP    10.0.1.6:58287         1.2.3.4:443            ESTABLISHED     1234
+  TCP    10.0.1.6:58279         2.3.4.5:80             TIME_WAIT       0
+  TCP    [::1]:6600             [::1]:41993            ESTABLISHED     42
+  TCP    [fe80::1%4]:5357       [fe80::2%4]:50123      ESTABLISHED     4
+  UDP    0.0.0.0:5353           *:*                                    1500
+`
+	res := parseWindowsNetstat(testString)
+	expected := []Connection{
+		{
+			Transport:     "tcp",
+			LocalAddress:  net.ParseIP("10.0.1.6"),
+			LocalPort:     58287,
+			RemoteAddress: net.ParseIP("1.2.3.4"),
+			RemotePort:    443,
+			Proc:          Proc{PID: 1234},
+		},
+		{
+			Transport:     "tcp",
+			LocalAddress:  net.ParseIP("::1"),
+			LocalPort:     6600,
+			RemoteAddress: net.ParseIP("::1"),
+			RemotePort:    41993,
+			Proc:          Proc{PID: 42},
+		},
+		{
+			Transport:     "tcp",
+			LocalAddress:  net.ParseIP("fe80::1"),
+			LocalPort:     5357,
+			RemoteAddress: net.ParseIP("fe80::2"),
+			RemotePort:    50123,
+			Proc:          Proc{PID: 4},
+		},
+	}
+
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Windows netstat error. Got\n%+v\nExpected\n%+v\n", res, expected)
+	}
+}
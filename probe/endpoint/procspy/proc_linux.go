@@ -97,6 +97,16 @@ func getNetNamespacePathSuffix() string {
 
 // ReadTCPFiles reads the proc files tcp and tcp6 for a pid
 func ReadTCPFiles(pid int, buf *bytes.Buffer) (int64, error) {
+	// even for tcp4 connections, we need to read the "tcp6" file because of IPv4-Mapped IPv6 Addresses
+	return readNetFiles(pid, "tcp", buf)
+}
+
+// ReadUDPFiles reads the proc files udp and udp6 for a pid
+func ReadUDPFiles(pid int, buf *bytes.Buffer) (int64, error) {
+	return readNetFiles(pid, "udp", buf)
+}
+
+func readNetFiles(pid int, proto string, buf *bytes.Buffer) (int64, error) {
 	var (
 		errRead  error
 		errRead6 error
@@ -104,12 +114,10 @@ func ReadTCPFiles(pid int, buf *bytes.Buffer) (int64, error) {
 		read6    int64
 	)
 
-	// even for tcp4 connections, we need to read the "tcp6" file because of IPv4-Mapped IPv6 Addresses
-
 	dirName := strconv.Itoa(pid)
-	read, errRead = readFile(filepath.Join(procRoot, dirName, "/net/tcp"), buf)
+	read, errRead = readFile(filepath.Join(procRoot, dirName, "/net/"+proto), buf)
 	if ipv6IsSupported {
-		read6, errRead6 = readFile(filepath.Join(procRoot, dirName, "/net/tcp6"), buf)
+		read6, errRead6 = readFile(filepath.Join(procRoot, dirName, "/net/"+proto+"6"), buf)
 	}
 
 	if errRead != nil {
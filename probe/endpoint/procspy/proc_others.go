@@ -1,3 +1,5 @@
+// +build !linux
+
 package procspy
 
 import (
@@ -10,6 +12,11 @@ func ReadTCPFiles(pid int, buf *bytes.Buffer) (int64, error) {
 	return 0, fmt.Errorf("not supported on non-Linux systems")
 }
 
+// ReadUDPFiles reads the proc files udp and udp6 for a pid
+func ReadUDPFiles(pid int, buf *bytes.Buffer) (int64, error) {
+	return 0, fmt.Errorf("not supported on non-Linux systems")
+}
+
 // ReadNetnsFromPID gets the netns inode of the specified pid
 func ReadNetnsFromPID(pid int) (uint64, error) {
 	return 0, fmt.Errorf("not supported on non-Linux systems")
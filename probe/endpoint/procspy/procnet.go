@@ -14,6 +14,7 @@ type ProcNet struct {
 	c                       Connection
 	bytesLocal, bytesRemote [16]byte
 	seen                    map[uint64]struct{}
+	listening               bool
 }
 
 // NewProcNet gives a new ProcNet parser.
@@ -25,6 +26,22 @@ func NewProcNet(b []byte) *ProcNet {
 	}
 }
 
+// NewUDPProcNet gives a new ProcNet parser for /proc/net/udp{,6} files. Only
+// connected sockets are returned, since the others have no remote address.
+func NewUDPProcNet(b []byte) *ProcNet {
+	p := NewProcNet(b)
+	p.c.Transport = "udp"
+	return p
+}
+
+// NewListeningProcNet gives a new ProcNet parser returning the listening
+// sockets of /proc/net/tcp{,6} files, rather than the connections.
+func NewListeningProcNet(b []byte) *ProcNet {
+	p := NewProcNet(b)
+	p.listening = true
+	return p
+}
+
 // Next returns the next connection. All buffers are re-used, so if you want
 // to keep the IPs you have to copy them.
 func (p *ProcNet) Next() *Connection {
@@ -47,9 +64,14 @@ again:
 	local, b = nextField(b)
 	remote, b = nextField(b)
 	state, b = nextField(b)
-	switch parseHex(state) {
+	switch st := parseHex(state); {
+	case p.listening:
+		if st != tcpListen {
+			p.b = nextLine(b)
+			goto again
+		}
 	// Only process established or half-closed connections
-	case tcpEstablished, tcpFinWait1, tcpFinWait2, tcpCloseWait:
+	case st == tcpEstablished, st == tcpFinWait1, st == tcpFinWait2, st == tcpCloseWait:
 	default:
 		p.b = nextLine(b)
 		goto again
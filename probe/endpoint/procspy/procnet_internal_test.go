@@ -57,6 +57,49 @@ func TestProcNet(t *testing.T) {
 
 }
 
+func TestUDPProcNet(t *testing.T) {
+	// Abridged /proc/net/udp: a DNS client (connected) and a listener (unconnected)
+	testString := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+ 1234: 0F02000A:A1B2 0A00000A:0035 01 00000000:00000000 00:00000000 00000000     0        0 71231 2 ffff88007c0b6c00 0
+ 4379: 00000000:14E9 00000000:0000 07 00000000:00000000 00:00000000 00000000   104        0 11064 2 ffff88007c0b6400 0
+`
+	p := NewUDPProcNet([]byte(testString))
+	want := Connection{
+		Transport:     "udp",
+		LocalAddress:  net.IP([]byte{10, 0, 2, 15}),
+		LocalPort:     0xa1b2,
+		RemoteAddress: net.IP([]byte{10, 0, 0, 10}),
+		RemotePort:    53,
+		Inode:         71231,
+	}
+	if have := p.Next(); have == nil || !reflect.DeepEqual(*have, want) {
+		t.Errorf("got\n%+v\nExpected\n%+v\n", have, want)
+	}
+	if got := p.Next(); got != nil {
+		t.Errorf("unconnected socket wasn't skipped: %+v", *got)
+	}
+}
+
+func TestListeningProcNet(t *testing.T) {
+	testString := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout Inode
+   0: 00000000:01BB 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5107 1 ffff8800a6aaf040 100 0 0 10 0
+   1: A12CF62E:E4D7 57FC1EC0:01BB 01 00000000:00000000 02:000006FA 00000000  1000        0 639474 2 ffff88007e75a740 48 4 26 10 -1
+`
+	p := NewListeningProcNet([]byte(testString))
+	want := Connection{
+		LocalAddress:  net.IP([]byte{0, 0, 0, 0}),
+		LocalPort:     443,
+		RemoteAddress: net.IP([]byte{0, 0, 0, 0}),
+		Inode:         5107,
+	}
+	if have := p.Next(); have == nil || !reflect.DeepEqual(*have, want) {
+		t.Errorf("got\n%+v\nExpected\n%+v\n", have, want)
+	}
+	if got := p.Next(); got != nil {
+		t.Errorf("connection wasn't skipped: %+v", *got)
+	}
+}
+
 func TestTransport6(t *testing.T) {
 	// Abridged copy of my /proc/net/tcp6
 	testString := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout Inode
@@ -1,6 +1,7 @@
 // Package procspy lists TCP connections, and optionally tries to find the
-// owning processes. Works on Linux (via /proc) and Darwin (via `lsof -i` and
-// `netstat`). You'll need root to use Processes().
+// owning processes. Works on Linux (via /proc), Darwin (via `lsof -i` and
+// `netstat`) and Windows (via `netstat -ano`). You'll need root to use
+// Processes().
 package procspy
 
 import (
@@ -13,6 +14,7 @@ const (
 	tcpFinWait1    = 4
 	tcpFinWait2    = 5
 	tcpCloseWait   = 8
+	tcpListen      = 10
 )
 
 // Connection is a (TCP) connection. The Proc struct might not be filled in.
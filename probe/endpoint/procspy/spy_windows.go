@@ -0,0 +1,60 @@
+package procspy
+
+import (
+	"os/exec"
+
+	"github.com/weaveworks/scope/probe/process"
+)
+
+const netstatBinary = "netstat"
+
+// NewConnectionScanner creates a new Windows ConnectionScanner
+func NewConnectionScanner(walker process.Walker, processes bool) ConnectionScanner {
+	return &windowsScanner{walker, processes}
+}
+
+// NewSyncConnectionScanner creates a new synchronous Windows ConnectionScanner
+func NewSyncConnectionScanner(walker process.Walker, processes bool) ConnectionScanner {
+	return &windowsScanner{walker, processes}
+}
+
+type windowsScanner struct {
+	walker    process.Walker
+	processes bool
+}
+
+// Connections returns all established (TCP) connections.
+func (s *windowsScanner) Connections() (ConnIter, error) {
+	out, err := exec.Command(
+		netstatBinary,
+		"-a", // all connections
+		"-n", // no number resolving
+		"-o", // owning PID
+	).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	connections := parseWindowsNetstat(string(out))
+
+	if s.processes {
+		names := map[uint]string{}
+		if err := s.walker.Walk(func(p, _ process.Process) {
+			names[uint(p.PID)] = p.Name
+		}); err != nil {
+			return nil, err
+		}
+		for i, c := range connections {
+			connections[i].Proc.Name = names[c.Proc.PID]
+		}
+	} else {
+		for i := range connections {
+			connections[i].Proc = Proc{}
+		}
+	}
+
+	f := fixedConnIter(connections)
+	return &f, nil
+}
+
+// Nothing to stop since there's nothing running in the background
+func (s *windowsScanner) Stop() {}
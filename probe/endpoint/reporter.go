@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"math/rand"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,11 +24,29 @@ type ReporterConfig struct {
 	UseConntrack bool
 	WalkProc     bool
 	UseEbpfConn  bool
+	TrackUDP     bool
 	ProcRoot     string
 	BufferSize   int
 	ProcessCache *process.CachingWalker
 	Scanner      procspy.ConnectionScanner
 	DNSSnooper   *DNSSnooper
+	// TCPStats reports the RTT, retransmissions and byte and packet counts
+	// of TCP connections on their edges.
+	TCPStats bool
+	// TrackAttempts reports the TCP connections conntrack saw attempted,
+	// but never answered, as attempted edges.
+	TrackAttempts bool
+	// MaxEdges is the number of edges over which they are sampled; 0
+	// keeps them all.
+	MaxEdges int
+	// TLSInspectInterval is how often listening sockets are inspected for
+	// the certificates of TLS; 0 doesn't inspect them.
+	TLSInspectInterval time.Duration
+	// RuntimeCollectors collect the metrics of the runtimes of processes
+	// with listening sockets, every RuntimeInspectInterval; none doesn't
+	// collect them.
+	RuntimeCollectors      []RuntimeCollector
+	RuntimeInspectInterval time.Duration
 }
 
 // Reporter generates Reports containing the Endpoint topology.
@@ -35,6 +54,8 @@ type Reporter struct {
 	conf              ReporterConfig
 	connectionTracker connectionTracker
 	natMapper         natMapper
+	tlsInspector      *tlsInspector
+	runtimeInspector  *runtimeInspector
 }
 
 // SpyDuration is an exported prometheus metric
@@ -55,7 +76,7 @@ var SpyDuration = prometheus.NewSummaryVec(
 // is stored in the Endpoint topology. It optionally enriches that topology
 // with process (PID) information.
 func NewReporter(conf ReporterConfig) *Reporter {
-	return &Reporter{
+	r := &Reporter{
 		conf: conf,
 		connectionTracker: newConnectionTracker(connectionTrackerConfig{
 			HostID:       conf.HostID,
@@ -64,14 +85,25 @@ func NewReporter(conf ReporterConfig) *Reporter {
 			UseConntrack: conf.UseConntrack,
 			WalkProc:     conf.WalkProc,
 			UseEbpfConn:  conf.UseEbpfConn,
+			TrackUDP:     conf.TrackUDP,
 			ProcRoot:     conf.ProcRoot,
 			BufferSize:   conf.BufferSize,
 			ProcessCache: conf.ProcessCache,
 			Scanner:      conf.Scanner,
 			DNSSnooper:   conf.DNSSnooper,
+			TCPStats:     conf.TCPStats,
+
+			TrackAttempts: conf.TrackAttempts,
 		}),
-		natMapper: makeNATMapper(newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, "--any-nat")),
+		natMapper: makeNATMapper(newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, tcpProto, true, false)),
+	}
+	if conf.TLSInspectInterval > 0 {
+		r.tlsInspector = newTLSInspector(conf.ProcRoot, conf.TLSInspectInterval)
 	}
+	if len(conf.RuntimeCollectors) > 0 && conf.RuntimeInspectInterval > 0 {
+		r.runtimeInspector = newRuntimeInspector(conf.ProcRoot, conf.RuntimeInspectInterval, conf.RuntimeCollectors)
+	}
+	return r
 }
 
 // Name of this reporter, for metrics gathering
@@ -81,6 +113,12 @@ func (Reporter) Name() string { return "Endpoint" }
 func (r *Reporter) Stop() {
 	r.connectionTracker.Stop()
 	r.natMapper.stop()
+	if r.tlsInspector != nil {
+		r.tlsInspector.stop()
+	}
+	if r.runtimeInspector != nil {
+		r.runtimeInspector.stop()
+	}
 	if r.conf.Scanner != nil {
 		r.conf.Scanner.Stop()
 	}
@@ -96,5 +134,12 @@ func (r *Reporter) Report() (report.Report, error) {
 
 	r.connectionTracker.ReportConnections(&rpt)
 	r.natMapper.applyNAT(rpt, r.conf.HostID)
+	sampleEdges(&rpt.Endpoint, r.conf.MaxEdges, rand.Float64)
+	if r.tlsInspector != nil {
+		r.tlsInspector.tag(&rpt, r.conf.HostID)
+	}
+	if r.runtimeInspector != nil {
+		r.runtimeInspector.tag(&rpt, r.conf.HostID)
+	}
 	return rpt, nil
 }
@@ -0,0 +1,342 @@
+package endpoint
+
+import (
+	"bufio"
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Metric IDs of the runtimes of processes.
+const (
+	RuntimeHeapBytes = "runtime_heap_bytes"
+	RuntimeGCCount   = "runtime_gc_count"
+	RuntimeGCPause   = "runtime_gc_pause_ms"
+	RuntimeThreads   = "runtime_threads"
+)
+
+const (
+	runtimeRequestTimeout = 2 * time.Second
+
+	// runtimeRediscoverInterval is how long to wait before looking again
+	// for the endpoint of a process on a runtime, once none answered.
+	runtimeRediscoverInterval = time.Minute
+)
+
+// RuntimeMetricTemplates are the metric templates of processes whose runtime
+// metrics are collected.
+var RuntimeMetricTemplates = report.MetricTemplates{
+	RuntimeHeapBytes: {ID: RuntimeHeapBytes, Label: "Heap", Format: report.FilesizeFormat, Priority: 10},
+	RuntimeGCPause:   {ID: RuntimeGCPause, Label: "GC pause (ms)", Priority: 11},
+	RuntimeGCCount:   {ID: RuntimeGCCount, Label: "GCs", Format: report.IntegerFormat, Priority: 12},
+	RuntimeThreads:   {ID: RuntimeThreads, Label: "Goroutines / threads", Format: report.IntegerFormat, Priority: 13},
+}
+
+// RuntimeCollector collects the metrics of the runtime of processes, such as
+// the JVM, from an HTTP endpoint they serve. Collectors for more runtimes can
+// be added to the ReporterConfig.
+type RuntimeCollector interface {
+	// Name of the runtime, for logging.
+	Name() string
+	// Detect tells whether the process with the /proc directory procDir
+	// runs on the runtime.
+	Detect(procDir string) bool
+	// Collect gets the metrics of the runtime from a listener of the
+	// process; it fails if the listener isn't its endpoint.
+	Collect(client *http.Client, addr string, now time.Time) (map[string]report.Metric, error)
+}
+
+// runtimeProcess is what the runtime inspector knows of a process.
+type runtimeProcess struct {
+	collector  RuntimeCollector // nil if the process runs on none
+	addr       string           // where the endpoint was found, if it was
+	retryAfter time.Time        // when to look again for the endpoint
+}
+
+// runtimeInspector periodically collects the runtime metrics of the
+// processes with listening sockets in the network namespace of the probe,
+// from the first of their listeners answering the collector of their
+// runtime.
+type runtimeInspector struct {
+	procRoot   string
+	interval   time.Duration
+	collectors []RuntimeCollector
+	listeners  func() ([]listeningSocket, error)
+	client     *http.Client
+	quit       chan struct{}
+	processes  map[int]*runtimeProcess
+
+	sync.RWMutex
+	metrics map[int]map[string]report.Metric // by PID
+}
+
+func newRuntimeInspector(procRoot string, interval time.Duration, collectors []RuntimeCollector) *runtimeInspector {
+	r := &runtimeInspector{
+		procRoot:   procRoot,
+		interval:   interval,
+		collectors: collectors,
+		listeners:  func() ([]listeningSocket, error) { return listeningSockets(procRoot) },
+		client:     &http.Client{Timeout: runtimeRequestTimeout},
+		quit:       make(chan struct{}),
+		processes:  map[int]*runtimeProcess{},
+		metrics:    map[int]map[string]report.Metric{},
+	}
+	go r.loop()
+	return r
+}
+
+func (r *runtimeInspector) loop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.inspect()
+		select {
+		case <-ticker.C:
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+func (r *runtimeInspector) stop() {
+	close(r.quit)
+}
+
+func (r *runtimeInspector) detect(pid int) RuntimeCollector {
+	procDir := filepath.Join(r.procRoot, strconv.Itoa(pid))
+	for _, c := range r.collectors {
+		if c.Detect(procDir) {
+			return c
+		}
+	}
+	return nil
+}
+
+// inspect collects the metrics of the processes on a runtime, replacing the
+// ones collected previously.
+func (r *runtimeInspector) inspect() {
+	listeners, err := r.listeners()
+	if err != nil {
+		log.Warnf("Runtime inspector: cannot list listening sockets: %v", err)
+		return
+	}
+	addrs := map[int][]string{}
+	for _, l := range listeners {
+		addrs[l.PID] = append(addrs[l.PID], dialAddress(l.Addr, l.Port))
+	}
+
+	now := mtime.Now()
+	processes := map[int]*runtimeProcess{}
+	metrics := map[int]map[string]report.Metric{}
+	for pid, candidates := range addrs {
+		p, ok := r.processes[pid]
+		if !ok {
+			p = &runtimeProcess{collector: r.detect(pid)}
+		}
+		processes[pid] = p
+		if p.collector == nil {
+			continue
+		}
+		if p.addr != "" {
+			if m, err := p.collector.Collect(r.client, p.addr, now); err == nil {
+				metrics[pid] = m
+				continue
+			}
+			p.addr = ""
+		}
+		if now.Before(p.retryAfter) {
+			continue
+		}
+		for _, addr := range candidates {
+			if m, err := p.collector.Collect(r.client, addr, now); err == nil {
+				log.Debugf("Runtime inspector: found the %s endpoint of PID %d on %s", p.collector.Name(), pid, addr)
+				p.addr, metrics[pid] = addr, m
+				break
+			}
+		}
+		if p.addr == "" {
+			p.retryAfter = now.Add(runtimeRediscoverInterval)
+		}
+	}
+	r.processes = processes
+
+	r.Lock()
+	r.metrics = metrics
+	r.Unlock()
+}
+
+// tag adds the metrics collected to the processes of the report.
+func (r *runtimeInspector) tag(rpt *report.Report, hostID string) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.metrics) == 0 {
+		return
+	}
+	rpt.Process = rpt.Process.WithMetricTemplates(RuntimeMetricTemplates)
+	for pid, metrics := range r.metrics {
+		node := report.MakeNode(report.MakeProcessNodeID(hostID, strconv.Itoa(pid)))
+		for id, metric := range metrics {
+			node = node.WithMetric(id, metric)
+		}
+		rpt.Process = rpt.Process.AddNode(node)
+	}
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GoRuntimeCollector collects the metrics of Go programs serving expvar
+// (/debug/vars), and the number of goroutines if they serve pprof too.
+type GoRuntimeCollector struct{}
+
+// Name implements RuntimeCollector.
+func (GoRuntimeCollector) Name() string { return "Go" }
+
+// Detect implements RuntimeCollector, by looking for the sections the Go
+// linker adds to binaries.
+func (GoRuntimeCollector) Detect(procDir string) bool {
+	f, err := elf.Open(filepath.Join(procDir, "exe"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	for _, section := range []string{".go.buildinfo", ".gopclntab", ".note.go.buildid"} {
+		if f.Section(section) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect implements RuntimeCollector.
+func (GoRuntimeCollector) Collect(client *http.Client, addr string, now time.Time) (map[string]report.Metric, error) {
+	var vars struct {
+		Memstats *struct {
+			HeapAlloc, HeapSys float64
+			NumGC              uint32
+			PauseNs            [256]uint64
+		} `json:"memstats"`
+	}
+	if err := getJSON(client, "http://"+addr+"/debug/vars", &vars); err != nil {
+		return nil, err
+	}
+	if vars.Memstats == nil {
+		return nil, fmt.Errorf("no memstats in the expvars of %s", addr)
+	}
+	m := vars.Memstats
+	result := map[string]report.Metric{
+		RuntimeHeapBytes: report.MakeSingletonMetric(now, m.HeapAlloc).WithMax(m.HeapSys),
+		RuntimeGCCount:   report.MakeSingletonMetric(now, float64(m.NumGC)),
+	}
+	if m.NumGC > 0 {
+		lastPause := m.PauseNs[(m.NumGC+255)%256]
+		result[RuntimeGCPause] = report.MakeSingletonMetric(now, float64(lastPause)/float64(time.Millisecond))
+	}
+	if goroutines, err := goroutineCount(client, addr); err == nil {
+		result[RuntimeThreads] = report.MakeSingletonMetric(now, float64(goroutines))
+	}
+	return result, nil
+}
+
+// goroutineCount reads the first line of the goroutine profile, as in
+// "goroutine profile: total 42".
+func goroutineCount(client *http.Client, addr string) (int, error) {
+	resp, err := client.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	if _, err := fmt.Sscanf(line, "goroutine profile: total %d", &total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// JVMRuntimeCollector collects the metrics of JVMs exposing JMX over HTTP
+// with the Jolokia agent (/jolokia).
+type JVMRuntimeCollector struct{}
+
+// Name implements RuntimeCollector.
+func (JVMRuntimeCollector) Name() string { return "JVM" }
+
+// Detect implements RuntimeCollector, by the name of the executable.
+func (JVMRuntimeCollector) Detect(procDir string) bool {
+	exe, err := os.Readlink(filepath.Join(procDir, "exe"))
+	return err == nil && filepath.Base(exe) == "java"
+}
+
+// Collect implements RuntimeCollector.
+func (JVMRuntimeCollector) Collect(client *http.Client, addr string, now time.Time) (map[string]report.Metric, error) {
+	base := "http://" + addr + "/jolokia/read/"
+	var heap struct {
+		Value struct {
+			Used, Max float64
+		} `json:"value"`
+		Status int `json:"status"`
+	}
+	if err := getJSON(client, base+"java.lang:type=Memory/HeapMemoryUsage", &heap); err != nil {
+		return nil, err
+	}
+	if heap.Status != http.StatusOK {
+		return nil, fmt.Errorf("jolokia status %d", heap.Status)
+	}
+	heapMetric := report.MakeSingletonMetric(now, heap.Value.Used)
+	if heap.Value.Max > 0 {
+		heapMetric = heapMetric.WithMax(heap.Value.Max)
+	}
+	result := map[string]report.Metric{RuntimeHeapBytes: heapMetric}
+
+	var gcs struct {
+		Value map[string]struct {
+			CollectionCount, CollectionTime float64
+		} `json:"value"`
+	}
+	if err := getJSON(client, base+"java.lang:type=GarbageCollector,name=*/CollectionCount,CollectionTime", &gcs); err == nil {
+		var count, millis float64
+		for name, gc := range gcs.Value {
+			if strings.Contains(name, "type=GarbageCollector") {
+				count += gc.CollectionCount
+				millis += gc.CollectionTime
+			}
+		}
+		result[RuntimeGCCount] = report.MakeSingletonMetric(now, count)
+		if count > 0 {
+			// JMX only has the total time spent collecting
+			result[RuntimeGCPause] = report.MakeSingletonMetric(now, millis/count)
+		}
+	}
+
+	var threads struct {
+		Value float64 `json:"value"`
+	}
+	if err := getJSON(client, base+"java.lang:type=Threading/ThreadCount", &threads); err == nil {
+		result[RuntimeThreads] = report.MakeSingletonMetric(now, threads.Value)
+	}
+	return result, nil
+}
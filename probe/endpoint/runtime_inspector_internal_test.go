@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// pidRuntimeCollector is the Go collector, for the processes with PID 1.
+type pidRuntimeCollector struct {
+	GoRuntimeCollector
+}
+
+func (pidRuntimeCollector) Detect(procDir string) bool {
+	return filepath.Base(procDir) == "1"
+}
+
+func TestRuntimeInspector(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/goroutine", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "goroutine profile: total 42\n1 @ 0x42\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+
+	listener := func(pid int, s *httptest.Server) listeningSocket {
+		return listeningSocket{PID: pid, Addr: net.IPv4zero, Port: uint16(s.Listener.Addr().(*net.TCPAddr).Port)}
+	}
+	inspector := &runtimeInspector{
+		procRoot:   "/proc",
+		collectors: []RuntimeCollector{pidRuntimeCollector{}},
+		listeners: func() ([]listeningSocket, error) {
+			return []listeningSocket{listener(1, other), listener(1, server), listener(2, server)}, nil
+		},
+		client:    &http.Client{Timeout: time.Second},
+		processes: map[int]*runtimeProcess{},
+	}
+	inspector.inspect()
+	if addr := inspector.processes[1].addr; addr != server.Listener.Addr().String() {
+		t.Errorf("Expected the endpoint to be found on %s, got %q", server.Listener.Addr(), addr)
+	}
+
+	rpt := report.MakeReport()
+	inspector.tag(&rpt, "host")
+	if len(rpt.Process.Nodes) != 1 {
+		t.Fatalf("Expected only the Go process to be tagged, got %v", rpt.Process.Nodes)
+	}
+	node, ok := rpt.Process.Nodes[report.MakeProcessNodeID("host", "1")]
+	if !ok {
+		t.Fatalf("Expected the Go process, got %v", rpt.Process.Nodes)
+	}
+	if heap, ok := node.Metrics[RuntimeHeapBytes]; !ok || heap.Max == 0 {
+		t.Errorf("Unexpected heap metric %v", heap)
+	}
+	if goroutines, ok := node.Metrics[RuntimeThreads].LastSample(); !ok || goroutines.Value != 42 {
+		t.Errorf("Unexpected goroutines %v", goroutines)
+	}
+	if _, ok := rpt.Process.MetricTemplates[RuntimeHeapBytes]; !ok {
+		t.Errorf("Expected the runtime metric templates, got %v", rpt.Process.MetricTemplates)
+	}
+}
+
+func TestJVMRuntimeCollector(t *testing.T) {
+	responses := map[string]string{
+		"/jolokia/read/java.lang:type=Memory/HeapMemoryUsage": `{"value":{"used":1024,"max":4096},"status":200}`,
+		"/jolokia/read/java.lang:type=GarbageCollector,name=*/CollectionCount,CollectionTime": `{"value":{
+			"java.lang:name=PS Scavenge,type=GarbageCollector":{"CollectionCount":3,"CollectionTime":30},
+			"java.lang:name=PS MarkSweep,type=GarbageCollector":{"CollectionCount":1,"CollectionTime":50}},"status":200}`,
+		"/jolokia/read/java.lang:type=Threading/ThreadCount": `{"value":17,"status":200}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	metrics, err := JVMRuntimeCollector{}.Collect(http.DefaultClient, server.Listener.Addr().String(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]float64{
+		RuntimeHeapBytes: 1024,
+		RuntimeGCCount:   4,
+		RuntimeGCPause:   20,
+		RuntimeThreads:   17,
+	} {
+		if sample, ok := metrics[id].LastSample(); !ok || sample.Value != want {
+			t.Errorf("Expected %s to be %v, got %v", id, want, sample)
+		}
+	}
+	if metrics[RuntimeHeapBytes].Max != 4096 {
+		t.Errorf("Unexpected heap max %v", metrics[RuntimeHeapBytes].Max)
+	}
+}
@@ -0,0 +1,106 @@
+package endpoint
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// SampleRate is the Latest key of the endpoints whose edges were kept by
+// sampling, with the fraction of such endpoints which were kept. Counts of
+// connections from those endpoints should be scaled up by its inverse.
+const SampleRate = "endpoint_sample_rate"
+
+type sampledEndpoint struct {
+	id    string
+	edges int
+	bytes uint64
+}
+
+type endpointsByBytes []sampledEndpoint
+
+func (s endpointsByBytes) Len() int      { return len(s) }
+func (s endpointsByBytes) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s endpointsByBytes) Less(i, j int) bool {
+	if s[i].bytes != s[j].bytes {
+		return s[i].bytes > s[j].bytes
+	}
+	return s[i].id < s[j].id
+}
+
+// sampleEdges brings the number of edges of an endpoint topology down to
+// about maxEdges, when it has more. Endpoints are kept or dropped with all
+// their outgoing edges. Up to half of maxEdges are kept from the endpoints
+// which transferred the most bytes; the rest are a random sample of the
+// other endpoints, tagged with the sample rate. random gives numbers in
+// [0.0,1.0).
+func sampleEdges(t *report.Topology, maxEdges int, random func() float64) {
+	if maxEdges <= 0 {
+		return
+	}
+	var (
+		sources []sampledEndpoint
+		total   int
+	)
+	for id, n := range t.Nodes {
+		if len(n.Adjacency) == 0 {
+			continue
+		}
+		e := sampledEndpoint{id: id, edges: len(n.Adjacency)}
+		md := n.Edges.Flatten()
+		if md.EgressByteCount != nil {
+			e.bytes += *md.EgressByteCount
+		}
+		if md.IngressByteCount != nil {
+			e.bytes += *md.IngressByteCount
+		}
+		sources = append(sources, e)
+		total += e.edges
+	}
+	if total <= maxEdges {
+		return
+	}
+	sort.Sort(endpointsByBytes(sources))
+
+	// The top endpoints by bytes
+	kept := 0
+	i := 0
+	for ; i < len(sources) && sources[i].bytes > 0 && kept+sources[i].edges <= maxEdges/2; i++ {
+		kept += sources[i].edges
+	}
+
+	// A sample of the rest
+	rest := sources[i:]
+	restEdges := total - kept
+	rate := float64(maxEdges-kept) / float64(restEdges)
+	rateStr := strconv.FormatFloat(rate, 'g', 4, 64)
+	dropped := map[string]struct{}{}
+	for _, e := range rest {
+		if random() < rate {
+			t.Nodes[e.id] = t.Nodes[e.id].WithLatests(map[string]string{SampleRate: rateStr})
+			continue
+		}
+		dropped[e.id] = struct{}{}
+	}
+
+	// Drop the endpoints which weren't sampled, and the endpoints only they
+	// had edges to.
+	orphans := map[string]struct{}{}
+	for id := range dropped {
+		for _, dst := range t.Nodes[id].Adjacency {
+			orphans[dst] = struct{}{}
+		}
+		delete(t.Nodes, id)
+	}
+	for _, n := range t.Nodes {
+		for _, dst := range n.Adjacency {
+			delete(orphans, dst)
+		}
+	}
+	for id := range orphans {
+		if n, ok := t.Nodes[id]; ok && len(n.Adjacency) == 0 {
+			delete(t.Nodes, id)
+		}
+	}
+}
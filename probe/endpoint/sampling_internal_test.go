@@ -0,0 +1,68 @@
+package endpoint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSampleEdges(t *testing.T) {
+	ten := uint64(10)
+	topology := report.MakeTopology()
+	// 10 client endpoints to a server, the first two with byte counts
+	server := report.MakeEndpointNodeID("host", "", "10.0.0.1", "80")
+	topology.AddNode(report.MakeNode(server))
+	for i := 0; i < 10; i++ {
+		edge := report.EdgeMetadata{}
+		if i < 2 {
+			edge.EgressByteCount = &ten
+		}
+		id := report.MakeEndpointNodeID("host", "", fmt.Sprintf("10.0.1.%d", i), "40000")
+		topology.AddNode(report.MakeNode(id).WithEdge(server, edge))
+	}
+	// An endpoint only reached by a client which will be dropped
+	lonely := report.MakeEndpointNodeID("host", "", "10.0.0.2", "80")
+	topology.AddNode(report.MakeNode(lonely))
+	topology.AddNode(report.MakeNode(report.MakeEndpointNodeID("host", "", "10.0.2.1", "40000")).WithEdge(lonely, report.EdgeMetadata{}))
+
+	// Under the limit, nothing changes
+	unsampled := topology.Copy()
+	sampleEdges(&unsampled, 11, func() float64 { return 0.99 })
+	if len(unsampled.Nodes) != len(topology.Nodes) {
+		t.Errorf("Expected %d nodes, got %d", len(topology.Nodes), len(unsampled.Nodes))
+	}
+
+	// The 2 busiest clients are kept, and 2 of the other 9 by random
+	// numbers under 2/9. The others are taken in order of their IDs.
+	randoms := []float64{0.1, 0.9, 0.2, 0.9, 0.9, 0.9, 0.9, 0.9, 0.9}
+	sampleEdges(&topology, 4, func() float64 {
+		r := randoms[0]
+		randoms = randoms[1:]
+		return r
+	})
+	var edges, sampled int
+	for _, n := range topology.Nodes {
+		edges += len(n.Adjacency)
+		if rate, ok := n.Latest.Lookup(SampleRate); ok {
+			sampled++
+			if rate != "0.2222" {
+				t.Errorf("Unexpected rate %s", rate)
+			}
+		}
+		if md := n.Edges.Flatten(); md.EgressByteCount != nil {
+			if _, ok := n.Latest.Lookup(SampleRate); ok {
+				t.Errorf("Expected busy %s not to be sampled", n.ID)
+			}
+		}
+	}
+	if edges != 4 || sampled != 2 {
+		t.Errorf("Expected 4 edges with 2 sampled, got %d with %d", edges, sampled)
+	}
+	if _, ok := topology.Nodes[server]; !ok {
+		t.Error("Expected the server to be kept")
+	}
+	if _, ok := topology.Nodes[lonely]; ok {
+		t.Error("Expected the endpoint only reached from the dropped 10.0.2.1 to be dropped")
+	}
+}
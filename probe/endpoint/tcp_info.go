@@ -0,0 +1,205 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// The RTT, retransmissions and counters of TCP connections are read from the
+// tcp_info of their sockets, dumped over the sock_diag netlink protocol.
+// Constants are from linux/sock_diag.h, linux/inet_diag.h and linux/tcp.h.
+const (
+	netlinkSockDiag   = 4  // NETLINK_SOCK_DIAG
+	sockDiagByFamily  = 20 // SOCK_DIAG_BY_FAMILY
+	inetDiagReqV2Len  = 56
+	inetDiagMsgLen    = 72
+	inetDiagInfo      = 2 // INET_DIAG_INFO
+	tcpEstablishedBit = 1 << 1
+	afInet6           = 10
+
+	// Offsets in struct tcp_info; counters are only there since Linux 4.2
+	tcpInfoRTTOffset           = 68
+	tcpInfoTotalRetransOffset  = 100
+	tcpInfoBytesAckedOffset    = 120
+	tcpInfoBytesReceivedOffset = 128
+	tcpInfoSegsOutOffset       = 136
+	tcpInfoSegsInOffset        = 140
+	tcpInfoCountersLen         = 144
+)
+
+// tcpStats are the stats of a TCP connection, from its socket. Counters are
+// of the direction from the end of the connection which sorts first in the
+// key of its tuple.
+type tcpStats struct {
+	rttMicros    uint64
+	totalRetrans uint64
+
+	bytesSent, bytesReceived uint64
+	segsOut, segsIn          uint64
+}
+
+// keyOrdered is whether the from end of a tuple sorts first in its key.
+func keyOrdered(t fourTuple) bool {
+	return hostPort(t.fromAddr, t.fromPort) <= hostPort(t.toAddr, t.toPort)
+}
+
+// edge gives the stats of a connection as edge metadata, for an edge
+// following a tuple.
+func (s tcpStats) edge(t fourTuple) report.EdgeMetadata {
+	sent, received, out, in := s.bytesSent, s.bytesReceived, s.segsOut, s.segsIn
+	if !keyOrdered(t) {
+		sent, received, out, in = received, sent, in, out
+	}
+	return report.EdgeMetadata{
+		RTTMicros:          &s.rttMicros,
+		Retransmits:        &s.totalRetrans,
+		EgressByteCount:    &sent,
+		IngressByteCount:   &received,
+		EgressPacketCount:  &out,
+		IngressPacketCount: &in,
+	}
+}
+
+// sockDiagRequest is the message asking for the tcp_info of the established
+// TCP sockets of a family.
+func sockDiagRequest(family uint8, seq uint32) []byte {
+	b := make([]byte, nlmsgHdrLen+inetDiagReqV2Len)
+	nativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	nativeEndian.PutUint16(b[4:6], sockDiagByFamily)
+	nativeEndian.PutUint16(b[6:8], nlmFRequest|nlmFDump)
+	nativeEndian.PutUint32(b[8:12], seq)
+	req := b[nlmsgHdrLen:]
+	req[0] = family
+	req[1] = ipprotoTCP
+	req[2] = 1 << (inetDiagInfo - 1) // idiag_ext
+	nativeEndian.PutUint32(req[4:8], tcpEstablishedBit)
+	return b
+}
+
+// decodeSockDiag decodes the stats of the sockets of a sock_diag datagram,
+// by direction-independent key of their tuple. done is true at the end of
+// the dump.
+func decodeSockDiag(b []byte, stats map[string]tcpStats) (done bool, err error) {
+	msgs, err := parseNetlinkMessages(b)
+	if err != nil {
+		return false, err
+	}
+	for _, msg := range msgs {
+		switch msg.Type {
+		case nlmsgDone:
+			return true, nil
+		case nlmsgError:
+			if err := netlinkError(msg); err != nil {
+				return false, err
+			}
+			continue
+		case sockDiagByFamily:
+		default:
+			continue
+		}
+		if len(msg.Data) < inetDiagMsgLen {
+			return false, fmt.Errorf("truncated inet_diag message")
+		}
+		tuple, ok := decodeInetDiagSockID(msg.Data)
+		if !ok {
+			continue
+		}
+		attrs, err := parseNetlinkAttrs(msg.Data[inetDiagMsgLen:])
+		if err != nil {
+			return false, err
+		}
+		for _, attr := range attrs {
+			if attr.Type != inetDiagInfo || len(attr.Value) < tcpInfoTotalRetransOffset+4 {
+				continue
+			}
+			s, seen := stats[tuple.key()]
+			// Both ends of local connections are seen: keep the slowest RTT,
+			// the retransmissions of both, and the counters of one.
+			if !seen && len(attr.Value) >= tcpInfoCountersLen {
+				s.bytesSent = nativeEndian.Uint64(attr.Value[tcpInfoBytesAckedOffset:])
+				s.bytesReceived = nativeEndian.Uint64(attr.Value[tcpInfoBytesReceivedOffset:])
+				s.segsOut = uint64(nativeEndian.Uint32(attr.Value[tcpInfoSegsOutOffset:]))
+				s.segsIn = uint64(nativeEndian.Uint32(attr.Value[tcpInfoSegsInOffset:]))
+				if !keyOrdered(tuple) {
+					s.bytesSent, s.bytesReceived, s.segsOut, s.segsIn = s.bytesReceived, s.bytesSent, s.segsIn, s.segsOut
+				}
+			}
+			if rtt := uint64(nativeEndian.Uint32(attr.Value[tcpInfoRTTOffset:])); rtt > s.rttMicros {
+				s.rttMicros = rtt
+			}
+			s.totalRetrans += uint64(nativeEndian.Uint32(attr.Value[tcpInfoTotalRetransOffset:]))
+			stats[tuple.key()] = s
+		}
+	}
+	return false, nil
+}
+
+// decodeInetDiagSockID decodes the tuple of the struct inet_diag_sockid of
+// an inet_diag_msg. Ports and addresses are in network byte order.
+func decodeInetDiagSockID(msg []byte) (fourTuple, bool) {
+	family, id := msg[0], msg[4:]
+	var src, dst net.IP
+	switch family {
+	case afInet:
+		src, dst = net.IP(id[4:8]), net.IP(id[20:24])
+	case afInet6:
+		src, dst = net.IP(id[4:20]), net.IP(id[20:36])
+	default:
+		return fourTuple{}, false
+	}
+	return fourTuple{
+		fromAddr: src.String(),
+		toAddr:   dst.String(),
+		fromPort: binary.BigEndian.Uint16(id[0:2]),
+		toPort:   binary.BigEndian.Uint16(id[2:4]),
+	}, true
+}
+
+// tcpStatsTracker turns the cumulative retransmissions and counters of
+// sockets into the ones since the previous report.
+type tcpStatsTracker struct {
+	dump     func() (map[string]tcpStats, error)
+	previous map[string]tcpStats
+}
+
+// update dumps the stats of the connections, with cumulative stats relative
+// to the previous dump. The first dump only gives RTTs, rather than what
+// connections carried before the probe started.
+func (t *tcpStatsTracker) update() (map[string]tcpStats, error) {
+	current, err := t.dump()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]tcpStats, len(current))
+	for key, s := range current {
+		prev, ok := t.previous[key]
+		if !ok && t.previous == nil {
+			prev = s
+		}
+		result[key] = tcpStats{
+			rttMicros:     s.rttMicros,
+			totalRetrans:  since(s.totalRetrans, prev.totalRetrans),
+			bytesSent:     since(s.bytesSent, prev.bytesSent),
+			bytesReceived: since(s.bytesReceived, prev.bytesReceived),
+			segsOut:       since(s.segsOut, prev.segsOut),
+			segsIn:        since(s.segsIn, prev.segsIn),
+		}
+	}
+	t.previous = current
+	if t.previous == nil {
+		t.previous = map[string]tcpStats{}
+	}
+	return result, nil
+}
+
+// since is the increase of a counter, which restarts when a new socket
+// reuses the tuple of a closed one.
+func since(current, previous uint64) uint64 {
+	if previous > current {
+		return current
+	}
+	return current - previous
+}
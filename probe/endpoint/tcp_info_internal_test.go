@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// encodeInetDiagMsg encodes an inet_diag_msg with the tcp_info of a socket,
+// as inet_diag_dump_one_icsk() does.
+func encodeInetDiagMsg(t fourTuple, rttMicros, totalRetrans uint32, bytesAcked, bytesReceived uint64) []byte {
+	msg := make([]byte, inetDiagMsgLen)
+	msg[0] = afInet
+	binary.BigEndian.PutUint16(msg[4:6], t.fromPort)
+	binary.BigEndian.PutUint16(msg[6:8], t.toPort)
+	copy(msg[8:12], net.ParseIP(t.fromAddr).To4())
+	copy(msg[24:28], net.ParseIP(t.toAddr).To4())
+	info := make([]byte, 232)
+	nativeEndian.PutUint32(info[tcpInfoRTTOffset:], rttMicros)
+	nativeEndian.PutUint32(info[tcpInfoTotalRetransOffset:], totalRetrans)
+	nativeEndian.PutUint64(info[tcpInfoBytesAckedOffset:], bytesAcked)
+	nativeEndian.PutUint64(info[tcpInfoBytesReceivedOffset:], bytesReceived)
+	nativeEndian.PutUint32(info[tcpInfoSegsOutOffset:], uint32(bytesAcked/1000))
+	nativeEndian.PutUint32(info[tcpInfoSegsInOffset:], uint32(bytesReceived/1000))
+	msg = append(msg, encodeAttr(inetDiagInfo, info)...)
+	return encodeMessage(sockDiagByFamily, 0, afInet, msg[4:])
+}
+
+func TestDecodeSockDiag(t *testing.T) {
+	var (
+		client = fourTuple{"10.32.0.1", "10.32.0.2", 41234, 80}
+		other  = fourTuple{"10.32.0.1", "10.0.0.9", 41235, 443}
+	)
+	var datagram []byte
+	for _, msg := range [][]byte{
+		encodeInetDiagMsg(client, 250, 1, 2000, 50000),
+		// The server end of the same connection, in another namespace
+		encodeInetDiagMsg(reverse(client), 400, 2, 50000, 2000),
+		// A connection whose from end sorts last in its key
+		encodeInetDiagMsg(other, 12000, 0, 3000, 1000),
+		encodeMessage(nlmsgDone, 0, 0),
+	} {
+		datagram = append(datagram, msg...)
+	}
+
+	stats := map[string]tcpStats{}
+	done, err := decodeSockDiag(datagram, stats)
+	if err != nil || !done {
+		t.Fatalf("Unexpected decoding result: %v, %v", done, err)
+	}
+	want := map[string]tcpStats{
+		client.key(): {rttMicros: 400, totalRetrans: 3, bytesSent: 2000, bytesReceived: 50000, segsOut: 2, segsIn: 50},
+		other.key():  {rttMicros: 12000, bytesSent: 1000, bytesReceived: 3000, segsOut: 1, segsIn: 3},
+	}
+	if !reflect.DeepEqual(want, stats) {
+		t.Errorf("Expected %v, got %v", want, stats)
+	}
+
+	// Edges of either direction get the counters of their direction
+	for _, tuple := range []fourTuple{other, reverse(other)} {
+		edge := stats[other.key()].edge(tuple)
+		wantSent := uint64(3000)
+		if tuple != other {
+			wantSent = 1000
+		}
+		if *edge.EgressByteCount != wantSent || *edge.IngressByteCount+*edge.EgressByteCount != 4000 || *edge.RTTMicros != 12000 {
+			t.Errorf("Unexpected edge of %v: %v", tuple, edge)
+		}
+	}
+}
+
+func TestSockDiagRequest(t *testing.T) {
+	msgs, err := parseNetlinkMessages(sockDiagRequest(afInet6, 3))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Expected one message, got %v, %v", msgs, err)
+	}
+	msg := msgs[0]
+	if msg.Type != sockDiagByFamily || msg.Flags != nlmFRequest|nlmFDump || len(msg.Data) != inetDiagReqV2Len ||
+		msg.Data[0] != afInet6 || msg.Data[1] != ipprotoTCP || msg.Data[2] != 1<<(inetDiagInfo-1) {
+		t.Errorf("Unexpected request %v", msg)
+	}
+}
+
+func TestTCPStatsTracker(t *testing.T) {
+	dumps := []map[string]tcpStats{
+		{"a": {rttMicros: 100, totalRetrans: 5, bytesSent: 100}, "b": {rttMicros: 200, totalRetrans: 1}},
+		// b was closed, and a new connection reused its tuple
+		{"a": {rttMicros: 150, totalRetrans: 7, bytesSent: 150}, "b": {rttMicros: 300}, "c": {bytesSent: 10}},
+	}
+	tracker := tcpStatsTracker{dump: func() (map[string]tcpStats, error) {
+		d := dumps[0]
+		dumps = dumps[1:]
+		return d, nil
+	}}
+	// What connections did before the first dump isn't counted
+	if have, _ := tracker.update(); !reflect.DeepEqual(map[string]tcpStats{
+		"a": {rttMicros: 100}, "b": {rttMicros: 200},
+	}, have) {
+		t.Errorf("Unexpected first stats %v", have)
+	}
+	if have, _ := tracker.update(); !reflect.DeepEqual(map[string]tcpStats{
+		"a": {rttMicros: 150, totalRetrans: 2, bytesSent: 50}, "b": {rttMicros: 300}, "c": {bytesSent: 10},
+	}, have) {
+		t.Errorf("Unexpected retransmissions since the first stats %v", have)
+	}
+}
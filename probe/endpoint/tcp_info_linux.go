@@ -0,0 +1,87 @@
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// dumpTCPStats dumps the stats of the established TCP connections of all
+// the network namespaces of the host. Entering other namespaces than the
+// probe's needs CAP_SYS_ADMIN.
+func dumpTCPStats(procRoot string) (map[string]tcpStats, error) {
+	stats := map[string]tcpStats{}
+	if err := dumpSockDiag(stats); err != nil {
+		return nil, err
+	}
+
+	own, _ := os.Readlink(filepath.Join(procRoot, "self", "ns", "net"))
+	namespaces, err := filepath.Glob(filepath.Join(procRoot, "[0-9]*", "ns", "net"))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{own: {}}
+	for _, path := range namespaces {
+		ns, err := os.Readlink(path)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[ns]; ok {
+			continue
+		}
+		seen[ns] = struct{}{}
+		if err := inNetNamespace(path, func() error { return dumpSockDiag(stats) }); err != nil {
+			log.Debugf("Cannot read the TCP stats of network namespace %s: %v", ns, err)
+		}
+	}
+	return stats, nil
+}
+
+func dumpSockDiag(stats map[string]tcpStats) error {
+	s, err := openNetlinkSocket(netlinkSockDiag, 0)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	for i, family := range []uint8{afInet, afInet6} {
+		if err := s.send(sockDiagRequest(family, uint32(i+1))); err != nil {
+			return err
+		}
+		for done := false; !done; {
+			b, err := s.recv()
+			if err != nil {
+				return err
+			}
+			if done, err = decodeSockDiag(b, stats); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inNetNamespace runs f in the network namespace at nsPath, on a thread of
+// its own. The thread stays locked, so that it's thrown away rather than
+// reused by other goroutines in the wrong namespace.
+func inNetNamespace(nsPath string, f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		fd, err := syscall.Open(nsPath, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			errc <- os.NewSyscallError("open", err)
+			return
+		}
+		defer syscall.Close(fd)
+		if err := unix.Setns(fd, syscall.CLONE_NEWNET); err != nil {
+			errc <- os.NewSyscallError("setns", err)
+			return
+		}
+		errc <- f()
+	}()
+	return <-errc
+}
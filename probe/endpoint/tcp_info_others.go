@@ -0,0 +1,11 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+func dumpTCPStats(procRoot string) (map[string]tcpStats, error) {
+	return nil, fmt.Errorf("TCP stats are only supported on Linux")
+}
@@ -0,0 +1,187 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/scope/report"
+)
+
+// Node metadata keys of the certificates of TLS listeners, on processes.
+const (
+	TLSCertExpiry       = "tls_cert_expiry"
+	TLSCertsTablePrefix = "tls_certs_"
+	TLSCertSubject      = "tls_cert_subject"
+	TLSCertIssuer       = "tls_cert_issuer"
+	TLSCertNotAfter     = "tls_cert_not_after"
+)
+
+const tlsHandshakeTimeout = 2 * time.Second
+
+var (
+	// TLSCertMetadataTemplates are the metadata templates of processes with
+	// TLS listeners.
+	TLSCertMetadataTemplates = report.MetadataTemplates{
+		TLSCertExpiry: {ID: TLSCertExpiry, Label: "Certificate expires", From: report.FromLatest, Datatype: "datetime", Priority: 10},
+	}
+
+	// TLSCertTableTemplates are the table templates of processes with TLS
+	// listeners. Rows are by port.
+	TLSCertTableTemplates = report.TableTemplates{
+		TLSCertsTablePrefix: {
+			ID:     TLSCertsTablePrefix,
+			Label:  "TLS Certificates",
+			Type:   report.MulticolumnTableType,
+			Prefix: TLSCertsTablePrefix,
+			Columns: []report.Column{
+				{ID: TLSCertSubject, Label: "Subject"},
+				{ID: TLSCertIssuer, Label: "Issuer"},
+				{ID: TLSCertNotAfter, Label: "Expires", DataType: "datetime"},
+			},
+		},
+	}
+)
+
+// listeningSocket is a listening TCP socket of a process.
+type listeningSocket struct {
+	PID  int
+	Addr net.IP
+	Port uint16
+}
+
+// tlsCert is the certificate a listener presented.
+type tlsCert struct {
+	Port     uint16
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+}
+
+// tlsInspector periodically handshakes with the listening sockets of the
+// host, to find the certificates of the ones speaking TLS. Listeners in
+// other network namespaces than the probe's aren't inspected.
+type tlsInspector struct {
+	interval  time.Duration
+	listeners func() ([]listeningSocket, error)
+	handshake func(addr string) (*x509.Certificate, error)
+	quit      chan struct{}
+
+	sync.RWMutex
+	certs map[int][]tlsCert // by PID
+}
+
+func newTLSInspector(procRoot string, interval time.Duration) *tlsInspector {
+	t := &tlsInspector{
+		interval:  interval,
+		listeners: func() ([]listeningSocket, error) { return listeningSockets(procRoot) },
+		handshake: tlsHandshake,
+		quit:      make(chan struct{}),
+		certs:     map[int][]tlsCert{},
+	}
+	go t.loop()
+	return t
+}
+
+func (t *tlsInspector) loop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		t.inspect()
+		select {
+		case <-ticker.C:
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+func (t *tlsInspector) stop() {
+	close(t.quit)
+}
+
+// inspect handshakes with every listener, replacing the certificates found
+// previously.
+func (t *tlsInspector) inspect() {
+	listeners, err := t.listeners()
+	if err != nil {
+		log.Warnf("TLS inspector: cannot list listening sockets: %v", err)
+		return
+	}
+	certs := map[int][]tlsCert{}
+	for _, l := range listeners {
+		cert, err := t.handshake(dialAddress(l.Addr, l.Port))
+		if err != nil {
+			// Most listeners don't speak TLS
+			log.Debugf("TLS inspector: no certificate on port %d of PID %d: %v", l.Port, l.PID, err)
+			continue
+		}
+		certs[l.PID] = append(certs[l.PID], tlsCert{
+			Port:     l.Port,
+			Subject:  cert.Subject.CommonName,
+			Issuer:   cert.Issuer.CommonName,
+			NotAfter: cert.NotAfter,
+		})
+	}
+	t.Lock()
+	t.certs = certs
+	t.Unlock()
+}
+
+// dialAddress is where to reach a listener from the host: wildcard listeners
+// are reached over the loopback interface.
+func dialAddress(addr net.IP, port uint16) string {
+	switch {
+	case addr.Equal(net.IPv4zero):
+		addr = net.IPv4(127, 0, 0, 1)
+	case addr.Equal(net.IPv6unspecified):
+		addr = net.IPv6loopback
+	}
+	return net.JoinHostPort(addr.String(), strconv.Itoa(int(port)))
+}
+
+func tlsHandshake(addr string) (*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: tlsHandshakeTimeout, Deadline: time.Now().Add(tlsHandshakeTimeout)}
+	// Only the certificate is of interest, not whether it's trusted
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+// tag adds the certificates found to the processes of the report.
+func (t *tlsInspector) tag(rpt *report.Report, hostID string) {
+	t.RLock()
+	defer t.RUnlock()
+	if len(t.certs) == 0 {
+		return
+	}
+	rpt.Process = rpt.Process.WithMetadataTemplates(TLSCertMetadataTemplates).WithTableTemplates(TLSCertTableTemplates)
+	for pid, certs := range t.certs {
+		expiry := certs[0].NotAfter
+		rows := make([]report.Row, 0, len(certs))
+		for _, cert := range certs {
+			if cert.NotAfter.Before(expiry) {
+				expiry = cert.NotAfter
+			}
+			rows = append(rows, report.Row{
+				ID: strconv.Itoa(int(cert.Port)),
+				Entries: map[string]string{
+					TLSCertSubject:  cert.Subject,
+					TLSCertIssuer:   cert.Issuer,
+					TLSCertNotAfter: cert.NotAfter.UTC().Format(time.RFC3339),
+				},
+			})
+		}
+		node := report.MakeNodeWith(report.MakeProcessNodeID(hostID, strconv.Itoa(pid)), map[string]string{
+			TLSCertExpiry: expiry.UTC().Format(time.RFC3339),
+		}).AddPrefixMulticolumnTable(TLSCertsTablePrefix, rows)
+		rpt.Process = rpt.Process.AddNode(node)
+	}
+}
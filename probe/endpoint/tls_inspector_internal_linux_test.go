@@ -0,0 +1,48 @@
+package endpoint
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListeningSockets(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "scope-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+	for _, dir := range []string{"net", "42/fd", "43/fd"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout Inode
+   0: 00000000:01BB 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5107 1 ffff8800a6aaf040 100 0 0 10 0
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5108 1 ffff8800a6aaf040 100 0 0 10 0
+`
+	if err := ioutil.WriteFile(filepath.Join(procRoot, "net", "tcp"), []byte(tcp), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"42/fd/3": "socket:[5107]",
+		"42/fd/4": "/dev/null",
+		"43/fd/3": "socket:[5107]", // shared with a child
+	} {
+		if err := os.Symlink(target, filepath.Join(procRoot, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	have, err := listeningSockets(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listeningSocket{{PID: 42, Addr: net.IP{0, 0, 0, 0}, Port: 443}}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
@@ -0,0 +1,64 @@
+package endpoint
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestTLSInspector(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	listener := func(pid int, l net.Listener) listeningSocket {
+		return listeningSocket{PID: pid, Addr: net.IPv4zero, Port: uint16(l.Addr().(*net.TCPAddr).Port)}
+	}
+	inspector := &tlsInspector{
+		listeners: func() ([]listeningSocket, error) {
+			return []listeningSocket{listener(1, server.Listener), listener(2, plain.Listener)}, nil
+		},
+		handshake: tlsHandshake,
+		certs:     map[int][]tlsCert{},
+	}
+	inspector.inspect()
+
+	rpt := report.MakeReport()
+	inspector.tag(&rpt, "host")
+	if len(rpt.Process.Nodes) != 1 {
+		t.Fatalf("Expected only the TLS listener to be tagged, got %v", rpt.Process.Nodes)
+	}
+	node, ok := rpt.Process.Nodes[report.MakeProcessNodeID("host", "1")]
+	if !ok {
+		t.Fatalf("Expected the process of the TLS listener, got %v", rpt.Process.Nodes)
+	}
+	if expiry, _ := node.Latest.Lookup(TLSCertExpiry); expiry != server.Certificate().NotAfter.UTC().Format(time.RFC3339) {
+		t.Errorf("Unexpected expiry %q", expiry)
+	}
+	rows := node.ExtractMulticolumnTable(TLSCertTableTemplates[TLSCertsTablePrefix])
+	port := strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+	if len(rows) != 1 || rows[0].ID != port || rows[0].Entries[TLSCertNotAfter] == "" {
+		t.Errorf("Unexpected certificates table %v", rows)
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	for _, c := range []struct {
+		addr net.IP
+		want string
+	}{
+		{net.IPv4zero, "127.0.0.1:443"},
+		{net.IPv6unspecified, "[::1]:443"},
+		{net.ParseIP("10.0.0.1"), "10.0.0.1:443"},
+	} {
+		if have := dialAddress(c.addr, 443); have != c.want {
+			t.Errorf("Expected %s for %s, got %s", c.want, c.addr, have)
+		}
+	}
+}
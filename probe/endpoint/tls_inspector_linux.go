@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/weaveworks/scope/probe/endpoint/procspy"
+)
+
+// listeningSockets lists the listening TCP sockets of the network namespace
+// of the probe, with the processes owning them. Sockets without an owning
+// process, as far as the probe can see, aren't listed.
+func listeningSockets(procRoot string) ([]listeningSocket, error) {
+	var buf []byte
+	for _, name := range []string{"tcp", "tcp6"} {
+		b, err := ioutil.ReadFile(filepath.Join(procRoot, "net", name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		buf = append(buf, b...)
+	}
+
+	byInode := map[uint64]listeningSocket{}
+	p := procspy.NewListeningProcNet(buf)
+	for c := p.Next(); c != nil; c = p.Next() {
+		addr := make([]byte, len(c.LocalAddress))
+		copy(addr, c.LocalAddress)
+		byInode[c.Inode] = listeningSocket{Addr: addr, Port: c.LocalPort}
+	}
+	if len(byInode) == 0 {
+		return nil, nil
+	}
+
+	fds, err := filepath.Glob(filepath.Join(procRoot, "[0-9]*", "fd", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var result []listeningSocket
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil {
+			continue
+		}
+		var inode uint64
+		if _, err := fmt.Sscanf(link, "socket:[%d]", &inode); err != nil {
+			continue
+		}
+		l, ok := byInode[inode]
+		if !ok {
+			continue
+		}
+		// Sockets shared by processes are inspected once
+		delete(byInode, inode)
+		if l.PID, err = strconv.Atoi(filepath.Base(filepath.Dir(filepath.Dir(fd)))); err == nil {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+func listeningSockets(procRoot string) ([]listeningSocket, error) {
+	return nil, fmt.Errorf("listing listening sockets is only supported on Linux")
+}
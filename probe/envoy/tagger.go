@@ -0,0 +1,173 @@
+package envoy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Clusters = "envoy_clusters"
+	Routes   = "envoy_routes"
+)
+
+// SidecarContainerName is the name Istio gives to the Envoy sidecar container
+// it injects into pods.
+const SidecarContainerName = "istio-proxy"
+
+const (
+	containerNameLabel = docker.LabelPrefix + "io.kubernetes.container.name"
+	podUIDLabel        = docker.LabelPrefix + "io.kubernetes.pod.uid"
+	statsTimeout       = 500 * time.Millisecond
+)
+
+// Exposed for testing
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		Clusters: {ID: Clusters, Label: "Mesh clusters", From: report.FromSets, Priority: 20},
+		Routes:   {ID: Routes, Label: "Mesh routes", From: report.FromSets, Priority: 21},
+	}
+
+	clusterStat = regexp.MustCompile(`^cluster\.(.+)\.upstream_rq_total$`)
+	routeStat   = regexp.MustCompile(`\.rds\.(.+)\.update_success$`)
+)
+
+// IsSidecar tells whether a container node is an Envoy sidecar.
+func IsSidecar(n report.Node) bool {
+	name, _ := n.Latest.Lookup(containerNameLabel)
+	return name == SidecarContainerName
+}
+
+// PodUID gives the UID of the Kubernetes pod a container node belongs to.
+func PodUID(n report.Node) (string, bool) {
+	return n.Latest.Lookup(podUIDLabel)
+}
+
+// Stats is what we read from the /stats endpoint of an Envoy admin
+// interface.
+type Stats struct {
+	// Clusters which have had any requests sent upstream
+	Clusters []string
+	// Route configurations which have been loaded
+	Routes []string
+}
+
+// ParseStats parses the plain text output of the Envoy /stats endpoint.
+func ParseStats(r io.Reader) (Stats, error) {
+	var (
+		stats   Stats
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || value == 0 {
+			continue
+		}
+		if m := clusterStat.FindStringSubmatch(parts[0]); m != nil {
+			stats.Clusters = append(stats.Clusters, m[1])
+		} else if m := routeStat.FindStringSubmatch(parts[0]); m != nil {
+			stats.Routes = append(stats.Routes, m[1])
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// Tagger reads the stats of the Envoy sidecars found in the container
+// topology, and tags all the containers of their pods with the mesh clusters
+// and routes they use.
+type Tagger struct {
+	adminPort int
+	client    *http.Client
+}
+
+// NewTagger makes a new Tagger, which expects the Envoy admin interface
+// of sidecars to be reachable on the pod IP at adminPort.
+func NewTagger(adminPort int) *Tagger {
+	return &Tagger{
+		adminPort: adminPort,
+		client:    &http.Client{Timeout: statsTimeout},
+	}
+}
+
+// Name of this tagger, for metrics gathering
+func (*Tagger) Name() string { return "Envoy" }
+
+func (t *Tagger) stats(ip string) (Stats, error) {
+	resp, err := t.client.Get(fmt.Sprintf("http://%s:%d/stats", ip, t.adminPort))
+	if err != nil {
+		return Stats{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Stats{}, fmt.Errorf("envoy returned non-200 status code: %s", resp.Status)
+	}
+	return ParseStats(resp.Body)
+}
+
+// Tag implements Tagger.
+func (t *Tagger) Tag(rpt report.Report) (report.Report, error) {
+	var (
+		wg    sync.WaitGroup
+		mtx   sync.Mutex
+		byPod = map[string]Stats{}
+	)
+	for id, n := range rpt.Container.Nodes {
+		podUID, ok := PodUID(n)
+		if !ok || !IsSidecar(n) {
+			continue
+		}
+		ips := docker.ExtractContainerIPs(n)
+		if len(ips) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(id, podUID, ip string) {
+			defer wg.Done()
+			stats, err := t.stats(ip)
+			if err != nil {
+				log.Debugf("envoy: error reading stats of sidecar %s: %v", id, err)
+				return
+			}
+			mtx.Lock()
+			byPod[podUID] = stats
+			mtx.Unlock()
+		}(id, podUID, ips[0])
+	}
+	wg.Wait()
+	if len(byPod) == 0 {
+		return rpt, nil
+	}
+
+	for _, n := range rpt.Container.Nodes {
+		podUID, ok := PodUID(n)
+		if !ok {
+			continue
+		}
+		stats, ok := byPod[podUID]
+		if !ok {
+			continue
+		}
+		rpt.Container.AddNode(n.WithSets(report.MakeSets().
+			Add(Clusters, report.MakeStringSet(stats.Clusters...)).
+			Add(Routes, report.MakeStringSet(stats.Routes...)),
+		))
+	}
+	rpt.Container = rpt.Container.WithMetadataTemplates(MetadataTemplates)
+	return rpt, nil
+}
@@ -0,0 +1,76 @@
+package envoy_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/envoy"
+	"github.com/weaveworks/scope/report"
+)
+
+const stats = `cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_rq_total: 12
+cluster.outbound|9080||ratings.default.svc.cluster.local.upstream_rq_total: 0
+cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_cx_total: 3
+http.outbound_0.0.0.0_9080.rds.9080.update_success: 2
+http.outbound_0.0.0.0_8080.rds.8080.update_success: 0
+server.uptime: 100
+`
+
+func TestParseStats(t *testing.T) {
+	have, err := envoy.ParseStats(strings.NewReader(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := envoy.Stats{
+		Clusters: []string{"outbound|9080||reviews.default.svc.cluster.local"},
+		Routes:   []string{"9080"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestTagger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, stats)
+	}))
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	container := func(id, podUID, name string) report.Node {
+		return report.MakeNodeWith(id, map[string]string{
+			docker.LabelPrefix + "io.kubernetes.pod.uid":        podUID,
+			docker.LabelPrefix + "io.kubernetes.container.name": name,
+		}).WithSets(report.MakeSets().Add(docker.ContainerIPs, report.MakeStringSet("127.0.0.1")))
+	}
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(container("app", "pod1", "app"))
+	rpt.Container.AddNode(container("proxy", "pod1", envoy.SidecarContainerName))
+	rpt.Container.AddNode(container("other", "pod2", "other"))
+
+	rpt, err := envoy.NewTagger(port).Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"app", "proxy"} {
+		clusters, _ := rpt.Container.Nodes[id].Sets.Lookup(envoy.Clusters)
+		if want := report.MakeStringSet("outbound|9080||reviews.default.svc.cluster.local"); !reflect.DeepEqual(want, clusters) {
+			t.Errorf("%s: want clusters %v, have %v", id, want, clusters)
+		}
+	}
+	if _, ok := rpt.Container.Nodes["other"].Sets.Lookup(envoy.Clusters); ok {
+		t.Errorf("container of a pod without sidecar should not be tagged")
+	}
+}
@@ -0,0 +1,26 @@
+package host
+
+import (
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/capture"
+)
+
+var captureControls = []string{CapturePackets}
+
+func (r *Reporter) registerCaptureControls() {
+	r.handlerRegistry.Register(CapturePackets, r.capturePackets)
+}
+
+func (r *Reporter) deregisterCaptureControls() {
+	r.handlerRegistry.Rm(CapturePackets)
+}
+
+// capturePackets captures the packets of the host, as bounded by the
+// arguments of the control. The probe runs in the host network namespace.
+func (r *Reporter) capturePackets(req xfer.Request) xfer.Response {
+	opts, err := capture.ParseOptions(req.ControlArgs)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return capture.Start(r.pipes, req.AppID, 0, opts)
+}
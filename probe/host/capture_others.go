@@ -0,0 +1,10 @@
+// +build !linux
+
+package host
+
+// Packets can only be captured on Linux.
+var captureControls []string
+
+func (r *Reporter) registerCaptureControls() {}
+
+func (r *Reporter) deregisterCaptureControls() {}
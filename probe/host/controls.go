@@ -1,3 +1,5 @@
+// +build !windows
+
 package host
 
 import (
@@ -11,20 +13,19 @@ import (
 	"github.com/weaveworks/scope/probe/controls"
 )
 
-// Control IDs used by the host integration.
-const (
-	ExecHost      = "host_exec"
-	ResizeExecTTY = "host_resize_exec_tty"
-)
+// activeControls are the controls of the host node.
+var activeControls = append([]string{ExecHost}, captureControls...)
 
 func (r *Reporter) registerControls() {
 	r.handlerRegistry.Register(ExecHost, r.execHost)
 	r.handlerRegistry.Register(ResizeExecTTY, xfer.ResizeTTYControlWrapper(r.resizeExecTTY))
+	r.registerCaptureControls()
 }
 
 func (r *Reporter) deregisterControls() {
 	r.handlerRegistry.Rm(ExecHost)
 	r.handlerRegistry.Rm(ResizeExecTTY)
+	r.deregisterCaptureControls()
 }
 
 func (r *Reporter) execHost(req xfer.Request) xfer.Response {
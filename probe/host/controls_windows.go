@@ -0,0 +1,69 @@
+package host
+
+import (
+	"io"
+	"os/exec"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+// Packets can't be captured with tcpdump on Windows.
+var activeControls = []string{ExecHost}
+
+// There are no ptys on Windows, so the host shell is plumbed straight
+// through to the pipe and can't be resized.
+func (r *Reporter) registerControls() {
+	r.handlerRegistry.Register(ExecHost, r.execHost)
+}
+
+func (r *Reporter) deregisterControls() {
+	r.handlerRegistry.Rm(ExecHost)
+}
+
+type shellPipe struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func (r *Reporter) execHost(req xfer.Request) xfer.Response {
+	cmd := exec.Command(r.hostShellCmd[0], r.hostShellCmd[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout, cmd.Stderr = stdoutWriter, stdoutWriter
+	if err := cmd.Start(); err != nil {
+		return xfer.ResponseError(err)
+	}
+
+	id, pipe, err := controls.NewPipeFromEnds(nil, shellPipe{stdout, stdin}, r.pipes, req.AppID)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+
+	pipe.OnClose(func() {
+		if err := cmd.Process.Kill(); err != nil {
+			log.Errorf("Error stopping host shell: %v", err)
+		}
+		log.Info("Host shell closed.")
+	})
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Errorf("Error waiting on host shell: %v", err)
+		}
+		stdoutWriter.Close()
+		pipe.Close()
+	}()
+
+	return xfer.Response{
+		Pipe: id,
+	}
+}
+
+func getHostShellCmd() []string {
+	return []string{"cmd.exe"}
+}
@@ -0,0 +1,89 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GPU is an NVIDIA GPU of the host.
+type GPU struct {
+	Index       int
+	UUID        string
+	Name        string
+	Utilization float64 // percent
+	MemoryUsed  float64 // bytes
+	MemoryTotal float64 // bytes
+}
+
+const mib = 1024 * 1024
+
+// nvidiaSMI is the command line of NVML, which is the only stable interface
+// of the NVIDIA driver. Going through it means the probe needs neither cgo
+// nor the NVIDIA libraries to build.
+var nvidiaSMI = "nvidia-smi"
+
+// DefaultGPUTimeout is how long nvidia-smi is waited for by default, half
+// the default spy interval.
+const DefaultGPUTimeout = 500 * time.Millisecond
+
+// GetGPUs returns the NVIDIA GPUs of the host, with their current usage. It
+// returns none on hosts without the NVIDIA driver. nvidia-smi is killed if
+// it takes longer than timeout, as hung drivers hang it.
+var GetGPUs = func(timeout time.Duration) ([]GPU, error) {
+	path, err := exec.LookPath(nvidiaSMI)
+	if err != nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path,
+		"--query-gpu=index,uuid,name,utilization.gpu,memory.used,memory.total",
+		"--format=csv,noheader,nounits",
+	).Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s took longer than %v", nvidiaSMI, timeout)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseGPUs(out)
+}
+
+func parseGPUs(out []byte) ([]GPU, error) {
+	reader := csv.NewReader(bytes.NewReader(out))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	gpus := []GPU{}
+	for _, record := range records {
+		if len(record) != 6 {
+			return nil, fmt.Errorf("invalid nvidia-smi output: %q", record)
+		}
+		index, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, err
+		}
+		gpu := GPU{Index: index, UUID: record[1], Name: record[2]}
+		// Values the GPU doesn't support are "[N/A]"; they count as zero.
+		gpu.Utilization = parseGPUValue(record[3])
+		gpu.MemoryUsed = parseGPUValue(record[4]) * mib
+		gpu.MemoryTotal = parseGPUValue(record[5]) * mib
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+func parseGPUValue(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
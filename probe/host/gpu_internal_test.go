@@ -0,0 +1,53 @@
+package host
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGPUs(t *testing.T) {
+	out := []byte("0, GPU-1234, Tesla V100-SXM2-16GB, 35, 1024, 16160\n" +
+		"1, GPU-5678, GeForce GTX 1080, [N/A], 512, 8119\n")
+	have, err := parseGPUs(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GPU{
+		{Index: 0, UUID: "GPU-1234", Name: "Tesla V100-SXM2-16GB", Utilization: 35, MemoryUsed: 1024 * mib, MemoryTotal: 16160 * mib},
+		{Index: 1, UUID: "GPU-5678", Name: "GeForce GTX 1080", Utilization: 0, MemoryUsed: 512 * mib, MemoryTotal: 8119 * mib},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+
+	if _, err := parseGPUs([]byte("0, GPU-1234\n")); err == nil {
+		t.Error("Expected an error for truncated output")
+	}
+}
+
+func TestGetGPUsTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldNvidiaSMI := nvidiaSMI
+	defer func() { nvidiaSMI = oldNvidiaSMI }()
+	nvidiaSMI = filepath.Join(dir, "nvidia-smi")
+	if err := ioutil.WriteFile(nvidiaSMI, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hung driver doesn't hang the host reporter
+	start := time.Now()
+	if _, err := GetGPUs(50 * time.Millisecond); err == nil {
+		t.Error("Expected an error once nvidia-smi took too long")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Expected nvidia-smi to be killed, waited %v for it", took)
+	}
+}
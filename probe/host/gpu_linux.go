@@ -0,0 +1,120 @@
+package host
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/cgroup"
+)
+
+// nvidiaMajor is the major number of the devices of NVIDIA GPUs. Minors 254
+// and 255 are nvidia-modeset and nvidiactl, which every GPU user needs.
+const (
+	nvidiaMajor    = "195"
+	nvidiaMaxMinor = 253
+)
+
+// Exposed for testing.
+var (
+	ProcDriverNVIDIAGPUs = "/proc/driver/nvidia/gpus"
+	ProcRoot             = "/proc"
+)
+
+// GetGPUDevices returns the NVIDIA GPU devices which the devices cgroup of a
+// process lets it use, as /dev/nvidiaN. Nothing is found under the unified
+// cgroup hierarchy, where devices are allowed by eBPF programs instead.
+var GetGPUDevices = func(pid int) []string {
+	minors := gpuMinors()
+	if len(minors) == 0 || cgroup.IsUnified() {
+		return nil
+	}
+	allowed, err := devicesCgroupAllows(pid)
+	if err != nil {
+		return nil
+	}
+	devices := []string{}
+	for _, minor := range minors {
+		if allowed(strconv.Itoa(minor)) {
+			devices = append(devices, fmt.Sprintf("/dev/nvidia%d", minor))
+		}
+	}
+	return devices
+}
+
+// gpuMinors gives the minor numbers of the devices of the GPUs the NVIDIA
+// driver knows about.
+func gpuMinors() []int {
+	infos, err := filepath.Glob(filepath.Join(ProcDriverNVIDIAGPUs, "*", "information"))
+	if err != nil {
+		return nil
+	}
+	minors := []int{}
+	for _, info := range infos {
+		buf, err := ioutil.ReadFile(info)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			fields := strings.SplitN(line, ":", 2)
+			if len(fields) != 2 || strings.TrimSpace(fields[0]) != "Device Minor" {
+				continue
+			}
+			if minor, err := strconv.Atoi(strings.TrimSpace(fields[1])); err == nil && minor <= nvidiaMaxMinor {
+				minors = append(minors, minor)
+			}
+		}
+	}
+	sort.Ints(minors)
+	return minors
+}
+
+// devicesCgroupAllows reads the devices cgroup of a process, and returns a
+// function telling whether it allows the NVIDIA device with a minor number.
+func devicesCgroupAllows(pid int) (func(minor string) bool, error) {
+	path, err := cgroup.Path(pid, "devices")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(cgroup.Root, "devices", path, "devices.list"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Entries are "type major:minor access", eg "c 195:0 rwm"; "a *:* rwm"
+	// allows everything.
+	all := false
+	minors := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "a" {
+			all = true
+			continue
+		}
+		device := strings.SplitN(fields[1], ":", 2)
+		if fields[0] != "c" || len(device) != 2 || (device[0] != nvidiaMajor && device[0] != "*") {
+			continue
+		}
+		if device[1] == "*" {
+			all = true
+		}
+		minors[device[1]] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return func(minor string) bool {
+		_, ok := minors[minor]
+		return all || ok
+	}, nil
+}
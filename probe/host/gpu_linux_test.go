@@ -0,0 +1,75 @@
+package host_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/cgroup"
+	"github.com/weaveworks/scope/probe/host"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetGPUDevices(t *testing.T) {
+	root, err := ioutil.TempDir("", "gpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	oldProcDriverNVIDIAGPUs, oldProcRoot, oldCgroupRoot := host.ProcDriverNVIDIAGPUs, cgroup.ProcRoot, cgroup.Root
+	defer func() {
+		host.ProcDriverNVIDIAGPUs, cgroup.ProcRoot, cgroup.Root = oldProcDriverNVIDIAGPUs, oldProcRoot, oldCgroupRoot
+	}()
+	host.ProcDriverNVIDIAGPUs = filepath.Join(root, "proc/driver/nvidia/gpus")
+	cgroup.ProcRoot = filepath.Join(root, "proc")
+	cgroup.Root = filepath.Join(root, "sys/fs/cgroup")
+	devicesCgroupRoot := filepath.Join(cgroup.Root, "devices")
+
+	if have := host.GetGPUDevices(1); have != nil {
+		t.Errorf("Expected no GPUs without the NVIDIA driver, got %v", have)
+	}
+
+	for bus, minor := range map[string]string{"0000:01:00.0": "0", "0000:02:00.0": "1"} {
+		writeFile(t, filepath.Join(host.ProcDriverNVIDIAGPUs, bus, "information"),
+			"Model: \t\t Tesla V100\nIRQ:   \t\t 42\nDevice Minor: \t "+minor+"\n")
+	}
+	for pid, lines := range map[string]string{
+		"1": "12:devices:/docker/one\n11:memory:/docker/one\n",
+		"2": "12:devices:/docker/two\n",
+		"3": "12:devices:/docker/three\n",
+		"4": "0::/system.slice/docker-four.scope\n",
+	} {
+		writeFile(t, filepath.Join(cgroup.ProcRoot, pid, "cgroup"), lines)
+	}
+	writeFile(t, filepath.Join(devicesCgroupRoot, "docker/one/devices.list"), "c 1:3 rwm\nc 195:255 rwm\nc 195:1 rw\n")
+	writeFile(t, filepath.Join(devicesCgroupRoot, "docker/two/devices.list"), "a *:* rwm\n")
+	writeFile(t, filepath.Join(devicesCgroupRoot, "docker/three/devices.list"), "c 1:3 rwm\n")
+
+	for pid, want := range map[int][]string{
+		1: {"/dev/nvidia1"},
+		2: {"/dev/nvidia0", "/dev/nvidia1"},
+		3: {},
+		4: nil, // no devices cgroup
+	} {
+		if have := host.GetGPUDevices(pid); !reflect.DeepEqual(have, want) {
+			t.Errorf("%d: expected %v, got %v", pid, want, have)
+		}
+	}
+
+	// Under the unified hierarchy, there are no devices cgroups to read
+	writeFile(t, filepath.Join(cgroup.Root, "cgroup.controllers"), "cpu io memory pids\n")
+	if have := host.GetGPUDevices(2); have != nil {
+		t.Errorf("Expected no GPUs under the unified hierarchy, got %v", have)
+	}
+}
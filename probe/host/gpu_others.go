@@ -0,0 +1,9 @@
+// +build !linux
+
+package host
+
+// GetGPUDevices returns the NVIDIA GPU devices a process may use. Devices
+// cgroups only exist on Linux.
+var GetGPUDevices = func(pid int) []string {
+	return nil
+}
@@ -0,0 +1,80 @@
+package host
+
+import (
+	"strconv"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in the Node.Latest and Node.Sets of network interfaces.
+const (
+	NetIfaceName      = "net_iface_name"
+	NetIfaceKind      = "net_iface_kind"
+	NetIfaceState     = "net_iface_state"
+	NetIfaceMAC       = "net_iface_mac"
+	NetIfaceMTU       = "net_iface_mtu"
+	NetIfaceMaster    = "net_iface_master"
+	NetIfaceAddresses = "net_iface_addresses"
+)
+
+// Values of NetIfaceKind
+const (
+	NetIfaceDevice   = "device"
+	NetIfaceBridge   = "bridge"
+	NetIfaceVeth     = "veth"
+	NetIfaceLoopback = "loopback"
+	NetIfaceVirtual  = "virtual"
+)
+
+// NetIfaceMetadataTemplates are the metadata templates of network interfaces.
+var NetIfaceMetadataTemplates = report.MetadataTemplates{
+	NetIfaceKind:      {ID: NetIfaceKind, Label: "Kind", From: report.FromLatest, Priority: 1},
+	NetIfaceState:     {ID: NetIfaceState, Label: "State", From: report.FromLatest, Priority: 2},
+	NetIfaceAddresses: {ID: NetIfaceAddresses, Label: "Addresses", From: report.FromSets, Priority: 3},
+	NetIfaceMAC:       {ID: NetIfaceMAC, Label: "MAC", From: report.FromLatest, Priority: 4},
+	NetIfaceMTU:       {ID: NetIfaceMTU, Label: "MTU", From: report.FromLatest, Datatype: "number", Priority: 5},
+	NetIfaceMaster:    {ID: NetIfaceMaster, Label: "Bridge", From: report.FromLatest, Priority: 6},
+}
+
+// NetIface is a network interface of the host.
+type NetIface struct {
+	Name      string
+	Index     int
+	Kind      string
+	State     string
+	MAC       string
+	MTU       int
+	Master    string // the bridge the interface is a port of, if any
+	Addresses []string
+}
+
+// netIfaceTopology makes the NetIface topology of the host. Ports of bridges
+// are adjacent to their bridge.
+func netIfaceTopology(hostID string, ifaces []NetIface) report.Topology {
+	result := report.MakeTopology().WithMetadataTemplates(NetIfaceMetadataTemplates)
+	parents := report.MakeSets().Add(report.Host, report.MakeStringSet(report.MakeHostNodeID(hostID)))
+	for _, iface := range ifaces {
+		latests := map[string]string{
+			NetIfaceName: iface.Name,
+			NetIfaceMTU:  strconv.Itoa(iface.MTU),
+		}
+		if iface.Kind != "" {
+			latests[NetIfaceKind] = iface.Kind
+		}
+		if iface.State != "" {
+			latests[NetIfaceState] = iface.State
+		}
+		if iface.MAC != "" {
+			latests[NetIfaceMAC] = iface.MAC
+		}
+		node := report.MakeNodeWith(report.MakeNetIfaceNodeID(hostID, iface.Name), latests).
+			WithSets(report.MakeSets().Add(NetIfaceAddresses, report.MakeStringSet(iface.Addresses...))).
+			WithParents(parents)
+		if iface.Master != "" {
+			node = node.WithLatests(map[string]string{NetIfaceMaster: iface.Master}).
+				WithAdjacent(report.MakeNetIfaceNodeID(hostID, iface.Master))
+		}
+		result.AddNode(node)
+	}
+	return result
+}
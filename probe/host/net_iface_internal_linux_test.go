@@ -0,0 +1,96 @@
+package host
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSysfs writes the files of interfaces under a fake sysfs.
+func writeSysfs(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNetIfaceKind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeSysfs(t, dir, map[string]string{
+		"eth0/device/vendor": "0x8086\n",
+		"eth0/iflink":        "2\n",
+		"docker0/bridge/stp": "0\n",
+		"docker0/iflink":     "3\n",
+		"veth1234/iflink":    "9\n",
+		"veth1234/uevent":    "INTERFACE=veth1234\nIFINDEX=10\n",
+		"eth0.100/iflink":    "2\n",
+		"eth0.100/uevent":    "DEVTYPE=vlan\nINTERFACE=eth0.100\n",
+		"dummy0/iflink":      "11\n",
+		"dummy0/uevent":      "INTERFACE=dummy0\n",
+	})
+	if err := os.Symlink("../docker0", filepath.Join(dir, "veth1234", "master")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		iface net.Interface
+		want  string
+	}{
+		{net.Interface{Name: "lo", Index: 1, Flags: net.FlagLoopback}, NetIfaceLoopback},
+		{net.Interface{Name: "eth0", Index: 2}, NetIfaceDevice},
+		{net.Interface{Name: "docker0", Index: 3}, NetIfaceBridge},
+		{net.Interface{Name: "veth1234", Index: 10}, NetIfaceVeth},
+		{net.Interface{Name: "eth0.100", Index: 12}, NetIfaceVirtual},
+		{net.Interface{Name: "dummy0", Index: 11}, NetIfaceVirtual},
+	} {
+		if have := netIfaceKind(filepath.Join(dir, tc.iface.Name), tc.iface); have != tc.want {
+			t.Errorf("%s: want %s, have %s", tc.iface.Name, tc.want, have)
+		}
+	}
+	if have := netIfaceMaster(filepath.Join(dir, "veth1234")); have != "docker0" {
+		t.Errorf("Expected veth1234 to be a port of docker0, got %q", have)
+	}
+	if have := netIfaceMaster(filepath.Join(dir, "eth0")); have != "" {
+		t.Errorf("Expected eth0 to be a port of nothing, got %q", have)
+	}
+}
+
+func TestGetVethPeers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeSysfs(t, filepath.Join(dir, "42", "root", SysClassNet), map[string]string{
+		"lo/ifindex":   "1\n",
+		"lo/iflink":    "1\n",
+		"eth0/ifindex": "4\n",
+		"eth0/iflink":  "10\n",
+	})
+
+	oldProcRoot, oldInterfaceByIndex := ProcRoot, interfaceByIndex
+	defer func() { ProcRoot, interfaceByIndex = oldProcRoot, oldInterfaceByIndex }()
+	ProcRoot = dir
+	interfaceByIndex = func(index int) (*net.Interface, error) {
+		return &net.Interface{Index: index, Name: "veth1234"}, nil
+	}
+
+	if have, want := GetVethPeers(42), []string{"veth1234"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if have := GetVethPeers(43); len(have) != 0 {
+		t.Errorf("Expected no peers of a missing process, got %v", have)
+	}
+}
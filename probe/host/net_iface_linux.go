@@ -0,0 +1,127 @@
+package host
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SysClassNet is where sysfs has the network interfaces of the probe's
+// network namespace. Exposed for testing.
+var SysClassNet = "/sys/class/net"
+
+// GetNetIfaces returns the network interfaces of the host, with their
+// addresses.
+var GetNetIfaces = func() ([]NetIface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]NetIface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		netIface := NetIface{
+			Name:   iface.Name,
+			Index:  iface.Index,
+			Kind:   netIfaceKind(filepath.Join(SysClassNet, iface.Name), iface),
+			State:  readSysfsString(filepath.Join(SysClassNet, iface.Name, "operstate")),
+			MAC:    iface.HardwareAddr.String(),
+			MTU:    iface.MTU,
+			Master: netIfaceMaster(filepath.Join(SysClassNet, iface.Name)),
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				netIface.Addresses = append(netIface.Addresses, addr.String())
+			}
+		}
+		result = append(result, netIface)
+	}
+	return result, nil
+}
+
+// netIfaceKind tells the kind of an interface from its directory in sysfs.
+// Veths are the virtual interfaces linked to another one, which isn't
+// themselves.
+func netIfaceKind(dir string, iface net.Interface) string {
+	switch {
+	case iface.Flags&net.FlagLoopback != 0:
+		return NetIfaceLoopback
+	case exists(filepath.Join(dir, "bridge")):
+		return NetIfaceBridge
+	case exists(filepath.Join(dir, "device")):
+		return NetIfaceDevice
+	}
+	iflink, err := strconv.Atoi(readSysfsString(filepath.Join(dir, "iflink")))
+	if err == nil && iflink != iface.Index && devType(dir) == "" {
+		return NetIfaceVeth
+	}
+	return NetIfaceVirtual
+}
+
+// devType gives the DEVTYPE of an interface, like vlan or vxlan, which veths
+// don't have.
+func devType(dir string) string {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, "DEVTYPE=") {
+			return strings.TrimPrefix(line, "DEVTYPE=")
+		}
+	}
+	return ""
+}
+
+// netIfaceMaster gives the name of the bridge an interface is a port of.
+func netIfaceMaster(dir string) string {
+	master, err := os.Readlink(filepath.Join(dir, "master"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(master)
+}
+
+// GetVethPeers returns the names of the interfaces of the host which are the
+// peers of the interfaces of a process's network namespace. They are found
+// through the sysfs the process sees, as containers get their own.
+var GetVethPeers = func(pid int) []string {
+	dir := filepath.Join(ProcRoot, strconv.Itoa(pid), "root", SysClassNet)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	peers := []string{}
+	for _, info := range infos {
+		index, err := strconv.Atoi(readSysfsString(filepath.Join(dir, info.Name(), "ifindex")))
+		if err != nil {
+			continue
+		}
+		iflink, err := strconv.Atoi(readSysfsString(filepath.Join(dir, info.Name(), "iflink")))
+		if err != nil || iflink == index {
+			continue
+		}
+		if peer, err := interfaceByIndex(iflink); err == nil {
+			peers = append(peers, peer.Name)
+		}
+	}
+	return peers
+}
+
+// interfaceByIndex is swappable for testing
+var interfaceByIndex = net.InterfaceByIndex
+
+func readSysfsString(path string) string {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
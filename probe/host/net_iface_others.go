@@ -0,0 +1,42 @@
+// +build !linux
+
+package host
+
+import (
+	"net"
+)
+
+// GetNetIfaces returns the network interfaces of the host, with their
+// addresses. Their kind isn't known outside Linux.
+var GetNetIfaces = func() ([]NetIface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]NetIface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		netIface := NetIface{
+			Name:  iface.Name,
+			Index: iface.Index,
+			MAC:   iface.HardwareAddr.String(),
+			MTU:   iface.MTU,
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			netIface.Kind = NetIfaceLoopback
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				netIface.Addresses = append(netIface.Addresses, addr.String())
+			}
+		}
+		result = append(result, netIface)
+	}
+	return result, nil
+}
+
+// GetVethPeers returns the names of the interfaces of the host which are the
+// peers of the interfaces of a process's network namespace. Network
+// namespaces only exist on Linux.
+var GetVethPeers = func(pid int) []string {
+	return nil
+}
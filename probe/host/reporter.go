@@ -3,9 +3,12 @@ package host
 import (
 	"fmt"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
+
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
@@ -23,8 +26,23 @@ const (
 	CPUUsage      = "host_cpu_usage_percent"
 	MemoryUsage   = "host_mem_usage_bytes"
 	ScopeVersion  = "host_scope_version"
+	GPUCount      = "host_gpu_count"
+	GPUUsage      = "host_gpu_usage_percent"
+	GPUMemory     = "host_gpu_mem_usage_bytes"
 )
 
+// Control IDs used by the host integration. Packets can only be captured
+// on Linux, and TTYs resized where there are ptys.
+const (
+	ExecHost       = "host_exec"
+	ResizeExecTTY  = "host_resize_exec_tty"
+	CapturePackets = "host_capture_packets"
+)
+
+// FilesystemUsagePrefix is the prefix of the metrics of the usage of the
+// host's filesystems, which are followed by their mount point.
+const FilesystemUsagePrefix = "host_fs_usage_bytes_"
+
 // Exposed for testing.
 const (
 	ProcUptime  = "/proc/uptime"
@@ -38,6 +56,7 @@ var (
 	MetadataTemplates = report.MetadataTemplates{
 		KernelVersion: {ID: KernelVersion, Label: "Kernel Version", From: report.FromLatest, Priority: 1},
 		Uptime:        {ID: Uptime, Label: "Uptime", From: report.FromLatest, Priority: 2},
+		GPUCount:      {ID: GPUCount, Label: "GPUs", From: report.FromLatest, Datatype: "number", Priority: 3},
 		HostName:      {ID: HostName, Label: "Hostname", From: report.FromLatest, Priority: 11},
 		OS:            {ID: OS, Label: "OS", From: report.FromLatest, Priority: 12},
 		LocalNetworks: {ID: LocalNetworks, Label: "Local Networks", From: report.FromSets, Priority: 13},
@@ -47,11 +66,20 @@ var (
 	MetricTemplates = report.MetricTemplates{
 		CPUUsage:    {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
 		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		GPUUsage:    {ID: GPUUsage, Label: "GPU", Format: report.PercentFormat, Priority: 3},
+		GPUMemory:   {ID: GPUMemory, Label: "GPU Memory", Format: report.FilesizeFormat, Priority: 4},
 		Load1:       {ID: Load1, Label: "Load (1m)", Format: report.DefaultFormat, Group: "load", Priority: 11},
 	}
 )
 
-// Reporter generates Reports containing the host topology.
+// FilesystemUsage is the usage of a filesystem of the host.
+type FilesystemUsage struct {
+	MountPoint  string
+	Used, Total float64 // bytes
+}
+
+// Reporter generates Reports containing the host and network interface
+// topologies.
 type Reporter struct {
 	sync.RWMutex
 	hostID          string
@@ -62,6 +90,7 @@ type Reporter struct {
 	hostShellCmd    []string
 	handlerRegistry *controls.HandlerRegistry
 	pipeIDToTTY     map[string]uintptr
+	gpuTimeout      time.Duration
 }
 
 // NewReporter returns a Reporter which produces a report containing host
@@ -76,11 +105,18 @@ func NewReporter(hostID, hostName, probeID, version string, pipes controls.PipeC
 		hostShellCmd:    getHostShellCmd(),
 		handlerRegistry: handlerRegistry,
 		pipeIDToTTY:     map[string]uintptr{},
+		gpuTimeout:      DefaultGPUTimeout,
 	}
 	r.registerControls()
 	return r
 }
 
+// SetGPUTimeout sets how long the GPUs of the host are queried for at
+// most, which should be shorter than the spy interval.
+func (r *Reporter) SetGPUTimeout(timeout time.Duration) {
+	r.gpuTimeout = timeout
+}
+
 // Name of this reporter, for metrics gathering
 func (*Reporter) Name() string { return "Host" }
 
@@ -123,28 +159,71 @@ func (r *Reporter) Report() (report.Report, error) {
 	memoryUsage, max := GetMemoryUsageBytes()
 	metrics[MemoryUsage] = report.MakeSingletonMetric(now, memoryUsage).WithMax(max)
 
+	for i, fs := range GetFilesystemUsage() {
+		id := FilesystemUsagePrefix + fs.MountPoint
+		metrics[id] = report.MakeSingletonMetric(now, fs.Used).WithMax(fs.Total)
+		rep.Host = rep.Host.WithMetricTemplates(report.MetricTemplates{
+			id: {
+				ID:     id,
+				Label:  "Disk " + fs.MountPoint,
+				Format: report.FilesizeFormat,
+				// After memory, and before GPUs, in the order of the mounts
+				Priority: 2 + float64(i+1)/100,
+			},
+		})
+	}
+
+	latest := map[string]string{
+		report.ControlProbeID: r.probeID,
+		Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
+		HostName:              r.hostName,
+		OS:                    runtime.GOOS,
+		KernelVersion:         kernel,
+		Uptime:                uptime.String(),
+		ScopeVersion:          r.version,
+	}
+	if gpus, err := GetGPUs(r.gpuTimeout); err != nil {
+		log.Warnf("Error getting GPUs: %v", err)
+	} else if len(gpus) > 0 {
+		latest[GPUCount] = strconv.Itoa(len(gpus))
+		gpuUsage, gpuMemory, gpuMemoryTotal := 0.0, 0.0, 0.0
+		for _, gpu := range gpus {
+			gpuUsage += gpu.Utilization
+			gpuMemory += gpu.MemoryUsed
+			gpuMemoryTotal += gpu.MemoryTotal
+		}
+		// Usage is the mean over all GPUs, like CPU usage is over all cores
+		metrics[GPUUsage] = report.MakeSingletonMetric(now, gpuUsage/float64(len(gpus))).WithMax(100)
+		metrics[GPUMemory] = report.MakeSingletonMetric(now, gpuMemory).WithMax(gpuMemoryTotal)
+	}
+
 	rep.Host.AddNode(
-		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), map[string]string{
-			report.ControlProbeID: r.probeID,
-			Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
-			HostName:              r.hostName,
-			OS:                    runtime.GOOS,
-			KernelVersion:         kernel,
-			Uptime:                uptime.String(),
-			ScopeVersion:          r.version,
-		}).
+		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), latest).
 			WithSets(report.MakeSets().
 				Add(LocalNetworks, report.MakeStringSet(localCIDRs...)),
 			).
 			WithMetrics(metrics).
-			WithLatestActiveControls(ExecHost),
+			WithLatestActiveControls(activeControls...),
 	)
 
+	if ifaces, err := GetNetIfaces(); err != nil {
+		log.Warnf("Error getting network interfaces: %v", err)
+	} else {
+		rep.NetIface = rep.NetIface.Merge(netIfaceTopology(r.hostID, ifaces))
+	}
+
 	rep.Host.Controls.AddControl(report.Control{
 		ID:    ExecHost,
 		Human: "Exec shell",
 		Icon:  "fa-terminal",
 	})
+	if len(captureControls) > 0 {
+		rep.Host.Controls.AddControl(report.Control{
+			ID:    CapturePackets,
+			Human: "Capture packets",
+			Icon:  "fa-download",
+		})
+	}
 
 	return rep, nil
 }
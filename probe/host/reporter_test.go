@@ -40,6 +40,9 @@ func TestReporter(t *testing.T) {
 		oldGetCPUUsagePercent         = host.GetCPUUsagePercent
 		oldGetMemoryUsageBytes        = host.GetMemoryUsageBytes
 		oldGetLocalNetworks           = host.GetLocalNetworks
+		oldGetGPUs                    = host.GetGPUs
+		oldGetFilesystemUsage         = host.GetFilesystemUsage
+		oldGetNetIfaces               = host.GetNetIfaces
 	)
 	defer func() {
 		host.GetKernelReleaseAndVersion = oldGetKernelReleaseAndVersion
@@ -48,6 +51,9 @@ func TestReporter(t *testing.T) {
 		host.GetCPUUsagePercent = oldGetCPUUsagePercent
 		host.GetMemoryUsageBytes = oldGetMemoryUsageBytes
 		host.GetLocalNetworks = oldGetLocalNetworks
+		host.GetGPUs = oldGetGPUs
+		host.GetFilesystemUsage = oldGetFilesystemUsage
+		host.GetNetIfaces = oldGetNetIfaces
 	}()
 	host.GetKernelReleaseAndVersion = func() (string, string, error) { return release, version, nil }
 	host.GetLoad = func(time.Time) report.Metrics { return metrics }
@@ -55,6 +61,23 @@ func TestReporter(t *testing.T) {
 	host.GetCPUUsagePercent = func() (float64, float64) { return 30.0, 100.0 }
 	host.GetMemoryUsageBytes = func() (float64, float64) { return 60.0, 100.0 }
 	host.GetLocalNetworks = func() ([]*net.IPNet, error) { return []*net.IPNet{ipnet}, nil }
+	host.GetGPUs = func(time.Duration) ([]host.GPU, error) {
+		return []host.GPU{
+			{Index: 0, Utilization: 20, MemoryUsed: 1024, MemoryTotal: 4096},
+			{Index: 1, Utilization: 60, MemoryUsed: 2048, MemoryTotal: 4096},
+		}, nil
+	}
+
+	host.GetFilesystemUsage = func() []host.FilesystemUsage {
+		return []host.FilesystemUsage{{MountPoint: "/", Used: 300, Total: 1000}}
+	}
+
+	host.GetNetIfaces = func() ([]host.NetIface, error) {
+		return []host.NetIface{
+			{Name: "docker0", Kind: host.NetIfaceBridge, State: "up", MTU: 1500, Addresses: []string{"172.17.0.1/16"}},
+			{Name: "veth1234", Kind: host.NetIfaceVeth, State: "up", MTU: 1500, Master: "docker0"},
+		}, nil
+	}
 
 	hr := controls.NewDefaultHandlerRegistry()
 	rpt, err := host.NewReporter(hostID, hostname, "", "", nil, hr).Report()
@@ -77,6 +100,7 @@ func TestReporter(t *testing.T) {
 		{host.OS, runtime.GOOS},
 		{host.Uptime, uptime},
 		{host.KernelVersion, kernel},
+		{host.GPUCount, "2"},
 	} {
 		if have, ok := node.Latest.Lookup(tuple.key); !ok || have != tuple.want {
 			t.Errorf("Expected %s %q, got %q", tuple.key, tuple.want, have)
@@ -99,4 +123,51 @@ func TestReporter(t *testing.T) {
 			t.Errorf("Expected %s metric sample %f, got %f", key, wantSample.Value, sample.Value)
 		}
 	}
+
+	// Should have the usage of the GPUs
+	for key, want := range map[string]float64{
+		host.GPUUsage:  40,
+		host.GPUMemory: 3072,
+	} {
+		metric, ok := node.Metrics[key]
+		if !ok {
+			t.Errorf("Expected %s metric, but not found", key)
+			continue
+		}
+		if sample, ok := metric.LastSample(); !ok || sample.Value != want {
+			t.Errorf("Expected %s metric sample %f, got %v", key, want, sample)
+		}
+	}
+	if max := node.Metrics[host.GPUMemory].Max; max != 8192 {
+		t.Errorf("Expected the GPU memory to be out of 8192, got %f", max)
+	}
+
+	// Should have the usage of the filesystems, with their templates
+	fsUsage := host.FilesystemUsagePrefix + "/"
+	if metric, ok := node.Metrics[fsUsage]; !ok {
+		t.Errorf("Expected %s metric, but not found", fsUsage)
+	} else if sample, ok := metric.LastSample(); !ok || sample.Value != 300 || metric.Max != 1000 {
+		t.Errorf("Expected %s metric of 300 out of 1000, got %v", fsUsage, metric)
+	}
+	if template, ok := rpt.Host.MetricTemplates[fsUsage]; !ok || template.Label != "Disk /" {
+		t.Errorf("Expected a template for %s, got %v", fsUsage, template)
+	}
+
+	// Should have the network interfaces, with bridge ports adjacent to
+	// their bridge
+	bridgeID := report.MakeNetIfaceNodeID(hostID, "docker0")
+	bridge, ok := rpt.NetIface.Nodes[bridgeID]
+	if !ok {
+		t.Fatalf("Expected interface %q, but not found", bridgeID)
+	}
+	if have, ok := bridge.Sets.Lookup(host.NetIfaceAddresses); !ok || !have.Contains("172.17.0.1/16") {
+		t.Errorf("Expected docker0 to have address 172.17.0.1/16, got %v", have)
+	}
+	if parents, _ := bridge.Parents.Lookup(report.Host); !parents.Contains(nodeID) {
+		t.Errorf("Expected docker0 to be on host %q, got %v", nodeID, parents)
+	}
+	veth := rpt.NetIface.Nodes[report.MakeNetIfaceNodeID(hostID, "veth1234")]
+	if kind, _ := veth.Latest.Lookup(host.NetIfaceKind); kind != host.NetIfaceVeth || !veth.Adjacency.Contains(bridgeID) {
+		t.Errorf("Expected veth1234 to be a veth adjacent to docker0, got %v", veth)
+	}
 }
@@ -84,3 +84,9 @@ var GetCPUUsagePercent = func() (float64, float64) {
 var GetMemoryUsageBytes = func() (float64, float64) {
 	return 0.0, 0.0
 }
+
+// GetFilesystemUsage returns the usage of the filesystems of the host. It
+// isn't implemented here.
+var GetFilesystemUsage = func() []FilesystemUsage {
+	return nil
+}
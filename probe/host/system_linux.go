@@ -1,6 +1,7 @@
 package host
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"strconv"
@@ -107,3 +108,78 @@ var GetMemoryUsageBytes = func() (float64, float64) {
 	used := meminfo.MemTotal - meminfo.MemFree - meminfo.Buffers - meminfo.Cached
 	return float64(used * kb), float64(meminfo.MemTotal * kb)
 }
+
+// Exposed for testing.
+var (
+	// HostMounts are the mounts of the mount namespace of the host, which
+	// are under HostRoot. When the probe can't see them, its own are used.
+	HostMounts = "/proc/1/mounts"
+	HostRoot   = "/proc/1/root"
+)
+
+// Filesystems which are on block devices, but not worth reporting.
+var ignoredFilesystemTypes = map[string]struct{}{
+	"squashfs": {}, // read-only images, like snaps
+	"iso9660":  {},
+}
+
+// GetFilesystemUsage returns the bytes used and total of each filesystem on
+// a block device, by its first mount point.
+var GetFilesystemUsage = func() []FilesystemUsage {
+	root := HostRoot
+	buf, err := ioutil.ReadFile(HostMounts)
+	if err != nil {
+		root = ""
+		if buf, err = ioutil.ReadFile("/proc/mounts"); err != nil {
+			return nil
+		}
+	}
+	result := []FilesystemUsage{}
+	seen := map[string]struct{}{}
+	for _, line := range strings.Split(string(buf), "\n") {
+		// device mountpoint type options dump pass
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		if _, ok := ignoredFilesystemTypes[fields[2]]; ok {
+			continue
+		}
+		// Bind mounts show the same filesystem again
+		if _, ok := seen[fields[0]]; ok {
+			continue
+		}
+		seen[fields[0]] = struct{}{}
+		mountPoint := unescapeMountPoint(fields[1])
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(root+mountPoint, &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		result = append(result, FilesystemUsage{
+			MountPoint: mountPoint,
+			Used:       float64((stat.Blocks - stat.Bfree) * uint64(stat.Bsize)),
+			Total:      float64(stat.Blocks * uint64(stat.Bsize)),
+		})
+	}
+	return result
+}
+
+// unescapeMountPoint undoes the octal escaping of spaces and the like in
+// /proc/mounts.
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -2,6 +2,9 @@ package host_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 
@@ -39,3 +42,37 @@ func string2c(s string) [65]int8 {
 	}
 	return result
 }
+
+func TestGetFilesystemUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "my data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mounts := filepath.Join(dir, "mounts")
+	if err := ioutil.WriteFile(mounts, []byte(`sysfs /sys sysfs rw,nosuid 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sda1 /var/lib/docker/plugins ext4 rw,relatime 0 0
+/dev/sdb1 /my\040data xfs rw 0 0
+/dev/loop0 /snap/core squashfs ro 0 0
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldHostMounts, oldHostRoot := host.HostMounts, host.HostRoot
+	defer func() { host.HostMounts, host.HostRoot = oldHostMounts, oldHostRoot }()
+	host.HostMounts, host.HostRoot = mounts, dir
+
+	usage := host.GetFilesystemUsage()
+	if len(usage) != 2 || usage[0].MountPoint != "/" || usage[1].MountPoint != "/my data" {
+		t.Fatalf("Expected / and /my data, got %v", usage)
+	}
+	for _, fs := range usage {
+		if fs.Total <= 0 || fs.Used > fs.Total {
+			t.Errorf("Expected %s to have some size, got %v", fs.MountPoint, fs)
+		}
+	}
+}
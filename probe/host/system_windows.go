@@ -0,0 +1,119 @@
+package host
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/weaveworks/scope/report"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetTickCount64       = kernel32.NewProc("GetTickCount64")
+	procGetSystemTimes       = kernel32.NewProc("GetSystemTimes")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// memoryStatusEx is MEMORYSTATUSEX, as filled in by GlobalMemoryStatusEx.
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// GetKernelReleaseAndVersion returns the Windows version, as major.minor
+// release and build number.
+var GetKernelReleaseAndVersion = func() (string, string, error) {
+	version, err := syscall.GetVersion()
+	if err != nil {
+		return "unknown", "unknown", err
+	}
+	var (
+		major = byte(version)
+		minor = uint8(version >> 8)
+		build = uint16(version >> 16)
+	)
+	return fmt.Sprintf("%d.%d", major, minor), fmt.Sprintf("%d", build), nil
+}
+
+// GetLoad returns no metrics - Windows doesn't have load averages.
+var GetLoad = func(now time.Time) report.Metrics {
+	return nil
+}
+
+// GetUptime returns the uptime of the host.
+var GetUptime = func() (time.Duration, error) {
+	if err := procGetTickCount64.Find(); err != nil {
+		return 0, err
+	}
+	ms, _, _ := procGetTickCount64.Call()
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+type systemTimes struct {
+	idle, kernel, user syscall.Filetime
+}
+
+func getSystemTimes() (systemTimes, error) {
+	var t systemTimes
+	if err := procGetSystemTimes.Find(); err != nil {
+		return t, err
+	}
+	ok, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&t.idle)),
+		uintptr(unsafe.Pointer(&t.kernel)),
+		uintptr(unsafe.Pointer(&t.user)),
+	)
+	if ok == 0 {
+		return t, err
+	}
+	return t, nil
+}
+
+var previousTimes systemTimes
+
+// GetCPUUsagePercent returns the percent cpu usage and max (i.e. 100% or 0 if unavailable)
+var GetCPUUsagePercent = func() (float64, float64) {
+	current, err := getSystemTimes()
+	if err != nil {
+		return 0.0, 0.0
+	}
+	var (
+		// Kernel time includes the idle time
+		idled  = current.idle.Nanoseconds() - previousTimes.idle.Nanoseconds()
+		totald = current.kernel.Nanoseconds() - previousTimes.kernel.Nanoseconds() +
+			current.user.Nanoseconds() - previousTimes.user.Nanoseconds()
+	)
+	previousTimes = current
+	if totald <= 0 {
+		return 0.0, 100.
+	}
+	return float64(totald-idled) * 100. / float64(totald), 100.
+}
+
+// GetMemoryUsageBytes returns the bytes memory usage and max
+var GetMemoryUsageBytes = func() (float64, float64) {
+	if err := procGlobalMemoryStatusEx.Find(); err != nil {
+		return 0.0, 0.0
+	}
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	if ok, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ok == 0 {
+		return 0.0, 0.0
+	}
+	return float64(status.totalPhys - status.availPhys), float64(status.totalPhys)
+}
+
+// GetFilesystemUsage returns the usage of the filesystems of the host. It
+// isn't implemented here.
+var GetFilesystemUsage = func() []FilesystemUsage {
+	return nil
+}
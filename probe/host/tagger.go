@@ -22,12 +22,16 @@ func NewTagger(hostID string) Tagger {
 // Name of this tagger, for metrics gathering
 func (Tagger) Name() string { return "Host" }
 
-// Tag implements Tagger.
+// Tag implements Tagger. Nodes are tagged with the cluster ID of the probe
+// too, when it has one, for their addresses to be scoped as in node IDs.
 func (t Tagger) Tag(r report.Report) (report.Report, error) {
 	var (
 		metadata = map[string]string{report.HostNodeID: t.hostNodeID}
 		parents  = report.MakeSets().Add(report.Host, report.MakeStringSet(t.hostNodeID))
 	)
+	if report.AddressScope != "" {
+		metadata[report.ClusterID] = report.AddressScope
+	}
 
 	// Explicitly don't tag Endpoints, Addresses and Overlay nodes - These topologies include pseudo nodes,
 	// and as such do their own host tagging.
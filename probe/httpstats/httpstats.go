@@ -0,0 +1,246 @@
+// Package httpstats counts the HTTP requests served by processes, and the
+// classes of the status codes of their responses, from the traffic snooped
+// on the host.
+package httpstats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// Metric IDs of the HTTP traffic of processes and containers.
+const (
+	RequestRate     = "http_requests_per_second"
+	ClientErrorRate = "http_client_error_rate" // 4xx, as a percentage of responses
+	ServerErrorRate = "http_server_error_rate" // 5xx, as a percentage of responses
+)
+
+// MetricTemplates of processes and containers serving HTTP, exposed for
+// testing.
+var MetricTemplates = report.MetricTemplates{
+	RequestRate:     {ID: RequestRate, Label: "HTTP req/s", Priority: 20},
+	ClientErrorRate: {ID: ClientErrorRate, Label: "HTTP 4xx", Format: report.PercentFormat, Priority: 21},
+	ServerErrorRate: {ID: ServerErrorRate, Label: "HTTP 5xx", Format: report.PercentFormat, Priority: 22},
+}
+
+// methods are the starts of the payloads of HTTP/1 requests.
+var methods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("DELETE "),
+	[]byte("HEAD "), []byte("PATCH "), []byte("OPTIONS "),
+}
+
+var responsePrefix = []byte("HTTP/1.")
+
+// Message is what a TCP payload starting an HTTP/1 message tells: whether
+// it's a request, and the status code of responses.
+type Message struct {
+	Request bool
+	Status  int
+}
+
+// ParseMessage parses the start of a TCP payload, as an HTTP/1 request line
+// ("GET /path HTTP/1.1") or status line ("HTTP/1.1 200 OK").
+func ParseMessage(payload []byte) (Message, bool) {
+	for _, method := range methods {
+		if bytes.HasPrefix(payload, method) {
+			return Message{Request: true}, true
+		}
+	}
+	// HTTP/1.x NNN
+	if !bytes.HasPrefix(payload, responsePrefix) || len(payload) < 12 || payload[8] != ' ' {
+		return Message{}, false
+	}
+	status, err := strconv.Atoi(string(payload[9:12]))
+	if err != nil || status < 100 || status > 599 {
+		return Message{}, false
+	}
+	return Message{Status: status}, true
+}
+
+// counts are the HTTP messages seen for a server endpoint.
+type counts struct {
+	requests  int
+	responses [6]int // by class of status code, 1xx to 5xx
+}
+
+func (c *counts) add(o counts) {
+	c.requests += o.requests
+	for i := range c.responses {
+		c.responses[i] += o.responses[i]
+	}
+}
+
+func (c counts) metrics(now time.Time, elapsed time.Duration) map[string]report.Metric {
+	result := map[string]report.Metric{
+		RequestRate: report.MakeSingletonMetric(now, float64(c.requests)/elapsed.Seconds()),
+	}
+	total := 0
+	for _, n := range c.responses {
+		total += n
+	}
+	if total > 0 {
+		result[ClientErrorRate] = report.MakeSingletonMetric(now, 100*float64(c.responses[4])/float64(total)).WithMax(100)
+		result[ServerErrorRate] = report.MakeSingletonMetric(now, 100*float64(c.responses[5])/float64(total)).WithMax(100)
+	}
+	return result
+}
+
+// Counter counts the HTTP messages by the endpoint of their server.
+type Counter struct {
+	mtx   sync.Mutex
+	since time.Time
+	byEnd map[string]*counts // by host:port of the server
+}
+
+// NewCounter makes a new Counter.
+func NewCounter() *Counter {
+	return &Counter{
+		since: mtime.Now(),
+		byEnd: map[string]*counts{},
+	}
+}
+
+// Filter implements snoop.Observer, matching the segments whose payload
+// starts with the first 4 bytes of a method or of "HTTP/1.".
+func (c *Counter) Filter() string {
+	var prefixes []string
+	for _, prefix := range append(methods, responsePrefix) {
+		padded := append(append([]byte{}, prefix...), ' ', ' ', ' ')
+		prefixes = append(prefixes, fmt.Sprintf("tcp[((tcp[12:1] & 0xf0) >> 2):4] = 0x%08x", binary.BigEndian.Uint32(padded)))
+	}
+	return strings.Join(prefixes, " or ")
+}
+
+// Observe implements snoop.Observer, counting the payload of a TCP segment
+// from src to dst if it starts an HTTP message. Requests are sent to the
+// server and responses by it.
+func (c *Counter) Observe(src, dst net.IP, srcPort, dstPort uint16, payload []byte) {
+	msg, ok := ParseMessage(payload)
+	if !ok {
+		return
+	}
+	server := net.JoinHostPort(src.String(), strconv.Itoa(int(srcPort)))
+	if msg.Request {
+		server = net.JoinHostPort(dst.String(), strconv.Itoa(int(dstPort)))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	n, ok := c.byEnd[server]
+	if !ok {
+		n = &counts{}
+		c.byEnd[server] = n
+	}
+	if msg.Request {
+		n.requests++
+	} else {
+		n.responses[msg.Status/100]++
+	}
+}
+
+// reset gives the counts since the last reset, and how long ago it was.
+func (c *Counter) reset(now time.Time) (map[string]*counts, time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	byEnd, elapsed := c.byEnd, now.Sub(c.since)
+	c.byEnd, c.since = map[string]*counts{}, now
+	return byEnd, elapsed
+}
+
+// Tagger adds the rates of HTTP requests, and their error rates, to the
+// processes serving them and to their containers. Processes are found by
+// the endpoints of the report, so it must come after the Docker tagger for
+// the containers to be.
+type Tagger struct {
+	hostID  string
+	counter *Counter
+}
+
+// NewTagger makes a new Tagger of the messages counted by counter.
+func NewTagger(hostID string, counter *Counter) *Tagger {
+	return &Tagger{
+		hostID:  hostID,
+		counter: counter,
+	}
+}
+
+// Name of this tagger, for metrics gathering
+func (*Tagger) Name() string { return "HTTP" }
+
+// Tag implements Tagger.
+func (t *Tagger) Tag(rpt report.Report) (report.Report, error) {
+	now := mtime.Now()
+	byEnd, elapsed := t.counter.reset(now)
+	if len(byEnd) == 0 || elapsed <= 0 {
+		return rpt, nil
+	}
+
+	// The lowest PID of the sockets of an endpoint, which is the parent
+	// of the other processes if they share it.
+	pids := map[string]int{}
+	for id, n := range rpt.Endpoint.Nodes {
+		pidStr, ok := n.Latest.Lookup(process.PID)
+		if !ok {
+			continue
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+		_, addr, port, ok := report.ParseEndpointNodeID(id)
+		if !ok {
+			continue
+		}
+		end := net.JoinHostPort(addr, port)
+		if other, ok := pids[end]; !ok || pid < other {
+			pids[end] = pid
+		}
+	}
+
+	byProcess := map[string]*counts{}
+	for end, c := range byEnd {
+		pid, ok := pids[end]
+		if !ok {
+			continue
+		}
+		id := report.MakeProcessNodeID(t.hostID, strconv.Itoa(pid))
+		if _, ok := byProcess[id]; !ok {
+			byProcess[id] = &counts{}
+		}
+		byProcess[id].add(*c)
+	}
+	if len(byProcess) == 0 {
+		return rpt, nil
+	}
+
+	byContainer := map[string]*counts{}
+	for id, c := range byProcess {
+		rpt.Process.AddNode(report.MakeNode(id).WithMetrics(c.metrics(now, elapsed)))
+		containers, _ := rpt.Process.Nodes[id].Parents.Lookup(report.Container)
+		for _, container := range containers {
+			if _, ok := byContainer[container]; !ok {
+				byContainer[container] = &counts{}
+			}
+			byContainer[container].add(*c)
+		}
+	}
+	rpt.Process = rpt.Process.WithMetricTemplates(MetricTemplates)
+	for id, c := range byContainer {
+		rpt.Container.AddNode(report.MakeNode(id).WithMetrics(c.metrics(now, elapsed)))
+	}
+	if len(byContainer) > 0 {
+		rpt.Container = rpt.Container.WithMetricTemplates(MetricTemplates)
+	}
+	return rpt, nil
+}
@@ -0,0 +1,88 @@
+package httpstats_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/probe/httpstats"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestParseMessage(t *testing.T) {
+	for _, c := range []struct {
+		payload string
+		ok      bool
+		want    httpstats.Message
+	}{
+		{"GET /index.html HTTP/1.1\r\n", true, httpstats.Message{Request: true}},
+		{"DELETE /things/1 HTTP/1.1\r\n", true, httpstats.Message{Request: true}},
+		{"HTTP/1.1 200 OK\r\n", true, httpstats.Message{Status: 200}},
+		{"HTTP/1.0 503 Service Unavailable\r\n", true, httpstats.Message{Status: 503}},
+		{"HTTP/1.1 abc\r\n", false, httpstats.Message{}},
+		{"HTTP/1.1 999 What\r\n", false, httpstats.Message{}},
+		{"GETTING", false, httpstats.Message{}},
+		{"\x16\x03\x01", false, httpstats.Message{}},
+	} {
+		have, ok := httpstats.ParseMessage([]byte(c.payload))
+		if ok != c.ok || have != c.want {
+			t.Errorf("%q: expected %v, %v, got %v, %v", c.payload, c.want, c.ok, have, ok)
+		}
+	}
+}
+
+func TestTagger(t *testing.T) {
+	start := time.Unix(0, 0)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	var (
+		server    = net.ParseIP("10.0.0.2")
+		client    = net.ParseIP("10.0.0.1")
+		processID = report.MakeProcessNodeID("host", "42")
+		container = report.MakeContainerNodeID("abc")
+	)
+	counter := httpstats.NewCounter()
+	for i := 0; i < 4; i++ {
+		counter.Observe(client, server, 50000, 80, []byte("GET / HTTP/1.1\r\n"))
+	}
+	for _, status := range []string{"200", "200", "404", "500"} {
+		counter.Observe(server, client, 80, 50000, []byte("HTTP/1.1 "+status+" Whatever\r\n"))
+	}
+	// Not served by a process of the report
+	counter.Observe(client, server, 50000, 8080, []byte("GET / HTTP/1.1\r\n"))
+
+	rpt := report.MakeReport()
+	rpt.Endpoint.AddNode(report.MakeNodeWith(report.MakeEndpointNodeID("host", "", server.String(), "80"), map[string]string{
+		process.PID: "42",
+	}))
+	rpt.Process.AddNode(report.MakeNode(processID).WithParents(report.MakeSets().
+		Add(report.Container, report.MakeStringSet(container)),
+	))
+
+	mtime.NowForce(start.Add(2 * time.Second))
+	rpt, err := httpstats.NewTagger("host", counter).Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Process.Nodes) != 1 {
+		t.Errorf("Expected only the process serving requests, got %v", rpt.Process.Nodes)
+	}
+	for _, node := range []report.Node{rpt.Process.Nodes[processID], rpt.Container.Nodes[container]} {
+		for id, want := range map[string]float64{
+			httpstats.RequestRate:     2,
+			httpstats.ClientErrorRate: 25,
+			httpstats.ServerErrorRate: 25,
+		} {
+			if sample, ok := node.Metrics[id].LastSample(); !ok || sample.Value != want {
+				t.Errorf("Expected %s of %s to be %v, got %v", id, node.ID, want, sample)
+			}
+		}
+	}
+	if _, ok := rpt.Container.MetricTemplates[httpstats.RequestRate]; !ok {
+		t.Errorf("Expected the HTTP metric templates on containers")
+	}
+}
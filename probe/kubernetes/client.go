@@ -3,25 +3,33 @@ package kubernetes
 import (
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/weaveworks/common/backoff"
-
 	log "github.com/Sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	apiappsv1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
 	apibatchv1 "k8s.io/client-go/pkg/apis/batch/v1"
 	apibatchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	apiextensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	apipolicyv1beta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/weaveworks/scope/common/backoff"
 )
 
 // Client keeps track of running kubernetes pods and services
@@ -35,14 +43,22 @@ type Client interface {
 	WalkStatefulSets(f func(StatefulSet) error) error
 	WalkCronJobs(f func(CronJob) error) error
 	WalkReplicationControllers(f func(ReplicationController) error) error
+	WalkCustomResources(f func(CustomResource) error) error
+	WalkNetworkPolicies(f func(NetworkPolicy) error) error
 	WalkNodes(f func(*apiv1.Node) error) error
+	WalkEvents(f func(ClusterEvent) error) error
 
 	WatchPods(f func(Event, Pod))
 
-	GetLogs(namespaceID, podID string) (io.ReadCloser, error)
+	GetLogs(namespaceID, podID string, opts LogOptions) (io.ReadCloser, error)
 	DeletePod(namespaceID, podID string) error
 	ScaleUp(resource, namespaceID, id string) error
 	ScaleDown(resource, namespaceID, id string) error
+	RestartDeployment(namespaceID, id string) error
+	PauseDeployment(namespaceID, id string, paused bool) error
+	RollbackDeployment(namespaceID, id string) error
+	CordonNode(name string, unschedulable bool) error
+	DrainNode(name string, gracePeriod *int64) error
 }
 
 type client struct {
@@ -59,6 +75,9 @@ type client struct {
 	cronJobStore               cache.Store
 	replicationControllerStore cache.Store
 	nodeStore                  cache.Store
+	customResourceStores       []cache.Store
+	networkPolicyStore         cache.Store
+	eventStore                 cache.Store
 
 	podWatchesMutex sync.Mutex
 	podWatches      []func(Event, Pod)
@@ -79,6 +98,9 @@ func runReflectorUntil(r *cache.Reflector, resyncPeriod time.Duration, stopCh <-
 	bo := backoff.New(listAndWatch, fmt.Sprintf("Kubernetes reflector (%s)", msg))
 	bo.SetInitialBackoff(resyncPeriod)
 	bo.SetMaxBackoff(5 * time.Minute)
+	// Every probe of the cluster relists when the API server comes back, so
+	// spread them out.
+	bo.SetJitter(0.2)
 	go bo.Start()
 }
 
@@ -97,6 +119,7 @@ type ClientConfig struct {
 	Token                string
 	User                 string
 	Username             string
+	CustomResources      []CustomResourceType
 }
 
 // NewClient returns a usable Client. Don't forget to Stop it.
@@ -159,6 +182,7 @@ func NewClient(config ClientConfig) (Client, error) {
 	result.serviceStore = result.setupStore(c.CoreV1Client.RESTClient(), "services", &apiv1.Service{}, nil)
 	result.replicationControllerStore = result.setupStore(c.CoreV1Client.RESTClient(), "replicationcontrollers", &apiv1.ReplicationController{}, nil)
 	result.nodeStore = result.setupStore(c.CoreV1Client.RESTClient(), "nodes", &apiv1.Node{}, nil)
+	result.eventStore = result.setupStore(c.CoreV1Client.RESTClient(), "events", &apiv1.Event{}, nil)
 
 	// We list deployments here to check if this version of kubernetes is >= 1.2.
 	// We would use NegotiateVersion, but Kubernetes 1.1 "supports"
@@ -170,6 +194,12 @@ func NewClient(config ClientConfig) (Client, error) {
 		result.replicaSetStore = result.setupStore(c.ExtensionsV1beta1Client.RESTClient(), "replicasets", &apiextensionsv1beta1.ReplicaSet{}, nil)
 		result.daemonSetStore = result.setupStore(c.ExtensionsV1beta1Client.RESTClient(), "daemonsets", &apiextensionsv1beta1.DaemonSet{}, nil)
 	}
+	// There is no typed client for NetworkPolicies in the version of client-go we use.
+	if err := c.ExtensionsV1beta1Client.RESTClient().Get().Resource("networkpolicies").Do().Error(); err != nil {
+		log.Infof("NetworkPolicies are not supported by this Kubernetes version: %v", err)
+	} else {
+		result.networkPolicyStore = result.setupStore(c.ExtensionsV1beta1Client.RESTClient(), "networkpolicies", &apiextensionsv1beta1.NetworkPolicy{}, nil)
+	}
 	// CronJobs and StatefulSets were introduced later. Easiest to use the same technique.
 	if _, err := c.BatchV2alpha1().CronJobs(metav1.NamespaceAll).List(metav1.ListOptions{}); err != nil {
 		log.Infof("CronJobs are not supported by this Kubernetes version: %v", err)
@@ -183,9 +213,42 @@ func NewClient(config ClientConfig) (Client, error) {
 		result.statefulSetStore = result.setupStore(c.AppsV1beta1Client.RESTClient(), "statefulsets", &apiappsv1beta1.StatefulSet{}, nil)
 	}
 
+	for _, t := range config.CustomResources {
+		store, err := result.setupCustomResourceStore(restConfig, t)
+		if err != nil {
+			log.Errorf("kubernetes: cannot watch custom resource %s: %v", t, err)
+			continue
+		}
+		result.customResourceStores = append(result.customResourceStores, store)
+	}
+
 	return result, nil
 }
 
+// setupCustomResourceStore watches the instances of a custom resource type
+// through the dynamic client, since we have no typed client for them.
+func (c *client) setupCustomResourceStore(restConfig *rest.Config, t CustomResourceType) (cache.Store, error) {
+	config := *restConfig
+	config.APIPath = "/apis"
+	config.GroupVersion = &schema.GroupVersion{Group: t.Group, Version: t.Version}
+	dc, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, err
+	}
+	rc := dc.Resource(&metav1.APIResource{Name: t.Resource, Kind: t.Kind, Namespaced: true}, metav1.NamespaceAll)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return rc.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return rc.Watch(options)
+		},
+	}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	runReflectorUntil(cache.NewReflector(lw, &unstructured.Unstructured{}, store, c.resyncPeriod), c.resyncPeriod, c.quit, t.Resource+"."+t.Group)
+	return store, nil
+}
+
 func (c *client) setupStore(kclient cache.Getter, resource string, itemType interface{}, nonDefaultStore cache.Store) cache.Store {
 	lw := cache.NewListWatchFromClient(kclient, resource, metav1.NamespaceAll, fields.Everything())
 	store := nonDefaultStore
@@ -317,6 +380,33 @@ func (c *client) WalkCronJobs(f func(CronJob) error) error {
 	return nil
 }
 
+// WalkCustomResources calls f for each instance of the configured custom resources
+func (c *client) WalkCustomResources(f func(CustomResource) error) error {
+	for _, store := range c.customResourceStores {
+		for _, m := range store.List() {
+			u := m.(*unstructured.Unstructured)
+			if err := f(NewCustomResource(u)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WalkNetworkPolicies calls f for each network policy
+func (c *client) WalkNetworkPolicies(f func(NetworkPolicy) error) error {
+	if c.networkPolicyStore == nil {
+		return nil
+	}
+	for _, m := range c.networkPolicyStore.List() {
+		np := m.(*apiextensionsv1beta1.NetworkPolicy)
+		if err := f(NewNetworkPolicy(np)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *client) WalkNodes(f func(*apiv1.Node) error) error {
 	for _, m := range c.nodeStore.List() {
 		node := m.(*apiv1.Node)
@@ -327,12 +417,44 @@ func (c *client) WalkNodes(f func(*apiv1.Node) error) error {
 	return nil
 }
 
-func (c *client) GetLogs(namespaceID, podID string) (io.ReadCloser, error) {
+// WalkEvents calls f for each event
+func (c *client) WalkEvents(f func(ClusterEvent) error) error {
+	for _, m := range c.eventStore.List() {
+		e := m.(*apiv1.Event)
+		if err := f(NewClusterEvent(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultContainerAnnotation names the container of a pod whose logs are
+// shown when no container is chosen, as with kubectl.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+func (c *client) GetLogs(namespaceID, podID string, opts LogOptions) (io.ReadCloser, error) {
+	container := opts.Container
+	if container == "" {
+		// The logs of pods with several containers are of the default
+		// container, or the first one.
+		if m, ok, err := c.podStore.GetByKey(namespaceID + "/" + podID); err == nil && ok {
+			p := m.(*apiv1.Pod)
+			if len(p.Spec.Containers) > 1 {
+				container = p.Spec.Containers[0].Name
+				if name, ok := p.ObjectMeta.Annotations[defaultContainerAnnotation]; ok {
+					container = name
+				}
+			}
+		}
+	}
 	req := c.client.CoreV1().Pods(namespaceID).GetLogs(
 		podID,
 		&apiv1.PodLogOptions{
-			Follow:     true,
-			Timestamps: true,
+			Container:  container,
+			Follow:     opts.Follow,
+			Previous:   opts.Previous,
+			Timestamps: opts.Timestamps,
+			TailLines:  opts.TailLines,
 		},
 	)
 	return req.Stream()
@@ -365,6 +487,98 @@ func (c *client) modifyScale(resource, namespace, id string, f func(*apiextensio
 	return err
 }
 
+// restartedAtAnnotation is set on the pod template of a deployment to roll
+// it out again, as with kubectl rollout restart.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+func (c *client) RestartDeployment(namespaceID, id string) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, time.Now().Format(time.RFC3339))
+	_, err := c.client.Extensions().Deployments(namespaceID).Patch(id, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+func (c *client) PauseDeployment(namespaceID, id string, paused bool) error {
+	patch := fmt.Sprintf(`{"spec":{"paused":%t}}`, paused)
+	_, err := c.client.Extensions().Deployments(namespaceID).Patch(id, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+// RollbackDeployment rolls a deployment back to the revision before its
+// current one.
+func (c *client) RollbackDeployment(namespaceID, id string) error {
+	return c.client.Extensions().Deployments(namespaceID).Rollback(&apiextensionsv1beta1.DeploymentRollback{
+		Name:       id,
+		RollbackTo: apiextensionsv1beta1.RollbackConfig{Revision: 0},
+	})
+}
+
+// forbidden explains the errors of requests the service account of the probe
+// is not allowed to make, which need RBAC rules granting them.
+func forbidden(err error, action string) error {
+	if apierrors.IsForbidden(err) {
+		return fmt.Errorf("The service account of the probe is not allowed to %s; grant it with an RBAC rule: %v", action, err)
+	}
+	return err
+}
+
+func (c *client) CordonNode(name string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := c.client.CoreV1().Nodes().Patch(name, types.StrategicMergePatchType, []byte(patch))
+	return forbidden(err, "patch nodes")
+}
+
+// mirrorPodAnnotation is set on the pods the kubelet runs from static
+// manifests, which the API server cannot evict.
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// evictable is whether a pod is evicted when draining its node, as with
+// kubectl drain --ignore-daemonsets: mirror pods, the pods of daemon sets,
+// which would be scheduled again right away, and finished pods are left.
+func evictable(pod *apiv1.Pod) bool {
+	if _, ok := pod.ObjectMeta.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	for _, ref := range pod.ObjectMeta.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return pod.Status.Phase != apiv1.PodSucceeded && pod.Status.Phase != apiv1.PodFailed
+}
+
+// DrainNode cordons a node, and evicts its pods, giving them gracePeriod
+// seconds to terminate, or their own grace periods if nil. Evictions which
+// would violate pod disruption budgets fail, and are reported.
+func (c *client) DrainNode(name string, gracePeriod *int64) error {
+	if err := c.CordonNode(name, true); err != nil {
+		return err
+	}
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return forbidden(err, "list pods")
+	}
+	var errs []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !evictable(pod) {
+			continue
+		}
+		err := c.client.CoreV1().Pods(pod.Namespace).Evict(&apipolicyv1beta1.Eviction{
+			ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriod},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, forbidden(err, "evict pods")))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Error evicting pods of node %s: %s", name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (c *client) Stop() {
 	close(c.quit)
 }
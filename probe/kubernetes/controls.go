@@ -1,8 +1,12 @@
 package kubernetes
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -15,11 +19,67 @@ const (
 	DeletePod = "kubernetes_delete_pod"
 	ScaleUp   = "kubernetes_scale_up"
 	ScaleDown = "kubernetes_scale_down"
+
+	RolloutRestart = "kubernetes_rollout_restart"
+	PauseRollout   = "kubernetes_pause_rollout"
+	ResumeRollout  = "kubernetes_resume_rollout"
+	Rollback       = "kubernetes_rollback"
+
+	CordonNode   = "kubernetes_cordon_node"
+	UncordonNode = "kubernetes_uncordon_node"
+	DrainNode    = "kubernetes_drain_node"
 )
 
+// LogOptions are the options of GetLogs.
+type LogOptions struct {
+	Container  string // empty for the default container
+	Follow     bool
+	TailLines  *int64 // nil for all lines
+	Previous   bool   // for the logs of the previous instance of the container
+	Timestamps bool
+}
+
+// parseLogOptions parses the arguments of a GetLogs request: container,
+// follow, tail_lines, previous and timestamps. Logs are followed, with
+// timestamps, unless asked otherwise.
+func parseLogOptions(args map[string]string) (LogOptions, error) {
+	opts := LogOptions{
+		Container:  args["container"],
+		Follow:     true,
+		Timestamps: true,
+	}
+	for key, value := range map[string]*bool{
+		"follow":     &opts.Follow,
+		"previous":   &opts.Previous,
+		"timestamps": &opts.Timestamps,
+	} {
+		arg, ok := args[key]
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return LogOptions{}, fmt.Errorf("Invalid %s: %q", key, arg)
+		}
+		*value = b
+	}
+	if arg, ok := args["tail_lines"]; ok {
+		lines, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || lines < 0 {
+			return LogOptions{}, fmt.Errorf("Invalid tail_lines: %q", arg)
+		}
+		opts.TailLines = &lines
+	}
+	return opts, nil
+}
+
 // GetLogs is the control to get the logs for a kubernetes pod
 func (r *Reporter) GetLogs(req xfer.Request, namespaceID, podID string) xfer.Response {
-	readCloser, err := r.client.GetLogs(namespaceID, podID)
+	opts, err := parseLogOptions(req.ControlArgs)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	readCloser, err := r.client.GetLogs(namespaceID, podID, opts)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
@@ -52,8 +112,59 @@ func (r *Reporter) deletePod(req xfer.Request, namespaceID, podID string) xfer.R
 	}
 }
 
+// deletePodDryRun tells what deleting a pod does: it is recreated by the
+// controller managing it, if any.
+func (r *Reporter) deletePodDryRun(req xfer.Request, pod Pod) xfer.Response {
+	effects := []string{fmt.Sprintf("Pod %s/%s will be deleted, once its containers exit within their grace period", pod.Namespace(), pod.Name())}
+	kind, name, ok := pod.Controller()
+	switch {
+	case !ok:
+		effects = append(effects, "It is not managed by a controller, and will not be recreated")
+	case kind == "ReplicaSet":
+		if deployment, ok := r.replicaSetDeployment(pod.Namespace(), name); ok {
+			effects = append(effects, fmt.Sprintf("It is managed by ReplicaSet %s of Deployment %s, and will be recreated", name, deployment))
+		} else {
+			effects = append(effects, fmt.Sprintf("It is managed by ReplicaSet %s, and will be recreated", name))
+		}
+	case kind == "ReplicationController" || kind == "StatefulSet" || kind == "DaemonSet" || kind == "Job":
+		effects = append(effects, fmt.Sprintf("It is managed by %s %s, and will be recreated", kind, name))
+	default:
+		effects = append(effects, fmt.Sprintf("It is managed by %s %s, which may recreate it", kind, name))
+	}
+	return controls.DryRunResponse(req, effects...)
+}
+
+// replicaSetDeployment gives the name of the deployment of a replica set,
+// if any: the one selecting the replica set.
+func (r *Reporter) replicaSetDeployment(namespace, name string) (string, bool) {
+	var replicaSet ReplicaSet
+	r.client.WalkReplicaSets(func(rs ReplicaSet) error {
+		if rs.Namespace() == namespace && rs.Name() == name {
+			replicaSet = rs
+		}
+		return nil
+	})
+	if replicaSet == nil {
+		return "", false
+	}
+	var deployment string
+	r.client.WalkDeployments(func(d Deployment) error {
+		if selector, err := d.Selector(); err == nil && d.Namespace() == namespace && selector.Matches(labels.Set(replicaSet.Labels())) {
+			deployment = d.Name()
+		}
+		return nil
+	})
+	return deployment, deployment != ""
+}
+
 // CapturePod is exported for testing
 func (r *Reporter) CapturePod(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return r.capturePod(func(req xfer.Request, pod Pod) xfer.Response {
+		return f(req, pod.Namespace(), pod.Name())
+	})
+}
+
+func (r *Reporter) capturePod(f func(xfer.Request, Pod) xfer.Response) func(xfer.Request) xfer.Response {
 	return func(req xfer.Request) xfer.Response {
 		uid, ok := report.ParsePodNodeID(req.NodeID)
 		if !ok {
@@ -70,7 +181,7 @@ func (r *Reporter) CapturePod(f func(xfer.Request, string, string) xfer.Response
 		if pod == nil {
 			return xfer.ResponseErrorf("Pod not found: %s", uid)
 		}
-		return f(req, pod.Namespace(), pod.Name())
+		return f(req, pod)
 	}
 }
 
@@ -143,12 +254,104 @@ func (r *Reporter) ScaleDown(req xfer.Request, resource, namespace, id string) x
 	return xfer.ResponseError(r.client.ScaleDown(resource, namespace, id))
 }
 
+// CaptureDeployment is exported for testing
+func (r *Reporter) CaptureDeployment(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		uid, ok := report.ParseDeploymentNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		var deployment Deployment
+		r.client.WalkDeployments(func(d Deployment) error {
+			if d.UID() == uid {
+				deployment = d
+			}
+			return nil
+		})
+		if deployment == nil {
+			return xfer.ResponseErrorf("Deployment not found: %s", uid)
+		}
+		return f(req, deployment.Namespace(), deployment.Name())
+	}
+}
+
+// RolloutRestart is the control to restart the pods of a deployment, by
+// rolling it out again
+func (r *Reporter) RolloutRestart(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.RestartDeployment(namespace, id))
+}
+
+// PauseRollout is the control to pause the rollout of a deployment
+func (r *Reporter) PauseRollout(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.PauseDeployment(namespace, id, true))
+}
+
+// ResumeRollout is the control to resume the paused rollout of a deployment
+func (r *Reporter) ResumeRollout(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.PauseDeployment(namespace, id, false))
+}
+
+// Rollback is the control to roll a deployment back to its previous
+// revision
+func (r *Reporter) Rollback(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.RollbackDeployment(namespace, id))
+}
+
+// CaptureNode is exported for testing
+func (r *Reporter) CaptureNode(f func(xfer.Request, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		hostID, ok := report.ParseHostNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		if hostID != r.hostID || r.nodeName == "" {
+			return xfer.ResponseErrorf("Kubernetes node not found: %s", hostID)
+		}
+		return f(req, r.nodeName)
+	}
+}
+
+// Cordon is the control to mark a kubernetes node unschedulable
+func (r *Reporter) Cordon(req xfer.Request, nodeName string) xfer.Response {
+	return xfer.ResponseError(r.client.CordonNode(nodeName, true))
+}
+
+// Uncordon is the control to mark a kubernetes node schedulable again
+func (r *Reporter) Uncordon(req xfer.Request, nodeName string) xfer.Response {
+	return xfer.ResponseError(r.client.CordonNode(nodeName, false))
+}
+
+// Drain is the control to cordon a kubernetes node and evict its pods, with
+// the grace period in seconds of its grace_period argument, if any
+func (r *Reporter) Drain(req xfer.Request, nodeName string) xfer.Response {
+	var gracePeriod *int64
+	if arg, ok := req.ControlArgs["grace_period"]; ok {
+		seconds, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || seconds < 0 {
+			return xfer.ResponseErrorf("Invalid grace_period: %q", arg)
+		}
+		gracePeriod = &seconds
+	}
+	return xfer.ResponseError(r.client.DrainNode(nodeName, gracePeriod))
+}
+
 func (r *Reporter) registerControls() {
 	controls := map[string]xfer.ControlHandlerFunc{
 		GetLogs:   r.CapturePod(r.GetLogs),
 		DeletePod: r.CapturePod(r.deletePod),
-		ScaleUp:   r.CaptureResource(r.ScaleUp),
-		ScaleDown: r.CaptureResource(r.ScaleDown),
+
+		xfer.DryRunControl(DeletePod): r.capturePod(r.deletePodDryRun),
+		ScaleUp:                       r.CaptureResource(r.ScaleUp),
+		ScaleDown:                     r.CaptureResource(r.ScaleDown),
+
+		RolloutRestart: r.CaptureDeployment(r.RolloutRestart),
+		PauseRollout:   r.CaptureDeployment(r.PauseRollout),
+		ResumeRollout:  r.CaptureDeployment(r.ResumeRollout),
+		Rollback:       r.CaptureDeployment(r.Rollback),
+
+		CordonNode:   r.CaptureNode(r.Cordon),
+		UncordonNode: r.CaptureNode(r.Uncordon),
+		DrainNode:    r.CaptureNode(r.Drain),
 	}
 	r.handlerRegistry.Batch(nil, controls)
 }
@@ -157,8 +360,16 @@ func (r *Reporter) deregisterControls() {
 	controls := []string{
 		GetLogs,
 		DeletePod,
+		xfer.DryRunControl(DeletePod),
 		ScaleUp,
 		ScaleDown,
+		RolloutRestart,
+		PauseRollout,
+		ResumeRollout,
+		Rollback,
+		CordonNode,
+		UncordonNode,
+		DrainNode,
 	}
 	r.handlerRegistry.Batch(controls, nil)
 }
@@ -0,0 +1,100 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	APIVersion = "kubernetes_api_version"
+)
+
+// CustomResourceType identifies a kind of custom resource to report on.
+type CustomResourceType struct {
+	Group    string
+	Version  string
+	Kind     string
+	Resource string // plural, lower case name used in the API path
+}
+
+// String gives the CustomResourceType in the format accepted by
+// ParseCustomResourceTypes.
+func (t CustomResourceType) String() string {
+	return fmt.Sprintf("%s/%s:%s", t.Group, t.Version, t.Kind)
+}
+
+// ParseCustomResourceTypes parses a comma-separated list of custom resource
+// types of the form group/version:Kind, optionally followed by :resource when
+// the plural resource name isn't simply the lower-cased kind plus "s", e.g.
+// "foo.example.com/v1:Widget,bar.example.com/v1alpha1:Proxy:proxies".
+func ParseCustomResourceTypes(s string) ([]CustomResourceType, error) {
+	result := []CustomResourceType{}
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid custom resource %q: expected group/version:Kind", spec)
+		}
+		groupVersion := strings.Split(parts[0], "/")
+		if len(groupVersion) != 2 || groupVersion[0] == "" || groupVersion[1] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid custom resource %q: expected group/version:Kind", spec)
+		}
+		t := CustomResourceType{
+			Group:    groupVersion[0],
+			Version:  groupVersion[1],
+			Kind:     parts[1],
+			Resource: strings.ToLower(parts[1]) + "s",
+		}
+		if len(parts) == 3 && parts[2] != "" {
+			t.Resource = parts[2]
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// CustomResource represents an instance of a Kubernetes custom resource
+type CustomResource interface {
+	Meta
+	Kind() string
+	GetNode() report.Node
+}
+
+type customResource struct {
+	*unstructured.Unstructured
+	Meta
+}
+
+// NewCustomResource creates a new custom resource
+func NewCustomResource(u *unstructured.Unstructured) CustomResource {
+	return &customResource{
+		Unstructured: u,
+		Meta: meta{metav1.ObjectMeta{
+			UID:               u.GetUID(),
+			Name:              u.GetName(),
+			Namespace:         u.GetNamespace(),
+			CreationTimestamp: u.GetCreationTimestamp(),
+			Labels:            u.GetLabels(),
+		}},
+	}
+}
+
+func (c *customResource) Kind() string {
+	return c.GetKind()
+}
+
+func (c *customResource) GetNode() report.Node {
+	return c.MetaNode(report.MakeCustomResourceNodeID(c.UID())).WithLatests(map[string]string{
+		NodeType:   c.Kind(),
+		APIVersion: c.GetAPIVersion(),
+	})
+}
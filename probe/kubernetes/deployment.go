@@ -17,6 +17,7 @@ const (
 	AvailableReplicas   = "kubernetes_available_replicas"
 	UnavailableReplicas = "kubernetes_unavailable_replicas"
 	Strategy            = "kubernetes_strategy"
+	Paused              = "kubernetes_paused"
 )
 
 // Deployment represents a Kubernetes deployment
@@ -51,6 +52,10 @@ func (d *deployment) GetNode(probeID string) report.Node {
 	if d.Spec.Replicas != nil {
 		desiredReplicas = int(*d.Spec.Replicas)
 	}
+	rolloutControl := PauseRollout
+	if d.Spec.Paused {
+		rolloutControl = ResumeRollout
+	}
 	return d.MetaNode(report.MakeDeploymentNodeID(d.UID())).WithLatests(map[string]string{
 		ObservedGeneration:    fmt.Sprint(d.Status.ObservedGeneration),
 		DesiredReplicas:       fmt.Sprint(desiredReplicas),
@@ -59,7 +64,8 @@ func (d *deployment) GetNode(probeID string) report.Node {
 		AvailableReplicas:     fmt.Sprint(d.Status.AvailableReplicas),
 		UnavailableReplicas:   fmt.Sprint(d.Status.UnavailableReplicas),
 		Strategy:              string(d.Spec.Strategy.Type),
+		Paused:                fmt.Sprint(d.Spec.Paused),
 		report.ControlProbeID: probeID,
 		NodeType:              "Deployment",
-	}).WithLatestActiveControls(ScaleUp, ScaleDown)
+	}).WithLatestActiveControls(ScaleUp, ScaleDown, RolloutRestart, rolloutControl, Rollback)
 }
@@ -0,0 +1,153 @@
+package kubernetes
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata, of the table of the
+// recent events of objects, by column.
+const (
+	EventsTablePrefix = "kubernetes_events_"
+	EventLastSeen     = "kubernetes_event_last_seen"
+	EventType         = "kubernetes_event_type"
+	EventReason       = "kubernetes_event_reason"
+	EventMessage      = "kubernetes_event_message"
+	EventCount        = "kubernetes_event_count"
+)
+
+// EventWindow is how recent events of objects are to be shown on their
+// nodes.
+const EventWindow = time.Hour
+
+// EventsTableTemplate is the table of the recent events of objects.
+var EventsTableTemplate = report.TableTemplate{
+	ID:     EventsTablePrefix,
+	Label:  "Recent Events",
+	Type:   report.MulticolumnTableType,
+	Prefix: EventsTablePrefix,
+	Columns: []report.Column{
+		{ID: EventLastSeen, Label: "Last Seen", DataType: "datetime"},
+		{ID: EventType, Label: "Type"},
+		{ID: EventReason, Label: "Reason"},
+		{ID: EventMessage, Label: "Message"},
+		{ID: EventCount, Label: "Count", DataType: "number"},
+	},
+}
+
+// ClusterEvent represents a Kubernetes event, of something happening to an
+// object, like a pod being OOM killed or failing to be scheduled
+type ClusterEvent interface {
+	Meta
+	ObjectKind() string
+	ObjectUID() string
+	LastSeen() time.Time
+	Row() report.Row
+}
+
+type clusterEvent struct {
+	*apiv1.Event
+	Meta
+}
+
+// NewClusterEvent creates a new ClusterEvent
+func NewClusterEvent(e *apiv1.Event) ClusterEvent {
+	return &clusterEvent{Event: e, Meta: meta{e.ObjectMeta}}
+}
+
+func (e *clusterEvent) ObjectKind() string {
+	return e.InvolvedObject.Kind
+}
+
+func (e *clusterEvent) ObjectUID() string {
+	return string(e.InvolvedObject.UID)
+}
+
+// LastSeen is when the event last happened. Events recorded once may have
+// no last timestamp, only when they were created.
+func (e *clusterEvent) LastSeen() time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	return e.ObjectMeta.CreationTimestamp.Time
+}
+
+// Row gives the event as a row of the table of the events of its object.
+// Rows are by event name, which Kubernetes suffixes with when the event
+// first happened.
+func (e *clusterEvent) Row() report.Row {
+	count := e.Event.Count
+	if count < 1 {
+		count = 1
+	}
+	return report.Row{
+		ID: e.Name(),
+		Entries: map[string]string{
+			EventLastSeen: e.LastSeen().UTC().Format(time.RFC3339),
+			EventType:     e.Type,
+			EventReason:   e.Reason,
+			EventMessage:  e.Message,
+			EventCount:    strconv.Itoa(int(count)),
+		},
+	}
+}
+
+// eventNodeIDs gives the IDs of the nodes of objects events are attached
+// to, by the kinds of the objects.
+var eventNodeIDs = map[string]func(uid string) string{
+	"Pod":         report.MakePodNodeID,
+	"Deployment":  report.MakeDeploymentNodeID,
+	"ReplicaSet":  report.MakeReplicaSetNodeID,
+	"DaemonSet":   report.MakeDaemonSetNodeID,
+	"StatefulSet": report.MakeStatefulSetNodeID,
+}
+
+// recentEvents gives the rows of the events of the last EventWindow, newest
+// first, by the IDs of the nodes of their objects.
+func (r *Reporter) recentEvents() (map[string][]report.Row, error) {
+	type event struct {
+		row      report.Row
+		lastSeen time.Time
+	}
+	since := mtime.Now().Add(-EventWindow)
+	events := map[string][]event{}
+	err := r.client.WalkEvents(func(e ClusterEvent) error {
+		makeID, ok := eventNodeIDs[e.ObjectKind()]
+		if !ok || e.ObjectUID() == "" || e.LastSeen().Before(since) {
+			return nil
+		}
+		id := makeID(e.ObjectUID())
+		events[id] = append(events[id], event{row: e.Row(), lastSeen: e.LastSeen()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]report.Row, len(events))
+	for id, es := range events {
+		sort.Slice(es, func(i, j int) bool { return es[i].lastSeen.After(es[j].lastSeen) })
+		rows := make([]report.Row, len(es))
+		for i, e := range es {
+			rows[i] = e.row
+		}
+		result[id] = rows
+	}
+	return result, nil
+}
+
+// withEvents adds the tables of the recent events of objects to their
+// nodes.
+func withEvents(t report.Topology, events map[string][]report.Row) report.Topology {
+	for id, rows := range events {
+		if n, ok := t.Nodes[id]; ok {
+			t.Nodes[id] = n.AddPrefixMulticolumnTable(EventsTablePrefix, rows)
+		}
+	}
+	return t
+}
@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	PolicyPodSelector = "kubernetes_policy_pod_selector"
+	PolicyIngress     = "kubernetes_policy_ingress"
+)
+
+// NetworkPolicyPeer is a source of traffic allowed by a NetworkPolicy
+// ingress rule, in a form which can be carried in a report.
+type NetworkPolicyPeer struct {
+	// PodSelector selects the allowed pods, in the format understood by
+	// labels.Parse.
+	PodSelector string `json:"podSelector,omitempty"`
+	// AnyNamespace is set for peers with a namespace selector. Reports
+	// don't carry namespace labels, so these are assumed to match pods
+	// in any namespace. Otherwise only pods from the namespace of the
+	// policy are allowed.
+	AnyNamespace bool `json:"anyNamespace,omitempty"`
+}
+
+// NetworkPolicyIngressRule is an ingress rule of a NetworkPolicy. Rules
+// without peers allow traffic from everywhere. Ports are not reported.
+type NetworkPolicyIngressRule struct {
+	From []NetworkPolicyPeer `json:"from,omitempty"`
+}
+
+// ParseNetworkPolicyIngress parses the ingress rules stored in the
+// PolicyIngress metadata of a network policy node.
+func ParseNetworkPolicyIngress(s string) ([]NetworkPolicyIngressRule, error) {
+	var rules []NetworkPolicyIngressRule
+	err := json.Unmarshal([]byte(s), &rules)
+	return rules, err
+}
+
+// NetworkPolicy represents a Kubernetes network policy
+type NetworkPolicy interface {
+	Meta
+	GetNode() (report.Node, error)
+}
+
+type networkPolicy struct {
+	*v1beta1.NetworkPolicy
+	Meta
+}
+
+// NewNetworkPolicy creates a new network policy
+func NewNetworkPolicy(p *v1beta1.NetworkPolicy) NetworkPolicy {
+	return &networkPolicy{
+		NetworkPolicy: p,
+		Meta:          meta{p.ObjectMeta},
+	}
+}
+
+func selectorString(s *metav1.LabelSelector) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(s)
+	if err != nil {
+		return "", err
+	}
+	return selector.String(), nil
+}
+
+func (p *networkPolicy) ingressRules() ([]NetworkPolicyIngressRule, error) {
+	rules := []NetworkPolicyIngressRule{}
+	for _, ingress := range p.Spec.Ingress {
+		rule := NetworkPolicyIngressRule{}
+		for _, from := range ingress.From {
+			var (
+				peer = NetworkPolicyPeer{PodSelector: labels.Everything().String()}
+				err  error
+			)
+			if from.PodSelector != nil {
+				if peer.PodSelector, err = selectorString(from.PodSelector); err != nil {
+					return nil, err
+				}
+			} else if from.NamespaceSelector != nil {
+				peer.AnyNamespace = true
+			}
+			rule.From = append(rule.From, peer)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (p *networkPolicy) GetNode() (report.Node, error) {
+	podSelector, err := selectorString(&p.Spec.PodSelector)
+	if err != nil {
+		return report.Node{}, err
+	}
+	rules, err := p.ingressRules()
+	if err != nil {
+		return report.Node{}, err
+	}
+	ingress, err := json.Marshal(rules)
+	if err != nil {
+		return report.Node{}, err
+	}
+	return p.MetaNode(report.MakeNetworkPolicyNodeID(p.UID())).WithLatests(map[string]string{
+		PolicyPodSelector: podSelector,
+		PolicyIngress:     string(ingress),
+	}), nil
+}
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/weaveworks/scope/report"
 
@@ -13,6 +14,9 @@ const (
 	State           = "kubernetes_state"
 	IsInHostNetwork = "kubernetes_is_in_host_network"
 	RestartCount    = "kubernetes_restart_count"
+	LastExitCode    = "kubernetes_last_exit_code"
+	LastTermination = "kubernetes_last_termination_reason"
+	LastTerminated  = "kubernetes_last_terminated"
 
 	StateDeleted = "deleted"
 )
@@ -21,6 +25,8 @@ const (
 type Pod interface {
 	Meta
 	AddParent(topology, id string)
+	OwnerUIDs() []string
+	Controller() (kind, name string, ok bool)
 	NodeName() string
 	GetNode(probeID string) report.Node
 	RestartCount() uint
@@ -54,6 +60,26 @@ func (p *pod) AddParent(topology, id string) {
 	p.parents = p.parents.Add(topology, report.MakeStringSet(id))
 }
 
+// OwnerUIDs returns the UIDs of the objects this pod is owned by.
+func (p *pod) OwnerUIDs() []string {
+	uids := make([]string, 0, len(p.ObjectMeta.OwnerReferences))
+	for _, ref := range p.ObjectMeta.OwnerReferences {
+		uids = append(uids, string(ref.UID))
+	}
+	return uids
+}
+
+// Controller returns the kind and name of the object managing this pod, if
+// any.
+func (p *pod) Controller() (string, string, bool) {
+	for _, ref := range p.ObjectMeta.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.Kind, ref.Name, true
+		}
+	}
+	return "", "", false
+}
+
 func (p *pod) State() string {
 	return string(p.Status.Phase)
 }
@@ -70,6 +96,20 @@ func (p *pod) RestartCount() uint {
 	return count
 }
 
+// lastTermination gives how the container of the pod which finished most
+// recently terminated, whether it is running again or not.
+func (p *pod) lastTermination() *apiv1.ContainerStateTerminated {
+	var last *apiv1.ContainerStateTerminated
+	for _, cs := range p.Status.ContainerStatuses {
+		for _, terminated := range []*apiv1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+			if terminated != nil && (last == nil || terminated.FinishedAt.After(last.FinishedAt.Time)) {
+				last = terminated
+			}
+		}
+	}
+	return last
+}
+
 func (p *pod) GetNode(probeID string) report.Node {
 	latests := map[string]string{
 		State: p.State(),
@@ -82,6 +122,12 @@ func (p *pod) GetNode(probeID string) report.Node {
 		latests[IsInHostNetwork] = "true"
 	}
 
+	if last := p.lastTermination(); last != nil {
+		latests[LastExitCode] = strconv.Itoa(int(last.ExitCode))
+		latests[LastTermination] = last.Reason
+		latests[LastTerminated] = last.FinishedAt.UTC().Format(time.RFC3339)
+	}
+
 	return p.MetaNode(report.MakePodNodeID(p.UID())).WithLatests(latests).
 		WithParents(p.parents).
 		WithLatestActiveControls(GetLogs, DeletePod)
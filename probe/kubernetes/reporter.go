@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/weaveworks/common/mtime"
@@ -23,6 +24,7 @@ const (
 	Replicas           = "kubernetes_replicas"
 	DesiredReplicas    = "kubernetes_desired_replicas"
 	NodeType           = "kubernetes_node_type"
+	Unschedulable      = "kubernetes_node_unschedulable"
 )
 
 // Exposed for testing
@@ -34,10 +36,17 @@ var (
 		Namespace:        {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 5},
 		Created:          {ID: Created, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 6},
 		RestartCount:     {ID: RestartCount, Label: "Restart #", From: report.FromLatest, Priority: 7},
+		LastExitCode:     {ID: LastExitCode, Label: "Last Exit Code", From: report.FromLatest, Datatype: "number", Priority: 8},
+		LastTermination:  {ID: LastTermination, Label: "Last Termination", From: report.FromLatest, Priority: 9},
+		LastTerminated:   {ID: LastTerminated, Label: "Last Terminated", From: report.FromLatest, Datatype: "datetime", Priority: 10},
 	}
 
 	PodMetricTemplates = docker.ContainerMetricTemplates
 
+	HostMetadataTemplates = report.MetadataTemplates{
+		Unschedulable: {ID: Unschedulable, Label: "Unschedulable", From: report.FromLatest, Priority: 15},
+	}
+
 	ServiceMetadataTemplates = report.MetadataTemplates{
 		Namespace:  {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
 		Created:    {ID: Created, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 3},
@@ -56,6 +65,7 @@ var (
 		DesiredReplicas:    {ID: DesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Datatype: "number", Priority: 5},
 		report.Pod:         {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 6},
 		Strategy:           {ID: Strategy, Label: "Strategy", From: report.FromLatest, Priority: 7},
+		Paused:             {ID: Paused, Label: "Paused", From: report.FromLatest, Priority: 8},
 	}
 
 	DeploymentMetricTemplates = ReplicaSetMetricTemplates
@@ -104,6 +114,16 @@ var (
 
 	CronJobMetricTemplates = PodMetricTemplates
 
+	CustomResourceMetadataTemplates = report.MetadataTemplates{
+		NodeType:   {ID: NodeType, Label: "Type", From: report.FromLatest, Priority: 1},
+		Namespace:  {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:    {ID: Created, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 3},
+		APIVersion: {ID: APIVersion, Label: "API Version", From: report.FromLatest, Priority: 4},
+		report.Pod: {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 5},
+	}
+
+	CustomResourceMetricTemplates = PodMetricTemplates
+
 	TableTemplates = report.TableTemplates{
 		LabelPrefix: {
 			ID:     LabelPrefix,
@@ -111,6 +131,7 @@ var (
 			Type:   report.PropertyListType,
 			Prefix: LabelPrefix,
 		},
+		EventsTablePrefix: EventsTableTemplate,
 	}
 
 	ScalingControls = []report.Control{
@@ -127,6 +148,54 @@ var (
 			Rank:  1,
 		},
 	}
+
+	NodeControls = []report.Control{
+		{
+			ID:    CordonNode,
+			Human: "Cordon",
+			Icon:  "fa-ban",
+			Rank:  1,
+		},
+		{
+			ID:    UncordonNode,
+			Human: "Uncordon",
+			Icon:  "fa-check-circle",
+			Rank:  1,
+		},
+		{
+			ID:    DrainNode,
+			Human: "Drain",
+			Icon:  "fa-sign-out",
+			Rank:  2,
+		},
+	}
+
+	RolloutControls = []report.Control{
+		{
+			ID:    RolloutRestart,
+			Human: "Rollout Restart",
+			Icon:  "fa-repeat",
+			Rank:  2,
+		},
+		{
+			ID:    PauseRollout,
+			Human: "Pause Rollout",
+			Icon:  "fa-pause",
+			Rank:  3,
+		},
+		{
+			ID:    ResumeRollout,
+			Human: "Resume Rollout",
+			Icon:  "fa-play",
+			Rank:  3,
+		},
+		{
+			ID:    Rollback,
+			Human: "Roll Back",
+			Icon:  "fa-undo",
+			Rank:  4,
+		},
+	}
 )
 
 // Reporter generate Reports containing Container and ContainerImage topologies
@@ -256,6 +325,10 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
+	customResourceTopology, customResources, err := r.customResourceTopology()
+	if err != nil {
+		return result, err
+	}
 	deploymentTopology, deployments, err := r.deploymentTopology(r.probeID)
 	if err != nil {
 		return result, err
@@ -264,16 +337,31 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
-	podTopology, err := r.podTopology(services, replicaSets, daemonSets, statefulSets, cronJobs)
+	networkPolicyTopology, err := r.networkPolicyTopology()
 	if err != nil {
 		return result, err
 	}
+	podTopology, err := r.podTopology(services, replicaSets, daemonSets, statefulSets, cronJobs, customResources)
+	if err != nil {
+		return result, err
+	}
+	events, err := r.recentEvents()
+	if err != nil {
+		return result, err
+	}
+	podTopology = withEvents(podTopology, events)
+	deploymentTopology = withEvents(deploymentTopology, events)
+	replicaSetTopology = withEvents(replicaSetTopology, events)
+	daemonSetTopology = withEvents(daemonSetTopology, events)
+	statefulSetTopology = withEvents(statefulSetTopology, events)
 	result.Pod = result.Pod.Merge(podTopology)
 	result.Service = result.Service.Merge(serviceTopology)
 	result.Host = result.Host.Merge(hostTopology)
 	result.DaemonSet = result.DaemonSet.Merge(daemonSetTopology)
 	result.StatefulSet = result.StatefulSet.Merge(statefulSetTopology)
 	result.CronJob = result.CronJob.Merge(cronJobTopology)
+	result.CustomResource = result.CustomResource.Merge(customResourceTopology)
+	result.NetworkPolicy = result.NetworkPolicy.Merge(networkPolicyTopology)
 	result.Deployment = result.Deployment.Merge(deploymentTopology)
 	result.ReplicaSet = result.ReplicaSet.Merge(replicaSetTopology)
 	return result, nil
@@ -308,19 +396,60 @@ func (r *Reporter) serviceTopology() (report.Topology, []Service, error) {
 // persistent connections for which we don't have a robust solution
 // (see https://github.com/weaveworks/scope/issues/1491).
 func (r *Reporter) hostTopology(services []Service) report.Topology {
-	serviceIPs := make([]net.IP, 0, len(services))
+	result := report.MakeTopology()
+	node := report.MakeNode(report.MakeHostNodeID(r.hostID))
+	var serviceIPv4s, serviceIPv6s []net.IP
 	for _, service := range services {
-		if ip := net.ParseIP(service.ClusterIP()).To4(); ip != nil {
-			serviceIPs = append(serviceIPs, ip)
+		ip := net.ParseIP(service.ClusterIP())
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			serviceIPv4s = append(serviceIPv4s, ip4)
+		} else {
+			serviceIPv6s = append(serviceIPv6s, ip)
 		}
 	}
-	serviceNetwork := report.ContainingIPv4Network(serviceIPs)
-	if serviceNetwork == nil {
-		return report.MakeTopology()
+	serviceNetworks := []string{}
+	for _, serviceNetwork := range []*net.IPNet{
+		report.ContainingIPv4Network(serviceIPv4s),
+		report.ContainingIPv6Network(serviceIPv6s),
+	} {
+		if serviceNetwork != nil {
+			serviceNetworks = append(serviceNetworks, serviceNetwork.String())
+		}
 	}
-	return report.MakeTopology().AddNode(
-		report.MakeNode(report.MakeHostNodeID(r.hostID)).
-			WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet(serviceNetwork.String()))))
+	hasNode := false
+	if len(serviceNetworks) > 0 {
+		node = node.WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet(serviceNetworks...)))
+		hasNode = true
+	}
+
+	// Hosts which are kubernetes nodes can be cordoned, uncordoned and
+	// drained.
+	if r.nodeName != "" {
+		r.client.WalkNodes(func(n *apiv1.Node) error {
+			if n.Name != r.nodeName {
+				return nil
+			}
+			cordonControl := CordonNode
+			if n.Spec.Unschedulable {
+				cordonControl = UncordonNode
+			}
+			result = result.WithMetadataTemplates(HostMetadataTemplates)
+			node = node.WithLatests(map[string]string{
+				report.ControlProbeID: r.probeID,
+				Unschedulable:         fmt.Sprint(n.Spec.Unschedulable),
+			}).WithLatestActiveControls(cordonControl, DrainNode)
+			result.Controls.AddControls(NodeControls)
+			hasNode = true
+			return nil
+		})
+	}
+	if !hasNode {
+		return result
+	}
+	return result.AddNode(node)
 }
 
 func (r *Reporter) deploymentTopology(probeID string) (report.Topology, []Deployment, error) {
@@ -332,6 +461,7 @@ func (r *Reporter) deploymentTopology(probeID string) (report.Topology, []Deploy
 		deployments = []Deployment{}
 	)
 	result.Controls.AddControls(ScalingControls)
+	result.Controls.AddControls(RolloutControls)
 
 	err := r.client.WalkDeployments(func(d Deployment) error {
 		result = result.AddNode(d.GetNode(probeID))
@@ -383,6 +513,33 @@ func (r *Reporter) cronJobTopology() (report.Topology, []CronJob, error) {
 	return result, cronJobs, err
 }
 
+func (r *Reporter) customResourceTopology() (report.Topology, []CustomResource, error) {
+	customResources := []CustomResource{}
+	result := report.MakeTopology().
+		WithMetadataTemplates(CustomResourceMetadataTemplates).
+		WithMetricTemplates(CustomResourceMetricTemplates).
+		WithTableTemplates(TableTemplates)
+	err := r.client.WalkCustomResources(func(c CustomResource) error {
+		result = result.AddNode(c.GetNode())
+		customResources = append(customResources, c)
+		return nil
+	})
+	return result, customResources, err
+}
+
+func (r *Reporter) networkPolicyTopology() (report.Topology, error) {
+	result := report.MakeTopology()
+	err := r.client.WalkNetworkPolicies(func(p NetworkPolicy) error {
+		node, err := p.GetNode()
+		if err != nil {
+			return err
+		}
+		result = result.AddNode(node)
+		return nil
+	})
+	return result, err
+}
+
 func (r *Reporter) replicaSetTopology(probeID string, deployments []Deployment) (report.Topology, []ReplicaSet, error) {
 	var (
 		result = report.MakeTopology().
@@ -446,7 +603,7 @@ func match(namespace string, selector labels.Selector, topology, id string) func
 	}
 }
 
-func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, daemonSets []DaemonSet, statefulSets []StatefulSet, cronJobs []CronJob) (report.Topology, error) {
+func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, daemonSets []DaemonSet, statefulSets []StatefulSet, cronJobs []CronJob, customResources []CustomResource) (report.Topology, error) {
 	var (
 		pods = report.MakeTopology().
 			WithMetadataTemplates(PodMetadataTemplates).
@@ -461,10 +618,11 @@ func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, dae
 		Rank:  0,
 	})
 	pods.Controls.AddControl(report.Control{
-		ID:    DeletePod,
-		Human: "Delete",
-		Icon:  "fa-trash-o",
-		Rank:  1,
+		ID:     DeletePod,
+		Human:  "Delete",
+		Icon:   "fa-trash-o",
+		Rank:   1,
+		DryRun: true,
 	})
 	for _, service := range services {
 		selectors = append(selectors, match(
@@ -525,6 +683,13 @@ func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, dae
 		}
 	}
 
+	// Custom resources have no selectors we know how to interpret, so
+	// we rely on the pods' owner references instead.
+	customResourceIDs := map[string]string{}
+	for _, customResource := range customResources {
+		customResourceIDs[customResource.UID()] = report.MakeCustomResourceNodeID(customResource.UID())
+	}
+
 	var localPodUIDs map[string]struct{}
 	if r.nodeName == "" {
 		// We don't know the node name: fall back to obtaining the local pods from kubelet
@@ -548,6 +713,11 @@ func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, dae
 		for _, selector := range selectors {
 			selector(p)
 		}
+		for _, uid := range p.OwnerUIDs() {
+			if id, ok := customResourceIDs[uid]; ok {
+				p.AddParent(report.CustomResource, id)
+			}
+		}
 		pods = pods.AddNode(p.GetNode(r.probeID))
 		return nil
 	})
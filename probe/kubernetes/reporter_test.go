@@ -6,10 +6,13 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
+	apiextensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -24,6 +27,7 @@ var (
 	pod1UID     = "a1b2c3d4e5"
 	pod2UID     = "f6g7h8i9j0"
 	serviceUID  = "service1234"
+	widgetUID   = "widget1234"
 	podTypeMeta = metav1.TypeMeta{
 		Kind:       "Pod",
 		APIVersion: "v1",
@@ -36,6 +40,9 @@ var (
 			Namespace:         "ping",
 			CreationTimestamp: metav1.Now(),
 			Labels:            map[string]string{"ponger": "true"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Widget", Name: "pong-widget", UID: types.UID(widgetUID)},
+			},
 		},
 		Status: apiv1.PodStatus{
 			HostIP: "1.2.3.4",
@@ -61,8 +68,12 @@ var (
 		Status: apiv1.PodStatus{
 			HostIP: "1.2.3.4",
 			ContainerStatuses: []apiv1.ContainerStatus{
-				{ContainerID: "container3"},
-				{ContainerID: "container4"},
+				{ContainerID: "container3", LastTerminationState: apiv1.ContainerState{
+					Terminated: &apiv1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", FinishedAt: metav1.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+				}},
+				{ContainerID: "container4", LastTerminationState: apiv1.ContainerState{
+					Terminated: &apiv1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", FinishedAt: metav1.Date(2017, 1, 1, 0, 5, 0, 0, time.UTC)},
+				}},
 			},
 		},
 		Spec: apiv1.PodSpec{
@@ -97,23 +108,41 @@ var (
 			},
 		},
 	}
-	pod1     = kubernetes.NewPod(&apiPod1)
-	pod2     = kubernetes.NewPod(&apiPod2)
-	service1 = kubernetes.NewService(&apiService1)
+	widget1 = &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "foo.example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":      "pong-widget",
+			"namespace": "ping",
+			"uid":       widgetUID,
+		},
+	}}
+	pod1           = kubernetes.NewPod(&apiPod1)
+	pod2           = kubernetes.NewPod(&apiPod2)
+	service1       = kubernetes.NewService(&apiService1)
+	customResource = kubernetes.NewCustomResource(widget1)
 )
 
 func newMockClient() *mockClient {
 	return &mockClient{
-		pods:     []kubernetes.Pod{pod1, pod2},
-		services: []kubernetes.Service{service1},
-		logs:     map[string]io.ReadCloser{},
+		pods:            []kubernetes.Pod{pod1, pod2},
+		services:        []kubernetes.Service{service1},
+		customResources: []kubernetes.CustomResource{customResource},
+		logs:            map[string]io.ReadCloser{},
 	}
 }
 
 type mockClient struct {
-	pods     []kubernetes.Pod
-	services []kubernetes.Service
-	logs     map[string]io.ReadCloser
+	pods            []kubernetes.Pod
+	services        []kubernetes.Service
+	customResources []kubernetes.CustomResource
+	logs            map[string]io.ReadCloser
+	logOptions      kubernetes.LogOptions
+	deployments     []kubernetes.Deployment
+	rollouts        []string
+	nodes           []*apiv1.Node
+	nodeActions     []string
+	events          []kubernetes.ClusterEvent
 }
 
 func (c *mockClient) Stop() {}
@@ -143,6 +172,11 @@ func (c *mockClient) WalkCronJobs(f func(kubernetes.CronJob) error) error {
 	return nil
 }
 func (c *mockClient) WalkDeployments(f func(kubernetes.Deployment) error) error {
+	for _, deployment := range c.deployments {
+		if err := f(deployment); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (c *mockClient) WalkReplicaSets(f func(kubernetes.ReplicaSet) error) error {
@@ -151,11 +185,36 @@ func (c *mockClient) WalkReplicaSets(f func(kubernetes.ReplicaSet) error) error
 func (c *mockClient) WalkReplicationControllers(f func(kubernetes.ReplicationController) error) error {
 	return nil
 }
-func (*mockClient) WalkNodes(f func(*apiv1.Node) error) error {
+func (c *mockClient) WalkCustomResources(f func(kubernetes.CustomResource) error) error {
+	for _, customResource := range c.customResources {
+		if err := f(customResource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkNetworkPolicies(f func(kubernetes.NetworkPolicy) error) error {
+	return nil
+}
+func (c *mockClient) WalkNodes(f func(*apiv1.Node) error) error {
+	for _, node := range c.nodes {
+		if err := f(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkEvents(f func(kubernetes.ClusterEvent) error) error {
+	for _, event := range c.events {
+		if err := f(event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (*mockClient) WatchPods(func(kubernetes.Event, kubernetes.Pod)) {}
-func (c *mockClient) GetLogs(namespaceID, podName string) (io.ReadCloser, error) {
+func (c *mockClient) GetLogs(namespaceID, podName string, opts kubernetes.LogOptions) (io.ReadCloser, error) {
+	c.logOptions = opts
 	r, ok := c.logs[namespaceID+";"+podName]
 	if !ok {
 		return nil, fmt.Errorf("Not found")
@@ -171,6 +230,30 @@ func (c *mockClient) ScaleUp(resource, namespaceID, id string) error {
 func (c *mockClient) ScaleDown(resource, namespaceID, id string) error {
 	return nil
 }
+func (c *mockClient) RestartDeployment(namespaceID, id string) error {
+	c.rollouts = append(c.rollouts, "restart "+namespaceID+"/"+id)
+	return nil
+}
+func (c *mockClient) PauseDeployment(namespaceID, id string, paused bool) error {
+	c.rollouts = append(c.rollouts, fmt.Sprintf("paused=%t %s/%s", paused, namespaceID, id))
+	return nil
+}
+func (c *mockClient) CordonNode(name string, unschedulable bool) error {
+	c.nodeActions = append(c.nodeActions, fmt.Sprintf("unschedulable=%t %s", unschedulable, name))
+	return nil
+}
+func (c *mockClient) DrainNode(name string, gracePeriod *int64) error {
+	action := "drain " + name
+	if gracePeriod != nil {
+		action += fmt.Sprintf(" %ds", *gracePeriod)
+	}
+	c.nodeActions = append(c.nodeActions, action)
+	return nil
+}
+func (c *mockClient) RollbackDeployment(namespaceID, id string) error {
+	c.rollouts = append(c.rollouts, "rollback "+namespaceID+"/"+id)
+	return nil
+}
 
 type mockPipeClient map[string]xfer.Pipe
 
@@ -214,9 +297,12 @@ func TestReporter(t *testing.T) {
 			kubernetes.Created:   pod1.Created(),
 		}},
 		{pod2ID, serviceID, map[string]string{
-			kubernetes.Name:      "pong-b",
-			kubernetes.Namespace: "ping",
-			kubernetes.Created:   pod2.Created(),
+			kubernetes.Name:            "pong-b",
+			kubernetes.Namespace:       "ping",
+			kubernetes.Created:         pod2.Created(),
+			kubernetes.LastExitCode:    "137",
+			kubernetes.LastTermination: "OOMKilled",
+			kubernetes.LastTerminated:  "2017-01-01T00:05:00Z",
 		}},
 	} {
 		node, ok := rpt.Pod.Nodes[pod.id]
@@ -252,6 +338,137 @@ func TestReporter(t *testing.T) {
 			}
 		}
 	}
+
+	// Reporter should have added the custom resource, as the parent of the
+	// pod it owns
+	{
+		widgetID := report.MakeCustomResourceNodeID(widgetUID)
+		node, ok := rpt.CustomResource.Nodes[widgetID]
+		if !ok {
+			t.Errorf("Expected report to have custom resource %q, but not found", widgetID)
+		}
+
+		for k, want := range map[string]string{
+			kubernetes.Name:       "pong-widget",
+			kubernetes.Namespace:  "ping",
+			kubernetes.NodeType:   "Widget",
+			kubernetes.APIVersion: "foo.example.com/v1",
+		} {
+			if have, ok := node.Latest.Lookup(k); !ok || have != want {
+				t.Errorf("Expected custom resource %s latest %q: %q, got %q", widgetID, k, want, have)
+			}
+		}
+
+		if parents, ok := rpt.Pod.Nodes[pod1ID].Parents.Lookup(report.CustomResource); !ok || !parents.Contains(widgetID) {
+			t.Errorf("Expected pod %s to have parent custom resource %q, got %q", pod1ID, widgetID, parents)
+		}
+		if _, ok := rpt.Pod.Nodes[pod2ID].Parents.Lookup(report.CustomResource); ok {
+			t.Errorf("Expected pod %s to have no parent custom resource", pod2ID)
+		}
+	}
+}
+
+func TestReporterEvents(t *testing.T) {
+	now := time.Now()
+	event := func(name, reason string, ago time.Duration) kubernetes.ClusterEvent {
+		return kubernetes.NewClusterEvent(&apiv1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "ping"},
+			InvolvedObject: apiv1.ObjectReference{Kind: "Pod", Name: "pong-a", UID: types.UID(pod1UID)},
+			Reason:         reason,
+			Message:        reason + " happened",
+			Type:           "Warning",
+			Count:          3,
+			LastTimestamp:  metav1.NewTime(now.Add(-ago)),
+		})
+	}
+	client := newMockClient()
+	client.events = []kubernetes.ClusterEvent{
+		event("pong-a.1", "FailedScheduling", 30*time.Minute),
+		event("pong-a.2", "BackOff", time.Minute),
+		event("pong-a.0", "Pulled", 2*time.Hour),
+	}
+	rpt, err := kubernetes.NewReporter(client, nil, "", "foo", nil, controls.NewDefaultHandlerRegistry(), "", 0).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := rpt.Pod.Nodes[report.MakePodNodeID(pod1UID)].ExtractMulticolumnTable(kubernetes.EventsTableTemplate)
+	if len(rows) != 2 {
+		t.Fatalf("Expected the 2 events of the last hour, got %v", rows)
+	}
+	want := report.Row{ID: "pong-a.2", Entries: map[string]string{
+		kubernetes.EventLastSeen: now.Add(-time.Minute).UTC().Format(time.RFC3339),
+		kubernetes.EventType:     "Warning",
+		kubernetes.EventReason:   "BackOff",
+		kubernetes.EventMessage:  "BackOff happened",
+		kubernetes.EventCount:    "3",
+	}}
+	if !reflect.DeepEqual(want, rows[1]) {
+		t.Errorf("Unexpected event row: %v", rows[1])
+	}
+	if rows := rpt.Pod.Nodes[report.MakePodNodeID(pod2UID)].ExtractMulticolumnTable(kubernetes.EventsTableTemplate); len(rows) != 0 {
+		t.Errorf("Expected no events of other pods, got %v", rows)
+	}
+}
+
+func TestNetworkPolicyNode(t *testing.T) {
+	policy := kubernetes.NewNetworkPolicy(&apiextensionsv1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "allow-pingers",
+			UID:       types.UID("policy1234"),
+			Namespace: "ping",
+		},
+		Spec: apiextensionsv1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"ponger": "true"}},
+			Ingress: []apiextensionsv1beta1.NetworkPolicyIngressRule{
+				{From: []apiextensionsv1beta1.NetworkPolicyPeer{
+					{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pinger": "true"}}},
+					{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ops"}}},
+				}},
+			},
+		},
+	})
+	node, err := policy.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := node.Latest.Lookup(kubernetes.PolicyPodSelector); have != "ponger=true" {
+		t.Errorf("Unexpected pod selector %q", have)
+	}
+	ingress, _ := node.Latest.Lookup(kubernetes.PolicyIngress)
+	have, err := kubernetes.ParseNetworkPolicyIngress(ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []kubernetes.NetworkPolicyIngressRule{
+		{From: []kubernetes.NetworkPolicyPeer{
+			{PodSelector: "pinger=true"},
+			{AnyNamespace: true},
+		}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestParseCustomResourceTypes(t *testing.T) {
+	have, err := kubernetes.ParseCustomResourceTypes("foo.example.com/v1:Widget, bar.example.com/v1alpha1:Proxy:proxies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []kubernetes.CustomResourceType{
+		{Group: "foo.example.com", Version: "v1", Kind: "Widget", Resource: "widgets"},
+		{Group: "bar.example.com", Version: "v1alpha1", Kind: "Proxy", Resource: "proxies"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	for _, invalid := range []string{"Widget", "foo.example.com:Widget", "foo.example.com/v1:", "/v1:Widget"} {
+		if _, err := kubernetes.ParseCustomResourceTypes(invalid); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
 }
 
 func TestTagger(t *testing.T) {
@@ -357,4 +574,170 @@ func TestReporterGetLogs(t *testing.T) {
 	if !closed {
 		t.Errorf("Expected pipe to close the underlying log stream")
 	}
+
+	// Logs are followed with timestamps by default
+	if want := (kubernetes.LogOptions{Follow: true, Timestamps: true}); !reflect.DeepEqual(want, client.logOptions) {
+		t.Errorf("Expected default log options %+v, got %+v", want, client.logOptions)
+	}
+
+	// Options are taken from the arguments of the request
+	client.logs[podNamespaceAndID] = ioutil.NopCloser(strings.NewReader(wantContents))
+	pod1Request.ControlArgs = map[string]string{
+		"container":  "sidecar",
+		"follow":     "false",
+		"tail_lines": "100",
+		"previous":   "true",
+		"timestamps": "false",
+	}
+	if resp := reporter.CapturePod(reporter.GetLogs)(pod1Request); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	tailLines := int64(100)
+	if want := (kubernetes.LogOptions{Container: "sidecar", TailLines: &tailLines, Previous: true}); !reflect.DeepEqual(want, client.logOptions) {
+		t.Errorf("Expected log options %+v, got %+v", want, client.logOptions)
+	}
+	for _, args := range []map[string]string{{"follow": "maybe"}, {"tail_lines": "-1"}, {"tail_lines": "lots"}} {
+		pod1Request.ControlArgs = args
+		if resp := reporter.CapturePod(reporter.GetLogs)(pod1Request); resp.Error == "" {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestReporterDeploymentControls(t *testing.T) {
+	deploymentUID := "deployment1234"
+	deployment := kubernetes.NewDeployment(&apiextensionsv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pong",
+			UID:       types.UID(deploymentUID),
+			Namespace: "ping",
+		},
+		Spec: apiextensionsv1beta1.DeploymentSpec{Paused: true},
+	})
+	client := newMockClient()
+	client.deployments = []kubernetes.Deployment{deployment}
+	reporter := kubernetes.NewReporter(client, nil, "", "", nil, controls.NewDefaultHandlerRegistry(), "", 0)
+
+	// Paused deployments can be resumed, but not paused again
+	node := deployment.GetNode("probe")
+	for control, want := range map[string]bool{
+		kubernetes.RolloutRestart: true,
+		kubernetes.PauseRollout:   false,
+		kubernetes.ResumeRollout:  true,
+		kubernetes.Rollback:       true,
+	} {
+		if _, have := node.LatestControls.Lookup(control); have != want {
+			t.Errorf("%s: want %t, have %t", control, want, have)
+		}
+	}
+
+	nodeID := report.MakeDeploymentNodeID(deploymentUID)
+	for _, f := range []func(xfer.Request, string, string) xfer.Response{
+		reporter.RolloutRestart, reporter.PauseRollout, reporter.ResumeRollout, reporter.Rollback,
+	} {
+		if resp := reporter.CaptureDeployment(f)(xfer.Request{NodeID: nodeID}); resp.Error != "" {
+			t.Fatal(resp.Error)
+		}
+	}
+	want := []string{"restart ping/pong", "paused=true ping/pong", "paused=false ping/pong", "rollback ping/pong"}
+	if !reflect.DeepEqual(want, client.rollouts) {
+		t.Errorf("want %v, have %v", want, client.rollouts)
+	}
+
+	resp := reporter.CaptureDeployment(reporter.Rollback)(xfer.Request{NodeID: report.MakeDeploymentNodeID("notfound")})
+	if want := "Deployment not found: notfound"; resp.Error != want {
+		t.Errorf("want %q, have %q", want, resp.Error)
+	}
+}
+
+func TestReporterNodeControls(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{}, nil
+	}
+
+	client := newMockClient()
+	client.nodes = []*apiv1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec:       apiv1.NodeSpec{Unschedulable: true},
+	}}
+	reporter := kubernetes.NewReporter(client, nil, "probe", "foo", nil, controls.NewDefaultHandlerRegistry(), nodeName, 0)
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cordoned nodes can be uncordoned, but not cordoned again
+	hostID := report.MakeHostNodeID("foo")
+	node, ok := rpt.Host.Nodes[hostID]
+	if !ok {
+		t.Fatalf("Expected host node %s", hostID)
+	}
+	for control, want := range map[string]bool{
+		kubernetes.CordonNode:   false,
+		kubernetes.UncordonNode: true,
+		kubernetes.DrainNode:    true,
+	} {
+		if _, have := node.LatestControls.Lookup(control); have != want {
+			t.Errorf("%s: want %t, have %t", control, want, have)
+		}
+	}
+	if have, _ := node.Latest.Lookup(kubernetes.Unschedulable); have != "true" {
+		t.Errorf("want unschedulable, have %q", have)
+	}
+
+	for _, req := range []struct {
+		f    func(xfer.Request, string) xfer.Response
+		args map[string]string
+	}{
+		{reporter.Cordon, nil},
+		{reporter.Uncordon, nil},
+		{reporter.Drain, nil},
+		{reporter.Drain, map[string]string{"grace_period": "30"}},
+	} {
+		if resp := reporter.CaptureNode(req.f)(xfer.Request{NodeID: hostID, ControlArgs: req.args}); resp.Error != "" {
+			t.Fatal(resp.Error)
+		}
+	}
+	want := []string{"unschedulable=true nodename", "unschedulable=false nodename", "drain nodename", "drain nodename 30s"}
+	if !reflect.DeepEqual(want, client.nodeActions) {
+		t.Errorf("want %v, have %v", want, client.nodeActions)
+	}
+
+	resp := reporter.CaptureNode(reporter.Drain)(xfer.Request{NodeID: hostID, ControlArgs: map[string]string{"grace_period": "soon"}})
+	if want := `Invalid grace_period: "soon"`; resp.Error != want {
+		t.Errorf("want %q, have %q", want, resp.Error)
+	}
+	resp = reporter.CaptureNode(reporter.Cordon)(xfer.Request{NodeID: report.MakeHostNodeID("bar")})
+	if want := "Kubernetes node not found: bar"; resp.Error != want {
+		t.Errorf("want %q, have %q", want, resp.Error)
+	}
+}
+
+func TestReporterDeletePodDryRun(t *testing.T) {
+	client := newMockClient()
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := kubernetes.NewReporter(client, nil, "", "", nil, hr, "", 0)
+	defer reporter.Stop()
+
+	resp := hr.HandleControlRequest(xfer.Request{
+		NodeID:  report.MakePodNodeID(pod1UID),
+		Control: xfer.DryRunControl(kubernetes.DeletePod),
+	})
+	want := []string{
+		"Pod ping/pong-a will be deleted, once its containers exit within their grace period",
+		"It is not managed by a controller, and will not be recreated",
+	}
+	if resp.DryRun == nil || !reflect.DeepEqual(want, resp.DryRun.Effects) {
+		t.Fatalf("want %v, have %+v", want, resp)
+	}
+	resp = hr.HandleControlRequest(xfer.Request{
+		NodeID:      report.MakePodNodeID(pod1UID),
+		Control:     kubernetes.DeletePod,
+		ControlArgs: map[string]string{xfer.ConfirmationArg: resp.DryRun.Confirmation},
+	})
+	if resp.Error != "" || resp.RemovedNode != report.MakePodNodeID(pod1UID) {
+		t.Errorf("Expected the pod to be deleted, got %+v", resp)
+	}
 }
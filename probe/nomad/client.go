@@ -0,0 +1,131 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const clientTimeout = 10 * time.Second
+
+// Job is the job of an allocation, as given by the Nomad API.
+type Job struct {
+	ID          string   `json:"ID"`
+	Name        string   `json:"Name"`
+	Namespace   string   `json:"Namespace"`
+	Type        string   `json:"Type"`
+	Status      string   `json:"Status"`
+	Datacenters []string `json:"Datacenters"`
+	Version     uint64   `json:"Version"`
+}
+
+// TaskState is the state of a task of an allocation.
+type TaskState struct {
+	State    string `json:"State"`
+	Restarts uint64 `json:"Restarts"`
+}
+
+// Allocation is an allocation, as given by the Nomad API.
+type Allocation struct {
+	ID            string               `json:"ID"`
+	Name          string               `json:"Name"`
+	Namespace     string               `json:"Namespace"`
+	NodeID        string               `json:"NodeID"`
+	JobID         string               `json:"JobID"`
+	Job           *Job                 `json:"Job"`
+	TaskGroup     string               `json:"TaskGroup"`
+	DesiredStatus string               `json:"DesiredStatus"`
+	ClientStatus  string               `json:"ClientStatus"`
+	TaskStates    map[string]TaskState `json:"TaskStates"`
+	CreateTime    int64                `json:"CreateTime"` // in nanoseconds
+}
+
+// Client talks to the local Nomad agent. Exposed for testing.
+type Client interface {
+	// LocalAllocations gives the allocations placed on the client node of
+	// the agent. Agents which are only servers have none.
+	LocalAllocations() ([]Allocation, error)
+}
+
+type client struct {
+	addr  string
+	token string
+	http  *http.Client
+
+	mtx    sync.Mutex
+	nodeID string
+}
+
+// NewClient makes a Client of the Nomad agent API served on addr, sending
+// token as the ACL token of requests if it isn't empty.
+func NewClient(addr, token string) (Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid Nomad address '%s'", addr)
+	}
+	return &client{
+		addr:  strings.TrimSuffix(addr, "/"),
+		token: token,
+		http:  &http.Client{Timeout: clientTimeout},
+	}, nil
+}
+
+func (c *client) get(path string, result interface{}) error {
+	req, err := http.NewRequest("GET", c.addr+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+type agentSelf struct {
+	Stats struct {
+		Client struct {
+			NodeID string `json:"node_id"`
+		} `json:"client"`
+	} `json:"stats"`
+}
+
+// localNodeID gives the ID of the client node of the agent, which doesn't
+// change for the life of the agent.
+func (c *client) localNodeID() (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.nodeID != "" {
+		return c.nodeID, nil
+	}
+	var self agentSelf
+	if err := c.get("/v1/agent/self", &self); err != nil {
+		return "", err
+	}
+	c.nodeID = self.Stats.Client.NodeID
+	return c.nodeID, nil
+}
+
+func (c *client) LocalAllocations() ([]Allocation, error) {
+	nodeID, err := c.localNodeID()
+	if err != nil || nodeID == "" {
+		return nil, err
+	}
+	var allocations []Allocation
+	err = c.get("/v1/node/"+url.PathEscape(nodeID)+"/allocations", &allocations)
+	return allocations, err
+}
@@ -0,0 +1,177 @@
+package nomad
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Name          = "nomad_name"
+	Namespace     = "nomad_namespace"
+	JobType       = "nomad_job_type"
+	JobStatus     = "nomad_job_status"
+	JobVersion    = "nomad_job_version"
+	Datacenters   = "nomad_datacenters"
+	TaskGroup     = "nomad_task_group"
+	DesiredStatus = "nomad_desired_status"
+	ClientStatus  = "nomad_client_status"
+	Tasks         = "nomad_tasks"
+	Created       = "nomad_created"
+)
+
+// AllocationIDLabel is the label the docker driver of Nomad gives the
+// containers of allocations.
+const AllocationIDLabel = "com.hashicorp.nomad.alloc_id"
+
+// Exposed for testing
+var (
+	JobMetadataTemplates = report.MetadataTemplates{
+		JobType:     {ID: JobType, Label: "Type", From: report.FromLatest, Priority: 1},
+		JobStatus:   {ID: JobStatus, Label: "Status", From: report.FromLatest, Priority: 2},
+		JobVersion:  {ID: JobVersion, Label: "Version", From: report.FromLatest, Datatype: "number", Priority: 3},
+		Namespace:   {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 4},
+		Datacenters: {ID: Datacenters, Label: "Datacenters", From: report.FromLatest, Priority: 5},
+	}
+
+	TaskGroupMetadataTemplates = report.MetadataTemplates{
+		Namespace: {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+	}
+
+	AllocationMetadataTemplates = report.MetadataTemplates{
+		ClientStatus:     {ID: ClientStatus, Label: "Status", From: report.FromLatest, Priority: 1},
+		DesiredStatus:    {ID: DesiredStatus, Label: "Desired Status", From: report.FromLatest, Priority: 2},
+		TaskGroup:        {ID: TaskGroup, Label: "Task Group", From: report.FromLatest, Priority: 3},
+		Tasks:            {ID: Tasks, Label: "Tasks", From: report.FromLatest, Priority: 4},
+		report.Container: {ID: report.Container, Label: "# Containers", From: report.FromCounters, Datatype: "number", Priority: 5},
+		Namespace:        {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 6},
+		Created:          {ID: Created, Label: "Created", From: report.FromLatest, Datatype: "datetime", Priority: 7},
+	}
+
+	AllocationMetricTemplates = docker.ContainerMetricTemplates
+)
+
+// Reporter generates Reports containing the NomadJob, NomadTaskGroup and
+// NomadAllocation topologies of the allocations on the local Nomad client,
+// and tags the containers of those allocations with them.
+type Reporter struct {
+	client Client
+	hostID string
+}
+
+// NewReporter makes a new Reporter.
+func NewReporter(client Client, hostID string) *Reporter {
+	return &Reporter{
+		client: client,
+		hostID: hostID,
+	}
+}
+
+// Name of this reporter/tagger/ticker, for metrics gathering
+func (*Reporter) Name() string { return "Nomad" }
+
+// Tag adds the allocations of containers run by the docker driver of Nomad
+// as their parents.
+func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
+	for id, n := range rpt.Container.Nodes {
+		allocationID, ok := n.Latest.Lookup(docker.LabelPrefix + AllocationIDLabel)
+		if !ok {
+			continue
+		}
+		rpt.Container.Nodes[id] = n.WithParents(n.Parents.Add(
+			report.NomadAllocation,
+			report.MakeStringSet(report.MakeNomadAllocationNodeID(allocationID)),
+		))
+	}
+	return rpt, nil
+}
+
+// Report generates a Report containing the NomadJob, NomadTaskGroup and
+// NomadAllocation topologies. Only allocations which haven't terminated are
+// reported.
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.NomadJob = result.NomadJob.WithMetadataTemplates(JobMetadataTemplates)
+	result.NomadTaskGroup = result.NomadTaskGroup.WithMetadataTemplates(TaskGroupMetadataTemplates)
+	result.NomadAllocation = result.NomadAllocation.
+		WithMetadataTemplates(AllocationMetadataTemplates).
+		WithMetricTemplates(AllocationMetricTemplates)
+
+	allocations, err := r.client.LocalAllocations()
+	if err != nil {
+		return result, err
+	}
+	for _, a := range allocations {
+		if terminal(a) {
+			continue
+		}
+		jobID := report.MakeNomadJobNodeID(a.Namespace + "/" + a.JobID)
+		taskGroupID := report.MakeNomadTaskGroupNodeID(a.Namespace + "/" + a.JobID + "/" + a.TaskGroup)
+		result.NomadJob.AddNode(jobNode(jobID, a))
+		result.NomadTaskGroup.AddNode(report.MakeNodeWith(taskGroupID, map[string]string{
+			Name:      a.TaskGroup,
+			Namespace: a.Namespace,
+		}).WithParents(report.MakeSets().
+			Add(report.NomadJob, report.MakeStringSet(jobID)),
+		))
+		result.NomadAllocation.AddNode(r.allocationNode(a, jobID, taskGroupID))
+	}
+	return result, nil
+}
+
+// terminal tells whether an allocation has finished running. Nomad keeps
+// those until they are garbage collected.
+func terminal(a Allocation) bool {
+	switch a.ClientStatus {
+	case "complete", "failed", "lost":
+		return true
+	}
+	return false
+}
+
+func jobNode(id string, a Allocation) report.Node {
+	latest := map[string]string{
+		Name:      a.JobID,
+		Namespace: a.Namespace,
+	}
+	if j := a.Job; j != nil {
+		if j.Name != "" {
+			latest[Name] = j.Name
+		}
+		latest[JobType] = j.Type
+		latest[JobStatus] = j.Status
+		latest[JobVersion] = strconv.FormatUint(j.Version, 10)
+		latest[Datacenters] = strings.Join(j.Datacenters, ", ")
+	}
+	return report.MakeNodeWith(id, latest)
+}
+
+func (r *Reporter) allocationNode(a Allocation, jobID, taskGroupID string) report.Node {
+	tasks := []string{}
+	for name := range a.TaskStates {
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+	latest := map[string]string{
+		Name:          a.Name,
+		Namespace:     a.Namespace,
+		TaskGroup:     a.TaskGroup,
+		DesiredStatus: a.DesiredStatus,
+		ClientStatus:  a.ClientStatus,
+		Tasks:         strings.Join(tasks, ", "),
+	}
+	if a.CreateTime != 0 {
+		latest[Created] = time.Unix(0, a.CreateTime).UTC().Format(time.RFC3339Nano)
+	}
+	return report.MakeNodeWith(report.MakeNomadAllocationNodeID(a.ID), latest).
+		WithParents(report.MakeSets().
+			Add(report.NomadJob, report.MakeStringSet(jobID)).
+			Add(report.NomadTaskGroup, report.MakeStringSet(taskGroupID)).
+			Add(report.Host, report.MakeStringSet(report.MakeHostNodeID(r.hostID))),
+		)
+}
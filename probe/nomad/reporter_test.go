@@ -0,0 +1,178 @@
+package nomad_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/nomad"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	allocations []nomad.Allocation
+}
+
+func (c *mockClient) LocalAllocations() ([]nomad.Allocation, error) {
+	return c.allocations, nil
+}
+
+var (
+	created = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	webJob  = &nomad.Job{ID: "web", Name: "web", Namespace: "default", Type: "service", Status: "running", Datacenters: []string{"dc1"}, Version: 3}
+
+	allocations = []nomad.Allocation{
+		{
+			ID:            "alloc1",
+			Name:          "web.frontend[0]",
+			Namespace:     "default",
+			JobID:         "web",
+			Job:           webJob,
+			TaskGroup:     "frontend",
+			DesiredStatus: "run",
+			ClientStatus:  "running",
+			TaskStates:    map[string]nomad.TaskState{"nginx": {State: "running"}, "envoy": {State: "running"}},
+			CreateTime:    created.UnixNano(),
+		},
+		{
+			ID:            "alloc2",
+			Name:          "web.frontend[1]",
+			Namespace:     "default",
+			JobID:         "web",
+			Job:           webJob,
+			TaskGroup:     "frontend",
+			DesiredStatus: "run",
+			ClientStatus:  "pending",
+		},
+		{
+			ID:            "alloc3",
+			Name:          "web.frontend[0]",
+			Namespace:     "default",
+			JobID:         "web",
+			Job:           webJob,
+			TaskGroup:     "frontend",
+			DesiredStatus: "stop",
+			ClientStatus:  "complete",
+		},
+	}
+)
+
+func TestReporter(t *testing.T) {
+	rpt, err := nomad.NewReporter(&mockClient{allocations: allocations}, "host1").Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobID := report.MakeNomadJobNodeID("default/web")
+	job, ok := rpt.NomadJob.Nodes[jobID]
+	if len(rpt.NomadJob.Nodes) != 1 || !ok {
+		t.Fatalf("Expected the job %s, got %v", jobID, rpt.NomadJob.Nodes)
+	}
+	for k, want := range map[string]string{
+		nomad.Name:        "web",
+		nomad.JobType:     "service",
+		nomad.JobVersion:  "3",
+		nomad.Datacenters: "dc1",
+	} {
+		if have, _ := job.Latest.Lookup(k); have != want {
+			t.Errorf("Expected job %s %q, got %q", k, want, have)
+		}
+	}
+
+	taskGroupID := report.MakeNomadTaskGroupNodeID("default/web/frontend")
+	taskGroup, ok := rpt.NomadTaskGroup.Nodes[taskGroupID]
+	if len(rpt.NomadTaskGroup.Nodes) != 1 || !ok {
+		t.Fatalf("Expected the task group %s, got %v", taskGroupID, rpt.NomadTaskGroup.Nodes)
+	}
+	if parents, _ := taskGroup.Parents.Lookup(report.NomadJob); !parents.Contains(jobID) {
+		t.Errorf("Expected the task group to be in the job, got %v", taskGroup.Parents)
+	}
+
+	// Terminal allocations aren't reported
+	if len(rpt.NomadAllocation.Nodes) != 2 {
+		t.Fatalf("Expected 2 allocations, got %v", rpt.NomadAllocation.Nodes)
+	}
+	alloc := rpt.NomadAllocation.Nodes[report.MakeNomadAllocationNodeID("alloc1")]
+	for k, want := range map[string]string{
+		nomad.Name:         "web.frontend[0]",
+		nomad.ClientStatus: "running",
+		nomad.Tasks:        "envoy, nginx",
+		nomad.Created:      "2020-06-01T12:00:00Z",
+	} {
+		if have, _ := alloc.Latest.Lookup(k); have != want {
+			t.Errorf("Expected allocation %s %q, got %q", k, want, have)
+		}
+	}
+	for topology, want := range map[string]string{
+		report.NomadJob:       jobID,
+		report.NomadTaskGroup: taskGroupID,
+		report.Host:           report.MakeHostNodeID("host1"),
+	} {
+		if parents, _ := alloc.Parents.Lookup(topology); !parents.Contains(want) {
+			t.Errorf("Expected %s parent %s, got %v", topology, want, alloc.Parents)
+		}
+	}
+}
+
+func TestTagger(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(report.MakeNodeWith("container1", map[string]string{
+		docker.LabelPrefix + nomad.AllocationIDLabel: "alloc1",
+	}))
+	rpt.Container.AddNode(report.MakeNode("container2"))
+
+	rpt, err := nomad.NewReporter(&mockClient{}, "host1").Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := rpt.Container.Nodes["container1"].Parents.Lookup(report.NomadAllocation); !parents.Contains(report.MakeNomadAllocationNodeID("alloc1")) {
+		t.Errorf("Expected container1 to be in alloc1, got %v", rpt.Container.Nodes["container1"].Parents)
+	}
+	if _, ok := rpt.Container.Nodes["container2"].Parents.Lookup(report.NomadAllocation); ok {
+		t.Errorf("Expected container2 not to be in an allocation")
+	}
+}
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/agent/self", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Nomad-Token") != "secret" {
+			http.Error(w, "Permission denied", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"stats": map[string]interface{}{"client": map[string]string{"node_id": "node1"}},
+		})
+	})
+	mux.HandleFunc("/v1/node/node1/allocations", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(allocations[:1])
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if _, err := nomad.NewClient("127.0.0.1:4646", ""); err == nil {
+		t.Error("Expected an error for an address without a scheme")
+	}
+	client, err := nomad.NewClient(server.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.LocalAllocations(); err == nil {
+		t.Error("Expected an error for a wrong token")
+	}
+
+	client, err = nomad.NewClient(server.URL+"/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := client.LocalAllocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 1 || have[0].ID != "alloc1" || have[0].Job == nil || have[0].Job.Type != "service" || have[0].TaskStates["nginx"].State != "running" {
+		t.Errorf("Unexpected allocations %+v", have)
+	}
+}
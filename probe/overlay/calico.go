@@ -0,0 +1,145 @@
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	realexec "os/exec"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+	"github.com/weaveworks/common/exec"
+)
+
+// Calico is a Network collected with calicoctl: the BGP sessions of the
+// node with its peers, and the IP pools of the cluster.
+type Calico struct {
+	calicoctl string
+}
+
+// NewCalico makes a new Calico running the calicoctl at path.
+func NewCalico(path string) *Calico {
+	return &Calico{calicoctl: path}
+}
+
+// Name implements Network.
+func (*Calico) Name() string { return "Calico" }
+
+// bgpPeer is a row of the BGP status of calicoctl node status.
+type bgpPeer struct {
+	address, info string
+}
+
+// calicoIPPools is the output of calicoctl get ippools -o json.
+type calicoIPPools struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			CIDR      string `json:"cidr"`
+			IPIPMode  string `json:"ipipMode"`
+			VXLANMode string `json:"vxlanMode"`
+			Disabled  bool   `json:"disabled"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+func (c *Calico) run(args ...string) ([]byte, error) {
+	output, err := exec.Command(c.calicoctl, args...).Output()
+	if err != nil {
+		if execErr, ok := err.(*realexec.Error); ok && execErr.Err == realexec.ErrNotFound {
+			return nil, ErrNotRunning
+		}
+		if exitErr, ok := err.(*realexec.ExitError); ok {
+			return output, fmt.Errorf("calicoctl %s: %v: %q", strings.Join(args, " "), err, exitErr.Stderr)
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+// Collect implements Network.
+func (c *Calico) Collect() (NetworkStatus, error) {
+	output, err := c.run("node", "status")
+	if bytes.Contains(output, []byte("Calico process is not running")) {
+		return NetworkStatus{}, ErrNotRunning
+	} else if err != nil {
+		return NetworkStatus{}, err
+	}
+	peers := parseBGPPeers(output)
+
+	output, err = c.run("get", "ippools", "-o", "json")
+	if err != nil {
+		return NetworkStatus{}, err
+	}
+	var pools calicoIPPools
+	if err := codec.NewDecoderBytes(output, &codec.JsonHandle{}).Decode(&pools); err != nil {
+		return NetworkStatus{}, fmt.Errorf("calicoctl get ippools: %v", err)
+	}
+
+	status := NetworkStatus{Healthy: true}
+	var poolNames []string
+	for _, pool := range pools.Items {
+		if pool.Spec.Disabled {
+			continue
+		}
+		status.Subnets = append(status.Subnets, pool.Spec.CIDR)
+		encapsulation := "none"
+		if pool.Spec.IPIPMode != "" && pool.Spec.IPIPMode != "Never" {
+			encapsulation = "IPIP"
+		} else if pool.Spec.VXLANMode != "" && pool.Spec.VXLANMode != "Never" {
+			encapsulation = "VXLAN"
+		}
+		poolNames = append(poolNames, fmt.Sprintf("%s (%s)", pool.Spec.CIDR, encapsulation))
+	}
+
+	var down []string
+	for _, peer := range peers {
+		if peer.info != "Established" {
+			down = append(down, peer.address)
+		}
+	}
+	if len(down) > 0 {
+		status.Healthy, status.Status = false, fmt.Sprintf("BGP sessions not established with %s", strings.Join(down, ", "))
+	}
+	status.Properties = map[string]string{
+		"BGP Peers": fmt.Sprintf("%d of %d established", len(peers)-len(down), len(peers)),
+		"IP Pools":  strings.Join(poolNames, ", "),
+	}
+	return status, nil
+}
+
+// parseBGPPeers parses the tables of the BGP status in the output of
+// calicoctl node status:
+//
+//	IPv4 BGP status
+//	+--------------+-------------------+-------+----------+-------------+
+//	| PEER ADDRESS |     PEER TYPE     | STATE |  SINCE   |    INFO     |
+//	+--------------+-------------------+-------+----------+-------------+
+//	| 172.17.8.102 | node-to-node mesh | up    | 23:30:04 | Established |
+//	+--------------+-------------------+-------+----------+-------------+
+func parseBGPPeers(output []byte) []bgpPeer {
+	var (
+		peers   []bgpPeer
+		scanner = bufio.NewScanner(bytes.NewReader(output))
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		columns := strings.Split(strings.Trim(line, "|"), "|")
+		if len(columns) < 5 {
+			continue
+		}
+		for i := range columns {
+			columns[i] = strings.TrimSpace(columns[i])
+		}
+		if columns[0] == "PEER ADDRESS" {
+			continue
+		}
+		peers = append(peers, bgpPeer{address: columns[0], info: columns[4]})
+	}
+	return peers
+}
@@ -0,0 +1,129 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+const ciliumTimeout = 5 * time.Second
+
+// Cilium is a Network collected from the API of the Cilium agent, on its
+// unix socket: its health, endpoints and security identities.
+type Cilium struct {
+	socket string
+	client *http.Client
+}
+
+// NewCilium makes a new Cilium of the agent listening on the unix socket
+// at path, usually /var/run/cilium/cilium.sock.
+func NewCilium(path string) *Cilium {
+	return &Cilium{
+		socket: path,
+		client: &http.Client{
+			Timeout: ciliumTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Name implements Network.
+func (*Cilium) Name() string { return "Cilium" }
+
+type ciliumHealth struct {
+	Cilium struct {
+		State string `json:"state"`
+		Msg   string `json:"msg"`
+	} `json:"cilium"`
+}
+
+type ciliumEndpoint struct {
+	ID     int64 `json:"id"`
+	Status struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+type ciliumIdentity struct {
+	ID int64 `json:"id"`
+}
+
+type ciliumConfig struct {
+	Status struct {
+		Addressing struct {
+			IPv4 struct {
+				AllocRange string `json:"alloc-range"`
+			} `json:"ipv4"`
+		} `json:"addressing"`
+	} `json:"status"`
+}
+
+func (c *Cilium) get(path string, v interface{}) error {
+	resp, err := c.client.Get("http://cilium/v1" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /v1%s: got %d", path, resp.StatusCode)
+	}
+	return codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(v)
+}
+
+// Collect implements Network.
+func (c *Cilium) Collect() (NetworkStatus, error) {
+	if _, err := os.Stat(c.socket); os.IsNotExist(err) {
+		return NetworkStatus{}, ErrNotRunning
+	}
+
+	var (
+		health     ciliumHealth
+		endpoints  []ciliumEndpoint
+		identities []ciliumIdentity
+		config     ciliumConfig
+	)
+	if err := c.get("/healthz", &health); err != nil {
+		return NetworkStatus{}, err
+	}
+	if err := c.get("/endpoint", &endpoints); err != nil {
+		return NetworkStatus{}, err
+	}
+	if err := c.get("/identity", &identities); err != nil {
+		return NetworkStatus{}, err
+	}
+	if err := c.get("/config", &config); err != nil {
+		return NetworkStatus{}, err
+	}
+
+	notReady := 0
+	for _, endpoint := range endpoints {
+		if endpoint.Status.State != "ready" {
+			notReady++
+		}
+	}
+	status := NetworkStatus{
+		Healthy: health.Cilium.State == "Ok",
+		Status:  fmt.Sprintf("%s: %s", health.Cilium.State, health.Cilium.Msg),
+		Properties: map[string]string{
+			"Endpoints":  fmt.Sprintf("%d (%d not ready)", len(endpoints), notReady),
+			"Identities": fmt.Sprintf("%d", len(identities)),
+		},
+	}
+	if status.Healthy && notReady > 0 {
+		status.Healthy, status.Status = false, fmt.Sprintf("%d endpoints not ready", notReady)
+	}
+	if allocRange := config.Status.Addressing.IPv4.AllocRange; allocRange != "" {
+		status.Subnets = []string{allocRange}
+		status.Properties["Allocation Range"] = allocRange
+	}
+	return status, nil
+}
@@ -0,0 +1,161 @@
+package overlay
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in the Node of the host
+const (
+	OverlayNetworks    = "overlay_networks"
+	OverlayTablePrefix = "overlay_table_"
+)
+
+// ErrNotRunning is returned by a Network not running on the host.
+var ErrNotRunning = errors.New("not running")
+
+// NetworkStatus is the state of an overlay network on the host.
+type NetworkStatus struct {
+	// Healthy is whether the network works as expected, and Status why
+	// not if it doesn't.
+	Healthy bool
+	Status  string
+	// Subnets are the CIDRs of the addresses of the network.
+	Subnets []string
+	// Properties are shown in the host details, by label.
+	Properties map[string]string
+}
+
+// Network is an overlay network other than Weave Net, which is detected
+// by its agent running on the host.
+type Network interface {
+	// Name of the network, as shown in the host details.
+	Name() string
+	// Collect gives the state of the network, or ErrNotRunning.
+	Collect() (NetworkStatus, error)
+}
+
+// Networks reports the overlay networks running on the host, on its node,
+// and their subnets as local networks.
+type Networks struct {
+	hostID   string
+	networks []Network
+	quit     chan struct{}
+
+	mtx      sync.RWMutex
+	statuses map[string]NetworkStatus // by name, of the networks running
+}
+
+// NewNetworks makes a new Networks, collecting from networks every
+// interval.
+func NewNetworks(hostID string, interval time.Duration, networks ...Network) *Networks {
+	n := &Networks{
+		hostID:   hostID,
+		networks: networks,
+		quit:     make(chan struct{}),
+		statuses: map[string]NetworkStatus{},
+	}
+	go n.loop(interval)
+	return n
+}
+
+// Name of this reporter, for metrics gathering
+func (*Networks) Name() string { return "Overlay" }
+
+// Stop collecting from the networks.
+func (n *Networks) Stop() {
+	close(n.quit)
+}
+
+func (n *Networks) loop(interval time.Duration) {
+	n.collect()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.collect()
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+func (n *Networks) collect() {
+	statuses := map[string]NetworkStatus{}
+	for _, network := range n.networks {
+		status, err := network.Collect()
+		if err == ErrNotRunning {
+			continue
+		} else if err != nil {
+			log.Warnf("Error collecting the status of %s: %v", network.Name(), err)
+			status = NetworkStatus{Status: err.Error()}
+		}
+		statuses[network.Name()] = status
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.statuses = statuses
+}
+
+// tablePrefix is the prefix of the property list of a network.
+func tablePrefix(name string) string {
+	return OverlayTablePrefix + strings.ToLower(name) + "_"
+}
+
+// Report implements Reporter.
+func (n *Networks) Report() (report.Report, error) {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+
+	r := report.MakeReport()
+	if len(n.statuses) == 0 {
+		return r, nil
+	}
+
+	var (
+		names    []string
+		subnets  []string
+		tables   = report.TableTemplates{}
+		hostNode = report.MakeNode(report.MakeHostNodeID(n.hostID))
+	)
+	for name, status := range n.statuses {
+		names = append(names, name)
+		subnets = append(subnets, status.Subnets...)
+
+		prefix := tablePrefix(name)
+		tables[prefix] = report.TableTemplate{
+			ID:     prefix,
+			Label:  name,
+			Type:   report.PropertyListType,
+			Prefix: prefix,
+		}
+		properties := map[string]string{"Status": "healthy"}
+		if !status.Healthy {
+			properties["Status"] = status.Status
+		}
+		for label, value := range status.Properties {
+			properties[label] = value
+		}
+		hostNode = hostNode.AddPrefixPropertyList(prefix, properties)
+	}
+	sort.Strings(names)
+
+	hostNode = hostNode.
+		WithLatests(map[string]string{OverlayNetworks: strings.Join(names, ", ")}).
+		WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet(subnets...)))
+	r.Host = r.Host.WithMetadataTemplates(report.MetadataTemplates{
+		OverlayNetworks: {ID: OverlayNetworks, Label: "Overlay Networks", From: report.FromLatest, Priority: 15},
+	}).WithTableTemplates(tables)
+	r.Host.AddNode(hostNode)
+	return r, nil
+}
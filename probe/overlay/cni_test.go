@@ -0,0 +1,165 @@
+package overlay_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/exec"
+	commonTest "github.com/weaveworks/common/test"
+	testExec "github.com/weaveworks/common/test/exec"
+
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/overlay"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+const (
+	mockNodeStatus = `Calico process is running.
+
+IPv4 BGP status
++--------------+-------------------+-------+----------+--------------------------------+
+| PEER ADDRESS |     PEER TYPE     | STATE |  SINCE   |              INFO              |
++--------------+-------------------+-------+----------+--------------------------------+
+| 172.17.8.102 | node-to-node mesh | up    | 23:30:04 | Established                    |
+| 172.17.8.103 | node-to-node mesh | start | 23:30:05 | Active Socket: Connection      |
++--------------+-------------------+-------+----------+--------------------------------+
+`
+	mockIPPools = `{"kind": "IPPoolList", "items": [
+		{"metadata": {"name": "default-ipv4-ippool"}, "spec": {"cidr": "192.168.0.0/16", "ipipMode": "Always"}},
+		{"metadata": {"name": "old"}, "spec": {"cidr": "10.10.0.0/16", "disabled": true}}
+	]}`
+)
+
+func TestCalico(t *testing.T) {
+	oldExecCmd := exec.Command
+	defer func() { exec.Command = oldExecCmd }()
+	exec.Command = func(name string, args ...string) exec.Cmd {
+		if args[0] == "node" {
+			return testExec.NewMockCmdString(mockNodeStatus)
+		}
+		return testExec.NewMockCmdString(mockIPPools)
+	}
+
+	have, err := overlay.NewCalico("calicoctl").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := overlay.NetworkStatus{
+		Status:  "BGP sessions not established with 172.17.8.103",
+		Subnets: []string{"192.168.0.0/16"},
+		Properties: map[string]string{
+			"BGP Peers": "1 of 2 established",
+			"IP Pools":  "192.168.0.0/16 (IPIP)",
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(commonTest.Diff(want, have))
+	}
+}
+
+func TestCilium(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-cilium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "cilium.sock")
+
+	if _, err := overlay.NewCilium(socket).Collect(); err != overlay.ErrNotRunning {
+		t.Errorf("Expected %v without the agent, got %v", overlay.ErrNotRunning, err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := map[string]string{
+		"/v1/healthz":  `{"cilium": {"state": "Ok", "msg": "OK"}}`,
+		"/v1/endpoint": `[{"id": 1, "status": {"state": "ready"}}, {"id": 2, "status": {"state": "ready"}}]`,
+		"/v1/identity": `[{"id": 1}, {"id": 4}, {"id": 12345}]`,
+		"/v1/config":   `{"status": {"addressing": {"ipv4": {"alloc-range": "10.0.1.0/24"}}}}`,
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, responses[r.URL.Path])
+	}))
+	defer listener.Close()
+
+	have, err := overlay.NewCilium(socket).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := overlay.NetworkStatus{
+		Healthy: true,
+		Status:  "Ok: OK",
+		Subnets: []string{"10.0.1.0/24"},
+		Properties: map[string]string{
+			"Endpoints":        "2 (0 not ready)",
+			"Identities":       "3",
+			"Allocation Range": "10.0.1.0/24",
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(commonTest.Diff(want, have))
+	}
+}
+
+func TestNetworksReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-flannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	subnetFile := filepath.Join(dir, "subnet.env")
+	subnetEnv := "FLANNEL_NETWORK=10.244.0.0/16\nFLANNEL_SUBNET=10.244.1.1/24\nFLANNEL_MTU=1450\nFLANNEL_IPMASQ=true\n"
+	if err := ioutil.WriteFile(subnetFile, []byte(subnetEnv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	networks := overlay.NewNetworks(mockHostID, time.Hour,
+		overlay.NewFlannel(subnetFile),
+		overlay.NewCilium(filepath.Join(dir, "cilium.sock")),
+	)
+	defer networks.Stop()
+	nodeID := report.MakeHostNodeID(mockHostID)
+	test.Poll(t, 300*time.Millisecond, "Flannel", func() interface{} {
+		rpt, _ := networks.Report()
+		have, _ := rpt.Host.Nodes[nodeID].Latest.Lookup(overlay.OverlayNetworks)
+		return have
+	})
+
+	rpt, err := networks.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rpt.Host.Nodes[nodeID]
+	if have, ok := node.Sets.Lookup(host.LocalNetworks); !ok || !have.Contains("10.244.1.1/24") {
+		t.Errorf("Expected the Flannel subnet in the local networks, got %v", have)
+	}
+	template, ok := rpt.Host.TableTemplates[overlay.OverlayTablePrefix+"flannel_"]
+	if !ok {
+		t.Fatalf("Expected a table of Flannel, got %v", rpt.Host.TableTemplates)
+	}
+	rows, _ := node.ExtractTable(template)
+	have := map[string]string{}
+	for _, row := range rows {
+		have[row.Entries["label"]] = row.Entries["value"]
+	}
+	want := map[string]string{
+		"Status":        "healthy",
+		"Network":       "10.244.0.0/16",
+		"Subnet":        "10.244.1.1/24",
+		"MTU":           "1450",
+		"IP Masquerade": "true",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(commonTest.Diff(want, have))
+	}
+}
@@ -0,0 +1,62 @@
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Flannel is a Network read from the subnet file flanneld writes for the
+// CNI plugin, with the network and the subnet leased to the host.
+type Flannel struct {
+	subnetFile string
+}
+
+// NewFlannel makes a new Flannel of the subnet file at path, usually
+// /run/flannel/subnet.env.
+func NewFlannel(path string) *Flannel {
+	return &Flannel{subnetFile: path}
+}
+
+// Name implements Network.
+func (*Flannel) Name() string { return "Flannel" }
+
+// Collect implements Network.
+func (f *Flannel) Collect() (NetworkStatus, error) {
+	buf, err := ioutil.ReadFile(f.subnetFile)
+	if os.IsNotExist(err) {
+		return NetworkStatus{}, ErrNotRunning
+	} else if err != nil {
+		return NetworkStatus{}, err
+	}
+
+	// FLANNEL_NETWORK=10.244.0.0/16
+	// FLANNEL_SUBNET=10.244.1.1/24
+	// FLANNEL_MTU=1450
+	// FLANNEL_IPMASQ=true
+	env := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		if kv := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+
+	status := NetworkStatus{
+		Healthy: true,
+		Properties: map[string]string{
+			"Network":       env["FLANNEL_NETWORK"],
+			"Subnet":        env["FLANNEL_SUBNET"],
+			"MTU":           env["FLANNEL_MTU"],
+			"IP Masquerade": env["FLANNEL_IPMASQ"],
+		},
+	}
+	if subnet, ok := env["FLANNEL_SUBNET"]; ok {
+		status.Subnets = []string{subnet}
+	} else {
+		status.Healthy, status.Status = false, "no subnet leased"
+	}
+	return status, nil
+}
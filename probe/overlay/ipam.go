@@ -0,0 +1,204 @@
+package overlay
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/weave"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// IDs of the tables of an IPAMInspection.
+const (
+	IPAMOwnersTable    = "weave_ipam_owners"
+	IPAMConsensusTable = "weave_ipam_consensus"
+	IPAMRepairTable    = "weave_ipam_repair"
+)
+
+// IPAMInspection is the value of the responses to the IPAM controls, as
+// tables shown in the details of the peer.
+type IPAMInspection struct {
+	Tables []report.Table `json:"tables"`
+}
+
+var (
+	ipamControls = []report.Control{
+		{
+			ID:    CheckIPAM,
+			Human: "Check IPAM consensus",
+			Icon:  "fa-check-circle",
+			Rank:  1,
+		},
+		{
+			ID:    RepairIPAM,
+			Human: "Reclaim the IP ranges of unreachable peers",
+			Icon:  "fa-wrench",
+			Rank:  2,
+		},
+	}
+
+	ipamOwnersColumns = []report.Column{
+		{ID: "peer", Label: "Peer"},
+		{ID: "reachable", Label: "Reachable"},
+		{ID: "addresses", Label: "Addresses", DataType: "number"},
+		{ID: "share", Label: "Share"},
+	}
+	ipamRepairColumns = []report.Column{
+		{ID: "peer", Label: "Peer"},
+		{ID: "result", Label: "Result"},
+	}
+)
+
+// ipamOwner is a peer owning ranges of the IPAM ring.
+type ipamOwner struct {
+	peer, nickname string
+	reachable      bool
+	size, total    uint64
+}
+
+func (o ipamOwner) share() string {
+	if o.total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(o.size)/float64(o.total))
+}
+
+func (o ipamOwner) String() string {
+	if o.nickname == "" {
+		return o.peer
+	}
+	return fmt.Sprintf("%s (%s)", o.nickname, o.peer)
+}
+
+// getIPAMOwners sums the sizes of the ranges of the ring by their owner,
+// sorted by name.
+func getIPAMOwners(ipam weave.IPAM) []ipamOwner {
+	var (
+		byPeer = map[string]*ipamOwner{}
+		total  uint64
+	)
+	for _, entry := range ipam.Entries {
+		if entry.Peer == "" {
+			continue
+		}
+		owner, ok := byPeer[entry.Peer]
+		if !ok {
+			owner = &ipamOwner{peer: entry.Peer, nickname: entry.Nickname}
+			byPeer[entry.Peer] = owner
+		}
+		owner.reachable = owner.reachable || entry.IsKnownPeer
+		owner.size += uint64(entry.Size)
+		total += uint64(entry.Size)
+	}
+	owners := make([]ipamOwner, 0, len(byPeer))
+	for _, owner := range byPeer {
+		owner.total = total
+		owners = append(owners, *owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].peer < owners[j].peer })
+	return owners
+}
+
+func (w *Weave) registerControls() {
+	w.handlerRegistry.Register(CheckIPAM, w.checkIPAM)
+	w.handlerRegistry.Register(RepairIPAM, w.repairIPAM)
+}
+
+func (w *Weave) deregisterControls() {
+	w.handlerRegistry.Rm(CheckIPAM)
+	w.handlerRegistry.Rm(RepairIPAM)
+}
+
+// ipam gives the IPAM status of the router and its name, as last
+// collected.
+func (w *Weave) ipam() (weave.IPAM, string, bool) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	if w.statusCache.IPAM == nil {
+		return weave.IPAM{}, "", false
+	}
+	return *w.statusCache.IPAM, w.statusCache.Router.Name, true
+}
+
+// checkIPAM shows the consensus of the peers on the IPAM ring: how the
+// range is split between them, and whether the owners are reachable.
+func (w *Weave) checkIPAM(req xfer.Request) xfer.Response {
+	ipam, _, ok := w.ipam()
+	if !ok {
+		return xfer.ResponseErrorf("Weave Net IPAM is not running")
+	}
+
+	consensus := []report.Row{
+		{ID: "status", Entries: map[string]string{"label": "Status", "value": getIPAMStatus(ipam)}},
+		{ID: "range", Entries: map[string]string{"label": "Range", "value": ipam.Range}},
+		{ID: "pending", Entries: map[string]string{"label": "Pending Allocations", "value": fmt.Sprintf("%d", len(ipam.PendingAllocates))}},
+	}
+	if ipam.Paxos != nil {
+		consensus = append(consensus, report.Row{ID: "quorum", Entries: map[string]string{
+			"label": "Quorum",
+			"value": fmt.Sprintf("%d of %d known peers", ipam.Paxos.Quorum, ipam.Paxos.KnownNodes),
+		}})
+	}
+
+	var owners []report.Row
+	for _, owner := range getIPAMOwners(ipam) {
+		reachable := "no"
+		if owner.reachable {
+			reachable = "yes"
+		}
+		owners = append(owners, report.Row{
+			ID: owner.peer,
+			Entries: map[string]string{
+				"peer":      owner.String(),
+				"reachable": reachable,
+				"addresses": fmt.Sprintf("%d", owner.size),
+				"share":     owner.share(),
+			},
+		})
+	}
+
+	return xfer.Response{
+		Value: IPAMInspection{Tables: []report.Table{
+			{ID: IPAMConsensusTable, Label: "IPAM consensus", Type: report.PropertyListType, Rows: consensus},
+			{ID: IPAMOwnersTable, Label: "IP ranges by peer", Type: report.MulticolumnTableType, Columns: ipamOwnersColumns, Rows: owners},
+		}},
+	}
+}
+
+// repairIPAM reclaims the ranges owned by unreachable peers, as weave rmpeer
+// does. Peers must only be removed once gone for good, or addresses may be
+// allocated twice.
+func (w *Weave) repairIPAM(req xfer.Request) xfer.Response {
+	ipam, name, ok := w.ipam()
+	if !ok {
+		return xfer.ResponseErrorf("Weave Net IPAM is not running")
+	}
+
+	var rows []report.Row
+	for _, owner := range getIPAMOwners(ipam) {
+		if owner.reachable || owner.size == 0 || owner.peer == name {
+			continue
+		}
+		result, err := w.client.RemovePeer(owner.peer)
+		if err != nil {
+			log.Errorf("Error removing weave peer %s: %v", owner.peer, err)
+			result = err.Error()
+		}
+		rows = append(rows, report.Row{
+			ID:      owner.peer,
+			Entries: map[string]string{"peer": owner.String(), "result": result},
+		})
+	}
+	if len(rows) == 0 {
+		return xfer.ResponseErrorf("No IP ranges are owned by unreachable peers")
+	}
+
+	return xfer.Response{
+		Value: IPAMInspection{Tables: []report.Table{
+			{ID: IPAMRepairTable, Label: "Reclaimed IP ranges", Type: report.MulticolumnTableType, Columns: ipamRepairColumns, Rows: rows},
+		}},
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/weaveworks/common/backoff"
+	"github.com/weaveworks/scope/common/backoff"
 	"github.com/weaveworks/scope/common/weave"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/report"
@@ -26,12 +27,17 @@ const (
 	WeavePeerDiscovery                     = "weave_peer_discovery"
 	WeaveTargetCount                       = "weave_target_count"
 	WeaveConnectionCount                   = "weave_connection_count"
+	WeaveFastDPConnectionCount             = "weave_fastdp_connection_count"
+	WeaveSleeveConnectionCount             = "weave_sleeve_connection_count"
+	WeaveEncryptedConnectionCount          = "weave_encrypted_connection_count"
 	WeavePeerCount                         = "weave_peer_count"
 	WeaveTrustedSubnets                    = "weave_trusted_subnet_count"
 	WeaveIPAMTableID                       = "weave_ipam_table"
 	WeaveIPAMStatus                        = "weave_ipam_status"
 	WeaveIPAMRange                         = "weave_ipam_range"
 	WeaveIPAMDefaultSubnet                 = "weave_ipam_default_subnet"
+	WeaveIPAMAddressCount                  = "weave_ipam_address_count"
+	WeaveIPAMShare                         = "weave_ipam_share"
 	WeaveDNSTableID                        = "weave_dns_table"
 	WeaveDNSDomain                         = "weave_dns_domain"
 	WeaveDNSUpstream                       = "weave_dns_upstream"
@@ -46,10 +52,25 @@ const (
 	WeaveConnectionsConnection             = "weave_connection_connection"
 	WeaveConnectionsState                  = "weave_connection_state"
 	WeaveConnectionsInfo                   = "weave_connection_info"
+	WeaveConnectionsProtocol               = "weave_connection_protocol"
+	WeaveConnectionsEncrypted              = "weave_connection_encrypted"
 	WeaveConnectionsTablePrefix            = "weave_connections_table_"
 	WeaveConnectionsMulticolumnTablePrefix = "weave_connections_multicolumn_table_"
 )
 
+// Control IDs used by the weave integration.
+const (
+	CheckIPAM  = "weave_ipam_check"
+	RepairIPAM = "weave_ipam_repair"
+)
+
+// Protocols of the connections between peers: in the kernel, or in user
+// space when fast datapath is unavailable.
+const (
+	fastDPProtocol = "fastdp"
+	sleeveProtocol = "sleeve"
+)
+
 var (
 	containerNotRunningRE = regexp.MustCompile(`Container .* is not running\n`)
 
@@ -68,6 +89,12 @@ var (
 		WeaveConnectionCount: {ID: WeaveConnectionCount, Label: "Connections", From: report.FromLatest, Priority: 8},
 		WeavePeerCount:       {ID: WeavePeerCount, Label: "Peers", From: report.FromLatest, Priority: 7},
 		WeaveTrustedSubnets:  {ID: WeaveTrustedSubnets, Label: "Trusted Subnets", From: report.FromSets, Priority: 9},
+
+		WeaveFastDPConnectionCount:    {ID: WeaveFastDPConnectionCount, Label: "Fast Datapath", From: report.FromLatest, Priority: 10},
+		WeaveSleeveConnectionCount:    {ID: WeaveSleeveConnectionCount, Label: "Sleeve", From: report.FromLatest, Priority: 11},
+		WeaveEncryptedConnectionCount: {ID: WeaveEncryptedConnectionCount, Label: "Encrypted", From: report.FromLatest, Priority: 12},
+		WeaveIPAMAddressCount:         {ID: WeaveIPAMAddressCount, Label: "IP Addresses", From: report.FromLatest, Datatype: "number", Priority: 13},
+		WeaveIPAMShare:                {ID: WeaveIPAMShare, Label: "IP Range Share", From: report.FromLatest, Priority: 14},
 	}
 
 	weaveTableTemplates = report.TableTemplates{
@@ -123,6 +150,14 @@ var (
 					ID:    WeaveConnectionsState,
 					Label: "State",
 				},
+				{
+					ID:    WeaveConnectionsProtocol,
+					Label: "Protocol",
+				},
+				{
+					ID:    WeaveConnectionsEncrypted,
+					Label: "Encrypted",
+				},
 				{
 					ID:    WeaveConnectionsInfo,
 					Label: "Info",
@@ -145,8 +180,10 @@ var (
 // overlay -- though I'm not sure what that would look like in practice right
 // now.
 type Weave struct {
-	client weave.Client
-	hostID string
+	client          weave.Client
+	hostID          string
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
 
 	mtx         sync.RWMutex
 	statusCache weave.Status
@@ -157,20 +194,33 @@ type Weave struct {
 }
 
 // NewWeave returns a new Weave tagger based on the Weave router at
-// address. The address should be an IP or FQDN, no port.
-func NewWeave(hostID string, client weave.Client) (*Weave, error) {
+// address. The address should be an IP or FQDN, no port. If maxRetries is
+// not 0, collecting from the router is given up on after that many failed
+// retries, and onGiveUp is called with what is being collected and the
+// error. The IPAM controls are registered with handlerRegistry, if any.
+func NewWeave(hostID, probeID string, client weave.Client, handlerRegistry *controls.HandlerRegistry, maxRetries int, onGiveUp func(string) func(error)) (*Weave, error) {
 	w := &Weave{
-		client:  client,
-		hostID:  hostID,
-		psCache: map[string]weave.PSEntry{},
+		client:          client,
+		hostID:          hostID,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+		psCache:         map[string]weave.PSEntry{},
+	}
+	if handlerRegistry != nil {
+		w.registerControls()
 	}
 
 	w.backoff = backoff.New(w.status, "collecting weave status")
 	w.backoff.SetInitialBackoff(5 * time.Second)
-	go w.backoff.Start()
-
 	w.psBackoff = backoff.New(w.ps, "collecting weave ps")
 	w.psBackoff.SetInitialBackoff(10 * time.Second)
+	if maxRetries > 0 {
+		w.backoff.SetMaxRetries(maxRetries)
+		w.backoff.OnGiveUp(onGiveUp("weave status"))
+		w.psBackoff.SetMaxRetries(maxRetries)
+		w.psBackoff.OnGiveUp(onGiveUp("weave ps"))
+	}
+	go w.backoff.Start()
 	go w.psBackoff.Start()
 
 	return w, nil
@@ -183,6 +233,9 @@ func (*Weave) Name() string { return "Weave" }
 func (w *Weave) Stop() {
 	w.backoff.Stop()
 	w.psBackoff.Stop()
+	if w.handlerRegistry != nil {
+		w.deregisterControls()
+	}
 }
 
 func (w *Weave) ps() (bool, error) {
@@ -273,6 +326,9 @@ func (w *Weave) Report() (report.Report, error) {
 	r := report.MakeReport()
 	r.Container = r.Container.WithMetadataTemplates(containerMetadata)
 	r.Overlay = r.Overlay.WithMetadataTemplates(weaveMetadata).WithTableTemplates(weaveTableTemplates)
+	if w.handlerRegistry != nil {
+		r.Overlay.Controls.AddControls(ipamControls)
+	}
 
 	// We report nodes for all peers (not just the current node) to highlight peers not monitored by Scope
 	// (i.e. without a running probe)
@@ -286,6 +342,16 @@ func (w *Weave) Report() (report.Report, error) {
 			report.MakeNode(report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, w.statusCache.Router.Name)).
 				WithSet(host.LocalNetworks, report.MakeStringSet(w.statusCache.IPAM.DefaultSubnet)),
 		)
+		// The owners of addresses which are gone are only known from the
+		// ring, and show up as unmanaged peers.
+		for _, owner := range getIPAMOwners(*w.statusCache.IPAM) {
+			r.Overlay.AddNode(report.MakeNodeWith(report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, owner.peer), map[string]string{
+				WeavePeerName:         owner.peer,
+				WeavePeerNickName:     owner.nickname,
+				WeaveIPAMAddressCount: fmt.Sprintf("%d", owner.size),
+				WeaveIPAMShare:        owner.share(),
+			}))
+		}
 	}
 	return r, nil
 }
@@ -332,6 +398,21 @@ func (w *Weave) addCurrentPeerInfo(latests map[string]string, node report.Node)
 	}
 	latests[WeaveTargetCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Targets))
 	latests[WeaveConnectionCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Connections))
+	var fastDP, sleeve, encrypted int
+	for _, conn := range w.statusCache.Router.Connections {
+		switch conn.Attrs.Name {
+		case fastDPProtocol:
+			fastDP++
+		case sleeveProtocol:
+			sleeve++
+		}
+		if conn.Attrs.Encrypted {
+			encrypted++
+		}
+	}
+	latests[WeaveFastDPConnectionCount] = fmt.Sprintf("%d", fastDP)
+	latests[WeaveSleeveConnectionCount] = fmt.Sprintf("%d", sleeve)
+	latests[WeaveEncryptedConnectionCount] = fmt.Sprintf("%d", encrypted)
 	latests[WeavePeerCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Peers))
 	node = node.WithSet(WeaveTrustedSubnets, report.MakeStringSet(w.statusCache.Router.TrustedSubnets...))
 	if w.statusCache.IPAM != nil {
@@ -366,6 +447,10 @@ func (w *Weave) addCurrentPeerInfo(latests map[string]string, node report.Node)
 	}
 	node = node.AddPrefixMulticolumnTable(WeaveConnectionsMulticolumnTablePrefix, getConnectionsTable(w.statusCache.Router))
 	node = node.WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(w.hostID)))
+	if w.handlerRegistry != nil {
+		latests[report.ControlProbeID] = w.probeID
+		node = node.WithLatestActiveControls(CheckIPAM, RepairIPAM)
+	}
 
 	return latests, node
 }
@@ -375,17 +460,23 @@ func getConnectionsTable(router weave.Router) []report.Row {
 		outboundArrow = "->"
 		inboundArrow  = "<-"
 	)
-	table := make([]report.Row, len(router.Connections))
+	table := make([]report.Row, 0, len(router.Connections))
 	for _, conn := range router.Connections {
 		arrow := inboundArrow
 		if conn.Outbound {
 			arrow = outboundArrow
 		}
+		encrypted := "no"
+		if conn.Attrs.Encrypted {
+			encrypted = "yes"
+		}
 		table = append(table, report.Row{
 			ID: conn.Address,
 			Entries: map[string]string{
 				WeaveConnectionsConnection: fmt.Sprintf("%s %s", arrow, conn.Address),
 				WeaveConnectionsState:      conn.State,
+				WeaveConnectionsProtocol:   conn.Attrs.Name,
+				WeaveConnectionsEncrypted:  encrypted,
 				WeaveConnectionsInfo:       conn.Info,
 			},
 		})
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/overlay"
@@ -15,18 +17,24 @@ import (
 
 const (
 	mockHostID               = "host1"
+	mockProbeID              = "probe1"
 	mockContainerIPWithScope = ";" + weave.MockContainerIP
 )
 
+// handlerRegistry has the controls of the Weave of the running test
+var handlerRegistry *controls.HandlerRegistry
+
 func runTest(t *testing.T, f func(*overlay.Weave)) {
-	w, err := overlay.NewWeave(mockHostID, weave.MockClient{})
+	handlerRegistry = controls.NewDefaultHandlerRegistry()
+	w, err := overlay.NewWeave(mockHostID, mockProbeID, weave.MockClient{}, handlerRegistry, 0, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer w.Stop()
 
-	// Wait until the reporter reports some nodes
-	test.Poll(t, 300*time.Millisecond, 1, func() interface{} {
+	// Wait until the reporter reports the peer, and the unreachable owner
+	// of the IPAM range
+	test.Poll(t, 300*time.Millisecond, 2, func() interface{} {
 		have, _ := w.Report()
 		return len(have.Overlay.Nodes)
 	})
@@ -120,3 +128,86 @@ func TestOverlayTopology(t *testing.T) {
 
 	runTest(t, test)
 }
+
+func TestOverlayPeerConnections(t *testing.T) {
+	test := func(w *overlay.Weave) {
+		have, err := w.Report()
+		if err != nil {
+			t.Fatal(err)
+		}
+		node := have.Overlay.Nodes[report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, weave.MockWeavePeerName)]
+		for key, want := range map[string]string{
+			overlay.WeaveFastDPConnectionCount:    "1",
+			overlay.WeaveSleeveConnectionCount:    "0",
+			overlay.WeaveEncryptedConnectionCount: "1",
+			report.ControlProbeID:                 mockProbeID,
+		} {
+			if have, ok := node.Latest.Lookup(key); !ok || have != want {
+				t.Errorf("Expected %s %q, got %q", key, want, have)
+			}
+		}
+	}
+
+	runTest(t, test)
+}
+
+func TestOverlayIPAMOwners(t *testing.T) {
+	test := func(w *overlay.Weave) {
+		have, err := w.Report()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The owner of the whole range isn't a peer of the router
+		node, ok := have.Overlay.Nodes[report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, weave.MockLostPeerName)]
+		if !ok {
+			t.Fatalf("Expected a node for the unreachable peer %q", weave.MockLostPeerName)
+		}
+		for key, want := range map[string]string{
+			overlay.WeavePeerNickName:     weave.MockLostPeerNickName,
+			overlay.WeaveIPAMAddressCount: "524288",
+			overlay.WeaveIPAMShare:        "100.0%",
+		} {
+			if have, ok := node.Latest.Lookup(key); !ok || have != want {
+				t.Errorf("Expected %s %q, got %q", key, want, have)
+			}
+		}
+		if _, ok := node.Latest.Lookup(report.HostNodeID); ok {
+			t.Errorf("Expected the unreachable peer not to be on a host")
+		}
+	}
+
+	runTest(t, test)
+}
+
+func TestIPAMControls(t *testing.T) {
+	test := func(w *overlay.Weave) {
+		nodeID := report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, weave.MockWeavePeerName)
+
+		resp := handlerRegistry.HandleControlRequest(xfer.Request{NodeID: nodeID, Control: overlay.CheckIPAM})
+		if resp.Error != "" {
+			t.Fatal(resp.Error)
+		}
+		inspection, ok := resp.Value.(overlay.IPAMInspection)
+		if !ok || len(inspection.Tables) != 2 {
+			t.Fatalf("Expected the consensus and owners tables, got %v", resp.Value)
+		}
+		owners := inspection.Tables[1]
+		if len(owners.Rows) != 2 || owners.Rows[0].ID != weave.MockLostPeerName || owners.Rows[0].Entries["reachable"] != "no" {
+			t.Errorf("Expected the unreachable peer to own the range, got %v", owners.Rows)
+		}
+
+		resp = handlerRegistry.HandleControlRequest(xfer.Request{NodeID: nodeID, Control: overlay.RepairIPAM})
+		if resp.Error != "" {
+			t.Fatal(resp.Error)
+		}
+		inspection, ok = resp.Value.(overlay.IPAMInspection)
+		if !ok || len(inspection.Tables) != 1 || len(inspection.Tables[0].Rows) != 1 {
+			t.Fatalf("Expected the range of the unreachable peer reclaimed, got %v", resp.Value)
+		}
+		if have, want := inspection.Tables[0].Rows[0].Entries["result"], "524288 IPs taken over from "+weave.MockLostPeerName; have != want {
+			t.Errorf("Expected %q, got %q", want, have)
+		}
+	}
+
+	runTest(t, test)
+}
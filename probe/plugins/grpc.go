@@ -0,0 +1,235 @@
+package plugins
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/weaveworks/scope/common/backoff"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+//go:generate protoc --go_out=plugins=grpc:. plugin.proto
+
+// Version 2 of the plugin API is the gRPC service of plugin.proto, served on a
+// unix socket whose name ends in ".grpc". Instead of being polled for whole
+// reports, v2 plugins push report deltas down a stream for as long as the
+// probe stays subscribed. Reports and control responses are carried JSON
+// encoded, so plugins share their format with v1 plugins. Sockets with any
+// other name are v1 plugins, which are still polled over HTTP.
+const (
+	// GRPCAPIVersion is the API version v2 plugins must report in their spec.
+	GRPCAPIVersion   = "2"
+	grpcSocketSuffix = ".grpc"
+)
+
+// Exposed for testing
+var (
+	grpcDialer = func(socket string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", socket, timeout)
+	}
+	grpcInitialBackoff = 1 * time.Second
+)
+
+// NewReportDelta encodes a report into a ReportDelta, for v2 plugins to send.
+func NewReportDelta(rpt report.Report) (*ReportDelta, error) {
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(rpt); err != nil {
+		return nil, err
+	}
+	return &ReportDelta{Report: buf}, nil
+}
+
+// NewControlResponse encodes the response of a v2 plugin to a control.
+func NewControlResponse(res PluginResponse) (*ControlResponse, error) {
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(res); err != nil {
+		return nil, err
+	}
+	return &ControlResponse{Response: buf}, nil
+}
+
+// grpcStream holds the state of the subscription to a v2 plugin.
+type grpcStream struct {
+	conn    *grpc.ClientConn
+	client  PluginClient
+	publish func(report.Report)
+
+	sync.Mutex
+	spec   *xfer.PluginSpec
+	latest report.Report
+	err    error
+}
+
+// NewGRPCPlugin connects to a v2 plugin and subscribes to its reports,
+// resubscribing with backoff whenever the stream breaks. Shortcut deltas are
+// passed to publish.
+func NewGRPCPlugin(ctx context.Context, socket string, handshakeMetadata map[string]string, publish func(report.Report)) (*Plugin, error) {
+	id := strings.TrimSuffix(filepath.Base(socket), grpcSocketSuffix)
+	if !validPluginName.MatchString(id) {
+		return nil, fmt.Errorf("invalid plugin id %q", id)
+	}
+
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithDialer(grpcDialer),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	plugin := &Plugin{
+		PluginSpec:         xfer.PluginSpec{ID: id, Label: id},
+		context:            ctx,
+		socket:             socket,
+		expectedAPIVersion: GRPCAPIVersion,
+		cancel:             cancel,
+		stream: &grpcStream{
+			conn:    conn,
+			client:  NewPluginClient(conn),
+			publish: publish,
+			latest:  report.MakeReport(),
+			err:     fmt.Errorf("not subscribed yet"),
+		},
+	}
+	plugin.backoff = backoff.New(func() (bool, error) {
+		err := plugin.subscribe(handshakeMetadata)
+		if plugin.context.Err() != nil {
+			return true, nil
+		}
+		plugin.stream.Lock()
+		plugin.stream.err = err
+		plugin.stream.Unlock()
+		return false, err
+	}, fmt.Sprintf("subscribing to plugin %s", id))
+	plugin.backoff.SetInitialBackoff(grpcInitialBackoff)
+	go plugin.backoff.StartWithContext(ctx)
+	return plugin, nil
+}
+
+// subscribe does the handshake with a v2 plugin, subscribes to the
+// topologies it reports and applies the deltas it sends, until the stream
+// breaks.
+func (p *Plugin) subscribe(handshakeMetadata map[string]string) error {
+	handshakeCtx, cancel := context.WithTimeout(p.context, pluginTimeout)
+	defer cancel()
+	handshake, err := p.stream.client.Handshake(handshakeCtx, &HandshakeRequest{Metadata: handshakeMetadata})
+	if err != nil {
+		return err
+	}
+	spec := handshake.GetSpec()
+	if spec.GetId() != p.PluginSpec.ID {
+		return fmt.Errorf("plugin must not change its id (is %q, should be %q)", spec.GetId(), p.PluginSpec.ID)
+	}
+	topologies := handshake.GetTopologies()
+	if err := checkTopologies(topologies); err != nil {
+		return err
+	}
+
+	stream, err := p.stream.client.Subscribe(p.context, &SubscribeRequest{Topologies: topologies})
+	if err != nil {
+		return err
+	}
+
+	pluginSpec := xfer.PluginSpec{
+		ID:          spec.GetId(),
+		Label:       spec.GetLabel(),
+		Description: spec.GetDescription(),
+		Interfaces:  spec.GetInterfaces(),
+		APIVersion:  spec.GetApiVersion(),
+	}
+	p.stream.Lock()
+	p.stream.spec = &pluginSpec
+	p.stream.latest = report.MakeReport()
+	p.stream.err = nil
+	p.stream.Unlock()
+	for {
+		delta, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		rpt := report.MakeReport()
+		if err := codec.NewDecoderBytes(delta.GetReport(), &codec.JsonHandle{}).Decode(&rpt); err != nil {
+			return fmt.Errorf("invalid report delta: %v", err)
+		}
+		rpt = onlyTopologies(rpt, topologies)
+		p.stream.Lock()
+		if delta.GetReset_() {
+			p.stream.latest = rpt
+		} else {
+			p.stream.latest = p.stream.latest.Merge(rpt)
+		}
+		p.stream.Unlock()
+		if delta.GetShortcut() && p.stream.publish != nil {
+			rpt.Plugins = xfer.MakePluginSpecs(pluginSpec)
+			p.stream.publish(rpt)
+		}
+	}
+}
+
+// checkTopologies checks a v2 plugin reports any topologies, and only known
+// ones.
+func checkTopologies(topologies []string) error {
+	if len(topologies) == 0 {
+		return fmt.Errorf("plugin reports no topologies")
+	}
+	rpt := report.MakeReport()
+	known := rpt.TopologyMap()
+	for _, name := range topologies {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("plugin reports unknown topology %q", name)
+		}
+	}
+	return nil
+}
+
+// onlyTopologies gives a report of the given topologies of rpt, dropping
+// those plugins send without having been subscribed to.
+func onlyTopologies(rpt report.Report, topologies []string) report.Report {
+	result := report.MakeReport()
+	from, to := rpt.TopologyMap(), result.TopologyMap()
+	for _, name := range topologies {
+		*to[name] = *from[name]
+	}
+	return result
+}
+
+// streamedReport gives the report accumulated from the deltas sent by a v2
+// plugin.
+func (p *Plugin) streamedReport() (report.Report, error) {
+	p.stream.Lock()
+	defer p.stream.Unlock()
+	if p.stream.err != nil {
+		return report.MakeReport(), p.stream.err
+	}
+	rpt := p.stream.latest.Copy()
+	rpt.Plugins = xfer.MakePluginSpecs(*p.stream.spec)
+	return rpt, nil
+}
+
+// streamedControl sends a control request to a v2 plugin.
+func (p *Plugin) streamedControl(request xfer.Request) (PluginResponse, error) {
+	ctx, cancel := context.WithTimeout(p.context, pluginTimeout)
+	defer cancel()
+	var res PluginResponse
+	out, err := p.stream.client.Control(ctx, &ControlRequest{
+		AppId:       request.AppID,
+		NodeId:      request.NodeID,
+		Control:     request.Control,
+		ControlArgs: request.ControlArgs,
+	})
+	if err != nil {
+		return res, err
+	}
+	err = codec.NewDecoderBytes(out.GetResponse(), &codec.JsonHandle{}).Decode(&res)
+	return res, err
+}
@@ -0,0 +1,160 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+type testGRPCPlugin struct {
+	deltas     chan *ReportDelta
+	subscribed chan []string
+}
+
+func (p testGRPCPlugin) Handshake(_ context.Context, req *HandshakeRequest) (*HandshakeResponse, error) {
+	return &HandshakeResponse{
+		Spec: &PluginSpec{
+			Id:         "testPlugin",
+			Label:      "testPlugin",
+			Interfaces: []string{"reporter", "controller"},
+			ApiVersion: GRPCAPIVersion,
+		},
+		Topologies: []string{report.Host},
+	}, nil
+}
+
+func (p testGRPCPlugin) Subscribe(req *SubscribeRequest, stream Plugin_SubscribeServer) error {
+	p.subscribed <- req.Topologies
+	for {
+		select {
+		case delta := <-p.deltas:
+			if err := stream.Send(delta); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (p testGRPCPlugin) Control(_ context.Context, req *ControlRequest) (*ControlResponse, error) {
+	return NewControlResponse(PluginResponse{Response: xfer.Response{Value: req.Control}})
+}
+
+func deltaWithNode(t *testing.T, id string) *ReportDelta {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(id))
+	rpt.Container.AddNode(report.MakeNode(id))
+	delta, err := NewReportDelta(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return delta
+}
+
+func TestGRPCPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpc-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "testPlugin"+grpcSocketSuffix)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pluginServer := testGRPCPlugin{deltas: make(chan *ReportDelta), subscribed: make(chan []string, 1)}
+	RegisterPluginServer(server, pluginServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	published := make(chan report.Report, 1)
+	plugin, err := NewGRPCPlugin(context.Background(), socket, nil, func(rpt report.Report) {
+		published <- rpt
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Close()
+
+	// Only the topologies the plugin reports are subscribed to, and kept
+	select {
+	case topologies := <-pluginServer.subscribed:
+		if want := []string{report.Host}; !reflect.DeepEqual(want, topologies) {
+			t.Errorf("want subscription to %v, have %v", want, topologies)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("plugin was not subscribed to")
+	}
+	pluginServer.deltas <- deltaWithNode(t, "a")
+	pluginServer.deltas <- deltaWithNode(t, "b")
+	nodes := func() interface{} {
+		rpt, err := plugin.Report()
+		if err != nil {
+			return -1
+		}
+		return len(rpt.Host.Nodes)
+	}
+	test.Poll(t, time.Second, 2, nodes)
+	if want, have := "ok", plugin.Status; want != have {
+		t.Errorf("want status %q, have %q", want, have)
+	}
+	if rpt, _ := plugin.Report(); len(rpt.Container.Nodes) != 0 {
+		t.Errorf("want no containers, which aren't subscribed to, have %v", rpt.Container.Nodes)
+	}
+
+	reset := deltaWithNode(t, "c")
+	reset.Reset_ = true
+	pluginServer.deltas <- reset
+	test.Poll(t, time.Second, 1, nodes)
+
+	shortcut := deltaWithNode(t, "d")
+	shortcut.Shortcut = true
+	pluginServer.deltas <- shortcut
+	select {
+	case rpt := <-published:
+		if _, ok := rpt.Host.Nodes["d"]; !ok {
+			t.Errorf("shortcut report is missing its node: %v", rpt.Host.Nodes)
+		}
+		if _, ok := rpt.Plugins.Lookup("testPlugin"); !ok {
+			t.Errorf("shortcut report is missing the plugin spec")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shortcut report was not published")
+	}
+
+	res := plugin.Control(xfer.Request{Control: "ping"})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if want, have := "ping", res.Value; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestCheckTopologies(t *testing.T) {
+	for _, c := range []struct {
+		topologies []string
+		ok         bool
+	}{
+		{nil, false},
+		{[]string{report.Host, report.Container}, true},
+		{[]string{report.Host, "nonesuch"}, false},
+	} {
+		if err := checkTopologies(c.topologies); (err == nil) != c.ok {
+			t.Errorf("%v: want ok %v, have %v", c.topologies, c.ok, err)
+		}
+	}
+}
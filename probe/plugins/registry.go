@@ -11,7 +11,6 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -19,8 +18,7 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
 
-	"github.com/weaveworks/common/backoff"
-	"github.com/weaveworks/common/fs"
+	"github.com/weaveworks/scope/common/backoff"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
@@ -118,13 +116,7 @@ func (r *Registry) scan() error {
 			pluginsByID[plugin.PluginSpec.ID] = plugin
 			continue
 		}
-		tr, err := transport(path, pluginTimeout)
-		if err != nil {
-			log.Warningf("plugins: error loading plugin %s: %v", path, err)
-			continue
-		}
-		client := &http.Client{Transport: tr, Timeout: pluginTimeout}
-		plugin, err := NewPlugin(r.context, path, client, r.apiVersion, r.handshakeMetadata)
+		plugin, err := r.newPlugin(path)
 		if err != nil {
 			log.Warningf("plugins: error loading plugin %s: %v", path, err)
 			continue
@@ -147,34 +139,28 @@ func (r *Registry) scan() error {
 	return nil
 }
 
-// sockets recursively finds all unix sockets under the path provided
-func (r *Registry) sockets(path string) ([]string, error) {
-	var (
-		result []string
-		statT  syscall.Stat_t
-	)
-	// TODO: use of fs.Stat (which is syscall.Stat) here makes this linux specific.
-	if err := fs.Stat(path, &statT); err != nil {
+func (r *Registry) newPlugin(path string) (*Plugin, error) {
+	if strings.HasSuffix(path, grpcSocketSuffix) {
+		return NewGRPCPlugin(r.context, path, r.handshakeMetadata, r.publishShortcut)
+	}
+	tr, err := transport(path, pluginTimeout)
+	if err != nil {
 		return nil, err
 	}
-	switch statT.Mode & syscall.S_IFMT {
-	case syscall.S_IFDIR:
-		files, err := fs.ReadDir(path)
-		if err != nil {
-			return nil, err
-		}
-		for _, file := range files {
-			fpath := filepath.Join(path, file.Name())
-			s, err := r.sockets(fpath)
-			if err != nil {
-				log.Warningf("plugins: error loading path %s: %v", fpath, err)
-			}
-			result = append(result, s...)
-		}
-	case syscall.S_IFSOCK:
-		result = append(result, path)
+	client := &http.Client{Transport: tr, Timeout: pluginTimeout}
+	return NewPlugin(r.context, path, client, r.apiVersion, r.handshakeMetadata)
+}
+
+// publishShortcut publishes a shortcut report pushed by a v2 plugin.
+func (r *Registry) publishShortcut(rpt report.Report) {
+	if r.publisher == nil {
+		return
 	}
-	return result, nil
+	r.lock.Lock()
+	r.updateAndRegisterControlsInReport(&rpt)
+	r.lock.Unlock()
+	rpt.Shortcut = true
+	r.publisher.Publish(rpt)
 }
 
 // forEach walks through all the plugins running f for each one.
@@ -207,6 +193,32 @@ func (r *Registry) Implementers(iface string, f func(p *Plugin)) {
 	})
 }
 
+// PluginStatus is the state of a plugin, for the status endpoint of the
+// probe.
+type PluginStatus struct {
+	ID          string     `json:"id"`
+	Label       string     `json:"label"`
+	Status      string     `json:"status"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Status gives the state of the plugins, with the last error of each.
+func (r *Registry) Status() []PluginStatus {
+	result := []PluginStatus{}
+	r.ForEach(func(p *Plugin) {
+		p.statusMtx.Lock()
+		defer p.statusMtx.Unlock()
+		status := PluginStatus{ID: p.ID, Label: p.Label, Status: p.Status, LastError: p.lastError}
+		if !p.lastErrorAt.IsZero() {
+			lastErrorAt := p.lastErrorAt
+			status.LastErrorAt = &lastErrorAt
+		}
+		result = append(result, status)
+	})
+	return result
+}
+
 // Name implements the Reporter interface
 func (r *Registry) Name() string { return "plugins" }
 
@@ -377,6 +389,10 @@ type Plugin struct {
 	client             *http.Client
 	cancel             context.CancelFunc
 	backoff            backoff.Interface
+	stream             *grpcStream // only set for v2 plugins
+	statusMtx          sync.Mutex  // as controls set the status concurrently
+	lastError          string
+	lastErrorAt        time.Time
 }
 
 // NewPlugin loads and initializes a new plugin. If client is nil,
@@ -417,7 +433,11 @@ func (p *Plugin) Report() (result report.Report, err error) {
 		}
 	}()
 
-	if err := p.get("/report", p.handshakeMetadata, &result); err != nil {
+	if p.stream != nil {
+		if result, err = p.streamedReport(); err != nil {
+			return result, err
+		}
+	} else if err := p.get("/report", p.handshakeMetadata, &result); err != nil {
 		return result, err
 	}
 	if result.Plugins.Size() != 1 {
@@ -453,10 +473,12 @@ func (p *Plugin) Control(request xfer.Request) (res PluginResponse) {
 		}
 	}()
 
-	if p.Implements("controller") {
-		err = p.post("/control", p.handshakeMetadata, request, &res)
-	} else {
+	if !p.Implements("controller") {
 		err = fmt.Errorf("the %s plugin does not implement the controller interface", p.PluginSpec.Label)
+	} else if p.stream != nil {
+		res, err = p.streamedControl(request)
+	} else {
+		err = p.post("/control", p.handshakeMetadata, request, &res)
 	}
 	return res
 }
@@ -472,10 +494,13 @@ func (p *Plugin) Implements(iface string) bool {
 }
 
 func (p *Plugin) setStatus(err error) {
+	p.statusMtx.Lock()
+	defer p.statusMtx.Unlock()
 	if err == nil {
 		p.Status = "ok"
 	} else {
 		p.Status = fmt.Sprintf("error: %v", err)
+		p.lastError, p.lastErrorAt = err.Error(), time.Now()
 	}
 }
 
@@ -526,8 +551,13 @@ func getResult(body io.ReadCloser, result interface{}) error {
 
 // Close closes the client
 func (p *Plugin) Close() {
-	if p.backoff != nil {
+	p.cancel()
+	if p.stream != nil {
+		p.stream.conn.Close()
+		// Don't wait for the subscription to stop, as it may be blocked
+		// publishing a shortcut report on the registry we're called from.
+		go p.backoff.Stop()
+	} else if p.backoff != nil {
 		p.backoff.Stop()
 	}
-	p.cancel()
 }
@@ -0,0 +1,41 @@
+// +build !windows
+
+package plugins
+
+import (
+	"path/filepath"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/fs"
+)
+
+// sockets recursively finds all unix sockets under the path provided
+func (r *Registry) sockets(path string) ([]string, error) {
+	var (
+		result []string
+		statT  syscall.Stat_t
+	)
+	if err := fs.Stat(path, &statT); err != nil {
+		return nil, err
+	}
+	switch statT.Mode & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		files, err := fs.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			fpath := filepath.Join(path, file.Name())
+			s, err := r.sockets(fpath)
+			if err != nil {
+				log.Warningf("plugins: error loading path %s: %v", fpath, err)
+			}
+			result = append(result, s...)
+		}
+	case syscall.S_IFSOCK:
+		result = append(result, path)
+	}
+	return result, nil
+}
@@ -0,0 +1,7 @@
+package plugins
+
+// sockets finds no plugins on Windows, where the probe doesn't look for unix
+// sockets.
+func (r *Registry) sockets(path string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,129 @@
+package podman
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+const (
+	// libpod API version we speak; all podman service versions accept it.
+	apiVersion    = "v1.0.0"
+	clientTimeout = 30 * time.Second
+)
+
+// Container is a container, as listed by the libpod API.
+type Container struct {
+	ID        string            `json:"Id"`
+	Names     []string          `json:"Names"`
+	Image     string            `json:"Image"`
+	ImageID   string            `json:"ImageID"`
+	Command   []string          `json:"Command"`
+	State     string            `json:"State"`
+	Labels    map[string]string `json:"Labels"`
+	PID       int               `json:"Pid"`
+	Pod       string            `json:"Pod"`
+	PodName   string            `json:"PodName"`
+	StartedAt int64             `json:"StartedAt"`
+	// Created is a unix timestamp with podman 2, and RFC3339 since podman 3.
+	Created interface{} `json:"Created"`
+}
+
+// CreatedAt gives the time the container was created at.
+func (c Container) CreatedAt() (time.Time, bool) {
+	switch created := c.Created.(type) {
+	case int64:
+		return time.Unix(created, 0), true
+	case uint64:
+		return time.Unix(int64(created), 0), true
+	case float64:
+		return time.Unix(int64(created), 0), true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, created)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// Client talks to one podman service. Exposed for testing.
+type Client interface {
+	ListContainers() ([]Container, error)
+	StartContainer(id string) error
+	StopContainer(id string, timeout time.Duration) error
+	RestartContainer(id string, timeout time.Duration) error
+}
+
+type client struct {
+	http *http.Client
+}
+
+// NewClient makes a Client of the libpod API served on socket, by the
+// system or a (rootless) user's podman service.
+func NewClient(socket string) Client {
+	return &client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				Dial: func(_, _ string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+			Timeout: clientTimeout,
+		},
+	}
+}
+
+func (c *client) do(method, path string, query url.Values, result interface{}) error {
+	u := fmt.Sprintf("http://podman/%s/libpod%s?%s", apiVersion, path, query.Encode())
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	// 304 is "already started/stopped", which is fine by us
+	case resp.StatusCode == http.StatusNotModified:
+		return nil
+	case resp.StatusCode >= 300:
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("podman returned %s", resp.Status)
+		}
+		return fmt.Errorf("podman returned %s: %s", resp.Status, apiErr.Message)
+	case result != nil:
+		return codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(result)
+	}
+	return nil
+}
+
+func (c *client) ListContainers() ([]Container, error) {
+	var containers []Container
+	err := c.do("GET", "/containers/json", url.Values{"all": {"true"}}, &containers)
+	return containers, err
+}
+
+func (c *client) StartContainer(id string) error {
+	return c.do("POST", "/containers/"+url.PathEscape(id)+"/start", nil, nil)
+}
+
+func timeoutParam(timeout time.Duration) url.Values {
+	return url.Values{"t": {fmt.Sprint(int(timeout / time.Second))}}
+}
+
+func (c *client) StopContainer(id string, timeout time.Duration) error {
+	return c.do("POST", "/containers/"+url.PathEscape(id)+"/stop", timeoutParam(timeout), nil)
+}
+
+func (c *client) RestartContainer(id string, timeout time.Duration) error {
+	return c.do("POST", "/containers/"+url.PathEscape(id)+"/restart", timeoutParam(timeout), nil)
+}
@@ -0,0 +1,74 @@
+package podman
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.0.0/libpod/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		w.Write([]byte(`[{"Id":"abc","Names":["web"],"State":"running","Created":1590000000,"Labels":{"a":"b"},"Pid":42}]`))
+	})
+	mux.HandleFunc("/v1.0.0/libpod/containers/abc/stop", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("/v1.0.0/libpod/containers/missing/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"cause":"no such container","message":"no container with name or ID missing found"}`))
+	})
+	go http.Serve(listener, mux)
+
+	client := NewClient(socket)
+	containers, err := client.ListContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("Expected 1 container, got %v", containers)
+	}
+	c := containers[0]
+	if c.ID != "abc" || c.PID != 42 || !reflect.DeepEqual(c.Labels, map[string]string{"a": "b"}) {
+		t.Errorf("Unexpected container %+v", c)
+	}
+	if created, ok := c.CreatedAt(); !ok || !created.Equal(time.Unix(1590000000, 0)) {
+		t.Errorf("Unexpected creation time %v", created)
+	}
+
+	// Already stopped is fine
+	if err := client.StopContainer("abc", 5*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := client.StartContainer("missing"); err == nil || err.Error() != "podman returned 404 Not Found: no container with name or ID missing found" {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	want := []string{
+		"GET /v1.0.0/libpod/containers/json?all=true",
+		"POST /v1.0.0/libpod/containers/abc/stop?t=5",
+	}
+	if !reflect.DeepEqual(want, requests) {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+}
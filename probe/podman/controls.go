@@ -0,0 +1,68 @@
+package podman
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the podman integration.
+const (
+	StartContainer   = "podman_start_container"
+	StopContainer    = "podman_stop_container"
+	RestartContainer = "podman_restart_container"
+
+	stopTimeout = 10 * time.Second
+)
+
+func (r *Reporter) startContainer(client Client, containerID string) xfer.Response {
+	log.Infof("Starting podman container %s", containerID)
+	return xfer.ResponseError(client.StartContainer(containerID))
+}
+
+func (r *Reporter) stopContainer(client Client, containerID string) xfer.Response {
+	log.Infof("Stopping podman container %s", containerID)
+	return xfer.ResponseError(client.StopContainer(containerID, stopTimeout))
+}
+
+func (r *Reporter) restartContainer(client Client, containerID string) xfer.Response {
+	log.Infof("Restarting podman container %s", containerID)
+	return xfer.ResponseError(client.RestartContainer(containerID, stopTimeout))
+}
+
+// captureContainer finds the podman service which owns the container of a
+// control request.
+func (r *Reporter) captureContainer(f func(Client, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		containerID, ok := report.ParseContainerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		client, ok := r.owner(containerID)
+		if !ok {
+			return xfer.ResponseErrorf("Not found: %s", containerID)
+		}
+		return f(client, containerID)
+	}
+}
+
+func (r *Reporter) registerControls() {
+	controls := map[string]xfer.ControlHandlerFunc{
+		StartContainer:   r.captureContainer(r.startContainer),
+		StopContainer:    r.captureContainer(r.stopContainer),
+		RestartContainer: r.captureContainer(r.restartContainer),
+	}
+	r.handlerRegistry.Batch(nil, controls)
+}
+
+func (r *Reporter) deregisterControls() {
+	controls := []string{
+		StartContainer,
+		StopContainer,
+		RestartContainer,
+	}
+	r.handlerRegistry.Batch(controls, nil)
+}
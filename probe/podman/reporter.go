@@ -0,0 +1,236 @@
+package podman
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest. Everything podman and docker containers have
+// in common uses the docker keys, so that containers from either render the
+// same way.
+const (
+	ContainerUser    = "podman_user"
+	ContainerPodName = "podman_pod_name"
+)
+
+// DefaultSockets are where the system podman service and the rootless
+// services of users listen.
+var DefaultSockets = []string{
+	"/run/podman/podman.sock",
+	"/run/user/*/podman/podman.sock",
+}
+
+// Exposed for testing
+var (
+	ContainerMetadataTemplates = docker.RuntimeContainerMetadataTemplates.Merge(report.MetadataTemplates{
+		docker.ContainerCommand: {ID: docker.ContainerCommand, Label: "Command", From: report.FromLatest, Priority: 2},
+		docker.ContainerUptime:  {ID: docker.ContainerUptime, Label: "Uptime", From: report.FromLatest, Priority: 4},
+		ContainerUser:           {ID: ContainerUser, Label: "Rootless user", From: report.FromLatest, Priority: 5},
+		ContainerPodName:        {ID: ContainerPodName, Label: "Pod", From: report.FromLatest, Priority: 6},
+	})
+
+	ContainerTableTemplates = docker.RuntimeContainerTableTemplates
+
+	ContainerControls = []report.Control{
+		{
+			ID:    StartContainer,
+			Human: "Start",
+			Icon:  "fa-play",
+			Rank:  3,
+		},
+		{
+			ID:    RestartContainer,
+			Human: "Restart",
+			Icon:  "fa-repeat",
+			Rank:  4,
+		},
+		{
+			ID:    StopContainer,
+			Human: "Stop",
+			Icon:  "fa-stop",
+			Rank:  7,
+		},
+	}
+
+	rootlessSocket = regexp.MustCompile(`/run/user/(\d+)/`)
+)
+
+// Reporter generates Reports containing the Container and ContainerImage
+// topologies of every podman service it finds a socket of.
+type Reporter struct {
+	sockets         []string
+	newClient       func(socket string) Client
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
+
+	sync.Mutex
+	clients map[string]Client // socket -> client
+	owners  map[string]Client // container ID -> client, as of the last report
+}
+
+// NewReporter makes a new Reporter, which looks for podman services on the
+// sockets matching the glob patterns in sockets.
+func NewReporter(sockets []string, newClient func(socket string) Client, probeID string, handlerRegistry *controls.HandlerRegistry) *Reporter {
+	reporter := &Reporter{
+		sockets:         sockets,
+		newClient:       newClient,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+		clients:         map[string]Client{},
+		owners:          map[string]Client{},
+	}
+	reporter.registerControls()
+	return reporter
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Podman" }
+
+// Stop unregisters controls.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+}
+
+// discover updates the clients with the sockets which currently exist, as
+// users' podman services come and go.
+func (r *Reporter) discover() map[string]Client {
+	r.Lock()
+	defer r.Unlock()
+	clients := map[string]Client{}
+	for _, pattern := range r.sockets {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Warnf("podman: bad socket pattern %q: %v", pattern, err)
+			continue
+		}
+		for _, socket := range matches {
+			if c, ok := r.clients[socket]; ok {
+				clients[socket] = c
+			} else {
+				clients[socket] = r.newClient(socket)
+			}
+		}
+	}
+	r.clients = clients
+	return clients
+}
+
+func (r *Reporter) owner(containerID string) (Client, bool) {
+	r.Lock()
+	defer r.Unlock()
+	c, ok := r.owners[containerID]
+	return c, ok
+}
+
+// Report generates a Report containing Container and ContainerImage topologies
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.Container = result.Container.
+		WithMetadataTemplates(ContainerMetadataTemplates).
+		WithTableTemplates(ContainerTableTemplates)
+	result.Container.Controls.AddControls(ContainerControls)
+	result.ContainerImage = result.ContainerImage.
+		WithMetadataTemplates(docker.ContainerImageMetadataTemplates)
+
+	owners := map[string]Client{}
+	for socket, client := range r.discover() {
+		containers, err := client.ListContainers()
+		if err != nil {
+			log.Warnf("podman: error listing containers on %s: %v", socket, err)
+			continue
+		}
+		user := ""
+		if m := rootlessSocket.FindStringSubmatch(socket); m != nil {
+			user = m[1]
+		}
+		for _, c := range containers {
+			owners[c.ID] = client
+			result.Container.AddNode(r.containerNode(c, user))
+			if c.ImageID != "" {
+				result.ContainerImage.AddNode(report.MakeNodeWith(report.MakeContainerImageNodeID(c.ImageID), map[string]string{
+					docker.ImageID:   c.ImageID,
+					docker.ImageName: c.Image,
+				}))
+			}
+		}
+	}
+
+	r.Lock()
+	r.owners = owners
+	r.Unlock()
+	return result, nil
+}
+
+func (r *Reporter) containerNode(c Container, user string) report.Node {
+	name := c.ID
+	if len(c.Names) > 0 {
+		name = c.Names[0]
+	}
+	latest := map[string]string{
+		docker.ContainerID:         c.ID,
+		docker.ContainerName:       name,
+		docker.ContainerCommand:    strings.Join(c.Command, " "),
+		docker.ContainerState:      containerState(c.State),
+		docker.ContainerStateHuman: strings.Title(c.State),
+		report.ControlProbeID:      r.probeID,
+	}
+	if created, ok := c.CreatedAt(); ok {
+		latest[docker.ContainerCreated] = created.UTC().Format(time.RFC3339Nano)
+	}
+	if c.State == "running" && c.StartedAt > 0 {
+		uptime := (mtime.Now().Sub(time.Unix(c.StartedAt, 0)) / time.Second) * time.Second
+		latest[docker.ContainerUptime] = uptime.String()
+	}
+	if user != "" {
+		latest[ContainerUser] = user
+	}
+	if c.PodName != "" {
+		latest[ContainerPodName] = c.PodName
+	}
+
+	node := report.MakeNodeWith(report.MakeContainerNodeID(c.ID), latest)
+	if c.ImageID != "" {
+		node = node.WithLatests(map[string]string{
+			docker.ImageID:   c.ImageID,
+			docker.ImageName: c.Image,
+		}).WithParents(report.MakeSets().
+			Add(report.ContainerImage, report.MakeStringSet(report.MakeContainerImageNodeID(c.ImageID))),
+		)
+	}
+	node = node.AddPrefixPropertyList(docker.LabelPrefix, c.Labels)
+	return node.WithLatestControls(controlsMap(latest[docker.ContainerState]))
+}
+
+// containerState maps libpod container states to the docker container
+// states.
+func containerState(state string) string {
+	switch state {
+	case "running":
+		return docker.StateRunning
+	case "paused":
+		return docker.StatePaused
+	case "exited", "stopped":
+		return docker.StateExited
+	default:
+		return docker.StateCreated
+	}
+}
+
+func controlsMap(state string) map[string]report.NodeControlData {
+	running := state == docker.StateRunning
+	return map[string]report.NodeControlData{
+		StartContainer:   {Dead: running || state == docker.StatePaused},
+		RestartContainer: {Dead: !running},
+		StopContainer:    {Dead: !running},
+	}
+}
@@ -0,0 +1,160 @@
+package podman_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/podman"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	containers []podman.Container
+	calls      []string
+}
+
+func (c *mockClient) ListContainers() ([]podman.Container, error) { return c.containers, nil }
+
+func (c *mockClient) StartContainer(id string) error {
+	c.calls = append(c.calls, "start "+id)
+	return nil
+}
+
+func (c *mockClient) StopContainer(id string, _ time.Duration) error {
+	c.calls = append(c.calls, "stop "+id)
+	return nil
+}
+
+func (c *mockClient) RestartContainer(id string, _ time.Duration) error {
+	c.calls = append(c.calls, "restart "+id)
+	return nil
+}
+
+// setupSockets makes a fake system socket and a rootless one for user 1000,
+// under a temporary root.
+func setupSockets(t *testing.T) (string, []string) {
+	root, err := ioutil.TempDir("", "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, socket := range []string{"run/podman/podman.sock", "run/user/1000/podman/podman.sock"} {
+		path := filepath.Join(root, socket)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	patterns := []string{}
+	for _, pattern := range podman.DefaultSockets {
+		patterns = append(patterns, filepath.Join(root, pattern))
+	}
+	return root, patterns
+}
+
+func TestReporter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	root, patterns := setupSockets(t)
+	defer os.RemoveAll(root)
+	clients := map[string]*mockClient{
+		filepath.Join(root, "run/podman/podman.sock"): {containers: []podman.Container{{
+			ID:        "sys1",
+			Names:     []string{"nginx"},
+			Image:     "docker.io/library/nginx:latest",
+			ImageID:   "img1",
+			Command:   []string{"nginx", "-g", "daemon off;"},
+			State:     "running",
+			StartedAt: now.Add(-time.Minute).Unix(),
+			Created:   "2020-06-01T11:00:00Z",
+			Labels:    map[string]string{"app": "web"},
+		}}},
+		filepath.Join(root, "run/user/1000/podman/podman.sock"): {containers: []podman.Container{{
+			ID:      "user1",
+			Names:   []string{"toolbox"},
+			State:   "exited",
+			Created: int64(1590000000),
+			PodName: "dev",
+		}}},
+	}
+	newClient := func(socket string) podman.Client {
+		c, ok := clients[socket]
+		if !ok {
+			t.Fatalf("Unexpected socket %s", socket)
+		}
+		return c
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := podman.NewReporter(patterns, newClient, "probe-id", hr)
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]map[string]string{
+		"sys1": {
+			docker.ContainerName:       "nginx",
+			docker.ContainerState:      docker.StateRunning,
+			docker.ContainerCommand:    "nginx -g daemon off;",
+			docker.ContainerUptime:     "1m0s",
+			docker.ContainerCreated:    "2020-06-01T11:00:00Z",
+			docker.ImageID:             "img1",
+			docker.LabelPrefix + "app": "web",
+			report.ControlProbeID:      "probe-id",
+		},
+		"user1": {
+			docker.ContainerName:    "toolbox",
+			docker.ContainerState:   docker.StateExited,
+			docker.ContainerCreated: "2020-05-20T18:40:00Z",
+			podman.ContainerUser:    "1000",
+			podman.ContainerPodName: "dev",
+		},
+	} {
+		node, ok := rpt.Container.Nodes[report.MakeContainerNodeID(id)]
+		if !ok {
+			t.Fatalf("Expected container %s", id)
+		}
+		for key, value := range want {
+			if have, _ := node.Latest.Lookup(key); value != have {
+				t.Errorf("%s: expected %s %q, got %q", id, key, value, have)
+			}
+		}
+	}
+	if user, ok := rpt.Container.Nodes[report.MakeContainerNodeID("sys1")].Latest.Lookup(podman.ContainerUser); ok {
+		t.Errorf("Expected no rootless user for a system container, got %q", user)
+	}
+	if _, ok := rpt.ContainerImage.Nodes[report.MakeContainerImageNodeID("img1")]; !ok {
+		t.Error("Expected image img1")
+	}
+
+	// Controls go to the service owning the container
+	for _, tc := range []struct{ control, id string }{
+		{podman.RestartContainer, "sys1"},
+		{podman.StopContainer, "sys1"},
+		{podman.StartContainer, "user1"},
+	} {
+		result := hr.HandleControlRequest(xfer.Request{Control: tc.control, NodeID: report.MakeContainerNodeID(tc.id)})
+		if !reflect.DeepEqual(xfer.Response{}, result) {
+			t.Errorf("%s: unexpected response %v", tc.control, result)
+		}
+	}
+	if want, have := []string{"restart sys1", "stop sys1"}, clients[filepath.Join(root, "run/podman/podman.sock")].calls; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected system calls %v, got %v", want, have)
+	}
+	if want, have := []string{"start user1"}, clients[filepath.Join(root, "run/user/1000/podman/podman.sock")].calls; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected rootless calls %v, got %v", want, have)
+	}
+}
@@ -1,29 +1,52 @@
 package probe
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/armon/go-metrics"
 
+	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
 
 const (
 	reportBufferSize = 16
+
+	// maxIntervalFactor is how many times longer than configured the
+	// intervals can get when adapting to the load of the probe.
+	maxIntervalFactor = 8
 )
 
 // Probe sits there, generating and publishing reports.
 type Probe struct {
+	publisher *appclient.ReportPublisher
+
+	mtx                          sync.Mutex
 	spyInterval, publishInterval time.Duration
-	publisher                    *appclient.ReportPublisher
+	intervalFactor               time.Duration
+	adaptive                     AdaptiveConfig
+	lastCPUTime                  time.Duration
+	lastAdapted                  time.Time
+	started                      time.Time
+	lastSpied                    time.Time
+	lastStale                    report.StringSet // of the last report spied
 
 	tickers   []Ticker
 	reporters []Reporter
 	taggers   []Tagger
 
+	pool        PoolConfig
+	workers     chan struct{} // held by running reporters and taggers; nil if unbounded
+	poolMtx     sync.Mutex
+	running     map[int]bool          // reporters, by index
+	lastReports map[int]report.Report // of reporters, for when they are late
+	lateTaggers map[int]bool
+
 	quit chan struct{}
 	done sync.WaitGroup
 
@@ -31,6 +54,26 @@ type Probe struct {
 	shortcutReports chan report.Report
 }
 
+// AdaptiveConfig says when the probe should lengthen its spy and publish
+// intervals, to generate fewer reports when they get big or expensive. The
+// intervals are doubled (up to 8 times) every publish interval that a
+// threshold is exceeded, and halved again once the probe is well under them.
+// Zero thresholds are ignored.
+type AdaptiveConfig struct {
+	MaxReportSize int     // bytes, as published
+	MaxCPU        float64 // percent of a CPU used by the probe
+}
+
+// PoolConfig bounds how many reporters and taggers run at once, and how long
+// each is waited for before the report is published without it. Late
+// reporters are not run again until they are done, and their last report is
+// published instead; late taggers leave the nodes untagged. Either way they
+// are named in the Stale reporters of the report.
+type PoolConfig struct {
+	Workers  int           // zero runs them all at once
+	Deadline time.Duration // zero is the spy interval
+}
+
 // Tagger tags nodes with value-add node metadata.
 type Tagger interface {
 	Name() string
@@ -73,8 +116,12 @@ func New(
 	result := &Probe{
 		spyInterval:     spyInterval,
 		publishInterval: publishInterval,
+		intervalFactor:  1,
 		publisher:       appclient.NewReportPublisher(publisher, noControls),
 		quit:            make(chan struct{}),
+		running:         map[int]bool{},
+		lastReports:     map[int]report.Report{},
+		lateTaggers:     map[int]bool{},
 		spiedReports:    make(chan report.Report, reportBufferSize),
 		shortcutReports: make(chan report.Report, reportBufferSize),
 	}
@@ -96,8 +143,141 @@ func (p *Probe) AddTicker(ts ...Ticker) {
 	p.tickers = append(p.tickers, ts...)
 }
 
+// SetAdaptiveConfig makes the probe adapt its intervals to its load.
+func (p *Probe) SetAdaptiveConfig(config AdaptiveConfig) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.adaptive = config
+}
+
+// SetPoolConfig bounds the reporters and taggers run at once, and how long
+// they are waited for. It must be called before Start.
+func (p *Probe) SetPoolConfig(config PoolConfig) {
+	p.pool = config
+	p.workers = nil
+	if config.Workers > 0 {
+		p.workers = make(chan struct{}, config.Workers)
+	}
+}
+
+// SetCompression sets how the probe compresses the reports it publishes. It
+// must be called before Start.
+func (p *Probe) SetCompression(config appclient.CompressionConfig) {
+	p.publisher.SetCompression(config)
+}
+
+// SetMaxReportSize sets the size budget of the reports the probe publishes,
+// leaving topologies out of the ones over it. It must be called before
+// Start.
+func (p *Probe) SetMaxReportSize(maxSize int) {
+	p.publisher.SetMaxSize(maxSize)
+}
+
+// SetIntervals changes the spy and publish intervals of the probe, from the
+// next tick. Zero intervals are left as they are.
+func (p *Probe) SetIntervals(spyInterval, publishInterval time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if spyInterval > 0 {
+		p.spyInterval = spyInterval
+	}
+	if publishInterval > 0 {
+		p.publishInterval = publishInterval
+	}
+	log.Infof("Spy interval %v, publish interval %v", p.spyInterval, p.publishInterval)
+}
+
+// intervals gives the spy and publish intervals, lengthened by adaptation.
+func (p *Probe) intervals() (time.Duration, time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.spyInterval * p.intervalFactor, p.publishInterval * p.intervalFactor
+}
+
+// RegisterControls registers the xfer.SetProbeIntervalsControl control, so
+// that apps can change the intervals of the probe.
+func (p *Probe) RegisterControls(handlerRegistry *controls.HandlerRegistry) {
+	handlerRegistry.Register(xfer.SetProbeIntervalsControl, p.setIntervals)
+}
+
+func (p *Probe) setIntervals(req xfer.Request) xfer.Response {
+	var intervals [2]time.Duration
+	for i, arg := range []string{"spy_interval", "publish_interval"} {
+		value, ok := req.ControlArgs[arg]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return xfer.ResponseErrorf("Invalid %s: %q", arg, value)
+		}
+		intervals[i] = d
+	}
+	p.SetIntervals(intervals[0], intervals[1])
+	return xfer.Response{}
+}
+
+// ProbeStatus is the state of the probe, for its status endpoint.
+type ProbeStatus struct {
+	Reporters       []string                 `json:"reporters"`
+	Taggers         []string                 `json:"taggers"`
+	Stale           []string                 `json:"stale"` // reporters and taggers late for the last report
+	SpyInterval     string                   `json:"spy_interval"`
+	PublishInterval string                   `json:"publish_interval"`
+	LastSpied       *time.Time               `json:"last_spied,omitempty"`
+	LastReportSize  int                      `json:"last_report_size"` // bytes, as published
+	Targets         []appclient.TargetStatus `json:"targets"`
+}
+
+// Targets gives the state of the connections to the apps published to.
+func (p *Probe) Targets() []appclient.TargetStatus {
+	return p.publisher.Targets()
+}
+
+// Status gives the state of the probe, and an error if it hasn't spied for
+// long enough that it must be stuck: a spy waits at most a deadline for the
+// reporters, and another for each tagger.
+func (p *Probe) Status() (interface{}, error) {
+	spyInterval, publishInterval := p.intervals()
+	status := ProbeStatus{
+		Reporters:       []string{},
+		Taggers:         []string{},
+		SpyInterval:     spyInterval.String(),
+		PublishInterval: publishInterval.String(),
+		LastReportSize:  p.publisher.LastSize(),
+		Targets:         p.publisher.Targets(),
+	}
+	for _, rep := range p.reporters {
+		status.Reporters = append(status.Reporters, rep.Name())
+	}
+	for _, tagger := range p.taggers {
+		status.Taggers = append(status.Taggers, tagger.Name())
+	}
+	if status.Targets == nil {
+		status.Targets = []appclient.TargetStatus{}
+	}
+
+	p.mtx.Lock()
+	lastSpied, started := p.lastSpied, p.started
+	status.Stale = append([]string{}, p.lastStale...)
+	p.mtx.Unlock()
+	if !lastSpied.IsZero() {
+		status.LastSpied = &lastSpied
+	} else {
+		lastSpied = started
+	}
+	stuckAfter := 2 * (spyInterval + time.Duration(1+len(p.taggers))*p.deadline())
+	if !lastSpied.IsZero() && time.Since(lastSpied) > stuckAfter {
+		return status, fmt.Errorf("no report generated for %v", time.Since(lastSpied))
+	}
+	return status, nil
+}
+
 // Start starts the probe
 func (p *Probe) Start() {
+	p.mtx.Lock()
+	p.started = time.Now()
+	p.mtx.Unlock()
 	p.done.Add(2)
 	go p.spyLoop()
 	go p.publishLoop()
@@ -118,15 +298,22 @@ func (p *Probe) Publish(rpt report.Report) {
 
 func (p *Probe) spyLoop() {
 	defer p.done.Done()
-	spyTick := time.Tick(p.spyInterval)
+	spyInterval, _ := p.intervals()
+	spyTimer := time.NewTimer(spyInterval)
+	defer spyTimer.Stop()
 
 	for {
 		select {
-		case <-spyTick:
+		case <-spyTimer.C:
+			spyInterval, _ = p.intervals()
+			spyTimer.Reset(spyInterval)
 			t := time.Now()
 			p.tick()
 			rpt := p.report()
 			rpt = p.tag(rpt)
+			p.mtx.Lock()
+			p.lastSpied, p.lastStale = time.Now(), rpt.Stale
+			p.mtx.Unlock()
 			p.spiedReports <- rpt
 			metrics.MeasureSince([]string{"Report Generaton"}, t)
 		case <-p.quit:
@@ -146,46 +333,172 @@ func (p *Probe) tick() {
 	}
 }
 
+// deadline is how long reporters and taggers are waited for, if at all.
+func (p *Probe) deadline() time.Duration {
+	if p.pool.Deadline > 0 {
+		return p.pool.Deadline
+	}
+	spyInterval, _ := p.intervals()
+	return spyInterval
+}
+
+// deadlineTimer fires once a deadline has passed, or never without one.
+func deadlineTimer(deadline time.Duration) (<-chan time.Time, func() bool) {
+	if deadline <= 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(deadline)
+	return timer.C, timer.Stop
+}
+
+// run runs f once a worker of the pool is free.
+func (p *Probe) run(f func()) {
+	go func() {
+		if p.workers != nil {
+			p.workers <- struct{}{}
+			defer func() { <-p.workers }()
+		}
+		f()
+	}()
+}
+
 func (p *Probe) report() report.Report {
-	reports := make(chan report.Report, len(p.reporters))
-	for _, rep := range p.reporters {
-		go func(rep Reporter) {
+	type reported struct {
+		index int
+		rpt   report.Report
+	}
+	var (
+		deadline = p.deadline()
+		reports  = make(chan reported, len(p.reporters))
+		started  = 0
+	)
+	p.poolMtx.Lock()
+	for i, rep := range p.reporters {
+		if p.running[i] {
+			continue // since an earlier spy
+		}
+		p.running[i] = true
+		started++
+		i, rep := i, rep
+		p.run(func() {
 			t := time.Now()
-			timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v reporter took longer than %v", rep.Name(), p.spyInterval) })
 			newReport, err := rep.Report()
-			if !timer.Stop() {
-				log.Warningf("%v reporter took %v (longer than %v)", rep.Name(), time.Now().Sub(t), p.spyInterval)
-			}
 			metrics.MeasureSince([]string{rep.Name(), "reporter"}, t)
 			if err != nil {
 				log.Errorf("error generating report: %v", err)
 				newReport = report.MakeReport() // empty is OK to merge
 			}
-			reports <- newReport
-		}(rep)
+			p.poolMtx.Lock()
+			defer p.poolMtx.Unlock()
+			if took := time.Now().Sub(t); deadline > 0 && took > deadline {
+				log.Warningf("%v reporter took %v (longer than %v)", rep.Name(), took, deadline)
+			}
+			p.running[i] = false
+			p.lastReports[i] = newReport
+			reports <- reported{i, newReport}
+		})
 	}
+	p.poolMtx.Unlock()
 
 	result := report.MakeReport()
-	for i := 0; i < cap(reports); i++ {
-		result = result.Merge(<-reports)
+	done := map[int]bool{}
+	timeout, stop := deadlineTimer(deadline)
+	defer stop()
+WaitLoop:
+	for len(done) < started {
+		select {
+		case r := <-reports:
+			done[r.index] = true
+			result = result.Merge(r.rpt)
+		case <-timeout:
+			break WaitLoop
+		}
 	}
+
+	// Fall back on the last reports of the reporters not done in time
+	p.poolMtx.Lock()
+	defer p.poolMtx.Unlock()
+	stale := []string{}
+	for i, rep := range p.reporters {
+		if done[i] {
+			continue
+		}
+		if p.running[i] {
+			log.Warningf("%v reporter is taking longer than %v, publishing its last report", rep.Name(), deadline)
+			stale = append(stale, rep.Name())
+		}
+		if last, ok := p.lastReports[i]; ok {
+			result = result.Merge(last)
+		}
+	}
+	result.Stale = result.Stale.Merge(report.MakeStringSet(stale...))
 	return result
 }
 
+// taggerInput copies the nodes of a report for a tagger to tag, so that the
+// report is left alone by taggers running late.
+func taggerInput(r report.Report) report.Report {
+	input := r
+	input.WalkPairedTopologies(&r, func(inputTopology, topology *report.Topology) {
+		*inputTopology = topology.Copy()
+	})
+	return input
+}
+
 func (p *Probe) tag(r report.Report) report.Report {
-	var err error
-	for _, tagger := range p.taggers {
-		t := time.Now()
-		timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v tagger took longer than %v", tagger.Name(), p.spyInterval) })
-		r, err = tagger.Tag(r)
-		if !timer.Stop() {
-			log.Warningf("%v tagger took %v (longer than %v)", tagger.Name(), time.Now().Sub(t), p.spyInterval)
+	type tagged struct {
+		rpt report.Report
+		err error
+	}
+	deadline := p.deadline()
+	stale := []string{}
+	for i, tagger := range p.taggers {
+		p.poolMtx.Lock()
+		late := p.lateTaggers[i]
+		p.poolMtx.Unlock()
+		if late {
+			stale = append(stale, tagger.Name())
+			continue
 		}
-		metrics.MeasureSince([]string{tagger.Name(), "tagger"}, t)
-		if err != nil {
-			log.Errorf("error applying tagger: %v", err)
+
+		i, tagger, input := i, tagger, taggerInput(r)
+		results := make(chan tagged, 1)
+		p.run(func() {
+			t := time.Now()
+			rpt, err := tagger.Tag(input)
+			metrics.MeasureSince([]string{tagger.Name(), "tagger"}, t)
+			p.poolMtx.Lock()
+			defer p.poolMtx.Unlock()
+			if p.lateTaggers[i] {
+				log.Warningf("%v tagger took %v (longer than %v)", tagger.Name(), time.Now().Sub(t), deadline)
+				p.lateTaggers[i] = false
+			}
+			results <- tagged{rpt, err}
+		})
+
+		timeout, stop := deadlineTimer(deadline)
+		var result tagged
+		select {
+		case result = <-results:
+		case <-timeout:
+			p.poolMtx.Lock()
+			select {
+			case result = <-results:
+			default:
+				log.Warningf("%v tagger is taking longer than %v, publishing the nodes untagged", tagger.Name(), deadline)
+				p.lateTaggers[i] = true
+				stale = append(stale, tagger.Name())
+				result = tagged{rpt: r}
+			}
+			p.poolMtx.Unlock()
+		}
+		stop()
+		r = result.rpt
+		if result.err != nil {
+			log.Errorf("error applying tagger: %v", result.err)
 		}
 	}
+	r.Stale = r.Stale.Merge(report.MakeStringSet(stale...))
 	return r
 }
 
@@ -207,12 +520,17 @@ ForLoop:
 
 func (p *Probe) publishLoop() {
 	defer p.done.Done()
-	pubTick := time.Tick(p.publishInterval)
+	_, publishInterval := p.intervals()
+	pubTimer := time.NewTimer(publishInterval)
+	defer pubTimer.Stop()
 
 	for {
 		select {
-		case <-pubTick:
+		case <-pubTimer.C:
 			p.drainAndPublish(report.MakeReport(), p.spiedReports)
+			p.adapt()
+			_, publishInterval = p.intervals()
+			pubTimer.Reset(publishInterval)
 
 		case rpt := <-p.shortcutReports:
 			p.drainAndPublish(rpt, p.shortcutReports)
@@ -222,3 +540,44 @@ func (p *Probe) publishLoop() {
 		}
 	}
 }
+
+// adapt lengthens or shortens the intervals according to the size of the
+// last report published and the CPU used by the probe since the last time.
+func (p *Probe) adapt() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.adaptive == (AdaptiveConfig{}) {
+		return
+	}
+
+	now := time.Now()
+	cpuTime, err := processCPUTime()
+	if err != nil {
+		log.Warnf("Error getting the CPU time of the probe: %v", err)
+	}
+	var cpu float64
+	if err == nil && !p.lastAdapted.IsZero() {
+		cpu = 100 * float64(cpuTime-p.lastCPUTime) / float64(now.Sub(p.lastAdapted))
+	}
+	p.lastCPUTime, p.lastAdapted = cpuTime, now
+	p.scaleIntervals(p.publisher.LastSize(), cpu)
+}
+
+func (p *Probe) scaleIntervals(size int, cpu float64) {
+	var (
+		sizeLimit, cpuLimit = float64(p.adaptive.MaxReportSize), p.adaptive.MaxCPU
+		over                = (sizeLimit > 0 && float64(size) > sizeLimit) || (cpuLimit > 0 && cpu > cpuLimit)
+		under               = (sizeLimit == 0 || float64(size) < sizeLimit/2) && (cpuLimit == 0 || cpu < cpuLimit/2)
+		factor              = p.intervalFactor
+	)
+	switch {
+	case over && factor < maxIntervalFactor:
+		factor *= 2
+	case under && factor > 1:
+		factor /= 2
+	}
+	if factor != p.intervalFactor {
+		log.Infof("Report size %d bytes, CPU %.1f%%: making spy and publish intervals %dx longer than configured", size, cpu, factor)
+		p.intervalFactor = factor
+	}
+}
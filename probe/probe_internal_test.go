@@ -2,12 +2,17 @@ package probe
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
+	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ugorji/go/codec"
 	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
 	"github.com/weaveworks/scope/test/reflect"
@@ -97,3 +102,180 @@ func TestProbe(t *testing.T) {
 		return <-pub.have
 	})
 }
+
+func TestScaleIntervals(t *testing.T) {
+	p := New(time.Second, 3*time.Second, nil, false)
+	p.SetAdaptiveConfig(AdaptiveConfig{MaxReportSize: 1000, MaxCPU: 10})
+
+	for _, tc := range []struct {
+		size        int
+		cpu         float64
+		wantSpy     time.Duration
+		wantPublish time.Duration
+	}{
+		{100, 1, time.Second, 3 * time.Second},
+		{2000, 1, 2 * time.Second, 6 * time.Second},
+		{100, 20, 4 * time.Second, 12 * time.Second},
+		{2000, 20, 8 * time.Second, 24 * time.Second},
+		{2000, 20, 8 * time.Second, 24 * time.Second}, // no longer than 8 times
+		{700, 1, 8 * time.Second, 24 * time.Second},   // not well under the size
+		{100, 1, 4 * time.Second, 12 * time.Second},
+	} {
+		p.scaleIntervals(tc.size, tc.cpu)
+		spy, publish := p.intervals()
+		if spy != tc.wantSpy || publish != tc.wantPublish {
+			t.Errorf("%d bytes, %v%% CPU: want %v/%v, have %v/%v", tc.size, tc.cpu, tc.wantSpy, tc.wantPublish, spy, publish)
+		}
+	}
+}
+
+func TestSetIntervalsControl(t *testing.T) {
+	p := New(time.Second, 3*time.Second, nil, false)
+	hr := controls.NewDefaultHandlerRegistry()
+	p.RegisterControls(hr)
+
+	res := hr.HandleControlRequest(xfer.Request{
+		Control:     xfer.SetProbeIntervalsControl,
+		ControlArgs: map[string]string{"publish_interval": "10s"},
+	})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if spy, publish := p.intervals(); spy != time.Second || publish != 10*time.Second {
+		t.Errorf("Unexpected intervals %v/%v", spy, publish)
+	}
+
+	res = hr.HandleControlRequest(xfer.Request{
+		Control:     xfer.SetProbeIntervalsControl,
+		ControlArgs: map[string]string{"spy_interval": "-1s"},
+	})
+	if res.Error == "" {
+		t.Error("Expected an error for a negative interval")
+	}
+}
+
+type slowReporter struct {
+	calls   *int32
+	release chan struct{}
+}
+
+func (slowReporter) Name() string { return "Slow" }
+
+// Report reports a node named after the call, blocking from the second
+// call until released.
+func (s slowReporter) Report() (report.Report, error) {
+	call := atomic.AddInt32(s.calls, 1)
+	if call > 1 {
+		<-s.release
+	}
+	r := report.MakeReport()
+	r.Endpoint.AddNode(report.MakeNode(fmt.Sprintf("slow%d", call)))
+	return r, nil
+}
+
+func TestLateReporter(t *testing.T) {
+	fast := report.MakeReport()
+	fast.Endpoint.AddNode(report.MakeNode("fast"))
+	slow := slowReporter{new(int32), make(chan struct{})}
+
+	p := New(time.Second, time.Second, nil, false)
+	p.SetPoolConfig(PoolConfig{Workers: 2, Deadline: 20 * time.Millisecond})
+	p.AddReporter(mockReporter{fast}, slow)
+
+	check := func(r report.Report, wantNodes []string, wantStale report.StringSet) {
+		t.Helper()
+		haveNodes := []string{}
+		for id := range r.Endpoint.Nodes {
+			haveNodes = append(haveNodes, id)
+		}
+		sort.Strings(haveNodes)
+		if !reflect.DeepEqual(wantNodes, haveNodes) {
+			t.Errorf("want nodes %v, have %v", wantNodes, haveNodes)
+		}
+		if !reflect.DeepEqual(wantStale, r.Stale) {
+			t.Errorf("want stale %v, have %v", wantStale, r.Stale)
+		}
+	}
+	check(p.report(), []string{"fast", "slow1"}, nil)
+
+	// The slow reporter is late: its last report is published instead, and
+	// it isn't run again until it is done
+	check(p.report(), []string{"fast", "slow1"}, report.MakeStringSet("Slow"))
+	check(p.report(), []string{"fast", "slow1"}, report.MakeStringSet("Slow"))
+	if calls := atomic.LoadInt32(slow.calls); calls != 2 {
+		t.Errorf("Expected the late reporter to be called twice, not %d times", calls)
+	}
+
+	close(slow.release)
+	test.Poll(t, 100*time.Millisecond, false, func() interface{} {
+		p.poolMtx.Lock()
+		defer p.poolMtx.Unlock()
+		return p.running[1]
+	})
+	check(p.report(), []string{"fast", "slow3"}, nil)
+}
+
+type slowTagger struct {
+	release chan struct{}
+}
+
+func (slowTagger) Name() string { return "Slow" }
+
+func (s slowTagger) Tag(r report.Report) (report.Report, error) {
+	<-s.release
+	r.Endpoint.AddNode(report.MakeNode("tagged"))
+	return r, nil
+}
+
+func TestLateTagger(t *testing.T) {
+	tagger := slowTagger{make(chan struct{})}
+	p := New(time.Second, time.Second, nil, false)
+	p.SetPoolConfig(PoolConfig{Deadline: 20 * time.Millisecond})
+	p.AddTagger(tagger)
+
+	for i := 0; i < 2; i++ {
+		r := p.tag(report.MakeReport())
+		if len(r.Endpoint.Nodes) != 0 {
+			t.Errorf("Expected the report to be left untagged, got %v", r.Endpoint.Nodes)
+		}
+		if want := report.MakeStringSet("Slow"); !reflect.DeepEqual(want, r.Stale) {
+			t.Errorf("want stale %v, have %v", want, r.Stale)
+		}
+	}
+
+	close(tagger.release)
+	test.Poll(t, 100*time.Millisecond, false, func() interface{} {
+		p.poolMtx.Lock()
+		defer p.poolMtx.Unlock()
+		return p.lateTaggers[0]
+	})
+	r := p.tag(report.MakeReport())
+	if _, ok := r.Endpoint.Nodes["tagged"]; !ok || len(r.Stale) != 0 {
+		t.Errorf("Expected the report to be tagged, got %v, stale %v", r.Endpoint.Nodes, r.Stale)
+	}
+}
+
+func TestProbeStatus(t *testing.T) {
+	p := New(10*time.Millisecond, 100*time.Millisecond, mockPublisher{make(chan report.Report, 10)}, false)
+	p.AddReporter(mockReporter{report.MakeReport()})
+	p.AddTagger(NewTopologyTagger())
+
+	p.mtx.Lock()
+	p.started = time.Now().Add(-time.Minute)
+	p.mtx.Unlock()
+	if _, err := p.Status(); err == nil {
+		t.Error("Expected a probe which never spied to be unhealthy")
+	}
+
+	p.Start()
+	defer p.Stop()
+	test.Poll(t, 300*time.Millisecond, true, func() interface{} {
+		state, err := p.Status()
+		return err == nil && state.(ProbeStatus).LastSpied != nil
+	})
+	state, _ := p.Status()
+	status := state.(ProbeStatus)
+	if !reflect.DeepEqual([]string{"Mock"}, status.Reporters) || !reflect.DeepEqual([]string{"Topology"}, status.Taggers) {
+		t.Errorf("Unexpected reporters %v and taggers %v", status.Reporters, status.Taggers)
+	}
+}
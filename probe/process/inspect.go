@@ -0,0 +1,238 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// IDs of the tables of an Inspection.
+const (
+	OpenFilesTable  = "process_open_files"
+	SocketsTable    = "process_sockets"
+	MemoryMapsTable = "process_memory_maps"
+)
+
+// maxInspectionRows is how many rows an Inspection table has, at most.
+const maxInspectionRows = 500
+
+// Inspection is the value of the response to the InspectProcess control:
+// tables of the process' open files, sockets and memory maps, which are too
+// big to be in every report.
+type Inspection struct {
+	Tables []report.Table `json:"tables"`
+}
+
+var (
+	openFilesColumns = []report.Column{
+		{ID: "fd", Label: "FD", DataType: "number"},
+		{ID: "path", Label: "Path"},
+	}
+	socketsColumns = []report.Column{
+		{ID: "fd", Label: "FD", DataType: "number"},
+		{ID: "protocol", Label: "Protocol"},
+		{ID: "local", Label: "Local"},
+		{ID: "remote", Label: "Peer"},
+		{ID: "state", Label: "State"},
+	}
+	memoryMapsColumns = []report.Column{
+		{ID: "address", Label: "Address"},
+		{ID: "perms", Label: "Perms"},
+		{ID: "size", Label: "Size", DataType: "number"},
+		{ID: "path", Label: "Path"},
+	}
+
+	// tcpStates are the names of the states in /proc/net/tcp.
+	tcpStates = map[string]string{
+		"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+		"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+		"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+	}
+)
+
+func (r *Reporter) inspectProcess(req xfer.Request) xfer.Response {
+	_, pid, ok := report.ParseNodeID(req.NodeID)
+	if !ok {
+		return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+	}
+	inspection, err := inspect(r.procRoot, pid)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{
+		Value: inspection,
+	}
+}
+
+type byFD []report.Row
+
+func (r byFD) Len() int      { return len(r) }
+func (r byFD) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byFD) Less(i, j int) bool {
+	a, _ := strconv.Atoi(r[i].Entries["fd"])
+	b, _ := strconv.Atoi(r[j].Entries["fd"])
+	return a < b
+}
+
+// inspect reads the open files, sockets and memory maps of a process from
+// /proc.
+func inspect(procRoot, pid string) (Inspection, error) {
+	dir := path.Join(procRoot, pid)
+	fds, err := ioutil.ReadDir(path.Join(dir, "fd"))
+	if err != nil {
+		return Inspection{}, err
+	}
+	sockets := readSockets(dir)
+
+	var files, socketRows []report.Row
+	for _, fd := range fds {
+		target, err := os.Readlink(path.Join(dir, "fd", fd.Name()))
+		if err != nil {
+			continue // closed since
+		}
+		if strings.HasPrefix(target, "socket:[") {
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			if socket, ok := sockets[inode]; ok {
+				entries := map[string]string{"fd": fd.Name()}
+				for k, v := range socket.Entries {
+					entries[k] = v
+				}
+				socketRows = append(socketRows, report.Row{ID: fd.Name(), Entries: entries})
+				continue
+			}
+		}
+		files = append(files, report.Row{
+			ID:      fd.Name(),
+			Entries: map[string]string{"fd": fd.Name(), "path": target},
+		})
+	}
+	sort.Sort(byFD(files))
+	sort.Sort(byFD(socketRows))
+
+	maps, err := readMemoryMaps(path.Join(dir, "maps"))
+	if err != nil {
+		return Inspection{}, err
+	}
+
+	return Inspection{Tables: []report.Table{
+		truncatedTable(OpenFilesTable, "Open files", openFilesColumns, files),
+		truncatedTable(SocketsTable, "Sockets", socketsColumns, socketRows),
+		truncatedTable(MemoryMapsTable, "Memory maps", memoryMapsColumns, maps),
+	}}, nil
+}
+
+func truncatedTable(id, label string, columns []report.Column, rows []report.Row) report.Table {
+	table := report.Table{
+		ID:      id,
+		Label:   label,
+		Type:    report.MulticolumnTableType,
+		Columns: columns,
+		Rows:    rows,
+	}
+	if len(rows) > maxInspectionRows {
+		table.Rows = rows[:maxInspectionRows]
+		table.TruncationCount = len(rows) - maxInspectionRows
+	}
+	return table
+}
+
+// readSockets reads the TCP and UDP sockets in the network namespace of a
+// process, by inode. Protocols which can't be read are skipped.
+func readSockets(dir string) map[string]report.Row {
+	result := map[string]report.Row{}
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		buf, err := ioutil.ReadFile(path.Join(dir, "net", protocol))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(buf))
+		scanner.Scan() // header
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			state := ""
+			if strings.HasPrefix(protocol, "tcp") {
+				state = tcpStates[fields[3]]
+			}
+			result[fields[9]] = report.Row{
+				ID: fields[9],
+				Entries: map[string]string{
+					"protocol": protocol,
+					"local":    parseProcNetAddress(fields[1]),
+					"remote":   parseProcNetAddress(fields[2]),
+					"state":    state,
+				},
+			}
+		}
+	}
+	return result
+}
+
+// parseProcNetAddress parses an address of /proc/net/{tcp,udp}[6]: the IP in
+// hex, as little endian 32 bit words, and the port in hex.
+func parseProcNetAddress(s string) string {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return s
+	}
+	raw, err := hex.DecodeString(s[:i])
+	port, err2 := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil || err2 != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return s
+	}
+	ip := make(net.IP, len(raw))
+	for j := 0; j < len(raw); j += 4 {
+		binary.BigEndian.PutUint32(ip[j:], binary.LittleEndian.Uint32(raw[j:]))
+	}
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(port, 10))
+}
+
+// readMemoryMaps reads the memory maps of a process, from lines such as
+// "00400000-00452000 r-xp 00000000 08:02 173521 /usr/bin/dbus-daemon".
+func readMemoryMaps(filename string) ([]report.Row, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rows []report.Row
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		var start, end uint64
+		if _, err := fmt.Sscanf(fields[0], "%x-%x", &start, &end); err != nil {
+			continue
+		}
+		mapped := ""
+		if len(fields) > 5 {
+			mapped = strings.Join(fields[5:], " ")
+		}
+		rows = append(rows, report.Row{
+			ID: fields[0],
+			Entries: map[string]string{
+				"address": fields[0],
+				"perms":   fields[1],
+				"size":    strconv.FormatUint(end-start, 10),
+				"path":    mapped,
+			},
+		})
+	}
+	return rows, nil
+}
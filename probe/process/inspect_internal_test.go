@@ -0,0 +1,68 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "scope-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+	dir := path.Join(procRoot, "1234")
+	for _, d := range []string{"fd", "net"} {
+		if err := os.MkdirAll(path.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for fd, target := range map[string]string{
+		"0":  "/dev/null",
+		"10": "/var/log/app.log",
+		"3":  "socket:[5678]",
+		"4":  "socket:[9999]",
+	} {
+		if err := os.Symlink(target, path.Join(dir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 0100007F:1F90 0200000A:D431 01 00000000:00000000 00:00000000 00000000  1000        0 5678 1 0000000000000000 20 4 30 10 -1\n",
+		"maps": "00400000-00452000 r-xp 00000000 08:02 173521      /usr/bin/app\n" +
+			"7ffd4a2c5000-7ffd4a2e6000 rw-p 00000000 00:00 0                          [stack]\n",
+	} {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inspection, err := inspect(procRoot, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inspection.Tables) != 3 {
+		t.Fatalf("expected 3 tables, got %d", len(inspection.Tables))
+	}
+	var paths []string
+	for _, row := range inspection.Tables[0].Rows {
+		paths = append(paths, row.Entries["path"])
+	}
+	if want := []string{"/dev/null", "socket:[9999]", "/var/log/app.log"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("open files: %v != %v", paths, want)
+	}
+	if want := []map[string]string{{
+		"fd": "3", "protocol": "tcp", "local": "127.0.0.1:8080", "remote": "10.0.0.2:54321", "state": "ESTABLISHED",
+	}}; len(inspection.Tables[1].Rows) != 1 || !reflect.DeepEqual(inspection.Tables[1].Rows[0].Entries, want[0]) {
+		t.Errorf("sockets: %v != %v", inspection.Tables[1].Rows, want)
+	}
+	if rows := inspection.Tables[2].Rows; len(rows) != 2 ||
+		!reflect.DeepEqual(rows[0].Entries, map[string]string{"address": "00400000-00452000", "perms": "r-xp", "size": "335872", "path": "/usr/bin/app"}) ||
+		rows[1].Entries["path"] != "[stack]" {
+		t.Errorf("memory maps: %v", rows)
+	}
+}
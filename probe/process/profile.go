@@ -0,0 +1,158 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the process integration.
+const (
+	ProfileCPU     = "process_profile_cpu"
+	InspectProcess = "process_inspect"
+)
+
+// Exposed for testing
+var (
+	ProfileDuration  = 5 * time.Second
+	ProfileFrequency = 99 // samples per second
+
+	// sampleStacks records the stacks of pid for duration with perf, and
+	// returns the output of perf script.
+	sampleStacks = func(pid string, duration time.Duration) ([]byte, error) {
+		data, err := ioutil.TempFile("", "scope-perf")
+		if err != nil {
+			return nil, err
+		}
+		data.Close()
+		defer os.Remove(data.Name())
+
+		record := exec.Command("perf", "record", "-q", "-g",
+			"-F", fmt.Sprint(ProfileFrequency), "-p", pid, "-o", data.Name(),
+			"--", "sleep", fmt.Sprint(duration.Seconds()))
+		if output, err := record.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("perf record: %v: %s", err, output)
+		}
+		return exec.Command("perf", "script", "-i", data.Name()).Output()
+	}
+)
+
+func (r *Reporter) registerControls() {
+	r.handlerRegistry.Register(ProfileCPU, r.profileCPU)
+	r.handlerRegistry.Register(InspectProcess, r.inspectProcess)
+}
+
+func (r *Reporter) deregisterControls() {
+	r.handlerRegistry.Rm(ProfileCPU)
+	r.handlerRegistry.Rm(InspectProcess)
+}
+
+// profileCPU samples the stacks of a process and sends them down a pipe as a
+// flame graph, in the folded format of stackcollapse-perf.pl (one line per
+// distinct stack, with the frames from the root separated by semicolons,
+// followed by the number of samples).
+func (r *Reporter) profileCPU(req xfer.Request) xfer.Response {
+	_, pid, ok := report.ParseNodeID(req.NodeID)
+	if !ok {
+		return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+	}
+
+	id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	go func() {
+		defer pipe.Close()
+		log.Infof("Profiling process %s for %v", pid, ProfileDuration)
+		output, err := sampleStacks(pid, ProfileDuration)
+		if err != nil {
+			log.Errorf("Error profiling process %s: %v", pid, err)
+			return
+		}
+		local, _ := pipe.Ends()
+		if err := writeFoldedStacks(local, foldStacks(bytes.NewReader(output))); err != nil {
+			log.Errorf("Error sending profile of process %s: %v", pid, err)
+		}
+	}()
+	return xfer.Response{
+		Pipe: id,
+	}
+}
+
+// foldStacks counts the distinct stacks in the output of perf script.
+func foldStacks(r io.Reader) map[string]int {
+	var (
+		result  = map[string]int{}
+		scanner = bufio.NewScanner(r)
+		comm    string
+		frames  []string
+	)
+	flush := func() {
+		if comm == "" {
+			return
+		}
+		stack := []string{comm}
+		for i := len(frames) - 1; i >= 0; i-- {
+			stack = append(stack, frames[i])
+		}
+		result[strings.Join(stack, ";")]++
+		comm, frames = "", nil
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case line[0] != ' ' && line[0] != '\t':
+			// Sample header: "comm pid [cpu] timestamp: period event:"
+			flush()
+			if fields := strings.Fields(line); len(fields) > 0 {
+				comm = fields[0]
+			}
+		default:
+			// Stack frame: "address symbol+offset (dso)"
+			line = strings.TrimSpace(line)
+			i := strings.IndexByte(line, ' ')
+			if i < 0 {
+				continue
+			}
+			symbol := line[i+1:]
+			if j := strings.LastIndex(symbol, " ("); j >= 0 {
+				symbol = symbol[:j]
+			}
+			if j := strings.LastIndex(symbol, "+0x"); j > 0 {
+				symbol = symbol[:j]
+			}
+			frames = append(frames, symbol)
+		}
+	}
+	flush()
+	return result
+}
+
+func writeFoldedStacks(w io.Writer, stacks map[string]int) error {
+	lines := make([]string, 0, len(stacks))
+	for stack, count := range stacks {
+		lines = append(lines, fmt.Sprintf("%s %d\n", stack, count))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package process
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const perfScript = `java 1234 [000] 1000.000001:   10101010 cpu-clock:
+	    7f0000000001 doWork+0x10 (/usr/lib/libwork.so)
+	    7f0000000002 std::vector<int, std::allocator<int> >::push_back+0x22 (/usr/lib/libstdc++.so)
+	    400001 main+0x5 (/usr/bin/java)
+
+java 1234 [000] 1000.010001:   10101010 cpu-clock:
+	    7f0000000001 doWork+0x14 (/usr/lib/libwork.so)
+	    7f0000000002 std::vector<int, std::allocator<int> >::push_back+0x22 (/usr/lib/libstdc++.so)
+	    400001 main+0x5 (/usr/bin/java)
+
+java 1235 [001] 1000.020001:   10101010 cpu-clock:
+	    400002 [unknown] (/usr/bin/java)
+`
+
+func TestFoldStacks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFoldedStacks(&buf, foldStacks(strings.NewReader(perfScript))); err != nil {
+		t.Fatal(err)
+	}
+	want := "java;[unknown] 1\n" +
+		"java;main;std::vector<int, std::allocator<int> >::push_back;doWork 2\n"
+	if have := buf.String(); want != have {
+		t.Errorf("want:\n%s\nhave:\n%s", want, have)
+	}
+}
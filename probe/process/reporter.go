@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -40,20 +41,38 @@ var (
 type Reporter struct {
 	scope                  string
 	walker                 Walker
+	procRoot               string
 	jiffies                Jiffies
 	noCommandLineArguments bool
+	pipes                  controls.PipeClient
+	handlerRegistry        *controls.HandlerRegistry
 }
 
 // Jiffies is the type for the function used to fetch the elapsed jiffies.
 type Jiffies func() (uint64, float64, error)
 
-// NewReporter makes a new Reporter.
-func NewReporter(walker Walker, scope string, jiffies Jiffies, noCommandLineArguments bool) *Reporter {
-	return &Reporter{
+// NewReporter makes a new Reporter. Processes get CPU profiling and
+// inspection controls, reading procRoot, unless handlerRegistry is nil.
+func NewReporter(walker Walker, procRoot, scope string, jiffies Jiffies, noCommandLineArguments bool, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *Reporter {
+	r := &Reporter{
 		scope:                  scope,
 		walker:                 walker,
+		procRoot:               procRoot,
 		jiffies:                jiffies,
 		noCommandLineArguments: noCommandLineArguments,
+		pipes:                  pipes,
+		handlerRegistry:        handlerRegistry,
+	}
+	if handlerRegistry != nil {
+		r.registerControls()
+	}
+	return r
+}
+
+// Stop stops the reporter.
+func (r *Reporter) Stop() {
+	if r.handlerRegistry != nil {
+		r.deregisterControls()
 	}
 }
 
@@ -75,6 +94,18 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 	t := report.MakeTopology().
 		WithMetadataTemplates(MetadataTemplates).
 		WithMetricTemplates(MetricTemplates)
+	if r.handlerRegistry != nil {
+		t.Controls.AddControl(report.Control{
+			ID:    ProfileCPU,
+			Human: "Profile CPU",
+			Icon:  "fa-fire",
+		})
+		t.Controls.AddControl(report.Control{
+			ID:    InspectProcess,
+			Human: "Show open files, sockets and memory maps",
+			Icon:  "fa-list-alt",
+		})
+	}
 	now := mtime.Now()
 	deltaTotal, maxCPU, err := r.jiffies()
 	if err != nil {
@@ -114,6 +145,9 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 
 		node = node.WithMetric(MemoryUsage, report.MakeSingletonMetric(now, float64(p.RSSBytes)).WithMax(float64(p.RSSBytesLimit)))
 		node = node.WithMetric(OpenFilesCount, report.MakeSingletonMetric(now, float64(p.OpenFilesCount)).WithMax(float64(p.OpenFilesLimit)))
+		if r.handlerRegistry != nil {
+			node = node.WithLatestActiveControls(ProfileCPU, InspectProcess)
+		}
 
 		t.AddNode(node)
 	})
@@ -36,7 +36,7 @@ func testReporter(t *testing.T, noCommandLineArguments bool, test func(report.Re
 	mtime.NowForce(now)
 	defer mtime.NowReset()
 
-	rpt, err := process.NewReporter(walker, "", getDeltaTotalJiffies, noCommandLineArguments).Report()
+	rpt, err := process.NewReporter(walker, "/proc", "", getDeltaTotalJiffies, noCommandLineArguments, nil, nil).Report()
 	if err != nil {
 		t.Error(err)
 	}
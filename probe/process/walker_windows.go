@@ -0,0 +1,130 @@
+package process
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// NewWalker returns a Windows (toolhelp-based) walker.
+func NewWalker(_ string, _ bool) Walker {
+	return &walker{}
+}
+
+type walker struct{}
+
+const processQueryLimitedInformation = 0x1000
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procGetSystemTimes        = kernel32.NewProc("GetSystemTimes")
+	procGetProcessMemoryInfo  = kernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+)
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS, as filled in by
+// GetProcessMemoryInfo.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+// IsProcInAccept returns true if the process has a at least one thread
+// blocked on the accept() system call
+func IsProcInAccept(procRoot, pid string) (ret bool) {
+	// Not implemented on windows
+	return false
+}
+
+// Walk walks the processes in a toolhelp snapshot. Processes we aren't
+// allowed to open are still reported, without their metrics.
+func (walker) Walk(f func(Process, Process)) error {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		p := Process{
+			PID:     int(entry.ProcessID),
+			PPID:    int(entry.ParentProcessID),
+			Name:    syscall.UTF16ToString(entry.ExeFile[:]),
+			Threads: int(entry.Threads),
+		}
+		readProcessMetrics(&p)
+		f(p, Process{})
+	}
+	if err != syscall.ERROR_NO_MORE_FILES {
+		return err
+	}
+	return nil
+}
+
+func readProcessMetrics(p *Process) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(p.PID))
+	if err != nil {
+		return
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err == nil {
+		p.Jiffies = filetimeTicks(kernel) + filetimeTicks(user)
+	}
+
+	if procGetProcessMemoryInfo.Find() == nil {
+		counters := processMemoryCounters{}
+		counters.cb = uint32(unsafe.Sizeof(counters))
+		if ok, _, _ := procGetProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); ok != 0 {
+			p.RSSBytes = uint64(counters.workingSetSize)
+		}
+	}
+
+	if procGetProcessHandleCount.Find() == nil {
+		var count uint32
+		if ok, _, _ := procGetProcessHandleCount.Call(uintptr(handle), uintptr(unsafe.Pointer(&count))); ok != 0 {
+			p.OpenFilesCount = int(count)
+		}
+	}
+}
+
+// filetimeTicks gives the number of 100ns ticks in a FILETIME, which is what
+// we use as jiffies on Windows.
+func filetimeTicks(t syscall.Filetime) uint64 {
+	return uint64(t.HighDateTime)<<32 | uint64(t.LowDateTime)
+}
+
+var previousTotal uint64
+
+// GetDeltaTotalJiffies returns the number of 100ns ticks of CPU time that
+// have passed since it was last called.  In that respect, it is
+// side-effect-ful.
+func GetDeltaTotalJiffies() (uint64, float64, error) {
+	if err := procGetSystemTimes.Find(); err != nil {
+		return 0, 0.0, err
+	}
+	var idle, kernel, user syscall.Filetime
+	ok, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&idle)),
+		uintptr(unsafe.Pointer(&kernel)),
+		uintptr(unsafe.Pointer(&user)),
+	)
+	if ok == 0 {
+		return 0, 0.0, err
+	}
+	// Kernel time includes the idle time
+	currentTotal := filetimeTicks(kernel) + filetimeTicks(user)
+	delta := currentTotal - previousTotal
+	previousTotal = currentTotal
+	return delta, 100., nil
+}
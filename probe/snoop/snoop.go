@@ -0,0 +1,29 @@
+// Package snoop snoops the TCP segments of the host for the observers of
+// application protocols, through a BPF socket filter only passing the ones
+// they are interested in.
+package snoop
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Observer is fed the payloads of the TCP segments over IPv4 matching its
+// filter.
+type Observer interface {
+	// Filter is a pcap filter expression, run in the kernel.
+	Filter() string
+	// Observe is called with the start of the payload of every segment
+	// matching the filter of any observer of the snooper.
+	Observe(src, dst net.IP, srcPort, dstPort uint16, payload []byte)
+}
+
+// filter gives the filter of the segments any of observers wants.
+func filter(observers []Observer) string {
+	var filters []string
+	for _, o := range observers {
+		filters = append(filters, fmt.Sprintf("(%s)", o.Filter()))
+	}
+	return fmt.Sprintf("ip and tcp and (%s)", strings.Join(filters, " or "))
+}
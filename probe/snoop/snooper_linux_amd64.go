@@ -0,0 +1,136 @@
+package snoop
+
+import (
+	"math"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+const (
+	bufSize = 8 * 1024 * 1024 // 8MB
+	snapLen = 128             // enough for the start of the payload
+
+	// maxSeen is how many segments are remembered to not count twice the
+	// ones crossing several interfaces, e.g. the veths of two containers.
+	maxSeen = 100000
+)
+
+// segment identifies a TCP segment.
+type segment struct {
+	src, dst         [16]byte
+	srcPort, dstPort uint16
+	seq              uint32
+}
+
+// Snooper feeds observers with the TCP segments over IPv4 on all
+// interfaces. It attaches a BPF socket filter only passing the segments
+// they want, so the kernel drops the rest of the traffic.
+type Snooper struct {
+	stop       chan struct{}
+	pcapHandle *pcap.Handle
+	observers  []Observer
+	seen       map[segment]struct{}
+}
+
+// NewSnooper starts snooping segments for observers.
+func NewSnooper(observers ...Observer) (*Snooper, error) {
+	pcapHandle, err := newPcapHandle(filter(observers))
+	if err != nil {
+		return nil, err
+	}
+	s := &Snooper{
+		stop:       make(chan struct{}),
+		pcapHandle: pcapHandle,
+		observers:  observers,
+		seen:       map[segment]struct{}{},
+	}
+	go s.run()
+	return s, nil
+}
+
+func newPcapHandle(filter string) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle("any")
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+	// See the DNS snooper for this timeout
+	if err = inactive.SetTimeout(time.Duration(math.MaxInt64)); err != nil {
+		return nil, err
+	}
+	if err = inactive.SetImmediateMode(true); err != nil {
+		return nil, err
+	}
+	if err = inactive.SetBufferSize(bufSize); err != nil {
+		return nil, err
+	}
+	if err = inactive.SetSnapLen(snapLen); err != nil {
+		return nil, err
+	}
+	pcapHandle, err := inactive.Activate()
+	if err != nil {
+		return nil, err
+	}
+	if err := pcapHandle.SetBPFFilter(filter); err != nil {
+		pcapHandle.Close()
+		return nil, err
+	}
+	return pcapHandle, nil
+}
+
+// Stop stops snooping.
+func (s *Snooper) Stop() {
+	close(s.stop)
+}
+
+func (s *Snooper) run() {
+	var (
+		decodedLayers []gopacket.LayerType
+		tcp           layers.TCP
+		ip4           layers.IPv4
+		sll           layers.LinuxSLL
+		payload       gopacket.Payload
+	)
+
+	// assumes that the "any" interface is being used (see https://wiki.wireshark.org/SLL)
+	packetParser := gopacket.NewDecodingLayerParser(layers.LayerTypeLinuxSLL, &sll, &ip4, &tcp, &payload)
+
+	for {
+		select {
+		case <-s.stop:
+			s.pcapHandle.Close()
+			return
+		default:
+		}
+
+		packet, _, err := s.pcapHandle.ZeroCopyReadPacketData()
+		if err != nil {
+			if err != pcap.NextErrorTimeoutExpired {
+				log.Errorf("Snooper: error reading packet data: %s", err)
+			}
+			continue
+		}
+		if err := packetParser.DecodeLayers(packet, &decodedLayers); err != nil || len(decodedLayers) < 4 {
+			continue
+		}
+
+		seg := segment{srcPort: uint16(tcp.SrcPort), dstPort: uint16(tcp.DstPort), seq: tcp.Seq}
+		copy(seg.src[:], ip4.SrcIP.To16())
+		copy(seg.dst[:], ip4.DstIP.To16())
+		if _, ok := s.seen[seg]; ok {
+			continue
+		}
+		if len(s.seen) >= maxSeen {
+			s.seen = map[segment]struct{}{}
+		}
+		s.seen[seg] = struct{}{}
+
+		for _, o := range s.observers {
+			o.Observe(ip4.SrcIP, ip4.DstIP, uint16(tcp.SrcPort), uint16(tcp.DstPort), payload)
+		}
+	}
+}
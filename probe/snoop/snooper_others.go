@@ -0,0 +1,19 @@
+// +build darwin arm windows
+
+// Cross-compiling the snooper requires having pcap binaries, as for the DNS
+// snooper.
+
+package snoop
+
+import "fmt"
+
+// Snooper feeds observers with the TCP segments snooped on the host.
+type Snooper struct{}
+
+// NewSnooper fails, as snooping isn't supported on this platform.
+func NewSnooper(observers ...Observer) (*Snooper, error) {
+	return nil, fmt.Errorf("snooping not supported on this platform")
+}
+
+// Stop stops snooping.
+func (s *Snooper) Stop() {}
@@ -0,0 +1,77 @@
+package probe
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Status holds the errors which loops of the probe have given up retrying,
+// to be served on the status endpoint of the probe, along with the state of
+// the parts of the probe added as sources.
+type Status struct {
+	mtx     sync.Mutex
+	errors  map[string]string
+	sources map[string]StatusSource
+}
+
+// StatusSource gives the state of a part of the probe, and an error if it
+// is unhealthy.
+type StatusSource func() (interface{}, error)
+
+// NewStatus makes a new Status.
+func NewStatus() *Status {
+	return &Status{errors: map[string]string{}, sources: map[string]StatusSource{}}
+}
+
+// GiveUp gives a function recording the error which the loop called name
+// gave up on, for use with backoff.OnGiveUp.
+func (s *Status) GiveUp(name string) func(error) {
+	return func(err error) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		s.errors[name] = err.Error()
+	}
+}
+
+// AddSource adds the state of a part of the probe to the status, under name.
+func (s *Status) AddSource(name string, source StatusSource) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.sources[name] = source
+}
+
+// ServeHTTP serves the errors and the state of the sources as JSON, with a
+// 503 if there are any errors, or unhealthy sources.
+func (s *Status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	errors := make(map[string]string, len(s.errors))
+	for name, err := range s.errors {
+		errors[name] = err
+	}
+	names := make([]string, 0, len(s.sources))
+	sources := make(map[string]StatusSource, len(s.sources))
+	for name, source := range s.sources {
+		names = append(names, name)
+		sources[name] = source
+	}
+	s.mtx.Unlock()
+
+	sort.Strings(names)
+	status := map[string]interface{}{"errors": errors}
+	for _, name := range names {
+		state, err := sources[name]()
+		if err != nil {
+			errors[name] = err.Error()
+		}
+		status[name] = state
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	codec.NewEncoder(w, &codec.JsonHandle{BasicHandle: codec.BasicHandle{EncodeOptions: codec.EncodeOptions{Canonical: true}}}).Encode(status)
+}
@@ -0,0 +1,56 @@
+package probe_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/probe"
+)
+
+func TestStatus(t *testing.T) {
+	s := probe.NewStatus()
+	for _, tc := range []struct {
+		giveUp   string
+		wantCode int
+		wantBody string
+	}{
+		{"", http.StatusOK, `{"errors":{}}`},
+		{"weave ps", http.StatusServiceUnavailable, `{"errors":{"weave ps":"connection refused"}}`},
+	} {
+		if tc.giveUp != "" {
+			s.GiveUp(tc.giveUp)(fmt.Errorf("connection refused"))
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+		if w.Code != tc.wantCode {
+			t.Errorf("Expected status %d, got %d", tc.wantCode, w.Code)
+		}
+		if have := strings.TrimSpace(w.Body.String()); have != tc.wantBody {
+			t.Errorf("Expected body %s, got %s", tc.wantBody, have)
+		}
+	}
+}
+
+func TestStatusSources(t *testing.T) {
+	s := probe.NewStatus()
+	s.AddSource("reporters", func() (interface{}, error) {
+		return []string{"host", "process"}, nil
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if want, have := `{"errors":{},"reporters":["host","process"]}`, strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || have != want {
+		t.Errorf("Expected %s, got %d %s", want, w.Code, have)
+	}
+
+	s.AddSource("spy", func() (interface{}, error) {
+		return "stuck", fmt.Errorf("no report generated for 1m0s")
+	})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if want, have := `{"errors":{"spy":"no report generated for 1m0s"},"reporters":["host","process"],"spy":"stuck"}`, strings.TrimSpace(w.Body.String()); w.Code != http.StatusServiceUnavailable || have != want {
+		t.Errorf("Expected %s, got %d %s", want, w.Code, have)
+	}
+}
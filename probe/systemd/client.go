@@ -0,0 +1,141 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Unit is a systemd service, with the properties of it systemd gives.
+type Unit struct {
+	Name          string // like "sshd.service"
+	Description   string
+	LoadState     string // like "loaded" or "not-found"
+	ActiveState   string // like "active", "inactive" or "failed"
+	SubState      string // like "running" or "exited"
+	UnitFileState string // like "enabled" or "disabled"
+	MainPID       int
+	Restarts      int
+}
+
+// Client talks to systemd. Exposed for testing.
+type Client interface {
+	// ListUnits gives the loaded services, active or not.
+	ListUnits() ([]Unit, error)
+	// Control starts, stops or restarts a unit, without waiting for the job
+	// of doing so to finish.
+	Control(action, unit string) error
+}
+
+// systemctl is the command line client of the D-Bus API of systemd. Going
+// through it means the probe needs no D-Bus library, only the systemctl of
+// the host and its /run/systemd.
+var systemctl = "systemctl"
+
+// unitProperties are the properties of units read, in the order of the
+// fields of Unit.
+var unitProperties = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "MainPID", "NRestarts"}
+
+type client struct {
+	path string
+}
+
+// NewClient makes a client of the systemd of the host, if systemctl is
+// there.
+func NewClient() (Client, error) {
+	path, err := exec.LookPath(systemctl)
+	if err != nil {
+		return nil, err
+	}
+	return &client{path: path}, nil
+}
+
+func (c *client) ListUnits() ([]Unit, error) {
+	out, err := exec.Command(c.path, "list-units", "--type=service", "--all", "--plain", "--no-legend", "--no-pager").Output()
+	if err != nil {
+		return nil, err
+	}
+	names := ParseUnitNames(out)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"show", "--no-pager", "--property=" + strings.Join(unitProperties, ",")}, names...)
+	if out, err = exec.Command(c.path, args...).Output(); err != nil {
+		return nil, err
+	}
+	return ParseUnits(out), nil
+}
+
+func (c *client) Control(action, unit string) error {
+	switch action {
+	case "start", "stop", "restart":
+	default:
+		return fmt.Errorf("unknown action on units: %s", action)
+	}
+	if out, err := exec.Command(c.path, action, "--no-block", "--", unit).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", action, unit, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// ParseUnitNames parses the names of the loaded units from the output of
+// systemctl list-units, of lines like "sshd.service loaded active running
+// OpenSSH Daemon". Exposed for testing.
+func ParseUnitNames(out []byte) []string {
+	names := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "loaded" {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+	return names
+}
+
+// ParseUnits parses the output of systemctl show, of blocks of the
+// "Key=value" properties of units separated by empty lines. Exposed for
+// testing.
+func ParseUnits(out []byte) []Unit {
+	units := []Unit{}
+	var unit *Unit
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			unit = nil
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if unit == nil {
+			units = append(units, Unit{})
+			unit = &units[len(units)-1]
+		}
+		switch kv[0] {
+		case "Id":
+			unit.Name = kv[1]
+		case "Description":
+			unit.Description = kv[1]
+		case "LoadState":
+			unit.LoadState = kv[1]
+		case "ActiveState":
+			unit.ActiveState = kv[1]
+		case "SubState":
+			unit.SubState = kv[1]
+		case "UnitFileState":
+			unit.UnitFileState = kv[1]
+		case "MainPID":
+			unit.MainPID, _ = strconv.Atoi(kv[1])
+		case "NRestarts":
+			unit.Restarts, _ = strconv.Atoi(kv[1])
+		}
+	}
+	return units
+}
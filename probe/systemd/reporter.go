@@ -0,0 +1,208 @@
+package systemd
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/cgroup"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	UnitName      = "systemd_unit_name"
+	Description   = "systemd_unit_description"
+	LoadState     = "systemd_unit_load_state"
+	ActiveState   = "systemd_unit_active_state"
+	SubState      = "systemd_unit_sub_state"
+	UnitFileState = "systemd_unit_file_state"
+	MainPID       = "systemd_unit_main_pid"
+	Restarts      = "systemd_unit_restarts"
+)
+
+// Control IDs used by the systemd integration.
+const (
+	StartUnit   = "systemd_unit_start"
+	StopUnit    = "systemd_unit_stop"
+	RestartUnit = "systemd_unit_restart"
+)
+
+// Exposed for testing
+var (
+	UnitMetadataTemplates = report.MetadataTemplates{
+		Description:    {ID: Description, Label: "Description", From: report.FromLatest, Priority: 1},
+		ActiveState:    {ID: ActiveState, Label: "State", From: report.FromLatest, Priority: 2},
+		SubState:       {ID: SubState, Label: "Sub-state", From: report.FromLatest, Priority: 3},
+		UnitFileState:  {ID: UnitFileState, Label: "Unit File", From: report.FromLatest, Priority: 4},
+		MainPID:        {ID: MainPID, Label: "Main PID", From: report.FromLatest, Datatype: "number", Priority: 5},
+		Restarts:       {ID: Restarts, Label: "Restart #", From: report.FromLatest, Datatype: "number", Priority: 6},
+		report.Process: {ID: report.Process, Label: "# Processes", From: report.FromCounters, Datatype: "number", Priority: 7},
+	}
+
+	UnitControls = []report.Control{
+		{
+			ID:    StartUnit,
+			Human: "Start",
+			Icon:  "fa-play",
+			Rank:  1,
+		},
+		{
+			ID:    RestartUnit,
+			Human: "Restart",
+			Icon:  "fa-repeat",
+			Rank:  2,
+		},
+		{
+			ID:    StopUnit,
+			Human: "Stop",
+			Icon:  "fa-stop",
+			Rank:  3,
+		},
+	}
+)
+
+// Reporter generates Reports containing the SystemdUnit topology of the
+// services of the host, and tags the processes of the host with the units
+// they are run by.
+type Reporter struct {
+	client          Client
+	hostID          string
+	handlerRegistry *controls.HandlerRegistry
+}
+
+// NewReporter makes a new Reporter.
+func NewReporter(client Client, hostID string, handlerRegistry *controls.HandlerRegistry) *Reporter {
+	r := &Reporter{
+		client:          client,
+		hostID:          hostID,
+		handlerRegistry: handlerRegistry,
+	}
+	r.registerControls()
+	return r
+}
+
+// Name of this reporter/tagger, for metrics gathering
+func (*Reporter) Name() string { return "Systemd" }
+
+// Stop stops the reporter.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+}
+
+// Report generates a Report containing the SystemdUnit topology, of the
+// loaded services of the host.
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.SystemdUnit = result.SystemdUnit.WithMetadataTemplates(UnitMetadataTemplates)
+	result.SystemdUnit.Controls.AddControls(UnitControls)
+
+	units, err := r.client.ListUnits()
+	if err != nil {
+		return result, err
+	}
+	hostNodeID := report.MakeHostNodeID(r.hostID)
+	for _, u := range units {
+		if u.LoadState != "loaded" {
+			continue
+		}
+		latest := map[string]string{
+			UnitName:      u.Name,
+			Description:   u.Description,
+			LoadState:     u.LoadState,
+			ActiveState:   u.ActiveState,
+			SubState:      u.SubState,
+			UnitFileState: u.UnitFileState,
+			Restarts:      strconv.Itoa(u.Restarts),
+		}
+		if u.MainPID > 0 {
+			latest[MainPID] = strconv.Itoa(u.MainPID)
+		}
+		result.SystemdUnit.AddNode(report.MakeNodeWith(report.MakeSystemdUnitNodeID(r.hostID, u.Name), latest).
+			WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID))).
+			WithLatestActiveControls(activeControls(u.ActiveState)...))
+	}
+	return result, nil
+}
+
+// activeControls are the controls of units in a state: units which are
+// running can be restarted or stopped, and units which are not, started.
+func activeControls(state string) []string {
+	switch state {
+	case "active", "activating", "reloading":
+		return []string{RestartUnit, StopUnit}
+	case "deactivating":
+		return nil
+	}
+	return []string{StartUnit}
+}
+
+// Tag adds the units processes are run by, from their systemd cgroups, as
+// their parents.
+func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
+	for id, n := range rpt.Process.Nodes {
+		pid, ok := n.Latest.Lookup(process.PID)
+		if !ok {
+			continue
+		}
+		pidNum, err := strconv.Atoi(pid)
+		if err != nil {
+			continue
+		}
+		cgroupPath, err := cgroup.Path(pidNum, "name=systemd")
+		if err != nil {
+			continue
+		}
+		unit, ok := UnitOfCgroup(cgroupPath)
+		if !ok {
+			continue
+		}
+		rpt.Process.Nodes[id] = n.WithParents(n.Parents.Add(
+			report.SystemdUnit,
+			report.MakeStringSet(report.MakeSystemdUnitNodeID(r.hostID, unit)),
+		))
+	}
+	return rpt, nil
+}
+
+// UnitOfCgroup gives the service running the processes of a cgroup, like
+// "sshd.service" of "/system.slice/sshd.service". Processes of services
+// which create cgroups of their own, like
+// "/system.slice/docker.service/payload", are still run by the service.
+// Exposed for testing.
+func UnitOfCgroup(cgroupPath string) (string, bool) {
+	for _, element := range strings.Split(path.Clean(cgroupPath), "/") {
+		if strings.HasSuffix(element, ".service") {
+			return element, true
+		}
+	}
+	return "", false
+}
+
+func (r *Reporter) registerControls() {
+	r.handlerRegistry.Batch(nil, map[string]xfer.ControlHandlerFunc{
+		StartUnit:   r.controlUnit("start"),
+		StopUnit:    r.controlUnit("stop"),
+		RestartUnit: r.controlUnit("restart"),
+	})
+}
+
+func (r *Reporter) deregisterControls() {
+	r.handlerRegistry.Batch([]string{StartUnit, StopUnit, RestartUnit}, nil)
+}
+
+func (r *Reporter) controlUnit(action string) xfer.ControlHandlerFunc {
+	return func(req xfer.Request) xfer.Response {
+		hostID, unit, ok := report.ParseSystemdUnitNodeID(req.NodeID)
+		if !ok || hostID != r.hostID {
+			return xfer.ResponseErrorf("invalid unit node ID: %s", req.NodeID)
+		}
+		if err := r.client.Control(action, unit); err != nil {
+			return xfer.ResponseErrorf("systemd: %v", err)
+		}
+		return xfer.Response{}
+	}
+}
@@ -0,0 +1,204 @@
+package systemd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/cgroup"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	units    []systemd.Unit
+	controls []string
+}
+
+func (c *mockClient) ListUnits() ([]systemd.Unit, error) {
+	return c.units, nil
+}
+
+func (c *mockClient) Control(action, unit string) error {
+	if unit == "missing.service" {
+		return fmt.Errorf("Unit %s not found.", unit)
+	}
+	c.controls = append(c.controls, action+" "+unit)
+	return nil
+}
+
+var units = []systemd.Unit{
+	{Name: "sshd.service", Description: "OpenSSH Daemon", LoadState: "loaded", ActiveState: "active", SubState: "running", UnitFileState: "enabled", MainPID: 812, Restarts: 1},
+	{Name: "backup.service", Description: "Nightly backup", LoadState: "loaded", ActiveState: "failed", SubState: "failed", UnitFileState: "static"},
+	{Name: "gone.service", LoadState: "not-found", ActiveState: "inactive", SubState: "dead"},
+}
+
+func TestReporter(t *testing.T) {
+	hr := controls.NewDefaultHandlerRegistry()
+	client := &mockClient{units: units}
+	r := systemd.NewReporter(client, "host1", hr)
+	defer r.Stop()
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.SystemdUnit.Nodes) != 2 {
+		t.Fatalf("Expected the 2 loaded units, got %d", len(rpt.SystemdUnit.Nodes))
+	}
+	sshd := rpt.SystemdUnit.Nodes[report.MakeSystemdUnitNodeID("host1", "sshd.service")]
+	for key, want := range map[string]string{
+		systemd.UnitName:    "sshd.service",
+		systemd.Description: "OpenSSH Daemon",
+		systemd.ActiveState: "active",
+		systemd.SubState:    "running",
+		systemd.MainPID:     "812",
+		systemd.Restarts:    "1",
+	} {
+		if have, _ := sshd.Latest.Lookup(key); have != want {
+			t.Errorf("%s: expected %q, got %q", key, want, have)
+		}
+	}
+	if hosts, _ := sshd.Parents.Lookup(report.Host); !hosts.Contains(report.MakeHostNodeID("host1")) {
+		t.Errorf("Expected sshd to have host1 as parent, got %v", hosts)
+	}
+
+	// Running units can be restarted and stopped, others started
+	for unit, want := range map[string][]string{
+		"sshd.service":   {systemd.RestartUnit, systemd.StopUnit},
+		"backup.service": {systemd.StartUnit},
+	} {
+		have := []string{}
+		rpt.SystemdUnit.Nodes[report.MakeSystemdUnitNodeID("host1", unit)].LatestControls.ForEach(func(control string, _ time.Time, _ report.NodeControlData) {
+			have = append(have, control)
+		})
+		sort.Strings(want)
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: expected controls %v, got %v", unit, want, have)
+		}
+	}
+
+	// Controls go to systemd
+	resp := hr.HandleControlRequest(xfer.Request{
+		Control: systemd.StartUnit,
+		NodeID:  report.MakeSystemdUnitNodeID("host1", "backup.service"),
+	})
+	if resp.Error != "" {
+		t.Errorf("Unexpected error starting a unit: %s", resp.Error)
+	}
+	for _, nodeID := range []string{
+		report.MakeSystemdUnitNodeID("host2", "backup.service"),
+		report.MakeSystemdUnitNodeID("host1", "missing.service"),
+	} {
+		if resp := hr.HandleControlRequest(xfer.Request{Control: systemd.StopUnit, NodeID: nodeID}); resp.Error == "" {
+			t.Errorf("Expected an error stopping %s", nodeID)
+		}
+	}
+	if want := []string{"start backup.service"}; !reflect.DeepEqual(client.controls, want) {
+		t.Errorf("Expected %v, got %v", want, client.controls)
+	}
+}
+
+func TestTagger(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	oldRoot, oldProcRoot := cgroup.Root, cgroup.ProcRoot
+	defer func() { cgroup.Root, cgroup.ProcRoot = oldRoot, oldProcRoot }()
+	cgroup.Root, cgroup.ProcRoot = filepath.Join(root, "sys/fs/cgroup"), filepath.Join(root, "proc")
+	for pid, lines := range map[string]string{
+		"812": "4:memory:/system.slice/sshd.service\n1:name=systemd:/system.slice/sshd.service\n",
+		"900": "1:name=systemd:/docker/abcdef\n",
+		"901": "1:name=systemd:/user.slice/user-1000.slice/session-2.scope\n",
+	} {
+		path := filepath.Join(cgroup.ProcRoot, pid, "cgroup")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(lines), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rpt := report.MakeReport()
+	for _, pid := range []string{"812", "900", "901", "902"} {
+		rpt.Process.AddNode(report.MakeNodeWith(report.MakeProcessNodeID("host1", pid), map[string]string{process.PID: pid}))
+	}
+	r := systemd.NewReporter(&mockClient{}, "host1", controls.NewDefaultHandlerRegistry())
+	defer r.Stop()
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pid, want := range map[string]string{
+		"812": report.MakeSystemdUnitNodeID("host1", "sshd.service"),
+		"900": "",
+		"901": "",
+		"902": "", // gone
+	} {
+		units, _ := rpt.Process.Nodes[report.MakeProcessNodeID("host1", pid)].Parents.Lookup(report.SystemdUnit)
+		if want == "" && len(units) != 0 || want != "" && !units.Contains(want) {
+			t.Errorf("%s: expected unit %q, got %v", pid, want, units)
+		}
+	}
+}
+
+func TestUnitOfCgroup(t *testing.T) {
+	for path, want := range map[string]string{
+		"/system.slice/sshd.service":                                 "sshd.service",
+		"/system.slice/docker.service/payload":                       "docker.service",
+		"/user.slice/user-1000.slice/user@1000.service/app.slice":    "user@1000.service",
+		"/system.slice/docker-0123456789abcdef.scope":                "",
+		"/kubepods/besteffort/pod1234/0123456789abcdef0123456789abc": "",
+	} {
+		if have, _ := systemd.UnitOfCgroup(path); have != want {
+			t.Errorf("%s: expected %q, got %q", path, want, have)
+		}
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	names := systemd.ParseUnitNames([]byte(`sshd.service   loaded    active   running OpenSSH Daemon
+backup.service loaded    failed   failed  Nightly backup
+gone.service   not-found inactive dead    gone.service
+`))
+	if want := []string{"sshd.service", "backup.service"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+
+	have := systemd.ParseUnits([]byte(`Id=sshd.service
+Description=OpenSSH Daemon
+LoadState=loaded
+ActiveState=active
+SubState=running
+UnitFileState=enabled
+MainPID=812
+NRestarts=1
+
+Id=backup.service
+Description=Nightly backup = safety
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+UnitFileState=static
+MainPID=0
+NRestarts=0
+`))
+	want := []systemd.Unit{
+		units[0],
+		{Name: "backup.service", Description: "Nightly backup = safety", LoadState: "loaded", ActiveState: "failed", SubState: "failed", UnitFileState: "static"},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
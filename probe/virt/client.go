@@ -0,0 +1,184 @@
+package virt
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Domain is a libvirt domain, a virtual machine, with its stats.
+type Domain struct {
+	Name       string
+	State      string // like "running", "paused" or "shut off"
+	VCPUs      int
+	CPUTime    uint64 // nanoseconds, of all vCPUs
+	Memory     uint64 // bytes, currently ballooned to
+	MaxMemory  uint64 // bytes
+	MemoryUsed uint64 // bytes, resident on the host; 0 if unknown
+	Interfaces []Interface
+}
+
+// Interface is a network interface of a domain. Name is the one of the tap
+// device of the host it is plugged into, like "vnet0".
+type Interface struct {
+	Name    string
+	MAC     string
+	IPs     []string
+	RxBytes uint64
+	TxBytes uint64
+}
+
+// Client talks to libvirt. Exposed for testing.
+type Client interface {
+	// Domains gives the domains of the host, running or not.
+	Domains() ([]Domain, error)
+}
+
+// virsh is the command line client of libvirt. Going through it means the
+// probe needs no libvirt library, only the virsh of the host and the socket
+// of its libvirtd.
+var virsh = "virsh"
+
+// states are the names of the values of state.state of domstats, of
+// virDomainState.
+var states = []string{"no state", "running", "blocked", "paused", "shutting down", "shut off", "crashed", "suspended"}
+
+type client struct {
+	path string
+}
+
+// NewClient makes a client of the libvirtd of the host, if virsh is there.
+func NewClient() (Client, error) {
+	path, err := exec.LookPath(virsh)
+	if err != nil {
+		return nil, err
+	}
+	return &client{path: path}, nil
+}
+
+func (c *client) Domains() ([]Domain, error) {
+	out, err := exec.Command(c.path, "--readonly", "domstats", "--raw", "--state", "--cpu-total", "--balloon", "--vcpu", "--interface").Output()
+	if err != nil {
+		return nil, err
+	}
+	domains := ParseDomainStats(out)
+	for i, d := range domains {
+		if d.State != "running" {
+			continue
+		}
+		// Leases only know of the addresses of domains on networks libvirt
+		// runs the DHCP of; the ARP table of the host knows of the others.
+		addrs := c.interfaceAddresses(d.Name, "lease")
+		if len(addrs) == 0 {
+			addrs = c.interfaceAddresses(d.Name, "arp")
+		}
+		for j, iface := range d.Interfaces {
+			if addr, ok := addrs[iface.Name]; ok {
+				domains[i].Interfaces[j].MAC = addr.MAC
+				domains[i].Interfaces[j].IPs = addr.IPs
+			}
+		}
+	}
+	return domains, nil
+}
+
+func (c *client) interfaceAddresses(domain, source string) map[string]Interface {
+	out, err := exec.Command(c.path, "--readonly", "domifaddr", "--source", source, "--", domain).Output()
+	if err != nil {
+		return nil
+	}
+	return ParseInterfaceAddresses(out)
+}
+
+// ParseDomainStats parses the output of virsh domstats --raw, of blocks of
+// "Domain: 'name'" followed by "key=value" stats. Exposed for testing.
+func ParseDomainStats(out []byte) []Domain {
+	domains := []Domain{}
+	var domain *Domain
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Domain:") {
+			domains = append(domains, Domain{Name: strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "Domain:")), "'")})
+			domain = &domains[len(domains)-1]
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if domain == nil || len(kv) != 2 {
+			continue
+		}
+		key, value := kv[0], kv[1]
+		number, _ := strconv.ParseUint(value, 10, 64)
+		switch key {
+		case "state.state":
+			if number < uint64(len(states)) {
+				domain.State = states[number]
+			}
+		case "cpu.time":
+			domain.CPUTime = number
+		case "vcpu.current":
+			domain.VCPUs = int(number)
+		case "balloon.current":
+			domain.Memory = number * 1024
+		case "balloon.maximum":
+			domain.MaxMemory = number * 1024
+		case "balloon.rss":
+			domain.MemoryUsed = number * 1024
+		default:
+			// Interfaces are like "net.0.name=vnet0"
+			fields := strings.SplitN(key, ".", 3)
+			if len(fields) != 3 || fields[0] != "net" {
+				continue
+			}
+			i, err := strconv.Atoi(fields[1])
+			if err != nil {
+				continue
+			}
+			for len(domain.Interfaces) <= i {
+				domain.Interfaces = append(domain.Interfaces, Interface{})
+			}
+			switch fields[2] {
+			case "name":
+				domain.Interfaces[i].Name = value
+			case "rx.bytes":
+				domain.Interfaces[i].RxBytes = number
+			case "tx.bytes":
+				domain.Interfaces[i].TxBytes = number
+			}
+		}
+	}
+	return domains
+}
+
+// ParseInterfaceAddresses parses the output of virsh domifaddr, a table of
+// interfaces, MACs and addresses, by the name of the interfaces. Addresses
+// after the first of an interface have "-" for its name and MAC. Exposed for
+// testing.
+func ParseInterfaceAddresses(out []byte) map[string]Interface {
+	result := map[string]Interface{}
+	var name string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		if fields[0] != "-" {
+			name = fields[0]
+		}
+		if name == "" {
+			continue
+		}
+		iface := result[name]
+		if fields[1] != "-" {
+			iface.MAC = fields[1]
+		}
+		if ip := strings.SplitN(fields[3], "/", 2)[0]; ip != "" {
+			iface.IPs = append(iface.IPs, ip)
+		}
+		result[name] = iface
+	}
+	return result
+}
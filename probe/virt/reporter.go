@@ -0,0 +1,131 @@
+package virt
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	DomainName    = "virt_domain_name"
+	State         = "virt_domain_state"
+	VCPUs         = "virt_domain_vcpus"
+	MaxMemory     = "virt_domain_max_memory"
+	IPs           = "virt_domain_ips"
+	IPsWithScopes = "virt_domain_ips_with_scopes"
+	MACs          = "virt_domain_macs"
+	CPUUsage      = "virt_domain_cpu_usage_percent"
+	MemoryUsage   = "virt_domain_memory_usage_bytes"
+)
+
+// Exposed for testing
+var (
+	VirtualMachineMetadataTemplates = report.MetadataTemplates{
+		State:     {ID: State, Label: "State", From: report.FromLatest, Priority: 1},
+		VCPUs:     {ID: VCPUs, Label: "vCPUs", From: report.FromLatest, Datatype: "number", Priority: 2},
+		MaxMemory: {ID: MaxMemory, Label: "Max Memory", From: report.FromLatest, Datatype: "number", Priority: 3},
+		IPs:       {ID: IPs, Label: "IPs", From: report.FromSets, Priority: 4},
+		MACs:      {ID: MACs, Label: "MACs", From: report.FromSets, Priority: 5},
+	}
+
+	VirtualMachineMetricTemplates = report.MetricTemplates{
+		CPUUsage:    {ID: CPUUsage, Label: "vCPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+	}
+)
+
+type cpuSample struct {
+	cpuTime uint64
+	at      time.Time
+}
+
+// Reporter generates Reports containing the VirtualMachine topology of the
+// libvirt domains of the host.
+type Reporter struct {
+	client Client
+	hostID string
+	last   map[string]cpuSample
+}
+
+// NewReporter makes a new Reporter.
+func NewReporter(client Client, hostID string) *Reporter {
+	return &Reporter{
+		client: client,
+		hostID: hostID,
+		last:   map[string]cpuSample{},
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Virt" }
+
+// Report generates a Report containing the VirtualMachine topology, and the
+// tap devices of the host the interfaces of VMs are plugged into as adjacent
+// to them.
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.VirtualMachine = result.VirtualMachine.
+		WithMetadataTemplates(VirtualMachineMetadataTemplates).
+		WithMetricTemplates(VirtualMachineMetricTemplates)
+
+	domains, err := r.client.Domains()
+	if err != nil {
+		return result, err
+	}
+	now := mtime.Now()
+	hostNodeID := report.MakeHostNodeID(r.hostID)
+	last := map[string]cpuSample{}
+	for _, d := range domains {
+		nodeID := report.MakeVirtualMachineNodeID(r.hostID, d.Name)
+		node := report.MakeNodeWith(nodeID, map[string]string{
+			DomainName: d.Name,
+			State:      d.State,
+			VCPUs:      strconv.Itoa(d.VCPUs),
+		}).WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID)))
+		if d.MaxMemory > 0 {
+			node = node.WithLatests(map[string]string{MaxMemory: strconv.FormatUint(d.MaxMemory, 10)})
+		}
+
+		if d.State == "running" {
+			sample := cpuSample{cpuTime: d.CPUTime, at: now}
+			if prev, ok := r.last[d.Name]; ok && d.VCPUs > 0 && sample.cpuTime >= prev.cpuTime && sample.at.After(prev.at) {
+				usage := float64(sample.cpuTime-prev.cpuTime) / float64(sample.at.Sub(prev.at).Nanoseconds()*int64(d.VCPUs)) * 100.
+				node = node.WithMetric(CPUUsage, report.MakeSingletonMetric(now, usage).WithMax(100))
+			}
+			last[d.Name] = sample
+			if d.MemoryUsed > 0 {
+				node = node.WithMetric(MemoryUsage, report.MakeSingletonMetric(now, float64(d.MemoryUsed)).WithMax(float64(d.Memory)))
+			}
+		}
+
+		var ips, ipsWithScopes, macs []string
+		for _, iface := range d.Interfaces {
+			if iface.MAC != "" {
+				macs = append(macs, iface.MAC)
+			}
+			for _, ip := range iface.IPs {
+				ips = append(ips, ip)
+				// Like those of containers, the addresses of VMs are mostly
+				// on networks of the host, like the NAT of libvirt
+				ipsWithScopes = append(ipsWithScopes, report.MakeAddressNodeID(r.hostID, ip))
+			}
+			if iface.Name != "" && d.State == "running" {
+				result.NetIface.AddNode(report.MakeNode(report.MakeNetIfaceNodeID(r.hostID, iface.Name)).WithAdjacent(nodeID))
+			}
+		}
+		if len(ips) > 0 {
+			node = node.WithSets(report.MakeSets().
+				Add(IPs, report.MakeStringSet(ips...)).
+				Add(IPsWithScopes, report.MakeStringSet(ipsWithScopes...)))
+		}
+		if len(macs) > 0 {
+			node = node.WithSet(MACs, report.MakeStringSet(macs...))
+		}
+		result.VirtualMachine.AddNode(node)
+	}
+	r.last = last
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package virt_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/virt"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient struct {
+	domains []virt.Domain
+}
+
+func (c *mockClient) Domains() ([]virt.Domain, error) {
+	return c.domains, nil
+}
+
+func TestReporter(t *testing.T) {
+	client := &mockClient{domains: []virt.Domain{
+		{
+			Name: "web1", State: "running", VCPUs: 2, CPUTime: 1e9,
+			Memory: 2 << 30, MaxMemory: 4 << 30, MemoryUsed: 1 << 30,
+			Interfaces: []virt.Interface{{Name: "vnet0", MAC: "52:54:00:8a:1b:2c", IPs: []string{"192.168.122.45"}}},
+		},
+		{Name: "build", State: "shut off", VCPUs: 4, MaxMemory: 8 << 30},
+	}}
+	r := virt.NewReporter(client, "host1")
+	start := time.Unix(1500000000, 0)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.VirtualMachine.Nodes) != 2 {
+		t.Fatalf("Expected 2 VMs, got %d", len(rpt.VirtualMachine.Nodes))
+	}
+	webID := report.MakeVirtualMachineNodeID("host1", "web1")
+	web := rpt.VirtualMachine.Nodes[webID]
+	for key, want := range map[string]string{
+		virt.DomainName: "web1",
+		virt.State:      "running",
+		virt.VCPUs:      "2",
+		virt.MaxMemory:  "4294967296",
+	} {
+		if have, _ := web.Latest.Lookup(key); have != want {
+			t.Errorf("%s: expected %q, got %q", key, want, have)
+		}
+	}
+	if hosts, _ := web.Parents.Lookup(report.Host); !hosts.Contains(report.MakeHostNodeID("host1")) {
+		t.Errorf("Expected web1 to have host1 as parent, got %v", hosts)
+	}
+	if ips, _ := web.Sets.Lookup(virt.IPsWithScopes); !reflect.DeepEqual(ips, report.MakeStringSet(report.MakeAddressNodeID("host1", "192.168.122.45"))) {
+		t.Errorf("Unexpected IPs %v", ips)
+	}
+	if memory, ok := web.Metrics[virt.MemoryUsage]; !ok || memory.Max != 2<<30 {
+		t.Errorf("Expected memory usage out of the ballooned memory, got %v", memory)
+	}
+	if _, ok := web.Metrics[virt.CPUUsage]; ok {
+		t.Errorf("Expected no CPU usage before the second report")
+	}
+	if tap, ok := rpt.NetIface.Nodes[report.MakeNetIfaceNodeID("host1", "vnet0")]; !ok || !tap.Adjacency.Contains(webID) {
+		t.Errorf("Expected vnet0 to be adjacent to web1, got %v", tap)
+	}
+
+	// 1.5s of vCPU time over 1s of 2 vCPUs
+	client.domains[0].CPUTime += 15e8
+	mtime.NowForce(start.Add(time.Second))
+	if rpt, err = r.Report(); err != nil {
+		t.Fatal(err)
+	}
+	metric, ok := rpt.VirtualMachine.Nodes[webID].Metrics[virt.CPUUsage]
+	if !ok {
+		t.Fatal("Expected the CPU usage of web1")
+	}
+	if value, _ := metric.LastSample(); value.Value != 75 {
+		t.Errorf("Expected 75%% vCPU usage, got %v", value.Value)
+	}
+	if _, ok := rpt.VirtualMachine.Nodes[report.MakeVirtualMachineNodeID("host1", "build")].Metrics[virt.CPUUsage]; ok {
+		t.Errorf("Expected no CPU usage of the shut off VM")
+	}
+}
+
+func TestParseDomainStats(t *testing.T) {
+	have := virt.ParseDomainStats([]byte(`Domain: 'web1'
+  state.state=1
+  state.reason=1
+  cpu.time=123456789
+  cpu.user=100000000
+  balloon.current=2097152
+  balloon.maximum=4194304
+  balloon.rss=1048576
+  vcpu.current=2
+  vcpu.maximum=2
+  net.count=1
+  net.0.name=vnet0
+  net.0.rx.bytes=1234
+  net.0.tx.bytes=5678
+
+Domain: 'build'
+  state.state=5
+  state.reason=1
+  balloon.maximum=8388608
+  vcpu.current=4
+  net.count=0
+
+`))
+	want := []virt.Domain{
+		{
+			Name: "web1", State: "running", VCPUs: 2, CPUTime: 123456789,
+			Memory: 2 << 30, MaxMemory: 4 << 30, MemoryUsed: 1 << 30,
+			Interfaces: []virt.Interface{{Name: "vnet0", RxBytes: 1234, TxBytes: 5678}},
+		},
+		{Name: "build", State: "shut off", VCPUs: 4, MaxMemory: 8 << 30},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
+
+func TestParseInterfaceAddresses(t *testing.T) {
+	have := virt.ParseInterfaceAddresses([]byte(` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+ vnet0      52:54:00:8a:1b:2c    ipv4         192.168.122.45/24
+ -          -                    ipv6         fd00::45/64
+ vnet1      52:54:00:8a:1b:2d    ipv4         10.0.0.7/8
+`))
+	want := map[string]virt.Interface{
+		"vnet0": {MAC: "52:54:00:8a:1b:2c", IPs: []string{"192.168.122.45", "fd00::45"}},
+		"vnet1": {MAC: "52:54:00:8a:1b:2d", IPs: []string{"10.0.0.7"}},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -13,7 +14,9 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	awssdk "github.com/aws/aws-sdk-go/aws"
 	"github.com/gorilla/mux"
+	_ "github.com/lib/pq" // registers the "postgres" driver of the postgres collector
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tylerb/graceful"
 
@@ -27,6 +30,8 @@ import (
 	"github.com/weaveworks/scope/common/weave"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/weave/common"
 )
 
@@ -50,17 +55,45 @@ func init() {
 }
 
 // Router creates the mux for all the various app components.
-func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter app.PipeRouter, externalUI bool, capabilities map[string]bool, metricsGraphURL string) http.Handler {
+func router(collector app.Collector, baselines *app.ReportBaselines, quarantine *app.ReportQuarantine, searches *app.Searches, annotations *app.NodeAnnotations, layouts *app.Layouts, views *app.Views, enrollments *app.Enrollments, alerter *app.Alerter, sharding *app.Sharding, controlRouter app.ControlRouter, pipeRouter app.PipeRouter, externalUI, debugPprof, debugRenderStats bool, capabilities map[string]bool, metricsGraphURL string, metricHistory report.MetricHistory, anomalies report.Anomalies) http.Handler {
 	router := mux.NewRouter().SkipClean(true)
 
 	// We pull in the http.DefaultServeMux to get the pprof routes
-	router.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
+	if debugPprof {
+		router.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
+	}
 	router.Path("/metrics").Handler(prometheus.Handler())
 
-	app.RegisterReportPostHandler(collector, router)
+	app.RegisterReportPostHandler(collector, router, baselines, quarantine)
 	app.RegisterControlRoutes(router, controlRouter)
 	app.RegisterPipeRoutes(router, pipeRouter)
-	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: collector, MetricsGraphURL: metricsGraphURL}, capabilities)
+	webReporter := app.WebReporter{Reporter: collector, MetricsGraphURL: metricsGraphURL, MetricHistory: metricHistory, Anomalies: anomalies, Quarantine: quarantine}
+	if annotations != nil {
+		webReporter.Annotations = annotations
+		app.RegisterAnnotationRoutes(router, annotations)
+	}
+	app.RegisterTopologyRoutes(router, webReporter, capabilities)
+	if debugRenderStats {
+		app.RegisterRenderStatsRoutes(router, webReporter)
+	}
+	if searches != nil {
+		app.RegisterSearchRoutes(router, searches)
+	}
+	if layouts != nil {
+		app.RegisterLayoutRoutes(router, layouts)
+	}
+	if views != nil {
+		app.RegisterViewRoutes(router, views)
+	}
+	if enrollments != nil {
+		app.RegisterEnrollmentRoutes(router, enrollments)
+	}
+	if alerter != nil {
+		app.RegisterAlertRoutes(router, alerter)
+	}
+	if sharding != nil {
+		app.RegisterShardingRoutes(router, sharding)
+	}
 
 	uiHandler := http.FileServer(GetFS(externalUI))
 	router.PathPrefix("/ui").Name("static").Handler(
@@ -76,7 +109,7 @@ func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter
 }
 
 func collectorFactory(userIDer multitenant.UserIDer, collectorURL, s3URL, natsHostname string,
-	memcacheConfig multitenant.MemcacheConfig, window time.Duration, createTables bool) (app.Collector, error) {
+	memcacheConfig multitenant.MemcacheConfig, window, retention time.Duration, createTables bool) (app.Collector, error) {
 	if collectorURL == "local" {
 		return app.NewCollector(window), nil
 	}
@@ -88,7 +121,14 @@ func collectorFactory(userIDer multitenant.UserIDer, collectorURL, s3URL, natsHo
 
 	switch parsed.Scheme {
 	case "file":
-		return app.NewFileCollector(parsed.Path, window)
+		// Timestamped reports are replayed sped up by ?speed=
+		speed := 1.0
+		if s := parsed.Query().Get("speed"); s != "" {
+			if speed, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("Invalid replay speed %q: %v", s, err)
+			}
+		}
+		return app.NewFileCollector(parsed.Path, window, speed)
 	case "dynamodb":
 		s3, err := url.Parse(s3URL)
 		if err != nil {
@@ -129,6 +169,25 @@ func collectorFactory(userIDer multitenant.UserIDer, collectorURL, s3URL, natsHo
 			}
 		}
 		return awsCollector, nil
+	case "postgres":
+		db, err := sql.Open("postgres", collectorURL)
+		if err != nil {
+			return nil, err
+		}
+		postgresCollector := multitenant.NewPostgresCollector(
+			multitenant.PostgresCollectorConfig{
+				UserIDer:  userIDer,
+				DB:        db,
+				Window:    window,
+				Retention: retention,
+			},
+		)
+		if createTables {
+			if err := postgresCollector.CreateTables(); err != nil {
+				return nil, err
+			}
+		}
+		return postgresCollector, nil
 	}
 
 	return nil, fmt.Errorf("Invalid collector '%s'", collectorURL)
@@ -195,6 +254,85 @@ func pipeRouterFactory(userIDer multitenant.UserIDer, pipeRouterURL, consulInf s
 	return nil, fmt.Errorf("Invalid pipe router '%s'", pipeRouterURL)
 }
 
+// gcsHost is the host of the S3-compatible API of Google Cloud Storage.
+const gcsHost = "storage.googleapis.com"
+
+func snapshotStoreFactory(snapshotsURL string) (app.SnapshotStore, string, error) {
+	parsed, err := url.Parse(snapshotsURL)
+	if err != nil {
+		return nil, "", err
+	}
+	bucketName, prefix := app.ParseSnapshotPath(parsed.Path)
+	if bucketName == "" {
+		return nil, "", fmt.Errorf("Snapshot store %q has no bucket", snapshotsURL)
+	}
+	var config *awssdk.Config
+	switch parsed.Scheme {
+	case "s3":
+		config, err = aws.ConfigFromURL(parsed)
+	case "gs":
+		// GCS is written to through its S3-compatible API
+		if parsed.Host == "" {
+			parsed.Host = gcsHost
+		}
+		if config, err = aws.ConfigFromURL(parsed); err == nil {
+			config = config.WithEndpoint("https://" + parsed.Host).WithRegion("auto").WithS3ForcePathStyle(true)
+		}
+	default:
+		return nil, "", fmt.Errorf("Invalid snapshot store '%s'", snapshotsURL)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	store := multitenant.NewS3Client(config, bucketName)
+	return &store, prefix, nil
+}
+
+func vulnerabilityScannerFactory(scanner string) (app.VulnerabilityScanner, error) {
+	if scanner == "trivy" {
+		return app.TrivyScanner{Path: "trivy"}, nil
+	}
+	parsed, err := url.Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme {
+	case "trivy":
+		return app.TrivyScanner{Path: "trivy", Server: "http://" + parsed.Host}, nil
+	case "http", "https":
+		return app.HTTPScanner{URL: scanner, Client: &http.Client{Timeout: 5 * time.Minute}}, nil
+	}
+	return nil, fmt.Errorf("Invalid vulnerability scanner '%s'", scanner)
+}
+
+func authenticatorFactory(flags appFlags, enrollments *app.Enrollments) (app.Authenticator, error) {
+	var authenticators app.Authenticators
+	if flags.authTokensFile != "" {
+		tokens, err := app.NewStaticTokens(flags.authTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if flags.authOIDCIssuer != "" {
+		if flags.authOIDCClientID == "" {
+			return nil, fmt.Errorf("An OpenID Connect client ID is needed to authenticate with %s", flags.authOIDCIssuer)
+		}
+		authenticators = append(authenticators, app.NewOIDC(flags.authOIDCIssuer, flags.authOIDCClientID, flags.authOIDCGroupsClaim, flags.authOIDCAdminGroup))
+	}
+	if enrollments != nil {
+		// Only admins can mint enrollment tokens, so someone must be one
+		if len(authenticators) == 0 {
+			return nil, fmt.Errorf("Enrolling probes needs -app.auth.tokens-file or -app.auth.oidc.issuer for the admins minting enrollment tokens")
+		}
+		authenticators = append(authenticators, enrollments)
+	}
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return authenticators, nil
+}
+
 // Main runs the app
 func appMain(flags appFlags) {
 	setLogLevel(flags.logLevel)
@@ -208,6 +346,20 @@ func appMain(flags appFlags) {
 	log.Infof("app starting, version %s, ID %s", app.Version, app.UniqueID)
 	logCensoredArgs()
 
+	if flags.topologiesFile != "" {
+		topologies, err := app.LoadCustomTopologies(flags.topologiesFile)
+		if err != nil {
+			log.Fatalf("Error loading custom topologies: %v", err)
+			return
+		}
+		if err := app.AddCustomTopologies(topologies...); err != nil {
+			log.Fatalf("Error adding custom topologies: %v", err)
+			return
+		}
+	}
+
+	render.SetCacheSize(flags.renderCacheSize)
+
 	userIDer := multitenant.NoopUserIDer
 	if flags.userIDHeader != "" {
 		userIDer = multitenant.UserIDHeader(flags.userIDHeader)
@@ -223,7 +375,7 @@ func appMain(flags appFlags) {
 			Service:          flags.memcachedService,
 			CompressionLevel: flags.memcachedCompressionLevel,
 		},
-		flags.window, flags.awsCreateTables)
+		flags.window, flags.collectorRetention, flags.awsCreateTables)
 	if err != nil {
 		log.Fatalf("Error creating collector: %v", err)
 		return
@@ -239,18 +391,187 @@ func appMain(flags appFlags) {
 		collector = billingEmitter
 	}
 
+	// Topology metrics need the report of a single user, so they are only
+	// exported by single-tenant apps.
+	if flags.userIDHeader == "" {
+		prometheus.MustRegister(app.NewTopologyMetrics(collector))
+	}
+
+	// Likewise, the history of metrics is kept in memory for a single user.
+	var metricHistory report.MetricHistory
+	if flags.userIDHeader == "" && flags.metricHistoryPoints > 0 {
+		history := app.NewMetricHistory(collector, flags.metricHistoryPoints)
+		collector, metricHistory = history, history
+	}
+
+	// And so are the baselines of the anomaly detector.
+	var anomalies report.Anomalies
+	if flags.userIDHeader == "" && flags.anomalyThreshold > 0 {
+		detector := app.NewAnomalyDetector(collector, flags.anomalyAlpha, flags.anomalyThreshold)
+		collector, anomalies = detector, detector
+	}
+
 	controlRouter, err := controlRouterFactory(userIDer, flags.controlRouterURL)
 	if err != nil {
 		log.Fatalf("Error creating control router: %v", err)
 		return
 	}
 
+	// Pushing intervals down to probes needs their control connections to
+	// this app.
+	if flags.userIDHeader == "" && (flags.probeSpyInterval > 0 || flags.probePublishInterval > 0) {
+		collector = app.NewProbeIntervals(collector, controlRouter, flags.probeSpyInterval, flags.probePublishInterval)
+	}
+
 	pipeRouter, err := pipeRouterFactory(userIDer, flags.pipeRouterURL, flags.consulInf)
 	if err != nil {
 		log.Fatalf("Error creating pipe router: %v", err)
 		return
 	}
 
+	// Sharding probes between apps, which each keep the reports of their
+	// probes in memory, only works for a single user.
+	var sharding *app.Sharding
+	if flags.userIDHeader == "" && flags.shardingAdvertise != "" {
+		if flags.shardingToken == "" {
+			log.Fatal("-app.sharding.token is required with -app.sharding.advertise")
+			return
+		}
+		sharding = app.NewSharding(collector, flags.shardingAdvertise, flags.shardingToken, strings.Split(flags.shardingPeers, ","), flags.shardingInterval)
+		defer sharding.Stop()
+		collector = sharding
+		controlRouter = sharding.ControlRouter(controlRouter)
+	}
+
+	// Reports consumed from NATS are of a single user.
+	if flags.userIDHeader == "" && flags.natsConsumeURL != "" {
+		consumer, err := app.NewNATSConsumer(collector, flags.natsConsumeURL, flags.natsSubject, flags.natsQueue)
+		if err != nil {
+			log.Fatalf("Error consuming reports from NATS: %v", err)
+			return
+		}
+		defer consumer.Stop()
+	}
+
+	// Federating downstream apps merges their reports into those of this
+	// app, which only works for a single user.
+	if flags.userIDHeader == "" && len(flags.federationDownstreams) > 0 {
+		federation := app.NewFederation(collector, flags.federationDownstreams, flags.federationInterval)
+		defer federation.Stop()
+		collector = federation
+		controlRouter = federation.ControlRouter(controlRouter)
+		pipeRouter = federation.PipeRouter(pipeRouter)
+	}
+
+	// Costs are estimated from the machine types of hosts, which their
+	// probes report when on the cloud.
+	if flags.costs {
+		prices := app.DefaultInstancePrices
+		if flags.costsPricesFile != "" {
+			if prices, err = app.LoadInstancePrices(flags.costsPricesFile); err != nil {
+				log.Fatalf("Error loading instance prices: %v", err)
+				return
+			}
+		}
+		collector = app.NewCostCollector(collector, prices)
+	}
+
+	// Images are scanned once for everyone, by their digests.
+	if flags.vulnerabilityScanner != "" {
+		scanner, err := vulnerabilityScannerFactory(flags.vulnerabilityScanner)
+		if err != nil {
+			log.Fatalf("Error creating vulnerability scanner: %v", err)
+			return
+		}
+		vulnerabilities := app.NewVulnerabilityCollector(collector, scanner, flags.vulnerabilityTTL, flags.vulnerabilityWorkers)
+		defer vulnerabilities.Stop()
+		collector = vulnerabilities
+	}
+
+	// Tags are looked up once for everyone, anonymously.
+	if flags.registryMetadata {
+		registry := app.NewRegistryCollector(collector, app.RegistryClient{Client: &http.Client{Timeout: time.Minute}}, flags.registryTTL)
+		defer registry.Stop()
+		collector = registry
+	}
+
+	// External addresses are classified by the same ranges for everyone.
+	if flags.knownServices {
+		var sources []string
+		if flags.knownServicesRanges != "" {
+			sources = strings.Split(flags.knownServicesRanges, ",")
+		}
+		knownServices := app.NewKnownServiceCollector(collector, &http.Client{Timeout: time.Minute}, sources, flags.knownServicesRefresh)
+		defer knownServices.Stop()
+		collector = knownServices
+	}
+
+	// External addresses are looked up once for everyone.
+	if flags.reverseDNS || flags.geoIPFile != "" {
+		var resolver app.ReverseResolver
+		if flags.reverseDNS {
+			resolver = app.LookupAddr
+		}
+		var geoIP app.GeoIPDatabase
+		if flags.geoIPFile != "" {
+			if geoIP, err = app.LoadGeoIPDatabase(flags.geoIPFile); err != nil {
+				log.Fatalf("Error loading GeoIP database: %v", err)
+				return
+			}
+		}
+		reverseDNS := app.NewReverseDNSCollector(collector, resolver, geoIP, flags.reverseDNSTTL)
+		defer reverseDNS.Stop()
+		collector = reverseDNS
+	}
+
+	// Snapshots are of the topologies of a single user.
+	if flags.userIDHeader == "" && flags.snapshotsURL != "" {
+		store, prefix, err := snapshotStoreFactory(flags.snapshotsURL)
+		if err != nil {
+			log.Fatalf("Error creating snapshot store: %v", err)
+			return
+		}
+		snapshotter := app.NewTopologySnapshotter(collector, store, prefix, flags.snapshotsInterval, flags.snapshotsRetention)
+		defer snapshotter.Stop()
+	}
+
+	// Alerts are on the topologies of a single user.
+	var alerter *app.Alerter
+	if flags.userIDHeader == "" && flags.alertRulesFile != "" {
+		rules, err := app.LoadAlertRules(flags.alertRulesFile)
+		if err != nil {
+			log.Fatalf("Error loading alert rules: %v", err)
+			return
+		}
+		var sinks app.AlertSinks
+		for _, sinkURL := range strings.Split(flags.alertSinks, ",") {
+			if sinkURL == "" {
+				continue
+			}
+			sink, err := app.NewAlertSink(sinkURL)
+			if err != nil {
+				log.Fatalf("Error creating alert sink: %v", err)
+				return
+			}
+			sinks = append(sinks, sink)
+		}
+		alerter = app.NewAlerter(collector, rules, sinks, flags.alertInterval)
+		defer alerter.Stop()
+	}
+
+	if flags.auditSinks != "" {
+		var sinks app.AuditSinks
+		for _, sinkURL := range strings.Split(flags.auditSinks, ",") {
+			sink, err := app.NewAuditSink(sinkURL)
+			if err != nil {
+				log.Fatalf("Error creating audit sink: %v", err)
+				return
+			}
+			sinks = append(sinks, sink)
+		}
+		controlRouter = app.NewAuditingControlRouter(controlRouter, sinks)
+	}
+
 	// Start background version checking
 	checkpoint.CheckInterval(&checkpoint.CheckParams{
 		Product: "scope-app",
@@ -266,6 +587,13 @@ func appMain(flags appFlags) {
 		}
 	})
 
+	if flags.probeUpdateVersion != "" {
+		if flags.probeUpdateURL == "" || flags.probeUpdateSignature == "" {
+			log.Fatalf("--app.probe.update.version needs --app.probe.update.url and --app.probe.update.signature")
+		}
+		app.AdvertiseProbeUpdate(flags.probeUpdateVersion, flags.probeUpdateURL, flags.probeUpdateSignature)
+	}
+
 	// Periodically try and register our IP address in WeaveDNS.
 	if flags.weaveEnabled && flags.weaveHostname != "" {
 		weave, err := newWeavePublisher(
@@ -278,10 +606,100 @@ func appMain(flags appFlags) {
 		}
 	}
 
+	// Incremental reports are resolved against the last full report of their
+	// probe, which only works for a single user.
+	var baselines *app.ReportBaselines
+	if flags.userIDHeader == "" {
+		baselines = app.NewReportBaselines()
+	}
+
+	// So is the quarantine of the reports rejected, shown in /api/probes.
+	var quarantine *app.ReportQuarantine
+	if flags.userIDHeader == "" {
+		quarantine = app.NewReportQuarantine()
+	}
+
+	// Saved searches are kept in memory, for a single user.
+	var searches *app.Searches
+	if flags.userIDHeader == "" {
+		searches = app.NewSearches()
+	}
+
+	// Annotations of nodes are for a single user too.
+	var annotations *app.NodeAnnotations
+	if flags.userIDHeader == "" {
+		if annotations, err = app.NewNodeAnnotations(flags.annotationsFile); err != nil {
+			log.Fatalf("Error loading annotations: %v", err)
+			return
+		}
+	}
+
+	// Layouts are by the names of the users of a single tenant.
+	var layouts *app.Layouts
+	if flags.userIDHeader == "" {
+		if layouts, err = app.NewLayouts(flags.layoutsFile); err != nil {
+			log.Fatalf("Error loading layouts: %v", err)
+			return
+		}
+	}
+
+	// Views are linked to within a single tenant too.
+	var views *app.Views
+	if flags.userIDHeader == "" {
+		if views, err = app.NewViews(flags.viewsFile); err != nil {
+			log.Fatalf("Error loading views: %v", err)
+			return
+		}
+	}
+
+	// Probes enroll with a single app, for a single user.
+	var enrollments *app.Enrollments
+	if flags.enrollment && flags.userIDHeader == "" {
+		if enrollments, err = app.NewEnrollments(flags.enrollmentFile); err != nil {
+			log.Fatalf("Error loading enrollments: %v", err)
+			return
+		}
+	}
+
 	capabilities := map[string]bool{
 		xfer.HistoricReportsCapability: collector.HasHistoricReports(),
+		xfer.ReportV2Capability:        true,
+		xfer.ReportDeltasCapability:    baselines != nil,
+		xfer.SavedSearchesCapability:   searches != nil,
+		xfer.AlertsCapability:          alerter != nil,
+		xfer.AnnotationsCapability:     annotations != nil,
+		xfer.LayoutsCapability:         layouts != nil,
+		xfer.ViewsCapability:           views != nil,
+	}
+	for _, encoding := range xfer.ReportEncodings() {
+		capabilities[xfer.ReportEncodingCapability(encoding)] = true
+	}
+	handler := router(collector, baselines, quarantine, searches, annotations, layouts, views, enrollments, alerter, sharding, controlRouter, pipeRouter, flags.externalUI, flags.debugPprof, flags.debugRenderStats, capabilities, flags.metricsGraphURL, metricHistory, anomalies)
+	if flags.ingestReportsPerSecond > 0 || flags.ingestBytesPerSecond > 0 {
+		handler = app.NewReportRateLimiter(flags.ingestReportsPerSecond, flags.ingestBytesPerSecond).Wrap(handler)
+	}
+	authenticator, err := authenticatorFactory(flags, enrollments)
+	if err != nil {
+		log.Fatalf("Error creating authenticator: %v", err)
+		return
+	}
+	tlsReloader, err := flags.tls.reloader()
+	if err != nil {
+		log.Fatalf("Error loading TLS certificates: %v", err)
+		return
+	}
+	if tlsReloader != nil {
+		defer tlsReloader.Stop()
+	}
+	clientCerts := tlsReloader != nil && flags.tls.caFile != ""
+	if authenticator != nil || clientCerts {
+		handler = app.AuthMiddleware{Authenticator: authenticator, ClientCerts: clientCerts}.Wrap(handler)
+	}
+	if sharding != nil {
+		// The apps of the cluster authenticate each other, bypassing the
+		// authentication of users
+		handler = sharding.Wrap(handler)
 	}
-	handler := router(collector, controlRouter, pipeRouter, flags.externalUI, capabilities, flags.metricsGraphURL)
 	if flags.logHTTP {
 		handler = middleware.Log{
 			LogRequestHeaders: flags.logHTTPHeaders,
@@ -301,6 +719,12 @@ func appMain(flags appFlags) {
 	}
 	go func() {
 		log.Infof("listening on %s", flags.listen)
+		if tlsReloader != nil {
+			if err := server.ListenAndServeTLSConfig(tlsReloader.ServerConfig()); err != nil {
+				log.Error(err)
+			}
+			return
+		}
 		if err := server.ListenAndServe(); err != nil {
 			log.Error(err)
 		}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/cli"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// cliCommands are the subcommands of the command-line client of the app API,
+// run as scope <command>. Each registers its flags, and returns the function
+// running it with the args left.
+var cliCommands = map[string]func(*flag.FlagSet) func(*cli.Client, []string) error{
+	"query":   cliQuery,
+	"top":     cliTop,
+	"exec":    cliExec,
+	"render":  cliRender,
+	"record":  cliRecord,
+	"loadgen": cliLoadgen,
+}
+
+func cliUsage(fs *flag.FlagSet, usage string) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: scope %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+}
+
+func writeJSON(v interface{}) error {
+	if err := codec.NewEncoder(os.Stdout, &codec.JsonHandle{}).Encode(v); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// cliMain runs a subcommand of the command-line client, exiting non-zero if
+// it fails.
+func cliMain(command string, args []string) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	appURL := os.Getenv("SCOPE_APP_URL")
+	if appURL == "" {
+		appURL = "localhost:4040"
+	}
+	fs.StringVar(&appURL, "app", appURL, "URL of the app (or set SCOPE_APP_URL)")
+	token := fs.String("token", os.Getenv("SCOPE_TOKEN"), "Bearer token to authenticate with (or set SCOPE_TOKEN)")
+	run := cliCommands[command](fs)
+	fs.Parse(args)
+
+	client, err := cli.NewClient(appURL, *token)
+	if err == nil {
+		err = run(client, fs.Args())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scope %s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func cliQuery(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "query [flags] [topology]\n\nLists the topologies, or the nodes of one.")
+	format := fs.String("format", cli.TableFormat, "Output format: table|tree|json")
+	search := fs.String("q", "", "Only show the nodes matching this search query")
+	return func(client *cli.Client, args []string) error {
+		if len(args) == 0 {
+			topologies, err := client.Topologies()
+			if err != nil {
+				return err
+			}
+			if *format == cli.JSONFormat {
+				return writeJSON(topologies)
+			}
+			return cli.WriteTopologies(os.Stdout, topologies)
+		}
+		topology, err := client.Topology(args[0], *search)
+		if err != nil {
+			return err
+		}
+		switch *format {
+		case cli.TableFormat:
+			return cli.WriteTable(os.Stdout, topology.Nodes)
+		case cli.TreeFormat:
+			return cli.WriteTree(os.Stdout, topology.Nodes)
+		case cli.JSONFormat:
+			return writeJSON(topology)
+		}
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func cliTop(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "top [flags] <topology>\n\nLists the nodes of a topology using the most of a metric.")
+	format := fs.String("format", cli.TableFormat, "Output format: table|json")
+	metric := fs.String("metric", "cpu", "ID or label of the metric")
+	n := fs.Int("n", 10, "Number of nodes to list")
+	return func(client *cli.Client, args []string) error {
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		top, err := client.Top(args[0], *metric, *n)
+		if err != nil {
+			return err
+		}
+		if *format == cli.JSONFormat {
+			return writeJSON(top)
+		}
+		return cli.WriteTop(os.Stdout, top)
+	}
+}
+
+func cliExec(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "exec [flags] <node>\n\nOpens a shell in a container or host, by its name or ID.")
+	topology := fs.String("topology", "containers", "Topology of the node: containers|hosts")
+	return func(client *cli.Client, args []string) error {
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return client.Exec(*topology, args[0], os.Stdin, os.Stdout)
+	}
+}
+
+func cliRender(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "render [flags] <topology>\n\nDraws a topology as a diagram, from the app or a report saved from one.")
+	reportFile := fs.String("report", "", "Render this report file (.json or .msgpack, optionally .gz) instead of asking the app")
+	format := fs.String("format", cli.SVGFormat, "Image format: svg|png")
+	output := fs.String("o", "", "File to write the image to, rather than stdout")
+	search := fs.String("q", "", "Only draw the nodes matching this search query")
+	return func(client *cli.Client, args []string) error {
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		write, ok := cli.DiagramFormats[*format]
+		if !ok {
+			return fmt.Errorf("unknown format %q", *format)
+		}
+		if *reportFile != "" {
+			rpt, err := report.MakeFromFile(*reportFile)
+			if err != nil {
+				return err
+			}
+			client = cli.NewReportClient(rpt)
+		}
+		topology, err := client.Topology(args[0], *search)
+		if err != nil {
+			return err
+		}
+		w := os.Stdout
+		if *output != "" {
+			if w, err = os.Create(*output); err != nil {
+				return err
+			}
+			defer w.Close()
+		}
+		return write(w, args[0], cli.MakeLayout(topology.Nodes))
+	}
+}
+
+func cliRecord(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "record [flags]\n\nWrites the reports of the app to a directory, to replay with scope replay.")
+	dir := fs.String("o", "scope-recording", "Directory to write the reports to")
+	duration := fs.Duration("duration", 10*time.Minute, "How long to record for; interrupt to stop sooner")
+	interval := fs.Duration("interval", 3*time.Second, "How often to record the report")
+	return func(client *cli.Client, args []string) error {
+		stop := make(chan struct{})
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		count, err := client.Record(*dir, *interval, *duration, stop)
+		fmt.Fprintf(os.Stderr, "Recorded %d reports to %s\n", count, *dir)
+		return err
+	}
+}
+
+// replayArgs turns the args of scope replay into those running an app
+// replaying a recording, at its original speed or faster.
+func replayArgs(args []string) []string {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	cliUsage(fs, "replay [flags] <directory>\n\nServes the reports recorded by scope record with an app, in a loop.")
+	speed := fs.Float64("speed", 1, "How many times faster than recorded to replay the reports")
+	listen := fs.String("app.http.address", ":"+strconv.Itoa(xfer.AppPort), "webserver listen address")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *speed <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scope replay: %v\n", err)
+		os.Exit(1)
+	}
+	collector := url.URL{
+		Scheme:   "file",
+		Path:     dir,
+		RawQuery: url.Values{"speed": {strconv.FormatFloat(*speed, 'f', -1, 64)}}.Encode(),
+	}
+	return []string{
+		"--mode=app",
+		"--app.collector=" + collector.String(),
+		"--app.http.address=" + *listen,
+	}
+}
+
+func cliLoadgen(fs *flag.FlagSet) func(*cli.Client, []string) error {
+	cliUsage(fs, "loadgen [flags]\n\nPublishes fabricated reports to the app, as the probes of a cluster would, to load test it.")
+	var load cli.Load
+	fs.IntVar(&load.Hosts, "hosts", 10, "Number of hosts, each with its own probe")
+	fs.IntVar(&load.Containers, "containers", 20, "Number of containers on each host")
+	fs.IntVar(&load.Processes, "processes", 2, "Number of processes in each container")
+	fs.IntVar(&load.Connections, "connections", 3, "Number of connections from each container to others")
+	fs.IntVar(&load.Images, "images", 10, "Number of container images")
+	fs.Float64Var(&load.Churn, "churn", 0.05, "Share of containers replaced by new ones at each report")
+	interval := fs.Duration("interval", 3*time.Second, "How often each probe publishes")
+	duration := fs.Duration("duration", 0, "How long to publish for; 0 is until interrupted")
+	seed := fs.Int64("seed", 1, "Seed of the fabricated reports, to repeat runs")
+	measure := fs.String("measure", "containers", "Topology to time rendering after each round of reports; empty to not")
+	return func(client *cli.Client, args []string) error {
+		g := cli.NewGenerator(load, *seed)
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		var deadline <-chan time.Time
+		if *duration > 0 {
+			deadline = time.After(*duration)
+		}
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			start := time.Now()
+			nodes, err := client.PublishAll(g, start)
+			if err != nil {
+				return err
+			}
+			line := fmt.Sprintf("published %d reports (%d nodes) in %v", load.Hosts, nodes, time.Since(start))
+			if *measure != "" {
+				start = time.Now()
+				topology, err := client.Topology(*measure, "")
+				if err != nil {
+					return err
+				}
+				line += fmt.Sprintf("; rendered %s (%d nodes) in %v", *measure, len(topology.Nodes), time.Since(start))
+			}
+			fmt.Println(line)
+			g.Step()
+			select {
+			case <-ticker.C:
+			case <-deadline:
+				return nil
+			case <-interrupt:
+				return nil
+			}
+		}
+	}
+}
@@ -17,10 +17,13 @@ import (
 	billing "github.com/weaveworks/billing-client"
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/app/multitenant"
+	"github.com/weaveworks/scope/common/certs"
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe"
 	"github.com/weaveworks/scope/probe/appclient"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/podman"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/weave/common"
 )
@@ -31,13 +34,17 @@ var (
 	// tokens to be elided when logging
 	serviceTokenFlag       = "service-token"
 	probeTokenFlag         = "probe.token"
+	enrollmentTokenFlag    = "probe.enrollment-token"
 	kubernetesPasswordFlag = "probe.kubernetes.password"
 	kubernetesTokenFlag    = "probe.kubernetes.token"
+	shardingTokenFlag      = "app.sharding.token"
 	sensitiveFlags         = []string{
 		serviceTokenFlag,
 		probeTokenFlag,
+		enrollmentTokenFlag,
 		kubernetesPasswordFlag,
 		kubernetesTokenFlag,
+		shardingTokenFlag,
 	}
 	colonFinder         = regexp.MustCompile(`[^\\](:)`)
 	unescapeBackslashes = regexp.MustCompile(`\\(.)`)
@@ -94,11 +101,21 @@ type flags struct {
 
 type probeFlags struct {
 	token                  string
+	enrollmentToken        string
+	credentialsFile        string
 	httpListen             string
 	publishInterval        time.Duration
+	appMaxRetries          int
 	spyInterval            time.Duration
+	adaptive               probe.AdaptiveConfig
+	pool                   probe.PoolConfig
+	encodings              string
+	compressionLevel       int
+	maxReportSize          int
 	pluginsRoot            string
 	insecure               bool
+	tls                    tlsFlags
+	clusterID              string // Scopes private addresses, for clusters whose networks overlap
 	logPrefix              string
 	logLevel               string
 	resolver               string
@@ -106,32 +123,91 @@ type probeFlags struct {
 	noControls             bool
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
+	natsURL                string
+	natsSubject            string
+	natsMaxPending         int
 
 	useConntrack        bool // Use conntrack for endpoint topo
 	conntrackBufferSize int  // Sie of kernel buffer for conntrack
-
-	spyProcs    bool // Associate endpoints with processes (must be root)
-	procEnabled bool // Produce process topology & process nodes in endpoint
-	useEbpfConn bool // Enable connection tracking with eBPF
-	procRoot    string
-
-	dockerEnabled  bool
-	dockerInterval time.Duration
-	dockerBridge   string
+	maxEdges            int
+
+	spyProcs       bool // Associate endpoints with processes (must be root)
+	procEnabled    bool // Produce process topology & process nodes in endpoint
+	procProfile    bool // Offer CPU profiling of processes (needs perf)
+	useEbpfConn    bool // Enable connection tracking with eBPF
+	trackUDP       bool // Also report UDP flows
+	tcpStats       bool // Report the RTT, retransmissions and throughput of connections
+	trackAttempts  bool // Report connections attempted but never answered
+	selfUpdate     bool // Update to the probe binary apps advertise
+	selfUpdateKey  string
+	dnsPerClient   bool // Name endpoints after the DNS lookups of their clients
+	httpStats      bool // Count the HTTP requests and errors of processes
+	dbStats        bool // Count the queries and errors on edges to databases
+	envoyEnabled   bool // Read the stats of Envoy sidecars
+	envoyAdminPort int
+	procRoot       string
+	tlsInspect     time.Duration
+	runtimeGo      bool // Collect the expvar metrics of Go processes
+	runtimeJVM     bool // Collect the Jolokia metrics of JVMs
+	runtimeInspect time.Duration
+	components     bool // Report the probe, its apps and plugins as nodes
+
+	dockerEnabled     bool
+	dockerInterval    time.Duration
+	dockerBridge      string
+	dockerSwarm       bool
+	dockerCheckpoints bool
+
+	dockerCrashLoopRestarts int
+	dockerCrashLoopWindow   time.Duration
+
+	containerdEnabled bool
+	containerdSocket  string
+
+	criEnabled  bool
+	criEndpoint string
+
+	podmanEnabled bool
+	podmanSockets string
 
 	kubernetesEnabled      bool
 	kubernetesNodeName     string
 	kubernetesClientConfig kubernetes.ClientConfig
 	kubernetesKubeletPort  uint
+	kubernetesCRDs         string
+
+	ecsEnabled               bool
+	ecsCacheSize             int
+	ecsCacheExpiry           time.Duration
+	ecsClusterRegion         string
+	ecsFargateClusters       string
+	ecsStacks                bool
+	ecsTerraformWorkspaceTag string
+
+	ec2Enabled bool
+	ec2Refresh time.Duration
+
+	cloudEnabled bool
+	cloudRefresh time.Duration
+
+	nomadEnabled bool
+	nomadAddr    string
+	nomadToken   string
+
+	systemdEnabled bool
+
+	virtEnabled bool
 
-	ecsEnabled       bool
-	ecsCacheSize     int
-	ecsCacheExpiry   time.Duration
-	ecsClusterRegion string
+	weaveEnabled    bool
+	weaveAddr       string
+	weaveHostname   string
+	weaveMaxRetries int
 
-	weaveEnabled  bool
-	weaveAddr     string
-	weaveHostname string
+	overlayEnabled    bool
+	overlayInterval   time.Duration
+	calicoctlPath     string
+	ciliumSocket      string
+	flannelSubnetFile string
 }
 
 type appFlags struct {
@@ -160,18 +236,127 @@ type appFlags struct {
 	memcachedExpiration       time.Duration
 	memcachedCompressionLevel int
 	userIDHeader              string
+	renderCacheSize           int
 	externalUI                bool
 	metricsGraphURL           string
 
 	blockProfileRate int
+	debugPprof       bool
+	debugRenderStats bool
 
 	awsCreateTables bool
 	consulInf       string
 
+	collectorRetention  time.Duration
+	metricHistoryPoints int
+	anomalyThreshold    float64
+	anomalyAlpha        float64
+
+	probeSpyInterval     time.Duration
+	probePublishInterval time.Duration
+	probeUpdateVersion   string
+	probeUpdateURL       string
+	probeUpdateSignature string
+
+	federationDownstreams downstreamAppsFlag
+	federationInterval    time.Duration
+
+	shardingAdvertise string
+	shardingPeers     string
+	shardingToken     string
+	shardingInterval  time.Duration
+
+	natsConsumeURL string
+	natsSubject    string
+	natsQueue      string
+
+	tls tlsFlags
+
+	authTokensFile      string
+	authOIDCIssuer      string
+	authOIDCClientID    string
+	authOIDCGroupsClaim string
+	authOIDCAdminGroup  string
+
+	enrollment     bool
+	enrollmentFile string
+
+	annotationsFile string
+	layoutsFile     string
+	viewsFile       string
+
+	ingestReportsPerSecond float64
+	ingestBytesPerSecond   float64
+
+	auditSinks string
+
+	topologiesFile string
+
+	costs           bool
+	costsPricesFile string
+
+	vulnerabilityScanner string
+	vulnerabilityTTL     time.Duration
+	vulnerabilityWorkers int
+
+	registryMetadata bool
+	registryTTL      time.Duration
+
+	knownServices        bool
+	knownServicesRanges  string
+	knownServicesRefresh time.Duration
+
+	reverseDNS    bool
+	reverseDNSTTL time.Duration
+	geoIPFile     string
+
+	snapshotsURL       string
+	snapshotsInterval  time.Duration
+	snapshotsRetention time.Duration
+
+	alertRulesFile string
+	alertSinks     string
+	alertInterval  time.Duration
+
 	multitenant.BillingEmitterConfig
 	BillingClientConfig billing.Config
 }
 
+// tlsFlags are the certificates of mutual TLS between probes and apps.
+type tlsFlags struct {
+	certFile       string
+	keyFile        string
+	caFile         string
+	reloadInterval time.Duration
+}
+
+// reloader gives a certs.Reloader of the certificate, or nil without one.
+func (f tlsFlags) reloader() (*certs.Reloader, error) {
+	if f.certFile == "" && f.keyFile == "" {
+		return nil, nil
+	}
+	return certs.NewReloader(f.certFile, f.keyFile, f.caFile, f.reloadInterval)
+}
+
+type downstreamAppsFlag []app.DownstreamApp
+
+func (d *downstreamAppsFlag) String() string {
+	clusters := []string{}
+	for _, a := range *d {
+		clusters = append(clusters, a.Cluster+"="+a.URL.String())
+	}
+	return strings.Join(clusters, ",")
+}
+
+func (d *downstreamAppsFlag) Set(flagValue string) error {
+	a, err := app.ParseDownstreamApp(flagValue)
+	if err != nil {
+		return err
+	}
+	*d = append(*d, a)
+	return nil
+}
+
 type containerLabelFiltersFlag struct {
 	apiTopologyOptions []app.APITopologyOption
 	filterNumber       int
@@ -275,15 +460,35 @@ func setupFlags(flags *flags) {
 	// Probe flags
 	flag.StringVar(&flags.probe.token, serviceTokenFlag, "", "Token to authenticate with cloud.weave.works")
 	flag.StringVar(&flags.probe.token, probeTokenFlag, "", "Token to authenticate with cloud.weave.works")
-	flag.StringVar(&flags.probe.httpListen, "probe.http.listen", "", "listen address for HTTP profiling and instrumentation server")
+	flag.StringVar(&flags.probe.enrollmentToken, enrollmentTokenFlag, "", "Enrollment token to exchange for a credential of the probe on first connecting to each app, instead of a static token")
+	flag.StringVar(&flags.probe.credentialsFile, "probe.enrollment.credentials-file", "", "File to keep the credentials the probe enrolled for in, so it only enrolls once")
+	flag.StringVar(&flags.probe.httpListen, "probe.http.listen", "", "listen address for HTTP profiling and instrumentation server, also serving the health of the probe on /status")
 	flag.DurationVar(&flags.probe.publishInterval, "probe.publish.interval", 3*time.Second, "publish (output) interval")
+	flag.IntVar(&flags.probe.appMaxRetries, "probe.app.max-retries", 0, "Give up publishing reports to and handling controls of an app after this many failed retries in a row, reporting the error on the /status endpoint of -probe.http.listen; 0 retries forever")
 	flag.DurationVar(&flags.probe.spyInterval, "probe.spy.interval", time.Second, "spy (scan) interval")
+	flag.StringVar(&flags.probe.natsURL, "probe.publish.nats", "", "Publish reports to apps through the NATS server at this URL, rather than to the apps directly; controls still connect to the apps. Example: --probe.publish.nats=nats://nats:4222")
+	flag.StringVar(&flags.probe.natsSubject, "probe.publish.nats-subject", xfer.DefaultReportSubject, "NATS subject to publish reports on")
+	flag.IntVar(&flags.probe.natsMaxPending, "probe.publish.nats-max-pending", 100, "Reports published on NATS to keep until an app acknowledges them, while apps or NATS are down; the oldest beyond them are dropped")
+	flag.StringVar(&flags.probe.encodings, "probe.publish.encodings", xfer.ZstdEncoding+","+xfer.GzipEncoding, "Comma-separated Content-Encodings to publish reports in, by preference; the first all the apps accept is used. One of "+strings.Join(append([]string{xfer.GzipEncoding, xfer.IdentityEncoding}, xfer.ReportEncodings()...), ", "))
+	flag.IntVar(&flags.probe.compressionLevel, "probe.publish.compression-level", gzip.DefaultCompression, "Level to compress published reports at, from 1 (fastest) to 9 (smallest); -1 is the default of the encoding")
+	flag.IntVar(&flags.probe.maxReportSize, "probe.publish.max-report-size", 0, "Leave the endpoint, process, network interface, image and container topologies out of reports, in that order, until they are at most this many bytes compressed; 0 is unlimited")
+	flag.IntVar(&flags.probe.adaptive.MaxReportSize, "probe.adaptive.max-report-size", 0, "Lengthen the spy and publish intervals while published reports are bigger than this many bytes; 0 disables")
+	flag.Float64Var(&flags.probe.adaptive.MaxCPU, "probe.adaptive.max-cpu", 0, "Lengthen the spy and publish intervals while the probe uses more than this percentage of a CPU; 0 disables")
+	flag.IntVar(&flags.probe.pool.Workers, "probe.workers", 8, "Most reporters and taggers to run at once; 0 is unlimited")
+	flag.DurationVar(&flags.probe.pool.Deadline, "probe.deadline", 0, "How long to wait for each reporter and tagger before publishing reports without them, flagged as stale; 0 is the spy interval")
 	flag.StringVar(&flags.probe.pluginsRoot, "probe.plugins.root", "/var/run/scope/plugins", "Root directory to search for plugins")
 	flag.BoolVar(&flags.probe.noControls, "probe.no-controls", false, "Disable controls (e.g. start/stop containers, terminals, logs ...)")
 	flag.BoolVar(&flags.probe.noCommandLineArguments, "probe.omit.cmd-args", false, "Disable collection of command-line arguments")
 	flag.BoolVar(&flags.probe.noEnvironmentVariables, "probe.omit.env-vars", false, "Disable collection of environment variables")
 
 	flag.BoolVar(&flags.probe.insecure, "probe.insecure", false, "(SSL) explicitly allow \"insecure\" SSL connections and transfers")
+	flag.BoolVar(&flags.probe.selfUpdate, "probe.self-update", false, "update the probe to the version apps advertise (--app.probe.update.version), downloading their signed binary and restarting with it; for probes not managed by an orchestrator")
+	flag.StringVar(&flags.probe.selfUpdateKey, "probe.self-update.key", "", "Ed25519 public key, in base64, the probe binaries apps advertise must be signed with")
+	flag.StringVar(&flags.probe.clusterID, "probe.cluster-id", "", "ID of the cluster of this probe, scoping its private addresses so that those of clusters with overlapping networks (like pod CIDRs) publishing to the same app never collide; the same for all probes of a cluster")
+	flag.StringVar(&flags.probe.tls.certFile, "probe.tls.cert", "", "Client certificate to present to the app, for mutual TLS")
+	flag.StringVar(&flags.probe.tls.keyFile, "probe.tls.key", "", "Key of the client certificate to present to the app")
+	flag.StringVar(&flags.probe.tls.caFile, "probe.tls.ca", "", "CA bundle to verify the certificate of the app against, instead of the system roots")
+	flag.DurationVar(&flags.probe.tls.reloadInterval, "probe.tls.reload-interval", time.Minute, "How often to check whether the TLS certificates changed; they are also reloaded on SIGHUP")
 	flag.StringVar(&flags.probe.resolver, "probe.resolver", "", "IP address & port of resolver to use.  Default is to use system resolver.")
 	flag.StringVar(&flags.probe.logPrefix, "probe.log.prefix", "<probe>", "prefix for each log line")
 	flag.StringVar(&flags.probe.logLevel, "probe.log.level", "info", "logging threshold level: debug|info|warn|error|fatal|panic")
@@ -291,15 +496,46 @@ func setupFlags(flags *flags) {
 	// Proc & endpoint
 	flag.BoolVar(&flags.probe.useConntrack, "probe.conntrack", true, "also use conntrack to track connections")
 	flag.IntVar(&flags.probe.conntrackBufferSize, "probe.conntrack.buffersize", 4096*1024, "conntrack buffer size")
+	flag.BoolVar(&flags.probe.trackAttempts, "probe.conntrack.attempts", false, "report TCP connections whose SYNs conntrack saw unanswered, as when dropped by firewalls or NetworkPolicies, as attempted edges")
+	flag.IntVar(&flags.probe.maxEdges, "probe.endpoint.max-edges", 0, "Sample connections when there are more than this many, keeping the busiest and a random sample of the rest; 0 keeps all connections")
 	flag.BoolVar(&flags.probe.spyProcs, "probe.proc.spy", true, "associate endpoints with processes (needs root)")
 	flag.StringVar(&flags.probe.procRoot, "probe.proc.root", "/proc", "location of the proc filesystem")
 	flag.BoolVar(&flags.probe.procEnabled, "probe.processes", true, "produce process topology & include procspied connections")
+	flag.BoolVar(&flags.probe.procProfile, "probe.processes.profile", false, "offer a control to CPU profile processes (needs perf)")
 	flag.BoolVar(&flags.probe.useEbpfConn, "probe.ebpf.connections", true, "enable connection tracking with eBPF")
+	flag.BoolVar(&flags.probe.trackUDP, "probe.udp", false, "also report UDP flows (from conntrack and /proc/net/udp)")
+	flag.BoolVar(&flags.probe.tcpStats, "probe.tcp-stats", false, "report the round-trip time, retransmissions and throughput of TCP connections on their edges (needs CAP_SYS_ADMIN for containers)")
+	flag.DurationVar(&flags.probe.tlsInspect, "probe.tls.inspect-interval", 0, "how often to handshake with listening sockets, to report the certificates of TLS listeners on their processes; 0 disables it")
+	flag.BoolVar(&flags.probe.runtimeGo, "probe.runtime.go", false, "report the heap, GC and goroutines of Go processes serving /debug/vars on a listening socket")
+	flag.BoolVar(&flags.probe.runtimeJVM, "probe.runtime.jvm", false, "report the heap, GC and threads of JVMs serving JMX with the Jolokia agent on a listening socket")
+	flag.DurationVar(&flags.probe.runtimeInspect, "probe.runtime.interval", 15*time.Second, "how often to collect the metrics of the runtimes of processes")
+	flag.BoolVar(&flags.probe.httpStats, "probe.http-stats", false, "report the rate of HTTP/1 requests over IPv4 served by processes and containers, and of their 4xx and 5xx responses, with a BPF socket filter")
+	flag.BoolVar(&flags.probe.dbStats, "probe.db-stats", false, "count the queries sent over IPv4 to MySQL and PostgreSQL servers on their well-known ports, and their errors, on the edges to them")
+	flag.BoolVar(&flags.probe.dnsPerClient, "probe.dns.per-client", false, "name the endpoints connected to after the DNS lookups of the host or container connecting, rather than of anyone")
+	flag.BoolVar(&flags.probe.components, "probe.components", true, "report this probe, the apps it publishes to and its plugins as nodes of a Scope topology, with the latency of publishing on their edges")
+	flag.BoolVar(&flags.probe.envoyEnabled, "probe.envoy", false, "read service mesh clusters and routes from the admin interface of Envoy sidecars")
+	flag.IntVar(&flags.probe.envoyAdminPort, "probe.envoy.admin-port", 15000, "port of the Envoy admin interface, which must be reachable on the pod IP")
 
 	// Docker
 	flag.BoolVar(&flags.probe.dockerEnabled, "probe.docker", false, "collect Docker-related attributes for processes")
 	flag.DurationVar(&flags.probe.dockerInterval, "probe.docker.interval", 10*time.Second, "how often to update Docker attributes")
 	flag.StringVar(&flags.probe.dockerBridge, "probe.docker.bridge", "docker0", "the docker bridge name")
+	flag.BoolVar(&flags.probe.dockerSwarm, "probe.docker.swarm", true, "report the services and stacks of the swarm, when the Docker engine is a swarm manager")
+	flag.BoolVar(&flags.probe.dockerCheckpoints, "probe.docker.checkpoints", false, "enable the experimental controls to checkpoint and restore containers; the Docker daemon needs experimental features and CRIU")
+	flag.IntVar(&flags.probe.dockerCrashLoopRestarts, "probe.docker.crashloop.restarts", 3, "show containers restarting this many times within the crash loop window as crash looping; 0 never does")
+	flag.DurationVar(&flags.probe.dockerCrashLoopWindow, "probe.docker.crashloop.window", 10*time.Minute, "how recent restarts count towards containers crash looping")
+
+	// Containerd
+	flag.BoolVar(&flags.probe.containerdEnabled, "probe.containerd", false, "collect containers from containerd, for hosts running it without Docker")
+	flag.StringVar(&flags.probe.containerdSocket, "probe.containerd.socket", "/run/containerd/containerd.sock", "path of the containerd gRPC socket")
+
+	// CRI
+	flag.BoolVar(&flags.probe.criEnabled, "probe.cri", false, "collect containers from a Kubernetes CRI runtime, such as CRI-O")
+	flag.StringVar(&flags.probe.criEndpoint, "probe.cri.endpoint", "unix:///var/run/crio/crio.sock", "the CRI runtime service socket")
+
+	// Podman
+	flag.BoolVar(&flags.probe.podmanEnabled, "probe.podman", false, "collect containers from the podman services of the system and of rootless users")
+	flag.StringVar(&flags.probe.podmanSockets, "probe.podman.sockets", strings.Join(podman.DefaultSockets, ","), "comma-separated glob patterns of the podman service sockets")
 
 	// K8s
 	flag.BoolVar(&flags.probe.kubernetesEnabled, "probe.kubernetes", false, "collect kubernetes-related attributes for containers, should only be enabled on the master node")
@@ -319,16 +555,47 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.probe.kubernetesClientConfig.Username, "probe.kubernetes.username", "", "Username for basic authentication to the API server")
 	flag.StringVar(&flags.probe.kubernetesNodeName, "probe.kubernetes.node-name", "", "Name of this node, for filtering pods")
 	flag.UintVar(&flags.probe.kubernetesKubeletPort, "probe.kubernetes.kubelet-port", 10255, "Node-local TCP port for contacting kubelet")
+	flag.StringVar(&flags.probe.kubernetesCRDs, "probe.kubernetes.crds", "", "Comma-separated custom resources to report, as group/version:Kind[:resource]. Example: --probe.kubernetes.crds=foo.example.com/v1:Widget")
 
 	// AWS ECS
 	flag.BoolVar(&flags.probe.ecsEnabled, "probe.ecs", false, "Collect ecs-related attributes for containers on this node")
 	flag.IntVar(&flags.probe.ecsCacheSize, "probe.ecs.cache.size", 1024*1024, "Max size of cached info for each ECS cluster")
 	flag.DurationVar(&flags.probe.ecsCacheExpiry, "probe.ecs.cache.expiry", time.Hour, "How long to keep cached ECS info")
 	flag.StringVar(&flags.probe.ecsClusterRegion, "probe.ecs.cluster.region", "", "ECS Cluster Region")
+	flag.StringVar(&flags.probe.ecsFargateClusters, "probe.ecs.fargate.clusters", "", "Comma-separated ECS clusters to list Fargate tasks and services of from the ECS API. Set this on a single probe per cluster")
+	flag.BoolVar(&flags.probe.ecsStacks, "probe.ecs.stacks", false, "Group ECS tasks and services by the CloudFormation stack or Terraform workspace which created them, from their tags")
+	flag.StringVar(&flags.probe.ecsTerraformWorkspaceTag, "probe.ecs.stacks.terraform-tag", "terraform-workspace", "Tag naming the Terraform workspace which created ECS tasks and services")
+
+	// AWS EC2
+	flag.BoolVar(&flags.probe.ec2Enabled, "probe.ec2", false, "Collect the EC2 instance type, availability zone, VPC, subnet, security groups and tags of this node")
+	flag.DurationVar(&flags.probe.ec2Refresh, "probe.ec2.refresh", 5*time.Minute, "How often to refresh the EC2 attributes of this node")
+
+	// Cloud providers
+	flag.BoolVar(&flags.probe.cloudEnabled, "probe.cloud", false, "Detect the cloud provider of this node, among Azure, GCP and EC2, and collect the attributes of its instance")
+	flag.DurationVar(&flags.probe.cloudRefresh, "probe.cloud.refresh", 5*time.Minute, "How often to refresh the cloud attributes of this node")
+
+	// HashiCorp Nomad
+	flag.BoolVar(&flags.probe.nomadEnabled, "probe.nomad", false, "Collect Nomad jobs, task groups and allocations from the local Nomad agent")
+	flag.StringVar(&flags.probe.nomadAddr, "probe.nomad.addr", "http://127.0.0.1:4646", "Address of the HTTP API of the local Nomad agent")
+	flag.StringVar(&flags.probe.nomadToken, "probe.nomad.token", "", "ACL token for the Nomad API")
+
+	// systemd
+	flag.BoolVar(&flags.probe.systemdEnabled, "probe.systemd", false, "Collect the systemd services of this host with systemctl, grouping processes under them; needs the /run/systemd of the host")
+
+	// libvirt
+	flag.BoolVar(&flags.probe.virtEnabled, "probe.virt", false, "Collect the libvirt virtual machines of this host with virsh; needs the libvirt socket of the host")
 
 	// Weave
 	flag.StringVar(&flags.probe.weaveAddr, "probe.weave.addr", "127.0.0.1:6784", "IP address & port of the Weave router")
 	flag.StringVar(&flags.probe.weaveHostname, "probe.weave.hostname", "", "Hostname to lookup in WeaveDNS")
+	flag.IntVar(&flags.probe.weaveMaxRetries, "probe.weave.max-retries", 0, "Give up on the Weave router after this many failed retries, reporting the error on the /status endpoint of -probe.http.listen; 0 retries forever")
+
+	// Other overlay networks
+	flag.BoolVar(&flags.probe.overlayEnabled, "probe.overlay", true, "Report the Calico, Cilium and Flannel networks running on the host, and their health")
+	flag.DurationVar(&flags.probe.overlayInterval, "probe.overlay.interval", 10*time.Second, "how often to collect the state of the overlay networks")
+	flag.StringVar(&flags.probe.calicoctlPath, "probe.overlay.calicoctl", "calicoctl", "Path of calicoctl, to collect the BGP peers and IP pools of Calico")
+	flag.StringVar(&flags.probe.ciliumSocket, "probe.overlay.cilium-socket", "/var/run/cilium/cilium.sock", "Unix socket of the API of the Cilium agent")
+	flag.StringVar(&flags.probe.flannelSubnetFile, "probe.overlay.flannel-subnet-file", "/run/flannel/subnet.env", "Subnet file written by flanneld")
 
 	// App flags
 	flag.DurationVar(&flags.app.window, "app.window", 15*time.Second, "window")
@@ -346,8 +613,68 @@ func setupFlags(flags *flags) {
 	flag.Var(&flags.containerLabelFilterFlags, "app.container-label-filter", "Add container label-based view filter, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter='Database Containers:role=db'")
 	flag.Var(&flags.containerLabelFilterFlagsExclude, "app.container-label-filter-exclude", "Add container label-based view filter that excludes containers with the given label, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter-exclude='Database Containers:role=db'")
 
-	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, or file/directory)")
+	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, postgres, or file/directory)")
 	flag.StringVar(&flags.app.s3URL, "app.collector.s3", "local", "S3 URL to use (when collector is dynamodb)")
+	flag.DurationVar(&flags.app.collectorRetention, "app.collector.retention", 0, "How long to keep reports for (when collector is postgres); 0 keeps them forever")
+	flag.DurationVar(&flags.app.probeSpyInterval, "app.probe.spy.interval", 0, "Spy interval to ask probes to use (single-tenant only); 0 leaves it to the probes")
+	flag.DurationVar(&flags.app.probePublishInterval, "app.probe.publish.interval", 0, "Publish interval to ask probes to use (single-tenant only); 0 leaves it to the probes")
+	flag.StringVar(&flags.app.probeUpdateVersion, "app.probe.update.version", "", "Version of Scope to ask probes updating themselves (--probe.self-update) to run; empty for none")
+	flag.StringVar(&flags.app.probeUpdateURL, "app.probe.update.url", "", "URL of the probe binary of --app.probe.update.version")
+	flag.StringVar(&flags.app.probeUpdateSignature, "app.probe.update.signature", "", "Ed25519 signature, in base64, of \"scope-probe-update\\n<version>\\n<SHA-256 of the binary, in hex>\\n\" for the probe binary of --app.probe.update.version")
+	flag.Var(&flags.app.federationDownstreams, "app.federation.downstream", "Federate the downstream app of a cluster, specified as cluster=url (single-tenant only). Multiple flags are accepted. Example: --app.federation.downstream=east=http://scope-east:4040")
+	flag.DurationVar(&flags.app.federationInterval, "app.federation.interval", 3*time.Second, "How often to fetch reports from downstream apps")
+	flag.StringVar(&flags.app.shardingAdvertise, "app.sharding.advertise", "", "URL other apps reach this app at, to shard the probes between several apps behind a load balancer (single-tenant only). Example: --app.sharding.advertise=http://10.0.0.1:4040")
+	flag.StringVar(&flags.app.shardingPeers, "app.sharding.peers", "", "Comma-separated URLs of apps to join the sharded cluster through")
+	flag.StringVar(&flags.app.shardingToken, shardingTokenFlag, "", "Token the apps of a sharded cluster authenticate their requests to each other with; required with -app.sharding.advertise")
+	flag.DurationVar(&flags.app.shardingInterval, "app.sharding.interval", time.Second, "How often sharded apps gossip with each other")
+	flag.StringVar(&flags.app.natsConsumeURL, "app.consume.nats", "", "Consume the reports probes publish through the NATS server at this URL (single-tenant only). Example: --app.consume.nats=nats://nats:4222")
+	flag.StringVar(&flags.app.natsSubject, "app.consume.nats-subject", xfer.DefaultReportSubject, "NATS subject to consume reports from")
+	flag.StringVar(&flags.app.natsQueue, "app.consume.nats-queue", "scope-app", "NATS queue group of the apps sharing the reports between them; empty for every app to get all the reports")
+	flag.StringVar(&flags.app.snapshotsURL, "app.snapshots.url", "", "Object store to write snapshots of the rendered topologies to (single-tenant only), as s3://key:secret@region/bucket[/prefix] or gs://key:secret@[host]/bucket[/prefix] with GCS HMAC keys")
+	flag.DurationVar(&flags.app.snapshotsInterval, "app.snapshots.interval", 5*time.Minute, "How often to write topology snapshots")
+	flag.DurationVar(&flags.app.snapshotsRetention, "app.snapshots.retention", 0, "How long to keep topology snapshots for; 0 keeps them forever")
+	flag.StringVar(&flags.app.alertRulesFile, "app.alerts.rules-file", "", "YAML file of alerting rules on the topologies (single-tenant only)")
+	flag.StringVar(&flags.app.alertSinks, "app.alerts.sinks", "", "Comma-separated sinks to notify alerts to: http(s):// webhook URLs, slack://hooks.slack.com/services/... or pagerduty://<routing key>")
+	flag.DurationVar(&flags.app.alertInterval, "app.alerts.interval", 15*time.Second, "How often to evaluate the alerting rules")
+
+	flag.Float64Var(&flags.app.ingestReportsPerSecond, "app.ingest.reports-per-second", 0, "Most reports each probe can publish per second, on average; 0 is unlimited. Probes over it are asked to retry later")
+	flag.Float64Var(&flags.app.ingestBytesPerSecond, "app.ingest.bytes-per-second", 0, "Most bytes of reports each probe can publish per second, on average; 0 is unlimited")
+
+	// TLS
+	flag.StringVar(&flags.app.tls.certFile, "app.tls.cert", "", "Certificate to serve HTTPS with; HTTP is served without one")
+	flag.StringVar(&flags.app.tls.keyFile, "app.tls.key", "", "Key of the certificate to serve HTTPS with")
+	flag.StringVar(&flags.app.tls.caFile, "app.tls.client-ca", "", "CA bundle to verify the client certificates of probes against. If set, probes are authenticated by their certificates rather than their tokens")
+	flag.DurationVar(&flags.app.tls.reloadInterval, "app.tls.reload-interval", time.Minute, "How often to check whether the TLS certificates changed; they are also reloaded on SIGHUP")
+
+	// Auth
+	flag.StringVar(&flags.app.authTokensFile, "app.auth.tokens-file", "", "File of static API tokens, with a token,role[,name] line per token. Roles are viewer (read-only), admin and probe. The API is only authenticated if tokens or OpenID Connect are configured")
+	flag.StringVar(&flags.app.authOIDCIssuer, "app.auth.oidc.issuer", "", "Issuer URL of OpenID Connect ID tokens to authenticate API requests with")
+	flag.StringVar(&flags.app.authOIDCClientID, "app.auth.oidc.client-id", "", "Client ID the OpenID Connect ID tokens must be issued for")
+	flag.StringVar(&flags.app.authOIDCGroupsClaim, "app.auth.oidc.groups-claim", "groups", "Claim of the OpenID Connect ID tokens with the groups of the user")
+	flag.StringVar(&flags.app.authOIDCAdminGroup, "app.auth.oidc.admin-group", "", "Group of the users with the admin role; all other users are viewers")
+	flag.BoolVar(&flags.app.enrollment, "app.enrollment", false, "Let probes enroll with enrollment tokens minted by admins through the API, for credentials of their own; enrolled probes must have the cluster of their token as -probe.cluster-id (single-tenant only)")
+	flag.StringVar(&flags.app.enrollmentFile, "app.enrollment.file", "", "File to keep the enrollment tokens and probe credentials in across restarts; they are only kept in memory without one")
+	flag.StringVar(&flags.app.annotationsFile, "app.annotations.file", "", "File to keep the pins and annotations users attach to nodes in across restarts; they are only kept in memory without one (single-tenant only)")
+	flag.StringVar(&flags.app.layoutsFile, "app.layouts.file", "", "File to keep the graph layouts users save in across restarts; they are only kept in memory without one (single-tenant only)")
+	flag.StringVar(&flags.app.viewsFile, "app.views.file", "", "File to keep the views users link to in across restarts; they are only kept in memory without one (single-tenant only)")
+	flag.StringVar(&flags.app.auditSinks, "app.audit.sinks", "", "Comma-separated sinks to record the controls invoked through the API to: file:///path, syslog://[host:port] or http(s):// webhook URLs")
+	flag.BoolVar(&flags.app.costs, "app.costs", false, "Estimate the hourly costs of hosts, containers, pods and namespaces, from the machine types of the hosts")
+	flag.StringVar(&flags.app.costsPricesFile, "app.costs.prices-file", "", "YAML file of the hourly prices of machine types, overriding the built-in estimates")
+	flag.StringVar(&flags.app.vulnerabilityScanner, "app.vulnerabilities.scanner", "", "Scan the images of containers for vulnerabilities with this scanner: trivy, running the trivy command; trivy://host:port, as a client of a Trivy server; or the http(s) URL of a service answering GET ?image=<image> with a Trivy JSON report")
+	flag.DurationVar(&flags.app.vulnerabilityTTL, "app.vulnerabilities.ttl", 6*time.Hour, "How long to keep the scans of images before scanning them again")
+	flag.IntVar(&flags.app.vulnerabilityWorkers, "app.vulnerabilities.workers", 2, "How many images to scan at a time")
+	flag.BoolVar(&flags.app.registryMetadata, "app.registry.metadata", false, "Look up the tags of the images of containers in their registries, showing when they were pushed and whether images are behind them")
+	flag.DurationVar(&flags.app.registryTTL, "app.registry.ttl", time.Hour, "How long to keep the lookups of tags before looking them up again")
+	flag.BoolVar(&flags.app.knownServices, "app.known-services", true, "Show the connections to the external addresses of known services, like public DNS resolvers and Cloudflare, as to nodes of those services rather than to the Internet")
+	flag.StringVar(&flags.app.knownServicesRanges, "app.known-services.ranges", "", "Comma-separated files or http(s) URLs of the published ranges of services to classify external addresses by: the ip-ranges.json of AWS, cloud.json of GCP, Service Tags of Azure, or lines of network[,service], prefixed with service= for lines without one, like Cloudflare=https://www.cloudflare.com/ips-v4")
+	flag.DurationVar(&flags.app.knownServicesRefresh, "app.known-services.refresh", 24*time.Hour, "How often to load the published ranges of services again")
+	flag.BoolVar(&flags.app.reverseDNS, "app.reverse-dns", false, "Reverse resolve the external addresses of the connections of the Internet nodes which probes found no names of")
+	flag.DurationVar(&flags.app.reverseDNSTTL, "app.reverse-dns.ttl", 30*time.Minute, "How long to keep the lookups of external addresses before looking them up again")
+	flag.StringVar(&flags.app.geoIPFile, "app.geoip.file", "", "CSV file of network,country,asn,organisation lines to show where the external addresses of the connections of the Internet nodes are")
+	flag.StringVar(&flags.app.topologiesFile, "app.topologies-file", "", "YAML file of custom topologies, grouping the containers, pods, processes or hosts by labels")
+	flag.IntVar(&flags.app.metricHistoryPoints, "app.metrics-history.points", 240, "Number of points to keep of the 1h, 6h and 24h history of node metrics, for the details panel (single-tenant only); 0 disables history")
+	flag.Float64Var(&flags.app.anomalyThreshold, "app.anomalies.threshold", 0, "Number of standard deviations from their baselines beyond which the CPU, memory and connection counts of nodes are anomalous (single-tenant only); 0 disables anomaly detection")
+	flag.Float64Var(&flags.app.anomalyAlpha, "app.anomalies.alpha", 0.1, "Weight of each new sample in the baselines of the anomaly detector, between 0 and 1")
 	flag.StringVar(&flags.app.controlRouterURL, "app.control.router", "local", "Control router to use (local or sqs)")
 	flag.StringVar(&flags.app.pipeRouterURL, "app.pipe.router", "local", "Pipe router to use (local)")
 	flag.StringVar(&flags.app.natsHostname, "app.nats", "", "Hostname for NATS service to use for shortcut reports.  If empty, shortcut reporting will be disabled.")
@@ -357,16 +684,29 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.app.memcachedService, "app.memcached.service", "memcached", "SRV service used to discover memcache servers.")
 	flag.IntVar(&flags.app.memcachedCompressionLevel, "app.memcached.compression", gzip.DefaultCompression, "How much to compress reports stored in memcached.")
 	flag.StringVar(&flags.app.userIDHeader, "app.userid.header", "", "HTTP header to use as userid")
+	flag.IntVar(&flags.app.renderCacheSize, "app.render-cache.size", render.DefaultCacheSize, "How many reports to keep the renders of; multitenant apps want at least as many as users viewing their reports at once")
 	flag.BoolVar(&flags.app.externalUI, "app.externalUI", false, "Point to externally hosted static UI assets")
 	flag.StringVar(&flags.app.metricsGraphURL, "app.metrics-graph", "", "Enable extended metrics graph by providing a templated URL (supports :orgID and :query). Example: --app.metric-graph=/prom/:orgID/notebook/new")
 
 	flag.IntVar(&flags.app.blockProfileRate, "app.block.profile.rate", 0, "If more than 0, enable block profiling. The profiler aims to sample an average of one blocking event per rate nanoseconds spent blocked.")
+	flag.BoolVar(&flags.app.debugPprof, "app.debug.pprof", true, "Serve the pprof profiles of the app under /debug/pprof; CPU profiles are labelled by the topology rendered")
+	flag.BoolVar(&flags.app.debugRenderStats, "app.debug.render-stats", false, "Time each map, filter and reduce stage of rendering topologies, exported to prometheus and broken down by topology under /debug/render-stats")
 
-	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB")
+	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB, or migrate the PostgreSQL schema")
 	flag.StringVar(&flags.app.consulInf, "app.consul.inf", "", "The interface who's address I should advertise myself under in consul")
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if _, ok := cliCommands[os.Args[1]]; ok {
+			cliMain(os.Args[1], os.Args[2:])
+			return
+		}
+		if os.Args[1] == "replay" {
+			os.Args = append(os.Args[:1], replayArgs(os.Args[2:])...)
+		}
+	}
+
 	flags := flags{}
 	setupFlags(&flags)
 	flags.app.BillingEmitterConfig.RegisterFlags(flag.CommandLine)
@@ -403,6 +743,10 @@ func main() {
 			log.Fatalf("Invalid value for -probe.http.address: %v", err)
 		}
 	}
+	flags.probe.kubernetesClientConfig.CustomResources, err = kubernetes.ParseCustomResourceTypes(flags.probe.kubernetesCRDs)
+	if err != nil {
+		log.Fatalf("Invalid value for -probe.kubernetes.crds: %v", err)
+	}
 
 	// Special case probe push address parsing
 	targets := []appclient.Target{}
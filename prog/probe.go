@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -22,15 +23,28 @@ import (
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/awsec2"
 	"github.com/weaveworks/scope/probe/awsecs"
+	"github.com/weaveworks/scope/probe/cloud"
+	"github.com/weaveworks/scope/probe/components"
+	"github.com/weaveworks/scope/probe/containerd"
 	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/cri"
+	"github.com/weaveworks/scope/probe/dbstats"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/envoy"
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/httpstats"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/nomad"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/probe/podman"
 	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/snoop"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/probe/virt"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/weave/common"
 )
@@ -52,6 +66,21 @@ func checkNewScopeVersion(flags probeFlags) {
 	if flags.ecsEnabled {
 		checkpointFlags["ecs_enabled"] = "true"
 	}
+	if flags.ec2Enabled {
+		checkpointFlags["ec2_enabled"] = "true"
+	}
+	if flags.cloudEnabled {
+		checkpointFlags["cloud_enabled"] = "true"
+	}
+	if flags.nomadEnabled {
+		checkpointFlags["nomad_enabled"] = "true"
+	}
+	if flags.systemdEnabled {
+		checkpointFlags["systemd_enabled"] = "true"
+	}
+	if flags.virtEnabled {
+		checkpointFlags["virt_enabled"] = "true"
+	}
 
 	go func() {
 		handleResponse := func(r *checkpoint.CheckResponse, err error) {
@@ -75,11 +104,13 @@ func checkNewScopeVersion(flags probeFlags) {
 	}()
 }
 
-func maybeExportProfileData(flags probeFlags) {
+func maybeExportProfileData(flags probeFlags, status *probe.Status) {
 	if flags.httpListen != "" {
 		go func() {
 			http.Handle("/metrics", prometheus.Handler())
+			http.Handle("/status", status)
 			log.Infof("Profiling data being exported to %s", flags.httpListen)
+			log.Infof("Health of the probe served on http://%s/status", flags.httpListen)
 			log.Infof("go tool pprof http://%s/debug/pprof/{profile,heap,block}", flags.httpListen)
 			log.Infof("Profiling endpoint %s terminated: %v", flags.httpListen, http.ListenAndServe(flags.httpListen, nil))
 		}()
@@ -111,8 +142,26 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	)
 	log.Infof("probe starting, version %s, ID %s", version, probeID)
 	checkNewScopeVersion(flags)
+	// Before anything makes node IDs
+	report.AddressScope = flags.clusterID
+
+	tlsReloader, err := flags.tls.reloader()
+	if err != nil {
+		log.Fatalf("Error loading TLS certificates: %v", err)
+	}
+	if tlsReloader != nil {
+		defer tlsReloader.Stop()
+	}
+
+	var credentials *appclient.Credentials
+	if flags.enrollmentToken != "" {
+		if credentials, err = appclient.NewCredentials(flags.credentialsFile, hostName); err != nil {
+			log.Fatalf("Error loading credentials: %v", err)
+		}
+	}
 
 	handlerRegistry := controls.NewDefaultHandlerRegistry()
+	status := probe.NewStatus()
 	clientFactory := func(hostname string, url url.URL) (appclient.AppClient, error) {
 		token := flags.token
 		if url.User != nil {
@@ -124,6 +173,18 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			ProbeVersion: version,
 			ProbeID:      probeID,
 			Insecure:     flags.insecure,
+			TLS:          tlsReloader,
+			MaxRetries:   flags.appMaxRetries,
+			OnGiveUp:     status.GiveUp,
+		}
+		if credentials != nil {
+			enrollment := probeConfig
+			enrollment.Token = flags.enrollmentToken
+			credential, err := credentials.Get(enrollment, hostname, url)
+			if err != nil {
+				return nil, err
+			}
+			probeConfig.Token = credential
 		}
 		return appclient.NewAppClient(
 			probeConfig, hostname, url,
@@ -132,6 +193,16 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	}
 	clients := appclient.NewMultiAppClient(clientFactory, flags.noControls)
 	defer clients.Stop()
+	if flags.selfUpdate {
+		updater, err := appclient.NewSelfUpdater(appclient.SelfUpdaterConfig{
+			Version:   version,
+			PublicKey: flags.selfUpdateKey,
+		})
+		if err != nil {
+			log.Fatalf("Error setting up self-updates: %v", err)
+		}
+		clients.SetProbeUpdater(updater)
+	}
 
 	dnsLookupFn := net.LookupIP
 	if flags.resolver != "" {
@@ -148,10 +219,37 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	}
 	defer resolver.Stop()
 
-	p := probe.New(flags.spyInterval, flags.publishInterval, clients, flags.noControls)
+	var publisher appclient.Publisher = clients
+	if flags.natsURL != "" {
+		natsPublisher, err := appclient.NewNATSPublisher(flags.natsURL, flags.natsSubject, probeID, flags.natsMaxPending)
+		if err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+			return
+		}
+		defer natsPublisher.Stop()
+		publisher = natsPublisher
+	}
+
+	p := probe.New(flags.spyInterval, flags.publishInterval, publisher, flags.noControls)
+	status.AddSource("probe", p.Status)
+	p.SetAdaptiveConfig(flags.adaptive)
+	p.SetPoolConfig(flags.pool)
+	compression := appclient.CompressionConfig{Level: flags.compressionLevel}
+	for _, encoding := range strings.Split(flags.encodings, ",") {
+		if encoding = strings.TrimSpace(encoding); !xfer.IsReportEncoding(encoding) {
+			log.Fatalf("Unsupported report encoding %q in -probe.publish.encodings", encoding)
+		}
+		compression.Encodings = append(compression.Encodings, encoding)
+	}
+	p.SetCompression(compression)
+	p.SetMaxReportSize(flags.maxReportSize)
+	if !flags.noControls {
+		p.RegisterControls(handlerRegistry)
+	}
 
 	hostReporter := host.NewReporter(hostID, hostName, probeID, version, clients, handlerRegistry)
 	defer hostReporter.Stop()
+	hostReporter.SetGPUTimeout(flags.spyInterval / 2)
 	p.AddReporter(hostReporter)
 	p.AddTagger(probe.NewTopologyTagger(), host.NewTagger(hostID))
 
@@ -159,27 +257,48 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	if flags.procEnabled {
 		processCache = process.NewCachingWalker(process.NewWalker(flags.procRoot, false))
 		p.AddTicker(processCache)
-		p.AddReporter(process.NewReporter(processCache, hostID, process.GetDeltaTotalJiffies, flags.noCommandLineArguments))
+		var profileControls *controls.HandlerRegistry
+		if flags.procProfile {
+			profileControls = handlerRegistry
+		}
+		processReporter := process.NewReporter(processCache, flags.procRoot, hostID, process.GetDeltaTotalJiffies, flags.noCommandLineArguments, clients, profileControls)
+		defer processReporter.Stop()
+		p.AddReporter(processReporter)
 	}
 
-	dnsSnooper, err := endpoint.NewDNSSnooper()
+	dnsSnooper, err := endpoint.NewDNSSnooper(flags.dnsPerClient)
 	if err != nil {
 		log.Errorf("Failed to start DNS snooper: nodes for external services will be less accurate: %s", err)
 	} else {
 		defer dnsSnooper.Stop()
 	}
 
+	var runtimeCollectors []endpoint.RuntimeCollector
+	if flags.runtimeGo {
+		runtimeCollectors = append(runtimeCollectors, endpoint.GoRuntimeCollector{})
+	}
+	if flags.runtimeJVM {
+		runtimeCollectors = append(runtimeCollectors, endpoint.JVMRuntimeCollector{})
+	}
+
 	endpointReporter := endpoint.NewReporter(endpoint.ReporterConfig{
-		HostID:       hostID,
-		HostName:     hostName,
-		SpyProcs:     flags.spyProcs,
-		UseConntrack: flags.useConntrack,
-		WalkProc:     flags.procEnabled,
-		UseEbpfConn:  flags.useEbpfConn,
-		ProcRoot:     flags.procRoot,
-		BufferSize:   flags.conntrackBufferSize,
-		ProcessCache: processCache,
-		DNSSnooper:   dnsSnooper,
+		HostID:                 hostID,
+		HostName:               hostName,
+		SpyProcs:               flags.spyProcs,
+		UseConntrack:           flags.useConntrack,
+		WalkProc:               flags.procEnabled,
+		UseEbpfConn:            flags.useEbpfConn,
+		TrackUDP:               flags.trackUDP,
+		TCPStats:               flags.tcpStats,
+		TrackAttempts:          flags.trackAttempts,
+		ProcRoot:               flags.procRoot,
+		BufferSize:             flags.conntrackBufferSize,
+		ProcessCache:           processCache,
+		DNSSnooper:             dnsSnooper,
+		MaxEdges:               flags.maxEdges,
+		TLSInspectInterval:     flags.tlsInspect,
+		RuntimeCollectors:      runtimeCollectors,
+		RuntimeInspectInterval: flags.runtimeInspect,
 	})
 	defer endpointReporter.Stop()
 	p.AddReporter(endpointReporter)
@@ -200,6 +319,9 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			HandlerRegistry:        handlerRegistry,
 			NoCommandLineArguments: flags.noCommandLineArguments,
 			NoEnvironmentVariables: flags.noEnvironmentVariables,
+			Checkpoints:            flags.dockerCheckpoints,
+			CrashLoopRestarts:      flags.dockerCrashLoopRestarts,
+			CrashLoopWindow:        flags.dockerCrashLoopWindow,
 		}
 		if registry, err := docker.NewRegistry(options); err == nil {
 			defer registry.Stop()
@@ -207,11 +329,72 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 				p.AddTagger(docker.NewTagger(registry, processCache))
 			}
 			p.AddReporter(docker.NewReporter(registry, hostID, probeID, p))
+			if flags.dockerSwarm {
+				if client, err := docker.NewSwarmClient(""); err == nil {
+					reporter := docker.NewSwarmReporter(client, probeID, handlerRegistry)
+					defer reporter.Stop()
+					p.AddReporter(reporter)
+				} else {
+					log.Errorf("Docker: failed to make Swarm client: %v", err)
+				}
+			}
+			if flags.envoyEnabled {
+				p.AddTagger(envoy.NewTagger(flags.envoyAdminPort))
+			}
 		} else {
 			log.Errorf("Docker: failed to start registry: %v", err)
 		}
 	}
 
+	if flags.containerdEnabled {
+		if client, err := containerd.NewClient(flags.containerdSocket); err == nil {
+			reporter := containerd.NewReporter(client, probeID, handlerRegistry)
+			defer reporter.Stop()
+			p.AddReporter(reporter)
+		} else {
+			log.Errorf("Containerd: failed to connect to %s: %v", flags.containerdSocket, err)
+		}
+	}
+
+	if flags.criEnabled {
+		if client, err := cri.NewClient(flags.criEndpoint); err == nil {
+			reporter := cri.NewReporter(client, probeID, handlerRegistry)
+			defer reporter.Stop()
+			p.AddReporter(reporter)
+		} else {
+			log.Errorf("CRI: failed to connect to %s: %v", flags.criEndpoint, err)
+		}
+	}
+
+	if flags.podmanEnabled {
+		reporter := podman.NewReporter(strings.Split(flags.podmanSockets, ","), podman.NewClient, probeID, handlerRegistry)
+		defer reporter.Stop()
+		p.AddReporter(reporter)
+	}
+
+	var (
+		observers []snoop.Observer
+		taggers   []probe.Tagger
+	)
+	if flags.httpStats {
+		counter := httpstats.NewCounter()
+		observers = append(observers, counter)
+		taggers = append(taggers, httpstats.NewTagger(hostID, counter))
+	}
+	if flags.dbStats {
+		counter := dbstats.NewCounter()
+		observers = append(observers, counter)
+		taggers = append(taggers, dbstats.NewTagger(counter))
+	}
+	if len(observers) > 0 {
+		if snooper, err := snoop.NewSnooper(observers...); err == nil {
+			defer snooper.Stop()
+			p.AddTagger(taggers...)
+		} else {
+			log.Errorf("Failed to start snooper: no HTTP or database stats: %v", err)
+		}
+	}
+
 	if flags.kubernetesEnabled {
 		if client, err := kubernetes.NewClient(flags.kubernetesClientConfig); err == nil {
 			defer client.Stop()
@@ -226,15 +409,81 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	}
 
 	if flags.ecsEnabled {
-		reporter := awsecs.Make(flags.ecsCacheSize, flags.ecsCacheExpiry, flags.ecsClusterRegion, handlerRegistry, probeID)
+		var fargateClusters []string
+		if flags.ecsFargateClusters != "" {
+			fargateClusters = strings.Split(flags.ecsFargateClusters, ",")
+		}
+		reporter := awsecs.Make(flags.ecsCacheSize, flags.ecsCacheExpiry, flags.ecsClusterRegion, fargateClusters, awsecs.StackConfig{
+			Enabled:               flags.ecsStacks,
+			TerraformWorkspaceTag: flags.ecsTerraformWorkspaceTag,
+		}, handlerRegistry, probeID)
 		defer reporter.Stop()
 		p.AddReporter(reporter)
 		p.AddTagger(reporter)
 	}
 
+	if flags.ec2Enabled {
+		if client, err := awsec2.NewClient(); err == nil {
+			p.AddReporter(awsec2.NewReporter(hostID, client, flags.ec2Refresh))
+		} else {
+			log.Errorf("EC2: failed to start client: %v", err)
+		}
+	}
+
+	if flags.cloudEnabled {
+		if client, err := cloud.Detect(); err == nil {
+			p.AddReporter(cloud.NewReporter(hostID, client, flags.cloudRefresh))
+		} else if flags.ec2Enabled {
+			log.Infof("Cloud: %v", err)
+		} else if client, ec2Err := awsec2.NewClient(); ec2Err == nil {
+			p.AddReporter(awsec2.NewReporter(hostID, client, flags.cloudRefresh))
+		} else {
+			log.Infof("Cloud: %v, nor EC2 metadata service: %v", err, ec2Err)
+		}
+	}
+
+	if flags.nomadEnabled {
+		if client, err := nomad.NewClient(flags.nomadAddr, flags.nomadToken); err == nil {
+			reporter := nomad.NewReporter(client, hostID)
+			p.AddReporter(reporter)
+			p.AddTagger(reporter)
+		} else {
+			log.Errorf("Nomad: failed to start client: %v", err)
+		}
+	}
+
+	if flags.systemdEnabled {
+		if client, err := systemd.NewClient(); err == nil {
+			reporter := systemd.NewReporter(client, hostID, handlerRegistry)
+			defer reporter.Stop()
+			p.AddReporter(reporter)
+			p.AddTagger(reporter)
+		} else {
+			log.Errorf("Systemd: failed to start client: %v", err)
+		}
+	}
+
+	if flags.virtEnabled {
+		if client, err := virt.NewClient(); err == nil {
+			p.AddReporter(virt.NewReporter(client, hostID))
+		} else {
+			log.Errorf("Virt: failed to start client: %v", err)
+		}
+	}
+
+	if flags.overlayEnabled {
+		networks := overlay.NewNetworks(hostID, flags.overlayInterval,
+			overlay.NewCalico(flags.calicoctlPath),
+			overlay.NewCilium(flags.ciliumSocket),
+			overlay.NewFlannel(flags.flannelSubnetFile),
+		)
+		defer networks.Stop()
+		p.AddReporter(networks)
+	}
+
 	if flags.weaveEnabled {
 		client := weave.NewClient(sanitize.URL("http://", 6784, "")(flags.weaveAddr))
-		weave, err := overlay.NewWeave(hostID, client)
+		weave, err := overlay.NewWeave(hostID, probeID, client, handlerRegistry, flags.weaveMaxRetries, status.GiveUp)
 		if err != nil {
 			log.Errorf("Weave: failed to start client: %v", err)
 		} else {
@@ -283,9 +532,18 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	} else {
 		defer pluginRegistry.Close()
 		p.AddReporter(pluginRegistry)
+		status.AddSource("plugins", func() (interface{}, error) { return pluginRegistry.Status(), nil })
+	}
+
+	if flags.components {
+		var pluginStatus func() []plugins.PluginStatus
+		if pluginRegistry != nil {
+			pluginStatus = pluginRegistry.Status
+		}
+		p.AddReporter(components.NewReporter(probeID, hostID, hostName, version, p.Targets, pluginStatus))
 	}
 
-	maybeExportProfileData(flags)
+	maybeExportProfileData(flags, status)
 
 	p.Start()
 	defer p.Stop()
@@ -0,0 +1,13 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// ScopeComponentRenderer is a Renderer for the apps, probes and plugins of
+// Scope itself.
+var ScopeComponentRenderer = ConditionalRenderer(renderScopeComponents, SelectScopeComponent)
+
+func renderScopeComponents(rpt report.Report) bool {
+	return len(rpt.ScopeComponent.Nodes) >= 1
+}
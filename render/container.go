@@ -2,6 +2,7 @@ package render
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/report"
@@ -24,7 +25,7 @@ var UncontainedIDPrefix = MakePseudoNodeID(UncontainedID)
 // NB We only want processes in container _or_ processes with network connections
 // but we need to be careful to ensure we only include each edge once, by only
 // including the ProcessRenderer once.
-var ContainerRenderer = MakeFilter(
+var ContainerRenderer = MakeSidecarAttributor(MakeFilter(
 	func(n report.Node) bool {
 		// Drop deleted containers
 		state, ok := n.Latest.Lookup(docker.ContainerState)
@@ -37,7 +38,7 @@ var ContainerRenderer = MakeFilter(
 		),
 		ConnectionJoin(MapContainer2IP, SelectContainer),
 	),
-)
+))
 
 var mapEndpoint2IP = MakeMap(endpoint2IP, SelectEndpoint)
 
@@ -219,7 +220,7 @@ var ContainerHostnameRenderer = FilterEmpty(report.Container,
 	),
 )
 
-var portMappingMatch = regexp.MustCompile(`([0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}):([0-9]+)->([0-9]+)/tcp`)
+var portMappingMatch = regexp.MustCompile(`([0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}|\[[0-9a-fA-F:.]+\]):([0-9]+)->([0-9]+)/tcp`)
 
 // MapContainer2IP maps container nodes to their IP addresses (outputs
 // multiple nodes).  This allows container to be joined directly with
@@ -253,12 +254,14 @@ func MapContainer2IP(m report.Node) []string {
 	}
 
 	// Also output all the host:port port mappings (see above comment).
-	// In this case we assume this doesn't need a scope, as they are for host IPs.
+	// In this case we assume this doesn't need a scope, as they are for host IPs,
+	// other than the cluster of private ones.
+	clusterID, _ := m.Latest.Lookup(report.ClusterID)
 	ports, _ := m.Sets.Lookup(docker.ContainerPorts)
 	for _, portMapping := range ports {
 		if mapping := portMappingMatch.FindStringSubmatch(portMapping); mapping != nil {
-			ip, port := mapping[1], mapping[2]
-			id := report.MakeScopedEndpointNodeID("", ip, port)
+			ip, port := strings.Trim(mapping[1], "[]"), mapping[2]
+			id := report.MakeScopedEndpointNodeID(report.ClusterAddressScope(clusterID, ip), ip, port)
 			result = append(result, id)
 		}
 	}
@@ -0,0 +1,140 @@
+package detailed
+
+import (
+	"sort"
+)
+
+// Changes are the changes to a topology between two points in time: the
+// nodes and edges which came and went, and the changes to the labels and
+// metadata of the other nodes. Metrics are left out, as they always change.
+type Changes struct {
+	AddedNodes   []NodeSummary `json:"addedNodes"`
+	RemovedNodes []NodeSummary `json:"removedNodes"`
+	ChangedNodes []NodeChange  `json:"changedNodes"`
+	AddedEdges   []Edge        `json:"addedEdges"`
+	RemovedEdges []Edge        `json:"removedEdges"`
+}
+
+// NodeChange is the change to the label and metadata of a node.
+type NodeChange struct {
+	ID       string           `json:"id"`
+	Label    string           `json:"label"`
+	Metadata []MetadataChange `json:"metadata"`
+}
+
+// MetadataChange is the change to a metadata row or label of a node. From
+// is empty for rows which were added, and To for those which were removed.
+type MetadataChange struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// Edge is an edge between two nodes.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MakeChanges gives the changes to get from the nodes of a topology at one
+// point in time to those of another.
+func MakeChanges(a, b NodeSummaries) Changes {
+	changes := Changes{
+		AddedNodes:   []NodeSummary{},
+		RemovedNodes: []NodeSummary{},
+		ChangedNodes: []NodeChange{},
+		AddedEdges:   diffEdges(b, a),
+		RemovedEdges: diffEdges(a, b),
+	}
+	for _, id := range sortedIDs(b) {
+		node := b[id]
+		previous, ok := a[id]
+		if !ok {
+			changes.AddedNodes = append(changes.AddedNodes, node)
+			continue
+		}
+		if metadata := diffMetadata(metadataValues(previous), metadataValues(node)); len(metadata) > 0 {
+			changes.ChangedNodes = append(changes.ChangedNodes, NodeChange{ID: id, Label: node.Label, Metadata: metadata})
+		}
+	}
+	for _, id := range sortedIDs(a) {
+		if _, ok := b[id]; !ok {
+			changes.RemovedNodes = append(changes.RemovedNodes, a[id])
+		}
+	}
+	return changes
+}
+
+func sortedIDs(n NodeSummaries) []string {
+	ids := make([]string, 0, len(n))
+	for id := range n {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// diffEdges gives the edges of a which are not in b.
+func diffEdges(a, b NodeSummaries) []Edge {
+	edges := []Edge{}
+	for _, id := range sortedIDs(a) {
+		for _, adjacent := range a[id].Adjacency {
+			if !b[id].Adjacency.Contains(adjacent) {
+				edges = append(edges, Edge{From: id, To: adjacent})
+			}
+		}
+	}
+	return edges
+}
+
+type metadataValue struct {
+	label, value string
+}
+
+// metadataValues gives the label, metadata rows and property list rows of a
+// node summary, by ID. The IDs of property list rows are prefixed with those
+// of their tables, e.g. docker_label_ for the labels of containers.
+func metadataValues(n NodeSummary) map[string]metadataValue {
+	values := map[string]metadataValue{"label": {"Label", n.Label}}
+	for _, row := range n.Metadata {
+		values[row.ID] = metadataValue{row.Label, row.Value}
+	}
+	for _, table := range n.Tables {
+		for _, row := range table.Rows {
+			if label, ok := row.Entries["label"]; ok {
+				values[table.ID+label] = metadataValue{label, row.Entries["value"]}
+			}
+		}
+	}
+	return values
+}
+
+func diffMetadata(a, b map[string]metadataValue) []MetadataChange {
+	ids := map[string]struct{}{}
+	for id := range a {
+		ids[id] = struct{}{}
+	}
+	for id := range b {
+		ids[id] = struct{}{}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	changes := []MetadataChange{}
+	for _, id := range sorted {
+		from, to := a[id], b[id]
+		if from.value == to.value {
+			continue
+		}
+		label := to.label
+		if label == "" {
+			label = from.label
+		}
+		changes = append(changes, MetadataChange{ID: id, Label: label, From: from.value, To: to.value})
+	}
+	return changes
+}
@@ -0,0 +1,48 @@
+package detailed_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestMakeChanges(t *testing.T) {
+	var (
+		web = detailed.NodeSummary{
+			ID:        "web",
+			Label:     "web",
+			Metadata:  []report.MetadataRow{{ID: "docker_image_name", Label: "Image name", Value: "nginx:1.12"}},
+			Adjacency: report.MakeIDList("db"),
+		}
+		db    = detailed.NodeSummary{ID: "db", Label: "db"}
+		cache = detailed.NodeSummary{ID: "cache", Label: "cache"}
+	)
+	updatedWeb := web
+	updatedWeb.Metadata = []report.MetadataRow{{ID: "docker_image_name", Label: "Image name", Value: "nginx:1.13"}}
+	updatedWeb.Metrics = []report.MetricRow{{ID: "docker_cpu_total_usage", Value: 12}}
+	updatedWeb.Adjacency = report.MakeIDList("cache")
+	updatedDB := db
+	updatedDB.Metrics = []report.MetricRow{{ID: "docker_cpu_total_usage", Value: 3}}
+
+	have := detailed.MakeChanges(
+		detailed.NodeSummaries{"web": web, "db": db},
+		detailed.NodeSummaries{"web": updatedWeb, "db": updatedDB, "cache": cache},
+	)
+	want := detailed.Changes{
+		AddedNodes:   []detailed.NodeSummary{cache},
+		RemovedNodes: []detailed.NodeSummary{},
+		ChangedNodes: []detailed.NodeChange{{
+			ID:       "web",
+			Label:    "web",
+			Metadata: []detailed.MetadataChange{{ID: "docker_image_name", Label: "Image name", From: "nginx:1.12", To: "nginx:1.13"}},
+		}},
+		AddedEdges:   []detailed.Edge{{From: "web", To: "cache"}},
+		RemovedEdges: []detailed.Edge{{From: "web", To: "db"}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
@@ -2,9 +2,11 @@ package detailed
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 
+	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
 )
@@ -61,16 +63,17 @@ func (s connectionsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
 type connection struct {
 	remoteNodeID          string
 	remoteAddr, localAddr string // for internet nodes only
+	location              string // of whichever address is of an internet node
 	port                  string // destination port
 }
 
 type connectionCounters struct {
 	counted map[string]struct{}
-	counts  map[connection]int
+	counts  map[connection]float64
 }
 
 func newConnectionCounters() *connectionCounters {
-	return &connectionCounters{counted: map[string]struct{}{}, counts: map[connection]int{}}
+	return &connectionCounters{counted: map[string]struct{}{}, counts: map[connection]float64{}}
 }
 
 func (c *connectionCounters) add(outgoing bool, localNode, remoteNode, localEndpoint, remoteEndpoint report.Node) {
@@ -100,9 +103,25 @@ func (c *connectionCounters) add(outgoing bool, localNode, remoteNode, localEndp
 	if conn.localAddr, ok = internetAddr(localNode, localEndpoint); !ok {
 		return
 	}
+	if conn.remoteAddr != "" {
+		conn.location = render.GeoIPLocation(remoteEndpoint)
+	} else if conn.localAddr != "" {
+		conn.location = render.GeoIPLocation(localEndpoint)
+	}
 
 	c.counted[connectionID] = struct{}{}
-	c.counts[conn]++
+	c.counts[conn] += sampleWeight(srcEndpoint)
+}
+
+// sampleWeight is how many connections a connection from an endpoint stands
+// for, when the probe has sampled them.
+func sampleWeight(srcEndpoint report.Node) float64 {
+	if rate, ok := srcEndpoint.Latest.Lookup(endpoint.SampleRate); ok {
+		if r, err := strconv.ParseFloat(rate, 64); err == nil && r > 0 && r <= 1 {
+			return 1 / r
+		}
+	}
+	return 1
 }
 
 func internetAddr(node report.Node, ep report.Node) (string, bool) {
@@ -137,13 +156,17 @@ func (c *connectionCounters) rows(r report.Report, ns report.Nodes, includeLocal
 		}
 		if row.remoteAddr != "" {
 			connection.Label = row.remoteAddr
-			connection.LabelMinor = ""
+			connection.LabelMinor = row.location
 		}
 		if includeLocal {
+			localAddr := row.localAddr
+			if row.location != "" {
+				localAddr = fmt.Sprintf("%s, %s", localAddr, row.location)
+			}
 			connection.Metadata = append(connection.Metadata,
 				report.MetadataRow{
 					ID:    remoteKey,
-					Value: row.localAddr,
+					Value: localAddr,
 				})
 		}
 		connection.Metadata = append(connection.Metadata,
@@ -153,7 +176,7 @@ func (c *connectionCounters) rows(r report.Report, ns report.Nodes, includeLocal
 			},
 			report.MetadataRow{
 				ID:    countKey,
-				Value: strconv.Itoa(count),
+				Value: strconv.Itoa(int(math.Floor(count + 0.5))),
 			},
 		)
 		output = append(output, connection)
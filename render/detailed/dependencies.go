@@ -0,0 +1,93 @@
+package detailed
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// defaultTransport is the transport of edges which don't have one.
+const defaultTransport = "tcp"
+
+// DependencyPort is a port a node connects to another on.
+type DependencyPort struct {
+	Port      int    `json:"port" yaml:"port"`
+	Transport string `json:"transport" yaml:"transport"`
+}
+
+// Dependency is a node another one connects to, and the ports it connects
+// to it on.
+type Dependency struct {
+	ID    string           `json:"id" yaml:"id"`
+	Label string           `json:"label" yaml:"label"`
+	Ports []DependencyPort `json:"ports" yaml:"ports"`
+}
+
+// NodeDependencies is a node of a rendered topology and its dependencies.
+type NodeDependencies struct {
+	ID           string       `json:"id" yaml:"id"`
+	Label        string       `json:"label" yaml:"label"`
+	Dependencies []Dependency `json:"dependencies" yaml:"dependencies"`
+}
+
+// MakeDependencies gives the dependencies of the nodes of a rendered
+// topology, by walking the connections of their endpoints, as the outbound
+// connections of the details of nodes do. Pseudo nodes have none of their
+// own, though they are dependencies of others. They are sorted by ID.
+func MakeDependencies(rc report.RenderContext, ns report.Nodes) []NodeDependencies {
+	label := func(n report.Node) string {
+		summary, _ := MakeNodeSummary(report.RenderContext{Report: rc.Report}, n)
+		return summary.Label
+	}
+	result := []NodeDependencies{}
+	for _, n := range ns {
+		if n.Topology == render.Pseudo {
+			continue
+		}
+		localEndpoints := endpointChildrenOf(n)
+		deps := NodeDependencies{ID: n.ID, Label: label(n), Dependencies: []Dependency{}}
+		for _, id := range n.Adjacency {
+			node, ok := ns[id]
+			if !ok {
+				continue
+			}
+			remoteEndpointIDs, remoteEndpointIDCopies := endpointChildIDsAndCopyMapOf(node)
+			ports := map[DependencyPort]struct{}{}
+			for _, localEndpoint := range localEndpoints {
+				for _, remoteEndpointID := range localEndpoint.Adjacency.Intersection(remoteEndpointIDs) {
+					transport := defaultTransport
+					if md, ok := localEndpoint.Edges.Lookup(remoteEndpointID); ok && md.Transport != "" {
+						transport = md.Transport
+					}
+					_, _, port, ok := report.ParseEndpointNodeID(canonicalEndpointID(remoteEndpointIDCopies, remoteEndpointID))
+					if !ok {
+						continue
+					}
+					if p, err := strconv.Atoi(port); err == nil {
+						ports[DependencyPort{Port: p, Transport: transport}] = struct{}{}
+					}
+				}
+			}
+			if len(ports) == 0 {
+				continue
+			}
+			dep := Dependency{ID: node.ID, Label: label(node), Ports: make([]DependencyPort, 0, len(ports))}
+			for port := range ports {
+				dep.Ports = append(dep.Ports, port)
+			}
+			sort.Slice(dep.Ports, func(i, j int) bool {
+				if dep.Ports[i].Port != dep.Ports[j].Port {
+					return dep.Ports[i].Port < dep.Ports[j].Port
+				}
+				return dep.Ports[i].Transport < dep.Ports[j].Transport
+			})
+			deps.Dependencies = append(deps.Dependencies, dep)
+		}
+		sort.Slice(deps.Dependencies, func(i, j int) bool { return deps.Dependencies[i].ID < deps.Dependencies[j].ID })
+		result = append(result, deps)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
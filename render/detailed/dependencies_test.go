@@ -0,0 +1,47 @@
+package detailed_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestMakeDependencies(t *testing.T) {
+	rc := report.RenderContext{Report: fixture.Report}
+	have := map[string]detailed.NodeDependencies{}
+	for _, deps := range detailed.MakeDependencies(rc, render.HostRenderer.Render(fixture.Report, nil)) {
+		have[deps.ID] = deps
+	}
+	want := map[string]detailed.NodeDependencies{
+		fixture.ClientHostNodeID: {
+			ID:    fixture.ClientHostNodeID,
+			Label: "client",
+			Dependencies: []detailed.Dependency{
+				{
+					ID:    fixture.ServerHostNodeID,
+					Label: "server",
+					Ports: []detailed.DependencyPort{{Port: 80, Transport: "tcp"}},
+				},
+			},
+		},
+		fixture.ServerHostNodeID: {
+			ID:    fixture.ServerHostNodeID,
+			Label: "server",
+			Dependencies: []detailed.Dependency{
+				{
+					ID:    render.OutgoingInternetID,
+					Label: render.OutboundMajor,
+					Ports: []detailed.DependencyPort{{Port: 80, Transport: "tcp"}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+}
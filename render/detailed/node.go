@@ -47,6 +47,7 @@ type wiredControlInstance struct {
 	Human   string `json:"human"`
 	Icon    string `json:"icon"`
 	Rank    int    `json:"rank"`
+	DryRun  bool   `json:"dryRun,omitempty"`
 }
 
 // CodecEncodeSelf marshals this ControlInstance. It takes the basic Metric
@@ -59,6 +60,7 @@ func (c *ControlInstance) CodecEncodeSelf(encoder *codec.Encoder) {
 		Human:   c.Control.Human,
 		Icon:    c.Control.Icon,
 		Rank:    c.Control.Rank,
+		DryRun:  c.Control.DryRun,
 	})
 }
 
@@ -70,10 +72,11 @@ func (c *ControlInstance) CodecDecodeSelf(decoder *codec.Decoder) {
 		ProbeID: in.ProbeID,
 		NodeID:  in.NodeID,
 		Control: report.Control{
-			ID:    in.ID,
-			Human: in.Human,
-			Icon:  in.Icon,
-			Rank:  in.Rank,
+			ID:     in.ID,
+			Human:  in.Human,
+			Icon:   in.Icon,
+			Rank:   in.Rank,
+			DryRun: in.DryRun,
 		},
 	}
 }
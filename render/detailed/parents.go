@@ -7,6 +7,9 @@ import (
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/nomad"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/probe/virt"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -19,20 +22,29 @@ type Parent struct {
 
 var (
 	kubernetesParentLabel = latestLookup(kubernetes.Name)
+	nomadParentLabel      = latestLookup(nomad.Name)
 
 	getLabelForTopology = map[string]func(report.Node) string{
-		report.Container:      getRenderableContainerName,
-		report.Pod:            kubernetesParentLabel,
-		report.Deployment:     kubernetesParentLabel,
-		report.DaemonSet:      kubernetesParentLabel,
-		report.StatefulSet:    kubernetesParentLabel,
-		report.CronJob:        kubernetesParentLabel,
-		report.Service:        kubernetesParentLabel,
-		report.ECSTask:        latestLookup(awsecs.TaskFamily),
-		report.ECSService:     ecsServiceParentLabel,
-		report.SwarmService:   latestLookup(docker.ServiceName),
-		report.ContainerImage: containerImageParentLabel,
-		report.Host:           latestLookup(host.HostName),
+		report.Container:       getRenderableContainerName,
+		report.Pod:             kubernetesParentLabel,
+		report.Deployment:      kubernetesParentLabel,
+		report.DaemonSet:       kubernetesParentLabel,
+		report.StatefulSet:     kubernetesParentLabel,
+		report.CronJob:         kubernetesParentLabel,
+		report.CustomResource:  kubernetesParentLabel,
+		report.Service:         kubernetesParentLabel,
+		report.ECSTask:         latestLookup(awsecs.TaskFamily),
+		report.ECSService:      ecsServiceParentLabel,
+		report.ECSStack:        latestLookup(awsecs.StackName),
+		report.SwarmService:    latestLookup(docker.ServiceName),
+		report.SwarmStack:      latestLookup(docker.StackNamespace),
+		report.NomadJob:        nomadParentLabel,
+		report.NomadTaskGroup:  nomadParentLabel,
+		report.NomadAllocation: nomadParentLabel,
+		report.ContainerImage:  containerImageParentLabel,
+		report.SystemdUnit:     latestLookup(systemd.UnitName),
+		report.VirtualMachine:  latestLookup(virt.DomainName),
+		report.Host:            latestLookup(host.HostName),
 	}
 )
 
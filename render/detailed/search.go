@@ -0,0 +1,340 @@
+package detailed
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Query selects node summaries. Queries are made of terms:
+//
+//	word           the label, minor label, or a metadata or label value
+//	               contains the word, ignoring case
+//	/regexp/       any of those matches the regular expression
+//	field:value    a metadata row or label named field has a value
+//	               containing value, or matching /regexp/
+//	field>number   a metric or numeric metadata row named field compares
+//	               to the number, with any of >, >=, <, <= and =; numbers
+//	               can end with a %, e.g. cpu>80%
+//
+// Fields are the labels or IDs of rows, ignoring case, or the last part of
+// their IDs. Words and values with spaces are quoted. Terms are joined by
+// AND, which is implied between terms, OR and NOT, and grouped with
+// parentheses.
+type Query interface {
+	Match(NodeSummary) bool
+}
+
+// ParseQuery parses a query.
+func ParseQuery(s string) (Query, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q in query", tok)
+	}
+	return q, nil
+}
+
+// Search gives the node summaries matching a query.
+func (n NodeSummaries) Search(q Query) NodeSummaries {
+	result := NodeSummaries{}
+	for id, summary := range n {
+		if q.Match(summary) {
+			result[id] = summary
+		}
+	}
+	return result
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, ok := p.peek(); !ok || tok != "OR" {
+			return q, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		q = orQuery{q, right}
+	}
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	q, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok == "OR" || tok == ")" {
+			return q, nil
+		}
+		if tok == "AND" {
+			p.pos++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		q = andQuery{q, right}
+	}
+}
+
+func (p *queryParser) parseNot() (Query, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	p.pos++
+	switch tok {
+	case "NOT":
+		q, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notQuery{q}, nil
+	case "(":
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.peek(); !ok || tok != ")" {
+			return nil, fmt.Errorf("missing ) in query")
+		}
+		p.pos++
+		return q, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("unexpected %q in query", tok)
+	}
+	return parseTerm(tok)
+}
+
+// tokenizeQuery splits a query into parentheses and terms, which keep their
+// quotes.
+func tokenizeQuery(s string) ([]string, error) {
+	var (
+		tokens []string
+		token  []rune
+		quoted bool
+	)
+	end := func() {
+		if len(token) > 0 {
+			tokens = append(tokens, string(token))
+			token = nil
+		}
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token = append(token, r)
+		case quoted:
+			token = append(token, r)
+		case r == ' ' || r == '\t' || r == '\n':
+			end()
+		case r == '(' || r == ')':
+			end()
+			tokens = append(tokens, string(r))
+		default:
+			token = append(token, r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	end()
+	return tokens, nil
+}
+
+var queryOperators = []string{">=", "<=", ":", ">", "<", "="}
+
+func parseTerm(tok string) (Query, error) {
+	field, op, value := splitTerm(tok)
+	if op == "" {
+		m, err := parseMatcher(unquote(tok))
+		if err != nil {
+			return nil, err
+		}
+		return textQuery{m}, nil
+	}
+	if field == "" {
+		return nil, fmt.Errorf("missing field in %q", tok)
+	}
+	if op == ":" {
+		m, err := parseMatcher(value)
+		if err != nil {
+			return nil, err
+		}
+		return fieldQuery{field, m}, nil
+	}
+	number, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("not a number in %q", tok)
+	}
+	return numericQuery{field, op, number}, nil
+}
+
+// splitTerm splits a term at its first unquoted operator, if any. Regular
+// expressions are never split.
+func splitTerm(tok string) (field, op, value string) {
+	if strings.HasPrefix(tok, "/") {
+		return "", "", ""
+	}
+	quoted := false
+	for i, r := range tok {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if quoted {
+			continue
+		}
+		for _, o := range queryOperators {
+			if strings.HasPrefix(tok[i:], o) {
+				return unquote(tok[:i]), o, unquote(tok[i+len(o):])
+			}
+		}
+	}
+	return "", "", ""
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+type matcher func(string) bool
+
+func parseMatcher(s string) (matcher, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty value in query")
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	s = strings.ToLower(s)
+	return func(v string) bool { return strings.Contains(strings.ToLower(v), s) }, nil
+}
+
+// fieldIs is whether a row with an ID and label is the field of a query.
+func fieldIs(field, id, label string) bool {
+	return strings.EqualFold(field, label) || strings.EqualFold(field, id) ||
+		strings.HasSuffix(strings.ToLower(id), "_"+strings.ToLower(field))
+}
+
+// forEachField calls f with the ID, label and value of the metadata rows and
+// property list rows of a node summary.
+func forEachField(n NodeSummary, f func(id, label, value string) bool) bool {
+	for _, row := range n.Metadata {
+		if f(row.ID, row.Label, row.Value) {
+			return true
+		}
+	}
+	for _, table := range n.Tables {
+		for _, row := range table.Rows {
+			if label, ok := row.Entries["label"]; ok {
+				if f(row.ID, label, row.Entries["value"]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type andQuery struct{ left, right Query }
+
+func (q andQuery) Match(n NodeSummary) bool { return q.left.Match(n) && q.right.Match(n) }
+
+type orQuery struct{ left, right Query }
+
+func (q orQuery) Match(n NodeSummary) bool { return q.left.Match(n) || q.right.Match(n) }
+
+type notQuery struct{ Query }
+
+func (q notQuery) Match(n NodeSummary) bool { return !q.Query.Match(n) }
+
+type textQuery struct{ matcher }
+
+func (q textQuery) Match(n NodeSummary) bool {
+	if q.matcher(n.Label) || q.matcher(n.LabelMinor) {
+		return true
+	}
+	return forEachField(n, func(_, _, value string) bool { return q.matcher(value) })
+}
+
+type fieldQuery struct {
+	field string
+	matcher
+}
+
+func (q fieldQuery) Match(n NodeSummary) bool {
+	if strings.EqualFold(q.field, "label") && q.matcher(n.Label) {
+		return true
+	}
+	return forEachField(n, func(id, label, value string) bool {
+		return fieldIs(q.field, id, label) && q.matcher(value)
+	})
+}
+
+type numericQuery struct {
+	field  string
+	op     string
+	number float64
+}
+
+func (q numericQuery) compare(v float64) bool {
+	switch q.op {
+	case ">":
+		return v > q.number
+	case ">=":
+		return v >= q.number
+	case "<":
+		return v < q.number
+	case "<=":
+		return v <= q.number
+	}
+	return v == q.number
+}
+
+func (q numericQuery) Match(n NodeSummary) bool {
+	for _, row := range n.Metrics {
+		if !row.ValueEmpty && fieldIs(q.field, row.ID, row.Label) && q.compare(row.Value) {
+			return true
+		}
+	}
+	return forEachField(n, func(id, label, value string) bool {
+		v, err := strconv.ParseFloat(value, 64)
+		return err == nil && fieldIs(q.field, id, label) && q.compare(v)
+	})
+}
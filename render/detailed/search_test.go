@@ -0,0 +1,81 @@
+package detailed_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+var searchSummaries = detailed.NodeSummaries{
+	"web": {
+		ID:       "web",
+		Label:    "web server",
+		Metadata: []report.MetadataRow{{ID: "docker_image_name", Label: "Image name", Value: "nginx:1.13"}, {ID: "docker_container_restart_count", Label: "Restart #", Value: "4"}},
+		Metrics:  []report.MetricRow{{ID: "docker_cpu_total_usage", Label: "CPU", Format: report.PercentFormat, Value: 92}},
+		Tables: []report.Table{{ID: "docker_label_", Type: report.PropertyListType, Rows: []report.Row{
+			{ID: "label_team", Entries: map[string]string{"label": "team", "value": "frontend"}},
+		}}},
+	},
+	"db": {
+		ID:       "db",
+		Label:    "database",
+		Metadata: []report.MetadataRow{{ID: "docker_image_name", Label: "Image name", Value: "postgres:9.6"}},
+		Metrics:  []report.MetricRow{{ID: "docker_cpu_total_usage", Label: "CPU", Format: report.PercentFormat, Value: 12}},
+		Tables: []report.Table{{ID: "docker_label_", Type: report.PropertyListType, Rows: []report.Row{
+			{ID: "label_team", Entries: map[string]string{"label": "team", "value": "backend"}},
+		}}},
+	},
+	"cache": {
+		ID:      "cache",
+		Label:   "cache",
+		Metrics: []report.MetricRow{{ID: "docker_cpu_total_usage", Label: "CPU", Format: report.PercentFormat, ValueEmpty: true}},
+	},
+}
+
+func TestSearch(t *testing.T) {
+	for query, want := range map[string][]string{
+		"server":                       {"web"},
+		"NGINX":                        {"web"},
+		"/^data/":                      {"db"},
+		"team:front":                   {"web"},
+		"team:/end$/":                  {"db", "web"},
+		`"image name":postgres`:        {"db"},
+		"cpu>80%":                      {"web"},
+		"cpu<=12":                      {"db"},
+		"restart_count>=4":             {"web"},
+		"team:backend OR cpu>90":       {"db", "web"},
+		"team:/end$/ AND NOT cpu>50":   {"db"},
+		"NOT (team:frontend OR cache)": {"db"},
+		"label:cache":                  {"cache"},
+		"team:frontend cpu<50":         {},
+	} {
+		q, err := detailed.ParseQuery(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		have := []string{}
+		for id := range searchSummaries.Search(q) {
+			have = append(have, id)
+		}
+		sort.Strings(have)
+		if len(have) != len(want) {
+			t.Errorf("%s: expected %v, got %v", query, want, have)
+			continue
+		}
+		for i := range want {
+			if have[i] != want[i] {
+				t.Errorf("%s: expected %v, got %v", query, want, have)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"", "(web", "web)", "cpu>lots", ":web", `"web`, "team:/(/", "web OR", "AND web"} {
+		if _, err := detailed.ParseQuery(query); err == nil {
+			t.Errorf("Expected an error parsing %q", query)
+		}
+	}
+}
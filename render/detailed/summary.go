@@ -5,11 +5,15 @@ import (
 	"strings"
 
 	"github.com/weaveworks/scope/probe/awsecs"
+	"github.com/weaveworks/scope/probe/components"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/nomad"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/probe/virt"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
 )
@@ -22,6 +26,10 @@ const (
 	AmazonECSContainerNameLabel  = "com.amazonaws.ecs.container-name"
 	KubernetesContainerNameLabel = "io.kubernetes.container.name"
 	MarathonAppIDEnv             = "MARATHON_APP_ID"
+
+	// StatusCrashLooping is the status of containers restarting over and
+	// over.
+	StatusCrashLooping = "crashlooping"
 )
 
 // NodeSummaryGroup is a topology-typed group of children for a Node.
@@ -57,25 +65,44 @@ type NodeSummary struct {
 	Metrics    []report.MetricRow   `json:"metrics,omitempty"`
 	Tables     []report.Table       `json:"tables,omitempty"`
 	Adjacency  report.IDList        `json:"adjacency,omitempty"`
+	// Edges holds the metadata (e.g. transport) drawn of those adjacencies
+	// which have any; see report.EdgeMetadata.Rendered.
+	Edges map[string]report.EdgeMetadata `json:"edges,omitempty"`
+	// Anomalies are the IDs of the metrics of the node which deviate from
+	// their baselines, for which it is shown as anomalous.
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Status flags nodes needing attention, like StatusCrashLooping, which
+	// the UI colours distinctly.
+	Status string `json:"status,omitempty"`
 }
 
 var renderers = map[string]func(NodeSummary, report.Node) (NodeSummary, bool){
-	render.Pseudo:         pseudoNodeSummary,
-	report.Process:        processNodeSummary,
-	report.Container:      containerNodeSummary,
-	report.ContainerImage: containerImageNodeSummary,
-	report.Pod:            podNodeSummary,
-	report.Service:        podGroupNodeSummary,
-	report.Deployment:     podGroupNodeSummary,
-	report.DaemonSet:      podGroupNodeSummary,
-	report.StatefulSet:    podGroupNodeSummary,
-	report.CronJob:        podGroupNodeSummary,
-	report.ECSTask:        ecsTaskNodeSummary,
-	report.ECSService:     ecsServiceNodeSummary,
-	report.SwarmService:   swarmServiceNodeSummary,
-	report.Host:           hostNodeSummary,
-	report.Overlay:        weaveNodeSummary,
-	report.Endpoint:       nil, // Do not render
+	render.Pseudo:          pseudoNodeSummary,
+	report.Process:         processNodeSummary,
+	report.Container:       containerNodeSummary,
+	report.ContainerImage:  containerImageNodeSummary,
+	report.Pod:             podNodeSummary,
+	report.Service:         podGroupNodeSummary,
+	report.Deployment:      podGroupNodeSummary,
+	report.DaemonSet:       podGroupNodeSummary,
+	report.StatefulSet:     podGroupNodeSummary,
+	report.CronJob:         podGroupNodeSummary,
+	report.CustomResource:  customResourceNodeSummary,
+	report.ECSTask:         ecsTaskNodeSummary,
+	report.ECSService:      ecsServiceNodeSummary,
+	report.ECSStack:        ecsStackNodeSummary,
+	report.SwarmService:    swarmServiceNodeSummary,
+	report.SwarmStack:      swarmStackNodeSummary,
+	report.NomadJob:        nomadJobNodeSummary,
+	report.NomadTaskGroup:  nomadTaskGroupNodeSummary,
+	report.NomadAllocation: nomadAllocationNodeSummary,
+	report.Host:            hostNodeSummary,
+	report.NetIface:        netIfaceNodeSummary,
+	report.ScopeComponent:  scopeComponentNodeSummary,
+	report.SystemdUnit:     systemdUnitNodeSummary,
+	report.VirtualMachine:  virtualMachineNodeSummary,
+	report.Overlay:         weaveNodeSummary,
+	report.Endpoint:        nil, // Do not render
 }
 
 var templates = map[string]struct{ Label, LabelMinor string }{
@@ -86,19 +113,29 @@ var templates = map[string]struct{ Label, LabelMinor string }{
 
 // For each report.Topology, map to a 'primary' API topology. This can then be used in a variety of places.
 var primaryAPITopology = map[string]string{
-	report.Process:        "processes",
-	report.Container:      "containers",
-	report.ContainerImage: "containers-by-image",
-	report.Pod:            "pods",
-	report.Deployment:     "kube-controllers",
-	report.DaemonSet:      "kube-controllers",
-	report.StatefulSet:    "kube-controllers",
-	report.CronJob:        "kube-controllers",
-	report.Service:        "services",
-	report.ECSTask:        "ecs-tasks",
-	report.ECSService:     "ecs-services",
-	report.SwarmService:   "swarm-services",
-	report.Host:           "hosts",
+	report.Process:         "processes",
+	report.Container:       "containers",
+	report.ContainerImage:  "containers-by-image",
+	report.Pod:             "pods",
+	report.Deployment:      "kube-controllers",
+	report.DaemonSet:       "kube-controllers",
+	report.StatefulSet:     "kube-controllers",
+	report.CronJob:         "kube-controllers",
+	report.CustomResource:  "custom-resources",
+	report.Service:         "services",
+	report.ECSTask:         "ecs-tasks",
+	report.ECSService:      "ecs-services",
+	report.ECSStack:        "ecs-stacks",
+	report.SwarmService:    "swarm-services",
+	report.SwarmStack:      "swarm-stacks",
+	report.NomadJob:        "nomad-jobs",
+	report.NomadTaskGroup:  "nomad-task-groups",
+	report.NomadAllocation: "nomad-allocations",
+	report.Host:            "hosts",
+	report.NetIface:        "net-ifaces",
+	report.ScopeComponent:  "scope",
+	report.SystemdUnit:     "systemd-units",
+	report.VirtualMachine:  "virtual-machines",
 }
 
 // MakeNodeSummary summarizes a node, if possible.
@@ -108,6 +145,8 @@ func MakeNodeSummary(rc report.RenderContext, n report.Node) (NodeSummary, bool)
 		// Skip (and don't fall through to fallback) if renderer maps to nil
 		if renderer != nil {
 			summary, b := renderer(baseNodeSummary(r, n), n)
+			summary.Anomalies = anomalies(rc, n)
+			summary.Metadata = append(summary.Metadata, annotations(rc, n)...)
 			return RenderMetricURLs(summary, n, rc.MetricsGraphURL), b
 		}
 	} else if _, ok := rc.Topology(n.Topology); ok {
@@ -122,6 +161,20 @@ func MakeNodeSummary(rc report.RenderContext, n report.Node) (NodeSummary, bool)
 	return NodeSummary{}, false
 }
 
+func anomalies(rc report.RenderContext, n report.Node) []string {
+	if rc.Anomalies == nil || n.Topology == render.Pseudo {
+		return nil
+	}
+	return rc.Anomalies.Anomalies(n.ID)
+}
+
+func annotations(rc report.RenderContext, n report.Node) []report.MetadataRow {
+	if rc.Annotations == nil || n.Topology == render.Pseudo {
+		return nil
+	}
+	return rc.Annotations.Annotations(n.ID)
+}
+
 // SummarizeMetrics returns a copy of the NodeSummary where the metrics are
 // replaced with their summaries
 func (n NodeSummary) SummarizeMetrics() NodeSummary {
@@ -144,9 +197,25 @@ func baseNodeSummary(r report.Report, n report.Node) NodeSummary {
 		Parents:   Parents(r, n),
 		Tables:    NodeTables(r, n),
 		Adjacency: n.Adjacency,
+		Edges:     edgeMetadatas(n),
 	}
 }
 
+func edgeMetadatas(n report.Node) map[string]report.EdgeMetadata {
+	var result map[string]report.EdgeMetadata
+	n.Edges.ForEach(func(id string, md report.EdgeMetadata) {
+		md = md.Rendered()
+		if md == (report.EdgeMetadata{}) || !n.Adjacency.Contains(id) {
+			return
+		}
+		if result == nil {
+			result = map[string]report.EdgeMetadata{}
+		}
+		result[id] = md
+	})
+	return result
+}
+
 func pseudoNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	base.Pseudo = true
 	base.Rank = n.ID
@@ -222,6 +291,10 @@ func containerNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 		base.Rank = docker.ImageNameWithoutVersion(imageName)
 	}
 
+	if crashLooping, ok := n.Latest.Lookup(docker.ContainerCrashLooping); ok && crashLooping == "true" {
+		base.Status = StatusCrashLooping
+	}
+
 	return base, true
 }
 
@@ -285,6 +358,18 @@ func podGroupNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	return base, true
 }
 
+func customResourceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base = addKubernetesLabelAndRank(base, n)
+	base.Stack = true
+	count := pluralize(n.Counters, report.Pod, "pod", "pods")
+	if kind, ok := n.Latest.Lookup(kubernetes.NodeType); ok {
+		base.LabelMinor = fmt.Sprintf("%s of %s", kind, count)
+	} else {
+		base.LabelMinor = count
+	}
+	return base, true
+}
+
 func ecsTaskNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	base.Label, _ = n.Latest.Lookup(awsecs.TaskFamily)
 	return base, true
@@ -296,8 +381,63 @@ func ecsServiceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool)
 	return base, true
 }
 
+func ecsStackNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(awsecs.StackName)
+	base.Stack = true
+	count := pluralize(n.Counters, report.ECSTask, "task", "tasks")
+	if kind, ok := n.Latest.Lookup(awsecs.StackKind); ok {
+		base.LabelMinor = fmt.Sprintf("%s of %s", kind, count)
+	} else {
+		base.LabelMinor = count
+	}
+	return base, true
+}
+
 func swarmServiceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	base.Label, _ = n.Latest.Lookup(docker.ServiceName)
+	if desired, ok := n.Latest.Lookup(docker.ServiceDesiredReplicas); ok {
+		running, _ := n.Latest.Lookup(docker.ServiceRunningReplicas)
+		base.LabelMinor = fmt.Sprintf("%s/%s replicas", running, desired)
+	}
+	return base, true
+}
+
+func swarmStackNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(docker.StackNamespace)
+	base.Stack = true
+	base.LabelMinor = pluralize(n.Counters, report.SwarmService, "service", "services")
+	return base, true
+}
+
+func addNomadLabelAndRank(base NodeSummary, n report.Node) NodeSummary {
+	base.Label, _ = n.Latest.Lookup(nomad.Name)
+	namespace, _ := n.Latest.Lookup(nomad.Namespace)
+	base.Rank = namespace + "/" + base.Label
+	return base
+}
+
+func nomadJobNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base = addNomadLabelAndRank(base, n)
+	base.Stack = true
+	count := pluralize(n.Counters, report.NomadTaskGroup, "task group", "task groups")
+	if jobType, ok := n.Latest.Lookup(nomad.JobType); ok && jobType != "" {
+		base.LabelMinor = fmt.Sprintf("%s of %s", jobType, count)
+	} else {
+		base.LabelMinor = count
+	}
+	return base, true
+}
+
+func nomadTaskGroupNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base = addNomadLabelAndRank(base, n)
+	base.Stack = true
+	base.LabelMinor = pluralize(n.Counters, report.NomadAllocation, "allocation", "allocations")
+	return base, true
+}
+
+func nomadAllocationNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base = addNomadLabelAndRank(base, n)
+	base.LabelMinor = pluralize(n.Counters, report.Container, "container", "containers")
 	return base, true
 }
 
@@ -316,6 +456,55 @@ func hostNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	return base, true
 }
 
+func netIfaceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(host.NetIfaceName)
+	hostID, _, _ := report.ParseNetIfaceNodeID(n.ID)
+	base.Rank = hostID
+	if kind, ok := n.Latest.Lookup(host.NetIfaceKind); ok {
+		base.LabelMinor = fmt.Sprintf("%s on %s", kind, hostID)
+	} else {
+		base.LabelMinor = hostID
+	}
+	return base, true
+}
+
+func scopeComponentNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(components.Name)
+	kind, _ := n.Latest.Lookup(components.Kind)
+	base.Rank = kind
+	if status, ok := n.Latest.Lookup(components.Status); ok {
+		base.LabelMinor = fmt.Sprintf("%s, %s", kind, status)
+	} else {
+		base.LabelMinor = kind
+	}
+	return base, true
+}
+
+func systemdUnitNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	name, _ := n.Latest.Lookup(systemd.UnitName)
+	base.Label = strings.TrimSuffix(name, ".service")
+	hostID, _, _ := report.ParseSystemdUnitNodeID(n.ID)
+	base.Rank = hostID
+	if state, ok := n.Latest.Lookup(systemd.SubState); ok {
+		base.LabelMinor = fmt.Sprintf("%s on %s", state, hostID)
+	} else {
+		base.LabelMinor = hostID
+	}
+	return base, true
+}
+
+func virtualMachineNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(virt.DomainName)
+	hostID, _, _ := report.ParseVirtualMachineNodeID(n.ID)
+	base.Rank = hostID
+	if state, ok := n.Latest.Lookup(virt.State); ok {
+		base.LabelMinor = fmt.Sprintf("%s on %s", state, hostID)
+	} else {
+		base.LabelMinor = hostID
+	}
+	return base, true
+}
+
 func weaveNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	var (
 		nickname, _ = n.Latest.Lookup(overlay.WeavePeerNickName)
@@ -346,6 +535,8 @@ func groupNodeSummary(base NodeSummary, r report.Report, n report.Node) (NodeSum
 	if ok && t.Label != "" {
 		base.LabelMinor = pluralize(n.Counters, parts[1], t.Label, t.LabelPlural)
 	}
+	// Groups have no metrics but those summed from their nodes, like costs
+	base.Metrics = t.MetricTemplates.MetricRows(n)
 
 	base.Shape = t.GetShape()
 	base.Stack = true
@@ -133,6 +133,25 @@ func TestMakeNodeSummary(t *testing.T) {
 				Adjacency: report.MakeIDList(fixture.ServerContainerNodeID),
 			},
 		},
+		{
+			name:  "crash looping container rendering",
+			input: expected.RenderedContainers[fixture.ClientContainerNodeID].WithLatests(map[string]string{docker.ContainerCrashLooping: "true"}),
+			ok:    true,
+			want: detailed.NodeSummary{
+				ID:         fixture.ClientContainerNodeID,
+				Label:      fixture.ClientContainerName,
+				LabelMinor: fixture.ClientHostName,
+				Rank:       fixture.ClientContainerImageName,
+				Shape:      "hexagon",
+				Linkable:   true,
+				Metadata: []report.MetadataRow{
+					{ID: docker.ImageName, Label: "Image", Value: fixture.ClientContainerImageName, Priority: 1},
+					{ID: docker.ContainerID, Label: "ID", Value: fixture.ClientContainerID, Priority: 10, Truncate: 12},
+				},
+				Adjacency: report.MakeIDList(fixture.ServerContainerNodeID),
+				Status:    detailed.StatusCrashLooping,
+			},
+		},
 		{
 			name:  "single container image rendering",
 			input: expected.RenderedContainerImages[expected.ClientContainerImageNodeID],
@@ -195,3 +214,19 @@ func TestMakeNodeSummary(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeNodeSummaryEdges(t *testing.T) {
+	// Only what edges are drawn with is summarized, not their traffic
+	bytes := uint64(1500)
+	node := report.MakeNode("a").WithTopology(report.Host).
+		WithEdge("b", report.EdgeMetadata{Transport: "udp", EgressByteCount: &bytes}).
+		WithEdge("c", report.EdgeMetadata{EgressByteCount: &bytes})
+	have, ok := detailed.MakeNodeSummary(report.RenderContext{Report: fixture.Report}, node)
+	if !ok {
+		t.Fatal("Expected node to be summarizable, but wasn't")
+	}
+	want := map[string]report.EdgeMetadata{"b": {Transport: "udp"}}
+	if !reflect.DeepEqual(want, have.Edges) {
+		t.Error(test.Diff(want, have.Edges))
+	}
+}
@@ -11,6 +11,17 @@ type Diff struct {
 	Update []NodeSummary `json:"update"`
 	Remove []string      `json:"remove"`
 	Reset  bool          `json:"reset,omitempty"`
+	// Patch holds the changes to nodes instead of Update, in diffs made by
+	// TopoDelta.
+	Patch []NodePatch `json:"patch,omitempty"`
+}
+
+// NodePatch is the change to a node, as the fields of its NodeSummary which
+// have changed, keyed by their JSON names. Fields which have become empty
+// are nil.
+type NodePatch struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
 }
 
 // TopoDiff gives you the diff to get from A to B.
@@ -38,3 +49,44 @@ func TopoDiff(a, b NodeSummaries) Diff {
 
 	return diff
 }
+
+// TopoDelta is TopoDiff, with NodePatches instead of whole nodes for the
+// updates, which are mostly small changes of metrics.
+func TopoDelta(a, b NodeSummaries) Diff {
+	diff := TopoDiff(a, b)
+	for _, node := range diff.Update {
+		diff.Patch = append(diff.Patch, MakeNodePatch(a[node.ID], node))
+	}
+	diff.Update = nil
+	return diff
+}
+
+// MakeNodePatch gives the patch from a to b.
+func MakeNodePatch(a, b NodeSummary) NodePatch {
+	fields := map[string]interface{}{}
+	set := func(name string, changed bool, value interface{}, empty bool) {
+		if !changed {
+			return
+		}
+		if empty {
+			value = nil
+		}
+		fields[name] = value
+	}
+	set("label", a.Label != b.Label, b.Label, false)
+	set("labelMinor", a.LabelMinor != b.LabelMinor, b.LabelMinor, false)
+	set("rank", a.Rank != b.Rank, b.Rank, false)
+	set("shape", a.Shape != b.Shape, b.Shape, b.Shape == "")
+	set("stack", a.Stack != b.Stack, b.Stack, !b.Stack)
+	set("linkable", a.Linkable != b.Linkable, b.Linkable, !b.Linkable)
+	set("pseudo", a.Pseudo != b.Pseudo, b.Pseudo, !b.Pseudo)
+	set("metadata", !reflect.DeepEqual(a.Metadata, b.Metadata), b.Metadata, len(b.Metadata) == 0)
+	set("parents", !reflect.DeepEqual(a.Parents, b.Parents), b.Parents, len(b.Parents) == 0)
+	set("metrics", !reflect.DeepEqual(a.Metrics, b.Metrics), b.Metrics, len(b.Metrics) == 0)
+	set("tables", !reflect.DeepEqual(a.Tables, b.Tables), b.Tables, len(b.Tables) == 0)
+	set("adjacency", !reflect.DeepEqual(a.Adjacency, b.Adjacency), b.Adjacency, len(b.Adjacency) == 0)
+	set("edges", !reflect.DeepEqual(a.Edges, b.Edges), b.Edges, len(b.Edges) == 0)
+	set("anomalies", !reflect.DeepEqual(a.Anomalies, b.Anomalies), b.Anomalies, len(b.Anomalies) == 0)
+	set("status", a.Status != b.Status, b.Status, b.Status == "")
+	return NodePatch{ID: b.ID, Fields: fields}
+}
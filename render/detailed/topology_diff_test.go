@@ -3,6 +3,7 @@ package detailed_test
 import (
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/weaveworks/common/test"
@@ -104,3 +105,66 @@ func TestTopoDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestTopoDelta(t *testing.T) {
+	nodea := detailed.NodeSummary{
+		ID:        "nodea",
+		Label:     "Node A",
+		Shape:     "circle",
+		Adjacency: report.MakeIDList("nodeb"),
+	}
+	nodeap := nodea
+	nodeap.Label = "Node A'"
+	nodeap.Shape = ""
+	nodeap.Metadata = []report.MetadataRow{{ID: "foo", Value: "bar"}}
+	nodeb := detailed.NodeSummary{ID: "nodeb"}
+
+	have := detailed.TopoDelta(
+		detailed.NodeSummaries{"nodea": nodea, "nodeb": nodeb},
+		detailed.NodeSummaries{"nodea": nodeap, "nodeb": nodeb},
+	)
+	want := detailed.Diff{
+		Patch: []detailed.NodePatch{{
+			ID: "nodea",
+			Fields: map[string]interface{}{
+				"label":    "Node A'",
+				"shape":    nil,
+				"metadata": nodeap.Metadata,
+			},
+		}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestMakeNodePatchFields(t *testing.T) {
+	// Every field of NodeSummary but the ID is patched when it changes
+	typ := reflect.TypeOf(detailed.NodeSummary{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "id" {
+			continue
+		}
+		var b detailed.NodeSummary
+		v := reflect.ValueOf(&b).Elem().Field(i)
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString("changed")
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		case reflect.Map:
+			v.Set(reflect.MakeMap(v.Type()))
+			v.SetMapIndex(reflect.Zero(v.Type().Key()), reflect.Zero(v.Type().Elem()))
+		default:
+			t.Fatalf("Field %s is of an unexpected kind %s", field.Name, v.Kind())
+		}
+		patch := detailed.MakeNodePatch(detailed.NodeSummary{}, b)
+		if _, ok := patch.Fields[name]; !ok {
+			t.Errorf("Expected a change of %s to be patched as %q, got %v", field.Name, name, patch.Fields)
+		}
+	}
+}
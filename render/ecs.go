@@ -23,6 +23,15 @@ var ECSServiceRenderer = ConditionalRenderer(renderECSTopologies,
 	),
 )
 
+// ECSStackRenderer is a Renderer for the CloudFormation stacks and Terraform
+// workspaces which created Amazon ECS tasks.
+var ECSStackRenderer = ConditionalRenderer(renderECSTopologies,
+	renderParents(
+		report.ECSTask, []string{report.ECSStack}, "",
+		ECSTaskRenderer,
+	),
+)
+
 func renderECSTopologies(rpt report.Report) bool {
-	return len(rpt.ECSTask.Nodes)+len(rpt.ECSService.Nodes) >= 1
+	return len(rpt.ECSTask.Nodes)+len(rpt.ECSService.Nodes)+len(rpt.ECSStack.Nodes) >= 1
 }
@@ -2,6 +2,7 @@ package render
 
 import (
 	"strings"
+	"time"
 
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/docker"
@@ -153,10 +154,12 @@ func (f *Filter) Render(rpt report.Report, dct Decorator) report.Nodes {
 }
 
 func (f *Filter) render(rpt report.Report, dct Decorator) (report.Nodes, int) {
+	input := f.Renderer.Render(rpt, dct)
+	begin := stageStart()
 	output := report.Nodes{}
 	inDegrees := map[string]int{}
 	filtered := 0
-	for id, node := range f.Renderer.Render(rpt, dct) {
+	for id, node := range input {
 		if f.FilterFunc(node) {
 			output[id] = node
 			inDegrees[id] = 0
@@ -190,6 +193,7 @@ func (f *Filter) render(rpt report.Report, dct Decorator) (report.Nodes, int) {
 		delete(output, id)
 		filtered++
 	}
+	observeStage(rpt, "filter", f.FilterFunc, begin, len(output))
 	return output, filtered
 }
 
@@ -251,6 +255,25 @@ func IsRunning(n report.Node) bool {
 // IsStopped checks if the node is *not* a running docker container
 var IsStopped = Complement(IsRunning)
 
+// OOMKillWindow is how recently containers must have been OOM killed to be
+// shown by IsRecentlyOOMKilled.
+const OOMKillWindow = time.Hour
+
+// IsRecentlyOOMKilled checks if the node is a docker container or a pod
+// which was last terminated for running out of memory, within the last
+// OOMKillWindow.
+func IsRecentlyOOMKilled(n report.Node) bool {
+	finished, ok := n.Latest.Lookup(docker.ContainerFinished)
+	if oomKilled, _ := n.Latest.Lookup(docker.ContainerOOMKilled); !ok || oomKilled != "true" {
+		finished, ok = n.Latest.Lookup(kubernetes.LastTerminated)
+		if reason, _ := n.Latest.Lookup(kubernetes.LastTermination); !ok || reason != "OOMKilled" {
+			return false
+		}
+	}
+	t, err := time.Parse(time.RFC3339Nano, finished)
+	return err == nil && mtime.Now().Sub(t) < OOMKillWindow
+}
+
 // IsApplication checks if the node is an "application" node
 func IsApplication(n report.Node) bool {
 	containerName, _ := n.Latest.Lookup(docker.ContainerName)
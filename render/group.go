@@ -0,0 +1,44 @@
+package render
+
+import (
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// MakeGroupRenderer makes a Renderer grouping the nodes of another one by
+// the value of the first of the keys they have in their latest values. Nodes
+// with none of the keys go in a group with the ungrouped label, or are
+// dropped if it is empty.
+func MakeGroupRenderer(keys []string, ungrouped string, r Renderer) Renderer {
+	return MakeMap(MapGroupBy(keys, ungrouped), r)
+}
+
+// MapGroupBy makes a MapFunc mapping nodes to the group nodes of
+// MakeGroupRenderer.
+func MapGroupBy(keys []string, ungrouped string) MapFunc {
+	return func(n report.Node, _ report.Networks) report.Nodes {
+		// Propagate all pseudo nodes
+		if n.Topology == Pseudo {
+			return report.Nodes{n.ID: n}
+		}
+
+		for _, key := range keys {
+			if value, timestamp, ok := n.Latest.LookupEntry(key); ok {
+				return groupNode(n, key, value, timestamp)
+			}
+		}
+		if ungrouped == "" || len(keys) == 0 {
+			return report.Nodes{}
+		}
+		return groupNode(n, keys[0], ungrouped, time.Time{})
+	}
+}
+
+// groupNode makes the group node of a node, labelled by the group value.
+func groupNode(n report.Node, key, value string, timestamp time.Time) report.Nodes {
+	node := NewDerivedNode(value, n).WithTopology(MakeGroupNodeTopology(n.Topology, key))
+	node.Latest = node.Latest.Set(key, timestamp, value)
+	node.Counters = node.Counters.Add(n.Topology, 1)
+	return report.Nodes{value: node}
+}
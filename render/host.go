@@ -1,6 +1,8 @@
 package render
 
 import (
+	"github.com/weaveworks/scope/probe/awsec2"
+	"github.com/weaveworks/scope/probe/cloud"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -30,6 +32,10 @@ var HostRenderer = MakeReduce(
 	SelectHost,
 )
 
+// HostAvailabilityZoneRenderer is a Renderer which groups the hosts on EC2,
+// Azure and GCP by the availability zone they are in.
+var HostAvailabilityZoneRenderer = MakeGroupRenderer([]string{awsec2.AvailabilityZone, cloud.Zone}, "", HostRenderer)
+
 // MapX2Host maps any Nodes to host Nodes.
 //
 // If this function is given a node without a hostname
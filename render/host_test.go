@@ -4,8 +4,11 @@ import (
 	"testing"
 
 	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/probe/awsec2"
+	"github.com/weaveworks/scope/probe/cloud"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/expected"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 	"github.com/weaveworks/scope/test/reflect"
 	"github.com/weaveworks/scope/test/utils"
@@ -18,3 +21,20 @@ func TestHostRenderer(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestHostAvailabilityZoneRenderer(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	// Zones of EC2 hosts, and of those of other clouds
+	rpt.Host.Nodes[fixture.ClientHostNodeID] = rpt.Host.Nodes[fixture.ClientHostNodeID].WithLatests(map[string]string{awsec2.AvailabilityZone: "us-east-1a"})
+	rpt.Host.Nodes[fixture.ServerHostNodeID] = rpt.Host.Nodes[fixture.ServerHostNodeID].WithLatests(map[string]string{cloud.Zone: "us-central1-b"})
+	have := render.HostAvailabilityZoneRenderer.Render(rpt, FilterNoop)
+	for _, zone := range []string{"us-east-1a", "us-central1-b"} {
+		node, ok := have[zone]
+		if !ok {
+			t.Fatalf("Expected a node of zone %s, got %v", zone, have)
+		}
+		if count, _ := node.Counters.Lookup(report.Host); count != 1 {
+			t.Errorf("Expected one host in zone %s, got %d", zone, count)
+		}
+	}
+}
@@ -48,9 +48,18 @@ func NewDerivedExternalNode(n report.Node, addr string, local report.Networks) (
 		}
 	}
 
-	// If the dstNodeAddr is not in a network local to this report, we emit an
-	// internet pseudoNode
+	// Addresses outside of the networks local to this report can be of the
+	// published ranges of a service, which the app classifies them by.
 	if ip := net.ParseIP(addr); ip != nil && !local.Contains(ip) {
+		if service, ok := n.Latest.Lookup(KnownService); ok && service != "" {
+			return NewDerivedPseudoNode(ServiceNodeIDPrefix+service, n), true
+		}
+	}
+
+	// If the dstNodeAddr is not in a network local to this report, we emit an
+	// internet pseudoNode. IPv6 link-local addresses are never routed off
+	// their link, so they are never external.
+	if ip := net.ParseIP(addr); ip != nil && !local.Contains(ip) && !(ip.To4() == nil && ip.IsLinkLocalUnicast()) {
 		// emit one internet node for incoming, one for outgoing
 		if len(n.Adjacency) > 0 {
 			return NewDerivedPseudoNode(IncomingInternetID, n), true
@@ -0,0 +1,51 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestContainerRendererIPv6(t *testing.T) {
+	var (
+		hostNodeID     = report.MakeHostNodeID("host1")
+		containerID    = report.MakeContainerNodeID("abcdef")
+		serverEndpoint = report.MakeEndpointNodeID("host1", "", "fd00::2", "80")
+		mappedEndpoint = report.MakeEndpointNodeID("host1", "", "2001:db8::1", "8080")
+		clientEndpoint = report.MakeEndpointNodeID("", "", "2001:db8:ffff::99", "50000")
+		peerEndpoint   = report.MakeEndpointNodeID("", "", "fe80::1", "50001")
+	)
+	rpt := report.MakeReport()
+	rpt.Endpoint = rpt.Endpoint.
+		AddNode(report.MakeNodeWith(serverEndpoint, map[string]string{report.HostNodeID: hostNodeID}).WithTopology(report.Endpoint)).
+		AddNode(report.MakeNodeWith(mappedEndpoint, map[string]string{report.HostNodeID: hostNodeID}).WithTopology(report.Endpoint)).
+		AddNode(report.MakeNode(clientEndpoint).WithTopology(report.Endpoint).WithAdjacent(serverEndpoint).WithAdjacent(mappedEndpoint)).
+		AddNode(report.MakeNode(peerEndpoint).WithTopology(report.Endpoint).WithAdjacent(serverEndpoint))
+	rpt.Container = rpt.Container.AddNode(report.MakeNodeWith(containerID, map[string]string{
+		docker.ContainerID: "abcdef",
+		report.HostNodeID:  hostNodeID,
+	}).WithTopology(report.Container).WithSets(report.MakeSets().
+		Add(docker.ContainerIPsWithScopes, report.MakeStringSet(report.MakeAddressNodeID("host1", "fd00::2"))).
+		Add(docker.ContainerPorts, report.MakeStringSet("[2001:db8::1]:8080->80/tcp"))))
+	rpt.Host = rpt.Host.AddNode(report.MakeNode(hostNodeID).WithTopology(report.Host).
+		WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet("fd00::/64", "2001:db8::/64"))))
+
+	have := render.ContainerRenderer.Render(rpt, FilterNoop)
+	internet, ok := have[render.IncomingInternetID]
+	if !ok {
+		t.Fatalf("Expected the internet to connect to the container, got %v", have)
+	}
+	if !internet.Adjacency.Contains(containerID) {
+		t.Errorf("Expected the internet to be adjacent to the container, got %v", internet.Adjacency)
+	}
+	ips := render.MapContainer2IP(rpt.Container.Nodes[containerID])
+	if want := report.MakeScopedEndpointNodeID("", "2001:db8::1", "8080"); len(ips) != 2 || ips[1] != want {
+		t.Errorf("Expected the port mapping %s, got %v", want, ips)
+	}
+	if _, ok := render.NewDerivedExternalNode(rpt.Endpoint.Nodes[peerEndpoint], "fe80::1", render.LocalNetworks(rpt)); ok {
+		t.Errorf("Expected the link-local peer not to be external")
+	}
+}
@@ -10,17 +10,51 @@ import (
 	"github.com/weaveworks/scope/report"
 )
 
-// renderCache is keyed on the combination of Memoiser and report
-// id. It contains promises of report.Nodes, which result from
-// rendering the report with the Memoiser's renderer.
+// DefaultCacheSize is how many reports have their renders kept, unless set
+// otherwise with SetCacheSize. Requests render the latest report, but those
+// in flight when a new one comes in still render the previous ones.
+const DefaultCacheSize = 4
+
+// renderCache is keyed on report id, and holds a generation of
+// renders for each: the outputs of all the Memoisers which rendered
+// the report. Generations are evicted in one go, so that the
+// intermediate outputs shared by the renderers of all topologies stay
+// cached for as long as their report is being rendered, however many
+// Memoisers there are.
+var renderCache = gcache.New(DefaultCacheSize).LRU().Build()
+
+// renderCacheMtx makes sure a report only ever has one generation.
+var renderCacheMtx sync.Mutex
+
+// generation contains promises of report.Nodes, by Memoiser, which
+// result from rendering a report with the Memoiser's renderer.
 //
 // The use of promises ensures that in the absence of cache evictions
 // a memoiser will only ever render a report once, even when Render()
 // is invoked concurrently.
-var renderCache = gcache.New(100).LRU().Build()
+type generation struct {
+	sync.Mutex
+	promises map[string]*promise
+}
+
+// generationFor gives the generation of renders of a report, starting
+// one if needed.
+func generationFor(rpt report.Report) *generation {
+	v, err := renderCache.Get(rpt.ID)
+	if err == nil {
+		return v.(*generation)
+	}
+	renderCacheMtx.Lock()
+	defer renderCacheMtx.Unlock()
+	if v, err := renderCache.Get(rpt.ID); err == nil {
+		return v.(*generation)
+	}
+	g := &generation{promises: map[string]*promise{}}
+	renderCache.Set(rpt.ID, g)
+	return g
+}
 
 type memoise struct {
-	sync.Mutex
 	Renderer
 	id string
 }
@@ -34,9 +68,9 @@ func Memoise(r Renderer) Renderer {
 }
 
 // Render produces a set of Nodes given a Report.  Ideally, it just
-// retrieves a promise from the cache and returns its value, otherwise
-// it stores a new promise and fulfils it by calling through to
-// m.Renderer.
+// retrieves a promise from the report's generation and returns its
+// value, otherwise it stores a new promise and fulfils it by calling
+// through to m.Renderer.
 //
 // The cache is bypassed when rendering a report with a decorator.
 func (m *memoise) Render(rpt report.Report, dct Decorator) report.Nodes {
@@ -44,17 +78,15 @@ func (m *memoise) Render(rpt report.Report, dct Decorator) report.Nodes {
 		return m.Renderer.Render(rpt, dct)
 	}
 
-	key := fmt.Sprintf("%s-%s", rpt.ID, m.id)
-
-	m.Lock()
-	v, err := renderCache.Get(key)
-	if err == nil {
-		m.Unlock()
-		return v.(*promise).Get()
+	g := generationFor(rpt)
+	g.Lock()
+	if p, ok := g.promises[m.id]; ok {
+		g.Unlock()
+		return p.Get()
 	}
 	promise := newPromise()
-	renderCache.Set(key, promise)
-	m.Unlock()
+	g.promises[m.id] = promise
+	g.Unlock()
 
 	output := m.Renderer.Render(rpt, dct)
 
@@ -82,6 +114,19 @@ func (p *promise) Get() report.Nodes {
 	return p.val
 }
 
+// SetCacheSize sets how many reports have their renders kept, emptying the
+// cache. Multitenant apps render the latest report of every user rendering,
+// and so want at least as many generations as users rendering at once.
+// It must be called before anything renders.
+func SetCacheSize(generations int) {
+	if generations < 1 {
+		generations = 1
+	}
+	renderCacheMtx.Lock()
+	defer renderCacheMtx.Unlock()
+	renderCache = gcache.New(generations).LRU().Build()
+}
+
 // ResetCache blows away the rendered node cache.
 func ResetCache() {
 	renderCache.Purge()
@@ -58,3 +58,60 @@ func TestMemoise(t *testing.T) {
 		t.Errorf("Expected renderer to have been called again after cache reset")
 	}
 }
+
+func TestMemoiseGenerations(t *testing.T) {
+	render.ResetCache()
+	calls := 0
+	var memoisers []render.Renderer
+	for i := 0; i < 200; i++ {
+		memoisers = append(memoisers, render.Memoise(renderFunc(func(rpt report.Report) report.Nodes {
+			calls++
+			return report.Nodes{}
+		})))
+	}
+
+	// All the renders of a report are kept, however many memoisers rendered it
+	rpt := report.MakeReport()
+	for i := 0; i < 2; i++ {
+		for _, m := range memoisers {
+			m.Render(rpt, nil)
+		}
+	}
+	if calls != len(memoisers) {
+		t.Errorf("Expected each memoiser to render the report once, got %d renders", calls)
+	}
+
+	// Renders of older reports are evicted as new reports get rendered
+	for i := 0; i < 10; i++ {
+		memoisers[0].Render(report.MakeReport(), nil)
+	}
+	calls = 0
+	memoisers[0].Render(rpt, nil)
+	if calls != 1 {
+		t.Errorf("Expected the renders of an old report to have been evicted")
+	}
+}
+
+func TestMemoiseCacheSize(t *testing.T) {
+	render.SetCacheSize(20)
+	defer render.SetCacheSize(render.DefaultCacheSize)
+	calls := 0
+	m := render.Memoise(renderFunc(func(rpt report.Report) report.Nodes {
+		calls++
+		return report.Nodes{}
+	}))
+
+	// The renders of as many reports as there are generations are kept,
+	// like the latest reports of that many users
+	var rpts []report.Report
+	for i := 0; i < 20; i++ {
+		rpts = append(rpts, report.MakeReport())
+		m.Render(rpts[i], nil)
+	}
+	for _, rpt := range rpts {
+		m.Render(rpt, nil)
+	}
+	if calls != len(rpts) {
+		t.Errorf("Expected each report to be rendered once, got %d renders", calls)
+	}
+}
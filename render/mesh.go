@@ -0,0 +1,100 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/envoy"
+	"github.com/weaveworks/scope/report"
+)
+
+// MakeSidecarAttributor makes a Renderer which moves the edges of the Envoy
+// sidecar containers rendered by r onto the application container of their
+// pod, as sidecars proxy all the traffic of the pod. Pods with more than one
+// application container are left alone, as we can't tell which of them the
+// traffic belongs to.
+func MakeSidecarAttributor(r Renderer) Renderer {
+	return sidecarAttributor{r}
+}
+
+type sidecarAttributor struct {
+	Renderer
+}
+
+const k8sPauseContainerName = "POD"
+
+// sidecarTargets maps the IDs of sidecar containers to the ID of the
+// application container in their pod.
+func sidecarTargets(nodes report.Nodes) map[string]string {
+	var (
+		sidecars = map[string]string{} // pod UID -> sidecar
+		apps     = map[string][]string{}
+	)
+	for id, n := range nodes {
+		if n.Topology != report.Container {
+			continue
+		}
+		podUID, ok := envoy.PodUID(n)
+		if !ok {
+			continue
+		}
+		if envoy.IsSidecar(n) {
+			sidecars[podUID] = id
+			continue
+		}
+		if name, _ := n.Latest.Lookup(docker.LabelPrefix + "io.kubernetes.container.name"); name == k8sPauseContainerName {
+			continue
+		}
+		apps[podUID] = append(apps[podUID], id)
+	}
+	targets := map[string]string{}
+	for podUID, sidecar := range sidecars {
+		if ids := apps[podUID]; len(ids) == 1 {
+			targets[sidecar] = ids[0]
+		}
+	}
+	return targets
+}
+
+func (r sidecarAttributor) Render(rpt report.Report, dct Decorator) report.Nodes {
+	nodes := r.Renderer.Render(rpt, dct)
+	targets := sidecarTargets(nodes)
+	if len(targets) == 0 {
+		return nodes
+	}
+	target := func(id string) string {
+		if t, ok := targets[id]; ok {
+			return t
+		}
+		return id
+	}
+
+	output := report.Nodes{}
+	for id, n := range nodes {
+		var (
+			src       = target(id)
+			adjacency = report.MakeIDList()
+			edges     = report.MakeEdgeMetadatas()
+		)
+		for _, dst := range n.Adjacency {
+			if dst = target(dst); dst != src {
+				adjacency = adjacency.Add(dst)
+			}
+		}
+		n.Edges.ForEach(func(dst string, md report.EdgeMetadata) {
+			if dst = target(dst); dst != src {
+				edges = edges.Add(dst, md)
+			}
+		})
+		if src != id {
+			// Keep the sidecar, but without its edges
+			n.Adjacency, n.Edges = report.MakeIDList(), report.MakeEdgeMetadatas()
+			output[id] = n
+			n = report.MakeNode(src).WithTopology(report.Container)
+		}
+		n.Adjacency, n.Edges = adjacency, edges
+		if existing, ok := output[src]; ok {
+			n = existing.Merge(n)
+		}
+		output[src] = n
+	}
+	return output
+}
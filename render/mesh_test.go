@@ -0,0 +1,46 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func podContainer(id, podUID, name string) report.Node {
+	return report.MakeNodeWith(id, map[string]string{
+		docker.LabelPrefix + "io.kubernetes.pod.uid":        podUID,
+		docker.LabelPrefix + "io.kubernetes.container.name": name,
+	}).WithTopology(report.Container)
+}
+
+func TestSidecarAttributor(t *testing.T) {
+	renderer := render.MakeSidecarAttributor(mockRenderer{Nodes: report.Nodes{
+		"pause":    podContainer("pause", "pod1", "POD"),
+		"app":      podContainer("app", "pod1", "app"),
+		"proxy":    podContainer("proxy", "pod1", "istio-proxy").WithAdjacent("db").WithEdge("db", report.EdgeMetadata{EgressPacketCount: newu64(10)}),
+		"db":       podContainer("db", "pod2", "db").WithAdjacent("proxy"),
+		"twoapps1": podContainer("twoapps1", "pod3", "one"),
+		"twoapps2": podContainer("twoapps2", "pod3", "two"),
+		"proxy3":   podContainer("proxy3", "pod3", "istio-proxy").WithAdjacent("db"),
+	}})
+	have := renderer.Render(report.MakeReport(), FilterNoop)
+
+	if adjacency := have["app"].Adjacency; !adjacency.Contains("db") {
+		t.Errorf("app should have the edge of its sidecar, has %v", adjacency)
+	}
+	if md, ok := have["app"].Edges.Lookup("db"); !ok || md.EgressPacketCount == nil || *md.EgressPacketCount != 10 {
+		t.Errorf("app should have the edge metadata of its sidecar, has %v", have["app"].Edges)
+	}
+	if len(have["proxy"].Adjacency) != 0 {
+		t.Errorf("sidecar should have no edges, has %v", have["proxy"].Adjacency)
+	}
+	if adjacency := have["db"].Adjacency; !adjacency.Contains("app") || adjacency.Contains("proxy") {
+		t.Errorf("edges to the sidecar should go to the app, have %v", adjacency)
+	}
+	// Can't tell which of two apps the sidecar traffic is for
+	if adjacency := have["proxy3"].Adjacency; !adjacency.Contains("db") {
+		t.Errorf("sidecar of pod with two apps should keep its edges, has %v", adjacency)
+	}
+}
@@ -1,6 +1,8 @@
 package render
 
 import (
+	"time"
+
 	"github.com/weaveworks/scope/report"
 )
 
@@ -22,3 +24,38 @@ func PropagateSingleMetrics(topology string) MapFunc {
 		return report.Nodes{n.ID: n}
 	}
 }
+
+// PropagateSummedMetrics puts the sums of the latest samples of metrics of
+// all the children of a topology onto the parent, e.g. the costs of the pods
+// of a namespace.
+func PropagateSummedMetrics(topology string, metricIDs ...string) MapFunc {
+	return func(n report.Node, _ report.Networks) report.Nodes {
+		for _, id := range metricIDs {
+			var (
+				sum   float64
+				found bool
+				ts    time.Time
+			)
+			n.Children.ForEach(func(child report.Node) {
+				if child.Topology != topology {
+					return
+				}
+				metric, ok := child.Metrics.Lookup(id)
+				if !ok {
+					return
+				}
+				if s, ok := metric.LastSample(); ok {
+					sum += s.Value
+					found = true
+					if s.Timestamp.After(ts) {
+						ts = s.Timestamp
+					}
+				}
+			})
+			if found {
+				n = n.WithMetric(id, report.MakeSingletonMetric(ts, sum))
+			}
+		}
+		return report.Nodes{n.ID: n}
+	}
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// NetIfaceRenderer is a Renderer for the network interfaces of hosts. The
+// containers holding the peers of veths, and the virtual machines plugged
+// into taps, are rendered with them, so CNI and libvirt plumbing shows as
+// edges.
+var NetIfaceRenderer = ConditionalRenderer(renderNetIfaces,
+	CustomRenderer{
+		RenderFunc: plumbNetIfaces,
+		Renderer: MakeReduce(
+			SelectNetIface,
+			MakeFilter(IsRunning, SelectContainer),
+			SelectVirtualMachine,
+		),
+	},
+)
+
+func renderNetIfaces(rpt report.Report) bool {
+	return len(rpt.NetIface.Nodes) >= 1
+}
+
+// plumbNetIfaces keeps the interfaces reported by hosts, and the containers
+// and VMs they are adjacent to. Interfaces only reported by the Docker or
+// virt probes, as peers of veths of containers or taps of VMs, have vanished
+// from the host.
+func plumbNetIfaces(input report.Nodes) report.Nodes {
+	output := report.Nodes{}
+	for id, n := range input {
+		if _, ok := n.Latest.Lookup(host.NetIfaceName); ok && n.Topology == report.NetIface {
+			output[id] = n
+		}
+	}
+	for _, n := range output {
+		for _, adj := range n.Adjacency {
+			if peer, ok := input[adj]; ok && (peer.Topology == report.Container || peer.Topology == report.VirtualMachine) {
+				output[adj] = peer
+			}
+		}
+	}
+	for id, n := range output {
+		adjacency := report.MakeIDList()
+		for _, adj := range n.Adjacency {
+			if _, ok := output[adj]; ok {
+				adjacency = adjacency.Add(adj)
+			}
+		}
+		n.Adjacency = adjacency
+		output[id] = n
+	}
+	return output
+}
@@ -0,0 +1,59 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestNetIfaceRenderer(t *testing.T) {
+	var (
+		bridgeID  = report.MakeNetIfaceNodeID("host1", "docker0")
+		vethID    = report.MakeNetIfaceNodeID("host1", "veth1234")
+		goneID    = report.MakeNetIfaceNodeID("host1", "veth5678")
+		plumbedID = report.MakeContainerNodeID("plumbed")
+		hostNetID = report.MakeContainerNodeID("hostnet")
+		tapID     = report.MakeNetIfaceNodeID("host1", "vnet0")
+		vmID      = report.MakeVirtualMachineNodeID("host1", "web1")
+	)
+	rpt := report.MakeReport()
+	rpt.NetIface = rpt.NetIface.
+		AddNode(report.MakeNodeWith(bridgeID, map[string]string{host.NetIfaceName: "docker0"}).
+			WithTopology(report.NetIface)).
+		AddNode(report.MakeNodeWith(vethID, map[string]string{host.NetIfaceName: "veth1234"}).
+			WithTopology(report.NetIface).
+			WithAdjacent(bridgeID).
+			WithAdjacent(plumbedID)).
+		// Only reported as the peer of a container's veth
+		AddNode(report.MakeNode(goneID).WithTopology(report.NetIface).WithAdjacent(hostNetID)).
+		AddNode(report.MakeNodeWith(tapID, map[string]string{host.NetIfaceName: "vnet0"}).
+			WithTopology(report.NetIface).
+			WithAdjacent(vmID))
+	rpt.VirtualMachine = rpt.VirtualMachine.AddNode(report.MakeNode(vmID).WithTopology(report.VirtualMachine))
+	for _, id := range []string{plumbedID, hostNetID} {
+		rpt.Container = rpt.Container.AddNode(report.MakeNodeWith(id, map[string]string{
+			docker.ContainerState: docker.StateRunning,
+		}).WithTopology(report.Container))
+	}
+
+	have := render.NetIfaceRenderer.Render(rpt, FilterNoop)
+	for _, id := range []string{bridgeID, vethID, plumbedID, tapID, vmID} {
+		if _, ok := have[id]; !ok {
+			t.Errorf("Expected %q to be rendered", id)
+		}
+	}
+	for _, id := range []string{goneID, hostNetID} {
+		if _, ok := have[id]; ok {
+			t.Errorf("Expected %q not to be rendered", id)
+		}
+	}
+	if adjacency := have[vethID].Adjacency; !adjacency.Contains(bridgeID) || !adjacency.Contains(plumbedID) {
+		t.Errorf("Expected veth1234 to be adjacent to docker0 and its container, got %v", adjacency)
+	}
+	if adjacency := have[tapID].Adjacency; !adjacency.Contains(vmID) {
+		t.Errorf("Expected vnet0 to be adjacent to its VM, got %v", adjacency)
+	}
+}
@@ -0,0 +1,156 @@
+package render
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+// PodNetworkPolicyRenderer is a Renderer which produces the pods graph, with
+// the edges between pods annotated with whether the NetworkPolicies in the
+// report allow them.
+var PodNetworkPolicyRenderer = MakeNetworkPolicyAnnotator(PodRenderer)
+
+// MakeNetworkPolicyAnnotator makes a Renderer which annotates the edges
+// between the pods rendered by r with their NetworkPolicy status.
+func MakeNetworkPolicyAnnotator(r Renderer) Renderer {
+	return networkPolicyRenderer{r}
+}
+
+type networkPolicyRenderer struct {
+	Renderer
+}
+
+type policyPeer struct {
+	selector     labels.Selector
+	anyNamespace bool
+}
+
+type policyRule struct {
+	from []policyPeer
+}
+
+type networkPolicy struct {
+	namespace   string
+	podSelector labels.Selector
+	ingress     []policyRule
+}
+
+func parseNetworkPolicy(n report.Node) (networkPolicy, error) {
+	var (
+		policy          = networkPolicy{}
+		podSelector, _  = n.Latest.Lookup(kubernetes.PolicyPodSelector)
+		ingressRules, _ = n.Latest.Lookup(kubernetes.PolicyIngress)
+		err             error
+	)
+	policy.namespace, _ = n.Latest.Lookup(kubernetes.Namespace)
+	if policy.podSelector, err = labels.Parse(podSelector); err != nil {
+		return policy, err
+	}
+	rules, err := kubernetes.ParseNetworkPolicyIngress(ingressRules)
+	if err != nil {
+		return policy, err
+	}
+	for _, rule := range rules {
+		r := policyRule{}
+		for _, from := range rule.From {
+			selector, err := labels.Parse(from.PodSelector)
+			if err != nil {
+				return policy, err
+			}
+			r.from = append(r.from, policyPeer{selector: selector, anyNamespace: from.AnyNamespace})
+		}
+		policy.ingress = append(policy.ingress, r)
+	}
+	return policy, nil
+}
+
+func (p networkPolicy) selects(namespace string, podLabels labels.Set) bool {
+	return namespace == p.namespace && p.podSelector.Matches(podLabels)
+}
+
+func (p networkPolicy) allows(namespace string, podLabels labels.Set) bool {
+	for _, rule := range p.ingress {
+		if len(rule.from) == 0 {
+			return true
+		}
+		for _, peer := range rule.from {
+			if (peer.anyNamespace || namespace == p.namespace) && peer.selector.Matches(podLabels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func podLabels(n report.Node) labels.Set {
+	result := labels.Set{}
+	n.Latest.ForEach(func(key string, _ time.Time, value string) {
+		if label, ok := report.WithoutPrefix(key, kubernetes.LabelPrefix); ok {
+			result[label] = value
+		}
+	})
+	return result
+}
+
+// networkPolicyStatus tells whether traffic from src to dst is allowed.
+// Pods not selected by any policy accept all traffic.
+func networkPolicyStatus(policies []networkPolicy, src, dst report.Node) string {
+	var (
+		srcNamespace, _ = src.Latest.Lookup(kubernetes.Namespace)
+		dstNamespace, _ = dst.Latest.Lookup(kubernetes.Namespace)
+		srcLabels       = podLabels(src)
+		dstLabels       = podLabels(dst)
+		isolated        = false
+	)
+	for _, policy := range policies {
+		if !policy.selects(dstNamespace, dstLabels) {
+			continue
+		}
+		isolated = true
+		if policy.allows(srcNamespace, srcLabels) {
+			return report.NetworkPolicyAllowed
+		}
+	}
+	if isolated {
+		return report.NetworkPolicyDenied
+	}
+	return report.NetworkPolicyAllowed
+}
+
+func (r networkPolicyRenderer) Render(rpt report.Report, dct Decorator) report.Nodes {
+	nodes := r.Renderer.Render(rpt, dct)
+	if len(rpt.NetworkPolicy.Nodes) == 0 {
+		return nodes
+	}
+	policies := []networkPolicy{}
+	for id, n := range rpt.NetworkPolicy.Nodes {
+		policy, err := parseNetworkPolicy(n)
+		if err != nil {
+			log.Warnf("Ignoring invalid network policy %s: %v", id, err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	output := make(report.Nodes, len(nodes))
+	for id, n := range nodes {
+		if n.Topology == report.Pod {
+			for _, adjacent := range n.Adjacency {
+				dst, ok := nodes[adjacent]
+				if !ok || dst.Topology != report.Pod {
+					continue
+				}
+				status := networkPolicyStatus(policies, n, dst)
+				md, _ := n.Edges.Lookup(adjacent)
+				n.Edges = n.Edges.Add(adjacent, report.EdgeMetadata{NetworkPolicy: status, Attempted: md.Attempted})
+			}
+		}
+		output[id] = n
+	}
+	return output
+}
@@ -0,0 +1,43 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func policyPod(id string, role string) report.Node {
+	return report.MakeNodeWith(id, map[string]string{
+		kubernetes.Namespace:            "ping",
+		kubernetes.LabelPrefix + "role": role,
+	}).WithTopology(report.Pod)
+}
+
+func TestNetworkPolicyAnnotator(t *testing.T) {
+	rpt := report.MakeReport()
+	// Only pods with role=frontend may talk to the backend
+	rpt.NetworkPolicy = rpt.NetworkPolicy.AddNode(report.MakeNodeWith(report.MakeNetworkPolicyNodeID("policy"), map[string]string{
+		kubernetes.Namespace:         "ping",
+		kubernetes.PolicyPodSelector: "role=backend",
+		kubernetes.PolicyIngress:     `[{"from":[{"podSelector":"role=frontend"}]}]`,
+	}))
+	renderer := render.MakeNetworkPolicyAnnotator(mockRenderer{Nodes: report.Nodes{
+		"frontend": policyPod("frontend", "frontend").WithAdjacent("backend"),
+		"batch":    policyPod("batch", "batch").WithAdjacent("backend").WithAdjacent("frontend"),
+		"backend":  policyPod("backend", "backend"),
+	}})
+	have := renderer.Render(rpt, FilterNoop)
+
+	for _, c := range []struct{ from, to, want string }{
+		{"frontend", "backend", report.NetworkPolicyAllowed},
+		{"batch", "backend", report.NetworkPolicyDenied},
+		{"batch", "frontend", report.NetworkPolicyAllowed},
+	} {
+		md, ok := have[c.from].Edges.Lookup(c.to)
+		if !ok || md.NetworkPolicy != c.want {
+			t.Errorf("%s -> %s: want %q, have %q", c.from, c.to, c.want, md.NetworkPolicy)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// NomadAllocationRenderer is a Renderer for HashiCorp Nomad allocations.
+var NomadAllocationRenderer = ConditionalRenderer(renderNomadTopologies,
+	renderParents(
+		report.Container, []string{report.NomadAllocation}, UnmanagedID,
+		MakeFilter(
+			IsRunning,
+			ContainerWithImageNameRenderer,
+		),
+	),
+)
+
+// NomadTaskGroupRenderer is a Renderer for Nomad task groups.
+var NomadTaskGroupRenderer = ConditionalRenderer(renderNomadTopologies,
+	renderParents(
+		report.NomadAllocation, []string{report.NomadTaskGroup}, "",
+		NomadAllocationRenderer,
+	),
+)
+
+// NomadJobRenderer is a Renderer for Nomad jobs.
+var NomadJobRenderer = ConditionalRenderer(renderNomadTopologies,
+	renderParents(
+		report.NomadTaskGroup, []string{report.NomadJob}, "",
+		NomadTaskGroupRenderer,
+	),
+)
+
+func renderNomadTopologies(rpt report.Report) bool {
+	return len(rpt.NomadJob.Nodes)+len(rpt.NomadTaskGroup.Nodes)+len(rpt.NomadAllocation.Nodes) >= 1
+}
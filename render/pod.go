@@ -26,6 +26,7 @@ func renderKubernetesTopologies(rpt report.Report) bool {
 		&rpt.DaemonSet,
 		&rpt.StatefulSet,
 		&rpt.CronJob,
+		&rpt.CustomResource,
 	}
 	for _, t := range topologies {
 		if len(t.Nodes) > 0 {
@@ -87,6 +88,19 @@ var KubeControllerRenderer = ConditionalRenderer(renderKubernetesTopologies,
 	),
 )
 
+// CustomResourceRenderer is a Renderer which produces a renderable graph of
+// the custom resources owning pods. Pods not owned by any are dropped.
+var CustomResourceRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	renderParents(
+		report.Pod, []string{report.CustomResource}, "",
+		PodRenderer,
+	),
+)
+
+// PodNamespaceRenderer is a Renderer which groups pods by their Kubernetes
+// namespace.
+var PodNamespaceRenderer = MakeGroupRenderer([]string{kubernetes.Namespace}, "", PodRenderer)
+
 // renderParents produces a 'standard' renderer for mapping from some child topology to some parent topologies,
 // by taking a child renderer, mapping to parents, propagating single metrics, and joining with full parent topology.
 // Other options are as per Map2Parent.
@@ -150,7 +164,8 @@ func MapPod2IP(m report.Node) []string {
 	if !ok {
 		return nil
 	}
-	return []string{report.MakeScopedEndpointNodeID("", ip, "")}
+	clusterID, _ := m.Latest.Lookup(report.ClusterID)
+	return []string{report.MakeScopedEndpointNodeID(report.ClusterAddressScope(clusterID, ip), ip, "")}
 }
 
 // Map2Parent returns a MapFunc which maps Nodes to some parent grouping.
@@ -7,6 +7,7 @@ import (
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/expected"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 	"github.com/weaveworks/scope/test/reflect"
 	"github.com/weaveworks/scope/test/utils"
@@ -68,3 +69,17 @@ func TestPodServiceFilterRenderer(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestMapPod2IPClusterScope(t *testing.T) {
+	// Pods of different clusters with the same IP are joined to different
+	// endpoints
+	var ids []string
+	for _, clusterID := range []string{"cluster-a", "cluster-b"} {
+		pod := report.MakeNodeWith("pod", map[string]string{kubernetes.IP: "10.32.0.7", report.ClusterID: clusterID})
+		ids = append(ids, render.MapPod2IP(pod)...)
+	}
+	want := []string{"cluster-a;10.32.0.7;", "cluster-b;10.32.0.7;"}
+	if !reflect.DeepEqual(want, ids) {
+		t.Error(test.Diff(want, ids))
+	}
+}
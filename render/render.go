@@ -54,7 +54,10 @@ func (r *Reduce) Render(rpt report.Report, dct Decorator) report.Nodes {
 	for ; l > 1; l-- {
 		left, right := <-c, <-c
 		go func() {
-			c <- left.Merge(right)
+			begin := stageStart()
+			merged := left.Merge(right)
+			observeStage(rpt, "reduce", nil, begin, len(merged))
+			c <- merged
 		}()
 	}
 	return <-c
@@ -86,9 +89,11 @@ func MakeMap(f MapFunc, r Renderer) Renderer {
 func (m *Map) Render(rpt report.Report, dct Decorator) report.Nodes {
 	var (
 		input         = m.Renderer.Render(rpt, dct)
+		begin         = stageStart()
 		output        = report.Nodes{}
-		mapped        = map[string]report.IDList{} // input node ID -> output node IDs
-		adjacencies   = map[string]report.IDList{} // output node ID -> input node Adjacencies
+		mapped        = map[string]report.IDList{}          // input node ID -> output node IDs
+		adjacencies   = map[string]report.IDList{}          // output node ID -> input node Adjacencies
+		edges         = map[string][]report.EdgeMetadatas{} // output node ID -> input node Edges
 		localNetworks = LocalNetworks(rpt)
 	)
 
@@ -102,10 +107,14 @@ func (m *Map) Render(rpt report.Report, dct Decorator) report.Nodes {
 			output[outRenderable.ID] = outRenderable
 			mapped[inRenderable.ID] = mapped[inRenderable.ID].Add(outRenderable.ID)
 			adjacencies[outRenderable.ID] = adjacencies[outRenderable.ID].Merge(inRenderable.Adjacency)
+			if inRenderable.Edges.Size() > 0 {
+				edges[outRenderable.ID] = append(edges[outRenderable.ID], inRenderable.Edges)
+			}
 		}
 	}
 
 	// Rewrite Adjacency for new node IDs.
+	attempted := false
 	for outNodeID, inAdjacency := range adjacencies {
 		outAdjacency := report.MakeIDList()
 		for _, inAdjacent := range inAdjacency {
@@ -113,12 +122,67 @@ func (m *Map) Render(rpt report.Report, dct Decorator) report.Nodes {
 		}
 		outNode := output[outNodeID]
 		outNode.Adjacency = outAdjacency
+		outNode.Edges = mapEdges(edges[outNodeID], mapped)
 		output[outNodeID] = outNode
+		attempted = attempted || hasAttemptedEdges(outNode.Edges)
+	}
+	if attempted {
+		answerEdges(input, mapped, output)
 	}
 
+	observeStage(rpt, "map", m.MapFunc, begin, len(output))
 	return output
 }
 
+// mapEdges rewrites the keys of the given edge metadatas to the output
+// node IDs, so that e.g. the transport of endpoint edges survives rendering.
+// The traffic stats are kept too, for the edges between e.g. containers to
+// aggregate those of their connections; only NodeSummaries drop them.
+func mapEdges(inEdges []report.EdgeMetadatas, mapped map[string]report.IDList) report.EdgeMetadatas {
+	outEdges := report.MakeEdgeMetadatas()
+	for _, in := range inEdges {
+		in.ForEach(func(inAdjacent string, md report.EdgeMetadata) {
+			if md == (report.EdgeMetadata{}) {
+				return
+			}
+			for _, outAdjacent := range mapped[inAdjacent] {
+				outEdges = outEdges.Add(outAdjacent, md)
+			}
+		})
+	}
+	return outEdges
+}
+
+func hasAttemptedEdges(edges report.EdgeMetadatas) bool {
+	attempted := false
+	edges.ForEach(func(_ string, md report.EdgeMetadata) {
+		attempted = attempted || md.Attempted
+	})
+	return attempted
+}
+
+// answerEdges answers the attempted edges of the output nodes which any of
+// the input nodes they are mapped from answered, by being adjacent without
+// having attempted the edge: the connections between two processes are only
+// attempted if none of those between their endpoints were answered.
+func answerEdges(input report.Nodes, mapped map[string]report.IDList, output report.Nodes) {
+	for inNodeID, outNodeIDs := range mapped {
+		inNode := input[inNodeID]
+		for _, inAdjacent := range inNode.Adjacency {
+			if md, _ := inNode.Edges.Lookup(inAdjacent); md.Attempted {
+				continue
+			}
+			for _, outNodeID := range outNodeIDs {
+				outNode := output[outNodeID]
+				for _, outAdjacent := range mapped[inAdjacent] {
+					outNode.Edges = outNode.Edges.Answered(outAdjacent)
+				}
+				output[outNodeID] = outNode
+			}
+		}
+	}
+}
+
 // Stats implements Renderer
 func (m *Map) Stats(_ report.Report, _ Decorator) Stats {
 	// There doesn't seem to be an instance where we want stats to recurse
@@ -98,4 +98,80 @@ func TestMapRender3(t *testing.T) {
 	}
 }
 
+func TestMapRenderEdges(t *testing.T) {
+	// 4. Check edge metadata follows the remapped adjacencies
+	udp := report.EdgeMetadata{Transport: "udp"}
+	mapper := render.Map{
+		MapFunc: func(nodes report.Node, _ report.Networks) report.Nodes {
+			id := "_" + nodes.ID
+			return report.Nodes{id: report.MakeNode(id)}
+		},
+		Renderer: mockRenderer{Nodes: report.Nodes{
+			"foo": report.MakeNode("foo").WithEdge("baz", udp),
+			"baz": report.MakeNode("baz").WithEdge("foo", report.EdgeMetadata{}),
+		}},
+	}
+	want := report.Nodes{
+		"_foo": report.MakeNode("_foo").WithEdge("_baz", udp),
+		"_baz": report.MakeNode("_baz").WithAdjacent("_foo"),
+	}
+	have := mapper.Render(report.MakeReport(), FilterNoop)
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestMapRenderEdgeStats(t *testing.T) {
+	// Edges between the endpoints of two containers become one edge, with
+	// the RTT of the slowest connection and the bytes of all of them
+	mapper := render.Map{
+		MapFunc: func(n report.Node, _ report.Networks) report.Nodes {
+			id := n.ID[:1]
+			return report.Nodes{id: report.MakeNode(id)}
+		},
+		Renderer: mockRenderer{Nodes: report.Nodes{
+			"a1": report.MakeNode("a1").WithEdge("b1", report.EdgeMetadata{RTTMicros: newu64(300), Retransmits: newu64(1), EgressByteCount: newu64(1000)}),
+			"a2": report.MakeNode("a2").WithEdge("b2", report.EdgeMetadata{RTTMicros: newu64(900), Retransmits: newu64(4), EgressByteCount: newu64(500)}),
+			"b1": report.MakeNode("b1"),
+			"b2": report.MakeNode("b2"),
+		}},
+	}
+	want := report.Nodes{
+		"a": report.MakeNode("a").WithEdge("b", report.EdgeMetadata{RTTMicros: newu64(900), Retransmits: newu64(5), EgressByteCount: newu64(1500)}),
+		"b": report.MakeNode("b"),
+	}
+	have := mapper.Render(report.MakeReport(), FilterNoop)
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
 func newu64(value uint64) *uint64 { return &value }
+
+func TestMapRenderAttemptedEdges(t *testing.T) {
+	// Edges are only attempted if none of the connections between the
+	// endpoints they are mapped from were answered
+	attempted := report.EdgeMetadata{Attempted: true}
+	mapper := render.Map{
+		MapFunc: func(n report.Node, _ report.Networks) report.Nodes {
+			id := n.ID[:1]
+			return report.Nodes{id: report.MakeNode(id)}
+		},
+		Renderer: mockRenderer{Nodes: report.Nodes{
+			"a1": report.MakeNode("a1").WithEdge("b1", attempted).WithEdge("c1", attempted),
+			"a2": report.MakeNode("a2").WithEdge("b2", attempted),
+			"a3": report.MakeNode("a3").WithAdjacent("c2"),
+			"b1": report.MakeNode("b1"),
+			"b2": report.MakeNode("b2"),
+			"c1": report.MakeNode("c1"),
+			"c2": report.MakeNode("c2"),
+		}},
+	}
+	have := mapper.Render(report.MakeReport(), FilterNoop)
+	if md, _ := have["a"].Edges.Lookup("b"); !md.Attempted {
+		t.Errorf("Expected the edge to b to be attempted, got %v", md)
+	}
+	if md, _ := have["a"].Edges.Lookup("c"); md.Attempted {
+		t.Errorf("Expected the edge to c to be answered, got %v", md)
+	}
+}
@@ -22,19 +22,29 @@ func (t TopologySelector) Stats(r report.Report, _ Decorator) Stats {
 // The topology selectors implement a Renderer which fetch the nodes from the
 // various report topologies.
 var (
-	SelectEndpoint       = TopologySelector(report.Endpoint)
-	SelectProcess        = TopologySelector(report.Process)
-	SelectContainer      = TopologySelector(report.Container)
-	SelectContainerImage = TopologySelector(report.ContainerImage)
-	SelectHost           = TopologySelector(report.Host)
-	SelectPod            = TopologySelector(report.Pod)
-	SelectService        = TopologySelector(report.Service)
-	SelectDeployment     = TopologySelector(report.Deployment)
-	SelectDaemonSet      = TopologySelector(report.DaemonSet)
-	SelectStatefulSet    = TopologySelector(report.StatefulSet)
-	SelectCronJob        = TopologySelector(report.CronJob)
-	SelectECSTask        = TopologySelector(report.ECSTask)
-	SelectECSService     = TopologySelector(report.ECSService)
-	SelectSwarmService   = TopologySelector(report.SwarmService)
-	SelectOverlay        = TopologySelector(report.Overlay)
+	SelectEndpoint        = TopologySelector(report.Endpoint)
+	SelectProcess         = TopologySelector(report.Process)
+	SelectContainer       = TopologySelector(report.Container)
+	SelectContainerImage  = TopologySelector(report.ContainerImage)
+	SelectHost            = TopologySelector(report.Host)
+	SelectPod             = TopologySelector(report.Pod)
+	SelectService         = TopologySelector(report.Service)
+	SelectDeployment      = TopologySelector(report.Deployment)
+	SelectDaemonSet       = TopologySelector(report.DaemonSet)
+	SelectStatefulSet     = TopologySelector(report.StatefulSet)
+	SelectCronJob         = TopologySelector(report.CronJob)
+	SelectCustomResource  = TopologySelector(report.CustomResource)
+	SelectECSTask         = TopologySelector(report.ECSTask)
+	SelectECSService      = TopologySelector(report.ECSService)
+	SelectECSStack        = TopologySelector(report.ECSStack)
+	SelectSwarmService    = TopologySelector(report.SwarmService)
+	SelectSwarmStack      = TopologySelector(report.SwarmStack)
+	SelectNomadJob        = TopologySelector(report.NomadJob)
+	SelectNomadTaskGroup  = TopologySelector(report.NomadTaskGroup)
+	SelectNomadAllocation = TopologySelector(report.NomadAllocation)
+	SelectNetIface        = TopologySelector(report.NetIface)
+	SelectScopeComponent  = TopologySelector(report.ScopeComponent)
+	SelectSystemdUnit     = TopologySelector(report.SystemdUnit)
+	SelectVirtualMachine  = TopologySelector(report.VirtualMachine)
+	SelectOverlay         = TopologySelector(report.Overlay)
 )
@@ -15,6 +15,14 @@ var SwarmServiceRenderer = ConditionalRenderer(renderSwarmTopologies,
 	),
 )
 
+// SwarmStackRenderer is a Renderer for Docker stacks
+var SwarmStackRenderer = ConditionalRenderer(renderSwarmTopologies,
+	renderParents(
+		report.SwarmService, []string{report.SwarmStack}, "",
+		SwarmServiceRenderer,
+	),
+)
+
 func renderSwarmTopologies(rpt report.Report) bool {
-	return len(rpt.SwarmService.Nodes) >= 1
+	return len(rpt.SwarmService.Nodes)+len(rpt.SwarmStack.Nodes) >= 1
 }
@@ -0,0 +1,26 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/report"
+)
+
+// SystemdUnitRenderer is a Renderer for the systemd services of hosts, with
+// the processes they run.
+var SystemdUnitRenderer = ConditionalRenderer(renderSystemdUnits,
+	renderParents(
+		report.Process, []string{report.SystemdUnit}, "",
+		ColorConnectedProcessRenderer,
+	),
+)
+
+func renderSystemdUnits(rpt report.Report) bool {
+	return len(rpt.SystemdUnit.Nodes) >= 1
+}
+
+// IsActiveUnit checks if the node is a systemd unit which is not inactive,
+// including units which failed.
+func IsActiveUnit(n report.Node) bool {
+	state, ok := n.Latest.Lookup(systemd.ActiveState)
+	return !ok || state != "inactive"
+}
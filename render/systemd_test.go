@@ -0,0 +1,39 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSystemdUnitRenderer(t *testing.T) {
+	var (
+		sshdID   = report.MakeSystemdUnitNodeID("host1", "sshd.service")
+		backupID = report.MakeSystemdUnitNodeID("host1", "backup.service")
+	)
+	rpt := report.MakeReport()
+	rpt.SystemdUnit = rpt.SystemdUnit.
+		AddNode(report.MakeNodeWith(sshdID, map[string]string{systemd.ActiveState: "active"}).WithTopology(report.SystemdUnit)).
+		AddNode(report.MakeNodeWith(backupID, map[string]string{systemd.ActiveState: "inactive"}).WithTopology(report.SystemdUnit))
+	for _, pid := range []string{"812", "813", "900"} {
+		n := report.MakeNodeWith(report.MakeProcessNodeID("host1", pid), map[string]string{process.PID: pid}).WithTopology(report.Process)
+		if pid != "900" {
+			n = n.WithParents(report.MakeSets().Add(report.SystemdUnit, report.MakeStringSet(sshdID)))
+		}
+		rpt.Process = rpt.Process.AddNode(n)
+	}
+
+	have := render.SystemdUnitRenderer.Render(rpt, FilterNoop)
+	if len(have) != 2 {
+		t.Fatalf("Expected the 2 units, got %d nodes", len(have))
+	}
+	if count, _ := have[sshdID].Counters.Lookup(report.Process); count != 2 {
+		t.Errorf("Expected sshd to run 2 processes, got %d", count)
+	}
+	if render.IsActiveUnit(have[backupID]) || !render.IsActiveUnit(have[sshdID]) {
+		t.Errorf("Expected only sshd to be active")
+	}
+}
@@ -10,6 +10,19 @@ import (
 	"github.com/weaveworks/scope/report"
 )
 
+// Keys of where external addresses are, on their endpoints, which the app
+// looks up in a GeoIP/ASN database.
+const (
+	GeoIPCountry      = "geoip_country"
+	GeoIPASN          = "geoip_asn"
+	GeoIPOrganisation = "geoip_organisation"
+)
+
+// KnownService is the key of the service external addresses are of, like
+// "AWS S3 us-east-1", on their endpoints, which the app classifies them as
+// by the published ranges of cloud providers and well-known services.
+const KnownService = "known_service"
+
 var (
 	// ServiceNodeIDPrefix is how the ID of all service pseudo nodes begin
 	ServiceNodeIDPrefix = "service-"
@@ -79,3 +92,20 @@ func LocalNetworks(r report.Report) report.Networks {
 	}
 	return networks
 }
+
+// GeoIPLocation describes where the address of an endpoint is, like
+// "AS15169 Google LLC, US", or is empty if that isn't known.
+func GeoIPLocation(n report.Node) string {
+	var parts []string
+	network, _ := n.Latest.Lookup(GeoIPOrganisation)
+	if asn, ok := n.Latest.Lookup(GeoIPASN); ok && asn != "" {
+		network = strings.TrimSpace("AS" + asn + " " + network)
+	}
+	if network != "" {
+		parts = append(parts, network)
+	}
+	if country, ok := n.Latest.Lookup(GeoIPCountry); ok && country != "" {
+		parts = append(parts, country)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -40,3 +40,36 @@ func TestReportLocalNetworks(t *testing.T) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 }
+
+func TestKnownServiceExternalNodes(t *testing.T) {
+	local := report.MakeNetworks()
+	if err := local.AddCIDR("10.0.0.0/8"); err != nil {
+		panic(err)
+	}
+	s3 := report.MakeNode("s3").WithLatests(map[string]string{render.KnownService: "AWS S3 us-east-1"})
+	for addr, want := range map[string]string{
+		"52.216.1.2": render.ServiceNodeIDPrefix + "AWS S3 us-east-1",
+		"10.0.0.1":   "", // local addresses are never of services
+	} {
+		have, ok := render.NewDerivedExternalNode(s3, addr, local)
+		if want == "" && ok || want != "" && have.ID != want {
+			t.Errorf("%s: expected %q, got %q", addr, want, have.ID)
+		}
+	}
+	if have, _ := render.NewDerivedExternalNode(report.MakeNode("other"), "52.216.1.2", local); have.ID != render.OutgoingInternetID {
+		t.Errorf("Expected an Internet node of unclassified addresses, got %q", have.ID)
+	}
+}
+
+func TestGeoIPLocation(t *testing.T) {
+	for want, latests := range map[string]map[string]string{
+		"AS15169 Google LLC, US": {render.GeoIPASN: "15169", render.GeoIPOrganisation: "Google LLC", render.GeoIPCountry: "US"},
+		"AS15169":                {render.GeoIPASN: "15169"},
+		"GB":                     {render.GeoIPCountry: "GB"},
+		"":                       {},
+	} {
+		if have := render.GeoIPLocation(report.MakeNodeWith("n", latests)); have != want {
+			t.Errorf("Expected %q, got %q", want, have)
+		}
+	}
+}
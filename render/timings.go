@@ -0,0 +1,154 @@
+package render
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// StageObserver is told how long each stage of each render took, by its
+// name, like map:render.MapEndpoint2Process, and how many nodes it output.
+// Stages are timed by themselves, excluding the renderers they read from.
+type StageObserver func(stage string, d time.Duration, nodes int)
+
+// StageTiming is how long a stage took, over its calls in a render.
+type StageTiming struct {
+	Stage    string        `json:"stage"`
+	Calls    int           `json:"calls"`
+	Duration time.Duration `json:"duration"`
+	Nodes    int           `json:"nodes"`
+}
+
+var (
+	// timing is non-zero while anything observes stages, so that renders
+	// don't even read the clock otherwise.
+	timing int32
+
+	observerMtx   sync.RWMutex
+	stageObserver StageObserver
+
+	tracesMtx sync.Mutex
+	traces    = map[string]map[string]*StageTiming{} // by report ID, by stage
+	traceID   int64
+
+	stageNames sync.Map // function pointer -> name
+)
+
+// SetStageObserver sets the observer of the stages of all renders, or
+// unsets it if nil.
+func SetStageObserver(o StageObserver) {
+	observerMtx.Lock()
+	defer observerMtx.Unlock()
+	if o != nil && stageObserver == nil {
+		atomic.AddInt32(&timing, 1)
+	} else if o == nil && stageObserver != nil {
+		atomic.AddInt32(&timing, -1)
+	}
+	stageObserver = o
+}
+
+// stageName names a stage after the function of it, like a MapFunc.
+func stageName(kind string, f interface{}) string {
+	pc := reflect.ValueOf(f).Pointer()
+	if name, ok := stageNames.Load(pc); ok {
+		return kind + ":" + name.(string)
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+		// github.com/weaveworks/scope/render.MapEndpoint2Process is
+		// render.MapEndpoint2Process
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+	stageNames.Store(pc, name)
+	return kind + ":" + name
+}
+
+// stageStart is when a stage began, or zero when nothing observes stages.
+func stageStart() time.Time {
+	if atomic.LoadInt32(&timing) == 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observeStage records how long a stage of rendering a report took, since
+// begin, unless begin is zero. Stages are named after their kind, and their
+// function if any.
+func observeStage(rpt report.Report, kind string, f interface{}, begin time.Time, nodes int) {
+	if begin.IsZero() {
+		return
+	}
+	d := time.Since(begin)
+	stage := kind
+	if f != nil {
+		stage = stageName(kind, f)
+	}
+	observerMtx.RLock()
+	if stageObserver != nil {
+		stageObserver(stage, d, nodes)
+	}
+	observerMtx.RUnlock()
+	tracesMtx.Lock()
+	defer tracesMtx.Unlock()
+	trace, ok := traces[rpt.ID]
+	if !ok {
+		return
+	}
+	timing, ok := trace[stage]
+	if !ok {
+		timing = &StageTiming{Stage: stage}
+		trace[stage] = timing
+	}
+	timing.Calls++
+	timing.Duration += d
+	timing.Nodes += nodes
+}
+
+func identityDecorator(r Renderer) Renderer { return r }
+
+// TimeStages renders a report, timing each of the stages of the renderer,
+// slowest first, and the whole render. The report is rendered afresh, as
+// memoised renders would hide the stages, under an ID of its own, so that
+// other renders of it at the same time are not counted.
+func TimeStages(rpt report.Report, renderer Renderer, dct Decorator) (report.Nodes, []StageTiming, time.Duration) {
+	// Memoisers pass renders with decorators through
+	if dct == nil {
+		dct = identityDecorator
+	}
+	tracesMtx.Lock()
+	traceID++
+	rpt.ID = fmt.Sprintf("render-stats-%d-%s", traceID, rpt.ID)
+	traces[rpt.ID] = map[string]*StageTiming{}
+	tracesMtx.Unlock()
+	atomic.AddInt32(&timing, 1)
+
+	begin := time.Now()
+	nodes := renderer.Render(rpt, dct)
+	total := time.Since(begin)
+
+	atomic.AddInt32(&timing, -1)
+	tracesMtx.Lock()
+	trace := traces[rpt.ID]
+	delete(traces, rpt.ID)
+	tracesMtx.Unlock()
+
+	result := make([]StageTiming, 0, len(trace))
+	for _, t := range trace {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Duration != result[j].Duration {
+			return result[i].Duration > result[j].Duration
+		}
+		return result[i].Stage < result[j].Stage
+	})
+	return nodes, result, total
+}
@@ -0,0 +1,62 @@
+package render_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test/fixture"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestTimeStages(t *testing.T) {
+	want := render.ProcessRenderer.Render(fixture.Report, nil)
+	have, stages, total := render.TimeStages(fixture.Report, render.ProcessRenderer, nil)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected the same nodes as an untimed render")
+	}
+	if total <= 0 {
+		t.Errorf("Expected a total duration, got %v", total)
+	}
+
+	byStage := map[string]render.StageTiming{}
+	for i, stage := range stages {
+		byStage[stage.Stage] = stage
+		if i > 0 && stage.Duration > stages[i-1].Duration {
+			t.Errorf("Expected stages slowest first, got %v", stages)
+		}
+	}
+	if stage, ok := byStage["map:render.MapEndpoint2Process"]; !ok || stage.Calls == 0 {
+		t.Errorf("Expected the endpoint to process map to be timed, got %v", stages)
+	}
+	for _, stage := range stages {
+		if !strings.HasPrefix(stage.Stage, "map:") && !strings.HasPrefix(stage.Stage, "filter:") && stage.Stage != "reduce" {
+			t.Errorf("Unexpected stage %q", stage.Stage)
+		}
+	}
+}
+
+func TestStageObserver(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		stages = map[string]int{}
+	)
+	render.SetStageObserver(func(stage string, _ time.Duration, _ int) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		stages[stage]++
+	})
+	render.TimeStages(fixture.Report, render.ProcessRenderer, nil)
+	render.SetStageObserver(nil)
+	if stages["map:render.MapEndpoint2Process"] == 0 {
+		t.Errorf("Expected the observer to be told of stages, got %v", stages)
+	}
+
+	observed := stages["map:render.MapEndpoint2Process"]
+	render.TimeStages(fixture.Report, render.ProcessRenderer, nil)
+	if stages["map:render.MapEndpoint2Process"] != observed {
+		t.Errorf("Expected no stages to be observed once unset")
+	}
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/probe/virt"
+	"github.com/weaveworks/scope/report"
+)
+
+// VirtualMachineRenderer is a Renderer for the virtual machines of hosts,
+// joined with the connections to the addresses of their interfaces. The
+// running containers of hosts are rendered with them, so the connections
+// between VMs and containers show as edges.
+var VirtualMachineRenderer = ConditionalRenderer(renderVirtualMachines,
+	ConnectionJoin(MapVirtualMachine2IP, MakeReduce(
+		SelectVirtualMachine,
+		MakeFilter(IsRunning, SelectContainer),
+	)),
+)
+
+func renderVirtualMachines(rpt report.Report) bool {
+	return len(rpt.VirtualMachine.Nodes) >= 1
+}
+
+// MapVirtualMachine2IP maps virtual machine nodes to their IP addresses, and
+// container nodes to theirs, so both can be joined with the endpoint
+// topology.
+func MapVirtualMachine2IP(m report.Node) []string {
+	if m.Topology == report.Container {
+		return MapContainer2IP(m)
+	}
+	result := []string{}
+	addrs, _ := m.Sets.Lookup(virt.IPsWithScopes)
+	for _, addr := range addrs {
+		scope, addr, ok := report.ParseAddressNodeID(addr)
+		if !ok || report.IsLoopback(addr) {
+			continue
+		}
+		result = append(result, report.MakeScopedEndpointNodeID(scope, addr, ""))
+	}
+	return result
+}
+
+// IsVirtualMachine checks if the node is a virtual machine, and not a
+// container rendered with them.
+func IsVirtualMachine(n report.Node) bool {
+	return n.Topology == report.VirtualMachine
+}
+
+// IsRunningVirtualMachine checks if the node is not a virtual machine which
+// is shut off.
+func IsRunningVirtualMachine(n report.Node) bool {
+	state, ok := n.Latest.Lookup(virt.State)
+	return !ok || state != "shut off"
+}
+
+// IsStoppedVirtualMachine checks if the node is a virtual machine which is
+// shut off.
+var IsStoppedVirtualMachine = Complement(IsRunningVirtualMachine)
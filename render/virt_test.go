@@ -0,0 +1,49 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/virt"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestVirtualMachineRenderer(t *testing.T) {
+	var (
+		webID         = report.MakeVirtualMachineNodeID("host1", "web1")
+		buildID       = report.MakeVirtualMachineNodeID("host1", "build")
+		containerID   = report.MakeContainerNodeID("abcdef")
+		webEndpoint   = report.MakeEndpointNodeID("host1", "", "192.168.122.45", "43210")
+		redisEndpoint = report.MakeEndpointNodeID("host1", "", "172.17.0.2", "6379")
+	)
+	rpt := report.MakeReport()
+	rpt.Endpoint = rpt.Endpoint.
+		AddNode(report.MakeNodeWith(webEndpoint, map[string]string{report.HostNodeID: report.MakeHostNodeID("host1")}).WithTopology(report.Endpoint).WithAdjacent(redisEndpoint)).
+		AddNode(report.MakeNodeWith(redisEndpoint, map[string]string{report.HostNodeID: report.MakeHostNodeID("host1")}).WithTopology(report.Endpoint))
+	rpt.VirtualMachine = rpt.VirtualMachine.
+		AddNode(report.MakeNodeWith(webID, map[string]string{virt.State: "running"}).WithTopology(report.VirtualMachine).
+			WithSet(virt.IPsWithScopes, report.MakeStringSet(report.MakeAddressNodeID("host1", "192.168.122.45")))).
+		AddNode(report.MakeNodeWith(buildID, map[string]string{virt.State: "shut off"}).WithTopology(report.VirtualMachine))
+	rpt.Container = rpt.Container.AddNode(report.MakeNodeWith(containerID, map[string]string{docker.ContainerState: docker.StateRunning}).WithTopology(report.Container).
+		WithSet(docker.ContainerIPsWithScopes, report.MakeStringSet(report.MakeAddressNodeID("host1", "172.17.0.2"))))
+	rpt.Host = rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID("host1")).WithTopology(report.Host).
+		WithSet(host.LocalNetworks, report.MakeStringSet("192.168.122.0/24", "172.17.0.0/16")))
+
+	have := render.VirtualMachineRenderer.Render(rpt, FilterNoop)
+	for _, id := range []string{webID, buildID, containerID} {
+		if _, ok := have[id]; !ok {
+			t.Errorf("Expected %s to be rendered, got %v", id, have)
+		}
+	}
+	if !have[webID].Adjacency.Contains(containerID) {
+		t.Errorf("Expected web1 to connect to the container, got %v", have[webID].Adjacency)
+	}
+	if render.IsRunningVirtualMachine(have[buildID]) || !render.IsRunningVirtualMachine(have[webID]) || !render.IsRunningVirtualMachine(have[containerID]) {
+		t.Errorf("Expected only build to be shut off")
+	}
+	if render.IsVirtualMachine(have[containerID]) {
+		t.Errorf("Expected the container not to be a VM")
+	}
+}
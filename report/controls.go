@@ -16,6 +16,9 @@ type Control struct {
 	Human string `json:"human"`
 	Icon  string `json:"icon"` // from https://fortawesome.github.io/Font-Awesome/cheatsheet/ please
 	Rank  int    `json:"rank"`
+	// DryRun is set for controls dry run (see xfer.DryRunControl) for
+	// users to confirm what they do before they are done.
+	DryRun bool `json:"dryRun,omitempty"`
 }
 
 // Merge merges other with cs, returning a fresh Controls.
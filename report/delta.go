@@ -0,0 +1,153 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+// IsDelta is whether the report is incremental, rather than full.
+func (r Report) IsDelta() bool {
+	return r.Baseline != ""
+}
+
+// Delta gives the changes from baseline to r, as an incremental report. Nodes
+// which only differ from the baseline in the timestamps of their latest
+// values and controls are left out, as the values are the same, and listed
+// in Touched with their newest timestamp.
+func (r Report) Delta(baseline Report) Report {
+	delta := r
+	delta.Baseline = baseline.ID
+	delta.Removed = map[string][]string{}
+	delta.Touched = map[string]map[string]time.Time{}
+	baselines := baseline.TopologyMap()
+	for name, t := range delta.TopologyMap() {
+		base := baselines[name]
+		nodes := Nodes{}
+		for id, n := range t.Nodes {
+			b, ok := base.Nodes[id]
+			if !ok || !unchangedNode(b, n) {
+				nodes[id] = n
+				continue
+			}
+			if newest := newestTimestamp(n); newest.After(newestTimestamp(b)) {
+				if delta.Touched[name] == nil {
+					delta.Touched[name] = map[string]time.Time{}
+				}
+				delta.Touched[name][id] = newest
+			}
+		}
+		for id := range base.Nodes {
+			if _, ok := t.Nodes[id]; !ok {
+				delta.Removed[name] = append(delta.Removed[name], id)
+			}
+		}
+		t.Nodes = nodes
+	}
+	return delta
+}
+
+// Resolve gives the full report an incremental one stands for, given its
+// baseline.
+func (r Report) Resolve(baseline Report) (Report, error) {
+	if r.Baseline != baseline.ID {
+		return Report{}, fmt.Errorf("report is a delta of %q, not of %q", r.Baseline, baseline.ID)
+	}
+	full := r
+	baselines := baseline.TopologyMap()
+	for name, t := range full.TopologyMap() {
+		nodes := baselines[name].Nodes.Copy()
+		for _, id := range r.Removed[name] {
+			delete(nodes, id)
+		}
+		for id, ts := range r.Touched[name] {
+			if n, ok := nodes[id]; ok {
+				nodes[id] = touchNode(n, ts)
+			}
+		}
+		for id, n := range t.Nodes {
+			nodes[id] = n
+		}
+		t.Nodes = nodes
+	}
+	full.Baseline, full.Removed, full.Touched = "", nil, nil
+	return full, nil
+}
+
+// newestTimestamp is the newest timestamp of the latest values and controls
+// of n.
+func newestTimestamp(n Node) time.Time {
+	newest := n.Controls.Timestamp
+	n.Latest.ForEach(func(_ string, ts time.Time, _ string) {
+		if ts.After(newest) {
+			newest = ts
+		}
+	})
+	n.LatestControls.ForEach(func(_ string, ts time.Time, _ NodeControlData) {
+		if ts.After(newest) {
+			newest = ts
+		}
+	})
+	return newest
+}
+
+// touchNode bumps the timestamps of the latest values and controls of n
+// older than ts to it.
+func touchNode(n Node, ts time.Time) Node {
+	n.Latest.ForEach(func(k string, old time.Time, v string) {
+		if old.Before(ts) {
+			n.Latest = n.Latest.Set(k, ts, v)
+		}
+	})
+	n.LatestControls.ForEach(func(k string, old time.Time, v NodeControlData) {
+		if old.Before(ts) {
+			n.LatestControls = n.LatestControls.Set(k, ts, v)
+		}
+	})
+	if n.Controls.Timestamp.Before(ts) {
+		n.Controls.Timestamp = ts
+	}
+	return n
+}
+
+// unchangedNode is whether two nodes are the same but for the timestamps of
+// their latest values and controls.
+func unchangedNode(a, b Node) bool {
+	if !sameLatest(a.Latest, b.Latest) || !sameLatestControls(a.LatestControls, b.LatestControls) ||
+		!reflect.DeepEqual(a.Controls.Controls, b.Controls.Controls) {
+		return false
+	}
+	a.Latest, a.LatestControls, a.Controls = b.Latest, b.LatestControls, b.Controls
+	return reflect.DeepEqual(a, b)
+}
+
+func sameLatest(a, b StringLatestMap) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	values := make(map[string]string, a.Size())
+	a.ForEach(func(k string, _ time.Time, v string) { values[k] = v })
+	same := true
+	b.ForEach(func(k string, _ time.Time, v string) {
+		if value, ok := values[k]; !ok || value != v {
+			same = false
+		}
+	})
+	return same
+}
+
+func sameLatestControls(a, b NodeControlDataLatestMap) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	values := make(map[string]NodeControlData, a.Size())
+	a.ForEach(func(k string, _ time.Time, v NodeControlData) { values[k] = v })
+	same := true
+	b.ForEach(func(k string, _ time.Time, v NodeControlData) {
+		if value, ok := values[k]; !ok || value != v {
+			same = false
+		}
+	})
+	return same
+}
@@ -84,13 +84,32 @@ func (c EdgeMetadatas) Merge(other EdgeMetadatas) EdgeMetadatas {
 // Flatten flattens all the EdgeMetadatas in this set and returns the result.
 // The original is not modified.
 func (c EdgeMetadatas) Flatten() EdgeMetadata {
-	result := EdgeMetadata{}
+	var (
+		result = EdgeMetadata{}
+		first  = true
+	)
 	c.ForEach(func(_ string, e EdgeMetadata) {
+		if first {
+			// Not flattened into the empty EdgeMetadata, which would
+			// answer all attempted edges
+			result, first = e.Copy(), false
+			return
+		}
 		result = result.Flatten(e)
 	})
 	return result
 }
 
+// Answered returns a fresh copy of c, with the edge to 'key' no longer
+// attempted, for one of its connections was answered.
+func (c EdgeMetadatas) Answered(key string) EdgeMetadatas {
+	if md, ok := c.Lookup(key); ok && md.Attempted {
+		md.Attempted = false
+		return EdgeMetadatas{c.psMap.Set(key, md)}
+	}
+	return c
+}
+
 // ForEach executes f on each key value pair in the map
 func (c EdgeMetadatas) ForEach(fn func(k string, v EdgeMetadata)) {
 	if c.psMap != nil {
@@ -146,9 +165,43 @@ type EdgeMetadata struct {
 	IngressPacketCount *uint64 `json:"ingress_packet_count,omitempty"`
 	EgressByteCount    *uint64 `json:"egress_byte_count,omitempty"`  // Transport layer
 	IngressByteCount   *uint64 `json:"ingress_byte_count,omitempty"` // Transport layer
+	// Transport is the layer 4 protocol of the edge. It is left empty for
+	// TCP, which is by far the most common case.
+	Transport string `json:"transport,omitempty"`
+	// NetworkPolicy records whether the Kubernetes NetworkPolicies declared
+	// for the destination allow the edge; one of NetworkPolicyAllowed or
+	// NetworkPolicyDenied, or empty when unknown.
+	NetworkPolicy string `json:"network_policy,omitempty"`
+	// RTTMicros is the smoothed round-trip time of the connections of the
+	// edge, in microseconds; of the slowest one when aggregated.
+	RTTMicros *uint64 `json:"rtt_us,omitempty"`
+	// Retransmits is the number of TCP segments retransmitted on the edge
+	// since the previous report.
+	Retransmits *uint64 `json:"retransmits,omitempty"`
+	// Protocol is the database protocol spoken on the edge, if it ends at
+	// a well-known database port, with the number of queries sent and of
+	// errors returned since the previous report.
+	Protocol        string  `json:"protocol,omitempty"`
+	QueryCount      *uint64 `json:"query_count,omitempty"`
+	QueryErrorCount *uint64 `json:"query_error_count,omitempty"`
+	// LatencyMicros is how long publishing over the edge took, in
+	// microseconds, for edges between the components of Scope itself; of
+	// the slowest one when aggregated.
+	LatencyMicros *uint64 `json:"latency_us,omitempty"`
+	// Attempted records that the connections of the edge were attempted,
+	// but never answered: their SYNs got no reply, as when a firewall or a
+	// NetworkPolicy drops them. Edges are only attempted while none of the
+	// connections they aggregate were answered.
+	Attempted bool `json:"attempted,omitempty"`
 	dummySelfer
 }
 
+// Values of EdgeMetadata.NetworkPolicy
+const (
+	NetworkPolicyAllowed = "allowed"
+	NetworkPolicyDenied  = "denied"
+)
+
 // String returns a string representation of this EdgeMetadata
 // Helps with our use of Spew and diff.
 func (e EdgeMetadata) String() string {
@@ -164,11 +217,29 @@ EgressPacketCount:  %v,
 IngressPacketCount: %v,
 EgressByteCount:    %v,
 IngressByteCount:   %v,
+Transport:          %q,
+NetworkPolicy:      %q,
+RTTMicros:          %v,
+Retransmits:        %v,
+Protocol:           %q,
+QueryCount:         %v,
+QueryErrorCount:    %v,
+LatencyMicros:      %v,
+Attempted:          %v,
 }`,
 		f(e.EgressPacketCount),
 		f(e.IngressPacketCount),
 		f(e.EgressByteCount),
-		f(e.IngressByteCount))
+		f(e.IngressByteCount),
+		e.Transport,
+		e.NetworkPolicy,
+		f(e.RTTMicros),
+		f(e.Retransmits),
+		e.Protocol,
+		f(e.QueryCount),
+		f(e.QueryErrorCount),
+		f(e.LatencyMicros),
+		e.Attempted)
 }
 
 // Copy returns a value copy of the EdgeMetadata.
@@ -178,6 +249,15 @@ func (e EdgeMetadata) Copy() EdgeMetadata {
 		IngressPacketCount: cpu64ptr(e.IngressPacketCount),
 		EgressByteCount:    cpu64ptr(e.EgressByteCount),
 		IngressByteCount:   cpu64ptr(e.IngressByteCount),
+		Transport:          e.Transport,
+		NetworkPolicy:      e.NetworkPolicy,
+		RTTMicros:          cpu64ptr(e.RTTMicros),
+		Retransmits:        cpu64ptr(e.Retransmits),
+		Protocol:           e.Protocol,
+		QueryCount:         cpu64ptr(e.QueryCount),
+		QueryErrorCount:    cpu64ptr(e.QueryErrorCount),
+		LatencyMicros:      cpu64ptr(e.LatencyMicros),
+		Attempted:          e.Attempted,
 	}
 }
 
@@ -188,6 +268,15 @@ func (e EdgeMetadata) Reversed() EdgeMetadata {
 		IngressPacketCount: cpu64ptr(e.EgressPacketCount),
 		EgressByteCount:    cpu64ptr(e.IngressByteCount),
 		IngressByteCount:   cpu64ptr(e.EgressByteCount),
+		Transport:          e.Transport,
+		NetworkPolicy:      e.NetworkPolicy,
+		RTTMicros:          cpu64ptr(e.RTTMicros),
+		Retransmits:        cpu64ptr(e.Retransmits),
+		Protocol:           e.Protocol,
+		QueryCount:         cpu64ptr(e.QueryCount),
+		QueryErrorCount:    cpu64ptr(e.QueryErrorCount),
+		LatencyMicros:      cpu64ptr(e.LatencyMicros),
+		Attempted:          e.Attempted,
 	}
 }
 
@@ -208,6 +297,15 @@ func (e EdgeMetadata) Merge(other EdgeMetadata) EdgeMetadata {
 	cp.IngressPacketCount = merge(cp.IngressPacketCount, other.IngressPacketCount, sum)
 	cp.EgressByteCount = merge(cp.EgressByteCount, other.EgressByteCount, sum)
 	cp.IngressByteCount = merge(cp.IngressByteCount, other.IngressByteCount, sum)
+	cp.Transport = mergeTransport(cp.Transport, other.Transport)
+	cp.NetworkPolicy = mergeNetworkPolicy(cp.NetworkPolicy, other.NetworkPolicy)
+	cp.RTTMicros = merge(cp.RTTMicros, other.RTTMicros, max)
+	cp.Retransmits = merge(cp.Retransmits, other.Retransmits, sum)
+	cp.Protocol = mergeTransport(cp.Protocol, other.Protocol)
+	cp.QueryCount = merge(cp.QueryCount, other.QueryCount, sum)
+	cp.QueryErrorCount = merge(cp.QueryErrorCount, other.QueryErrorCount, sum)
+	cp.LatencyMicros = merge(cp.LatencyMicros, other.LatencyMicros, max)
+	cp.Attempted = cp.Attempted && other.Attempted
 	return cp
 }
 
@@ -220,9 +318,46 @@ func (e EdgeMetadata) Flatten(other EdgeMetadata) EdgeMetadata {
 	cp.IngressPacketCount = merge(cp.IngressPacketCount, other.IngressPacketCount, sum)
 	cp.EgressByteCount = merge(cp.EgressByteCount, other.EgressByteCount, sum)
 	cp.IngressByteCount = merge(cp.IngressByteCount, other.IngressByteCount, sum)
+	cp.Transport = mergeTransport(cp.Transport, other.Transport)
+	cp.NetworkPolicy = mergeNetworkPolicy(cp.NetworkPolicy, other.NetworkPolicy)
+	cp.RTTMicros = merge(cp.RTTMicros, other.RTTMicros, max)
+	cp.Retransmits = merge(cp.Retransmits, other.Retransmits, sum)
+	cp.Protocol = mergeTransport(cp.Protocol, other.Protocol)
+	cp.QueryCount = merge(cp.QueryCount, other.QueryCount, sum)
+	cp.QueryErrorCount = merge(cp.QueryErrorCount, other.QueryErrorCount, sum)
+	cp.LatencyMicros = merge(cp.LatencyMicros, other.LatencyMicros, max)
+	cp.Attempted = cp.Attempted && other.Attempted
 	return cp
 }
 
+// Rendered is the part of the EdgeMetadata the UI draws edges with, rather
+// than the traffic counted over them.
+func (e EdgeMetadata) Rendered() EdgeMetadata {
+	return EdgeMetadata{
+		Transport:     e.Transport,
+		NetworkPolicy: e.NetworkPolicy,
+		Attempted:     e.Attempted,
+	}
+}
+
+// mergeTransport lets non-TCP transports win, so that an edge aggregating
+// both TCP and UDP flows is still shown as carrying UDP.
+func mergeTransport(dst, src string) string {
+	if dst == "" {
+		return src
+	}
+	return dst
+}
+
+// mergeNetworkPolicy lets denials win, so that an edge aggregating a denied
+// flow is never shown as allowed.
+func mergeNetworkPolicy(dst, src string) string {
+	if dst == "" || src == NetworkPolicyDenied {
+		return src
+	}
+	return dst
+}
+
 func merge(dst, src *uint64, op func(uint64, uint64) uint64) *uint64 {
 	if src == nil {
 		return dst
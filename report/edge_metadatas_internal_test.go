@@ -183,6 +183,73 @@ func TestEdgeMetadataFlatten(t *testing.T) {
 		}
 	}
 
+	// Test UDP wins when flattening edges of mixed transports
+	{
+		have := (EdgeMetadata{}).Flatten(EdgeMetadata{
+			Transport: "udp",
+		})
+		want := EdgeMetadata{
+			Transport: "udp",
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+
+	// Test denials win when flattening edges with mixed policy status
+	{
+		have := (EdgeMetadata{
+			NetworkPolicy: NetworkPolicyDenied,
+		}).Flatten(EdgeMetadata{
+			NetworkPolicy: NetworkPolicyAllowed,
+		})
+		want := EdgeMetadata{
+			NetworkPolicy: NetworkPolicyDenied,
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+
+	// Test the slowest RTT wins, and retransmissions add up, when
+	// flattening edges
+	{
+		have := (EdgeMetadata{
+			RTTMicros:   newu64(200),
+			Retransmits: newu64(1),
+		}).Flatten(EdgeMetadata{
+			RTTMicros:   newu64(1500),
+			Retransmits: newu64(2),
+		})
+		want := EdgeMetadata{
+			RTTMicros:   newu64(1500),
+			Retransmits: newu64(3),
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+
+	// Test queries and their errors add up, when flattening edges to
+	// database servers
+	{
+		have := (EdgeMetadata{
+			QueryCount: newu64(10),
+		}).Flatten(EdgeMetadata{
+			Protocol:        "mysql",
+			QueryCount:      newu64(5),
+			QueryErrorCount: newu64(1),
+		})
+		want := EdgeMetadata{
+			Protocol:        "mysql",
+			QueryCount:      newu64(15),
+			QueryErrorCount: newu64(1),
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+
 	{
 		// Should not panic on nil
 		have := EdgeMetadatas{}.Flatten()
@@ -212,6 +279,7 @@ func TestEdgeMetadatasEncoding(t *testing.T) {
 		}).
 		Add("bar", EdgeMetadata{
 			EgressPacketCount: newu64(3),
+			Transport:         "udp",
 		})
 
 	{
@@ -286,3 +354,40 @@ func TestEdgeMetadataDeepEquals(t *testing.T) {
 		}
 	}
 }
+
+func TestEdgeMetadataAttempted(t *testing.T) {
+	var (
+		attempted = EdgeMetadata{Attempted: true}
+		answered  = EdgeMetadata{EgressPacketCount: newu64(3)}
+	)
+	if !attempted.Merge(attempted).Attempted || attempted.Merge(answered).Attempted || answered.Flatten(attempted).Attempted {
+		t.Errorf("Expected edges to be attempted only while none of their connections were answered")
+	}
+
+	edges := MakeEdgeMetadatas().Add("a", attempted).Add("b", attempted)
+	if !edges.Flatten().Attempted {
+		t.Errorf("Expected the flattened attempted edges to be attempted")
+	}
+	if md, _ := edges.Answered("a").Lookup("a"); md.Attempted {
+		t.Errorf("Expected the answered edge not to be attempted")
+	}
+	if md, _ := edges.Answered("a").Lookup("b"); !md.Attempted {
+		t.Errorf("Expected the other edge to still be attempted")
+	}
+
+	// Nodes adjacent without having attempted an edge answer it
+	var (
+		attempter = MakeNode("n").WithEdge("a", attempted).WithEdge("b", attempted)
+		adjacent  = MakeNode("n").WithAdjacent("a")
+		merged    = attempter.Merge(adjacent)
+	)
+	if md, _ := merged.Edges.Lookup("a"); md.Attempted {
+		t.Errorf("Expected the edge of the adjacent node not to be attempted")
+	}
+	if md, _ := merged.Edges.Lookup("b"); !md.Attempted {
+		t.Errorf("Expected the other edge to still be attempted")
+	}
+	if md, _ := adjacent.Merge(attempter).Edges.Lookup("a"); md.Attempted {
+		t.Errorf("Expected merging to be commutative")
+	}
+}
@@ -30,7 +30,48 @@ const (
 	DockerOverlayPeerPrefix = "docker_peer_"
 )
 
+// AddressScope scopes the private addresses of node IDs which aren't
+// host-scoped, like pod IPs, by a cluster ID, so that the identical addresses
+// of clusters with networks which overlap never collide when their probes
+// publish to the same app. Probes set it from -probe.cluster-id; empty, the
+// default, leaves them unscoped.
+var AddressScope = ""
+
+// privateNetworks are the networks addresses are only unique within, and
+// scoped by AddressScope: those of RFC 1918, the shared address space of
+// RFC 6598 some overlay networks use, and IPv6 unique local addresses.
+var privateNetworks = func() []*net.IPNet {
+	var result []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		result = append(result, network)
+	}
+	return result
+}()
+
+// ClusterAddressScope gives the scope of an address of a cluster, which
+// isn't host-scoped: the cluster ID if the address is private, as addresses
+// of the same cluster are scoped in node IDs.
+func ClusterAddressScope(clusterID, address string) string {
+	if clusterID == "" {
+		return ""
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return clusterID
+		}
+	}
+	return ""
+}
+
 // MakeEndpointNodeID produces an endpoint node ID from its composite parts.
+// Endpoint node IDs carry no transport, so TCP and UDP flows on the same
+// address and port are of the same endpoint node, and their edges merged
+// (shown as UDP, see mergeTransport).
 func MakeEndpointNodeID(hostID, namespaceID, address, port string) string {
 	return makeAddressID(hostID, namespaceID, address) + ScopeDelim + port
 }
@@ -47,7 +88,14 @@ func makeAddressID(hostID, namespaceID, address string) string {
 	// scoped by hostID
 	// Loopback addresses are also scoped by the networking
 	// namespace if available, since they can clash.
+	// IPv6 link-local addresses are only unique on their link, so they are
+	// scoped by hostID too.
 	addressIP := net.ParseIP(address)
+	if addressIP != nil {
+		// IPv6 addresses have many spellings, and IPv4-mapped ones are
+		// the IPv4 addresses of dual-stack sockets
+		address = addressIP.String()
+	}
 	if addressIP != nil && LocalNetworks.Contains(addressIP) {
 		scope = hostID
 	} else if IsLoopback(address) {
@@ -55,6 +103,10 @@ func makeAddressID(hostID, namespaceID, address string) string {
 		if namespaceID != "" {
 			scope += "-" + namespaceID
 		}
+	} else if addressIP != nil && addressIP.To4() == nil && addressIP.IsLinkLocalUnicast() {
+		scope = hostID
+	} else {
+		scope = ClusterAddressScope(AddressScope, address)
 	}
 
 	return scope + ScopeDelim + address
@@ -77,11 +129,37 @@ func MakeProcessNodeID(hostID, pid string) string {
 	return hostID + ScopeDelim + pid
 }
 
+// MakeNetIfaceNodeID produces a network interface node ID from its composite parts.
+func MakeNetIfaceNodeID(hostID, name string) string {
+	return hostID + ScopeDelim + name
+}
+
+// MakeScopeComponentNodeID produces a Scope component node ID from its kind,
+// one of app, probe or plugin, and its ID.
+func MakeScopeComponentNodeID(kind, id string) string {
+	return kind + ScopeDelim + id
+}
+
+// MakeSystemdUnitNodeID produces a systemd unit node ID from its composite parts.
+func MakeSystemdUnitNodeID(hostID, unit string) string {
+	return hostID + ScopeDelim + unit
+}
+
+// MakeVirtualMachineNodeID produces a virtual machine node ID from its composite parts.
+func MakeVirtualMachineNodeID(hostID, name string) string {
+	return hostID + ScopeDelim + name
+}
+
 // MakeECSServiceNodeID produces an ECS Service node ID from its composite parts.
 func MakeECSServiceNodeID(cluster, serviceName string) string {
 	return cluster + ScopeDelim + serviceName
 }
 
+// MakeECSStackNodeID produces an ECS Stack node ID from its composite parts.
+func MakeECSStackNodeID(kind, name string) string {
+	return kind + ScopeDelim + name
+}
+
 var (
 	// MakeHostNodeID produces a host node ID from its composite parts.
 	MakeHostNodeID = makeSingleComponentID("host")
@@ -143,6 +221,18 @@ var (
 	// ParseCronJobNodeID parses a daemon set node ID
 	ParseCronJobNodeID = parseSingleComponentID("cronjob")
 
+	// MakeCustomResourceNodeID produces a custom resource node ID from its composite parts.
+	MakeCustomResourceNodeID = makeSingleComponentID("custom_resource")
+
+	// ParseCustomResourceNodeID parses a custom resource node ID
+	ParseCustomResourceNodeID = parseSingleComponentID("custom_resource")
+
+	// MakeNetworkPolicyNodeID produces a network policy node ID from its composite parts.
+	MakeNetworkPolicyNodeID = makeSingleComponentID("network_policy")
+
+	// ParseNetworkPolicyNodeID parses a network policy node ID
+	ParseNetworkPolicyNodeID = parseSingleComponentID("network_policy")
+
 	// MakeECSTaskNodeID produces a replica set node ID from its composite parts.
 	MakeECSTaskNodeID = makeSingleComponentID("ecs_task")
 
@@ -154,6 +244,30 @@ var (
 
 	// ParseSwarmServiceNodeID parses a replica set node ID
 	ParseSwarmServiceNodeID = parseSingleComponentID("swarm_service")
+
+	// MakeSwarmStackNodeID produces a Swarm stack node ID from its composite parts.
+	MakeSwarmStackNodeID = makeSingleComponentID("swarm_stack")
+
+	// ParseSwarmStackNodeID parses a Swarm stack node ID
+	ParseSwarmStackNodeID = parseSingleComponentID("swarm_stack")
+
+	// MakeNomadJobNodeID produces a Nomad job node ID from its composite parts.
+	MakeNomadJobNodeID = makeSingleComponentID("nomad_job")
+
+	// ParseNomadJobNodeID parses a Nomad job node ID
+	ParseNomadJobNodeID = parseSingleComponentID("nomad_job")
+
+	// MakeNomadTaskGroupNodeID produces a Nomad task group node ID from its composite parts.
+	MakeNomadTaskGroupNodeID = makeSingleComponentID("nomad_task_group")
+
+	// ParseNomadTaskGroupNodeID parses a Nomad task group node ID
+	ParseNomadTaskGroupNodeID = parseSingleComponentID("nomad_task_group")
+
+	// MakeNomadAllocationNodeID produces a Nomad allocation node ID from its composite parts.
+	MakeNomadAllocationNodeID = makeSingleComponentID("nomad_allocation")
+
+	// ParseNomadAllocationNodeID parses a Nomad allocation node ID
+	ParseNomadAllocationNodeID = parseSingleComponentID("nomad_allocation")
 )
 
 // makeSingleComponentID makes a single-component node id encoder
@@ -227,6 +341,42 @@ func ParseAddressNodeID(addressNodeID string) (hostID, address string, ok bool)
 	return fields[0], fields[1], true
 }
 
+// ParseNetIfaceNodeID produces the host ID and name of a network interface from its node ID.
+func ParseNetIfaceNodeID(netIfaceNodeID string) (hostID, name string, ok bool) {
+	fields := strings.SplitN(netIfaceNodeID, ScopeDelim, 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+// ParseScopeComponentNodeID produces the kind and ID of a Scope component from its node ID.
+func ParseScopeComponentNodeID(scopeComponentNodeID string) (kind, id string, ok bool) {
+	fields := strings.SplitN(scopeComponentNodeID, ScopeDelim, 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+// ParseSystemdUnitNodeID produces the host ID and name of a systemd unit from its node ID.
+func ParseSystemdUnitNodeID(systemdUnitNodeID string) (hostID, unit string, ok bool) {
+	fields := strings.SplitN(systemdUnitNodeID, ScopeDelim, 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+// ParseVirtualMachineNodeID produces the host ID and domain name of a virtual machine from its node ID.
+func ParseVirtualMachineNodeID(virtualMachineNodeID string) (hostID, name string, ok bool) {
+	fields := strings.SplitN(virtualMachineNodeID, ScopeDelim, 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
 // ParseECSServiceNodeID produces the cluster, service name from an ECS Service node ID
 func ParseECSServiceNodeID(ecsServiceNodeID string) (cluster, serviceName string, ok bool) {
 	fields := strings.SplitN(ecsServiceNodeID, ScopeDelim, 2)
@@ -241,6 +391,15 @@ func ParseECSServiceNodeID(ecsServiceNodeID string) (cluster, serviceName string
 	return fields[0], fields[1], true
 }
 
+// ParseECSStackNodeID produces the kind and name from an ECS Stack node ID
+func ParseECSStackNodeID(ecsStackNodeID string) (kind, name string, ok bool) {
+	fields := strings.SplitN(ecsStackNodeID, ScopeDelim, 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
 // ExtractHostID extracts the host id from Node
 func ExtractHostID(m Node) string {
 	hostNodeID, _ := m.Latest.Lookup(HostNodeID)
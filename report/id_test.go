@@ -52,6 +52,10 @@ func TestEndpointNodeID(t *testing.T) {
 	for input, want := range map[string]struct{ name, address, port string }{
 		report.MakeEndpointNodeID("host.com", "namespaceid", "127.0.0.1", "c"): {"host.com-namespaceid", "127.0.0.1", "c"},
 		report.MakeEndpointNodeID("host.com", "", "1.2.3.4", "c"):              {"", "1.2.3.4", "c"},
+		report.MakeEndpointNodeID("host.com", "namespaceid", "::1", "c"):       {"host.com-namespaceid", "::1", "c"},
+		report.MakeEndpointNodeID("host.com", "", "2001:DB8:0::1", "c"):        {"", "2001:db8::1", "c"},
+		report.MakeEndpointNodeID("host.com", "", "::ffff:1.2.3.4", "c"):       {"", "1.2.3.4", "c"},
+		report.MakeEndpointNodeID("host.com", "", "fe80::1", "c"):              {"host.com", "fe80::1", "c"},
 		"a;b;c": {"a", "b", "c"},
 	} {
 		haveName, haveAddress, havePort, ok := report.ParseEndpointNodeID(input)
@@ -78,3 +82,41 @@ func TestECSServiceNodeIDCompat(t *testing.T) {
 		t.Errorf("Backwards-compatible id %q parsed name to %q, expected %q", testID, name, testName)
 	}
 }
+
+func TestECSStackNodeID(t *testing.T) {
+	kind, name, ok := report.ParseECSStackNodeID(report.MakeECSStackNodeID("Terraform", "prod;eu"))
+	if !ok || kind != "Terraform" || name != "prod;eu" {
+		t.Errorf("Expected the kind and name back, got %q, %q, %v", kind, name, ok)
+	}
+	if _, _, ok := report.ParseECSStackNodeID("no-delimiter"); ok {
+		t.Error("Expected an ID without a delimiter not to parse")
+	}
+}
+
+func TestAddressScope(t *testing.T) {
+	report.AddressScope = "cluster-a"
+	defer func() { report.AddressScope = "" }()
+
+	for _, c := range []struct {
+		hostID, address, want string
+	}{
+		// Private addresses are scoped by the cluster
+		{"host1", "10.0.47.1", "cluster-a;10.0.47.1;80"},
+		{"host1", "100.96.1.7", "cluster-a;100.96.1.7;80"},
+		{"host1", "fd00::7", "cluster-a;fd00::7;80"},
+		// Others are unique anyway
+		{"host1", "8.8.8.8", ";8.8.8.8;80"},
+		// Host-scoped ones are still scoped by their host
+		{"host1", "127.0.0.1", "host1;127.0.0.1;80"},
+	} {
+		if have := report.MakeEndpointNodeID(c.hostID, "", c.address, "80"); have != c.want {
+			t.Errorf("%s: expected %q, got %q", c.address, c.want, have)
+		}
+	}
+	if have := report.ClusterAddressScope("cluster-b", "192.168.1.1"); have != "cluster-b" {
+		t.Errorf("Expected the scope of a private address of cluster-b, got %q", have)
+	}
+	if have := report.ClusterAddressScope("", "192.168.1.1"); have != "" {
+		t.Errorf("Expected no scope without a cluster, got %q", have)
+	}
+}
@@ -1,12 +1,18 @@
 package report_test
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/report"
+	s_reflect "github.com/weaveworks/scope/test/reflect"
 )
 
 func TestRoundtrip(t *testing.T) {
@@ -55,3 +61,69 @@ func TestMoreCompressionMeansSmaller(t *testing.T) {
 		t.Errorf("Compression doesn't change size: %v >= %v", buf1.Len(), buf2.Len())
 	}
 }
+
+func makeV2TestReport() report.Report {
+	now := time.Unix(1500000000, 0).UTC()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	r := report.MakeReport()
+	r.Endpoint = r.Endpoint.WithMetadataTemplates(report.MetadataTemplates{"addr": {ID: "addr", Label: "Address"}})
+	for i := 0; i < 100; i++ {
+		id := report.MakeEndpointNodeID("host", "", "10.0.0.1", fmt.Sprint(i))
+		node := report.MakeNode(id).WithTopology(report.Endpoint).
+			WithLatest("addr", now, "10.0.0.1").
+			WithLatest("port", now.Add(time.Duration(i)), fmt.Sprint(i)).
+			WithSet("names", report.MakeStringSet("b", "a")).
+			WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet("host;<host>")))
+		if i%3 == 0 {
+			peer := report.MakeEndpointNodeID("host", "", "10.0.0.2", "80")
+			count := uint64(i)
+			node = node.WithAdjacent(peer).WithEdge(peer, report.EdgeMetadata{EgressByteCount: &count})
+		}
+		r.Endpoint = r.Endpoint.AddNode(node)
+	}
+	r.Host = r.Host.AddNode(report.MakeNodeWith("host;<host>", map[string]string{"name": "host"}).
+		WithTopology(report.Host).
+		WithMetric("load1", report.MakeSingletonMetric(now, 0.5)).
+		WithControls("restart").
+		WithLatestActiveControls("restart"))
+	// Zero timestamps are kept
+	r.Host = r.Host.AddNode(report.MakeNode("other").WithLatest("name", time.Time{}, "other"))
+	return r
+}
+
+func TestRoundtripV2(t *testing.T) {
+	r1 := makeV2TestReport()
+	var v1, v2 bytes.Buffer
+	if err := r1.WriteBinary(&v1, gzip.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.WriteBinaryV2(&v2, gzip.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Len() >= v1.Len() {
+		t.Errorf("v2 report isn't smaller: %d >= %d bytes", v2.Len(), v1.Len())
+	}
+	if len(r1.Endpoint.Nodes) != 100 {
+		t.Errorf("Encoding modified the report")
+	}
+
+	if !report.PeekV2(bufio.NewReader(bytes.NewReader(v2.Bytes()))) {
+		t.Errorf("Expected a v2 report")
+	}
+	if report.PeekV2(bufio.NewReader(bytes.NewReader(v1.Bytes()))) {
+		t.Errorf("Didn't expect a v2 report")
+	}
+	if _, err := report.MakeFromBinaryV2(&v1); err == nil {
+		t.Errorf("Expected an error reading a msgpack report")
+	}
+
+	r2, err := report.MakeFromBinaryV2(&v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s_reflect.DeepEqual(r1, *r2) {
+		t.Errorf("%s", test.Diff(r1, *r2))
+	}
+}
@@ -0,0 +1,471 @@
+package report
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/ugorji/go/codec"
+)
+
+// The v2 wire format of reports is a protobuf in which every string is
+// interned, and nodes are encoded by column: rather than each node carrying
+// its own map of latest values, sets and parents, a topology has a column per
+// key, holding the rows (nodes) with that key and their values. Node IDs and
+// metadata keys, which the msgpack encoding repeats for every node, are sent
+// once per report.
+//
+// What isn't columnar is kept as msgpack: the report with its nodes taken
+// out, and the counters, edges, controls, metrics and children of the nodes
+// which have any.
+
+// V2ContentType is the Content-Type of reports in the v2 wire format.
+const V2ContentType = "application/vnd.weaveworks.scope.report.v2"
+
+// v2Magic starts reports in the v2 wire format, before their gzipped
+// protobuf. It can't start a gzip stream.
+const v2Magic = "scope-report-v2\n"
+
+type reportV2 struct {
+	Strings    []string      `protobuf:"bytes,1,rep,name=strings" json:"strings,omitempty"`
+	Meta       []byte        `protobuf:"bytes,2,opt,name=meta,proto3" json:"meta,omitempty"`
+	Topologies []*topologyV2 `protobuf:"bytes,3,rep,name=topologies" json:"topologies,omitempty"`
+}
+
+func (m *reportV2) Reset()         { *m = reportV2{} }
+func (m *reportV2) String() string { return proto.CompactTextString(m) }
+func (*reportV2) ProtoMessage()    {}
+
+// topologyV2 holds the nodes of a topology. Row i of the columns is the node
+// with the ID IDs[i]. Strings are indexes in the strings of the report.
+type topologyV2 struct {
+	Name       uint32            `protobuf:"varint,1,opt,name=name,proto3" json:"name,omitempty"`
+	IDs        []uint32          `protobuf:"varint,2,rep,packed,name=ids" json:"ids,omitempty"`
+	Topologies []uint32          `protobuf:"varint,3,rep,packed,name=topologies" json:"topologies,omitempty"`
+	Latest     []*latestColumnV2 `protobuf:"bytes,4,rep,name=latest" json:"latest,omitempty"`
+	Sets       []*setsColumnV2   `protobuf:"bytes,5,rep,name=sets" json:"sets,omitempty"`
+	Parents    []*setsColumnV2   `protobuf:"bytes,6,rep,name=parents" json:"parents,omitempty"`
+	Adjacency  *setsColumnV2     `protobuf:"bytes,7,opt,name=adjacency" json:"adjacency,omitempty"`
+	RestRows   []uint32          `protobuf:"varint,8,rep,packed,name=rest_rows" json:"rest_rows,omitempty"`
+	Rest       []byte            `protobuf:"bytes,9,opt,name=rest,proto3" json:"rest,omitempty"`
+}
+
+func (m *topologyV2) Reset()         { *m = topologyV2{} }
+func (m *topologyV2) String() string { return proto.CompactTextString(m) }
+func (*topologyV2) ProtoMessage()    {}
+
+// latestColumnV2 holds the latest values of a key. Rows and timestamps (in
+// nanoseconds, 0 for none) are delta-encoded.
+type latestColumnV2 struct {
+	Key        uint32   `protobuf:"varint,1,opt,name=key,proto3" json:"key,omitempty"`
+	Rows       []uint32 `protobuf:"varint,2,rep,packed,name=rows" json:"rows,omitempty"`
+	Values     []uint32 `protobuf:"varint,3,rep,packed,name=values" json:"values,omitempty"`
+	Timestamps []int64  `protobuf:"zigzag64,4,rep,packed,name=timestamps" json:"timestamps,omitempty"`
+}
+
+func (m *latestColumnV2) Reset()         { *m = latestColumnV2{} }
+func (m *latestColumnV2) String() string { return proto.CompactTextString(m) }
+func (*latestColumnV2) ProtoMessage()    {}
+
+// setsColumnV2 holds the string sets of a key: Counts[i] values for the row
+// Rows[i]. Rows are delta-encoded.
+type setsColumnV2 struct {
+	Key    uint32   `protobuf:"varint,1,opt,name=key,proto3" json:"key,omitempty"`
+	Rows   []uint32 `protobuf:"varint,2,rep,packed,name=rows" json:"rows,omitempty"`
+	Counts []uint32 `protobuf:"varint,3,rep,packed,name=counts" json:"counts,omitempty"`
+	Values []uint32 `protobuf:"varint,4,rep,packed,name=values" json:"values,omitempty"`
+}
+
+func (m *setsColumnV2) Reset()         { *m = setsColumnV2{} }
+func (m *setsColumnV2) String() string { return proto.CompactTextString(m) }
+func (*setsColumnV2) ProtoMessage()    {}
+
+func (c *setsColumnV2) add(row, previous uint32, values StringSet, strings *stringTable) {
+	c.Rows = append(c.Rows, row-previous)
+	c.Counts = append(c.Counts, uint32(len(values)))
+	for _, v := range values {
+		c.Values = append(c.Values, strings.intern(v))
+	}
+}
+
+// stringTable interns the strings of a report.
+type stringTable struct {
+	strings []string
+	index   map[string]uint32
+}
+
+func (t *stringTable) intern(s string) uint32 {
+	i, ok := t.index[s]
+	if !ok {
+		i = uint32(len(t.strings))
+		t.strings = append(t.strings, s)
+		t.index[s] = i
+	}
+	return i
+}
+
+// WriteBinaryV2 writes a Report in the v2 wire format.
+func (rep Report) WriteBinaryV2(w io.Writer, compressionLevel int) error {
+	strings := &stringTable{index: map[string]uint32{}}
+	msg := &reportV2{}
+
+	// rep is a copy, so taking the nodes out of its topologies leaves the
+	// caller's alone.
+	topologies := rep.TopologyMap()
+	names := make([]string, 0, len(topologies))
+	for name := range topologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := topologies[name]
+		if len(t.Nodes) == 0 {
+			continue
+		}
+		encoded, err := encodeTopologyV2(name, t.Nodes, strings)
+		if err != nil {
+			return err
+		}
+		msg.Topologies = append(msg.Topologies, encoded)
+		t.Nodes = Nodes{}
+	}
+
+	var meta []byte
+	if err := codec.NewEncoderBytes(&meta, &codec.MsgpackHandle{}).Encode(&rep); err != nil {
+		return err
+	}
+	msg.Meta = meta
+	msg.Strings = strings.strings
+
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, v2Magic); err != nil {
+		return err
+	}
+	gzwriter, err := gzip.NewWriterLevel(w, compressionLevel)
+	if err != nil {
+		return err
+	}
+	if _, err := gzwriter.Write(buf); err != nil {
+		return err
+	}
+	return gzwriter.Close()
+}
+
+func encodeTopologyV2(name string, nodes Nodes, strings *stringTable) (*topologyV2, error) {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		t         = &topologyV2{Name: strings.intern(name), Adjacency: &setsColumnV2{}}
+		latest    = map[string]*latestColumnV2{}
+		lastRow   = map[string]uint32{}
+		lastTime  = map[string]int64{}
+		sets      = map[string]*setsColumnV2{}
+		parents   = map[string]*setsColumnV2{}
+		lastSet   = map[string]uint32{}
+		lastAdj   uint32
+		rest      []Node
+		lastRest  uint32
+		restShape = MakeNode("")
+	)
+	for row, id := range ids {
+		r, n := uint32(row), nodes[id]
+		t.IDs = append(t.IDs, strings.intern(id))
+		t.Topologies = append(t.Topologies, strings.intern(n.Topology))
+
+		n.Latest.ForEach(func(k string, ts time.Time, v string) {
+			c, ok := latest[k]
+			if !ok {
+				c = &latestColumnV2{Key: strings.intern(k)}
+				latest[k] = c
+			}
+			var nanos int64
+			if !ts.IsZero() {
+				nanos = ts.UnixNano()
+			}
+			c.Rows = append(c.Rows, r-lastRow[k])
+			c.Values = append(c.Values, strings.intern(v))
+			c.Timestamps = append(c.Timestamps, nanos-lastTime[k])
+			lastRow[k], lastTime[k] = r, nanos
+		})
+		encodeSetsV2(r, n.Sets, sets, lastSet, "s", strings)
+		encodeSetsV2(r, n.Parents, parents, lastSet, "p", strings)
+		if len(n.Adjacency) > 0 {
+			t.Adjacency.add(r, lastAdj, StringSet(n.Adjacency), strings)
+			lastAdj = r
+		}
+
+		if n.Counters.Size() > 0 || n.Edges.Size() > 0 || len(n.Controls.Controls) > 0 ||
+			!n.Controls.Timestamp.IsZero() || n.LatestControls.Size() > 0 ||
+			len(n.Metrics) > 0 || n.Children.Size() > 0 {
+			r := restShape
+			r.Counters, r.Edges, r.Controls = n.Counters, n.Edges, n.Controls
+			r.LatestControls, r.Metrics, r.Children = n.LatestControls, n.Metrics, n.Children
+			rest = append(rest, r)
+			t.RestRows = append(t.RestRows, uint32(row)-lastRest)
+			lastRest = uint32(row)
+		}
+	}
+
+	for _, key := range sortedKeys(latest) {
+		t.Latest = append(t.Latest, latest[key])
+	}
+	for _, key := range sortedKeys(sets) {
+		t.Sets = append(t.Sets, sets[key])
+	}
+	for _, key := range sortedKeys(parents) {
+		t.Parents = append(t.Parents, parents[key])
+	}
+	if len(rest) > 0 {
+		if err := codec.NewEncoderBytes(&t.Rest, &codec.MsgpackHandle{}).Encode(rest); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// encodeSetsV2 adds the sets of a row to their columns. Sets and parents
+// share lastRow, under different prefixes.
+func encodeSetsV2(row uint32, s Sets, columns map[string]*setsColumnV2, lastRow map[string]uint32, prefix string, strings *stringTable) {
+	for _, k := range s.Keys() {
+		values, _ := s.Lookup(k)
+		c, ok := columns[k]
+		if !ok {
+			c = &setsColumnV2{Key: strings.intern(k)}
+			columns[k] = c
+		}
+		c.add(row, lastRow[prefix+k], values, strings)
+		lastRow[prefix+k] = row
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*latestColumnV2:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*setsColumnV2:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PeekV2 tells whether the report to be read from r is in the v2 wire
+// format, without consuming it.
+func PeekV2(r *bufio.Reader) bool {
+	prefix, err := r.Peek(len(v2Magic))
+	return err == nil && string(prefix) == v2Magic
+}
+
+// ReadBinaryV2 reads a report in the v2 wire format into a Report.
+func (rep *Report) ReadBinaryV2(r io.Reader) error {
+	prefix := make([]byte, len(v2Magic))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return err
+	}
+	if string(prefix) != v2Magic {
+		return fmt.Errorf("not a v2 report")
+	}
+	gzreader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadAll(gzreader)
+	if err != nil {
+		return err
+	}
+	var msg reportV2
+	if err := proto.Unmarshal(buf, &msg); err != nil {
+		return err
+	}
+	if err := rep.ReadBytes(msg.Meta, &codec.MsgpackHandle{}); err != nil {
+		return err
+	}
+	d := v2Decoder{strings: msg.Strings}
+	topologies := rep.TopologyMap()
+	for _, encoded := range msg.Topologies {
+		name := d.string(encoded.Name)
+		t, ok := topologies[name]
+		if d.err == nil && !ok {
+			return fmt.Errorf("unknown topology %q", name)
+		}
+		nodes := d.topology(encoded)
+		if d.err != nil {
+			return d.err
+		}
+		t.Nodes = nodes
+	}
+	return nil
+}
+
+// MakeFromBinaryV2 constructs a Report from the v2 wire format.
+func MakeFromBinaryV2(r io.Reader) (*Report, error) {
+	rep := MakeReport()
+	if err := rep.ReadBinaryV2(r); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// v2Decoder decodes the topologies of a report, keeping the first error.
+type v2Decoder struct {
+	strings []string
+	err     error
+}
+
+func (d *v2Decoder) string(i uint32) string {
+	if int(i) >= len(d.strings) {
+		d.fail("string index %d out of range", i)
+		return ""
+	}
+	return d.strings[i]
+}
+
+func (d *v2Decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("invalid v2 report: "+format, args...)
+	}
+}
+
+// row decodes the delta-encoded row, returning false if it's out of range.
+func (d *v2Decoder) row(delta uint32, previous *uint32, rows int) bool {
+	*previous += delta
+	if int(*previous) >= rows {
+		d.fail("row %d out of range", *previous)
+		return false
+	}
+	return true
+}
+
+func (d *v2Decoder) topology(t *topologyV2) Nodes {
+	if len(t.Topologies) != len(t.IDs) {
+		d.fail("%d topologies for %d nodes", len(t.Topologies), len(t.IDs))
+		return nil
+	}
+	rows := make([]Node, len(t.IDs))
+	for i, id := range t.IDs {
+		rows[i] = MakeNode(d.string(id)).WithTopology(d.string(t.Topologies[i]))
+	}
+
+	for _, c := range t.Latest {
+		if len(c.Values) != len(c.Rows) || len(c.Timestamps) != len(c.Rows) {
+			d.fail("latest column of %d rows, %d values and %d timestamps", len(c.Rows), len(c.Values), len(c.Timestamps))
+			return nil
+		}
+		key := d.string(c.Key)
+		var row uint32
+		var nanos int64
+		for i, delta := range c.Rows {
+			if !d.row(delta, &row, len(rows)) {
+				return nil
+			}
+			nanos += c.Timestamps[i]
+			var ts time.Time
+			if nanos != 0 {
+				ts = time.Unix(0, nanos)
+			}
+			rows[row].Latest = rows[row].Latest.Set(key, ts, d.string(c.Values[i]))
+		}
+	}
+	for _, c := range t.Sets {
+		d.sets(c, rows, func(n *Node, key string, values StringSet) { n.Sets = n.Sets.Add(key, values) })
+	}
+	for _, c := range t.Parents {
+		d.sets(c, rows, func(n *Node, key string, values StringSet) { n.Parents = n.Parents.Add(key, values) })
+	}
+	if t.Adjacency != nil {
+		d.sets(t.Adjacency, rows, func(n *Node, _ string, values StringSet) { n.Adjacency = IDList(values) })
+	}
+
+	if len(t.RestRows) > 0 {
+		var rest []Node
+		if err := codec.NewDecoderBytes(t.Rest, &codec.MsgpackHandle{}).Decode(&rest); err != nil {
+			d.fail("%v", err)
+			return nil
+		}
+		if len(rest) != len(t.RestRows) {
+			d.fail("%d nodes for %d rows", len(rest), len(t.RestRows))
+			return nil
+		}
+		var row uint32
+		for i, delta := range t.RestRows {
+			if !d.row(delta, &row, len(rows)) {
+				return nil
+			}
+			rows[row] = withRestV2(rows[row], rest[i])
+		}
+	}
+
+	nodes := make(Nodes, len(rows))
+	for _, n := range rows {
+		nodes[n.ID] = n
+	}
+	return nodes
+}
+
+// withRestV2 gives a node the non-columnar fields of rest. Empty ones are left
+// as made by MakeNode, rather than as decoded.
+func withRestV2(n, rest Node) Node {
+	if rest.Counters.Size() > 0 {
+		n.Counters = rest.Counters
+	}
+	if rest.Edges.Size() > 0 {
+		n.Edges = rest.Edges
+	}
+	if len(rest.Controls.Controls) > 0 || !rest.Controls.Timestamp.IsZero() {
+		n.Controls = rest.Controls
+	}
+	if rest.LatestControls.Size() > 0 {
+		n.LatestControls = rest.LatestControls
+	}
+	if len(rest.Metrics) > 0 {
+		n.Metrics = rest.Metrics
+	}
+	if rest.Children.Size() > 0 {
+		n.Children = rest.Children
+	}
+	return n
+}
+
+func (d *v2Decoder) sets(c *setsColumnV2, rows []Node, add func(*Node, string, StringSet)) {
+	if len(c.Counts) != len(c.Rows) {
+		d.fail("set column of %d rows and %d counts", len(c.Rows), len(c.Counts))
+		return
+	}
+	key := d.string(c.Key)
+	var row uint32
+	values := c.Values
+	for i, delta := range c.Rows {
+		if !d.row(delta, &row, len(rows)) {
+			return
+		}
+		count := int(c.Counts[i])
+		if count > len(values) {
+			d.fail("set of %d values out of range", count)
+			return
+		}
+		// Values were sorted when encoded
+		set := make(StringSet, count)
+		for j, v := range values[:count] {
+			set[j] = d.string(v)
+		}
+		values = values[count:]
+		add(&rows[row], key, set)
+	}
+}
@@ -7,10 +7,11 @@ import (
 // DefaultFormat and friends tell the UI how to render the "Value" of this
 // metric.
 const (
-	DefaultFormat  = ""
-	FilesizeFormat = "filesize"
-	IntegerFormat  = "integer"
-	PercentFormat  = "percent"
+	DefaultFormat      = ""
+	FilesizeFormat     = "filesize"
+	FilesizeRateFormat = "filesizerate"
+	IntegerFormat      = "integer"
+	PercentFormat      = "percent"
 )
 
 // MetricRow is a tuple of data used to render a metric as a sparkline and
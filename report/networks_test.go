@@ -33,6 +33,20 @@ func TestContainingIPv4Network(t *testing.T) {
 	assert.Equal(t, "0.0.0.0/0", containingIPv4Networks([]string{"10.0.0.1", "192.168.0.1"}).String())
 }
 
+func TestContainingIPv6Network(t *testing.T) {
+	ips := func(ipstrings ...string) []net.IP {
+		result := []net.IP{}
+		for _, ip := range ipstrings {
+			result = append(result, net.ParseIP(ip))
+		}
+		return result
+	}
+	assert.Nil(t, report.ContainingIPv6Network(nil))
+	assert.Equal(t, "fd00::1/128", report.ContainingIPv6Network(ips("fd00::1")).String())
+	assert.Equal(t, "fd00:10:96::/112", report.ContainingIPv6Network(ips("fd00:10:96::1", "fd00:10:96::a", "fd00:10:96::ff00")).String())
+	assert.Equal(t, "::/0", report.ContainingIPv6Network(ips("fd00::1", "2001:db8::1")).String())
+}
+
 func containingIPv4Networks(ipstrings []string) *net.IPNet {
 	ips := make([]net.IP, len(ipstrings))
 	for i, ip := range ipstrings {
@@ -205,7 +205,7 @@ func (n Node) Merge(other Node) Node {
 		Counters:       n.Counters.Merge(other.Counters),
 		Sets:           n.Sets.Merge(other.Sets),
 		Adjacency:      n.Adjacency.Merge(other.Adjacency),
-		Edges:          n.Edges.Merge(other.Edges),
+		Edges:          mergeEdges(n, other),
 		Controls:       n.Controls.Merge(other.Controls),
 		LatestControls: n.LatestControls.Merge(other.LatestControls),
 		Latest:         n.Latest.Merge(other.Latest),
@@ -214,3 +214,22 @@ func (n Node) Merge(other Node) Node {
 		Children:       n.Children.Merge(other.Children),
 	}
 }
+
+// mergeEdges merges the edges of two nodes. An edge attempted by one node is
+// answered if the other is adjacent without having attempted it.
+func mergeEdges(n, other Node) EdgeMetadatas {
+	edges := n.Edges.Merge(other.Edges)
+	if edges.Size() == 0 {
+		return edges
+	}
+	return answeredEdges(answeredEdges(edges, n), other)
+}
+
+func answeredEdges(edges EdgeMetadatas, n Node) EdgeMetadatas {
+	for _, adjacent := range n.Adjacency {
+		if md, _ := n.Edges.Lookup(adjacent); !md.Attempted {
+			edges = edges.Answered(adjacent)
+		}
+	}
+	return edges
+}
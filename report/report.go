@@ -3,6 +3,8 @@ package report
 import (
 	"fmt"
 	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,22 +14,33 @@ import (
 
 // Names of the various topologies.
 const (
-	Endpoint       = "endpoint"
-	Process        = "process"
-	Container      = "container"
-	Pod            = "pod"
-	Service        = "service"
-	Deployment     = "deployment"
-	ReplicaSet     = "replica_set"
-	DaemonSet      = "daemon_set"
-	StatefulSet    = "stateful_set"
-	CronJob        = "cron_job"
-	ContainerImage = "container_image"
-	Host           = "host"
-	Overlay        = "overlay"
-	ECSService     = "ecs_service"
-	ECSTask        = "ecs_task"
-	SwarmService   = "swarm_service"
+	Endpoint        = "endpoint"
+	Process         = "process"
+	Container       = "container"
+	Pod             = "pod"
+	Service         = "service"
+	Deployment      = "deployment"
+	ReplicaSet      = "replica_set"
+	DaemonSet       = "daemon_set"
+	StatefulSet     = "stateful_set"
+	CronJob         = "cron_job"
+	CustomResource  = "custom_resource"
+	NetworkPolicy   = "network_policy"
+	ContainerImage  = "container_image"
+	Host            = "host"
+	Overlay         = "overlay"
+	ECSService      = "ecs_service"
+	ECSTask         = "ecs_task"
+	ECSStack        = "ecs_stack"
+	SwarmService    = "swarm_service"
+	SwarmStack      = "swarm_stack"
+	NomadJob        = "nomad_job"
+	NomadTaskGroup  = "nomad_task_group"
+	NomadAllocation = "nomad_allocation"
+	NetIface        = "net_iface"
+	ScopeComponent  = "scope_component"
+	SystemdUnit     = "systemd_unit"
+	VirtualMachine  = "virtual_machine"
 
 	// Shapes used for different nodes
 	Circle   = "circle"
@@ -95,6 +108,16 @@ type Report struct {
 	// present.
 	CronJob Topology
 
+	// CustomResource nodes represent instances of the Kubernetes Custom
+	// Resources the probes have been configured to report. Metadata includes
+	// things like kind, name, etc. Edges are not present.
+	CustomResource Topology
+
+	// NetworkPolicy nodes represent all Kubernetes Network Policies. They
+	// are not rendered themselves, but are used to annotate the edges
+	// between pods. Edges are not present.
+	NetworkPolicy Topology
+
 	// ContainerImages nodes represent all Docker containers images on
 	// hosts running probes. Metadata includes things like image id, name etc.
 	// Edges are not present.
@@ -114,11 +137,51 @@ type Report struct {
 	// Metadata is limited for now, more to come later. Edges are not present.
 	ECSService Topology
 
+	// ECS Stack nodes are the CloudFormation stacks and Terraform workspaces
+	// which created ECS services and tasks, from their tags. Edges are not
+	// present.
+	ECSStack Topology
+
 	// Swarm Service nodes are Docker Swarm services, which represent a specification for a
 	// group of tasks (either one per host, or a desired count).
 	// Edges are not present.
 	SwarmService Topology
 
+	// Swarm Stack nodes are Docker stacks, which are groups of Swarm services
+	// deployed together. Edges are not present.
+	SwarmStack Topology
+
+	// Nomad Job nodes are HashiCorp Nomad jobs, which declare groups of tasks
+	// to be scheduled. Edges are not present.
+	NomadJob Topology
+
+	// Nomad Task Group nodes are the groups of tasks of Nomad jobs, which are
+	// placed together, as an allocation. Edges are not present.
+	NomadTaskGroup Topology
+
+	// Nomad Allocation nodes are instances of Nomad task groups, placed on a
+	// client node. Edges are not present.
+	NomadAllocation Topology
+
+	// NetIface nodes are the network interfaces of hosts: devices, bridges
+	// and veths. Edges go from bridge ports to their bridge, and from veths
+	// to the containers which hold their peers.
+	NetIface Topology
+
+	// ScopeComponent nodes are the apps, probes and plugins of Scope itself.
+	// Edges go from probes to the apps they publish to, with the latency of
+	// publishing, and from plugins to their probes.
+	ScopeComponent Topology
+
+	// SystemdUnit nodes are the systemd services of hosts. Metadata includes
+	// their states; processes have them as parents.
+	SystemdUnit Topology
+
+	// VirtualMachine nodes are the libvirt domains of hosts. Metadata includes
+	// their states and the addresses of their interfaces; metrics their vCPU
+	// and memory usage.
+	VirtualMachine Topology
+
 	// Overlay nodes are active peers in any software-defined network that's
 	// overlaid on the infrastructure. The information is scraped by polling
 	// their status endpoints. Edges could be present, but aren't currently.
@@ -141,6 +204,27 @@ type Report struct {
 
 	Plugins xfer.PluginSpecs
 
+	// Baseline is the ID of the full report an incremental report is a delta
+	// of: its nodes are the nodes of the baseline, with the ones here added
+	// or replaced, and the ones in Removed taken out. Apps resolve
+	// incremental reports before adding them.
+	Baseline string `json:"baseline,omitempty"`
+
+	// Removed are the IDs of the nodes of the baseline which are gone, by
+	// topology.
+	Removed map[string][]string `json:"removed,omitempty"`
+
+	// Touched are the IDs of the nodes of the baseline which an incremental
+	// report leaves out as their values are the same, but whose timestamps
+	// are newer, by topology, with the newest of them. Resolving the report
+	// bumps the older timestamps of the nodes to it.
+	Touched map[string]map[string]time.Time `json:"touched,omitempty"`
+
+	// Stale are the names of the reporters and taggers of probes which ran
+	// past their deadlines: the nodes of late reporters are from an earlier
+	// report, and late taggers left theirs untagged.
+	Stale StringSet `json:"stale,omitempty"`
+
 	// ID a random identifier for this report, used when caching
 	// rendered views of the report.  Reports with the same id
 	// must be equal, but we don't require that equal reports have
@@ -152,6 +236,27 @@ type Report struct {
 type RenderContext struct {
 	Report
 	MetricsGraphURL string
+	MetricHistory   MetricHistory `json:"-"`
+	Anomalies       Anomalies     `json:"-"`
+	Annotations     Annotations   `json:"-"`
+}
+
+// MetricHistory gives the history of the metrics of nodes, over ranges
+// longer than the window of the report being rendered.
+type MetricHistory interface {
+	MetricHistory(nodeID, metricID string, d time.Duration) (Metric, bool)
+}
+
+// Anomalies gives the IDs of the metrics of nodes which deviate from their
+// baselines.
+type Anomalies interface {
+	Anomalies(nodeID string) []string
+}
+
+// Annotations gives the metadata rows users annotated nodes with, which
+// are kept by the app rather than reported by probes.
+type Annotations interface {
+	Annotations(nodeID string) []MetadataRow
 }
 
 // MakeReport makes a clean report, ready to Merge() other reports into.
@@ -203,6 +308,14 @@ func MakeReport() Report {
 			WithShape(Triangle).
 			WithLabel("cron job", "cron jobs"),
 
+		CustomResource: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("custom resource", "custom resources"),
+
+		NetworkPolicy: MakeTopology().
+			WithShape(Square).
+			WithLabel("network policy", "network policies"),
+
 		Overlay: MakeTopology().
 			WithShape(Circle).
 			WithLabel("peer", "peers"),
@@ -215,10 +328,46 @@ func MakeReport() Report {
 			WithShape(Heptagon).
 			WithLabel("service", "services"),
 
+		ECSStack: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("stack", "stacks"),
+
 		SwarmService: MakeTopology().
 			WithShape(Heptagon).
 			WithLabel("service", "services"),
 
+		SwarmStack: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("stack", "stacks"),
+
+		NomadJob: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("job", "jobs"),
+
+		NomadTaskGroup: MakeTopology().
+			WithShape(Hexagon).
+			WithLabel("task group", "task groups"),
+
+		NomadAllocation: MakeTopology().
+			WithShape(Heptagon).
+			WithLabel("allocation", "allocations"),
+
+		NetIface: MakeTopology().
+			WithShape(Square).
+			WithLabel("interface", "interfaces"),
+
+		ScopeComponent: MakeTopology().
+			WithShape(Square).
+			WithLabel("component", "components"),
+
+		SystemdUnit: MakeTopology().
+			WithShape(Pentagon).
+			WithLabel("unit", "units"),
+
+		VirtualMachine: MakeTopology().
+			WithShape(Square).
+			WithLabel("VM", "VMs"),
+
 		Sampling: Sampling{},
 		Window:   0,
 		Plugins:  xfer.MakePluginSpecs(),
@@ -229,22 +378,33 @@ func MakeReport() Report {
 // TopologyMap gets a map from topology names to pointers to the respective topologies
 func (r *Report) TopologyMap() map[string]*Topology {
 	return map[string]*Topology{
-		Endpoint:       &r.Endpoint,
-		Process:        &r.Process,
-		Container:      &r.Container,
-		ContainerImage: &r.ContainerImage,
-		Pod:            &r.Pod,
-		Service:        &r.Service,
-		Deployment:     &r.Deployment,
-		ReplicaSet:     &r.ReplicaSet,
-		DaemonSet:      &r.DaemonSet,
-		StatefulSet:    &r.StatefulSet,
-		CronJob:        &r.CronJob,
-		Host:           &r.Host,
-		Overlay:        &r.Overlay,
-		ECSTask:        &r.ECSTask,
-		ECSService:     &r.ECSService,
-		SwarmService:   &r.SwarmService,
+		Endpoint:        &r.Endpoint,
+		Process:         &r.Process,
+		Container:       &r.Container,
+		ContainerImage:  &r.ContainerImage,
+		Pod:             &r.Pod,
+		Service:         &r.Service,
+		Deployment:      &r.Deployment,
+		ReplicaSet:      &r.ReplicaSet,
+		DaemonSet:       &r.DaemonSet,
+		StatefulSet:     &r.StatefulSet,
+		CronJob:         &r.CronJob,
+		CustomResource:  &r.CustomResource,
+		NetworkPolicy:   &r.NetworkPolicy,
+		Host:            &r.Host,
+		Overlay:         &r.Overlay,
+		ECSTask:         &r.ECSTask,
+		ECSService:      &r.ECSService,
+		ECSStack:        &r.ECSStack,
+		SwarmService:    &r.SwarmService,
+		SwarmStack:      &r.SwarmStack,
+		NomadJob:        &r.NomadJob,
+		NomadTaskGroup:  &r.NomadTaskGroup,
+		NomadAllocation: &r.NomadAllocation,
+		NetIface:        &r.NetIface,
+		ScopeComponent:  &r.ScopeComponent,
+		SystemdUnit:     &r.SystemdUnit,
+		VirtualMachine:  &r.VirtualMachine,
 	}
 }
 
@@ -254,6 +414,7 @@ func (r Report) Copy() Report {
 		Sampling: r.Sampling,
 		Window:   r.Window,
 		Plugins:  r.Plugins.Copy(),
+		Stale:    r.Stale,
 		ID:       fmt.Sprintf("%d", rand.Int63()),
 	}
 	newReport.WalkPairedTopologies(&r, func(newTopology, oldTopology *Topology) {
@@ -269,6 +430,7 @@ func (r Report) Merge(other Report) Report {
 	newReport.Sampling = newReport.Sampling.Merge(other.Sampling)
 	newReport.Window = newReport.Window + other.Window
 	newReport.Plugins = newReport.Plugins.Merge(other.Plugins)
+	newReport.Stale = newReport.Stale.Merge(other.Stale)
 	newReport.WalkPairedTopologies(&other, func(ourTopology, theirTopology *Topology) {
 		*ourTopology = ourTopology.Merge(*theirTopology)
 	})
@@ -305,11 +467,22 @@ func (r *Report) WalkPairedTopologies(o *Report, f func(*Topology, *Topology)) {
 	f(&r.DaemonSet, &o.DaemonSet)
 	f(&r.StatefulSet, &o.StatefulSet)
 	f(&r.CronJob, &o.CronJob)
+	f(&r.CustomResource, &o.CustomResource)
+	f(&r.NetworkPolicy, &o.NetworkPolicy)
 	f(&r.Host, &o.Host)
 	f(&r.Overlay, &o.Overlay)
 	f(&r.ECSTask, &o.ECSTask)
 	f(&r.ECSService, &o.ECSService)
+	f(&r.ECSStack, &o.ECSStack)
 	f(&r.SwarmService, &o.SwarmService)
+	f(&r.SwarmStack, &o.SwarmStack)
+	f(&r.NomadJob, &o.NomadJob)
+	f(&r.NomadTaskGroup, &o.NomadTaskGroup)
+	f(&r.NomadAllocation, &o.NomadAllocation)
+	f(&r.NetIface, &o.NetIface)
+	f(&r.ScopeComponent, &o.ScopeComponent)
+	f(&r.SystemdUnit, &o.SystemdUnit)
+	f(&r.VirtualMachine, &o.VirtualMachine)
 }
 
 // Topology gets a topology by name
@@ -420,6 +593,40 @@ const (
 	// a node in the host topology. That host node is the origin host, where
 	// the node was originally detected.
 	HostNodeID = "host_node_id"
+	// ClusterID is on the nodes of probes given a cluster ID, which scopes
+	// their private addresses (see AddressScope).
+	ClusterID = "cluster_id"
 	// ControlProbeID is the random ID of the probe which controls the specific node.
 	ControlProbeID = "control_probe_id"
+	// TruncatedTopologies is on the host nodes of probes which left out
+	// topologies to keep their reports within their size budget: the number
+	// of nodes left out of each, as topology=count, comma-separated.
+	TruncatedTopologies = "truncated_topologies"
 )
+
+// FormatTruncated formats the number of nodes left out of each topology, as
+// in TruncatedTopologies.
+func FormatTruncated(truncated map[string]int) string {
+	parts := make([]string, 0, len(truncated))
+	for topology, count := range truncated {
+		parts = append(parts, topology+"="+strconv.Itoa(count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// ParseTruncated parses the number of nodes left out of each topology, as
+// in TruncatedTopologies.
+func ParseTruncated(s string) map[string]int {
+	result := map[string]int{}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if count, err := strconv.Atoi(kv[1]); err == nil {
+			result[kv[0]] = count
+		}
+	}
+	return result
+}
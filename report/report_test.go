@@ -121,3 +121,88 @@ func TestReportUpgrade(t *testing.T) {
 		t.Error(test.Diff(expected, got))
 	}
 }
+
+func TestReportDelta(t *testing.T) {
+	then, now := time.Unix(1000, 0).UTC(), time.Unix(1010, 0).UTC()
+	baseline := report.MakeReport()
+	baseline.Host.AddNode(report.MakeNode("unchanged").WithLatest("name", then, "a"))
+	baseline.Host.AddNode(report.MakeNode("changed").WithLatest("name", then, "b"))
+	baseline.Host.AddNode(report.MakeNode("removed").WithLatest("name", then, "c"))
+
+	r := report.MakeReport()
+	r.Host.AddNode(report.MakeNode("unchanged").WithLatest("name", now, "a"))
+	r.Host.AddNode(report.MakeNode("changed").WithLatest("name", now, "B"))
+	r.Host.AddNode(report.MakeNode("added").WithLatest("name", now, "d"))
+
+	delta := r.Delta(baseline)
+	if !delta.IsDelta() || delta.Baseline != baseline.ID {
+		t.Fatalf("Expected a delta of %s, got one of %q", baseline.ID, delta.Baseline)
+	}
+	if want, have := []string{"removed"}, delta.Removed[report.Host]; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected removed nodes %v, got %v", want, have)
+	}
+	if _, ok := delta.Host.Nodes["unchanged"]; ok || len(delta.Host.Nodes) != 2 {
+		t.Errorf("Expected the changed and added nodes, got %v", delta.Host.Nodes)
+	}
+	if len(r.Host.Nodes) != 3 {
+		t.Errorf("Delta modified the report")
+	}
+
+	if _, err := delta.Resolve(r); err == nil {
+		t.Errorf("Expected an error resolving against the wrong baseline")
+	}
+	full, err := delta.Resolve(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.IsDelta() || full.Removed != nil {
+		t.Errorf("Expected a full report")
+	}
+	want := map[string]string{"unchanged": "a", "changed": "B", "added": "d"}
+	have := map[string]string{}
+	for id, n := range full.Host.Nodes {
+		have[id], _ = n.Latest.Lookup("name")
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if len(baseline.Host.Nodes) != 3 {
+		t.Errorf("Resolve modified the baseline")
+	}
+}
+
+func TestReportDeltaTimestamps(t *testing.T) {
+	then, now := time.Unix(1000, 0).UTC(), time.Unix(1010, 0).UTC()
+	baseline := report.MakeReport()
+	baseline.Host.AddNode(report.MakeNode("refreshed").WithLatest("name", then, "a"))
+	baseline.Host.AddNode(report.MakeNode("stale").WithLatest("name", then, "b"))
+
+	r := report.MakeReport()
+	r.Host.AddNode(report.MakeNode("refreshed").WithLatest("name", now, "a"))
+	r.Host.AddNode(report.MakeNode("stale").WithLatest("name", then, "b"))
+
+	// Neither node is sent, but the timestamps of the refreshed one are
+	delta := r.Delta(baseline)
+	if len(delta.Host.Nodes) != 0 {
+		t.Errorf("Expected no nodes, got %v", delta.Host.Nodes)
+	}
+	if want, have := map[string]time.Time{"refreshed": now}, delta.Touched[report.Host]; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected touched nodes %v, got %v", want, have)
+	}
+
+	full, err := delta.Resolve(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Time{"refreshed": now, "stale": then}
+	have := map[string]time.Time{}
+	for id, n := range full.Host.Nodes {
+		_, have[id], _ = n.Latest.LookupEntry("name")
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected timestamps %v, got %v", want, have)
+	}
+	if _, ts, _ := baseline.Host.Nodes["refreshed"].Latest.LookupEntry("name"); !ts.Equal(then) {
+		t.Errorf("Resolve modified the baseline")
+	}
+}
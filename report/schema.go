@@ -0,0 +1,32 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SchemaVersion is the version of the schema of reports, which probes
+// publish them with. It is bumped whenever reports change in ways apps
+// would misread; apps reject the reports of versions they don't read,
+// rather than merging them.
+const SchemaVersion = 1
+
+// MinSchemaVersion is the oldest schema version of reports apps read.
+const MinSchemaVersion = 1
+
+// CheckSchemaVersion checks that reports of a schema version, as published
+// with them, can be read. Reports without schema versions, of older probes,
+// are read as ever.
+func CheckSchemaVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return fmt.Errorf("Invalid report schema version %q", version)
+	}
+	if v < MinSchemaVersion || v > SchemaVersion {
+		return fmt.Errorf("Unsupported report schema version %d: versions %d to %d are supported", v, MinSchemaVersion, SchemaVersion)
+	}
+	return nil
+}
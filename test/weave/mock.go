@@ -17,6 +17,8 @@ const (
 	MockHostname           = "hostname.weave.local"
 	MockProxyAddress       = "unix:///foo/bar/weave.sock"
 	MockDriverName         = "weave_mock"
+	MockLostPeerName       = "ba:d0:ba:d0:ba:d0"
+	MockLostPeerNickName   = "gone"
 )
 
 // MockClient is a mock version of weave.Client
@@ -33,6 +35,14 @@ func (MockClient) Status() (weave.Status, error) {
 					NickName: MockWeavePeerNickName,
 				},
 			},
+			Connections: []weave.Connection{
+				{
+					Address:  "10.0.0.2:6783",
+					Outbound: true,
+					State:    "established",
+					Attrs:    weave.ConnectionAttrs{Name: "fastdp", Encrypted: true, MTU: 1376},
+				},
+			},
 		},
 		DNS: &weave.DNS{
 			Entries: []struct {
@@ -49,11 +59,9 @@ func (MockClient) Status() (weave.Status, error) {
 		},
 		IPAM: &weave.IPAM{
 			DefaultSubnet: MockWeaveDefaultSubnet,
-			Entries: []struct {
-				Size        uint32
-				IsKnownPeer bool
-			}{
-				{Size: 0, IsKnownPeer: false},
+			Entries: []weave.IPAMEntry{
+				{Token: "10.32.0.0", Size: 0, Peer: MockWeavePeerName, Nickname: MockWeavePeerNickName, IsKnownPeer: false},
+				{Token: "10.40.0.0", Size: 524288, Peer: MockLostPeerName, Nickname: MockLostPeerNickName, IsKnownPeer: false},
 			},
 		},
 		Proxy: &weave.Proxy{
@@ -70,6 +78,11 @@ func (MockClient) AddDNSEntry(fqdn, containerid string, ip net.IP) error {
 	return nil
 }
 
+// RemovePeer implements weave.Client
+func (MockClient) RemovePeer(name string) (string, error) {
+	return "524288 IPs taken over from " + name, nil
+}
+
 // PS implements weave.Client
 func (MockClient) PS() (map[string]weave.PSEntry, error) {
 	return map[string]weave.PSEntry{